@@ -2,16 +2,26 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/smartcat999/container-ui/internal/cert"
 	"github.com/smartcat999/container-ui/internal/config"
+	"github.com/smartcat999/container-ui/internal/proxy"
+	"github.com/smartcat999/container-ui/internal/ratelimit"
 	"github.com/smartcat999/container-ui/internal/registry"
 	"github.com/smartcat999/container-ui/internal/server"
+	"github.com/smartcat999/container-ui/internal/storage"
 	"github.com/smartcat999/container-ui/internal/utils"
 )
 
@@ -22,29 +32,216 @@ func main() {
 	// 解析命令行参数
 	var (
 		listenAddr = flag.String("listen", ":80", "HTTP监听地址")
-		configType = flag.String("config-type", "memory", "配置存储类型 (memory, file)")
-		configPath = flag.String("config-path", "", "配置文件路径 (仅用于 file 类型)")
+		configType = flag.String("config-type", "memory", "配置存储类型 (memory, file, etcd, kubernetes)")
+		configPath = flag.String("config-path", "", "配置文件路径 (file 类型)；逗号分隔的 etcd 地址 (etcd 类型)，例如 https://etcd-0:2379,https://etcd-1:2379；"+
+			"configmap/<名称> 使用 ConfigMap 中的 registries.json，为空时使用 RegistryProxy 自定义资源 (kubernetes 类型)")
+		watchCfg   = flag.Bool("watch-config", true, "修改配置文件后自动重新加载，不需要重启；也可以发送 SIGHUP 或调用 POST /api/v1/reload (file 类型)")
+		credKey    = flag.String("credential-key-file", "", "加密保存仓库用户名和密码的 32 字节密钥文件 (原始、十六进制或 base64)，环境变量 "+config.CredentialKeyEnv+" 优先；为空时凭据按原样保存")
+		kubeNS     = flag.String("kube-namespace", "", "读取 ConfigMap 或自定义资源的命名空间，默认为 Pod 所在的命名空间 (kubernetes 类型)")
+		etcdPrefix = flag.String("etcd-prefix", "", "仓库配置在 etcd 中的键前缀，默认为 /container-ui/registries/")
+		etcdUser   = flag.String("etcd-username", "", "etcd 用户名")
+		etcdPass   = flag.String("etcd-password", os.Getenv("CONTAINER_UI_ETCD_PASSWORD"), "etcd 密码，默认读取 CONTAINER_UI_ETCD_PASSWORD")
+		etcdCA     = flag.String("etcd-ca-cert", "", "校验 etcd 服务端证书的 CA 证书路径")
+		etcdCert   = flag.String("etcd-cert", "", "连接 etcd 的客户端证书路径")
+		etcdKey    = flag.String("etcd-key", "", "连接 etcd 的客户端私钥路径")
 		adminAPI   = flag.Bool("admin-api", true, "启用管理API")
 		adminAddr  = flag.String("admin-addr", ":5001", "管理API监听地址")
+		ipRate     = flag.Float64("rate-limit", 100, "每个客户端 IP 每秒允许的请求数，0 表示不限流")
+		ipBurst    = flag.Int("rate-burst", 200, "每个客户端 IP 允许的突发请求数")
+		tokenRate  = flag.Float64("token-rate-limit", 0, "每个凭据 (Authorization 头) 每秒允许的请求数，0 表示不限流")
+		tokenBurst = flag.Int("token-rate-burst", 0, "每个凭据允许的突发请求数")
+		maxBody    = flag.Int64("max-body-size", 0, "请求体大小上限 (字节)，0 表示不限制")
+		cacheType  = flag.String("cache-type", "", "拉取缓存的存储类型 (memory, file, distribution)，为空时不缓存")
+		cacheDir   = flag.String("cache-dir", "", "拉取缓存目录 (仅用于 file 类型)")
+		bandwidth  = flag.Int64("bandwidth", 0, "所有响应的总带宽上限 (字节/秒)，0 表示不限制")
+		clientBw   = flag.Int64("client-bandwidth", 0, "每个客户端 IP 的带宽上限 (字节/秒)，0 表示不限制")
+		healthIntv = flag.Duration("health-interval", 30*time.Second, "上游健康探测 (GET /v2/) 的间隔，0 表示不探测")
+		connect    = flag.Bool("connect", false, "作为 HTTPS_PROXY 使用：拦截发往已配置仓库的 CONNECT 请求，其他主机默认拒绝")
+		passthru   = flag.String("connect-passthrough", "", "不拦截、直接建立隧道的主机，逗号分隔，支持 *.example.com，* 表示全部主机；只允许 443 端口 (用于 -connect)")
+		tlsListen  = flag.String("tls-listen", "", "HTTPS 监听地址，例如 :443，DNS 把仓库主机名指向代理时使用；证书按 SNI 由 CA 签发，包含仓库配置的 dnsNames")
+		caCert     = flag.String("ca-cert", "", "签发拦截证书的 CA 证书路径，不存在时自动生成；使用企业 CA 时指定已有的证书 (可包含中间 CA 证书链) (用于 -connect 和 -tls-listen)")
+		caKey      = flag.String("ca-key", "", "签发拦截证书的 CA 私钥路径，也可以是已注册的外部签名后端地址 (KMS、HSM)，例如 awskms://alias/registry-ca (用于 -connect 和 -tls-listen)")
+		keyPass    = flag.String("key-passphrase", os.Getenv("CONTAINER_UI_KEY_PASSPHRASE"), "加密保存 CA、主机证书和 ACME 证书私钥的口令，默认读取 CONTAINER_UI_KEY_PASSPHRASE，为空时私钥以明文保存")
+		certDir    = flag.String("cert-dir", "", "证书目录，保存自动生成的 CA (未指定 -ca-cert 时) 和签发的主机证书，重启后继续使用 (用于 -connect 和 -tls-listen)")
+		unified    = flag.Bool("unified-cert", false, "HTTPS 监听使用同一个包含全部仓库主机名和 dnsNames 的证书，配置变化后自动重新签发，用于不发送 SNI 的客户端 (用于 -tls-listen)")
+		crlURL     = flag.String("crl-url", "", "写入签发证书的 CRL 分发地址，例如 http://proxy.example.com:3128/ca.crl，严格校验吊销状态的客户端从该地址获取 CRL")
+		acmeDomain = flag.String("acme-domains", "", "通过 ACME 申请公开信任证书的域名，逗号分隔，例如路径路由使用的镜像域名和管理接口域名；HTTP-01 验证需要 -listen 可以从公网 80 端口访问，TLS-ALPN-01 验证需要 -tls-listen 可以从 443 端口访问")
+		acmeEmail  = flag.String("acme-email", "", "ACME 账户的联系邮箱")
+		acmeURL    = flag.String("acme-directory", "", "ACME 服务地址，为空时使用 Let's Encrypt 正式环境")
+		acmeCache  = flag.String("acme-cache-dir", "", "保存 ACME 账户和证书的目录，为空时使用 -cert-dir 下的 acme 目录")
+		adminTLS   = flag.Bool("admin-tls", false, "管理接口使用 HTTPS，证书通过 ACME 申请，-acme-domains 需要包含访问管理接口的域名")
+		pathRoute  = flag.Bool("path-routing", false, "按路径前缀路由上游，例如 /v2/docker.io/library/nginx，适用于无法劫持 DNS 的环境")
+		validate   = flag.Bool("validate-config", false, "只校验仓库配置 (主机名、上游地址、凭据、dnsNames、改写规则和 TLS 设置) 后退出，不启动服务；配置有误时退出码为 1")
 	)
 	flag.Parse()
 
+	// 凭据加密密钥需要在读取配置之前加载
+	if err := config.LoadCredentialKey(*credKey); err != nil {
+		log.Fatalf("Failed to load credential key: %v", err)
+	}
+
+	storeOpts := config.StoreOptions{
+		Etcd: config.EtcdConfig{
+			Prefix:   *etcdPrefix,
+			Username: *etcdUser,
+			Password: *etcdPass,
+			CACert:   *etcdCA,
+			Cert:     *etcdCert,
+			Key:      *etcdKey,
+		},
+		Kubernetes: config.KubernetesConfig{Namespace: *kubeNS},
+	}
+	if *validate {
+		os.Exit(validateConfigs(*configType, *configPath, storeOpts))
+	}
+
 	// 创建配置存储
-	store, err := config.CreateConfigStore(*configType, *configPath)
+	storeOpts.WatchFile = *watchCfg
+	store, err := config.CreateConfigStoreWithOptions(*configType, *configPath, storeOpts)
 	if err != nil {
 		log.Fatalf("Failed to create config store: %v", err)
 	}
 
+	// 创建拉取缓存，命中时不再请求上游
+	var cache storage.Storage
+	if *cacheType != "" {
+		cache, err = storage.CreateStorage(*cacheType, *cacheDir)
+		if err != nil {
+			log.Fatalf("Failed to create cache storage: %v", err)
+		}
+		log.Printf("Pull-through cache enabled: %s %s", *cacheType, *cacheDir)
+	}
+
 	// 创建仓库管理器
-	registryManager := registry.NewManager(store)
+	registryManager := registry.NewManagerWithOptions(store, registry.ManagerOptions{
+		Cache:               cache,
+		Bandwidth:           *bandwidth,
+		ClientBandwidth:     *clientBw,
+		HealthCheckInterval: *healthIntv,
+	})
 	defer registryManager.Close()
 
 	// 创建上下文以支持优雅关闭
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// 创建代理处理器
-	proxyHandler := server.CreateProxyHandler(registryManager)
+	// 创建代理处理器，并按客户端限流以保护上游仓库
+	ipLimiter := ratelimit.NewLimiter(*ipRate, *ipBurst)
+	defer ipLimiter.Close()
+	tokenLimiter := ratelimit.NewLimiter(*tokenRate, *tokenBurst)
+	defer tokenLimiter.Close()
+	handler := server.CreateProxyHandler(registryManager)
+	if *pathRoute {
+		handler = server.CreatePathRoutingHandler(registryManager)
+		log.Printf("Path-based routing enabled")
+	}
+	proxyHandler := ratelimit.Middleware(handler, ratelimit.Options{
+		PerIP:       ipLimiter,
+		PerToken:    tokenLimiter,
+		MaxBodySize: *maxBody,
+	})
+
+	// 正向代理和 HTTPS 模式使用 CA 按 SNI 签发证书，只为已配置的仓库签发，证书包含配置的 DNSNames；
+	// 使用 ACME 时 HTTPS 只提供 ACME 域名的证书，除非同时启用正向代理
+	var certs *cert.Manager
+	if *connect || (*tlsListen != "" && *acmeDomain == "") {
+		var unifiedNames func() []string
+		if *unified {
+			unifiedNames = func() []string {
+				configs, err := registryManager.ListConfigs()
+				if err != nil {
+					log.Printf("Failed to list registry configs: %v", err)
+				}
+				var names []string
+				for _, cfg := range configs {
+					names = append(names, cfg.HostName)
+					names = append(names, cfg.GetDNSNames()...)
+				}
+				return names
+			}
+		}
+		certs, err = cert.NewManagerWithOptions(cert.Options{
+			Dir:        *certDir,
+			CACert:     *caCert,
+			CAKey:      *caKey,
+			Passphrase: *keyPass,
+			CRLURL:     *crlURL,
+			Unified:    unifiedNames,
+			Hosts: func(host string) ([]string, bool) {
+				cfg, ok := registryManager.MatchConfig(host)
+				return cfg.GetDNSNames(), ok
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to load CA: %v", err)
+		}
+		// 配置变化后丢弃按旧配置签发的证书，例如 DNSNames 减少后不再包含删除的名称
+		if watchable, ok := store.(config.Watchable); ok {
+			watchable.OnChange(certs.Invalidate)
+		}
+		if *caCert == "" && *certDir == "" {
+			log.Printf("Warning: using an in-memory CA, clients must trust %s again after restart", proxy.CACertPath)
+		}
+	}
+
+	// 代理部署在公网域名上时通过 ACME 申请公开信任的证书并自动续期
+	var acmeCerts *cert.ACME
+	if *acmeDomain != "" {
+		cacheDir := *acmeCache
+		if cacheDir == "" && *certDir != "" {
+			cacheDir = filepath.Join(*certDir, "acme")
+		}
+		acmeCerts, err = cert.NewACME(cert.ACMEOptions{
+			Domains:      strings.Split(*acmeDomain, ","),
+			Email:        *acmeEmail,
+			CacheDir:     cacheDir,
+			DirectoryURL: *acmeURL,
+			Passphrase:   *keyPass,
+		})
+		if err != nil {
+			log.Fatalf("Failed to configure ACME: %v", err)
+		}
+	}
+	if *adminTLS && acmeCerts == nil {
+		log.Fatalf("-admin-tls requires -acme-domains")
+	}
+
+	// DNS 指向代理时客户端直接以 HTTPS 访问仓库主机名
+	var tlsServer *http.Server
+	if *tlsListen != "" {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if certs != nil {
+			tlsConfig.GetCertificate = certs.GetCertificate
+		}
+		if acmeCerts != nil {
+			tlsConfig = acmeCerts.TLSConfig(tlsConfig.GetCertificate)
+		}
+		tlsServer = server.StartServerWithOptions(ctx, server.ServerOptions{
+			Addr:      *tlsListen,
+			Handler:   proxyHandler,
+			Manager:   registryManager,
+			TLSConfig: tlsConfig,
+		})
+	}
+
+	// 正向代理模式，客户端需要信任 CA 证书，可以从 /ca.crt 下载
+	if *connect {
+		intercept := func(host string) bool {
+			_, ok := registryManager.MatchConfig(host)
+			return ok
+		}
+		var passthrough []string
+		if *passthru != "" {
+			passthrough = strings.Split(*passthru, ",")
+		}
+		proxyHandler = proxy.NewConnectHandlerWithOptions(certs, intercept, proxyHandler, proxy.ConnectOptions{Passthrough: passthrough})
+		log.Printf("CONNECT proxy mode enabled")
+	}
+
+	// HTTP-01 验证请求由 HTTP 代理服务处理
+	if acmeCerts != nil {
+		proxyHandler = acmeCerts.HTTPHandler(proxyHandler)
+	}
 
 	// 启动HTTP代理服务
 	proxyServer := server.StartServer(ctx, *listenAddr, proxyHandler, registryManager)
@@ -52,17 +249,61 @@ func main() {
 	// 如果启用了管理API，启动管理服务
 	var adminServer *http.Server
 	if *adminAPI {
-		adminServer = server.StartAdminServer(ctx, *adminAddr, registryManager)
+		adminOpts := server.AdminOptions{Certs: certs, ProxyAddr: *listenAddr}
+		if *adminTLS {
+			adminOpts.TLSConfig = acmeCerts.TLSConfig(nil)
+		}
+		adminServer = server.StartAdminServerWithOptions(ctx, *adminAddr, registryManager, adminOpts)
 	}
 
 	// 处理信号以优雅关闭
-	handleSignals([]*http.Server{proxyServer, adminServer}, cancel)
+	handleSignals([]*http.Server{proxyServer, tlsServer, adminServer}, cancel)
+	handleReload(registryManager)
 
 	// 等待服务关闭
 	<-ctx.Done()
 	log.Println("所有服务已关闭")
 }
 
+// validateConfigs 校验配置存储中的全部仓库配置并输出结果，返回进程退出码。
+// file 类型直接读取文件，可以发现被覆盖的重复主机名
+func validateConfigs(configType, configPath string, opts config.StoreOptions) int {
+	var configs []config.Config
+	if configType == "file" {
+		var err error
+		if configs, err = config.ReadConfigFile(configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read config file: %v\n", err)
+			return 1
+		}
+	} else {
+		store, err := config.CreateConfigStoreWithOptions(configType, configPath, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create config store: %v\n", err)
+			return 1
+		}
+		defer store.Close()
+		// List 返回的配置不含凭据，逐个读取完整配置
+		redacted, err := store.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list registry configs: %v\n", err)
+			return 1
+		}
+		for _, cfg := range redacted {
+			if full, ok, err := store.Get(cfg.HostName); err == nil && ok {
+				configs = append(configs, full)
+			}
+		}
+		sort.Slice(configs, func(i, j int) bool { return configs[i].HostName < configs[j].HostName })
+	}
+
+	if err := registry.ValidateConfigs(configs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%d registry configs are valid\n", len(configs))
+	return 0
+}
+
 // handleSignals 处理系统信号以优雅关闭
 func handleSignals(servers []*http.Server, cancel context.CancelFunc) {
 	sigChan := make(chan os.Signal, 1)
@@ -79,3 +320,17 @@ func handleSignals(servers []*http.Server, cancel context.CancelFunc) {
 		cancel()
 	}()
 }
+
+// handleReload 收到 SIGHUP 时重新读取配置文件
+func handleReload(manager *registry.Manager) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+
+	go func() {
+		for range sigChan {
+			if _, err := manager.ReloadConfigs(); err != nil {
+				log.Printf("Failed to reload registry configs: %v", err)
+			}
+		}
+	}()
+}
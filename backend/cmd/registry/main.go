@@ -1,29 +1,145 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 
+	"github.com/smartcat999/container-ui/internal/auth"
+	"github.com/smartcat999/container-ui/internal/config"
+	"github.com/smartcat999/container-ui/internal/registry"
 	"github.com/smartcat999/container-ui/internal/server"
+	"github.com/smartcat999/container-ui/internal/storage"
 )
 
 func main() {
+	// registry gc [参数] 执行一次垃圾回收后退出
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		runGC(os.Args[2:])
+		return
+	}
+	// registry htpasswd <用户名> 从标准输入读取密码，输出一行 htpasswd 记录
+	if len(os.Args) > 1 && os.Args[1] == "htpasswd" {
+		runHtpasswd(os.Args[2:])
+		return
+	}
+
+	// registry migrate 把一个存储中的全部数据复制到另一个存储
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	// registry export|import 导出或导入 OCI image-layout / docker save 格式的归档
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		runExport(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
+
 	// 解析命令行参数
+	storageFlags := registerStorageFlags(flag.CommandLine)
 	var (
-		listenAddr = flag.String("listen", ":5050", "HTTP监听地址")
+		listenAddr        = flag.String("listen", ":5050", "HTTP监听地址")
+		adminAddr         = flag.String("admin-listen", "", "管理接口监听地址 (提供 /api/v1/gc)，为空时不启动")
+		maxBlobSize       = flag.Int64("max-blob-size", registry.DefaultMaxBlobSize, "单个 blob 上传的大小上限 (字节)，负数表示不限制")
+		deleteTagManifest = flag.Bool("delete-tag-manifest", false, "按标签删除清单时同时删除清单，默认只删除标签")
+		referenceCheck    = flag.String("manifest-reference-check", string(registry.ReferenceCheckStrict), "推送清单时对引用内容的检查：strict 要求配置、层和子清单已存在，mount 从可以拉取的其他仓库自动挂载缺少的 blob，off 不检查")
+		uploadTTL         = flag.Duration("upload-ttl", registry.DefaultUploadTTL, "未完成的上传没有写入多久后被清理，负数表示不清理")
+		htpasswdFile      = flag.String("auth-htpasswd", "", "htpasswd 文件，设置后启用令牌认证并由仓库服务器在 /auth/token 签发令牌")
+		authUserFile      = flag.String("auth-user-file", "", "界面的用户文件 (users.json)，设置后启用令牌认证并使用界面的用户登录")
+		authRealm         = flag.String("auth-realm", "", "外部令牌服务地址，例如 http://ui:8080/api/registry/token，设置后启用令牌认证")
+		authService       = flag.String("auth-service", auth.DefaultRegistryService, "令牌的 service，与令牌服务一致")
+		authSecretFile    = flag.String("auth-secret-file", "", "令牌签名密钥文件，使用外部令牌服务时必须与其共用；为空时每次启动随机生成")
+		notifyConfig      = flag.String("notifications-config", "", "通知配置文件 (YAML，endpoints 列表)，推送、拉取和删除事件会发送到其中的 webhook 地址")
+		aclFile           = flag.String("auth-acl-file", "", "仓库访问控制文件，通过管理接口 /api/v1/acls 修改；使用外部令牌服务时只用于过滤仓库目录")
+		maxRepoBytes      = flag.Int64("quota-repository-bytes", 0, "单个仓库的存储配额 (字节)，0 表示不限制")
+		maxTotalBytes     = flag.Int64("quota-total-bytes", 0, "所有仓库的存储配额 (字节)，0 表示不限制")
+		maxTags           = flag.Int("quota-tags", 0, "单个仓库的标签数量上限，0 表示不限制")
+		retentionConfig   = flag.String("retention-config", "", "保留策略配置文件 (YAML)，按间隔删除旧标签和过期的无标签清单并执行垃圾回收")
 	)
 	flag.Parse()
 
+	store, err := storageFlags.open()
+	if err != nil {
+		log.Fatalf("Failed to create storage: %v", err)
+	}
+	check, err := registry.ParseReferenceCheck(*referenceCheck)
+	if err != nil {
+		log.Fatalf("Invalid -manifest-reference-check: %v", err)
+	}
+	var acls config.ACLStore
+	if *aclFile != "" {
+		if acls, err = config.NewFileACLStore(*aclFile); err != nil {
+			log.Fatalf("Failed to load acls: %v", err)
+		}
+	}
+	var notifier *registry.Notifier
+	if *notifyConfig != "" {
+		endpoints, err := registry.LoadWebhookConfig(*notifyConfig)
+		if err != nil {
+			log.Fatalf("Failed to load notification config: %v", err)
+		}
+		notifier = registry.NewNotifier(endpoints)
+	}
+	var quota *registry.Quota
+	if *maxRepoBytes > 0 || *maxTotalBytes > 0 || *maxTags > 0 {
+		quota = registry.NewQuota(store, registry.QuotaOptions{
+			MaxRepositoryBytes: *maxRepoBytes,
+			MaxTotalBytes:      *maxTotalBytes,
+			MaxTags:            *maxTags,
+		})
+	}
+	tokenAuth, err := openTokenAuth(*htpasswdFile, *authUserFile, *authRealm, *authService, *authSecretFile, acls)
+	if err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+
 	// 创建上下文以支持优雅关闭
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// 启动仓库服务器
-	registryServer := server.StartRegistryServer(ctx, *listenAddr, nil)
+	registryServer := server.StartRegistryServerWithStorage(ctx, *listenAddr, nil, store, registry.HandlerOptions{
+		MaxBlobSize:       *maxBlobSize,
+		UploadTTL:         *uploadTTL,
+		DeleteTagManifest: *deleteTagManifest,
+		ReferenceCheck:    check,
+		Auth:              tokenAuth,
+		AuthRealm:         *authRealm,
+		Notifier:          notifier,
+		Quota:             quota,
+	})
+	gc := registry.NewGarbageCollector(store)
+	var retention *registry.Retention
+	if *retentionConfig != "" {
+		policy, err := registry.LoadRetentionConfig(*retentionConfig)
+		if err != nil {
+			log.Fatalf("Failed to load retention config: %v", err)
+		}
+		retention = registry.NewRetention(store, policy.Rules, gc)
+		go retention.Run(ctx, policy.Interval)
+	}
+	if *adminAddr != "" {
+		server.StartRegistryAdminServer(ctx, *adminAddr, server.RegistryAdminOptions{
+			GC:        gc,
+			ACLs:      acls,
+			Notifier:  notifier,
+			Quota:     quota,
+			Retention: retention,
+			Inspector: registry.NewInspector(store),
+		})
+	}
 
 	// 处理信号以优雅关闭
 	sigChan := make(chan os.Signal, 1)
@@ -40,3 +156,262 @@ func main() {
 	<-ctx.Done()
 	log.Println("Registry server has shut down")
 }
+
+// runGC 执行 gc 子命令，打印删除 (或 dry-run 时将被删除) 的清单和 blob
+func runGC(args []string) {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	storageFlags := registerStorageFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "只列出将被删除的清单和 blob，不实际删除")
+	gracePeriod := fs.Duration("grace-period", registry.DefaultGCGracePeriod, "不删除最近多久内写入的清单和 blob，保护正在推送的镜像")
+	fs.Parse(args)
+
+	store, err := storageFlags.open()
+	if err != nil {
+		log.Fatalf("Failed to create storage: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	result, err := registry.GarbageCollect(ctx, store, registry.GCOptions{DryRun: *dryRun, GracePeriod: *gracePeriod}, func(p registry.GCProgress) {
+		if p.Phase == "sweep" {
+			log.Printf("[%d/%d] %s", p.RepositoriesDone+1, p.RepositoriesTotal, p.Repository)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Garbage collection failed: %v", err)
+	}
+
+	action := "deleted"
+	if *dryRun {
+		action = "would delete"
+	}
+	for _, manifest := range result.Manifests {
+		fmt.Printf("%s manifest %s\n", action, manifest)
+	}
+	for _, blob := range result.Blobs {
+		fmt.Printf("%s blob %s\n", action, blob)
+	}
+	for _, blob := range result.PrunedBlobs {
+		fmt.Printf("%s blob data %s\n", action, blob)
+	}
+	fmt.Printf("%d manifests, %d blobs, %d blob data %s\n", len(result.Manifests), len(result.Blobs), len(result.PrunedBlobs), action)
+}
+
+// runMigrate 执行 migrate 子命令，目标中已有的内容会被跳过，中断后重新执行即可继续
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := registerPrefixedStorageFlags(fs, "from-")
+	to := registerPrefixedStorageFlags(fs, "to-")
+	repositories := fs.String("repositories", "", "只迁移这些仓库，逗号分隔，为空时迁移全部")
+	fs.Parse(args)
+
+	src, err := from.open()
+	if err != nil {
+		log.Fatalf("Failed to create source storage: %v", err)
+	}
+	dst, err := to.open()
+	if err != nil {
+		log.Fatalf("Failed to create destination storage: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	var opts registry.MigrateOptions
+	if *repositories != "" {
+		opts.Repositories = strings.Split(*repositories, ",")
+	}
+	result, err := registry.Migrate(ctx, src, dst, opts, func(p registry.MigrateProgress) {
+		if p.Repository != "" && p.RepositoriesDone < p.RepositoriesTotal {
+			log.Printf("[%d/%d] %s: %d blobs copied, %d skipped", p.RepositoriesDone+1, p.RepositoriesTotal, p.Repository, p.BlobsCopied, p.BlobsSkipped)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+	fmt.Printf("%d repositories, %d blobs (%d bytes) copied, %d blobs skipped, %d manifests copied, %d manifests skipped, %d tags copied\n",
+		result.RepositoriesDone, result.BlobsCopied, result.BytesCopied, result.BlobsSkipped, result.ManifestsCopied, result.ManifestsSkipped, result.TagsCopied)
+}
+
+// runExport 执行 export 子命令，参数是要导出的 <repository>[:<tag>]
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	storageFlags := registerStorageFlags(fs)
+	output := fs.String("o", "", "输出的 tar 文件，为空时写到标准输出")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: registry export [-o archive.tar] <repository>[:<tag>]...")
+		os.Exit(2)
+	}
+
+	store, err := storageFlags.open()
+	if err != nil {
+		log.Fatalf("Failed to create storage: %v", err)
+	}
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.Create(*output); err != nil {
+			log.Fatalf("Failed to create archive: %v", err)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	if err := registry.ExportArchive(ctx, store, w, fs.Args()); err != nil {
+		w.Close()
+		log.Fatalf("Export failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+}
+
+// runImport 执行 import 子命令，参数是 OCI image-layout 或 docker save 格式的 tar 文件
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	storageFlags := registerStorageFlags(fs)
+	repository := fs.String("repository", "", "导入到该仓库，忽略归档中的仓库名")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: registry import [-repository name] <archive.tar>")
+		os.Exit(2)
+	}
+
+	store, err := storageFlags.open()
+	if err != nil {
+		log.Fatalf("Failed to create storage: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	result, err := registry.ImportArchive(ctx, store, fs.Arg(0), registry.ImportOptions{Repository: *repository})
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+	for _, image := range result.Images {
+		fmt.Printf("imported %s\n", image)
+	}
+	fmt.Printf("%d images, %d blobs imported\n", len(result.Images), result.Blobs)
+}
+
+// openTokenAuth 根据认证参数创建令牌服务，没有设置任何认证参数时返回 nil 表示不认证
+// 使用外部令牌服务时仓库服务器只校验令牌，签名密钥必须与令牌服务共用；acls 不为空时按仓库访问控制授权
+func openTokenAuth(htpasswdFile, userFile, realm, service, secretFile string, acls config.ACLStore) (*auth.RegistryTokenService, error) {
+	if htpasswdFile == "" && userFile == "" && realm == "" {
+		return nil, nil
+	}
+
+	var credentials auth.CredentialChecker
+	switch {
+	case htpasswdFile != "" && userFile != "":
+		return nil, fmt.Errorf("-auth-htpasswd and -auth-user-file are mutually exclusive")
+	case htpasswdFile != "":
+		htpasswd, err := auth.LoadHtpasswd(htpasswdFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load htpasswd: %v", err)
+		}
+		credentials = htpasswd
+	case userFile != "":
+		users, err := config.NewFileUserStore(userFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load users: %v", err)
+		}
+		credentials = auth.NewUserCredentials(users)
+	}
+
+	var secret []byte
+	switch {
+	case secretFile != "":
+		var err error
+		if secret, err = auth.LoadOrCreateSecret(secretFile); err != nil {
+			return nil, fmt.Errorf("failed to load token secret: %v", err)
+		}
+	case realm != "":
+		return nil, fmt.Errorf("-auth-secret-file is required when using an external token service")
+	default:
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	opts := auth.RegistryTokenOptions{Service: service}
+	if acls != nil {
+		opts.Authorize = auth.ACLRegistryAuthorizer(acls)
+	}
+	return auth.NewRegistryTokenService(credentials, secret, opts), nil
+}
+
+// runHtpasswd 执行 htpasswd 子命令，生成的哈希可以直接写入 -auth-htpasswd 指定的文件
+func runHtpasswd(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: registry htpasswd <username> < password")
+		os.Exit(2)
+	}
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		log.Fatalf("Failed to read password: %v", err)
+	}
+	entry, err := auth.HtpasswdEntry(args[0], strings.TrimRight(password, "\r\n"))
+	if err != nil {
+		log.Fatalf("Failed to create htpasswd entry: %v", err)
+	}
+	fmt.Println(entry)
+}
+
+// storageFlags 服务和各子命令共用的存储参数
+type storageFlags struct {
+	backend   *string
+	config    *string
+	dir       *string
+	endpoint  *string
+	region    *string
+	bucket    *string
+	prefix    *string
+	accessKey *string
+	secretKey *string
+	pathStyle *bool
+}
+
+func registerStorageFlags(fs *flag.FlagSet) *storageFlags {
+	return registerPrefixedStorageFlags(fs, "")
+}
+
+// registerPrefixedStorageFlags 注册带前缀的存储参数，migrate 子命令用 from- 和 to- 区分源和目标
+func registerPrefixedStorageFlags(fs *flag.FlagSet, prefix string) *storageFlags {
+	return &storageFlags{
+		backend:   fs.String(prefix+"storage-backend", "file", "存储驱动 ("+strings.Join(storage.Drivers(), ", ")+")，distribution 与 registry:2 的目录布局兼容"),
+		config:    fs.String(prefix+"storage-config", "", "存储驱动配置文件 (YAML，包含 driver 和 parameters)，设置后忽略其他存储参数"),
+		dir:       fs.String(prefix+"storage-dir", "./tmp", "file 和 distribution 存储的根目录"),
+		endpoint:  fs.String(prefix+"s3-endpoint", "https://s3.amazonaws.com", "S3 服务地址"),
+		region:    fs.String(prefix+"s3-region", "us-east-1", "S3 区域"),
+		bucket:    fs.String(prefix+"s3-bucket", "", "S3 bucket"),
+		prefix:    fs.String(prefix+"s3-prefix", "", "S3 对象键前缀"),
+		accessKey: fs.String(prefix+"s3-access-key", os.Getenv("AWS_ACCESS_KEY_ID"), "S3 access key，默认读取 AWS_ACCESS_KEY_ID"),
+		secretKey: fs.String(prefix+"s3-secret-key", os.Getenv("AWS_SECRET_ACCESS_KEY"), "S3 secret key，默认读取 AWS_SECRET_ACCESS_KEY"),
+		pathStyle: fs.Bool(prefix+"s3-path-style", false, "使用路径形式的 bucket 地址 (MinIO 需要开启)"),
+	}
+}
+
+// open 创建存储，配置文件优先于命令行参数
+func (f *storageFlags) open() (storage.Storage, error) {
+	driver := *f.backend
+	params := storage.Parameters{
+		"rootdirectory": *f.dir,
+		"endpoint":      *f.endpoint,
+		"region":        *f.region,
+		"bucket":        *f.bucket,
+		"prefix":        *f.prefix,
+		"accesskey":     *f.accessKey,
+		"secretkey":     *f.secretKey,
+		"pathstyle":     strconv.FormatBool(*f.pathStyle),
+	}
+	if *f.config != "" {
+		driverConfig, err := storage.LoadDriverConfig(*f.config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load storage config: %v", err)
+		}
+		driver, params = driverConfig.Driver, driverConfig.Parameters
+	}
+	return storage.New(driver, params)
+}
@@ -1,88 +1,327 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
-
+	"github.com/smartcat999/container-ui/internal/audit"
+	"github.com/smartcat999/container-ui/internal/auth"
+	"github.com/smartcat999/container-ui/internal/config"
 	"github.com/smartcat999/container-ui/internal/handler"
+	"github.com/smartcat999/container-ui/internal/registry"
 	"github.com/smartcat999/container-ui/internal/service"
 )
 
 func main() {
+	// 解析命令行参数
+	var (
+		serverConfig   = flag.String("config", "", "服务配置文件路径 (YAML)，包含监听地址、TLS、CORS 等配置")
+		listen         = flag.String("listen", "", "监听地址，覆盖配置文件，默认 :8080")
+		tlsCert        = flag.String("tls-cert", "", "HTTPS 证书文件路径")
+		tlsKey         = flag.String("tls-key", "", "HTTPS 私钥文件路径")
+		corsOrigins    = flag.String("cors-origins", "", "允许跨域访问的来源，逗号分隔，* 表示全部")
+		staticDir      = flag.String("static-dir", "", "前端静态文件目录，默认 ./dist")
+		trustedProxies = flag.String("trusted-proxies", "", "受信任的反向代理 IP 或 CIDR，逗号分隔")
+		shutdownGrace  = flag.Duration("shutdown-grace-period", 0, "关闭服务时等待请求完成的最长时间，默认 30s")
+		registryConfig = flag.String("registry-config", "", "仓库配置文件路径，用于推送/拉取镜像时复用认证信息")
+		registryKey    = flag.String("credential-key-file", "", "解密仓库配置中加密保存的凭据的密钥文件，与代理的 -credential-key-file 相同，环境变量 "+config.CredentialKeyEnv+" 优先")
+		registryURL    = flag.String("registry-url", "", "内置镜像仓库地址，例如 http://localhost:5050，用于镜像搜索")
+		contextStore   = flag.String("context-store", "file", "context 配置存储类型 (file, memory)")
+		contextFile    = flag.String("context-file", ".docker-contexts/contexts.json", "context 配置文件路径，旧格式文件会被自动迁移")
+		scheduleFile   = flag.String("schedule-file", ".docker-contexts/schedules.json", "定时任务保存文件路径")
+		metricsPeriod  = flag.Duration("metrics-interval", service.DefaultMetricsInterval, "主机资源使用情况的采样间隔，只采样最近被查询过的 context")
+		authEnabled    = flag.Bool("auth", false, "启用用户认证，对外暴露服务时必须开启")
+		userStore      = flag.String("user-store", "file", "用户存储类型 (file, memory)")
+		userFile       = flag.String("user-file", ".docker-contexts/users.json", "用户保存文件路径")
+		tokenFile      = flag.String("token-file", ".docker-contexts/tokens.json", "个人访问令牌保存文件路径，存储类型与用户存储相同")
+		jwtSecretFile  = flag.String("jwt-secret-file", ".docker-contexts/jwt.secret", "JWT 签名密钥文件路径，不存在时自动生成")
+		accessTTL      = flag.Duration("access-token-ttl", auth.DefaultAccessTTL, "access token 有效期")
+		refreshTTL     = flag.Duration("refresh-token-ttl", auth.DefaultRefreshTTL, "refresh token 有效期")
+		registrySecret = flag.String("registry-token-secret-file", ".docker-contexts/registry-token.secret", "内置镜像仓库令牌的签名密钥文件，与仓库服务器的 -auth-secret-file 共用，不存在时自动生成")
+		registryACL    = flag.String("registry-acl-file", ".docker-contexts/registry-acls.json", "内置镜像仓库的访问控制保存文件路径，存储类型与用户存储相同")
+		registrySvc    = flag.String("registry-token-service", auth.DefaultRegistryService, "内置镜像仓库令牌的 service，与仓库服务器的 -auth-service 一致")
+		adminUser      = flag.String("admin-user", "admin", "没有任何用户时创建的初始管理员用户名")
+		adminPassFile  = flag.String("admin-password-file", ".docker-contexts/initial-admin-password", "未设置 CONTAINER_UI_ADMIN_PASSWORD 时，生成的初始管理员密码写入该文件 (权限 0600)，登录后修改密码并删除该文件")
+		oidcIssuer     = flag.String("oidc-issuer", "", "OIDC issuer 地址，设置后启用 OIDC 登录")
+		oidcClientID   = flag.String("oidc-client-id", "", "OIDC client ID")
+		oidcRedirect   = flag.String("oidc-redirect-url", "", "OIDC 回调地址，例如 https://ui.example.com/api/auth/oidc/callback")
+		oidcScopes     = flag.String("oidc-scopes", "openid,profile,email,groups", "OIDC 请求的 scope，逗号分隔")
+		oidcUserClaim  = flag.String("oidc-username-claim", "preferred_username", "作为用户名的 ID Token 声明")
+		oidcGroupClaim = flag.String("oidc-groups-claim", "groups", "用户组所在的 ID Token 声明")
+		oidcRoles      = flag.String("oidc-role-mapping", "", "用户组到角色的映射，例如 ops=admin,dev=operator")
+		oidcDefRole    = flag.String("oidc-default-role", "", "未匹配任何用户组时的角色，为空时拒绝登录")
+		oidcLoginURL   = flag.String("oidc-login-redirect", "/", "OIDC 登录完成后跳转的前端地址")
+		auditSink      = flag.String("audit-sink", "file", "审计日志存储类型 (file, memory)")
+		validateOnly   = flag.Bool("validate-config", false, "只校验服务配置和仓库配置 (-registry-config) 后退出，不启动服务；配置有误时退出码为 1")
+		auditFile      = flag.String("audit-file", ".docker-contexts/audit.log", "审计日志文件路径，JSON Lines 格式")
+	)
+	flag.Parse()
+
+	// 加载服务配置，命令行参数只在显式指定时覆盖配置文件和环境变量
+	serverCfg, err := config.LoadServerConfig(*serverConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			serverCfg.Listen = *listen
+		case "tls-cert":
+			serverCfg.TLS.CertFile = *tlsCert
+		case "tls-key":
+			serverCfg.TLS.KeyFile = *tlsKey
+		case "cors-origins":
+			serverCfg.CORS.AllowedOrigins = config.SplitList(*corsOrigins)
+		case "static-dir":
+			serverCfg.StaticDir = *staticDir
+		case "trusted-proxies":
+			serverCfg.TrustedProxies = config.SplitList(*trustedProxies)
+		case "shutdown-grace-period":
+			serverCfg.Timeouts.ShutdownGrace = *shutdownGrace
+		}
+	})
+	if err := serverCfg.Validate(); err != nil {
+		log.Fatalf("Invalid server config: %v", err)
+	}
+	if *validateOnly {
+		os.Exit(validateRegistryConfig(*registryConfig, *registryKey))
+	}
+
+	// 创建仓库配置存储（可选）
+	var registryConfigs config.ConfigStore
+	if *registryConfig != "" {
+		if err := config.LoadCredentialKey(*registryKey); err != nil {
+			log.Fatalf("Failed to load credential key: %v", err)
+		}
+		store, err := config.CreateConfigStore("file", *registryConfig)
+		if err != nil {
+			log.Fatalf("Failed to create registry config store: %v", err)
+		}
+		defer store.Close()
+		registryConfigs = store
+	}
+
+	// 创建 context 配置存储
+	contexts, err := config.CreateContextStore(*contextStore, *contextFile)
+	if err != nil {
+		log.Fatalf("Failed to create context store: %v", err)
+	}
+	defer contexts.Close()
+
 	// 创建 Docker 服务
-	dockerService, err := service.NewDockerService()
+	dockerService, err := service.NewDockerService(contexts)
 	if err != nil {
 		log.Fatal(err)
 	}
-	// 创建处理器
-	containerHandler := handler.NewContainerHandler(dockerService)
-	imageHandler := handler.NewImageHandler(dockerService)
-	networkHandler := handler.NewNetworkHandler(dockerService)
-	volumeHandler := handler.NewVolumeHandler(dockerService)
-	contextHandler := handler.NewContextHandler(dockerService)
-
-	r := gin.Default()
-
-	// 配置CORS
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		AllowCredentials: true,
-	}))
-
-	// API路由组
-	api := r.Group("/api")
-	{
-		// Context 相关路由 - 不需要 context 参数
-		api.GET("/contexts", contextHandler.ListContexts)
-		api.POST("/contexts", contextHandler.CreateContext)
-		api.GET("/contexts/:context", contextHandler.GetContextConfig)
-		api.PUT("/contexts/:context", contextHandler.UpdateContextConfig)
-		api.DELETE("/contexts/:context", contextHandler.DeleteContext)
-		// 新增：获取服务器信息路由
-		api.GET("/contexts/:context/info", contextHandler.GetServerInfo)
-
-		// 需要 context 参数的资源路由组
-		contextAPI := api.Group("/contexts/:context")
-		{
-			// 容器相关路由
-			contextAPI.GET("/containers", containerHandler.ListContainers)
-			contextAPI.POST("/containers/:id/start", containerHandler.StartContainer)
-			contextAPI.POST("/containers/:id/stop", containerHandler.StopContainer)
-			contextAPI.DELETE("/containers/:id", containerHandler.DeleteContainer)
-			contextAPI.GET("/containers/:id/json", containerHandler.GetContainerDetail)
-			contextAPI.GET("/containers/:id/logs", containerHandler.GetContainerLogs)
-			contextAPI.GET("/containers/:id/exec", containerHandler.ExecContainer)
-
-			// 镜像相关路由
-			contextAPI.GET("/images", imageHandler.GetImages)
-			contextAPI.DELETE("/images/:id", imageHandler.DeleteImage)
-			contextAPI.POST("/containers", imageHandler.CreateContainer)
-			contextAPI.GET("/images/:id/json", imageHandler.GetImageDetail)
-
-			// 网络相关路由
-			contextAPI.GET("/networks", networkHandler.GetNetworks)
-			contextAPI.GET("/networks/:id", networkHandler.GetNetworkDetail)
-			contextAPI.DELETE("/networks/:id", networkHandler.DeleteNetwork)
-
-			// 数据卷相关路由
-			contextAPI.GET("/volumes", volumeHandler.GetVolumes)
-			contextAPI.GET("/volumes/:name", volumeHandler.GetVolumeDetail)
-			contextAPI.DELETE("/volumes/:name", volumeHandler.DeleteVolume)
+
+	// 后台探测本机的 Docker socket，作为建议的 context
+	go dockerService.DiscoverContexts()
+
+	// 创建并启动定时任务调度器
+	scheduler, err := service.NewScheduler(dockerService, *scheduleFile, config.LegacyContextBackup(*contextFile))
+	if err != nil {
+		log.Fatalf("Failed to create scheduler: %v", err)
+	}
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	// 启动主机资源采样
+	metrics := service.NewMetricsSampler(dockerService, *metricsPeriod)
+	metrics.Start()
+	defer metrics.Stop()
+
+	// 创建认证管理器
+	var authManager *auth.Manager
+	var registryTokens *auth.RegistryTokenService
+	var registryACLs config.ACLStore
+	if *authEnabled {
+		users, err := config.CreateUserStore(*userStore, *userFile)
+		if err != nil {
+			log.Fatalf("Failed to create user store: %v", err)
+		}
+		defer users.Close()
+
+		tokens, err := config.CreateTokenStore(*userStore, *tokenFile)
+		if err != nil {
+			log.Fatalf("Failed to create token store: %v", err)
+		}
+		defer tokens.Close()
+
+		secret, err := auth.LoadOrCreateSecret(*jwtSecretFile)
+		if err != nil {
+			log.Fatalf("Failed to load jwt secret: %v", err)
+		}
+		authManager = auth.NewManager(users, tokens, secret, *accessTTL, *refreshTTL)
+
+		// 内置镜像仓库的令牌服务，仓库服务器通过 -auth-realm 指向 /api/registry/token
+		tokenSecret, err := auth.LoadOrCreateSecret(*registrySecret)
+		if err != nil {
+			log.Fatalf("Failed to load registry token secret: %v", err)
+		}
+		registryACLs, err = config.CreateACLStore(*userStore, *registryACL)
+		if err != nil {
+			log.Fatalf("Failed to create registry acl store: %v", err)
+		}
+		defer registryACLs.Close()
+		registryTokens = auth.NewRegistryTokenService(authManager, tokenSecret, auth.RegistryTokenOptions{
+			Service:   *registrySvc,
+			Authorize: auth.ACLRegistryAuthorizer(registryACLs),
+		})
+
+		// 初始管理员密码通过环境变量传入，避免出现在进程参数中
+		password, err := authManager.EnsureAdmin(*adminUser, os.Getenv("CONTAINER_UI_ADMIN_PASSWORD"))
+		if err != nil {
+			log.Fatalf("Failed to create admin user: %v", err)
+		}
+		// 生成的密码不写入日志，日志通常会被收集到其他系统
+		if password != "" && os.Getenv("CONTAINER_UI_ADMIN_PASSWORD") == "" {
+			if err := config.WriteFileAtomic(*adminPassFile, []byte(password+"\n"), 0600); err != nil {
+				log.Fatalf("Failed to write initial admin password: %v", err)
+			}
+			log.Printf("Created initial user %q, password written to %s, please change it after login and delete the file", *adminUser, *adminPassFile)
+		}
+	} else {
+		log.Printf("Authentication is disabled, do not expose this server beyond localhost")
+	}
+
+	// 创建 OIDC 客户端（可选），client secret 只从环境变量读取
+	var oidcClient *auth.OIDCClient
+	if authManager != nil && *oidcIssuer != "" {
+		roleMapping, err := auth.ParseRoleMapping(*oidcRoles)
+		if err != nil {
+			log.Fatalf("Failed to parse oidc role mapping: %v", err)
+		}
+		oidcClient, err = auth.NewOIDCClient(auth.OIDCConfig{
+			Issuer:        *oidcIssuer,
+			ClientID:      *oidcClientID,
+			ClientSecret:  os.Getenv("CONTAINER_UI_OIDC_CLIENT_SECRET"),
+			RedirectURL:   *oidcRedirect,
+			Scopes:        strings.Split(*oidcScopes, ","),
+			UsernameClaim: *oidcUserClaim,
+			GroupsClaim:   *oidcGroupClaim,
+			RoleMapping:   roleMapping,
+			DefaultRole:   *oidcDefRole,
+		})
+		if err != nil {
+			log.Fatalf("Failed to create oidc client: %v", err)
 		}
 	}
 
-	// 托管静态文件
-	r.Static("/assets", "./dist/assets")
-	r.StaticFile("/favicon.ico", "./dist/favicon.ico")
+	// 创建审计日志存储
+	audits, err := audit.CreateSink(*auditSink, *auditFile)
+	if err != nil {
+		log.Fatalf("Failed to create audit sink: %v", err)
+	}
+	defer audits.Close()
 
-	// 所有其他路由返回 index.html
-	r.NoRoute(func(c *gin.Context) {
-		c.File("./dist/index.html")
+	// 创建路由
+	execSessions := handler.NewExecSessions()
+	r, cleanup, err := newRouter(routerOptions{
+		server:          serverCfg,
+		docker:          dockerService,
+		scheduler:       scheduler,
+		metrics:         metrics,
+		registryConfigs: registryConfigs,
+		registryURL:     *registryURL,
+		audits:          audits,
+		authManager:     authManager,
+		registryTokens:  registryTokens,
+		registryACLs:    registryACLs,
+		oidcClient:      oidcClient,
+		oidcLoginURL:    *oidcLoginURL,
+		execSessions:    execSessions,
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cleanup()
+
+	srv := &http.Server{
+		Addr:              serverCfg.Listen,
+		Handler:           r,
+		ReadHeaderTimeout: serverCfg.Timeouts.ReadHeader,
+		IdleTimeout:       serverCfg.Timeouts.Idle,
+	}
+	if err := serve(srv, serverCfg, execSessions); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve 启动 HTTP 服务并在收到 SIGINT 或 SIGTERM 时优雅关闭
+// 关闭顺序：停止接受新连接并通知终端会话退出，等待正在处理的请求完成，
+// 超过宽限期后强制关闭剩余连接；返回后由 main 中的 defer 依次关闭调度器和各个存储
+func serve(srv *http.Server, cfg config.ServerConfig, sessions *handler.ExecSessions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	log.Fatal(r.Run(":8080"))
+	errChan := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %s", srv.Addr)
+		if cfg.TLSEnabled() {
+			errChan <- srv.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		} else {
+			errChan <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+	}
+	// 恢复默认的信号处理，再次按下 Ctrl+C 时立即退出
+	stop()
+	log.Printf("Shutting down, waiting up to %s for active requests", cfg.Timeouts.ShutdownGrace)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.ShutdownGrace)
+	defer cancel()
+
+	// WebSocket 连接已被劫持，Shutdown 不会等待它们，需要单独通知并等待
+	sessionsDone := make(chan error, 1)
+	go func() {
+		sessionsDone <- sessions.CloseAll(shutdownCtx)
+	}()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Graceful shutdown timed out, closing remaining connections: %v", err)
+		srv.Close()
+	}
+	if err := <-sessionsDone; err != nil {
+		log.Printf("Terminal sessions did not exit in time and were closed: %v", err)
+	}
+	if err := <-errChan; err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	log.Println("Server stopped")
+	return nil
+}
+
+// validateRegistryConfig 校验仓库配置文件并输出结果，返回进程退出码；没有指定仓库配置时只校验服务配置
+func validateRegistryConfig(file, keyFile string) int {
+	if file == "" {
+		fmt.Println("Server config is valid")
+		return 0
+	}
+	if err := config.LoadCredentialKey(keyFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load credential key: %v\n", err)
+		return 1
+	}
+	configs, err := config.ReadConfigFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read registry config: %v\n", err)
+		return 1
+	}
+	if err := registry.ValidateConfigs(configs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Server config and %d registry configs are valid\n", len(configs))
+	return 0
 }
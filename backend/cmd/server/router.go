@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/audit"
+	"github.com/smartcat999/container-ui/internal/auth"
+	"github.com/smartcat999/container-ui/internal/config"
+	"github.com/smartcat999/container-ui/internal/handler"
+	"github.com/smartcat999/container-ui/internal/ratelimit"
+	"github.com/smartcat999/container-ui/internal/service"
+)
+
+// routerOptions 创建路由所需的依赖
+type routerOptions struct {
+	server          config.ServerConfig
+	docker          *service.DockerService
+	scheduler       *service.Scheduler
+	metrics         *service.MetricsSampler
+	registryConfigs config.ConfigStore
+	registryURL     string
+	audits          audit.Sink
+	authManager     *auth.Manager
+	registryTokens  *auth.RegistryTokenService
+	registryACLs    config.ACLStore
+	oidcClient      *auth.OIDCClient
+	oidcLoginURL    string
+	execSessions    *handler.ExecSessions
+}
+
+// newRouter 注册所有路由，返回的 cleanup 用于停止限流器的后台清理
+// 新增 API 路由时需要同步更新 handler.APIRoutes 中的接口说明
+func newRouter(opts routerOptions) (*gin.Engine, func(), error) {
+	var limiters []*ratelimit.Limiter
+	cleanup := func() {
+		for _, l := range limiters {
+			l.Close()
+		}
+	}
+
+	// 创建处理器
+	containerHandler := handler.NewContainerHandler(opts.docker, opts.execSessions)
+	imageHandler := handler.NewImageHandler(opts.docker, opts.registryConfigs, opts.registryURL)
+	networkHandler := handler.NewNetworkHandler(opts.docker)
+	volumeHandler := handler.NewVolumeHandler(opts.docker)
+	contextHandler := handler.NewContextHandler(opts.docker)
+	eventHandler := handler.NewEventHandler(opts.docker)
+	pruneHandler := handler.NewPruneHandler(opts.docker)
+	buildHandler := handler.NewBuildHandler(opts.docker)
+	scheduleHandler := handler.NewScheduleHandler(opts.scheduler)
+	metricsHandler := handler.NewMetricsHandler(opts.metrics)
+	auditHandler := handler.NewAuditHandler(opts.audits)
+	openAPIHandler, err := handler.NewOpenAPIHandler(opts.authManager != nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := gin.Default()
+
+	// 未配置受信任代理时直接使用连接的来源地址，防止伪造 X-Forwarded-For
+	if err := r.SetTrustedProxies(opts.server.TrustedProxies); err != nil {
+		return nil, nil, fmt.Errorf("invalid trusted proxies: %v", err)
+	}
+
+	// 配置CORS，允许所有来源时不能同时允许携带凭据
+	corsConfig := cors.Config{
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		ExposeHeaders:    []string{"X-Total-Count"},
+		AllowCredentials: !opts.server.AllowAllOrigins(),
+	}
+	if opts.server.AllowAllOrigins() {
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOrigins = opts.server.CORS.AllowedOrigins
+	}
+	if len(opts.server.CORS.AllowedOrigins) > 0 {
+		r.Use(cors.New(corsConfig))
+	}
+
+	// API路由组
+	api := r.Group("/api")
+	// 记录所有修改操作，包括登录等认证请求
+	api.Use(handler.AuditMiddleware(opts.audits))
+	// 按 IP 限流在认证之前生效，同时保护登录接口不被暴力破解
+	ipLimiter := ratelimit.NewLimiter(opts.server.RateLimit.PerIP.Rate, opts.server.RateLimit.PerIP.Burst)
+	limiters = append(limiters, ipLimiter)
+	if ipLimiter != nil {
+		api.Use(handler.RateLimitByIP(ipLimiter))
+	}
+	api.Use(handler.BodyLimit(opts.server.Limits.MaxBodySize, opts.server.Limits.MaxUploadSize))
+
+	// API 文档不需要认证
+	api.GET("/openapi.json", openAPIHandler.GetSpec)
+	api.GET("/docs", openAPIHandler.GetDocs)
+	api.GET("/docs/:asset", openAPIHandler.GetDocs)
+
+	// adminOnly 启用认证时只有管理员可以访问的路由，例如导出包含 TLS 私钥的 context，
+	// 以及创建、更新和删除 context，避免其他角色关闭只读设置或删除后重建只读 context
+	var adminOnly []gin.HandlerFunc
+	if opts.authManager != nil {
+		adminOnly = append(adminOnly, handler.RequireRole(auth.RoleAdmin))
+		authHandler := handler.NewAuthHandler(opts.authManager, opts.oidcClient, opts.oidcLoginURL)
+		api.GET("/auth/providers", authHandler.GetProviders)
+		api.POST("/auth/login", authHandler.Login)
+		api.POST("/auth/refresh", authHandler.Refresh)
+		api.POST("/auth/logout", authHandler.Logout)
+		api.GET("/auth/oidc/login", authHandler.OIDCLogin)
+		api.GET("/auth/oidc/callback", authHandler.OIDCCallback)
+		// 内置镜像仓库的令牌服务，自行校验 Basic 认证
+		if opts.registryTokens != nil {
+			api.GET("/registry/token", gin.WrapH(opts.registryTokens))
+		}
+
+		// 之后注册的路由都需要认证
+		// 只有 WebSocket 和 EventSource 路由接受 token 查询参数
+		api.Use(handler.AuthMiddleware(opts.authManager,
+			"/api/contexts/:context/containers/:id/exec",
+			"/api/contexts/:context/events",
+			"/api/contexts/:context/logs",
+		))
+		tokenLimiter := ratelimit.NewLimiter(opts.server.RateLimit.PerToken.Rate, opts.server.RateLimit.PerToken.Burst)
+		limiters = append(limiters, tokenLimiter)
+		if tokenLimiter != nil {
+			api.Use(handler.RateLimitByToken(tokenLimiter))
+		}
+		api.GET("/auth/me", authHandler.GetCurrentUser)
+		api.PUT("/auth/password", authHandler.ChangePassword)
+
+		// 用户管理只对管理员开放
+		users := api.Group("/users", handler.RequireRole(auth.RoleAdmin))
+		users.GET("", authHandler.ListUsers)
+		users.POST("", authHandler.CreateUser)
+		users.DELETE("/:username", authHandler.DeleteUser)
+		if opts.registryACLs != nil {
+			aclHandler := handler.NewRegistryACLHandler(opts.registryACLs)
+			acls := api.Group("/registry/acls", handler.RequireRole(auth.RoleAdmin))
+			acls.GET("", aclHandler.ListACLs)
+			acls.PUT("", aclHandler.PutACL)
+			acls.DELETE("", aclHandler.DeleteACL)
+		}
+		api.GET("/audit", handler.RequireRole(auth.RoleAdmin), auditHandler.ListAudit)
+
+		// 个人访问令牌，只能通过登录会话管理
+		tokenHandler := handler.NewTokenHandler(opts.authManager)
+		tokensAPI := api.Group("/tokens", handler.RequireSession())
+		tokensAPI.GET("", tokenHandler.ListTokens)
+		tokensAPI.POST("", tokenHandler.CreateToken)
+		tokensAPI.DELETE("/:id", tokenHandler.DeleteToken)
+
+		// viewer 角色只能查看
+		api.Use(handler.ViewerGuard())
+	} else {
+		api.GET("/audit", auditHandler.ListAudit)
+	}
+	{
+		// Context 相关路由 - 不需要 context 参数
+		api.GET("/contexts", contextHandler.ListContexts)
+		api.POST("/contexts", append(adminOnly, contextHandler.CreateContext)...)
+		api.POST("/contexts/import", append(adminOnly, contextHandler.ImportContexts)...)
+		api.GET("/contexts/export", append(adminOnly, contextHandler.ExportContexts)...)
+		api.GET("/contexts/discovered", contextHandler.GetDiscoveredContexts)
+		api.GET("/contexts/:context", contextHandler.GetContextConfig)
+		api.PUT("/contexts/:context", append(adminOnly, contextHandler.UpdateContextConfig)...)
+		api.DELETE("/contexts/:context", append(adminOnly, contextHandler.DeleteContext)...)
+		// 新增：获取服务器信息路由
+		api.GET("/contexts/:context/info", contextHandler.GetServerInfo)
+		api.GET("/contexts/:context/metrics", metricsHandler.GetMetrics)
+		api.GET("/overview", contextHandler.GetOverview)
+		api.POST("/groups/:group/containers/batch", contextHandler.BatchGroupContainers)
+
+		// 定时任务路由，任务中指定所属 context
+		api.GET("/schedules", scheduleHandler.ListSchedules)
+		api.POST("/schedules", scheduleHandler.CreateSchedule)
+		api.GET("/schedules/:id", scheduleHandler.GetSchedule)
+		api.PUT("/schedules/:id", scheduleHandler.UpdateSchedule)
+		api.DELETE("/schedules/:id", scheduleHandler.DeleteSchedule)
+		api.POST("/schedules/:id/run", scheduleHandler.RunSchedule)
+		api.GET("/schedules/:id/history", scheduleHandler.GetScheduleHistory)
+
+		// 需要 context 参数的资源路由组
+		contextAPI := api.Group("/contexts/:context")
+		// 只读 context 拒绝所有修改操作
+		contextAPI.Use(handler.ReadOnlyGuard(opts.docker))
+		{
+			// 容器相关路由
+			contextAPI.GET("/containers", containerHandler.ListContainers)
+			contextAPI.POST("/containers/batch", containerHandler.BatchContainers)
+			contextAPI.POST("/containers/:id/start", containerHandler.StartContainer)
+			contextAPI.POST("/containers/:id/stop", containerHandler.StopContainer)
+			contextAPI.POST("/containers/:id/pause", containerHandler.PauseContainer)
+			contextAPI.POST("/containers/:id/unpause", containerHandler.UnpauseContainer)
+			contextAPI.POST("/containers/:id/healthcheck", containerHandler.RunHealthCheck)
+			contextAPI.POST("/containers/:id/recreate", containerHandler.RecreateContainer)
+			contextAPI.POST("/containers/:id/restart", containerHandler.RestartContainer)
+			contextAPI.POST("/containers/:id/kill", containerHandler.KillContainer)
+			contextAPI.POST("/containers/:id/rename", containerHandler.RenameContainer)
+			contextAPI.POST("/containers/:id/update", containerHandler.UpdateContainer)
+			contextAPI.POST("/containers/:id/commit", containerHandler.CommitContainer)
+			contextAPI.GET("/containers/:id/export", containerHandler.ExportContainer)
+			contextAPI.DELETE("/containers/:id", containerHandler.DeleteContainer)
+			contextAPI.GET("/containers/:id/json", containerHandler.GetContainerDetail)
+			contextAPI.GET("/containers/:id/logs", containerHandler.GetContainerLogs)
+			contextAPI.GET("/containers/:id/logs/download", containerHandler.DownloadContainerLogs)
+			contextAPI.GET("/containers/:id/logs/search", containerHandler.SearchContainerLogs)
+			contextAPI.GET("/containers/:id/exec", handler.Mutating(), containerHandler.ExecContainer)
+			contextAPI.GET("/containers/:id/archive", containerHandler.GetContainerArchive)
+			contextAPI.PUT("/containers/:id/archive", containerHandler.PutContainerArchive)
+			contextAPI.GET("/containers/:id/fs", containerHandler.ListContainerFiles)
+			contextAPI.GET("/containers/:id/fs/content", containerHandler.GetContainerFileContent)
+
+			// 镜像相关路由
+			contextAPI.GET("/images", imageHandler.GetImages)
+			contextAPI.GET("/images/search", imageHandler.SearchImages)
+			contextAPI.POST("/images/pull", imageHandler.PullImage)
+			contextAPI.POST("/images/import", imageHandler.ImportImage)
+			contextAPI.POST("/images/load", imageHandler.LoadImage)
+			contextAPI.GET("/images/:id/save", imageHandler.SaveImage)
+			contextAPI.DELETE("/images/:id", imageHandler.DeleteImage)
+			contextAPI.POST("/containers", imageHandler.CreateContainer)
+			contextAPI.GET("/images/:id/json", imageHandler.GetImageDetail)
+			contextAPI.GET("/images/:id/history", imageHandler.GetImageHistory)
+			contextAPI.POST("/images/:id/push", imageHandler.PushImage)
+			contextAPI.POST("/images/:id/tag", imageHandler.TagImage)
+
+			// 镜像构建路由
+			contextAPI.POST("/build", buildHandler.BuildImage)
+
+			// 网络相关路由
+			contextAPI.GET("/networks", networkHandler.GetNetworks)
+			contextAPI.GET("/networks/:id", networkHandler.GetNetworkDetail)
+			contextAPI.DELETE("/networks/:id", networkHandler.DeleteNetwork)
+			contextAPI.POST("/networks", networkHandler.CreateNetwork)
+			contextAPI.POST("/networks/:id/connect", networkHandler.ConnectNetwork)
+			contextAPI.POST("/networks/:id/disconnect", networkHandler.DisconnectNetwork)
+			contextAPI.GET("/networks/:id/containers", networkHandler.GetNetworkContainers)
+
+			// 数据卷相关路由
+			contextAPI.GET("/volumes", volumeHandler.GetVolumes)
+			contextAPI.GET("/volumes/:name", volumeHandler.GetVolumeDetail)
+			contextAPI.DELETE("/volumes/:name", volumeHandler.DeleteVolume)
+			contextAPI.POST("/volumes", volumeHandler.CreateVolume)
+			contextAPI.GET("/volumes/:name/browse", handler.Mutating(), volumeHandler.BrowseVolume)
+			contextAPI.GET("/volumes/:name/backup", handler.Mutating(), volumeHandler.BackupVolume)
+			contextAPI.GET("/volumes/:name/containers", volumeHandler.GetVolumeContainers)
+			contextAPI.POST("/volumes/:name/restore", volumeHandler.RestoreVolume)
+
+			// 资源清理路由
+			contextAPI.POST("/prune", pruneHandler.Prune)
+			contextAPI.POST("/containers/prune", pruneHandler.PruneContainers)
+			contextAPI.POST("/images/prune", pruneHandler.PruneImages)
+			contextAPI.POST("/volumes/prune", pruneHandler.PruneVolumes)
+			contextAPI.POST("/networks/prune", pruneHandler.PruneNetworks)
+			contextAPI.POST("/buildcache/prune", pruneHandler.PruneBuildCache)
+
+			// 事件订阅路由
+			contextAPI.GET("/events", eventHandler.StreamEvents)
+
+			// 多容器聚合日志
+			contextAPI.GET("/logs", containerHandler.StreamAggregatedLogs)
+		}
+	}
+
+	// 托管静态文件
+	if _, err := os.Stat(opts.server.StaticDir); err != nil {
+		log.Printf("Static dir %s is not available, only the API will be served: %v", opts.server.StaticDir, err)
+	}
+	r.Static("/assets", filepath.Join(opts.server.StaticDir, "assets"))
+	r.StaticFile("/favicon.ico", filepath.Join(opts.server.StaticDir, "favicon.ico"))
+
+	// 所有其他路由返回 index.html
+	indexFile := filepath.Join(opts.server.StaticDir, "index.html")
+	r.NoRoute(func(c *gin.Context) {
+		c.File(indexFile)
+	})
+
+	return r, cleanup, nil
+}
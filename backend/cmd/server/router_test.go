@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/audit"
+	"github.com/smartcat999/container-ui/internal/auth"
+	"github.com/smartcat999/container-ui/internal/config"
+	"github.com/smartcat999/container-ui/internal/handler"
+	"github.com/smartcat999/container-ui/internal/openapi"
+	"github.com/smartcat999/container-ui/internal/service"
+)
+
+func newTestRouter(t *testing.T) *gin.Engine {
+	r, _ := newTestRouterWithAuth(t)
+	return r
+}
+
+func newTestRouterWithAuth(t *testing.T) (*gin.Engine, *auth.Manager) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+
+	docker, err := service.NewDockerService(config.NewMemoryContextStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler, err := service.NewScheduler(docker, filepath.Join(dir, "schedules.json"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := auth.NewManager(config.NewMemoryUserStore(), config.NewMemoryTokenStore(), []byte("0123456789abcdef0123456789abcdef"), 0, 0)
+
+	r, cleanup, err := newRouter(routerOptions{
+		server:       config.DefaultServerConfig(),
+		docker:       docker,
+		scheduler:    scheduler,
+		metrics:      service.NewMetricsSampler(docker, 0),
+		audits:       audit.NewMemorySink(10),
+		authManager:  manager,
+		execSessions: handler.NewExecSessions(),
+
+		registryTokens: auth.NewRegistryTokenService(manager, []byte("0123456789abcdef0123456789abcdef"), auth.RegistryTokenOptions{}),
+		registryACLs:   config.NewMemoryACLStore(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
+	return r, manager
+}
+
+// TestOpenAPIRoutes 确保文档中的接口与实际注册的 API 路由一致
+func TestOpenAPIRoutes(t *testing.T) {
+	r := newTestRouter(t)
+
+	registered := make(map[string]bool)
+	for _, route := range r.Routes() {
+		if strings.HasPrefix(route.Path, "/api/") {
+			registered[route.Method+" "+route.Path] = true
+		}
+	}
+	documented := make(map[string]bool)
+	for _, route := range handler.APIRoutes() {
+		key := route.Method + " " + route.Path
+		if documented[key] {
+			t.Errorf("route documented twice: %s", key)
+		}
+		documented[key] = true
+	}
+
+	var missing, stale []string
+	for key := range registered {
+		if !documented[key] {
+			missing = append(missing, key)
+		}
+	}
+	for key := range documented {
+		if !registered[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	for _, key := range missing {
+		t.Errorf("route is not documented in handler.APIRoutes: %s", key)
+	}
+	for _, key := range stale {
+		t.Errorf("documented route is not registered: %s", key)
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+
+	var doc openapi.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	op := doc.Paths["/api/contexts/{context}/containers/{id}/stop"]["post"]
+	if op == nil || len(op.Parameters) != 2 {
+		t.Fatalf("expected stop operation with two path parameters, got %+v", op)
+	}
+	login := doc.Paths["/api/auth/login"]["post"]
+	if login == nil || login.Security == nil || len(*login.Security) != 0 {
+		t.Errorf("login must not require authentication")
+	}
+	if _, ok := doc.Components.Schemas["service.ContainerInfo"]; !ok {
+		t.Errorf("expected ContainerInfo schema in components")
+	}
+}
+
+// loginAs 创建指定角色的用户并返回 access token
+func loginAs(t *testing.T, manager *auth.Manager, username, role string) string {
+	if err := manager.CreateUser(username, username+"-password", role); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := manager.Login(username, username+"-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens.AccessToken
+}
+
+func TestQueryTokenOnlyOnStreamingRoutes(t *testing.T) {
+	r, manager := newTestRouterWithAuth(t)
+	token := loginAs(t, manager, "alice", auth.RoleViewer)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/contexts?token="+token, nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected token query parameter to be rejected on regular routes, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/contexts", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected bearer token to be accepted, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/contexts/missing/events?token="+token, nil))
+	if w.Code == http.StatusUnauthorized {
+		t.Fatal("expected token query parameter to be accepted on event stream")
+	}
+}
+
+func TestContextExportRequiresAdmin(t *testing.T) {
+	r, manager := newTestRouterWithAuth(t)
+	tokens := map[string]string{
+		auth.RoleViewer:   loginAs(t, manager, "viewer", auth.RoleViewer),
+		auth.RoleOperator: loginAs(t, manager, "operator", auth.RoleOperator),
+		auth.RoleAdmin:    loginAs(t, manager, "admin", auth.RoleAdmin),
+	}
+
+	for role, token := range tokens {
+		for _, route := range []struct{ method, path string }{
+			{http.MethodGet, "/api/contexts/export"},
+			{http.MethodPost, "/api/contexts/import"},
+		} {
+			req := httptest.NewRequest(route.method, route.path, strings.NewReader("{}"))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if forbidden := w.Code == http.StatusForbidden; forbidden != (role != auth.RoleAdmin) {
+				t.Errorf("%s %s as %s: unexpected status %d", route.method, route.path, role, w.Code)
+			}
+		}
+	}
+}
+
+func TestViewerCannotUseMutatingGetRoutes(t *testing.T) {
+	r, manager := newTestRouterWithAuth(t)
+	token := loginAs(t, manager, "viewer", auth.RoleViewer)
+
+	for path, mutating := range map[string]bool{
+		"/api/contexts/local/volumes/data":            false,
+		"/api/contexts/local/volumes/data/browse":     true,
+		"/api/contexts/local/volumes/data/backup":     true,
+		"/api/contexts/local/containers/web/exec":     true,
+		"/api/contexts/local/containers/web/fs?path=": false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if forbidden := w.Code == http.StatusForbidden; forbidden != mutating {
+			t.Errorf("GET %s as viewer: unexpected status %d", path, w.Code)
+		}
+	}
+}
+
+func TestOperatorCannotManageContexts(t *testing.T) {
+	r, manager := newTestRouterWithAuth(t)
+	token := loginAs(t, manager, "operator", auth.RoleOperator)
+
+	body := `{"name":"local","type":"socket","host":"unix:///var/run/docker.sock","readOnly":false}`
+	for _, route := range []struct{ method, path, body string }{
+		{http.MethodPost, "/api/contexts", body},
+		{http.MethodPut, "/api/contexts/local", body},
+		{http.MethodDelete, "/api/contexts/local", ""},
+	} {
+		req := httptest.NewRequest(route.method, route.path, strings.NewReader(route.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s as operator: expected 403, got %d", route.method, route.path, w.Code)
+		}
+	}
+
+	// 查看 context 不受影响
+	req := httptest.NewRequest(http.MethodGet, "/api/contexts", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /api/contexts as operator: expected 200, got %d", w.Code)
+	}
+}
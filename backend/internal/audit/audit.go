@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Entry 一条审计记录
+type Entry struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user,omitempty"`
+	// Token 使用个人访问令牌调用时的令牌 ID
+	Token    string `json:"token,omitempty"`
+	SourceIP string `json:"sourceIp"`
+	Method   string `json:"method"`
+	// Path 实际请求路径，Route 为匹配的路由模板
+	Path    string `json:"path"`
+	Route   string `json:"route"`
+	Context string `json:"context,omitempty"`
+	// Resource 操作的资源，例如容器 ID、数据卷名称
+	Resource string `json:"resource,omitempty"`
+	Action   string `json:"action"`
+	Status   int    `json:"status"`
+	Result   string `json:"result"`
+	Duration int64  `json:"durationMs"`
+}
+
+// 操作结果
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Query 审计记录查询条件，结果按时间倒序
+type Query struct {
+	User     string
+	Context  string
+	Resource string
+	Action   string
+	Result   string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+	Offset   int
+}
+
+// MaxQueryLimit 单次查询返回的最大条数
+const MaxQueryLimit = 1000
+
+// Validate 校验查询条件并填充默认值
+func (q *Query) Validate() error {
+	if q.Result != "" && q.Result != ResultSuccess && q.Result != ResultFailure {
+		return fmt.Errorf("invalid result %q", q.Result)
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return errors.New("limit and offset must not be negative")
+	}
+	if q.Limit == 0 || q.Limit > MaxQueryLimit {
+		q.Limit = MaxQueryLimit
+	}
+	return nil
+}
+
+// Match 判断记录是否满足查询条件
+func (q Query) Match(entry Entry) bool {
+	switch {
+	case q.User != "" && entry.User != q.User,
+		q.Context != "" && entry.Context != q.Context,
+		q.Resource != "" && entry.Resource != q.Resource,
+		q.Action != "" && entry.Action != q.Action,
+		q.Result != "" && entry.Result != q.Result,
+		!q.Since.IsZero() && entry.Time.Before(q.Since),
+		!q.Until.IsZero() && !entry.Time.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// page 对按时间正序排列的匹配结果分页，返回倒序的一页和总数
+func (q Query) page(matched []Entry) ([]Entry, int) {
+	total := len(matched)
+	result := make([]Entry, 0, q.Limit)
+	for i := total - 1 - q.Offset; i >= 0 && len(result) < q.Limit; i-- {
+		result = append(result, matched[i])
+	}
+	return result, total
+}
+
+// Sink 定义审计记录的存储接口
+type Sink interface {
+	// Record 写入一条记录
+	Record(entry Entry) error
+
+	// Query 查询记录，返回当前页和匹配的总数
+	Query(query Query) ([]Entry, int, error)
+
+	// Close 关闭存储
+	Close() error
+}
+
+// CreateSink 根据类型创建审计存储
+func CreateSink(sinkType, path string) (Sink, error) {
+	switch sinkType {
+	case "memory":
+		return NewMemorySink(DefaultMemoryCapacity), nil
+	case "file":
+		if path == "" {
+			return nil, errors.New("file path is required for file audit sink")
+		}
+		return NewFileSink(path)
+	default:
+		return nil, errors.New("unsupported audit sink type")
+	}
+}
@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSinkQuery(t *testing.T) {
+	sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		entry := Entry{Time: base.Add(time.Duration(i) * time.Minute), User: "alice", Status: 200, Result: ResultSuccess}
+		if i%2 == 1 {
+			entry.User, entry.Status, entry.Result = "bob", 500, ResultFailure
+		}
+		if err := sink.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := Query{User: "alice", Limit: 2}
+	if err := query.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	entries, total, err := sink.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(entries) != 2 {
+		t.Fatalf("expected 2 of 3 entries, got %d of %d", len(entries), total)
+	}
+	// 按时间倒序返回
+	if !entries[0].Time.Equal(base.Add(4*time.Minute)) || !entries[1].Time.Equal(base.Add(2*time.Minute)) {
+		t.Errorf("unexpected order: %v, %v", entries[0].Time, entries[1].Time)
+	}
+
+	query = Query{Result: ResultFailure, Since: base.Add(2 * time.Minute), Offset: 0}
+	query.Validate()
+	if entries, total, _ = sink.Query(query); total != 1 || entries[0].User != "bob" {
+		t.Errorf("unexpected failure entries: %+v", entries)
+	}
+}
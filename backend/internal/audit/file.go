@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileSink 以 JSON Lines 格式追加写入文件的审计存储
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewFileSink 创建文件审计存储
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	return &FileSink{path: path, file: file}, nil
+}
+
+// Record 实现 Sink 接口
+func (s *FileSink) Record(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// Query 实现 Sink 接口，每次查询顺序扫描整个文件
+func (s *FileSink) Query(query Query) ([]Entry, int, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var matched []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		// 跳过写入中断等原因产生的损坏行
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if query.Match(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read audit log: %v", err)
+	}
+
+	entries, total := query.page(matched)
+	return entries, total, nil
+}
+
+// Close 实现 Sink 接口
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,50 @@
+package audit
+
+import "sync"
+
+// DefaultMemoryCapacity 内存存储保留的最大记录数
+const DefaultMemoryCapacity = 10000
+
+// MemorySink 内存审计存储，超出容量后丢弃最早的记录
+type MemorySink struct {
+	mu       sync.RWMutex
+	entries  []Entry
+	capacity int
+}
+
+// NewMemorySink 创建内存审计存储
+func NewMemorySink(capacity int) *MemorySink {
+	return &MemorySink{capacity: capacity}
+}
+
+// Record 实现 Sink 接口
+func (s *MemorySink) Record(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, entry)
+	if len(s.entries) > s.capacity {
+		s.entries = append([]Entry(nil), s.entries[len(s.entries)-s.capacity:]...)
+	}
+	return nil
+}
+
+// Query 实现 Sink 接口
+func (s *MemorySink) Query(query Query) ([]Entry, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []Entry
+	for _, entry := range s.entries {
+		if query.Match(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	entries, total := query.page(matched)
+	return entries, total, nil
+}
+
+// Close 实现 Sink 接口
+func (s *MemorySink) Close() error {
+	return nil
+}
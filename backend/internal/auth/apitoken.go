@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+// APITokenPrefix 访问令牌的前缀，用于和 JWT 区分，也便于密钥扫描工具识别
+const APITokenPrefix = "cui_"
+
+// 访问令牌的权限范围，令牌的实际权限不会超过所属用户的角色
+const (
+	// ScopeRead 只读访问
+	ScopeRead = "read"
+	// ScopeWrite 可以修改资源，包含 read
+	ScopeWrite = "write"
+)
+
+// 令牌最后使用时间的更新间隔，避免每个请求都写文件
+const lastUsedInterval = time.Minute
+
+var (
+	ErrInvalidScope  = errors.New("invalid token scope")
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// APITokenInfo 返回给前端的令牌信息，不包含密钥
+type APITokenInfo struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Username   string     `json:"username"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// CreatedAPIToken 新建的令牌，Token 明文只在创建时返回一次
+type CreatedAPIToken struct {
+	APITokenInfo
+	Token string `json:"token"`
+}
+
+// IsAPIToken 判断 bearer token 是否为访问令牌
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// scopeRole 根据权限范围计算角色
+func scopeRole(scopes []string) (string, error) {
+	role := ""
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeRead:
+			role = highestRole([]string{role, RoleViewer})
+		case ScopeWrite:
+			role = highestRole([]string{role, RoleOperator})
+		default:
+			return "", fmt.Errorf("%w %q", ErrInvalidScope, scope)
+		}
+	}
+	if role == "" {
+		return "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	return role, nil
+}
+
+// CreateAPIToken 为用户创建访问令牌，ttl 为 0 表示永不过期
+func (m *Manager) CreateAPIToken(username, name string, scopes []string, ttl time.Duration) (CreatedAPIToken, error) {
+	if name == "" {
+		return CreatedAPIToken{}, errors.New("token name is required")
+	}
+	if ttl < 0 {
+		return CreatedAPIToken{}, errors.New("token expiry must not be negative")
+	}
+	if _, err := scopeRole(scopes); err != nil {
+		return CreatedAPIToken{}, err
+	}
+	if _, ok, err := m.users.Get(username); err != nil {
+		return CreatedAPIToken{}, err
+	} else if !ok {
+		return CreatedAPIToken{}, ErrUserNotFound
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return CreatedAPIToken{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return CreatedAPIToken{}, err
+	}
+
+	now := time.Now()
+	token := config.APIToken{
+		ID:         hex.EncodeToString(id),
+		Name:       name,
+		Username:   username,
+		SecretHash: hashSecret(hex.EncodeToString(secret)),
+		Scopes:     scopes,
+		CreatedAt:  now,
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := m.tokens.Put(token); err != nil {
+		return CreatedAPIToken{}, err
+	}
+
+	return CreatedAPIToken{
+		APITokenInfo: tokenInfo(token),
+		Token:        APITokenPrefix + token.ID + "_" + hex.EncodeToString(secret),
+	}, nil
+}
+
+// ListAPITokens 列出令牌，username 为空时列出所有用户的令牌
+func (m *Manager) ListAPITokens(username string) ([]APITokenInfo, error) {
+	tokens, err := m.tokens.List()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]APITokenInfo, 0, len(tokens))
+	for _, token := range tokens {
+		if username == "" || token.Username == username {
+			infos = append(infos, tokenInfo(token))
+		}
+	}
+	return infos, nil
+}
+
+// DeleteAPIToken 删除令牌，username 不为空时只能删除该用户自己的令牌
+func (m *Manager) DeleteAPIToken(username, id string) error {
+	token, ok, err := m.tokens.Get(id)
+	if err != nil {
+		return err
+	}
+	if !ok || (username != "" && token.Username != username) {
+		return ErrTokenNotFound
+	}
+	if _, err := m.tokens.Remove(id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AuthenticateAPIToken 校验访问令牌，返回的角色取令牌权限范围和用户角色中较低的一个
+func (m *Manager) AuthenticateAPIToken(value string) (Claims, error) {
+	var claims Claims
+
+	id, secret, ok := strings.Cut(strings.TrimPrefix(value, APITokenPrefix), "_")
+	if !IsAPIToken(value) || !ok {
+		return claims, ErrInvalidToken
+	}
+	token, ok, err := m.tokens.Get(id)
+	if err != nil {
+		return claims, err
+	}
+	if !ok || subtle.ConstantTimeCompare([]byte(token.SecretHash), []byte(hashSecret(secret))) != 1 {
+		return claims, ErrInvalidToken
+	}
+	now := time.Now()
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return claims, ErrTokenExpired
+	}
+
+	user, ok, err := m.users.Get(token.Username)
+	if err != nil {
+		return claims, err
+	}
+	if !ok {
+		return claims, ErrInvalidToken
+	}
+	userRole, err := ParseRole(user.Role)
+	if err != nil {
+		return claims, err
+	}
+	tokenRole, err := scopeRole(token.Scopes)
+	if err != nil {
+		return claims, err
+	}
+	role := tokenRole
+	if roleRanks[userRole] < roleRanks[tokenRole] {
+		role = userRole
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > lastUsedInterval {
+		// 最后使用时间只用于展示，写入失败不影响认证；只更新仍然存在的令牌，不会恢复并发删除的令牌
+		m.tokens.Touch(token.ID, now)
+	}
+
+	return Claims{
+		Subject: token.Username,
+		Role:    role,
+		ID:      token.ID,
+		Type:    TokenAPI,
+	}, nil
+}
+
+// deleteUserTokens 删除用户的所有令牌
+func (m *Manager) deleteUserTokens(username string) error {
+	tokens, err := m.tokens.List()
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if token.Username == username {
+			if _, err := m.tokens.Remove(token.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func tokenInfo(token config.APIToken) APITokenInfo {
+	return APITokenInfo{
+		ID:         token.ID,
+		Name:       token.Name,
+		Username:   token.Username,
+		Scopes:     token.Scopes,
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+// hashSecret 令牌密钥是高熵随机值，使用 SHA-256 即可，无需慢哈希
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+// 默认的 token 有效期
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 7 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUserExists         = errors.New("user already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidUsername    = errors.New("invalid username")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrExternalUser       = errors.New("user is managed by an external identity provider")
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.@-]{0,63}$`)
+
+// TokenPair 登录或刷新后返回的 token
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int64  `json:"expiresIn"` // access token 有效期（秒）
+}
+
+// UserInfo 返回给前端的用户信息，不包含密码哈希
+type UserInfo struct {
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Provider  string    `json:"provider,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Manager 负责用户认证和 token 的签发、刷新与校验
+type Manager struct {
+	users      config.UserStore
+	tokens     config.TokenStore
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	// 已注销的 refresh token，保存到过期为止；重启后失效，因此 refresh token 还受有效期限制
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+// NewManager 创建认证管理器，ttl 为 0 时使用默认值
+func NewManager(users config.UserStore, tokens config.TokenStore, secret []byte, accessTTL, refreshTTL time.Duration) *Manager {
+	if accessTTL <= 0 {
+		accessTTL = DefaultAccessTTL
+	}
+	if refreshTTL <= 0 {
+		refreshTTL = DefaultRefreshTTL
+	}
+	return &Manager{
+		users:      users,
+		tokens:     tokens,
+		secret:     secret,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		revoked:    make(map[string]time.Time),
+	}
+}
+
+// LoadOrCreateSecret 读取签名密钥，文件不存在时生成随机密钥并保存，使重启后已签发的 token 仍然有效
+func LoadOrCreateSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(secret) < 32 {
+			return nil, fmt.Errorf("invalid jwt secret in %s", path)
+		}
+		return secret, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := config.WriteFileAtomic(path, []byte(hex.EncodeToString(secret)), 0600); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EnsureAdmin 没有任何用户时创建初始管理员；password 为空时生成随机密码并返回
+func (m *Manager) EnsureAdmin(username, password string) (string, error) {
+	users, err := m.users.List()
+	if err != nil {
+		return "", err
+	}
+	if len(users) > 0 {
+		return "", nil
+	}
+
+	if password == "" {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		password = hex.EncodeToString(b)
+	}
+	if err := m.CreateUser(username, password, RoleAdmin); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// Login 校验用户名和密码并签发 token
+func (m *Manager) Login(username, password string) (TokenPair, error) {
+	user, ok, err := m.users.Get(username)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !ok {
+		// 用户不存在时同样计算一次哈希，避免通过响应时间探测用户名
+		CheckPassword(dummyHash, password)
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if user.Provider != "" || !CheckPassword(user.PasswordHash, password) {
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	return m.issue(user)
+}
+
+// LoginExternal 为外部身份提供方认证通过的用户签发 token
+// 用户不存在时自动创建，角色以身份提供方的映射结果为准，每次登录时更新
+func (m *Manager) LoginExternal(provider, username, role string) (TokenPair, error) {
+	if !usernamePattern.MatchString(username) {
+		return TokenPair{}, fmt.Errorf("%w %q", ErrInvalidUsername, username)
+	}
+	user, ok, err := m.users.Get(username)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if ok && user.Provider != provider {
+		// 不允许外部身份覆盖同名的本地用户
+		return TokenPair{}, ErrUserExists
+	}
+	if !ok {
+		user = config.User{Username: username, Provider: provider, CreatedAt: time.Now()}
+	}
+	user.Role = role
+	if err := m.users.Put(user); err != nil {
+		return TokenPair{}, err
+	}
+	return m.issue(user)
+}
+
+// Refresh 使用 refresh token 换取新的 token，旧的 refresh token 随即失效
+func (m *Manager) Refresh(refreshToken string) (TokenPair, error) {
+	claims, err := m.verify(refreshToken, TokenRefresh)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	// 用户被删除后不再允许刷新
+	user, ok, err := m.users.Get(claims.Subject)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !ok {
+		return TokenPair{}, ErrInvalidToken
+	}
+
+	m.revoke(claims)
+	return m.issue(user)
+}
+
+// Logout 注销 refresh token
+func (m *Manager) Logout(refreshToken string) error {
+	claims, err := m.verify(refreshToken, TokenRefresh)
+	if err != nil {
+		return err
+	}
+	m.revoke(claims)
+	return nil
+}
+
+// Authenticate 校验 access token，返回其中的声明
+// 角色以用户存储中的当前值为准，修改角色后无需等待 token 过期
+func (m *Manager) Authenticate(accessToken string) (Claims, error) {
+	claims, err := m.verify(accessToken, TokenAccess)
+	if err != nil {
+		return claims, err
+	}
+	user, ok, err := m.users.Get(claims.Subject)
+	if err != nil {
+		return claims, err
+	}
+	if !ok {
+		return claims, ErrInvalidToken
+	}
+	if claims.Role, err = ParseRole(user.Role); err != nil {
+		return claims, err
+	}
+	return claims, nil
+}
+
+func (m *Manager) verify(token string, tokenType string) (Claims, error) {
+	claims, err := parseToken(m.secret, token, time.Now())
+	if err != nil {
+		return claims, err
+	}
+	if claims.Type != tokenType {
+		return claims, ErrInvalidToken
+	}
+
+	m.mu.Lock()
+	_, revoked := m.revoked[claims.ID]
+	m.mu.Unlock()
+	if revoked {
+		return claims, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (m *Manager) revoke(claims Claims) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range m.revoked {
+		if now.After(exp) {
+			delete(m.revoked, id)
+		}
+	}
+	m.revoked[claims.ID] = time.Unix(claims.ExpiresAt, 0)
+}
+
+func (m *Manager) issue(user config.User) (TokenPair, error) {
+	role, err := ParseRole(user.Role)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	now := time.Now()
+	access, err := m.sign(user.Username, role, TokenAccess, now, m.accessTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := m.sign(user.Username, role, TokenRefresh, now, m.refreshTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(m.accessTTL / time.Second),
+	}, nil
+}
+
+func (m *Manager) sign(username, role, tokenType string, now time.Time, ttl time.Duration) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return signToken(m.secret, Claims{
+		Subject:   username,
+		Role:      role,
+		Type:      tokenType,
+		ID:        hex.EncodeToString(id),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+}
+
+// ListUsers 列出所有用户
+func (m *Manager) ListUsers() ([]UserInfo, error) {
+	users, err := m.users.List()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]UserInfo, 0, len(users))
+	for _, user := range users {
+		role, _ := ParseRole(user.Role)
+		infos = append(infos, UserInfo{
+			Username:  user.Username,
+			Role:      role,
+			Provider:  user.Provider,
+			CreatedAt: user.CreatedAt,
+		})
+	}
+	return infos, nil
+}
+
+// CreateUser 创建本地用户
+func (m *Manager) CreateUser(username, password, role string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("%w %q", ErrInvalidUsername, username)
+	}
+	role, err := ParseRole(role)
+	if err != nil {
+		return err
+	}
+	if _, ok, err := m.users.Get(username); err != nil {
+		return err
+	} else if ok {
+		return ErrUserExists
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return m.users.Put(config.User{
+		Username:     username,
+		PasswordHash: hash,
+		Role:         role,
+		CreatedAt:    time.Now(),
+	})
+}
+
+// ChangePassword 校验旧密码后修改密码
+func (m *Manager) ChangePassword(username, oldPassword, newPassword string) error {
+	user, ok, err := m.users.Get(username)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrUserNotFound
+	}
+	if user.Provider != "" {
+		return ErrExternalUser
+	}
+	if !CheckPassword(user.PasswordHash, oldPassword) {
+		return ErrInvalidCredentials
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	return m.users.Put(user)
+}
+
+// DeleteUser 删除用户及其访问令牌
+func (m *Manager) DeleteUser(username string) error {
+	removed, err := m.users.Remove(username)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrUserNotFound
+	}
+	return m.deleteUserTokens(username)
+}
+
+// dummyHash 用于用户不存在时的等时比较
+var dummyHash, _ = HashPassword("container-ui-dummy-password")
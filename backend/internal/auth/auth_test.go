@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CheckPassword(hash, "correct horse") {
+		t.Error("expected password to match")
+	}
+	if CheckPassword(hash, "wrong horse") {
+		t.Error("expected wrong password to be rejected")
+	}
+	if _, err := HashPassword("short"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("expected ErrWeakPassword, got %v", err)
+	}
+	if _, err := HashPassword(strings.Repeat("a", 73)); !errors.Is(err, ErrPasswordTooLong) {
+		t.Errorf("expected ErrPasswordTooLong, got %v", err)
+	}
+	if !strings.HasPrefix(hash, "$2a$") || !isPasswordHash(hash) {
+		t.Errorf("expected bcrypt hash, got %q", hash)
+	}
+
+	// 早期版本生成的 PBKDF2 哈希仍然可以登录
+	legacy := "pbkdf2-sha256$1000$MDEyMzQ1Njc4OWFiY2RlZg$cBg8D2DungRB9k76szThf5ehfyBz991ay6PT8Srwk4M"
+	if !CheckPassword(legacy, "correct horse") || CheckPassword(legacy, "wrong horse") {
+		t.Error("expected legacy pbkdf2 hash to be verified")
+	}
+	if isPasswordHash("$apr1$salt$hash") || CheckPassword("$apr1$salt$hash", "correct horse") {
+		t.Error("expected unsupported hash to be rejected")
+	}
+}
+
+func TestToken(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Now()
+	token, err := signToken(secret, Claims{Subject: "admin", Type: TokenAccess, ID: "1", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := parseToken(secret, token, now)
+	if err != nil || claims.Subject != "admin" {
+		t.Fatalf("unexpected claims %+v, err %v", claims, err)
+	}
+	if _, err := parseToken(secret, token, now.Add(2*time.Minute)); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expected ErrTokenExpired, got %v", err)
+	}
+	if _, err := parseToken([]byte("another secret"), token, now); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for wrong secret, got %v", err)
+	}
+
+	parts := strings.Split(token, ".")
+	forged := strings.Join([]string{"eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0", parts[1], ""}, ".")
+	if _, err := parseToken(secret, forged, now); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for alg none, got %v", err)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	m := NewManager(config.NewMemoryUserStore(), config.NewMemoryTokenStore(), []byte("0123456789abcdef0123456789abcdef"), 0, 0)
+	if err := m.CreateUser("admin", "password1", RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Login("admin", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+
+	tokens, err := m.Login("admin", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(tokens.RefreshToken); err == nil {
+		t.Error("refresh token must not be accepted as access token")
+	}
+	if _, err := m.Refresh(tokens.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Refresh(tokens.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected reused refresh token to be rejected, got %v", err)
+	}
+}
+
+func TestAPIToken(t *testing.T) {
+	m := NewManager(config.NewMemoryUserStore(), config.NewMemoryTokenStore(), []byte("0123456789abcdef0123456789abcdef"), 0, 0)
+	if err := m.CreateUser("ci", "password1", RoleOperator); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateAPIToken("ci", "deploy", []string{"admin"}, 0); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected ErrInvalidScope, got %v", err)
+	}
+
+	created, err := m.CreateAPIToken("ci", "deploy", []string{ScopeRead}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := m.AuthenticateAPIToken(created.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "ci" || claims.Role != RoleViewer {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if _, err := m.AuthenticateAPIToken(created.Token + "0"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for wrong secret, got %v", err)
+	}
+
+	if err := m.DeleteAPIToken("someone-else", created.ID); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("expected other users not to delete the token, got %v", err)
+	}
+	if err := m.DeleteAPIToken("ci", created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AuthenticateAPIToken(created.Token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected deleted token to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Htpasswd 从 htpasswd 文件中读取的用户，每行格式为 user:hash
+// 支持 bcrypt 哈希 (htpasswd -B 或 HashPassword 生成)、早期版本的 pbkdf2-sha256 哈希和 {SHA} 哈希，apr1 等其他哈希在加载时报错
+// 文件中的用户都可以推送和拉取，按 operator 角色授权
+type Htpasswd struct {
+	entries map[string]string
+}
+
+// LoadHtpasswd 读取 htpasswd 文件，忽略空行和 # 开头的注释
+func LoadHtpasswd(path string) (*Htpasswd, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	h := &Htpasswd{entries: make(map[string]string)}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		username, hash, ok := strings.Cut(text, ":")
+		if !ok || username == "" || hash == "" {
+			return nil, fmt.Errorf("invalid htpasswd entry at %s:%d", path, line)
+		}
+		if !isPasswordHash(hash) && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("unsupported password hash for user %q at %s:%d, use bcrypt (htpasswd -B) or {SHA}", username, path, line)
+		}
+		h.entries[username] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// HtpasswdEntry 生成一行 htpasswd 记录
+func HtpasswdEntry(username, password string) (string, error) {
+	if username == "" || strings.Contains(username, ":") {
+		return "", fmt.Errorf("%w %q", ErrInvalidUsername, username)
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	return username + ":" + hash, nil
+}
+
+// CheckCredentials 校验用户名和密码
+func (h *Htpasswd) CheckCredentials(username, password string) (RegistryIdentity, error) {
+	hash, ok := h.entries[username]
+	if !ok {
+		CheckPassword(dummyHash, password)
+		return RegistryIdentity{}, ErrInvalidCredentials
+	}
+	if sha, found := strings.CutPrefix(hash, "{SHA}"); found {
+		sum := sha1.Sum([]byte(password))
+		if subtle.ConstantTimeCompare([]byte(base64.StdEncoding.EncodeToString(sum[:])), []byte(sha)) != 1 {
+			return RegistryIdentity{}, ErrInvalidCredentials
+		}
+	} else if !CheckPassword(hash, password) {
+		return RegistryIdentity{}, ErrInvalidCredentials
+	}
+	return RegistryIdentity{Username: username, Role: RoleOperator}, nil
+}
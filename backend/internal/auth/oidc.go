@@ -0,0 +1,415 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCProviderName 通过 OIDC 登录的用户在用户存储中的 Provider
+const OIDCProviderName = "oidc"
+
+// OIDCConfig OIDC 客户端配置
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// UsernameClaim 作为用户名的声明，默认 preferred_username，不存在时使用 email 和 sub
+	UsernameClaim string
+	// GroupsClaim 用户组声明，默认 groups
+	GroupsClaim string
+	// RoleMapping 用户组到角色的映射，匹配多个组时取权限最高的角色
+	RoleMapping map[string]string
+	// DefaultRole 没有匹配任何组时的角色，为空时拒绝登录
+	DefaultRole string
+}
+
+// Validate 校验配置并填充默认值
+func (c *OIDCConfig) Validate() error {
+	if c.Issuer == "" || c.ClientID == "" || c.RedirectURL == "" {
+		return errors.New("oidc issuer, client id and redirect url are required")
+	}
+	if _, err := url.Parse(c.RedirectURL); err != nil {
+		return fmt.Errorf("invalid oidc redirect url: %v", err)
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "profile", "email", "groups"}
+	}
+	if c.UsernameClaim == "" {
+		c.UsernameClaim = "preferred_username"
+	}
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = "groups"
+	}
+	for group, role := range c.RoleMapping {
+		if _, ok := roleRanks[role]; !ok {
+			return fmt.Errorf("%w %q for group %q", ErrInvalidRole, role, group)
+		}
+	}
+	if c.DefaultRole != "" {
+		if _, ok := roleRanks[c.DefaultRole]; !ok {
+			return fmt.Errorf("%w %q", ErrInvalidRole, c.DefaultRole)
+		}
+	}
+	return nil
+}
+
+// ParseRoleMapping 解析 "group=role,group=role" 格式的映射
+func ParseRoleMapping(s string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(item, "=")
+		if !ok || group == "" {
+			return nil, fmt.Errorf("invalid role mapping %q", item)
+		}
+		mapping[strings.TrimSpace(group)] = strings.TrimSpace(role)
+	}
+	return mapping, nil
+}
+
+// OIDCIdentity 从 ID Token 中解析出的用户身份
+type OIDCIdentity struct {
+	Username string
+	Groups   []string
+	Role     string
+}
+
+// OIDCClient 实现授权码流程，provider 元数据和签名公钥在首次使用时获取并缓存
+type OIDCClient struct {
+	config     OIDCConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+	keysAt    time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// keysRefreshInterval 遇到未知 kid 时最多按此间隔重新获取公钥，防止被用来放大请求
+const keysRefreshInterval = time.Minute
+
+// NewOIDCClient 创建 OIDC 客户端
+func NewOIDCClient(config OIDCConfig) (*OIDCClient, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &OIDCClient{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// AuthCodeURL 返回跳转到身份提供方的授权地址
+func (o *OIDCClient) AuthCodeURL(ctx context.Context, state, nonce string) (string, error) {
+	discovery, err := o.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {o.config.ClientID},
+		"redirect_uri":  {o.config.RedirectURL},
+		"scope":         {strings.Join(o.config.Scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// Exchange 使用授权码换取 ID Token，校验后返回用户身份
+func (o *OIDCClient) Exchange(ctx context.Context, code, nonce string) (OIDCIdentity, error) {
+	discovery, err := o.getDiscovery(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {o.config.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.config.ClientID), url.QueryEscape(o.config.ClientSecret))
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := o.doJSON(req, &token); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("failed to exchange authorization code: %v", err)
+	}
+	if token.Error != "" {
+		return OIDCIdentity{}, fmt.Errorf("failed to exchange authorization code: %s %s", token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return OIDCIdentity{}, errors.New("failed to exchange authorization code: no id_token in response")
+	}
+
+	claims, err := o.verifyIDToken(ctx, discovery, token.IDToken, nonce, time.Now())
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	return o.identity(claims)
+}
+
+// identity 从声明中解析用户名和用户组，并映射为角色
+func (o *OIDCClient) identity(claims map[string]interface{}) (OIDCIdentity, error) {
+	var identity OIDCIdentity
+	for _, name := range []string{o.config.UsernameClaim, "email", "sub"} {
+		if s, ok := claims[name].(string); ok && s != "" {
+			identity.Username = s
+			break
+		}
+	}
+	if identity.Username == "" {
+		return identity, errors.New("id token has no username claim")
+	}
+
+	switch groups := claims[o.config.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, s)
+			}
+		}
+	case string:
+		identity.Groups = []string{groups}
+	}
+
+	roles := make([]string, 0, len(identity.Groups))
+	for _, group := range identity.Groups {
+		if role, ok := o.config.RoleMapping[group]; ok {
+			roles = append(roles, role)
+		}
+	}
+	identity.Role = highestRole(roles)
+	if identity.Role == "" {
+		identity.Role = o.config.DefaultRole
+	}
+	if identity.Role == "" {
+		return identity, fmt.Errorf("user %q is not in any group mapped to a role", identity.Username)
+	}
+	return identity, nil
+}
+
+// verifyIDToken 校验 ID Token 的 RS256 签名、issuer、audience、过期时间和 nonce
+func (o *OIDCClient) verifyIDToken(ctx context.Context, discovery *oidcDiscovery, token, nonce string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported id token algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	key, err := o.getKey(ctx, discovery, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if iss, _ := claims["iss"].(string); iss != discovery.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, iss)
+	}
+	if !audienceContains(claims["aud"], o.config.ClientID) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	// 允许一分钟的时钟偏差
+	if exp, _ := claims["exp"].(float64); now.Add(-time.Minute).Unix() >= int64(exp) {
+		return nil, ErrTokenExpired
+	}
+	if got, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o *OIDCClient) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+
+	wellKnown := strings.TrimSuffix(o.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	var discovery oidcDiscovery
+	if err := o.doJSON(req, &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider: %v", err)
+	}
+	if discovery.Issuer != o.config.Issuer {
+		return nil, fmt.Errorf("failed to discover oidc provider: issuer mismatch %q", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("failed to discover oidc provider: incomplete provider metadata")
+	}
+	o.discovery = &discovery
+	return o.discovery, nil
+}
+
+// getKey 按 kid 查找签名公钥，找不到时重新获取一次以支持密钥轮换
+func (o *OIDCClient) getKey(ctx context.Context, discovery *oidcDiscovery, kid string) (*rsa.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key, ok := o.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(o.keysAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := o.doJSON(req, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch oidc signing keys: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	o.keys = keys
+	o.keysAt = time.Now()
+
+	if key, ok := o.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+}
+
+// lookupKey 查找公钥，token 未指定 kid 且只有一个公钥时直接使用该公钥
+func (o *OIDCClient) lookupKey(kid string) (*rsa.PublicKey, bool) {
+	if key, ok := o.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(o.keys) == 1 {
+		for _, key := range o.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (o *OIDCClient) doJSON(req *http.Request, v interface{}) error {
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	// token 接口出错时返回 400 和错误描述，交给调用方处理
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
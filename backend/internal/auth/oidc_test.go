@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOIDCExchange(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var server *httptest.Server
+	var idToken string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/auth",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "ui" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	sign := func(claims map[string]interface{}) string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"k1"}`))
+		payload, _ := json.Marshal(claims)
+		input := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(input))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+	}
+	claims := map[string]interface{}{
+		"iss":                server.URL,
+		"aud":                "ui",
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"nonce":              "n1",
+		"preferred_username": "alice",
+		"groups":             []string{"dev", "ops"},
+	}
+
+	client, err := NewOIDCClient(OIDCConfig{
+		Issuer:       server.URL,
+		ClientID:     "ui",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost/api/auth/oidc/callback",
+		RoleMapping:  map[string]string{"dev": RoleViewer, "ops": RoleOperator},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idToken = sign(claims)
+	identity, err := client.Exchange(context.Background(), "code", "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Username != "alice" || identity.Role != RoleOperator {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	if _, err := client.Exchange(context.Background(), "code", "other"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected nonce mismatch, got %v", err)
+	}
+
+	claims["aud"] = "another-client"
+	idToken = sign(claims)
+	if _, err := client.Exchange(context.Background(), "code", "n1"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected audience mismatch, got %v", err)
+	}
+
+	claims["aud"] = "ui"
+	claims["groups"] = []string{"guests"}
+	idToken = sign(claims)
+	if _, err := client.Exchange(context.Background(), "code", "n1"); err == nil {
+		t.Error("expected user without mapped group to be rejected")
+	}
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// 密码哈希参数
+const (
+	passwordCost   = bcrypt.DefaultCost
+	minPasswordLen = 8
+	// maxPasswordLen bcrypt 只使用密码的前 72 字节，超出时拒绝而不是截断
+	maxPasswordLen = 72
+	// legacyPasswordScheme 早期版本生成的 PBKDF2 哈希，仍然可以校验
+	legacyPasswordScheme = "pbkdf2-sha256"
+)
+
+// ErrWeakPassword 密码不满足长度要求
+var ErrWeakPassword = fmt.Errorf("password must be at least %d characters", minPasswordLen)
+
+// ErrPasswordTooLong 密码超过 bcrypt 支持的长度
+var ErrPasswordTooLong = fmt.Errorf("password must be at most %d bytes", maxPasswordLen)
+
+// HashPassword 生成 bcrypt 密码哈希
+func HashPassword(password string) (string, error) {
+	if len(password) < minPasswordLen {
+		return "", ErrWeakPassword
+	}
+	if len(password) > maxPasswordLen {
+		return "", ErrPasswordTooLong
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword 校验密码是否与哈希匹配，支持 bcrypt 哈希和早期版本的 pbkdf2-sha256$<iterations>$<salt>$<hash>
+func CheckPassword(hash, password string) bool {
+	if strings.HasPrefix(hash, legacyPasswordScheme+"$") {
+		return checkLegacyPassword(hash, password)
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// isPasswordHash 判断是否为 CheckPassword 支持的哈希
+func isPasswordHash(hash string) bool {
+	if strings.HasPrefix(hash, legacyPasswordScheme+"$") {
+		return true
+	}
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+// checkLegacyPassword 校验早期版本生成的 PBKDF2-HMAC-SHA256 哈希
+func checkLegacyPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, iterations, len(expected), sha256.New)
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
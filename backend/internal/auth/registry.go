@@ -0,0 +1,410 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+// registry token 的默认参数
+const (
+	DefaultRegistryTokenTTL = 5 * time.Minute
+	DefaultRegistryIssuer   = "container-ui"
+	DefaultRegistryService  = "container-ui-registry"
+)
+
+// ErrInvalidRegistryScope scope 不符合 type:name:actions 格式
+var ErrInvalidRegistryScope = errors.New("invalid registry scope")
+
+// RegistryAccess 授予某个资源的操作，格式与 Docker token 规范一致
+// 例如 {"type":"repository","name":"library/nginx","actions":["pull","push"]}
+type RegistryAccess struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+}
+
+// RegistryClaims 仓库访问令牌中的声明
+type RegistryClaims struct {
+	Issuer    string           `json:"iss"`
+	Subject   string           `json:"sub"`
+	Audience  string           `json:"aud"`
+	ID        string           `json:"jti"`
+	IssuedAt  int64            `json:"iat"`
+	NotBefore int64            `json:"nbf"`
+	ExpiresAt int64            `json:"exp"`
+	Access    []RegistryAccess `json:"access"`
+	// Role 和 TokenID 记录签发时的身份，仓库服务器据此过滤仓库目录
+	Role    string `json:"role,omitempty"`
+	TokenID string `json:"tid,omitempty"`
+}
+
+// Allows 判断令牌是否授予了资源上的操作，"*" 表示全部操作
+func (c RegistryClaims) Allows(resourceType, name, action string) bool {
+	for _, access := range c.Access {
+		if access.Type != resourceType || access.Name != name {
+			continue
+		}
+		for _, granted := range access.Actions {
+			if granted == action || granted == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseRegistryScope 解析 scope 参数，例如 repository:library/nginx:pull,push
+// 仓库名中可能带有端口，因此类型取第一个冒号之前、操作取最后一个冒号之后的部分
+func ParseRegistryScope(scope string) (RegistryAccess, error) {
+	resourceType, rest, ok := strings.Cut(scope, ":")
+	i := strings.LastIndex(rest, ":")
+	if !ok || i <= 0 || resourceType == "" {
+		return RegistryAccess{}, fmt.Errorf("%w %q", ErrInvalidRegistryScope, scope)
+	}
+	access := RegistryAccess{Type: resourceType, Name: rest[:i]}
+	for _, action := range strings.Split(rest[i+1:], ",") {
+		if action != "" {
+			access.Actions = append(access.Actions, action)
+		}
+	}
+	if len(access.Actions) == 0 {
+		return RegistryAccess{}, fmt.Errorf("%w %q", ErrInvalidRegistryScope, scope)
+	}
+	return access, nil
+}
+
+// RegistryIdentity 通过 docker login 认证的身份，匿名用户的所有字段为空
+type RegistryIdentity struct {
+	Username string
+	Role     string
+	// TokenID 使用个人访问令牌登录时的令牌 ID
+	TokenID string
+}
+
+// CredentialChecker 校验 docker login 提交的用户名和密码
+type CredentialChecker interface {
+	CheckCredentials(username, password string) (RegistryIdentity, error)
+}
+
+// RegistryAuthorizer 决定身份在请求的资源上能获得哪些操作
+type RegistryAuthorizer func(identity RegistryIdentity, access RegistryAccess) []string
+
+// RoleRegistryAuthorizer 按角色授权：viewer 只能拉取，operator 和 admin 可以推送和删除
+// 查看仓库目录需要登录，匿名用户没有任何权限
+func RoleRegistryAuthorizer(identity RegistryIdentity, access RegistryAccess) []string {
+	if identity.Username == "" {
+		return nil
+	}
+	var allowed []string
+	switch access.Type {
+	case "repository":
+		allowed = []string{"pull"}
+		if HasRole(identity.Role, RoleOperator) {
+			allowed = append(allowed, "push", "delete", "*")
+		}
+	case "registry":
+		if access.Name == "catalog" {
+			allowed = []string{"*"}
+		}
+	}
+	return grantActions(access.Actions, allowed)
+}
+
+// ACLRegistryAuthorizer 按仓库访问控制授权，没有匹配的访问控制时按角色授权
+// 公开仓库允许匿名拉取；私有仓库只有 Pull 和 Push 中的成员可以访问，推送仍需要 operator 及以上角色；
+// 管理员可以访问所有仓库
+func ACLRegistryAuthorizer(acls config.ACLStore) RegistryAuthorizer {
+	return func(identity RegistryIdentity, access RegistryAccess) []string {
+		if access.Type != "repository" {
+			return RoleRegistryAuthorizer(identity, access)
+		}
+		acl, ok, err := MatchRepositoryACL(acls, access.Name)
+		if err != nil {
+			return nil
+		}
+		if !ok {
+			return RoleRegistryAuthorizer(identity, access)
+		}
+
+		var allowed []string
+		switch {
+		case identity.Username != "" && HasRole(identity.Role, RoleAdmin):
+			allowed = []string{"pull", "push", "delete", "*"}
+		case aclMember(acl.Push, identity) && HasRole(identity.Role, RoleOperator):
+			allowed = []string{"pull", "push", "delete", "*"}
+		case acl.Public || aclMember(acl.Pull, identity) || aclMember(acl.Push, identity):
+			allowed = []string{"pull"}
+		}
+		return grantActions(access.Actions, allowed)
+	}
+}
+
+// MatchRepositoryACL 返回仓库适用的访问控制，精确匹配优先，其次是最长的 /* 前缀，最后是 *
+func MatchRepositoryACL(acls config.ACLStore, repository string) (config.RepositoryACL, bool, error) {
+	if acl, ok, err := acls.Get(repository); err != nil || ok {
+		return acl, ok, err
+	}
+	all, err := acls.List()
+	if err != nil {
+		return config.RepositoryACL{}, false, err
+	}
+	var best config.RepositoryACL
+	found := false
+	for _, acl := range all {
+		prefix, isPattern := strings.CutSuffix(acl.Repository, "*")
+		if !isPattern || (prefix != "" && !strings.HasSuffix(prefix, "/")) || !strings.HasPrefix(repository, prefix) {
+			continue
+		}
+		if !found || len(acl.Repository) > len(best.Repository) {
+			best, found = acl, true
+		}
+	}
+	return best, found, nil
+}
+
+// aclMember 判断身份是否在成员列表中，成员可以是用户名或 token:<id>
+func aclMember(members []string, identity RegistryIdentity) bool {
+	if identity.Username == "" {
+		return false
+	}
+	for _, member := range members {
+		if member == identity.Username || (identity.TokenID != "" && member == "token:"+identity.TokenID) {
+			return true
+		}
+	}
+	return false
+}
+
+// grantActions 返回 requested 中被 allowed 允许的操作
+func grantActions(requested, allowed []string) []string {
+	var granted []string
+	for _, action := range requested {
+		for _, a := range allowed {
+			if action == a {
+				granted = append(granted, action)
+				break
+			}
+		}
+	}
+	return granted
+}
+
+// RegistryTokenOptions 令牌服务的配置，零值字段使用默认值
+type RegistryTokenOptions struct {
+	Issuer    string
+	Service   string
+	TTL       time.Duration
+	Authorize RegistryAuthorizer
+}
+
+// RegistryTokenService 实现 Docker token 认证流程中的令牌服务
+// 仓库服务器返回 WWW-Authenticate 质询后，客户端携带 Basic 认证到令牌服务换取限定仓库和操作的 JWT
+// 令牌服务和仓库服务器共用签名密钥，仓库服务器只需要校验令牌，credentials 为 nil 时不能签发令牌
+type RegistryTokenService struct {
+	credentials CredentialChecker
+	secret      []byte
+	opts        RegistryTokenOptions
+}
+
+// NewRegistryTokenService 创建令牌服务
+func NewRegistryTokenService(credentials CredentialChecker, secret []byte, opts RegistryTokenOptions) *RegistryTokenService {
+	if opts.Issuer == "" {
+		opts.Issuer = DefaultRegistryIssuer
+	}
+	if opts.Service == "" {
+		opts.Service = DefaultRegistryService
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultRegistryTokenTTL
+	}
+	if opts.Authorize == nil {
+		opts.Authorize = RoleRegistryAuthorizer
+	}
+	return &RegistryTokenService{credentials: credentials, secret: secret, opts: opts}
+}
+
+// Service 返回令牌的受众，仓库服务器在质询中原样返回
+func (s *RegistryTokenService) Service() string {
+	return s.opts.Service
+}
+
+// Issue 为身份签发令牌，只包含授权后仍有操作的资源
+func (s *RegistryTokenService) Issue(identity RegistryIdentity, requested []RegistryAccess) (string, RegistryClaims, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", RegistryClaims{}, err
+	}
+
+	now := time.Now()
+	claims := RegistryClaims{
+		Issuer:    s.opts.Issuer,
+		Subject:   identity.Username,
+		Audience:  s.opts.Service,
+		ID:        hex.EncodeToString(id),
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(s.opts.TTL).Unix(),
+		Access:    []RegistryAccess{},
+		Role:      identity.Role,
+		TokenID:   identity.TokenID,
+	}
+	for _, access := range requested {
+		if actions := s.opts.Authorize(identity, access); len(actions) > 0 {
+			claims.Access = append(claims.Access, RegistryAccess{Type: access.Type, Name: access.Name, Actions: actions})
+		}
+	}
+
+	token, err := signToken(s.secret, claims)
+	if err != nil {
+		return "", RegistryClaims{}, err
+	}
+	return token, claims, nil
+}
+
+// Verify 校验令牌的签名、有效期、签发者和受众
+func (s *RegistryTokenService) Verify(token string) (RegistryClaims, error) {
+	var claims RegistryClaims
+	if err := verifyToken(s.secret, token, &claims); err != nil {
+		return claims, err
+	}
+	if claims.Issuer != s.opts.Issuer || claims.Audience != s.opts.Service {
+		return claims, ErrInvalidToken
+	}
+	now := time.Now().Unix()
+	if now >= claims.ExpiresAt {
+		return claims, ErrTokenExpired
+	}
+	if now < claims.NotBefore {
+		return claims, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// CanPull 判断令牌的持有者能否拉取仓库，用于过滤仓库目录
+// 仓库服务器只校验外部令牌服务签发的令牌时，使用仓库服务器自己的授权配置判断
+func (s *RegistryTokenService) CanPull(claims RegistryClaims, repository string) bool {
+	identity := RegistryIdentity{Username: claims.Subject, Role: claims.Role, TokenID: claims.TokenID}
+	return len(s.opts.Authorize(identity, RegistryAccess{Type: "repository", Name: repository, Actions: []string{"pull"}})) > 0
+}
+
+// RegistryTokenResponse 令牌接口的响应，同时返回 token 和 access_token 兼容不同客户端
+type RegistryTokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IssuedAt    string `json:"issued_at"`
+}
+
+// ServeHTTP 处理 GET <realm>?service=<service>&scope=<scope>
+// 没有 Basic 认证时按匿名用户签发令牌，用户名或密码错误时返回 401
+func (s *RegistryTokenService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeTokenError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		return
+	}
+	if s.credentials == nil {
+		writeTokenError(w, http.StatusNotFound, "UNSUPPORTED", "token issuing is not enabled")
+		return
+	}
+	if service := r.URL.Query().Get("service"); service != "" && service != s.opts.Service {
+		writeTokenError(w, http.StatusBadRequest, "INVALID_REQUEST", fmt.Sprintf("unknown service %q", service))
+		return
+	}
+
+	var requested []RegistryAccess
+	for _, scope := range r.URL.Query()["scope"] {
+		// docker 客户端可能在一个 scope 参数中用空格分隔多个作用域
+		for _, field := range strings.Fields(scope) {
+			access, err := ParseRegistryScope(field)
+			if err != nil {
+				writeTokenError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+				return
+			}
+			requested = append(requested, access)
+		}
+	}
+
+	var identity RegistryIdentity
+	if user, password, ok := r.BasicAuth(); ok {
+		var err error
+		if identity, err = s.credentials.CheckCredentials(user, password); err != nil {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", s.opts.Service))
+			writeTokenError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid username or password")
+			return
+		}
+	}
+
+	token, claims, err := s.Issue(identity, requested)
+	if err != nil {
+		writeTokenError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RegistryTokenResponse{
+		Token:       token,
+		AccessToken: token,
+		ExpiresIn:   claims.ExpiresAt - claims.IssuedAt,
+		IssuedAt:    time.Unix(claims.IssuedAt, 0).UTC().Format(time.RFC3339),
+	})
+}
+
+// writeTokenError 按 Distribution 规范的错误格式返回
+func writeTokenError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+// CheckCredentials 校验本地用户的密码，也接受个人访问令牌作为密码，便于在 CI 中 docker login
+func (m *Manager) CheckCredentials(username, password string) (RegistryIdentity, error) {
+	if IsAPIToken(password) {
+		claims, err := m.AuthenticateAPIToken(password)
+		if err != nil || claims.Subject != username {
+			return RegistryIdentity{}, ErrInvalidCredentials
+		}
+		return RegistryIdentity{Username: username, Role: claims.Role, TokenID: claims.ID}, nil
+	}
+	return NewUserCredentials(m.users).CheckCredentials(username, password)
+}
+
+// UserCredentials 使用界面的用户存储校验 docker login，外部身份提供方的用户没有密码，不能登录
+type UserCredentials struct {
+	users config.UserStore
+}
+
+// NewUserCredentials 创建基于用户存储的凭据校验
+func NewUserCredentials(users config.UserStore) *UserCredentials {
+	return &UserCredentials{users: users}
+}
+
+// CheckCredentials 校验用户名和密码
+func (u *UserCredentials) CheckCredentials(username, password string) (RegistryIdentity, error) {
+	user, ok, err := u.users.Get(username)
+	if err != nil {
+		return RegistryIdentity{}, err
+	}
+	if !ok {
+		CheckPassword(dummyHash, password)
+		return RegistryIdentity{}, ErrInvalidCredentials
+	}
+	if user.Provider != "" || !CheckPassword(user.PasswordHash, password) {
+		return RegistryIdentity{}, ErrInvalidCredentials
+	}
+	role, err := ParseRole(user.Role)
+	if err != nil {
+		return RegistryIdentity{}, err
+	}
+	return RegistryIdentity{Username: username, Role: role}, nil
+}
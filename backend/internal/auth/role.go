@@ -0,0 +1,46 @@
+package auth
+
+import "fmt"
+
+// 角色，权限从高到低
+const (
+	// RoleAdmin 可以管理用户以及所有资源
+	RoleAdmin = "admin"
+	// RoleOperator 可以修改所有资源，但不能管理用户
+	RoleOperator = "operator"
+	// RoleViewer 只能查看
+	RoleViewer = "viewer"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// ParseRole 校验角色名称，为空时返回默认的 admin，兼容引入角色之前创建的用户
+func ParseRole(role string) (string, error) {
+	if role == "" {
+		return RoleAdmin, nil
+	}
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("%w %q", ErrInvalidRole, role)
+	}
+	return role, nil
+}
+
+// HasRole 判断 role 是否具有 required 及以上的权限
+func HasRole(role, required string) bool {
+	return roleRanks[role] >= roleRanks[required]
+}
+
+// highestRole 返回权限最高的角色
+func highestRole(roles []string) string {
+	best := ""
+	for _, role := range roles {
+		if roleRanks[role] > roleRanks[best] {
+			best = role
+		}
+	}
+	return best
+}
@@ -0,0 +1,110 @@
+package cert
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEOptions 通过 ACME (例如 Let's Encrypt) 获取公开信任证书的选项
+type ACMEOptions struct {
+	// Domains 申请证书的域名，只为这些域名申请，必须能从公网解析到代理
+	Domains []string
+	// Email 证书到期等通知的联系邮箱，可以为空
+	Email string
+	// CacheDir 保存账户密钥和证书的目录，重启后继续使用，避免触发 CA 的签发频率限制
+	CacheDir string
+	// DirectoryURL ACME 服务地址，为空时使用 Let's Encrypt 正式环境
+	DirectoryURL string
+	// Passphrase 不为空时 CacheDir 中的账户私钥和证书私钥加密保存
+	Passphrase string
+}
+
+// ACME 为公网域名自动申请和续期证书，支持 HTTP-01 (需要 80 端口) 和 TLS-ALPN-01 (需要 443 端口) 验证，
+// 证书在到期前 30 天自动续期
+type ACME struct {
+	manager *autocert.Manager
+	domains map[string]bool
+}
+
+// NewACME 创建 ACME 证书管理器
+func NewACME(opts ACMEOptions) (*ACME, error) {
+	if len(opts.Domains) == 0 {
+		return nil, errors.New("acme requires at least one domain")
+	}
+	if opts.CacheDir == "" {
+		return nil, errors.New("acme requires a cache directory")
+	}
+	domains := make(map[string]bool, len(opts.Domains))
+	for i, domain := range opts.Domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || strings.ContainsAny(domain, "*/:") {
+			return nil, fmt.Errorf("invalid acme domain %q", opts.Domains[i])
+		}
+		opts.Domains[i] = domain
+		domains[domain] = true
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(opts.Domains...),
+		Cache:      &sealedCache{Cache: autocert.DirCache(opts.CacheDir), keys: newKeyring(opts.Passphrase)},
+		Email:      opts.Email,
+	}
+	if opts.DirectoryURL != "" {
+		manager.Client = &acme.Client{DirectoryURL: opts.DirectoryURL}
+	}
+	return &ACME{manager: manager, domains: domains}, nil
+}
+
+// HTTPHandler 处理 HTTP-01 验证请求，其他请求交给 fallback
+func (a *ACME) HTTPHandler(fallback http.Handler) http.Handler {
+	return a.manager.HTTPHandler(fallback)
+}
+
+// TLSConfig 返回使用 ACME 证书的 TLS 配置，同时处理 TLS-ALPN-01 验证。
+// SNI 不是 ACME 域名时使用 fallback 签发的证书 (例如 CA 为镜像仓库主机名签发的拦截证书)，fallback 为空时拒绝握手
+func (a *ACME) TLSConfig(fallback func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1", acme.ALPNProto},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			host := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+			if a.domains[host] {
+				return a.manager.GetCertificate(hello)
+			}
+			if fallback == nil {
+				return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+			}
+			return fallback(hello)
+		},
+	}
+}
+
+// sealedCache 加密保存 ACME 缓存中的私钥，读取时解密
+type sealedCache struct {
+	autocert.Cache
+	keys *keyring
+}
+
+func (c *sealedCache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := c.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.keys.open(data)
+}
+
+func (c *sealedCache) Put(ctx context.Context, key string, data []byte) error {
+	sealed, err := c.keys.seal(data)
+	if err != nil {
+		return err
+	}
+	return c.Cache.Put(ctx, key, sealed)
+}
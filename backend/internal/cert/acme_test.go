@@ -0,0 +1,72 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestACMEFallback(t *testing.T) {
+	if _, err := NewACME(ACMEOptions{Domains: []string{"*.example.com"}, CacheDir: t.TempDir()}); err == nil {
+		t.Fatal("Expected wildcard domain to be rejected")
+	}
+	if _, err := NewACME(ACMEOptions{Domains: []string{"mirror.example.com"}}); err == nil {
+		t.Fatal("Expected missing cache directory to be rejected")
+	}
+
+	a, err := NewACME(ACMEOptions{Domains: []string{" Mirror.Example.com "}, CacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.domains["mirror.example.com"] {
+		t.Fatalf("Expected domain to be normalized, got %v", a.domains)
+	}
+
+	// 非 ACME 域名使用 CA 签发的证书
+	m, err := NewManager("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := a.TLSConfig(m.GetCertificate)
+	cert, err := config.GetCertificate(&tls.ClientHelloInfo{ServerName: "registry-1.docker.io"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "registry-1.docker.io" {
+		t.Fatalf("Expected fallback certificate for registry-1.docker.io")
+	}
+
+	if _, err := a.TLSConfig(nil).GetCertificate(&tls.ClientHelloInfo{ServerName: "registry-1.docker.io"}); err == nil {
+		t.Fatal("Expected handshake without fallback to fail")
+	}
+}
+
+func TestACMESealedCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := &sealedCache{Cache: autocert.DirCache(dir), keys: newKeyring("secret")}
+	ctx := context.Background()
+	_, keyPEM, _ := testCA(t, "ACME Account", nil)
+	if err := cache.Put(ctx, "acme_account+key", keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	// HTTP-01 的 token 不是 PEM，原样保存
+	if err := cache.Put(ctx, "example.com+http-01", []byte("token")); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := os.ReadFile(filepath.Join(dir, "acme_account+key"))
+	if bytes.Contains(stored, []byte("EC PRIVATE KEY-----")) {
+		t.Fatalf("Expected account key to be encrypted:\n%s", stored)
+	}
+	if data, err := cache.Get(ctx, "acme_account+key"); err != nil || !bytes.Equal(data, keyPEM) {
+		t.Fatalf("Expected account key to be decrypted: %v", err)
+	}
+	if data, err := cache.Get(ctx, "example.com+http-01"); err != nil || string(data) != "token" {
+		t.Fatalf("Unexpected token %q: %v", data, err)
+	}
+}
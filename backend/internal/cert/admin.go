@@ -0,0 +1,150 @@
+package cert
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CAInfo CA 证书的摘要信息
+type CAInfo struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	// Fingerprint 证书 DER 编码的 SHA-256，客户端安装信任前可以核对
+	Fingerprint string `json:"fingerprint"`
+}
+
+// CARequest 更换 CA 的请求，证书和私钥都是 PEM 文本
+type CARequest struct {
+	Certificate string `json:"certificate"`
+	Key         string `json:"key"`
+}
+
+// CAAdmin CA 管理接口
+type CAAdmin struct {
+	certs *Manager
+}
+
+// NewCAAdmin 创建 CA 管理接口
+func NewCAAdmin(certs *Manager) *CAAdmin {
+	return &CAAdmin{certs: certs}
+}
+
+// ServeHTTP 实现管理接口：GET 查看当前 CA，PUT 上传已有的 CA 证书和私钥替换当前 CA
+func (a *CAAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req CARequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := parseCA([]byte(req.Certificate), []byte(req.Key)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := a.certs.SetCA([]byte(req.Certificate), []byte(req.Key)); errors.Is(err, ErrExternalCA) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ca := a.certs.CACertificate()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CAInfo{
+		Subject:     ca.Subject.String(),
+		Issuer:      ca.Issuer.String(),
+		NotBefore:   ca.NotBefore,
+		NotAfter:    ca.NotAfter,
+		Fingerprint: fingerprint(ca),
+	})
+}
+
+// CertificateAdmin 签发记录管理接口
+type CertificateAdmin struct {
+	certs *Manager
+}
+
+// NewCertificateAdmin 创建签发记录管理接口
+func NewCertificateAdmin(certs *Manager) *CertificateAdmin {
+	return &CertificateAdmin{certs: certs}
+}
+
+// ServeHTTP 实现管理接口：GET /api/v1/certificates 列出签发记录 (?host= 过滤)，
+// DELETE /api/v1/certificates/{host} 吊销主机的证书 (?serial= 只吊销指定的证书)，
+// POST /api/v1/certificates/{host} 吊销主机当前的证书并立即重新签发；主机名为 * 时对应统一证书
+func (a *CertificateAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/certificates"), "/")
+	switch {
+	case r.Method == http.MethodGet && host == "":
+		writeJSON(w, http.StatusOK, a.certs.Certificates(r.URL.Query().Get("host")))
+	case r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, a.certs.Certificates(host))
+	case r.Method == http.MethodDelete && host != "":
+		revoked, err := a.certs.Revoke(host, r.URL.Query().Get("serial"))
+		if errors.Is(err, ErrCertificateNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, revoked)
+	case r.Method == http.MethodPost && host != "":
+		if _, err := a.certs.Revoke(host, ""); err != nil && !errors.Is(err, ErrCertificateNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		issue := a.certs.Certificate
+		if host == UnifiedHost {
+			issue = func(string) (*tls.Certificate, error) { return a.certs.UnifiedCertificate() }
+		}
+		cert, err := issue(host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, issued := range a.certs.Certificates(host) {
+			if issued.Serial == serialHex(cert.Leaf.SerialNumber) {
+				writeJSON(w, http.StatusCreated, issued)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// WriteCRL 返回当前 CA 签发的 CRL，默认返回 DER 编码，?format=pem 返回 PEM
+func WriteCRL(w http.ResponseWriter, r *http.Request, m *Manager) {
+	crl, err := m.CRL()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("format") == "pem" {
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Write(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl}))
+		return
+	}
+	w.Header().Set("Content-Type", "application/pkix-crl")
+	w.Header().Set("Content-Disposition", `attachment; filename="ca.crl"`)
+	w.Write(crl)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
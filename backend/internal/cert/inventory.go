@@ -0,0 +1,231 @@
+package cert
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+const (
+	// crlValidity 发布的 CRL 的有效期，客户端在 NextUpdate 之后重新获取
+	crlValidity = 24 * time.Hour
+	// inventoryRetention 过期的签发记录保留的时间
+	inventoryRetention = 7 * 24 * time.Hour
+)
+
+// ErrCertificateNotFound 没有可以吊销的证书
+var ErrCertificateNotFound = errors.New("certificate not found")
+
+// IssuedCertificate 签发的主机证书的记录
+type IssuedCertificate struct {
+	// Serial 证书序列号的十六进制表示
+	Serial    string    `json:"serial"`
+	Host      string    `json:"host"`
+	Names     []string  `json:"names"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	// Issuer 签发该证书的 CA 证书的 SHA-256，更换 CA 后旧 CA 签发的证书不再出现在 CRL 中
+	Issuer    string     `json:"issuer"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// inventory 签发记录，证书目录不为空时保存为 Dir/inventory.json
+type inventory struct {
+	file string
+	// CRLNumber 最近一次发布的 CRL 编号，每次发布递增
+	CRLNumber    int64                `json:"crlNumber"`
+	Certificates []*IssuedCertificate `json:"certificates"`
+}
+
+// loadInventory 读取签发记录，文件不存在时返回空的记录
+func loadInventory(dir string) (*inventory, error) {
+	inv := &inventory{}
+	if dir == "" {
+		return inv, nil
+	}
+	inv.file = filepath.Join(dir, "inventory.json")
+	data, err := os.ReadFile(inv.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return inv, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate inventory: %v", err)
+	}
+	if err := json.Unmarshal(data, inv); err != nil {
+		return nil, fmt.Errorf("failed to parse certificate inventory: %v", err)
+	}
+	return inv, nil
+}
+
+// save 写入签发记录并去掉过期较久的记录，失败时只记录日志
+func (inv *inventory) save() {
+	now := time.Now()
+	kept := inv.Certificates[:0]
+	for _, c := range inv.Certificates {
+		if now.Sub(c.NotAfter) < inventoryRetention {
+			kept = append(kept, c)
+		}
+	}
+	inv.Certificates = kept
+	if inv.file == "" {
+		return
+	}
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err == nil {
+		err = config.WriteFileAtomic(inv.file, data, 0644)
+	}
+	if err != nil {
+		log.Printf("Failed to save certificate inventory: %v", err)
+	}
+}
+
+// find 按序列号查找记录
+func (inv *inventory) find(serial string) *IssuedCertificate {
+	for _, c := range inv.Certificates {
+		if c.Serial == serial {
+			return c
+		}
+	}
+	return nil
+}
+
+// record 记录签发的证书，已记录时忽略
+func (inv *inventory) record(host string, leaf *x509.Certificate, issuer string) bool {
+	serial := serialHex(leaf.SerialNumber)
+	if inv.find(serial) != nil {
+		return false
+	}
+	names := append([]string{}, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		names = append(names, ip.String())
+	}
+	inv.Certificates = append(inv.Certificates, &IssuedCertificate{
+		Serial:    serial,
+		Host:      host,
+		Names:     names,
+		NotBefore: leaf.NotBefore,
+		NotAfter:  leaf.NotAfter,
+		Issuer:    issuer,
+	})
+	return true
+}
+
+func serialHex(serial *big.Int) string {
+	return hex.EncodeToString(serial.Bytes())
+}
+
+// fingerprint CA 证书的 SHA-256
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Certificates 返回签发记录，按签发时间排序；host 不为空时只返回该主机的证书
+func (m *Manager) Certificates(host string) []IssuedCertificate {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := []IssuedCertificate{}
+	for _, c := range m.inventory.Certificates {
+		if host == "" || c.Host == host {
+			result = append(result, *c)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].NotBefore.Before(result[j].NotBefore) })
+	return result
+}
+
+// Revoke 吊销主机由当前 CA 签发且未过期的证书，serial 不为空时只吊销该证书。
+// 吊销的证书不再使用，下次连接时重新签发，并出现在之后发布的 CRL 中；返回吊销的记录
+func (m *Manager) Revoke(host, serial string) ([]IssuedCertificate, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	serial = strings.ToLower(strings.TrimLeft(serial, "0"))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	issuer := fingerprint(m.ca.cert)
+	var revoked []IssuedCertificate
+	for _, c := range m.inventory.Certificates {
+		if c.Host != host || c.Issuer != issuer || c.RevokedAt != nil || now.After(c.NotAfter) {
+			continue
+		}
+		if serial != "" && strings.TrimLeft(c.Serial, "0") != serial {
+			continue
+		}
+		c.RevokedAt = &now
+		revoked = append(revoked, *c)
+	}
+	if len(revoked) == 0 {
+		return nil, ErrCertificateNotFound
+	}
+	m.crl = nil
+	if host == UnifiedHost && m.unified != nil && m.isRevoked(m.unified.Leaf) {
+		m.unified = nil
+	}
+	if cert, ok := m.certs[host]; ok && m.isRevoked(cert.Leaf) {
+		delete(m.certs, host)
+		if name, ok := hostFileName(host); ok && m.dir != "" {
+			os.Remove(filepath.Join(m.dir, name))
+		}
+	}
+	m.inventory.save()
+	return revoked, nil
+}
+
+// isRevoked 判断证书是否已吊销
+func (m *Manager) isRevoked(leaf *x509.Certificate) bool {
+	c := m.inventory.find(serialHex(leaf.SerialNumber))
+	return c != nil && c.RevokedAt != nil
+}
+
+// CRL 用当前 CA 签发包含其已吊销且未过期证书的 CRL (DER 编码)，CA 需要允许签发 CRL。
+// 吊销证书或更换 CA 后重新签发，否则在有效期过半前返回同一个 CRL
+func (m *Manager) CRL() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if m.crl != nil && now.Sub(m.crlUpdated) < crlValidity/2 {
+		return m.crl, nil
+	}
+	issuer := fingerprint(m.ca.cert)
+	var entries []x509.RevocationListEntry
+	for _, c := range m.inventory.Certificates {
+		if c.Issuer != issuer || c.RevokedAt == nil || now.After(c.NotAfter) {
+			continue
+		}
+		serial, ok := new(big.Int).SetString(c.Serial, 16)
+		if !ok {
+			continue
+		}
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: *c.RevokedAt})
+	}
+
+	m.inventory.CRLNumber++
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    big.NewInt(m.inventory.CRLNumber),
+		ThisUpdate:                now.Add(-time.Hour),
+		NextUpdate:                now.Add(crlValidity),
+	}, m.ca.cert, m.ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create crl: %v", err)
+	}
+	m.inventory.save()
+	m.crl, m.crlUpdated = crl, now
+	return crl, nil
+}
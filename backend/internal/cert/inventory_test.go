@@ -0,0 +1,81 @@
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestManagerRevoke(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManagerWithOptions(Options{Dir: dir, CRLURL: "http://proxy.local/ca.crl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, err := m.Certificate("registry.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issued.Leaf.CRLDistributionPoints) != 1 {
+		t.Fatalf("Expected CRL distribution point, got %v", issued.Leaf.CRLDistributionPoints)
+	}
+
+	admin := NewCertificateAdmin(m)
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+	var list []IssuedCertificate
+	json.Unmarshal(serve(http.MethodGet, "/api/v1/certificates").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Host != "registry.example.com" || list[0].Serial != serialHex(issued.Leaf.SerialNumber) {
+		t.Fatalf("Unexpected inventory %+v", list)
+	}
+
+	if code := serve(http.MethodDelete, "/api/v1/certificates/unknown.example.com").Code; code != http.StatusNotFound {
+		t.Fatalf("Expected revoking unknown host to fail, got %d", code)
+	}
+	if code := serve(http.MethodDelete, "/api/v1/certificates/registry.example.com").Code; code != http.StatusOK {
+		t.Fatalf("Expected certificate to be revoked, got %d", code)
+	}
+
+	// 吊销后重新签发，吊销的证书出现在 CRL 中
+	reissued, err := m.Certificate("registry.example.com")
+	if err != nil || reissued.Leaf.SerialNumber.Cmp(issued.Leaf.SerialNumber) == 0 {
+		t.Fatalf("Expected certificate to be reissued: %v", err)
+	}
+	der, err := m.CRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(m.CACertificate()); err != nil {
+		t.Fatal(err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 || crl.RevokedCertificateEntries[0].SerialNumber.Cmp(issued.Leaf.SerialNumber) != 0 {
+		t.Fatalf("Unexpected CRL entries %+v", crl.RevokedCertificateEntries)
+	}
+
+	// 吊销状态保存在证书目录中，重启后吊销的证书不再加载
+	reloaded, err := NewManagerWithOptions(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := reloaded.Certificates("registry.example.com"); len(list) != 2 || list[0].RevokedAt == nil || list[1].RevokedAt != nil {
+		t.Fatalf("Unexpected persisted inventory %+v", list)
+	}
+
+	// POST 立即重新签发
+	w := serve(http.MethodPost, "/api/v1/certificates/registry.example.com")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected certificate to be reissued, got %d", w.Code)
+	}
+	if list := m.Certificates("registry.example.com"); len(list) != 3 || list[1].RevokedAt == nil {
+		t.Fatalf("Expected previous certificate to be revoked, got %+v", list)
+	}
+}
@@ -0,0 +1,173 @@
+package cert
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// encryptedKeyType 加密私钥的 PEM 类型，内容为 AES-256-GCM 加密的私钥，Type 头记录原来的 PEM 类型
+	encryptedKeyType = "CONTAINER-UI ENCRYPTED PRIVATE KEY"
+	// scrypt 参数，派生一次约需几十毫秒，同一个 salt 的密钥只派生一次
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// errPassphraseRequired 私钥已加密但没有配置口令
+var errPassphraseRequired = errors.New("private key is encrypted, passphrase is required")
+
+// keyring 用口令加密和解密保存在证书目录中的私钥，口令为空时私钥以明文保存
+type keyring struct {
+	passphrase []byte
+
+	mu   sync.Mutex
+	salt []byte            // 新写入的私钥使用的 salt
+	keys map[string][]byte // salt -> 派生的密钥
+}
+
+func newKeyring(passphrase string) *keyring {
+	return &keyring{passphrase: []byte(passphrase), keys: make(map[string][]byte)}
+}
+
+// enabled 是否加密保存私钥
+func (k *keyring) enabled() bool {
+	return len(k.passphrase) > 0
+}
+
+// derive 返回 salt 对应的密钥
+func (k *keyring) derive(salt []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if key, ok := k.keys[string(salt)]; ok {
+		return key, nil
+	}
+	key, err := scrypt.Key(k.passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	k.keys[string(salt)] = key
+	return key, nil
+}
+
+// seal 把 PEM 数据中的私钥替换为加密的私钥，证书等其他内容不变；未启用加密时原样返回
+func (k *keyring) seal(data []byte) ([]byte, error) {
+	if !k.enabled() {
+		return data, nil
+	}
+	k.mu.Lock()
+	if k.salt == nil {
+		k.salt = make([]byte, 16)
+		if _, err := rand.Read(k.salt); err != nil {
+			k.mu.Unlock()
+			return nil, err
+		}
+	}
+	salt := k.salt
+	k.mu.Unlock()
+
+	key, err := k.derive(salt)
+	if err != nil {
+		return nil, err
+	}
+	return mapKeyBlocks(data, func(block *pem.Block) (*pem.Block, error) {
+		if block.Type == encryptedKeyType {
+			return block, nil
+		}
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		return &pem.Block{
+			Type:    encryptedKeyType,
+			Headers: map[string]string{"KDF": "scrypt", "Salt": base64.StdEncoding.EncodeToString(salt), "Type": block.Type},
+			Bytes:   gcm.Seal(nonce, nonce, block.Bytes, []byte(block.Type)),
+		}, nil
+	})
+}
+
+// open 把 PEM 数据中加密的私钥解密为原来的 PEM 块，没有加密的私钥原样返回
+func (k *keyring) open(data []byte) ([]byte, error) {
+	return mapKeyBlocks(data, func(block *pem.Block) (*pem.Block, error) {
+		if block.Type != encryptedKeyType {
+			return block, nil
+		}
+		if !k.enabled() {
+			return nil, errPassphraseRequired
+		}
+		salt, err := base64.StdEncoding.DecodeString(block.Headers["Salt"])
+		keyType := block.Headers["Type"]
+		if err != nil || len(salt) == 0 || block.Headers["KDF"] != "scrypt" || !strings.HasSuffix(keyType, "PRIVATE KEY") {
+			return nil, errors.New("invalid encrypted private key")
+		}
+		key, err := k.derive(salt)
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(block.Bytes) < gcm.NonceSize() {
+			return nil, errors.New("invalid encrypted private key")
+		}
+		nonce, ciphertext := block.Bytes[:gcm.NonceSize()], block.Bytes[gcm.NonceSize():]
+		der, err := gcm.Open(nil, nonce, ciphertext, []byte(keyType))
+		if err != nil {
+			return nil, errors.New("failed to decrypt private key: wrong passphrase")
+		}
+		return &pem.Block{Type: keyType, Bytes: der}, nil
+	})
+}
+
+// isSealed 判断 PEM 数据中的私钥是否都已加密
+func isSealed(data []byte) bool {
+	sealed := true
+	mapKeyBlocks(data, func(block *pem.Block) (*pem.Block, error) {
+		sealed = sealed && block.Type == encryptedKeyType
+		return block, nil
+	})
+	return sealed
+}
+
+// mapKeyBlocks 对 PEM 数据中的每个私钥块调用 fn，其他块保持不变；不是 PEM 的数据原样返回
+func mapKeyBlocks(data []byte, fn func(*pem.Block) (*pem.Block, error)) ([]byte, error) {
+	var out []byte
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil && out == nil {
+			return data, nil
+		}
+		if block == nil {
+			return out, nil
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			var err error
+			if block, err = fn(block); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, pem.EncodeToMemory(block)...)
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,623 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+const (
+	// caValidity 自动生成的 CA 证书有效期
+	caValidity = 10 * 365 * 24 * time.Hour
+	// leafValidity 签发的主机证书有效期，过期前 leafRenewBefore 重新签发
+	leafValidity    = 30 * 24 * time.Hour
+	leafRenewBefore = 24 * time.Hour
+)
+
+// ErrExternalCA CA 私钥保存在外部 KMS/HSM 中，不能通过上传替换
+var ErrExternalCA = errors.New("ca key is held by an external signer")
+
+// Manager 使用 CA 按主机名签发 TLS 证书，用于拦截发往镜像仓库的 HTTPS 请求
+// 客户端 (containerd、dockerd) 需要信任该 CA
+type Manager struct {
+	dir   string // 主机证书的保存目录，为空时只保存在内存中
+	hosts func(host string) ([]string, bool)
+	// caFile、keyFile 通过 SetCA 更换 CA 时写入的路径，为空时只在内存中更换
+	caFile  string
+	keyFile string
+	// keys 加密保存在磁盘上的私钥
+	keys *keyring
+	// external CA 私钥保存在外部 KMS/HSM 中，不能通过 SetCA 更换
+	external bool
+
+	// crlURLs 写入主机证书的 CRL 分发地址
+	crlURLs []string
+	// unifiedNames 统一证书模式下返回全部配置的名称，为空时按 SNI 分别签发
+	unifiedNames func() []string
+
+	mu        sync.Mutex
+	ca        *authority
+	certs     map[string]*tls.Certificate
+	inventory *inventory
+	// crl 最近签发的 CRL，吊销证书或更换 CA 后清空
+	crl        []byte
+	crlUpdated time.Time
+	// unified 统一证书，unifiedKey 为签发时的名称列表
+	unified    *tls.Certificate
+	unifiedKey string
+}
+
+// authority 签发主机证书的 CA
+type authority struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+	pem  []byte
+	// chain 附加在主机证书之后的证书链：签发用的 CA 以及 PEM 中随后的上级证书
+	chain [][]byte
+}
+
+// Options 证书管理器的选项
+type Options struct {
+	// Dir 证书目录，CACert 为空时 CA 保存为 Dir/ca.crt 和 Dir/ca.key；
+	// 签发的主机证书保存在 Dir/hosts 下，启动时加载，重启后不需要重新签发；签发记录和吊销状态保存在 Dir/inventory.json
+	Dir string
+	// CACert、CAKey CA 证书和私钥的路径，文件不存在时生成新的 CA 并写入。
+	// 使用企业 CA 时指定已有的文件，CACert 可以包含中间 CA 及其上级证书，第一个证书用于签发
+	CACert string
+	CAKey  string
+	// Hosts 返回为主机签发证书时附加的名称 (例如仓库配置的 DNSNames)，返回 false 时拒绝签发；
+	// 每次签发时调用，配置变化后不需要重启。为空时为任意主机名签发只包含该主机名的证书
+	Hosts func(host string) ([]string, bool)
+	// Passphrase 不为空时 CA 私钥和主机证书的私钥加密保存 (scrypt 派生密钥，AES-256-GCM 加密)，
+	// 证书目录泄露时无法用于签发证书；已有的明文私钥在加载时改为加密保存
+	Passphrase string
+	// Signer 不为空时使用外部签名接口 (KMS、HSM) 中的 CA 私钥签发主机证书，CAKey 被忽略。
+	// CAKey 为 RegisterSigner 注册的 scheme://... 地址时也使用外部签名
+	Signer crypto.Signer
+	// CRLURL 不为空时写入签发的主机证书的 CRL 分发点，严格校验吊销状态的客户端从该地址获取 CRL
+	CRLURL string
+	// Unified 不为空时 GetCertificate 对所有连接返回同一个证书，包含 Unified 返回的全部名称 (例如所有仓库的主机名和 DNSNames)，
+	// 用于不发送或发送错误 SNI 的客户端；每次握手时调用，名称变化后重新签发
+	Unified func() []string
+}
+
+// NewManager 加载 CA 证书和私钥，文件不存在时生成新的 CA 并写入这两个文件
+// certFile 为空时生成仅保存在内存中的 CA，重启后客户端需要重新信任
+func NewManager(certFile, keyFile string) (*Manager, error) {
+	return NewManagerWithOptions(Options{CACert: certFile, CAKey: keyFile})
+}
+
+// NewManagerWithOptions 使用选项创建证书管理器，CA 证书和 Dir 都为空时 CA 只保存在内存中
+func NewManagerWithOptions(opts Options) (*Manager, error) {
+	signer := opts.Signer
+	if signer == nil {
+		var err error
+		if signer, _, err = openSigner(opts.CAKey); err != nil {
+			return nil, fmt.Errorf("failed to open ca key %s: %v", opts.CAKey, err)
+		}
+	}
+
+	certFile, keyFile := opts.CACert, opts.CAKey
+	if certFile == "" && opts.Dir != "" {
+		certFile, keyFile = filepath.Join(opts.Dir, "ca.crt"), filepath.Join(opts.Dir, "ca.key")
+	}
+	if signer != nil {
+		keyFile = ""
+	} else if certFile != "" && keyFile == "" {
+		return nil, errors.New("ca key path is required with ca certificate")
+	}
+
+	keys := newKeyring(opts.Passphrase)
+	var ca *authority
+	var err error
+	if signer != nil {
+		ca, err = loadExternalCA(certFile, signer)
+	} else {
+		ca, err = loadCA(certFile, keyFile, keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+	inv, err := loadInventory(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manager{
+		hosts:     opts.Hosts,
+		caFile:    certFile,
+		keyFile:   keyFile,
+		keys:      keys,
+		external:  signer != nil,
+		ca:        ca,
+		certs:     make(map[string]*tls.Certificate),
+		inventory: inv,
+	}
+	m.unifiedNames = opts.Unified
+	if opts.CRLURL != "" {
+		m.crlURLs = []string{opts.CRLURL}
+	}
+	if opts.Dir != "" {
+		m.dir = filepath.Join(opts.Dir, "hosts")
+		if err := os.MkdirAll(m.dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create certificate directory: %v", err)
+		}
+		m.loadHostCertificates()
+	}
+	return m, nil
+}
+
+// loadCA 读取 CA，文件不存在时生成新的 CA，certFile 不为空时写入文件。
+// 启用加密时明文保存的私钥改为加密保存
+func loadCA(certFile, keyFile string, keys *keyring) (*authority, error) {
+	if certFile != "" {
+		certPEM, certErr := os.ReadFile(certFile)
+		keyPEM, keyErr := os.ReadFile(keyFile)
+		if certErr == nil && keyErr == nil {
+			plainPEM, err := keys.open(keyPEM)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load ca key: %v", err)
+			}
+			ca, err := parseCA(certPEM, plainPEM)
+			if err != nil {
+				return nil, err
+			}
+			if keys.enabled() && !isSealed(keyPEM) {
+				if err := writeCA(certFile, keyFile, certPEM, plainPEM, keys); err != nil {
+					return nil, err
+				}
+			}
+			return ca, nil
+		}
+		if !errors.Is(certErr, os.ErrNotExist) && certErr != nil {
+			return nil, fmt.Errorf("failed to read ca certificate: %v", certErr)
+		}
+		if !errors.Is(keyErr, os.ErrNotExist) && keyErr != nil {
+			return nil, fmt.Errorf("failed to read ca key: %v", keyErr)
+		}
+	}
+
+	certPEM, keyPEM, err := generateCA()
+	if err != nil {
+		return nil, err
+	}
+	if certFile != "" {
+		if err := writeCA(certFile, keyFile, certPEM, keyPEM, keys); err != nil {
+			return nil, err
+		}
+	}
+	return parseCA(certPEM, keyPEM)
+}
+
+// loadExternalCA 读取私钥保存在外部签名接口中的 CA 证书，文件不存在时用该私钥生成自签名的 CA 并写入
+func loadExternalCA(certFile string, signer crypto.Signer) (*authority, error) {
+	var certPEM []byte
+	if certFile != "" {
+		data, err := os.ReadFile(certFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read ca certificate: %v", err)
+		}
+		certPEM = data
+	}
+	if certPEM == nil {
+		der, err := createCACertificate(signer)
+		if err != nil {
+			return nil, err
+		}
+		certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		if certFile != "" {
+			if err := config.WriteFileAtomic(certFile, certPEM, 0644); err != nil {
+				return nil, fmt.Errorf("failed to write ca certificate: %v", err)
+			}
+		}
+	}
+
+	var chain [][]byte
+	for rest := certPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("failed to load ca: no certificate found")
+	}
+	ca, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ca certificate: %v", err)
+	}
+	if pub, ok := ca.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(signer.Public()) {
+		return nil, errors.New("failed to load ca: external key does not match ca certificate")
+	}
+	return newAuthority(ca, signer, certPEM, chain)
+}
+
+// writeCA 写入 CA 证书和私钥，启用加密时私钥加密保存
+func writeCA(certFile, keyFile string, certPEM, keyPEM []byte, keys *keyring) error {
+	keyPEM, err := keys.seal(keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt ca key: %v", err)
+	}
+	if err := config.WriteFileAtomic(keyFile, keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write ca key: %v", err)
+	}
+	if err := config.WriteFileAtomic(certFile, certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write ca certificate: %v", err)
+	}
+	return nil
+}
+
+// parseCA 解析 CA 证书和私钥，私钥必须与第一个证书匹配，且该证书可以签发证书
+func parseCA(certPEM, keyPEM []byte) (*authority, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ca: %v", err)
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ca certificate: %v", err)
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported ca key type %T", pair.PrivateKey)
+	}
+	return newAuthority(ca, signer, certPEM, pair.Certificate)
+}
+
+// newAuthority 检查证书可以签发证书且没有过期
+func newAuthority(ca *x509.Certificate, key crypto.Signer, certPEM []byte, chain [][]byte) (*authority, error) {
+	if !ca.IsCA || (ca.KeyUsage != 0 && ca.KeyUsage&x509.KeyUsageCertSign == 0) {
+		return nil, fmt.Errorf("certificate %q is not a ca", ca.Subject.CommonName)
+	}
+	if time.Now().After(ca.NotAfter) {
+		return nil, fmt.Errorf("ca certificate %q expired at %s", ca.Subject.CommonName, ca.NotAfter.Format(time.RFC3339))
+	}
+	return &authority{cert: ca, key: key, pem: certPEM, chain: chain}, nil
+}
+
+// SetCA 更换签发主机证书的 CA，例如改用客户端已经信任的企业 CA。
+// 已签发的主机证书全部作废，之后的连接使用新 CA 重新签发；CA 有文件路径时同时写入文件，重启后继续使用
+func (m *Manager) SetCA(certPEM, keyPEM []byte) error {
+	if m.external {
+		return ErrExternalCA
+	}
+	ca, err := parseCA(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	if m.caFile != "" {
+		if err := writeCA(m.caFile, m.keyFile, certPEM, keyPEM, m.keys); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ca = ca
+	m.certs = make(map[string]*tls.Certificate)
+	m.unified = nil
+	m.crl = nil
+	return nil
+}
+
+// CACertPEM 返回 CA 证书，供客户端安装信任
+func (m *Manager) CACertPEM() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ca.pem
+}
+
+// CACertificate 返回签发主机证书的 CA 证书
+func (m *Manager) CACertificate() *x509.Certificate {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ca.cert
+}
+
+// GetCertificate 按 SNI 返回证书，用作 tls.Config.GetCertificate；统一证书模式下返回统一证书
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if m.unifiedNames != nil {
+		return m.UnifiedCertificate()
+	}
+	host := hello.ServerName
+	if host == "" {
+		// 客户端没有发送 SNI 时 (例如直接使用 IP)，按本地地址签发
+		if addr, ok := hello.Conn.LocalAddr().(*net.TCPAddr); ok {
+			host = addr.IP.String()
+		}
+	}
+	return m.Certificate(host)
+}
+
+// Certificate 返回主机名的证书，已签发且未临近过期时复用
+func (m *Manager) Certificate(host string) (*tls.Certificate, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return nil, errors.New("missing server name")
+	}
+
+	names := []string{host}
+	if m.hosts != nil {
+		extra, ok := m.hosts(host)
+		if !ok {
+			return nil, fmt.Errorf("no registry configured for %s", host)
+		}
+		names = append(names, extra...)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 配置的名称增加后已签发的证书不再覆盖全部名称，重新签发
+	if cert, ok := m.certs[host]; ok && time.Until(cert.Leaf.NotAfter) > leafRenewBefore && coversNames(cert.Leaf, names) {
+		return cert, nil
+	}
+	cert, err := m.ca.sign(host, names, m.crlURLs)
+	if err != nil {
+		return nil, err
+	}
+	m.certs[host] = cert
+	m.saveHostCertificate(host, cert)
+	m.inventory.record(host, cert.Leaf, fingerprint(m.ca.cert))
+	m.inventory.save()
+	return cert, nil
+}
+
+// Invalidate 丢弃为配置的主机名签发的证书，包括名称中含有该主机名或被其通配符匹配的证书，
+// 用于配置变化后按新的配置重新签发
+func (m *Manager) Invalidate(hostName string) {
+	hostName = strings.ToLower(strings.TrimSuffix(hostName, "."))
+	suffix, wildcard := strings.CutPrefix(hostName, "*")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for host, cert := range m.certs {
+		if host != hostName && !containsName(cert.Leaf.DNSNames, hostName) && !(wildcard && strings.HasSuffix(host, suffix)) {
+			continue
+		}
+		delete(m.certs, host)
+		if name, ok := hostFileName(host); ok && m.dir != "" {
+			os.Remove(filepath.Join(m.dir, name))
+		}
+	}
+}
+
+// hostFileName 主机证书的文件名，主机名来自客户端的 SNI，只保存由合法字符组成的主机名
+func hostFileName(host string) (string, bool) {
+	if len(host) > 253 || strings.HasPrefix(host, ".") || strings.Contains(host, "..") {
+		return "", false
+	}
+	for _, c := range host {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == ':') {
+			return "", false
+		}
+	}
+	// IPv6 地址中的冒号在部分文件系统上不合法
+	return strings.ReplaceAll(host, ":", "_") + ".pem", true
+}
+
+// saveHostCertificate 把主机证书和私钥保存到证书目录，失败时只记录日志，证书仍然可用
+func (m *Manager) saveHostCertificate(host string, cert *tls.Certificate) {
+	name, ok := hostFileName(host)
+	if m.dir == "" || !ok {
+		return
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		log.Printf("Failed to save certificate for %s: %v", host, err)
+		return
+	}
+	var data []byte
+	for _, der := range cert.Certificate {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+	if data, err = m.keys.seal(data); err != nil {
+		log.Printf("Failed to save certificate for %s: %v", host, err)
+		return
+	}
+	if err := config.WriteFileAtomic(filepath.Join(m.dir, name), data, 0600); err != nil {
+		log.Printf("Failed to save certificate for %s: %v", host, err)
+	}
+}
+
+// loadHostCertificates 加载证书目录中由当前 CA 签发且未临近过期的主机证书，
+// 其他证书 (CA 已更换、已过期、已吊销、无法解析或解密) 忽略，需要时重新签发并覆盖；启用加密时明文保存的证书改为加密保存
+func (m *Manager) loadHostCertificates() {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		log.Printf("Failed to read certificate directory: %v", err)
+		return
+	}
+	recorded := false
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".pem")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(m.dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		plain, err := m.keys.open(data)
+		if err != nil {
+			continue
+		}
+		cert, err := tls.X509KeyPair(plain, plain)
+		if err != nil {
+			continue
+		}
+		if cert.Leaf == nil {
+			if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+				continue
+			}
+		}
+		if cert.Leaf.CheckSignatureFrom(m.ca.cert) != nil || time.Until(cert.Leaf.NotAfter) <= leafRenewBefore || m.isRevoked(cert.Leaf) {
+			continue
+		}
+		host := strings.ReplaceAll(name, "_", ":")
+		m.certs[host] = &cert
+		// 签发记录出现之前保存的证书补充记录
+		recorded = m.inventory.record(host, cert.Leaf, fingerprint(m.ca.cert)) || recorded
+		if m.keys.enabled() && !isSealed(data) {
+			m.saveHostCertificate(host, &cert)
+		}
+	}
+	if recorded {
+		m.inventory.save()
+	}
+}
+
+// subjectAltNames 把名称分为 DNS 名称和 IP 地址，去掉端口、重复的名称以及不能用作证书名称的兜底规则和 CIDR
+func subjectAltNames(names []string) ([]string, []net.IP) {
+	var dnsNames []string
+	var ips []net.IP
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if host, _, err := net.SplitHostPort(name); err == nil {
+			name = host
+		}
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if name == "" || name == "*" || strings.Contains(name, "/") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if ip := net.ParseIP(name); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+	return dnsNames, ips
+}
+
+// coversNames 判断证书是否包含全部名称
+func coversNames(leaf *x509.Certificate, names []string) bool {
+	dnsNames, ips := subjectAltNames(names)
+	for _, name := range dnsNames {
+		if !containsName(leaf.DNSNames, name) {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		found := false
+		for _, issued := range leaf.IPAddresses {
+			found = found || issued.Equal(ip)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sign 用 CA 签发主机证书，names 为证书包含的全部名称，通配符 (*.gcr.io) 作为通配符证书名称
+func (ca *authority) sign(host string, names, crlURLs []string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		// 客户端按分发点获取 CRL 检查吊销状态
+		CRLDistributionPoints: crlURLs,
+	}
+	template.DNSNames, template.IPAddresses = subjectAltNames(names)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate for %s: %v", host, err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: append([][]byte{der}, ca.chain...),
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// generateCA 生成自签名的 CA 证书和私钥
+func generateCA() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := createCACertificate(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// createCACertificate 用私钥生成自签名的 CA 证书
+func createCACertificate(key crypto.Signer) ([]byte, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Container UI Registry Proxy CA", Organization: []string{"container-ui"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ca certificate: %v", err)
+	}
+	return der, nil
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
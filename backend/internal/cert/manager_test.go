@@ -0,0 +1,299 @@
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManagerPersistence(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManagerWithOptions(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, err := m.Certificate("registry-1.docker.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 来自 SNI 的非法主机名可以签发，但不写入证书目录
+	if _, err := m.Certificate("../escape"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新启动后 CA 不变，已签发的主机证书直接加载
+	reloaded, err := NewManagerWithOptions(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reloaded.CACertPEM(), m.CACertPEM()) {
+		t.Fatal("Expected CA to be reused")
+	}
+	cert, err := reloaded.Certificate("registry-1.docker.io")
+	if err != nil || cert.Leaf.SerialNumber.Cmp(issued.Leaf.SerialNumber) != 0 {
+		t.Fatalf("Expected persisted certificate to be reused: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "hosts"))
+	if len(entries) != 1 {
+		t.Fatalf("Unexpected host certificate files %v", entries)
+	}
+
+	// CA 更换后旧的主机证书不再使用
+	os.Remove(filepath.Join(dir, "ca.crt"))
+	replaced, err := NewManagerWithOptions(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replaced.certs) != 0 {
+		t.Fatalf("Expected certificates of the old CA to be ignored, got %d", len(replaced.certs))
+	}
+}
+
+func TestManagerCustomCA(t *testing.T) {
+	// 企业根 CA 签发的中间 CA，客户端只信任根 CA
+	rootPEM, _, root := testCA(t, "Corporate Root CA", nil)
+	chainPEM, keyPEM, _ := testCA(t, "Corporate Intermediate CA", root)
+	chainPEM = append(chainPEM, rootPEM...)
+
+	dir := t.TempDir()
+	m, err := NewManagerWithOptions(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := m.Certificate("registry.example.com")
+
+	admin := NewCAAdmin(m)
+	put := func(body CARequest) int {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/v1/ca", bytes.NewReader(data)))
+		return w.Code
+	}
+	if code := put(CARequest{Certificate: string(rootPEM), Key: string(keyPEM)}); code != http.StatusBadRequest {
+		t.Fatalf("Expected mismatched key to be rejected, got %d", code)
+	}
+	if code := put(CARequest{Certificate: string(chainPEM), Key: string(keyPEM)}); code != http.StatusOK {
+		t.Fatalf("Expected CA to be replaced, got %d", code)
+	}
+
+	// 之前签发的证书作废，新证书附带中间 CA，可以用根 CA 校验
+	cert, err := m.Certificate("registry.example.com")
+	if err != nil || cert == before {
+		t.Fatalf("Expected certificate to be reissued: %v", err)
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	roots.AppendCertsFromPEM(rootPEM)
+	for _, der := range cert.Certificate[1:] {
+		c, _ := x509.ParseCertificate(der)
+		intermediates.AddCert(c)
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "registry.example.com", Roots: roots, Intermediates: intermediates}); err != nil {
+		t.Fatalf("Failed to verify certificate against corporate root: %v", err)
+	}
+
+	// 更换的 CA 写入证书目录，重启后继续使用
+	reloaded, err := NewManagerWithOptions(Options{Dir: dir})
+	if err != nil || !bytes.Equal(reloaded.CACertPEM(), chainPEM) {
+		t.Fatalf("Expected custom CA to be persisted: %v", err)
+	}
+}
+
+// testCA 生成 CA，parent 为空时自签名
+func testCA(t *testing.T, name string, parent *authority) ([]byte, []byte, *authority) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	issuer, signer := template, crypto.Signer(key)
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	ca, err := parseCA(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certPEM, keyPEM, ca
+}
+
+func TestManagerHostNames(t *testing.T) {
+	names := map[string][]string{"registry.local": {"registry.local", "mirror.local", "10.0.0.5", "10.0.0.0/8"}}
+	m, err := NewManagerWithOptions(Options{Hosts: func(host string) ([]string, bool) {
+		extra, ok := names[host]
+		return extra, ok
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Certificate("unknown.example.com"); err == nil {
+		t.Fatal("Expected certificate for unconfigured host to be refused")
+	}
+
+	cert, err := m.Certificate("registry.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"registry.local", "mirror.local", "10.0.0.5"} {
+		if err := cert.Leaf.VerifyHostname(name); err != nil {
+			t.Fatalf("Expected certificate to cover %s: %v", name, err)
+		}
+	}
+
+	// 配置增加名称后重新签发，不需要重启
+	names["registry.local"] = append(names["registry.local"], "*.mirror.local")
+	reissued, err := m.Certificate("registry.local")
+	if err != nil || reissued == cert || reissued.Leaf.VerifyHostname("eu.mirror.local") != nil {
+		t.Fatalf("Expected certificate to be reissued with wildcard name: %v", err)
+	}
+
+	// 配置删除名称后已签发的证书仍然覆盖新的名称，需要丢弃后才会重新签发
+	names["registry.local"] = []string{"registry.local"}
+	if again, _ := m.Certificate("registry.local"); again != reissued {
+		t.Fatal("Expected certificate to be reused before invalidation")
+	}
+	m.Invalidate("registry.local")
+	again, err := m.Certificate("registry.local")
+	if err != nil || again == reissued || again.Leaf.VerifyHostname("mirror.local") == nil {
+		t.Fatalf("Expected certificate to be reissued without removed names: %v", err)
+	}
+}
+
+func TestManagerEncryptedKeys(t *testing.T) {
+	// 已有的明文 CA 和主机证书在启用口令后改为加密保存
+	dir := t.TempDir()
+	plain, err := NewManagerWithOptions(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Certificate("registry.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManagerWithOptions(Options{Dir: dir, Passphrase: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m.CACertPEM(), plain.CACertPEM()) || len(m.certs) != 1 {
+		t.Fatal("Expected existing CA and host certificate to be loaded")
+	}
+	for _, name := range []string{"ca.key", filepath.Join("hosts", "registry.example.com.pem")} {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		if !bytes.Contains(data, []byte(encryptedKeyType)) || bytes.Contains(data, []byte("BEGIN EC PRIVATE KEY")) || bytes.Contains(data, []byte("BEGIN PRIVATE KEY")) {
+			t.Fatalf("Expected %s to be encrypted:\n%s", name, data)
+		}
+	}
+
+	if _, err := NewManagerWithOptions(Options{Dir: dir}); err == nil {
+		t.Fatal("Expected encrypted CA key to require a passphrase")
+	}
+	if _, err := NewManagerWithOptions(Options{Dir: dir, Passphrase: "wrong"}); err == nil {
+		t.Fatal("Expected wrong passphrase to be rejected")
+	}
+	reloaded, err := NewManagerWithOptions(Options{Dir: dir, Passphrase: "secret"})
+	if err != nil || len(reloaded.certs) != 1 {
+		t.Fatalf("Expected encrypted keys to be loaded: %v", err)
+	}
+}
+
+func TestManagerExternalSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterSigner("testkms", func(uri string) (crypto.Signer, error) {
+		return key, nil
+	})
+
+	// 证书不存在时用外部私钥生成 CA，私钥不写入磁盘
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	m, err := NewManagerWithOptions(Options{CACert: caFile, CAKey: "testkms://registry-ca"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := m.Certificate("registry.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Leaf.CheckSignatureFrom(m.CACertificate()); err != nil {
+		t.Fatalf("Expected certificate to be signed by the external key: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("Expected only the CA certificate to be written, got %v", entries)
+	}
+
+	reloaded, err := NewManagerWithOptions(Options{CACert: caFile, CAKey: "testkms://registry-ca"})
+	if err != nil || !bytes.Equal(reloaded.CACertPEM(), m.CACertPEM()) {
+		t.Fatalf("Expected CA certificate to be reused: %v", err)
+	}
+	certPEM, keyPEM, _ := testCA(t, "Other CA", nil)
+	if err := reloaded.SetCA(certPEM, keyPEM); err != ErrExternalCA {
+		t.Fatalf("Expected external CA not to be replaced, got %v", err)
+	}
+
+	// 外部私钥必须与 CA 证书匹配
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, err := NewManagerWithOptions(Options{CACert: caFile, Signer: other}); err == nil {
+		t.Fatal("Expected mismatched external key to be rejected")
+	}
+}
+
+func TestManagerUnified(t *testing.T) {
+	names := []string{"docker.io", "registry.local:5000", "*.gcr.io", "10.0.0.0/8", "*"}
+	m, err := NewManagerWithOptions(Options{Unified: func() []string { return names }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 客户端没有发送 SNI 时同样返回统一证书
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"docker.io", "registry.local", "eu.gcr.io"} {
+		if err := cert.Leaf.VerifyHostname(name); err != nil {
+			t.Fatalf("Expected unified certificate to cover %s: %v", name, err)
+		}
+	}
+	if same, _ := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "quay.io"}); same != cert {
+		t.Fatal("Expected unified certificate to be reused")
+	}
+
+	// 配置变化后重新签发
+	names = append(names, "quay.io")
+	reissued, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "quay.io"})
+	if err != nil || reissued == cert || reissued.Leaf.VerifyHostname("quay.io") != nil {
+		t.Fatalf("Expected unified certificate to be reissued: %v", err)
+	}
+	if list := m.Certificates(UnifiedHost); len(list) != 2 {
+		t.Fatalf("Expected unified certificates to be recorded, got %+v", list)
+	}
+}
@@ -0,0 +1,40 @@
+package cert
+
+import (
+	"crypto"
+	"strings"
+	"sync"
+)
+
+// SignerOpener 打开保存在外部 KMS 或 HSM 中的 CA 私钥，uri 为完整的私钥地址 (例如 awskms://alias/registry-ca)。
+// 返回的 Signer 在每次签发主机证书时调用，私钥不离开外部服务
+type SignerOpener func(uri string) (crypto.Signer, error)
+
+var (
+	signersMu sync.RWMutex
+	signers   = make(map[string]SignerOpener)
+)
+
+// RegisterSigner 注册外部签名后端，Options.CAKey 为 scheme://... 时使用该后端打开 CA 私钥。
+// 后端实现通常放在单独的包中，在 init 中注册
+func RegisterSigner(scheme string, open SignerOpener) {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+	signers[strings.ToLower(scheme)] = open
+}
+
+// openSigner 私钥地址的 scheme 已注册时打开外部私钥，否则返回 false，按文件路径处理
+func openSigner(uri string) (crypto.Signer, bool, error) {
+	scheme, _, ok := strings.Cut(uri, "://")
+	if !ok {
+		return nil, false, nil
+	}
+	signersMu.RLock()
+	open, ok := signers[strings.ToLower(scheme)]
+	signersMu.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	signer, err := open(uri)
+	return signer, true, err
+}
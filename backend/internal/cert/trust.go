@@ -0,0 +1,129 @@
+package cert
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// caFileName 安装到节点上的 CA 证书文件名
+const caFileName = "container-ui-proxy-ca.crt"
+
+// TrustFile 需要写入节点的文件
+type TrustFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// TrustBundle 让节点上的 containerd 和 dockerd 通过正向代理拉取镜像并信任拦截证书所需的文件和命令
+type TrustBundle struct {
+	ProxyURL string      `json:"proxyUrl"`
+	Hosts    []string    `json:"hosts"`
+	Files    []TrustFile `json:"files"`
+	// Commands 写入文件后需要执行的命令
+	Commands []string `json:"commands"`
+	// DockerDaemonConfig 可以代替 systemd 配置合并到 /etc/docker/daemon.json 的代理设置 (Docker 23.0 及以上)，
+	// 节点上通常已有该文件，不包含在 Files 中
+	DockerDaemonConfig string `json:"dockerDaemonConfig"`
+}
+
+// NewTrustBundle 按代理地址和被拦截的仓库主机名生成配置。
+// 通配符和 CIDR 规则无法对应到 certs.d 下的目录，不生成按主机的配置，依赖系统信任的 CA
+func NewTrustBundle(caPEM []byte, hosts []string, proxyURL string) *TrustBundle {
+	bundle := &TrustBundle{ProxyURL: proxyURL, Hosts: []string{}, DockerDaemonConfig: dockerDaemonConfig(proxyURL)}
+	ca := string(caPEM)
+	proxyEnv := fmt.Sprintf("[Service]\nEnvironment=\"HTTPS_PROXY=%s\"\n", proxyURL)
+	bundle.Files = append(bundle.Files,
+		// dockerd 和大多数工具使用系统根证书
+		TrustFile{Path: "/usr/local/share/ca-certificates/" + caFileName, Content: ca},
+		TrustFile{Path: "/etc/systemd/system/containerd.service.d/http-proxy.conf", Content: proxyEnv},
+		TrustFile{Path: "/etc/systemd/system/docker.service.d/http-proxy.conf", Content: proxyEnv},
+	)
+
+	for _, host := range hosts {
+		if host == "" || strings.ContainsAny(host, "*/\\' ") || strings.Contains(host, "..") {
+			continue
+		}
+		bundle.Hosts = append(bundle.Hosts, host)
+		containerdDir := path.Join("/etc/containerd/certs.d", host)
+		bundle.Files = append(bundle.Files,
+			TrustFile{Path: path.Join(containerdDir, "ca.crt"), Content: ca},
+			TrustFile{Path: path.Join(containerdDir, "hosts.toml"), Content: containerdHosts(host, path.Join(containerdDir, "ca.crt"))},
+			TrustFile{Path: path.Join("/etc/docker/certs.d", host, "ca.crt"), Content: ca},
+		)
+	}
+
+	bundle.Commands = []string{
+		// RHEL 系列没有 update-ca-certificates，证书需要放在 anchors 目录下
+		"if command -v update-ca-certificates >/dev/null; then update-ca-certificates; else cp /usr/local/share/ca-certificates/" + caFileName + " /etc/pki/ca-trust/source/anchors/ && update-ca-trust; fi",
+		"systemctl daemon-reload",
+		// 只重启正在运行的服务，节点上可能只安装了其中一个
+		"systemctl try-restart containerd.service docker.service || true",
+	}
+	return bundle
+}
+
+// containerdHosts containerd certs.d 下的 hosts.toml，需要 CRI 插件的 config_path 指向 /etc/containerd/certs.d
+func containerdHosts(host, caPath string) string {
+	server := "https://" + host
+	if host == "docker.io" {
+		server = "https://registry-1.docker.io"
+	}
+	return fmt.Sprintf("server = %q\n\n[host.%q]\n  capabilities = [\"pull\", \"resolve\"]\n  ca = %q\n", server, server, caPath)
+}
+
+// dockerDaemonConfig daemon.json 中的代理设置
+func dockerDaemonConfig(proxyURL string) string {
+	data, _ := json.MarshalIndent(map[string]any{
+		"proxies": map[string]string{"https-proxy": proxyURL},
+	}, "", "  ")
+	return string(data) + "\n"
+}
+
+// Script 生成写入全部文件并执行命令的 shell 脚本，在节点上以 root 执行
+func (b *TrustBundle) Script() string {
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\nset -e\n")
+	for i, file := range b.Files {
+		delimiter := fmt.Sprintf("CONTAINER_UI_EOF_%d", i)
+		fmt.Fprintf(&script, "\nmkdir -p '%s'\ncat > '%s' <<'%s'\n%s%s\n", path.Dir(file.Path), file.Path, delimiter, file.Content, delimiter)
+	}
+	script.WriteString("\n")
+	for _, command := range b.Commands {
+		script.WriteString(command + "\n")
+	}
+	return script.String()
+}
+
+// WriteCACertificate 返回 CA 证书 (PEM 时包含完整的证书链)，?format=der 或 Accept 为 application/pkix-cert 时返回 DER 编码，默认返回 PEM
+func WriteCACertificate(w http.ResponseWriter, r *http.Request, m *Manager) {
+	caPEM := m.CACertPEM()
+	accept := r.Header.Get("Accept")
+	if r.URL.Query().Get("format") == "der" || strings.Contains(accept, "application/pkix-cert") || strings.Contains(accept, "application/x-x509-ca-cert") {
+		// DER 只能包含一个证书，使用企业 CA 证书链时返回最后一个，即客户端需要信任的根 CA
+		var der []byte
+		for rest := caPEM; ; {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			if block.Type == "CERTIFICATE" {
+				der = block.Bytes
+			}
+		}
+		if der == nil {
+			http.Error(w, "invalid ca certificate", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pkix-cert")
+		w.Header().Set("Content-Disposition", `attachment; filename="ca.der"`)
+		w.Write(der)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", `attachment; filename="ca.crt"`)
+	w.Write(caPEM)
+}
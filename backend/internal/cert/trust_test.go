@@ -0,0 +1,44 @@
+package cert
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTrustBundle(t *testing.T) {
+	m, err := NewManager("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := NewTrustBundle(m.CACertPEM(), []string{"docker.io", "*.gcr.io", "10.0.0.0/8", "quay.io"}, "http://proxy:3128")
+	if strings.Join(bundle.Hosts, ",") != "docker.io,quay.io" {
+		t.Fatalf("Unexpected hosts %v", bundle.Hosts)
+	}
+	files := make(map[string]string)
+	for _, file := range bundle.Files {
+		files[file.Path] = file.Content
+	}
+	if hosts := files["/etc/containerd/certs.d/docker.io/hosts.toml"]; !strings.Contains(hosts, `server = "https://registry-1.docker.io"`) ||
+		!strings.Contains(hosts, `ca = "/etc/containerd/certs.d/docker.io/ca.crt"`) {
+		t.Fatalf("Unexpected hosts.toml %q", hosts)
+	}
+	if files["/etc/docker/certs.d/quay.io/ca.crt"] != string(m.CACertPEM()) {
+		t.Fatal("Expected CA for docker certs.d")
+	}
+	if !strings.Contains(bundle.DockerDaemonConfig, `"https-proxy": "http://proxy:3128"`) {
+		t.Fatalf("Unexpected daemon.json %q", bundle.DockerDaemonConfig)
+	}
+	if script := bundle.Script(); !strings.Contains(script, "cat > '/etc/containerd/certs.d/quay.io/hosts.toml'") || strings.Contains(script, "daemon.json") {
+		t.Fatalf("Unexpected script %s", script)
+	}
+
+	// DER 编码的 CA 证书
+	w := httptest.NewRecorder()
+	WriteCACertificate(w, httptest.NewRequest(http.MethodGet, "/api/v1/ca.crt?format=der", nil), m)
+	if ca, err := x509.ParseCertificate(w.Body.Bytes()); err != nil || !ca.IsCA {
+		t.Fatalf("Expected DER encoded CA: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package cert
+
+import (
+	"crypto/tls"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UnifiedHost 统一证书在签发记录中使用的主机名，吊销该主机名的证书即吊销统一证书
+const UnifiedHost = "*"
+
+// UnifiedCertificate 返回包含全部配置名称的统一证书，名称变化或临近过期时重新签发，
+// 之后的握手直接使用新证书，不需要重启
+func (m *Manager) UnifiedCertificate() (*tls.Certificate, error) {
+	if m.unifiedNames == nil {
+		return nil, errors.New("unified certificate is not enabled")
+	}
+	dnsNames, ips := subjectAltNames(m.unifiedNames())
+	names := append([]string{}, dnsNames...)
+	for _, ip := range ips {
+		names = append(names, ip.String())
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no names configured for unified certificate")
+	}
+	sort.Strings(names)
+	key := strings.Join(names, ",")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.unified != nil && m.unifiedKey == key && time.Until(m.unified.Leaf.NotAfter) > leafRenewBefore {
+		return m.unified, nil
+	}
+	cert, err := m.ca.sign(names[0], names, m.crlURLs)
+	if err != nil {
+		return nil, err
+	}
+	m.unified, m.unifiedKey = cert, key
+	m.inventory.record(UnifiedHost, cert.Leaf, fingerprint(m.ca.cert))
+	m.inventory.save()
+	return cert, nil
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RepositoryACL 内置镜像仓库的访问控制
+// Repository 为仓库名，以 /* 结尾时匹配该前缀下的所有仓库，例如 team-a/*
+// Pull 和 Push 中的成员是用户名，或 token:<id> 表示某个个人访问令牌；能推送的成员也能拉取
+type RepositoryACL struct {
+	Repository string   `json:"repository"`
+	Public     bool     `json:"public"`
+	Pull       []string `json:"pull,omitempty"`
+	Push       []string `json:"push,omitempty"`
+}
+
+// Validate 校验仓库名模式和成员
+func (acl RepositoryACL) Validate() error {
+	name := strings.TrimSuffix(strings.TrimSuffix(acl.Repository, "*"), "/")
+	if acl.Repository == "" || (name == "" && acl.Repository != "*") || strings.ContainsAny(name, "* \t") {
+		return fmt.Errorf("invalid repository pattern %q", acl.Repository)
+	}
+	if strings.HasSuffix(acl.Repository, "*") && acl.Repository != "*" && !strings.HasSuffix(acl.Repository, "/*") {
+		return fmt.Errorf("invalid repository pattern %q, wildcard must follow a slash", acl.Repository)
+	}
+	for _, member := range append(append([]string{}, acl.Pull...), acl.Push...) {
+		if strings.TrimSpace(member) == "" || member == "token:" {
+			return fmt.Errorf("invalid member %q", member)
+		}
+	}
+	return nil
+}
+
+// ACLStore 定义仓库访问控制存储接口
+type ACLStore interface {
+	// Get 获取指定仓库的访问控制
+	Get(repository string) (RepositoryACL, bool, error)
+
+	// List 按仓库名顺序列出所有访问控制
+	List() ([]RepositoryACL, error)
+
+	// Put 添加或更新访问控制
+	Put(acl RepositoryACL) error
+
+	// Remove 删除访问控制
+	Remove(repository string) (bool, error)
+
+	// Close 关闭存储
+	Close() error
+}
+
+// MemoryACLStore 内存访问控制存储实现
+type MemoryACLStore struct {
+	acls map[string]RepositoryACL
+	mu   sync.RWMutex
+}
+
+// NewMemoryACLStore 创建新的内存访问控制存储
+func NewMemoryACLStore() *MemoryACLStore {
+	return &MemoryACLStore{
+		acls: make(map[string]RepositoryACL),
+	}
+}
+
+// Get 获取指定仓库的访问控制
+func (s *MemoryACLStore) Get(repository string) (RepositoryACL, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	acl, ok := s.acls[repository]
+	return acl, ok, nil
+}
+
+// List 按仓库名顺序列出所有访问控制
+func (s *MemoryACLStore) List() ([]RepositoryACL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	acls := make([]RepositoryACL, 0, len(s.acls))
+	for _, acl := range s.acls {
+		acls = append(acls, acl)
+	}
+	sort.Slice(acls, func(i, j int) bool {
+		return acls[i].Repository < acls[j].Repository
+	})
+	return acls, nil
+}
+
+// Put 添加或更新访问控制
+func (s *MemoryACLStore) Put(acl RepositoryACL) error {
+	if acl.Repository == "" {
+		return errors.New("repository is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.acls[acl.Repository] = acl
+	return nil
+}
+
+// Remove 删除访问控制
+func (s *MemoryACLStore) Remove(repository string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.acls[repository]; !exists {
+		return false, nil
+	}
+	delete(s.acls, repository)
+	return true, nil
+}
+
+// Close 关闭存储
+func (s *MemoryACLStore) Close() error {
+	return nil
+}
+
+// FileACLStore 文件访问控制存储实现
+type FileACLStore struct {
+	*MemoryACLStore
+	filePath string
+	saveMu   sync.Mutex
+}
+
+// NewFileACLStore 创建新的文件访问控制存储
+func NewFileACLStore(filePath string) (*FileACLStore, error) {
+	store := &FileACLStore{
+		MemoryACLStore: NewMemoryACLStore(),
+		filePath:       filePath,
+	}
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var acls []RepositoryACL
+	if err := json.Unmarshal(data, &acls); err != nil {
+		return nil, fmt.Errorf("failed to parse acl file %s: %v", filePath, err)
+	}
+	for _, acl := range acls {
+		store.acls[acl.Repository] = acl
+	}
+	return store, nil
+}
+
+// saveToFile 将访问控制写入文件
+func (s *FileACLStore) saveToFile() error {
+	acls, err := s.MemoryACLStore.List()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(acls, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(s.filePath, data, 0600)
+}
+
+// Put 添加或更新访问控制并保存到文件
+func (s *FileACLStore) Put(acl RepositoryACL) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	old, existed, _ := s.MemoryACLStore.Get(acl.Repository)
+	if err := s.MemoryACLStore.Put(acl); err != nil {
+		return err
+	}
+
+	if err := s.saveToFile(); err != nil {
+		s.mu.Lock()
+		if existed {
+			s.acls[acl.Repository] = old
+		} else {
+			delete(s.acls, acl.Repository)
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Remove 删除访问控制并保存到文件
+func (s *FileACLStore) Remove(repository string) (bool, error) {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	old, _, _ := s.MemoryACLStore.Get(repository)
+	removed, err := s.MemoryACLStore.Remove(repository)
+	if err != nil || !removed {
+		return removed, err
+	}
+
+	if err := s.saveToFile(); err != nil {
+		s.mu.Lock()
+		s.acls[repository] = old
+		s.mu.Unlock()
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateACLStore 创建访问控制存储
+func CreateACLStore(storeType, path string) (ACLStore, error) {
+	switch storeType {
+	case "memory":
+		return NewMemoryACLStore(), nil
+	case "file":
+		if path == "" {
+			return nil, errors.New("file path is required for file acl store")
+		}
+		return NewFileACLStore(path)
+	default:
+		return nil, errors.New("unsupported acl store type")
+	}
+}
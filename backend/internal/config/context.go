@@ -0,0 +1,246 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// contextNamePattern 与 docker CLI 的 context 名称规则一致，名称会出现在 URL 路径中
+var contextNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.+-]*$`)
+
+// DockerContext 表示一个 Docker 守护进程的连接配置
+type DockerContext struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // tcp, socket or ssh
+	Host string `json:"host"` // tcp://host:port、unix:///path/to/socket 或 ssh://user@host:port
+
+	Group  string            `json:"group,omitempty"`  // 分组，例如 prod、staging
+	Labels map[string]string `json:"labels,omitempty"` // 自定义标签
+
+	// ReadOnly 只读 context 只允许查询，所有修改操作都会被拒绝
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// SSH 连接配置，仅对 ssh:// 生效，认证使用密钥或 ssh-agent
+	SSHIdentityFile   string `json:"sshIdentityFile,omitempty"`   // 私钥文件路径，为空时使用 ssh-agent 或默认密钥
+	SSHKnownHostsFile string `json:"sshKnownHostsFile,omitempty"` // known_hosts 文件路径，为空时使用 ~/.ssh/known_hosts
+	SSHHostKeyCheck   string `json:"sshHostKeyCheck,omitempty"`   // yes/accept-new/no，为空时使用 ssh 默认策略
+
+	// TLS 配置，仅对 tcp:// 生效，证书和私钥可以是文件路径或 PEM 文本
+	TLSCACert     string `json:"tlsCACert,omitempty"`
+	TLSCert       string `json:"tlsCert,omitempty"`
+	TLSKey        string `json:"tlsKey,omitempty"`
+	TLSSkipVerify bool   `json:"tlsSkipVerify,omitempty"` // 跳过服务端证书校验
+}
+
+// contextTypes 地址协议对应的 context 类型
+var contextTypes = map[string]string{
+	"tcp":  "tcp",
+	"unix": "socket",
+	"ssh":  "ssh",
+}
+
+// UsesTLS 判断是否配置了 TLS
+func (c *DockerContext) UsesTLS() bool {
+	return c.TLSCACert != "" || c.TLSCert != "" || c.TLSKey != "" || c.TLSSkipVerify
+}
+
+// Redacted 返回去掉内联私钥的副本，用于 API 响应；私钥为文件路径时保留
+func (c DockerContext) Redacted() DockerContext {
+	if strings.HasPrefix(strings.TrimSpace(c.TLSKey), "-----BEGIN") {
+		c.TLSKey = ""
+	}
+	return c
+}
+
+// MatchLabels 判断 context 是否匹配全部标签选择器，选择器格式为 key 或 key=value
+func (c *DockerContext) MatchLabels(selectors []string) bool {
+	for _, selector := range selectors {
+		key, value, hasValue := strings.Cut(selector, "=")
+		actual, ok := c.Labels[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate 检查配置格式，Type 为空时根据地址协议补全
+func (c *DockerContext) Validate() error {
+	if !contextNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("invalid context name %q", c.Name)
+	}
+
+	scheme, _, ok := strings.Cut(c.Host, "://")
+	if !ok {
+		return fmt.Errorf("invalid host %q: expected tcp://, unix:// or ssh://", c.Host)
+	}
+	contextType, ok := contextTypes[scheme]
+	if !ok {
+		return fmt.Errorf("unsupported host scheme %q", scheme)
+	}
+	if c.Type == "" {
+		c.Type = contextType
+	} else if c.Type != contextType {
+		return fmt.Errorf("context type %q does not match host %q", c.Type, c.Host)
+	}
+
+	if c.Group != "" && !contextNamePattern.MatchString(c.Group) {
+		return fmt.Errorf("invalid context group %q", c.Group)
+	}
+	for key := range c.Labels {
+		if key == "" || strings.ContainsAny(key, "=,") {
+			return fmt.Errorf("invalid context label key %q", key)
+		}
+	}
+
+	switch c.SSHHostKeyCheck {
+	case "", "yes", "accept-new", "no":
+	default:
+		return fmt.Errorf("invalid ssh host key check %q: expected yes, accept-new or no", c.SSHHostKeyCheck)
+	}
+	if scheme != "ssh" && (c.SSHIdentityFile != "" || c.SSHKnownHostsFile != "" || c.SSHHostKeyCheck != "") {
+		return fmt.Errorf("ssh options are only supported for ssh:// hosts")
+	}
+
+	if c.UsesTLS() && scheme != "tcp" {
+		return fmt.Errorf("tls is only supported for tcp:// hosts")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls client certificate and key must be provided together")
+	}
+	return nil
+}
+
+// ContextStore 定义 Docker context 存储接口
+type ContextStore interface {
+	// Get 获取指定名称的 context
+	Get(name string) (DockerContext, bool, error)
+
+	// List 按名称顺序列出所有 context
+	List() ([]DockerContext, error)
+
+	// Put 添加或更新 context
+	Put(ctx DockerContext) error
+
+	// Remove 删除 context
+	Remove(name string) (bool, error)
+
+	// Current 获取当前 context 名称
+	Current() (string, error)
+
+	// SetCurrent 设置当前 context，name 为空表示清除
+	SetCurrent(name string) error
+
+	// Close 关闭存储
+	Close() error
+}
+
+// MemoryContextStore 内存 context 存储实现
+type MemoryContextStore struct {
+	contexts map[string]DockerContext
+	current  string
+	mu       sync.RWMutex
+}
+
+// NewMemoryContextStore 创建新的内存 context 存储
+func NewMemoryContextStore() *MemoryContextStore {
+	return &MemoryContextStore{
+		contexts: make(map[string]DockerContext),
+	}
+}
+
+// Get 获取指定名称的 context
+func (s *MemoryContextStore) Get(name string) (DockerContext, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ctx, ok := s.contexts[name]
+	return ctx, ok, nil
+}
+
+// List 按名称顺序列出所有 context
+func (s *MemoryContextStore) List() ([]DockerContext, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contexts := make([]DockerContext, 0, len(s.contexts))
+	for _, ctx := range s.contexts {
+		contexts = append(contexts, ctx)
+	}
+	sort.Slice(contexts, func(i, j int) bool {
+		return contexts[i].Name < contexts[j].Name
+	})
+	return contexts, nil
+}
+
+// Put 添加或更新 context
+func (s *MemoryContextStore) Put(ctx DockerContext) error {
+	if err := ctx.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.contexts[ctx.Name] = ctx
+	return nil
+}
+
+// Remove 删除 context，不允许删除当前 context
+func (s *MemoryContextStore) Remove(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name == s.current {
+		return false, fmt.Errorf("cannot delete current context: %s", name)
+	}
+	if _, exists := s.contexts[name]; !exists {
+		return false, nil
+	}
+	delete(s.contexts, name)
+	return true, nil
+}
+
+// Current 获取当前 context 名称
+func (s *MemoryContextStore) Current() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.current, nil
+}
+
+// SetCurrent 设置当前 context
+func (s *MemoryContextStore) SetCurrent(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.contexts[name]; name != "" && !exists {
+		return fmt.Errorf("context %s not found", name)
+	}
+	s.current = name
+	return nil
+}
+
+// Close 关闭存储
+func (s *MemoryContextStore) Close() error {
+	return nil
+}
+
+// CreateContextStore 创建 context 存储
+func CreateContextStore(storeType, path string) (ContextStore, error) {
+	switch storeType {
+	case "memory":
+		return NewMemoryContextStore(), nil
+	case "file":
+		if path == "" {
+			return nil, errors.New("file path is required for file context store")
+		}
+		return NewFileContextStore(path)
+	default:
+		return nil, errors.New("unsupported context store type")
+	}
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// contextFileVersion 当前 context 文件格式版本
+const contextFileVersion = 1
+
+// contextFile context 文件格式
+type contextFile struct {
+	Version        int             `json:"version"`
+	CurrentContext string          `json:"currentContext"`
+	Contexts       []DockerContext `json:"contexts"`
+}
+
+// legacyContextFile 旧版本的 context 文件格式，没有 version 字段，context 以名称为键
+type legacyContextFile struct {
+	Contexts       map[string]json.RawMessage `json:"contexts"`
+	CurrentContext string                     `json:"current-context"`
+}
+
+// LegacyContextBackup 返回迁移旧格式文件时保留的备份文件路径
+func LegacyContextBackup(path string) string {
+	return path + ".legacy"
+}
+
+// FileContextStore 文件 context 存储实现，每次修改后整体原子写入文件
+type FileContextStore struct {
+	*MemoryContextStore
+	filePath string
+	saveMu   sync.Mutex // 串行化修改和写文件，保证文件内容与最后一次修改一致
+}
+
+// NewFileContextStore 创建新的文件 context 存储，旧格式文件会被自动迁移
+func NewFileContextStore(filePath string) (*FileContextStore, error) {
+	store := &FileContextStore{
+		MemoryContextStore: NewMemoryContextStore(),
+		filePath:           filePath,
+	}
+
+	// 如果文件存在，加载配置
+	if _, err := os.Stat(filePath); err == nil {
+		if err := store.loadFromFile(); err != nil {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+// loadFromFile 从文件加载 context
+func (s *FileContextStore) loadFromFile() error {
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		return err
+	}
+
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("failed to parse context file %s: %v", s.filePath, err)
+	}
+
+	switch header.Version {
+	case 0:
+		return s.migrateLegacy(data)
+	case contextFileVersion:
+	default:
+		return fmt.Errorf("unsupported context file version %d in %s", header.Version, s.filePath)
+	}
+
+	var file contextFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse context file %s: %v", s.filePath, err)
+	}
+	for _, ctx := range file.Contexts {
+		s.contexts[ctx.Name] = ctx
+	}
+	if _, ok := s.contexts[file.CurrentContext]; ok {
+		s.current = file.CurrentContext
+	}
+	return nil
+}
+
+// migrateLegacy 将旧格式转换为当前格式，原文件保留为备份
+func (s *FileContextStore) migrateLegacy(data []byte) error {
+	var legacy legacyContextFile
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return fmt.Errorf("failed to parse legacy context file %s: %v", s.filePath, err)
+	}
+
+	for name, raw := range legacy.Contexts {
+		var ctx DockerContext
+		if err := json.Unmarshal(raw, &ctx); err != nil {
+			log.Printf("Skipping invalid legacy context %s: %v", name, err)
+			continue
+		}
+		ctx.Name = name
+		// 校验同时补全缺失的类型，校验失败的旧配置仍然保留，由用户在界面中修正
+		if err := ctx.Validate(); err != nil {
+			log.Printf("Legacy context %s is invalid: %v", name, err)
+		}
+		s.contexts[name] = ctx
+	}
+	if _, ok := s.contexts[legacy.CurrentContext]; ok {
+		s.current = legacy.CurrentContext
+	}
+
+	if err := WriteFileAtomic(LegacyContextBackup(s.filePath), data, 0600); err != nil {
+		return fmt.Errorf("failed to back up legacy context file: %v", err)
+	}
+	if err := s.saveToFile(); err != nil {
+		return err
+	}
+	log.Printf("Migrated %d contexts in %s to version %d", len(s.contexts), s.filePath, contextFileVersion)
+	return nil
+}
+
+// saveToFile 将 context 写入文件
+func (s *FileContextStore) saveToFile() error {
+	contexts, err := s.MemoryContextStore.List()
+	if err != nil {
+		return err
+	}
+	current, err := s.MemoryContextStore.Current()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(contextFile{
+		Version:        contextFileVersion,
+		CurrentContext: current,
+		Contexts:       contexts,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 文件中可能包含 TLS 私钥，仅允许当前用户读取
+	return WriteFileAtomic(s.filePath, data, 0600)
+}
+
+// Put 添加或更新 context 并保存到文件
+func (s *FileContextStore) Put(ctx DockerContext) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	old, existed, _ := s.MemoryContextStore.Get(ctx.Name)
+	if err := s.MemoryContextStore.Put(ctx); err != nil {
+		return err
+	}
+
+	if err := s.saveToFile(); err != nil {
+		// 写入失败时回滚内存中的修改
+		s.mu.Lock()
+		if existed {
+			s.contexts[ctx.Name] = old
+		} else {
+			delete(s.contexts, ctx.Name)
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Remove 删除 context 并保存到文件
+func (s *FileContextStore) Remove(name string) (bool, error) {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	old, _, _ := s.MemoryContextStore.Get(name)
+	removed, err := s.MemoryContextStore.Remove(name)
+	if err != nil || !removed {
+		return removed, err
+	}
+
+	if err := s.saveToFile(); err != nil {
+		s.mu.Lock()
+		s.contexts[name] = old
+		s.mu.Unlock()
+		return false, err
+	}
+	return true, nil
+}
+
+// SetCurrent 设置当前 context 并保存到文件
+func (s *FileContextStore) SetCurrent(name string) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	old, _ := s.MemoryContextStore.Current()
+	if err := s.MemoryContextStore.SetCurrent(name); err != nil {
+		return err
+	}
+
+	if err := s.saveToFile(); err != nil {
+		s.mu.Lock()
+		s.current = old
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
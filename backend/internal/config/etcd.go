@@ -0,0 +1,444 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultEtcdPrefix 仓库配置在 etcd 中的默认键前缀，键为前缀加主机名
+	defaultEtcdPrefix = "/container-ui/registries/"
+	// etcdRetryInterval watch 断开后重新连接的间隔
+	etcdRetryInterval = 2 * time.Second
+)
+
+// EtcdConfig etcd 配置存储的连接设置
+type EtcdConfig struct {
+	// Endpoints etcd 地址，例如 https://etcd-0:2379，按顺序尝试
+	Endpoints []string `json:"endpoints"`
+	// Prefix 键前缀，多个代理集群可以共用一个 etcd，为空时为 /container-ui/registries/
+	Prefix string `json:"prefix,omitempty"`
+	// Username、Password 启用 etcd 认证时使用
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// CACert、Cert、Key 证书文件路径，CACert 用于校验 etcd 的服务端证书，Cert 和 Key 用于双向认证
+	CACert string `json:"caCert,omitempty"`
+	Cert   string `json:"cert,omitempty"`
+	Key    string `json:"key,omitempty"`
+	// Timeout 单个请求的超时时间，0 时为 5 秒
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// EtcdConfigStore 配置保存在 etcd 中，多个代理副本共享同一份仓库配置。
+// 通过 etcd v3 的 JSON 网关访问，启动时读取前缀下的全部配置并持续 watch，
+// 其他副本的修改实时同步到本地，读取直接使用本地副本
+type EtcdConfigStore struct {
+	*MemoryConfigStore
+	changeListeners
+
+	config EtcdConfig
+	client *http.Client
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu    sync.Mutex
+	token string // 启用认证时的令牌
+}
+
+// etcdKeyValue etcd 的键值，键和值为 base64 编码 (由 []byte 字段处理)
+type etcdKeyValue struct {
+	Key         []byte `json:"key"`
+	Value       []byte `json:"value,omitempty"`
+	ModRevision int64  `json:"mod_revision,string,omitempty"`
+}
+
+type etcdHeader struct {
+	Revision int64 `json:"revision,string,omitempty"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader     `json:"header"`
+	Kvs    []etcdKeyValue `json:"kvs"`
+}
+
+type etcdDeleteResponse struct {
+	Deleted int64 `json:"deleted,string,omitempty"`
+}
+
+type etcdWatchResponse struct {
+	Result struct {
+		Header          etcdHeader `json:"header"`
+		Canceled        bool       `json:"canceled,omitempty"`
+		CompactRevision int64      `json:"compact_revision,string,omitempty"`
+		Events          []struct {
+			// Type 为空时是 PUT
+			Type string       `json:"type,omitempty"`
+			Kv   etcdKeyValue `json:"kv"`
+		} `json:"events"`
+	} `json:"result"`
+	Error *etcdError `json:"error,omitempty"`
+}
+
+type etcdError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewEtcdConfigStore 连接 etcd 并加载前缀下的全部配置
+func NewEtcdConfigStore(cfg EtcdConfig) (*EtcdConfigStore, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, errors.New("etcd endpoints are required for etcd config store")
+	}
+	for i, endpoint := range cfg.Endpoints {
+		endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+		cfg.Endpoints[i] = endpoint
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = defaultEtcdPrefix
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	tlsConfig, err := etcdTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &EtcdConfigStore{
+		MemoryConfigStore: NewMemoryConfigStore(),
+		config:            cfg,
+		// watch 是长连接，超时由每个请求的 context 控制
+		client: &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}},
+		done:   make(chan struct{}),
+	}
+	revision, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	migrateCredentials(s.snapshot(), s.Add)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.watch(ctx, revision)
+	return s, nil
+}
+
+// etcdTLSConfig 按证书文件创建 TLS 配置
+func etcdTLSConfig(cfg EtcdConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CACert != "" {
+		caPEM, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read etcd ca certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("failed to parse etcd ca certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (cfg.Cert == "") != (cfg.Key == "") {
+		return nil, errors.New("etcd client certificate and key must be provided together")
+	}
+	if cfg.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load etcd client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// load 读取前缀下的全部配置替换本地副本，返回读取时的 revision
+func (s *EtcdConfigStore) load() (int64, error) {
+	var resp etcdRangeResponse
+	err := s.call(context.Background(), "/v3/kv/range", map[string]interface{}{
+		"key":       []byte(s.config.Prefix),
+		"range_end": prefixEnd(s.config.Prefix),
+	}, &resp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load configs from etcd: %v", err)
+	}
+
+	configs := make(map[string]Config, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if cfg, ok := s.decode(kv); ok {
+			configs[cfg.HostName] = cfg
+		}
+	}
+
+	for _, hostName := range s.MemoryConfigStore.replace(configs) {
+		s.notify(hostName)
+	}
+	return resp.Header.Revision, nil
+}
+
+// decode 解析 etcd 中保存的配置，主机名以键为准
+func (s *EtcdConfigStore) decode(kv etcdKeyValue) (Config, bool) {
+	hostName := strings.TrimPrefix(string(kv.Key), s.config.Prefix)
+	var cfg Config
+	if err := json.Unmarshal(kv.Value, &cfg); err != nil {
+		log.Printf("Ignoring invalid registry config %s in etcd: %v", kv.Key, err)
+		return Config{}, false
+	}
+	cfg.HostName = hostName
+	return cfg, true
+}
+
+// watch 持续同步前缀下的修改，连接断开后从上次的 revision 继续，历史已被压缩时重新加载全部配置
+func (s *EtcdConfigStore) watch(ctx context.Context, revision int64) {
+	defer close(s.done)
+	for {
+		next, err := s.watchOnce(ctx, revision)
+		if ctx.Err() != nil {
+			return
+		}
+		if next > revision {
+			revision = next
+		}
+		if errors.Is(err, errEtcdCompacted) {
+			if revision, err = s.load(); err == nil {
+				continue
+			}
+		}
+		log.Printf("etcd watch interrupted, retrying: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(etcdRetryInterval):
+		}
+	}
+}
+
+// errEtcdCompacted watch 的起始 revision 已被压缩
+var errEtcdCompacted = errors.New("etcd revision compacted")
+
+// watchOnce 建立一次 watch 流并应用收到的事件，返回已处理的 revision
+func (s *EtcdConfigStore) watchOnce(ctx context.Context, revision int64) (int64, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            []byte(s.config.Prefix),
+			"range_end":      prefixEnd(s.config.Prefix),
+			"start_revision": fmt.Sprint(revision + 1),
+		},
+	})
+	if err != nil {
+		return revision, err
+	}
+	resp, err := s.do(ctx, "/v3/watch", body)
+	if err != nil {
+		return revision, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var event etcdWatchResponse
+		if err := decoder.Decode(&event); err != nil {
+			return revision, err
+		}
+		if event.Error != nil {
+			return revision, errors.New(event.Error.Message)
+		}
+		result := event.Result
+		if result.CompactRevision > 0 {
+			return revision, errEtcdCompacted
+		}
+		if result.Canceled {
+			return revision, errors.New("watch canceled by etcd")
+		}
+		for _, e := range result.Events {
+			hostName := strings.TrimPrefix(string(e.Kv.Key), s.config.Prefix)
+			if e.Type == "DELETE" {
+				s.MemoryConfigStore.Remove(hostName)
+			} else if cfg, ok := s.decode(e.Kv); ok {
+				s.MemoryConfigStore.Add(cfg)
+			}
+			if e.Kv.ModRevision > revision {
+				revision = e.Kv.ModRevision
+			}
+			s.notify(hostName)
+		}
+	}
+}
+
+// Add 写入 etcd 并更新本地副本
+func (s *EtcdConfigStore) Add(config Config) error {
+	config, err := sealCredentials(config)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+	if err := s.call(ctx, "/v3/kv/put", map[string]interface{}{
+		"key":   []byte(s.config.Prefix + config.HostName),
+		"value": value,
+	}, nil); err != nil {
+		return fmt.Errorf("failed to save config to etcd: %v", err)
+	}
+	return s.MemoryConfigStore.Add(config)
+}
+
+// Remove 从 etcd 删除配置并更新本地副本
+func (s *EtcdConfigStore) Remove(hostName string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+	var resp etcdDeleteResponse
+	if err := s.call(ctx, "/v3/kv/deleterange", map[string]interface{}{
+		"key": []byte(s.config.Prefix + hostName),
+	}, &resp); err != nil {
+		return false, fmt.Errorf("failed to remove config from etcd: %v", err)
+	}
+	s.MemoryConfigStore.Remove(hostName)
+	return resp.Deleted > 0, nil
+}
+
+// Close 停止 watch
+func (s *EtcdConfigStore) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// call 发送请求并解析响应，out 为空时忽略响应内容
+func (s *EtcdConfigStore) call(ctx context.Context, path string, request interface{}, out interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.Timeout)
+		defer cancel()
+	}
+	resp, err := s.do(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// do 依次尝试各个 etcd 地址，令牌过期时重新认证一次
+func (s *EtcdConfigStore) do(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	var lastErr error
+	for _, endpoint := range s.config.Endpoints {
+		for attempt := 0; attempt < 2; attempt++ {
+			token, err := s.authToken(ctx, endpoint, attempt > 0)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+path, bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", token)
+			}
+			resp, err := s.client.Do(req)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			if resp.StatusCode == http.StatusOK {
+				return resp, nil
+			}
+			lastErr = etcdResponseError(resp)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized || s.config.Username == "" {
+				return nil, lastErr
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, lastErr
+}
+
+// authToken 返回认证令牌，未配置用户名时为空；renew 为 true 时重新认证
+func (s *EtcdConfigStore) authToken(ctx context.Context, endpoint string, renew bool) (string, error) {
+	if s.config.Username == "" {
+		return "", nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && !renew {
+		return s.token, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"name": s.config.Username, "password": s.config.Password})
+	authCtx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(authCtx, http.MethodPost, endpoint+"/v3/auth/authenticate", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("etcd authentication failed: %v", etcdResponseError(resp))
+	}
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return "", err
+	}
+	s.token = auth.Token
+	return s.token, nil
+}
+
+// etcdResponseError 解析 JSON 网关返回的错误
+func etcdResponseError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e etcdError
+	if json.Unmarshal(data, &e) == nil && e.Message != "" {
+		return fmt.Errorf("etcd returned %s: %s", resp.Status, e.Message)
+	}
+	return fmt.Errorf("etcd returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+}
+
+// prefixEnd 返回前缀范围查询的结束键，即前缀最后一个字节加一
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// 前缀全部为 0xff 时查询到最后
+	return []byte{0}
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEtcd 模拟 etcd v3 的 JSON 网关，watch 流推送 events 中的响应
+type fakeEtcd struct {
+	mu       sync.Mutex
+	kvs      map[string][]byte
+	revision int64
+	failPut  bool
+	watches  []int64 // 每次 watch 的起始 revision
+
+	events chan etcdWatchResponse
+}
+
+func newFakeEtcd(t *testing.T) (*fakeEtcd, *httptest.Server) {
+	f := &fakeEtcd{kvs: make(map[string][]byte), revision: 1, events: make(chan etcdWatchResponse, 10)}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeEtcd) set(key string, cfg Config) {
+	value, _ := json.Marshal(cfg)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revision++
+	f.kvs[key] = value
+}
+
+func (f *fakeEtcd) watchStarts() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int64{}, f.watches...)
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key           []byte `json:"key"`
+		RangeEnd      []byte `json:"range_end"`
+		Value         []byte `json:"value"`
+		CreateRequest struct {
+			StartRevision int64 `json:"start_revision,string"`
+		} `json:"create_request"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		resp := etcdRangeResponse{Header: etcdHeader{Revision: f.revision}}
+		for key, value := range f.kvs {
+			if key >= string(req.Key) && key < string(req.RangeEnd) {
+				resp.Kvs = append(resp.Kvs, etcdKeyValue{Key: []byte(key), Value: value})
+			}
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(resp)
+	case "/v3/kv/put":
+		if f.failPut {
+			f.mu.Unlock()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"code":14,"message":"etcdserver: request timed out"}`)
+			return
+		}
+		f.revision++
+		f.kvs[string(req.Key)] = req.Value
+		f.mu.Unlock()
+		fmt.Fprint(w, `{}`)
+	case "/v3/kv/deleterange":
+		_, ok := f.kvs[string(req.Key)]
+		delete(f.kvs, string(req.Key))
+		f.mu.Unlock()
+		if ok {
+			fmt.Fprint(w, `{"deleted":"1"}`)
+		} else {
+			fmt.Fprint(w, `{}`)
+		}
+	case "/v3/watch":
+		f.watches = append(f.watches, req.CreateRequest.StartRevision)
+		f.mu.Unlock()
+		w.(http.Flusher).Flush()
+		encoder := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-f.events:
+				encoder.Encode(event)
+				w.(http.Flusher).Flush()
+				if event.Result.CompactRevision > 0 {
+					return
+				}
+			}
+		}
+	default:
+		f.mu.Unlock()
+		http.NotFound(w, r)
+	}
+}
+
+func etcdEvent(eventType, key string, cfg Config, revision int64) etcdWatchResponse {
+	var resp etcdWatchResponse
+	value, _ := json.Marshal(cfg)
+	resp.Result.Events = append(resp.Result.Events, struct {
+		Type string       `json:"type,omitempty"`
+		Kv   etcdKeyValue `json:"kv"`
+	}{Type: eventType, Kv: etcdKeyValue{Key: []byte(key), Value: value, ModRevision: revision}})
+	return resp
+}
+
+// waitChange 等待 OnChange 通知主机名
+func waitChange(t *testing.T, changes <-chan string, hostName string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-changes:
+			if got == hostName {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for change of %s", hostName)
+		}
+	}
+}
+
+func TestEtcdConfigStore(t *testing.T) {
+	fake, server := newFakeEtcd(t)
+	fake.set(defaultEtcdPrefix+"registry.local", Config{RemoteURL: "https://registry.local"})
+	// 前缀之外的键不会被加载
+	fake.set("/other/ignored.local", Config{RemoteURL: "https://ignored.local"})
+
+	store, err := NewEtcdConfigStore(EtcdConfig{Endpoints: []string{strings.TrimPrefix(server.URL, "http://") + "/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	changes := make(chan string, 10)
+	store.OnChange(func(hostName string) { changes <- hostName })
+
+	// 启动时加载前缀下的配置，主机名取自键
+	if cfg, ok, _ := store.Get("registry.local"); !ok || cfg.HostName != "registry.local" || cfg.RemoteURL != "https://registry.local" {
+		t.Fatalf("Expected initial config, got %+v %v", cfg, ok)
+	}
+	if configs, _ := store.List(); len(configs) != 1 {
+		t.Fatalf("Expected 1 config, got %+v", configs)
+	}
+
+	// 其他副本的修改通过 watch 同步
+	fake.events <- etcdEvent("", defaultEtcdPrefix+"mirror.local", Config{RemoteURL: "https://mirror.local"}, 5)
+	waitChange(t, changes, "mirror.local")
+	if cfg, ok, _ := store.Get("mirror.local"); !ok || cfg.RemoteURL != "https://mirror.local" {
+		t.Fatalf("Expected watched config, got %+v %v", cfg, ok)
+	}
+	fake.events <- etcdEvent("DELETE", defaultEtcdPrefix+"registry.local", Config{}, 6)
+	waitChange(t, changes, "registry.local")
+	if _, ok, _ := store.Get("registry.local"); ok {
+		t.Fatal("Expected deleted config to be removed")
+	}
+	if starts := fake.watchStarts(); len(starts) != 1 || starts[0] != 4 {
+		t.Fatalf("Expected watch to start after the loaded revision, got %v", starts)
+	}
+
+	// 历史被压缩时重新加载全部配置，并从新的 revision 继续 watch
+	fake.mu.Lock()
+	fake.kvs = map[string][]byte{}
+	fake.revision = 9
+	fake.mu.Unlock()
+	fake.set(defaultEtcdPrefix+"new.local", Config{RemoteURL: "https://new.local"})
+	var compacted etcdWatchResponse
+	compacted.Result.CompactRevision = 5
+	fake.events <- compacted
+	waitChange(t, changes, "new.local")
+	if _, ok, _ := store.Get("mirror.local"); ok {
+		t.Fatal("Expected config missed during compaction to be removed")
+	}
+	if _, ok, _ := store.Get("new.local"); !ok {
+		t.Fatal("Expected config added during compaction to be loaded")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fake.watchStarts()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if starts := fake.watchStarts(); len(starts) != 2 || starts[1] != 11 {
+		t.Fatalf("Expected watch to restart after the reloaded revision, got %v", starts)
+	}
+
+	// 写入 etcd 失败时不修改本地副本
+	fake.mu.Lock()
+	fake.failPut = true
+	fake.mu.Unlock()
+	if err := store.Add(Config{HostName: "failed.local", RemoteURL: "https://failed.local"}); err == nil || !strings.Contains(err.Error(), "request timed out") {
+		t.Fatalf("Expected etcd error, got %v", err)
+	}
+	if _, ok, _ := store.Get("failed.local"); ok {
+		t.Fatal("Expected failed Add not to change the local copy")
+	}
+
+	fake.mu.Lock()
+	fake.failPut = false
+	fake.mu.Unlock()
+	if err := store.Add(Config{HostName: "added.local", RemoteURL: "https://added.local"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Get("added.local"); !ok {
+		t.Fatal("Expected added config in the local copy")
+	}
+	if removed, err := store.Remove("added.local"); err != nil || !removed {
+		t.Fatalf("Expected config to be removed, got %v %v", removed, err)
+	}
+}
@@ -2,15 +2,32 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
+// reloadDelay 文件变化后等待的时间，合并编辑器保存时产生的多个事件
+const reloadDelay = 200 * time.Millisecond
+
 // FileConfigStore 文件配置存储实现
 type FileConfigStore struct {
 	*MemoryConfigStore
+	changeListeners
 	filePath string
+
+	// saveMu 保证写入文件和重新加载不会交错，避免重新加载读到写入前的文件而丢失刚添加的配置
+	saveMu  sync.Mutex
+	watcher *fsnotify.Watcher
+	done    chan struct{}
 }
 
 // NewFileConfigStore 创建新的文件配置存储
@@ -30,27 +47,189 @@ func NewFileConfigStore(filePath string) (*FileConfigStore, error) {
 	return store, nil
 }
 
-// loadFromFile 从文件加载配置
-func (s *FileConfigStore) loadFromFile() error {
-	data, err := ioutil.ReadFile(s.filePath)
+// ReadConfigFile 读取配置文件中的全部配置，保留原来的顺序和重复的主机名，用于校验
+func ReadConfigFile(filePath string) ([]Config, error) {
+	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var configs []Config
 	if err := json.Unmarshal(data, &configs); err != nil {
-		return err
+		return nil, err
+	}
+	return configs, nil
+}
+
+// readFile 读取并解析配置文件，同一主机名出现多次时使用最后一个
+func (s *FileConfigStore) readFile() (map[string]Config, error) {
+	configs, err := ReadConfigFile(s.filePath)
+	if err != nil {
+		return nil, err
 	}
 
+	result := make(map[string]Config, len(configs))
 	for _, config := range configs {
-		if err := s.MemoryConfigStore.Add(config); err != nil {
-			return err
+		result[config.HostName] = config
+	}
+	return result, nil
+}
+
+// loadFromFile 从文件加载配置
+func (s *FileConfigStore) loadFromFile() error {
+	configs, err := s.readFile()
+	if err != nil {
+		return err
+	}
+	sealed := s.sealPlaintext(configs)
+	s.MemoryConfigStore.replace(configs)
+	s.saveSealed(sealed)
+	return nil
+}
+
+// sealPlaintext 配置了密钥时加密文件中以明文保存的凭据，返回是否有需要写回文件的修改。
+// 明文与当前配置中加密的值相同时沿用原来的密文，避免每次重新加载都被当作修改
+func (s *FileConfigStore) sealPlaintext(configs map[string]Config) bool {
+	current := s.MemoryConfigStore.snapshot()
+	sealed := false
+	for hostName, cfg := range configs {
+		if !hasPlaintextCredentials(cfg) {
+			continue
 		}
+		previous := current[hostName]
+		cfg.Username = reuseSealed(cfg.Username, previous.Username)
+		cfg.Password = reuseSealed(cfg.Password, previous.Password)
+		result, err := sealCredentials(cfg)
+		if err != nil {
+			log.Printf("Failed to encrypt plaintext credentials of %s: %v", hostName, err)
+			continue
+		}
+		configs[hostName] = result
+		sealed = true
 	}
+	return sealed
+}
 
+// reuseSealed 明文与 previous 解密后相同时返回 previous
+func reuseSealed(value, previous string) string {
+	if isPlaintextSecret(value) && strings.HasPrefix(previous, sealedPrefix) {
+		if plain, err := resolveSecret(previous); err == nil && plain == value {
+			return previous
+		}
+	}
+	return value
+}
+
+// saveSealed 把加密后的凭据写回配置文件，文件只读 (例如挂载的 ConfigMap) 时记录日志，内存中仍使用密文
+func (s *FileConfigStore) saveSealed(sealed bool) {
+	if !sealed {
+		return
+	}
+	if err := s.saveToFile(); err != nil {
+		log.Printf("Failed to write encrypted credentials to %s: %v", s.filePath, err)
+		return
+	}
+	log.Printf("Encrypted plaintext credentials in %s", s.filePath)
+}
+
+// Reload 重新读取配置文件并替换内存中的配置，通知发生变化的主机名；
+// 文件不存在或无法解析时保留当前配置
+func (s *FileConfigStore) Reload() ([]string, error) {
+	s.saveMu.Lock()
+	configs, err := s.readFile()
+	if err != nil {
+		s.saveMu.Unlock()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errors.New("config file not found")
+		}
+		return nil, err
+	}
+	sealed := s.sealPlaintext(configs)
+	changed := s.MemoryConfigStore.replace(configs)
+	s.saveSealed(sealed)
+	s.saveMu.Unlock()
+
+	sort.Strings(changed)
+	for _, hostName := range changed {
+		s.notify(hostName)
+	}
+	return changed, nil
+}
+
+// Watch 监听配置文件的变化并自动重新加载。监听的是文件所在的目录，
+// 编辑器保存和 Kubernetes 更新挂载的 ConfigMap 时通过重命名替换文件也能感知
+func (s *FileConfigStore) Watch() error {
+	if s.watcher != nil {
+		return nil
+	}
+	dir := filepath.Dir(s.filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return err
+	}
+	s.watcher = watcher
+	s.done = make(chan struct{})
+	go s.watch()
 	return nil
 }
 
+// watch 处理文件事件，一段时间内的多个事件只重新加载一次
+func (s *FileConfigStore) watch() {
+	defer close(s.done)
+	target := filepath.Clean(s.filePath)
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			// ConfigMap 挂载的文件是指向 ..data 目录的符号链接，更新时替换的是 ..data
+			if event.Op == fsnotify.Chmod || (filepath.Clean(event.Name) != target && filepath.Base(event.Name) != "..data") {
+				continue
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(reloadDelay, s.reloadChanged)
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Config file watch error: %v", err)
+		}
+	}
+}
+
+// reloadChanged 文件变化后重新加载，失败时记录日志并保留当前配置
+func (s *FileConfigStore) reloadChanged() {
+	if _, err := os.Stat(s.filePath); errors.Is(err, os.ErrNotExist) {
+		// 重命名替换的中间状态，等待新文件出现
+		return
+	}
+	changed, err := s.Reload()
+	if err != nil {
+		log.Printf("Failed to reload config file %s: %v", s.filePath, err)
+		return
+	}
+	if len(changed) > 0 {
+		log.Printf("Reloaded config file %s, changed: %v", s.filePath, changed)
+	}
+}
+
 // saveToFile 将配置保存到文件
 func (s *FileConfigStore) saveToFile() error {
 	configs, err := s.MemoryConfigStore.List()
@@ -75,16 +254,15 @@ func (s *FileConfigStore) saveToFile() error {
 		return err
 	}
 
-	// 确保目录存在
-	if err := os.MkdirAll(filepath.Dir(s.filePath), 0755); err != nil {
-		return err
-	}
-
-	return ioutil.WriteFile(s.filePath, data, 0644)
+	// 监听文件时可能随时重新加载，原子替换避免读到写了一半的文件
+	return WriteFileAtomic(s.filePath, data, 0644)
 }
 
 // Add 添加或更新配置并保存到文件
 func (s *FileConfigStore) Add(config Config) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
 	if err := s.MemoryConfigStore.Add(config); err != nil {
 		return err
 	}
@@ -94,6 +272,9 @@ func (s *FileConfigStore) Add(config Config) error {
 
 // Remove 删除配置并保存到文件
 func (s *FileConfigStore) Remove(hostName string) (bool, error) {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
 	removed, err := s.MemoryConfigStore.Remove(hostName)
 	if err != nil {
 		return false, err
@@ -107,3 +288,13 @@ func (s *FileConfigStore) Remove(hostName string) (bool, error) {
 
 	return removed, nil
 }
+
+// Close 停止监听配置文件
+func (s *FileConfigStore) Close() error {
+	if s.watcher == nil {
+		return nil
+	}
+	err := s.watcher.Close()
+	<-s.done
+	return err
+}
@@ -0,0 +1,595 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// serviceAccountDir Pod 内服务账号的令牌、CA 证书和命名空间所在的目录
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// defaultConfigMapKey ConfigMap 中保存仓库配置的键，内容与文件配置存储的 JSON 格式相同
+	defaultConfigMapKey = "registries.json"
+	// kubernetesRetryInterval watch 断开后重新连接的间隔
+	kubernetesRetryInterval = 2 * time.Second
+	// conflictRetries 写入 ConfigMap 遇到版本冲突时的重试次数
+	conflictRetries = 5
+
+	// RegistryProxyGroup、RegistryProxyVersion、RegistryProxyResource 保存仓库配置的自定义资源，
+	// 每个 RegistryProxy 对象的 spec 为一个仓库配置 (与 Config 的 JSON 格式相同)
+	RegistryProxyGroup    = "container-ui.io"
+	RegistryProxyVersion  = "v1alpha1"
+	RegistryProxyResource = "registryproxies"
+	RegistryProxyKind     = "RegistryProxy"
+)
+
+// KubernetesConfig Kubernetes 配置存储的设置，在 Pod 内运行时 (例如作为 DaemonSet) 默认使用服务账号
+type KubernetesConfig struct {
+	// APIServer API 服务器地址，为空时使用 KUBERNETES_SERVICE_HOST 和 KUBERNETES_SERVICE_PORT
+	APIServer string `json:"apiServer,omitempty"`
+	// TokenFile 令牌文件，每次请求时读取以支持令牌轮换，为空时使用服务账号的令牌
+	TokenFile string `json:"tokenFile,omitempty"`
+	// CACert 校验 API 服务器证书的 CA 证书文件，为空时使用服务账号的 CA 证书
+	CACert string `json:"caCert,omitempty"`
+	// Namespace 命名空间，为空时使用 Pod 所在的命名空间
+	Namespace string `json:"namespace,omitempty"`
+	// ConfigMap 不为空时配置保存在该 ConfigMap 的 Key 中，否则保存为 RegistryProxy 自定义资源
+	ConfigMap string `json:"configMap,omitempty"`
+	// Key ConfigMap 中的键，为空时为 registries.json
+	Key string `json:"key,omitempty"`
+	// Timeout 单个请求的超时时间，0 时为 10 秒
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// KubernetesConfigStore 从 ConfigMap 或 RegistryProxy 自定义资源读取仓库配置并持续 watch，
+// 通过 GitOps 修改的配置实时生效。管理接口的修改同样写回 Kubernetes，
+// 但由 GitOps 管理的对象之后可能被覆盖
+type KubernetesConfigStore struct {
+	*MemoryConfigStore
+	changeListeners
+
+	config KubernetesConfig
+	client *http.Client
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// writeMu 串行化写入，names 为自定义资源模式下主机名对应的对象名称
+	writeMu sync.Mutex
+	namesMu sync.Mutex
+	names   map[string]string
+}
+
+// kubeObject ConfigMap 和 RegistryProxy 共用的对象结构
+type kubeObject struct {
+	APIVersion string            `json:"apiVersion,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Metadata   kubeMetadata      `json:"metadata"`
+	Data       map[string]string `json:"data,omitempty"`
+	Spec       *Config           `json:"spec,omitempty"`
+}
+
+type kubeMetadata struct {
+	Name            string `json:"name,omitempty"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type kubeList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []kubeObject `json:"items"`
+}
+
+type kubeWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// kubeStatus API 服务器返回的错误
+type kubeStatus struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// errResourceExpired watch 的 resourceVersion 已过期，需要重新列出
+var errResourceExpired = errors.New("resource version expired")
+
+// NewKubernetesConfigStore 读取 ConfigMap 或自定义资源中的配置并开始 watch
+func NewKubernetesConfigStore(cfg KubernetesConfig) (*KubernetesConfigStore, error) {
+	if cfg.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("kubernetes api server is required outside a cluster")
+		}
+		cfg.APIServer = "https://" + net.JoinHostPort(host, port)
+	}
+	cfg.APIServer = strings.TrimRight(cfg.APIServer, "/")
+	if cfg.TokenFile == "" {
+		cfg.TokenFile = serviceAccountDir + "/token"
+	}
+	if cfg.CACert == "" {
+		cfg.CACert = serviceAccountDir + "/ca.crt"
+	}
+	if cfg.Namespace == "" {
+		data, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes namespace is required: %v", err)
+		}
+		cfg.Namespace = strings.TrimSpace(string(data))
+	}
+	if cfg.Key == "" {
+		cfg.Key = defaultConfigMapKey
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caPEM, err := os.ReadFile(cfg.CACert); err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("failed to parse kubernetes ca certificate")
+		}
+		tlsConfig.RootCAs = pool
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read kubernetes ca certificate: %v", err)
+	}
+
+	s := &KubernetesConfigStore{
+		MemoryConfigStore: NewMemoryConfigStore(),
+		config:            cfg,
+		client:            &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}},
+		done:              make(chan struct{}),
+		names:             make(map[string]string),
+	}
+	resourceVersion, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	migrateCredentials(s.snapshot(), s.Add)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.watch(ctx, resourceVersion)
+	return s, nil
+}
+
+// collectionPath 资源集合的路径
+func (s *KubernetesConfigStore) collectionPath() string {
+	ns := url.PathEscape(s.config.Namespace)
+	if s.config.ConfigMap != "" {
+		return "/api/v1/namespaces/" + ns + "/configmaps"
+	}
+	return "/apis/" + RegistryProxyGroup + "/" + RegistryProxyVersion + "/namespaces/" + ns + "/" + RegistryProxyResource
+}
+
+// listQuery 列出和 watch 时的查询参数，ConfigMap 模式只关注指定的 ConfigMap
+func (s *KubernetesConfigStore) listQuery() url.Values {
+	query := url.Values{}
+	if s.config.ConfigMap != "" {
+		query.Set("fieldSelector", "metadata.name="+s.config.ConfigMap)
+	}
+	return query
+}
+
+// load 列出全部配置替换本地副本，返回列出时的 resourceVersion
+func (s *KubernetesConfigStore) load() (string, error) {
+	var list kubeList
+	if err := s.request(context.Background(), http.MethodGet, s.collectionPath()+"?"+s.listQuery().Encode(), nil, &list); err != nil {
+		return "", fmt.Errorf("failed to load configs from kubernetes: %v", err)
+	}
+
+	configs := make(map[string]Config)
+	names := make(map[string]string)
+	for _, obj := range list.Items {
+		if s.config.ConfigMap != "" {
+			configs = s.parseConfigMap(obj)
+			continue
+		}
+		if obj.Spec != nil && obj.Spec.HostName != "" {
+			configs[obj.Spec.HostName] = *obj.Spec
+			names[obj.Spec.HostName] = obj.Metadata.Name
+		}
+	}
+	s.namesMu.Lock()
+	s.names = names
+	s.namesMu.Unlock()
+	for _, hostName := range s.MemoryConfigStore.replace(configs) {
+		s.notify(hostName)
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// parseConfigMap 解析 ConfigMap 中的配置，格式错误时保留当前配置
+func (s *KubernetesConfigStore) parseConfigMap(obj kubeObject) map[string]Config {
+	configs := make(map[string]Config)
+	data, ok := obj.Data[s.config.Key]
+	if !ok {
+		return configs
+	}
+	var list []Config
+	if err := json.Unmarshal([]byte(data), &list); err != nil {
+		log.Printf("Ignoring invalid registry configs in configmap %s: %v", obj.Metadata.Name, err)
+		return s.snapshot()
+	}
+	for _, cfg := range list {
+		configs[cfg.HostName] = cfg
+	}
+	return configs
+}
+
+// watch 持续同步修改，连接断开后从上次的 resourceVersion 继续，版本过期时重新列出
+func (s *KubernetesConfigStore) watch(ctx context.Context, resourceVersion string) {
+	defer close(s.done)
+	for {
+		next, err := s.watchOnce(ctx, resourceVersion)
+		if ctx.Err() != nil {
+			return
+		}
+		resourceVersion = next
+		if errors.Is(err, errResourceExpired) {
+			if resourceVersion, err = s.load(); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			log.Printf("Kubernetes watch interrupted, retrying: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(kubernetesRetryInterval):
+		}
+	}
+}
+
+// watchOnce 建立一次 watch 并应用收到的事件，返回最后处理的 resourceVersion
+func (s *KubernetesConfigStore) watchOnce(ctx context.Context, resourceVersion string) (string, error) {
+	query := s.listQuery()
+	query.Set("watch", "1")
+	query.Set("allowWatchBookmarks", "true")
+	query.Set("resourceVersion", resourceVersion)
+	resp, err := s.do(ctx, http.MethodGet, s.collectionPath()+"?"+query.Encode(), nil)
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event kubeWatchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				// API 服务器定期结束 watch，从当前版本继续
+				return resourceVersion, nil
+			}
+			return resourceVersion, err
+		}
+		if event.Type == "ERROR" {
+			var status kubeStatus
+			json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return resourceVersion, errResourceExpired
+			}
+			return resourceVersion, fmt.Errorf("watch error: %s", status.Message)
+		}
+
+		var obj kubeObject
+		if err := json.Unmarshal(event.Object, &obj); err != nil {
+			return resourceVersion, err
+		}
+		resourceVersion = obj.Metadata.ResourceVersion
+		switch event.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+			s.apply(event.Type, obj)
+		}
+	}
+}
+
+// apply 应用一个 watch 事件
+func (s *KubernetesConfigStore) apply(eventType string, obj kubeObject) {
+	if s.config.ConfigMap != "" {
+		configs := make(map[string]Config)
+		if eventType != "DELETED" {
+			configs = s.parseConfigMap(obj)
+		}
+		for _, hostName := range s.MemoryConfigStore.replace(configs) {
+			s.notify(hostName)
+		}
+		return
+	}
+
+	// 自定义资源的主机名可能被修改，按对象名称找到之前的主机名
+	s.namesMu.Lock()
+	var changed []string
+	for hostName, name := range s.names {
+		if name == obj.Metadata.Name && (eventType == "DELETED" || obj.Spec == nil || obj.Spec.HostName != hostName) {
+			delete(s.names, hostName)
+			s.MemoryConfigStore.Remove(hostName)
+			changed = append(changed, hostName)
+		}
+	}
+	if eventType != "DELETED" && obj.Spec != nil && obj.Spec.HostName != "" {
+		s.names[obj.Spec.HostName] = obj.Metadata.Name
+		s.MemoryConfigStore.Add(*obj.Spec)
+		changed = append(changed, obj.Spec.HostName)
+	}
+	s.namesMu.Unlock()
+	for _, hostName := range changed {
+		s.notify(hostName)
+	}
+}
+
+// Add 写入 ConfigMap 或创建、更新 RegistryProxy 对象，并更新本地副本
+func (s *KubernetesConfigStore) Add(config Config) error {
+	config, err := sealCredentials(config)
+	if err != nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if s.config.ConfigMap != "" {
+		err = s.updateConfigMap(func(configs map[string]Config) bool {
+			configs[config.HostName] = config
+			return true
+		})
+	} else {
+		err = s.putResource(config)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save config to kubernetes: %v", err)
+	}
+	return s.MemoryConfigStore.Add(config)
+}
+
+// Remove 从 ConfigMap 中删除配置或删除 RegistryProxy 对象
+func (s *KubernetesConfigStore) Remove(hostName string) (bool, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	removed := false
+	var err error
+	if s.config.ConfigMap != "" {
+		err = s.updateConfigMap(func(configs map[string]Config) bool {
+			_, removed = configs[hostName]
+			delete(configs, hostName)
+			return removed
+		})
+	} else {
+		s.namesMu.Lock()
+		name, ok := s.names[hostName]
+		s.namesMu.Unlock()
+		if ok {
+			err = s.request(context.Background(), http.MethodDelete, s.collectionPath()+"/"+url.PathEscape(name), nil, nil)
+			removed = err == nil || isNotFound(err)
+			if isNotFound(err) {
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to remove config from kubernetes: %v", err)
+	}
+	s.MemoryConfigStore.Remove(hostName)
+	return removed, nil
+}
+
+// updateConfigMap 读取 ConfigMap，修改配置后按 resourceVersion 写回，版本冲突时重试；ConfigMap 不存在时创建
+func (s *KubernetesConfigStore) updateConfigMap(modify func(map[string]Config) bool) error {
+	path := s.collectionPath() + "/" + url.PathEscape(s.config.ConfigMap)
+	for attempt := 0; ; attempt++ {
+		var obj kubeObject
+		err := s.request(context.Background(), http.MethodGet, path, nil, &obj)
+		create := isNotFound(err)
+		if err != nil && !create {
+			return err
+		}
+		configs := make(map[string]Config)
+		if !create {
+			if data, ok := obj.Data[s.config.Key]; ok {
+				var list []Config
+				if err := json.Unmarshal([]byte(data), &list); err != nil {
+					return fmt.Errorf("invalid registry configs in configmap: %v", err)
+				}
+				for _, cfg := range list {
+					configs[cfg.HostName] = cfg
+				}
+			}
+		}
+		if !modify(configs) {
+			return nil
+		}
+
+		list := make([]Config, 0, len(configs))
+		for _, cfg := range configs {
+			list = append(list, cfg)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].HostName < list[j].HostName })
+		data, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return err
+		}
+		if obj.Data == nil {
+			obj.Data = make(map[string]string)
+		}
+		obj.Data[s.config.Key] = string(data)
+		obj.APIVersion, obj.Kind = "v1", "ConfigMap"
+
+		if create {
+			obj.Metadata = kubeMetadata{Name: s.config.ConfigMap, Namespace: s.config.Namespace}
+			err = s.request(context.Background(), http.MethodPost, s.collectionPath(), obj, nil)
+		} else {
+			// 带 resourceVersion 写回，其他副本同时修改时返回 409
+			err = s.request(context.Background(), http.MethodPut, path, obj, nil)
+		}
+		if !isConflict(err) || attempt >= conflictRetries {
+			return err
+		}
+	}
+}
+
+// putResource 创建或更新主机名对应的 RegistryProxy 对象
+func (s *KubernetesConfigStore) putResource(config Config) error {
+	s.namesMu.Lock()
+	name, exists := s.names[config.HostName]
+	s.namesMu.Unlock()
+
+	obj := kubeObject{
+		APIVersion: RegistryProxyGroup + "/" + RegistryProxyVersion,
+		Kind:       RegistryProxyKind,
+		Spec:       &config,
+	}
+	if !exists {
+		obj.Metadata = kubeMetadata{Name: resourceName(config.HostName), Namespace: s.config.Namespace}
+		if err := s.request(context.Background(), http.MethodPost, s.collectionPath(), obj, nil); err != nil {
+			return err
+		}
+		s.namesMu.Lock()
+		s.names[config.HostName] = obj.Metadata.Name
+		s.namesMu.Unlock()
+		return nil
+	}
+
+	path := s.collectionPath() + "/" + url.PathEscape(name)
+	for attempt := 0; ; attempt++ {
+		var current kubeObject
+		if err := s.request(context.Background(), http.MethodGet, path, nil, &current); err != nil {
+			return err
+		}
+		obj.Metadata = current.Metadata
+		err := s.request(context.Background(), http.MethodPut, path, obj, nil)
+		if !isConflict(err) || attempt >= conflictRetries {
+			return err
+		}
+	}
+}
+
+// resourceName 把主机名转换为合法的对象名称，主机名本身不合法时 (例如 *.gcr.io、registry.local:5000)
+// 替换非法字符并附加主机名的摘要，避免不同主机名得到相同的名称
+func resourceName(hostName string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, strings.ReplaceAll(hostName, "*", "wildcard"))
+	name = strings.Trim(name, "-.")
+	if name == hostName && name != "" && len(name) <= 253 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(hostName))
+	if len(name) > 200 {
+		name = strings.Trim(name[:200], "-.")
+	}
+	if name == "" {
+		name = "registry"
+	}
+	return name + "-" + hex.EncodeToString(sum[:4])
+}
+
+// Close 停止 watch
+func (s *KubernetesConfigStore) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// kubeError API 服务器返回的错误
+type kubeError struct {
+	status int
+	kubeStatus
+}
+
+func (e *kubeError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("kubernetes returned %d: %s", e.status, e.Message)
+	}
+	return fmt.Sprintf("kubernetes returned %d", e.status)
+}
+
+func isNotFound(err error) bool {
+	var e *kubeError
+	return errors.As(err, &e) && e.status == http.StatusNotFound
+}
+
+func isConflict(err error) bool {
+	var e *kubeError
+	return errors.As(err, &e) && e.status == http.StatusConflict
+}
+
+// request 发送请求并解析响应，out 为空时忽略响应内容
+func (s *KubernetesConfigStore) request(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	resp, err := s.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// do 使用服务账号令牌发送请求，非 2xx 响应返回 kubeError
+func (s *KubernetesConfigStore) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.config.APIServer+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token, err := os.ReadFile(s.config.TokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read kubernetes token: %v", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	e := &kubeError{status: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(data, &e.kubeStatus) != nil || e.Message == "" {
+		e.Message = strings.TrimSpace(string(data))
+	}
+	return nil, e
+}
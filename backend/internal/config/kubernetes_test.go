@@ -0,0 +1,216 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKubernetes 模拟 API 服务器上的一个 ConfigMap，watch 流推送 events 中的事件
+type fakeKubernetes struct {
+	mu        sync.Mutex
+	configMap *kubeObject
+	version   int
+	conflicts int // 接下来的多少次 PUT 前模拟其他副本的写入
+	puts      int
+	watches   []string // 每次 watch 的起始 resourceVersion
+
+	events chan kubeWatchEvent
+}
+
+func newFakeKubernetes(t *testing.T) (*fakeKubernetes, *httptest.Server) {
+	f := &fakeKubernetes{version: 1, events: make(chan kubeWatchEvent, 10)}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+// setConfigs 替换 ConfigMap 中的配置，调用方持有锁
+func (f *fakeKubernetes) setConfigs(configs ...Config) {
+	data, _ := json.Marshal(configs)
+	f.version++
+	f.configMap = &kubeObject{
+		Metadata: kubeMetadata{Name: "registries", Namespace: "default", ResourceVersion: strconv.Itoa(f.version)},
+		Data:     map[string]string{defaultConfigMapKey: string(data)},
+	}
+}
+
+func (f *fakeKubernetes) hostNames() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var configs []Config
+	json.Unmarshal([]byte(f.configMap.Data[defaultConfigMapKey]), &configs)
+	var hostNames []string
+	for _, cfg := range configs {
+		hostNames = append(hostNames, cfg.HostName)
+	}
+	return hostNames
+}
+
+func (f *fakeKubernetes) watchStarts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.watches...)
+}
+
+func (f *fakeKubernetes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const collection = "/api/v1/namespaces/default/configmaps"
+	f.mu.Lock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == collection && r.URL.Query().Get("watch") == "1":
+		f.watches = append(f.watches, r.URL.Query().Get("resourceVersion"))
+		f.mu.Unlock()
+		w.(http.Flusher).Flush()
+		encoder := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-f.events:
+				encoder.Encode(event)
+				w.(http.Flusher).Flush()
+				if event.Type == "ERROR" {
+					return
+				}
+			}
+		}
+	case r.Method == http.MethodGet && r.URL.Path == collection:
+		list := kubeList{}
+		list.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		if f.configMap != nil && r.URL.Query().Get("fieldSelector") == "metadata.name=registries" {
+			list.Items = append(list.Items, *f.configMap)
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodGet && r.URL.Path == collection+"/registries":
+		defer f.mu.Unlock()
+		if f.configMap == nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":404,"reason":"NotFound","message":"configmaps \"registries\" not found"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(f.configMap)
+	case r.Method == http.MethodPut && r.URL.Path == collection+"/registries":
+		defer f.mu.Unlock()
+		var obj kubeObject
+		json.NewDecoder(r.Body).Decode(&obj)
+		f.puts++
+		if f.conflicts > 0 {
+			f.conflicts--
+			f.setConfigs(append(f.configsLocked(), Config{HostName: fmt.Sprintf("other%d.local", f.puts)})...)
+		}
+		if obj.Metadata.ResourceVersion != f.configMap.Metadata.ResourceVersion {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"code":409,"reason":"Conflict","message":"the object has been modified"}`)
+			return
+		}
+		f.version++
+		obj.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		f.configMap = &obj
+		json.NewEncoder(w).Encode(obj)
+	default:
+		f.mu.Unlock()
+		http.NotFound(w, r)
+	}
+}
+
+// configsLocked 返回 ConfigMap 中的配置，调用方持有锁
+func (f *fakeKubernetes) configsLocked() []Config {
+	var configs []Config
+	json.Unmarshal([]byte(f.configMap.Data[defaultConfigMapKey]), &configs)
+	return configs
+}
+
+func TestKubernetesConfigMapStore(t *testing.T) {
+	fake, server := newFakeKubernetes(t)
+	fake.setConfigs(Config{HostName: "registry.local", RemoteURL: "https://registry.local"})
+
+	dir := t.TempDir()
+	store, err := NewKubernetesConfigStore(KubernetesConfig{
+		APIServer: server.URL + "/",
+		TokenFile: filepath.Join(dir, "token"),
+		CACert:    filepath.Join(dir, "ca.crt"),
+		Namespace: "default",
+		ConfigMap: "registries",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	changes := make(chan string, 10)
+	store.OnChange(func(hostName string) { changes <- hostName })
+
+	if cfg, ok, _ := store.Get("registry.local"); !ok || cfg.RemoteURL != "https://registry.local" {
+		t.Fatalf("Expected initial config, got %+v %v", cfg, ok)
+	}
+
+	// 写入时其他副本修改了 ConfigMap，重新读取后写回，不会覆盖对方的修改
+	fake.mu.Lock()
+	fake.conflicts = 1
+	fake.mu.Unlock()
+	if err := store.Add(Config{HostName: "mirror.local", RemoteURL: "https://mirror.local"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fake.hostNames(), ","); got != "mirror.local,other1.local,registry.local" {
+		t.Fatalf("Unexpected configmap content %s", got)
+	}
+	fake.mu.Lock()
+	puts := fake.puts
+	fake.mu.Unlock()
+	if puts != 2 {
+		t.Fatalf("Expected 1 retry after conflict, got %d puts", puts)
+	}
+	if _, ok, _ := store.Get("mirror.local"); !ok {
+		t.Fatal("Expected added config in the local copy")
+	}
+
+	// 冲突次数超过上限时返回错误，本地副本不变
+	fake.mu.Lock()
+	fake.conflicts = conflictRetries + 1
+	fake.mu.Unlock()
+	if err := store.Add(Config{HostName: "failed.local", RemoteURL: "https://failed.local"}); err == nil || !strings.Contains(err.Error(), "409") {
+		t.Fatalf("Expected conflict error, got %v", err)
+	}
+	if _, ok, _ := store.Get("failed.local"); ok {
+		t.Fatal("Expected failed Add not to change the local copy")
+	}
+
+	// watch 收到 ConfigMap 的修改后替换全部配置
+	fake.mu.Lock()
+	fake.setConfigs(Config{HostName: "watched.local", RemoteURL: "https://watched.local"})
+	object, _ := json.Marshal(fake.configMap)
+	fake.mu.Unlock()
+	fake.events <- kubeWatchEvent{Type: "MODIFIED", Object: object}
+	waitChange(t, changes, "watched.local")
+	if _, ok, _ := store.Get("registry.local"); ok {
+		t.Fatal("Expected config removed from the configmap to be removed")
+	}
+	if starts := fake.watchStarts(); len(starts) != 1 || starts[0] != "2" {
+		t.Fatalf("Expected watch to start from the listed version, got %v", starts)
+	}
+
+	// resourceVersion 过期时重新列出，并从新的版本继续 watch
+	fake.mu.Lock()
+	fake.setConfigs(Config{HostName: "relisted.local", RemoteURL: "https://relisted.local"})
+	version := fake.configMap.Metadata.ResourceVersion
+	fake.mu.Unlock()
+	fake.events <- kubeWatchEvent{Type: "ERROR", Object: json.RawMessage(`{"code":410,"reason":"Expired","message":"too old resource version"}`)}
+	waitChange(t, changes, "relisted.local")
+	if _, ok, _ := store.Get("watched.local"); ok {
+		t.Fatal("Expected relist to replace the local copy")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fake.watchStarts()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if starts := fake.watchStarts(); len(starts) != 2 || starts[1] != version {
+		t.Fatalf("Expected watch to restart from %s, got %v", version, starts)
+	}
+}
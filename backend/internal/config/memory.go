@@ -1,7 +1,10 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"strings"
 	"sync"
 )
 
@@ -52,19 +55,19 @@ func (s *MemoryConfigStore) List() ([]Config, error) {
 
 	var configs []Config
 	for _, config := range s.configs {
-		// 创建副本，不包含敏感信息
-		safeConfig := Config{
-			HostName:  config.HostName,
-			RemoteURL: config.RemoteURL,
-		}
-		configs = append(configs, safeConfig)
+		configs = append(configs, config.Redacted())
 	}
 
 	return configs, nil
 }
 
-// Add 添加或更新配置
+// Add 添加或更新配置，配置了凭据加密密钥时用户名和密码加密保存
 func (s *MemoryConfigStore) Add(config Config) error {
+	config, err := sealCredentials(config)
+	if err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -90,8 +93,62 @@ func (s *MemoryConfigStore) Close() error {
 	return nil
 }
 
+// snapshot 返回全部配置的副本 (包含凭据)
+func (s *MemoryConfigStore) snapshot() map[string]Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	configs := make(map[string]Config, len(s.configs))
+	for hostName, cfg := range s.configs {
+		configs[hostName] = cfg
+	}
+	return configs
+}
+
+// replace 用 configs 替换全部配置，返回新增、修改和删除的主机名
+func (s *MemoryConfigStore) replace(configs map[string]Config) []string {
+	s.mu.Lock()
+	previous := s.configs
+	s.configs = configs
+	s.mu.Unlock()
+
+	var changed []string
+	for hostName := range previous {
+		if _, ok := configs[hostName]; !ok {
+			changed = append(changed, hostName)
+		}
+	}
+	for hostName, cfg := range configs {
+		if old, ok := previous[hostName]; !ok || !configEqual(old, cfg) {
+			changed = append(changed, hostName)
+		}
+	}
+	return changed
+}
+
+// configEqual 比较两个配置是否相同
+func configEqual(a, b Config) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+// StoreOptions 创建配置存储的选项，只有对应类型的设置生效
+type StoreOptions struct {
+	// Etcd etcd 类型的连接设置，Endpoints 为空时使用 configPath 中逗号分隔的地址
+	Etcd EtcdConfig
+	// Kubernetes kubernetes 类型的设置，configPath 为 configmap/<名称> 时使用该 ConfigMap，为空时使用 RegistryProxy 自定义资源
+	Kubernetes KubernetesConfig
+	// WatchFile file 类型监听配置文件，文件被修改后自动重新加载
+	WatchFile bool
+}
+
 // CreateConfigStore 创建配置存储
 func CreateConfigStore(configType, configPath string) (ConfigStore, error) {
+	return CreateConfigStoreWithOptions(configType, configPath, StoreOptions{})
+}
+
+// CreateConfigStoreWithOptions 使用选项创建配置存储
+func CreateConfigStoreWithOptions(configType, configPath string, opts StoreOptions) (ConfigStore, error) {
 	switch configType {
 	case "memory":
 		return NewMemoryConfigStore(), nil
@@ -99,7 +156,28 @@ func CreateConfigStore(configType, configPath string) (ConfigStore, error) {
 		if configPath == "" {
 			return nil, errors.New("file path is required for file config store")
 		}
-		return NewFileConfigStore(configPath)
+		store, err := NewFileConfigStore(configPath)
+		if err != nil {
+			return nil, err
+		}
+		if opts.WatchFile {
+			if err := store.Watch(); err != nil {
+				return nil, err
+			}
+		}
+		return store, nil
+	case "etcd":
+		if len(opts.Etcd.Endpoints) == 0 && configPath != "" {
+			opts.Etcd.Endpoints = strings.Split(configPath, ",")
+		}
+		return NewEtcdConfigStore(opts.Etcd)
+	case "kubernetes":
+		if name, ok := strings.CutPrefix(configPath, "configmap/"); ok && opts.Kubernetes.ConfigMap == "" {
+			opts.Kubernetes.ConfigMap = name
+		} else if configPath != "" && !ok {
+			return nil, errors.New("kubernetes config path must be configmap/<name> or empty for custom resources")
+		}
+		return NewKubernetesConfigStore(opts.Kubernetes)
 	default:
 		return nil, errors.New("unsupported config store type")
 	}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// CredentialKeyEnv 保存凭据加密密钥的环境变量，优先于密钥文件
+	CredentialKeyEnv = "CONTAINER_UI_CREDENTIAL_KEY"
+
+	// sealedPrefix 加密保存的凭据的前缀，之后是 base64 编码的 nonce 和 AES-256-GCM 密文
+	sealedPrefix = "enc:v1:"
+	// filePrefix 从文件读取的凭据的前缀，例如 file:/run/secrets/registry-password
+	filePrefix = "file:"
+)
+
+// errCredentialKeyRequired 凭据已加密但没有配置密钥
+var errCredentialKeyRequired = errors.New("credentials are encrypted, credential key is required")
+
+// credentialKey 加密仓库凭据的密钥，为 nil 时凭据按原样保存
+var credentialKey struct {
+	mu   sync.RWMutex
+	aead cipher.AEAD
+}
+
+// SetCredentialKey 设置加密仓库凭据的 32 字节密钥，之后添加的配置中的用户名和密码加密保存；key 为空时不再加密
+func SetCredentialKey(key []byte) error {
+	var aead cipher.AEAD
+	if len(key) > 0 {
+		if len(key) != 32 {
+			return errors.New("credential key must be 32 bytes")
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		if aead, err = cipher.NewGCM(block); err != nil {
+			return err
+		}
+	}
+	credentialKey.mu.Lock()
+	defer credentialKey.mu.Unlock()
+	credentialKey.aead = aead
+	return nil
+}
+
+// LoadCredentialKey 从 CONTAINER_UI_CREDENTIAL_KEY 或密钥文件加载凭据加密密钥，两者都为空时不加密。
+// 密钥为 32 字节，可以是原始字节、十六进制或 base64 编码，例如 openssl rand -base64 32 生成的密钥
+func LoadCredentialKey(keyFile string) error {
+	data := []byte(os.Getenv(CredentialKeyEnv))
+	if len(data) == 0 && keyFile != "" {
+		var err error
+		if data, err = os.ReadFile(keyFile); err != nil {
+			return fmt.Errorf("failed to read credential key: %v", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	key, err := parseCredentialKey(data)
+	if err != nil {
+		return err
+	}
+	return SetCredentialKey(key)
+}
+
+// parseCredentialKey 解析原始、十六进制或 base64 编码的 32 字节密钥
+func parseCredentialKey(data []byte) ([]byte, error) {
+	if len(data) == 32 {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, errors.New("credential key must be 32 bytes, hex or base64 encoded")
+}
+
+// isSecretReference 判断凭据是否引用环境变量 (${NAME}) 或文件 (file:/path)，引用本身不是机密，按原样保存
+func isSecretReference(value string) bool {
+	return strings.HasPrefix(value, filePrefix) || (strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}"))
+}
+
+// RejectSecretReferences 拒绝引用环境变量或文件的用户名和密码，返回 *ValidationError。
+// 引用读取的是代理所在主机的环境变量和文件，只接受配置文件等运维人员控制的来源，管理 API 提交的配置需要先调用该方法；
+// 与 previous 中相同的值视为未修改，更新配置时可以保留配置文件中原有的引用
+func (c *Config) RejectSecretReferences(previous Config) error {
+	v := &ValidationError{HostName: c.HostName}
+	if isSecretReference(c.Username) && c.Username != previous.Username {
+		v.Add("username", "", "environment and file references are only accepted in the config file")
+	}
+	if isSecretReference(c.Password) && c.Password != previous.Password {
+		v.Add("password", "", "environment and file references are only accepted in the config file")
+	}
+	if len(v.Errors) == 0 {
+		return nil
+	}
+	return v
+}
+
+// sealSecret 加密凭据，未配置密钥、值为空、已加密或为引用时原样返回
+func sealSecret(value string) (string, error) {
+	credentialKey.mu.RLock()
+	aead := credentialKey.aead
+	credentialKey.mu.RUnlock()
+	if aead == nil || value == "" || strings.HasPrefix(value, sealedPrefix) || isSecretReference(value) {
+		return value, nil
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return sealedPrefix + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(value), nil)), nil
+}
+
+// resolveSecret 返回凭据的明文：解密加密的值，读取引用的环境变量或文件，其他值原样返回
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, sealedPrefix):
+		credentialKey.mu.RLock()
+		aead := credentialKey.aead
+		credentialKey.mu.RUnlock()
+		if aead == nil {
+			return "", errCredentialKeyRequired
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+		if err != nil || len(data) < aead.NonceSize() {
+			return "", errors.New("invalid encrypted credential")
+		}
+		plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+		if err != nil {
+			return "", errors.New("failed to decrypt credential: wrong credential key")
+		}
+		return string(plain), nil
+	case strings.HasPrefix(value, filePrefix):
+		data, err := os.ReadFile(strings.TrimPrefix(value, filePrefix))
+		if err != nil {
+			return "", fmt.Errorf("failed to read credential file: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}"):
+		name := value[2 : len(value)-1]
+		if name == CredentialKeyEnv {
+			return "", fmt.Errorf("%s cannot be used as a credential", CredentialKeyEnv)
+		}
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("credential environment variable %s is not set", name)
+		}
+		return secret, nil
+	}
+	return value, nil
+}
+
+// sealCredentials 返回用户名和密码加密后的副本，保存配置前调用
+func sealCredentials(c Config) (Config, error) {
+	var err error
+	if c.Username, err = sealSecret(c.Username); err != nil {
+		return c, err
+	}
+	if c.Password, err = sealSecret(c.Password); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// isPlaintextSecret 判断配置了密钥时凭据是否仍以明文保存
+func isPlaintextSecret(value string) bool {
+	credentialKey.mu.RLock()
+	aead := credentialKey.aead
+	credentialKey.mu.RUnlock()
+	return aead != nil && value != "" && !strings.HasPrefix(value, sealedPrefix) && !isSecretReference(value)
+}
+
+// hasPlaintextCredentials 判断配置了密钥时用户名或密码是否仍以明文保存
+func hasPlaintextCredentials(c Config) bool {
+	return isPlaintextSecret(c.Username) || isPlaintextSecret(c.Password)
+}
+
+// migrateCredentials 配置密钥之前保存的明文凭据在加载后通过 add 加密并重新写入，失败时记录日志并保留明文
+func migrateCredentials(configs map[string]Config, add func(Config) error) {
+	hostNames := make([]string, 0, len(configs))
+	for hostName, cfg := range configs {
+		if hasPlaintextCredentials(cfg) {
+			hostNames = append(hostNames, hostName)
+		}
+	}
+	sort.Strings(hostNames)
+	for _, hostName := range hostNames {
+		if err := add(configs[hostName]); err != nil {
+			log.Printf("Failed to encrypt plaintext credentials of %s: %v", hostName, err)
+			continue
+		}
+		log.Printf("Encrypted plaintext credentials of %s", hostName)
+	}
+}
+
+// Credentials 返回连接 RemoteURL 使用的用户名和密码。配置中的值可以是明文、加密保存的值、
+// 环境变量引用 ${NAME} 或文件引用 file:/path，引用在每次调用时读取，轮换后不需要修改配置
+func (c *Config) Credentials() (string, string, error) {
+	username, err := resolveSecret(c.Username)
+	if err != nil {
+		return "", "", fmt.Errorf("username of %s: %v", c.HostName, err)
+	}
+	password, err := resolveSecret(c.Password)
+	if err != nil {
+		return "", "", fmt.Errorf("password of %s: %v", c.HostName, err)
+	}
+	return username, password, nil
+}
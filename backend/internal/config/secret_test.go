@@ -0,0 +1,245 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testCredentialKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSealAndResolveSecret(t *testing.T) {
+	if err := SetCredentialKey(testCredentialKey); err != nil {
+		t.Fatal(err)
+	}
+	defer SetCredentialKey(nil)
+
+	sealed, err := sealSecret("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, sealedPrefix) || strings.Contains(sealed, "secret") {
+		t.Fatalf("Expected sealed value, got %q", sealed)
+	}
+	if again, _ := sealSecret("secret"); again == sealed {
+		t.Fatal("Expected a fresh nonce for every seal")
+	}
+	if again, _ := sealSecret(sealed); again != sealed {
+		t.Fatal("Expected sealed value to be kept as is")
+	}
+	for _, value := range []string{"", "${REGISTRY_PASSWORD}", "file:/run/secrets/password"} {
+		if got, _ := sealSecret(value); got != value {
+			t.Fatalf("Expected %q not to be sealed, got %q", value, got)
+		}
+	}
+	if plain, err := resolveSecret(sealed); err != nil || plain != "secret" {
+		t.Fatalf("Expected secret, got %q %v", plain, err)
+	}
+
+	// 密文被修改或使用其他密钥时解密失败
+	if _, err := resolveSecret(sealedPrefix + "not base64"); err == nil {
+		t.Fatal("Expected invalid encrypted credential to fail")
+	}
+	if err := SetCredentialKey([]byte("fedcba9876543210fedcba9876543210")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveSecret(sealed); err == nil || !strings.Contains(err.Error(), "wrong credential key") {
+		t.Fatalf("Expected wrong key error, got %v", err)
+	}
+	SetCredentialKey(nil)
+	if _, err := resolveSecret(sealed); !errors.Is(err, errCredentialKeyRequired) {
+		t.Fatalf("Expected key required error, got %v", err)
+	}
+	if got, _ := sealSecret("secret"); got != "secret" {
+		t.Fatalf("Expected plaintext without key, got %q", got)
+	}
+
+	if err := SetCredentialKey([]byte("short")); err == nil {
+		t.Fatal("Expected short key to be rejected")
+	}
+}
+
+func TestResolveSecretReferences(t *testing.T) {
+	t.Setenv("TEST_REGISTRY_PASSWORD", "from-env")
+	t.Setenv(CredentialKeyEnv, base64.StdEncoding.EncodeToString(testCredentialKey))
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "plain", want: "plain"},
+		{value: "${TEST_REGISTRY_PASSWORD}", want: "from-env"},
+		{value: "${TEST_REGISTRY_MISSING}", wantErr: true},
+		{value: "${" + CredentialKeyEnv + "}", wantErr: true},
+		{value: "file:" + file, want: "from-file"},
+		{value: "file:" + file + ".missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := resolveSecret(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveSecret(%q) = %q, %v", tt.value, got, err)
+		}
+	}
+
+	cfg := Config{HostName: "registry.local", Username: "alice", Password: "${TEST_REGISTRY_PASSWORD}"}
+	if username, password, err := cfg.Credentials(); err != nil || username != "alice" || password != "from-env" {
+		t.Fatalf("Unexpected credentials %q %q %v", username, password, err)
+	}
+	cfg.Password = "${TEST_REGISTRY_MISSING}"
+	if _, _, err := cfg.Credentials(); err == nil || !strings.Contains(err.Error(), "password of registry.local") {
+		t.Fatalf("Expected password error, got %v", err)
+	}
+}
+
+func TestLoadCredentialKey(t *testing.T) {
+	defer SetCredentialKey(nil)
+
+	for _, encoded := range []string{string(testCredentialKey), hex.EncodeToString(testCredentialKey), base64.StdEncoding.EncodeToString(testCredentialKey) + "\n"} {
+		if key, err := parseCredentialKey([]byte(encoded)); err != nil || string(key) != string(testCredentialKey) {
+			t.Fatalf("Failed to parse key %q: %v", encoded, err)
+		}
+	}
+	if _, err := parseCredentialKey([]byte("too short")); err == nil {
+		t.Fatal("Expected invalid key to be rejected")
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(testCredentialKey)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(CredentialKeyEnv, "")
+	if err := LoadCredentialKey(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if sealed, _ := sealSecret("secret"); !strings.HasPrefix(sealed, sealedPrefix) {
+		t.Fatal("Expected key file to enable encryption")
+	}
+
+	// 环境变量优先于密钥文件
+	t.Setenv(CredentialKeyEnv, "invalid")
+	if err := LoadCredentialKey(keyFile); err == nil {
+		t.Fatal("Expected invalid key in environment to be rejected")
+	}
+}
+
+func TestRejectSecretReferences(t *testing.T) {
+	cfg := Config{HostName: "registry.local", Username: "alice", Password: "file:/etc/shadow"}
+	var verr *ValidationError
+	if err := cfg.RejectSecretReferences(Config{}); !errors.As(err, &verr) || len(verr.Errors) != 1 || verr.Errors[0].Field != "password" {
+		t.Fatalf("Expected password reference to be rejected, got %v", err)
+	}
+	cfg.Username = "${" + CredentialKeyEnv + "}"
+	if err := cfg.RejectSecretReferences(Config{}); !errors.As(err, &verr) || len(verr.Errors) != 2 {
+		t.Fatalf("Expected both references to be rejected, got %v", err)
+	}
+
+	// 原样提交已保存的引用视为未修改
+	if err := cfg.RejectSecretReferences(cfg); err != nil {
+		t.Fatalf("Expected unchanged references to be kept, got %v", err)
+	}
+	if err := (&Config{HostName: "registry.local", Username: "alice", Password: "secret"}).RejectSecretReferences(Config{}); err != nil {
+		t.Fatalf("Expected plaintext credentials to be accepted, got %v", err)
+	}
+}
+
+func TestFileConfigStoreMigratesPlaintextCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registries.json")
+	data, _ := json.Marshal([]Config{
+		{HostName: "registry.local", RemoteURL: "https://registry.local", Username: "alice", Password: "secret"},
+		{HostName: "mirror.local", RemoteURL: "https://mirror.local", Username: "bob", Password: "${TEST_MIRROR_PASSWORD}"},
+	})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有密钥时保持明文
+	store, err := NewFileConfigStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _, _ := store.Get("registry.local"); cfg.Password != "secret" {
+		t.Fatalf("Expected plaintext without key, got %q", cfg.Password)
+	}
+
+	if err := SetCredentialKey(testCredentialKey); err != nil {
+		t.Fatal(err)
+	}
+	defer SetCredentialKey(nil)
+	if store, err = NewFileConfigStore(path); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := ReadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range configs {
+		switch cfg.HostName {
+		case "registry.local":
+			if !strings.HasPrefix(cfg.Username, sealedPrefix) || !strings.HasPrefix(cfg.Password, sealedPrefix) {
+				t.Fatalf("Expected credentials to be encrypted in the file, got %q %q", cfg.Username, cfg.Password)
+			}
+		case "mirror.local":
+			if cfg.Password != "${TEST_MIRROR_PASSWORD}" {
+				t.Fatalf("Expected reference to be kept, got %q", cfg.Password)
+			}
+		}
+	}
+	cfg, _, _ := store.Get("registry.local")
+	if username, password, err := cfg.Credentials(); err != nil || username != "alice" || password != "secret" {
+		t.Fatalf("Unexpected credentials %q %q %v", username, password, err)
+	}
+
+	// 重新加载加密后的文件没有变化
+	if changed, err := store.Reload(); err != nil || len(changed) != 0 {
+		t.Fatalf("Expected no changes after migration, got %v %v", changed, err)
+	}
+
+	// 文件中新加入的明文凭据在重新加载时加密，未修改的配置沿用原来的密文
+	configs = append(configs, Config{HostName: "new.local", RemoteURL: "https://new.local", Username: "carol", Password: "other"})
+	data, _ = json.Marshal(configs)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := store.Reload(); err != nil || len(changed) != 1 || changed[0] != "new.local" {
+		t.Fatalf("Expected only new.local to change, got %v %v", changed, err)
+	}
+	if cfg, _, _ := store.Get("new.local"); !strings.HasPrefix(cfg.Password, sealedPrefix) {
+		t.Fatalf("Expected new credentials to be encrypted, got %q", cfg.Password)
+	}
+}
+
+func TestMigrateCredentials(t *testing.T) {
+	store := NewMemoryConfigStore()
+	store.Add(Config{HostName: "registry.local", Username: "alice", Password: "secret"})
+
+	if err := SetCredentialKey(testCredentialKey); err != nil {
+		t.Fatal(err)
+	}
+	defer SetCredentialKey(nil)
+
+	failing := func(Config) error { return errors.New("read only") }
+	migrateCredentials(store.snapshot(), failing)
+	if cfg, _, _ := store.Get("registry.local"); cfg.Password != "secret" {
+		t.Fatal("Expected failed migration to keep the stored value")
+	}
+
+	migrateCredentials(store.snapshot(), store.Add)
+	cfg, _, _ := store.Get("registry.local")
+	if !strings.HasPrefix(cfg.Password, sealedPrefix) {
+		t.Fatalf("Expected credentials to be encrypted, got %q", cfg.Password)
+	}
+	if _, password, _ := cfg.Credentials(); password != "secret" {
+		t.Fatalf("Expected migrated password to resolve, got %q", password)
+	}
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ServerConfig cmd/server 的启动配置
+// 优先级从低到高：默认值、配置文件、环境变量、命令行参数
+type ServerConfig struct {
+	// Listen 监听地址，例如 :8080 或 127.0.0.1:8080
+	Listen string     `yaml:"listen"`
+	TLS    TLSConfig  `yaml:"tls"`
+	CORS   CORSConfig `yaml:"cors"`
+	// StaticDir 前端静态文件目录，包含 index.html 和 assets
+	StaticDir string `yaml:"staticDir"`
+	// TrustedProxies 受信任的反向代理 IP 或 CIDR，只有来自这些地址的 X-Forwarded-For 才会被采用
+	TrustedProxies []string        `yaml:"trustedProxies"`
+	RateLimit      RateLimitConfig `yaml:"rateLimit"`
+	Limits         LimitsConfig    `yaml:"limits"`
+	Timeouts       TimeoutsConfig  `yaml:"timeouts"`
+}
+
+// TimeoutsConfig HTTP 服务器超时配置，使用 Go duration 格式，例如 30s、2m
+type TimeoutsConfig struct {
+	// ReadHeader 读取请求头的超时时间，防止慢速连接占用服务器
+	ReadHeader time.Duration `yaml:"readHeader"`
+	// Idle keep-alive 空闲连接的超时时间
+	Idle time.Duration `yaml:"idle"`
+	// ShutdownGrace 关闭服务时等待正在处理的请求完成的最长时间
+	ShutdownGrace time.Duration `yaml:"shutdownGrace"`
+}
+
+// RateLimitConfig API 限流配置
+type RateLimitConfig struct {
+	// PerIP 按客户端 IP 限流，在认证之前生效
+	PerIP RateConfig `yaml:"perIP"`
+	// PerToken 按登录用户或访问令牌限流，在认证之后生效
+	PerToken RateConfig `yaml:"perToken"`
+}
+
+// RateConfig 令牌桶参数，Rate 为 0 时不限流
+type RateConfig struct {
+	// Rate 每秒允许的请求数
+	Rate float64 `yaml:"rate"`
+	// Burst 允许的突发请求数
+	Burst int `yaml:"burst"`
+}
+
+// LimitsConfig 请求体大小限制，单位为字节，0 表示不限制
+type LimitsConfig struct {
+	// MaxBodySize 普通 API 请求的请求体上限
+	MaxBodySize int64 `yaml:"maxBodySize"`
+	// MaxUploadSize 镜像导入、数据卷恢复等上传请求的请求体上限
+	MaxUploadSize int64 `yaml:"maxUploadSize"`
+}
+
+// TLSConfig HTTPS 证书配置，两者都为空时使用 HTTP
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// CORSConfig 跨域配置
+type CORSConfig struct {
+	// AllowedOrigins 允许的来源，"*" 表示允许所有来源
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+}
+
+// 环境变量名称，列表类型使用逗号分隔
+const (
+	EnvServerListen         = "CONTAINER_UI_LISTEN"
+	EnvServerTLSCert        = "CONTAINER_UI_TLS_CERT"
+	EnvServerTLSKey         = "CONTAINER_UI_TLS_KEY"
+	EnvServerCORSOrigins    = "CONTAINER_UI_CORS_ORIGINS"
+	EnvServerStaticDir      = "CONTAINER_UI_STATIC_DIR"
+	EnvServerTrustedProxies = "CONTAINER_UI_TRUSTED_PROXIES"
+	EnvServerRateLimitIP    = "CONTAINER_UI_RATE_LIMIT_PER_IP"
+	EnvServerRateLimitToken = "CONTAINER_UI_RATE_LIMIT_PER_TOKEN"
+	EnvServerMaxBodySize    = "CONTAINER_UI_MAX_BODY_SIZE"
+	EnvServerMaxUploadSize  = "CONTAINER_UI_MAX_UPLOAD_SIZE"
+	EnvServerReadHeader     = "CONTAINER_UI_READ_HEADER_TIMEOUT"
+	EnvServerIdle           = "CONTAINER_UI_IDLE_TIMEOUT"
+	EnvServerShutdownGrace  = "CONTAINER_UI_SHUTDOWN_GRACE_PERIOD"
+)
+
+// DefaultServerConfig 返回默认配置，与开发环境的前端地址保持一致
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Listen:    ":8080",
+		CORS:      CORSConfig{AllowedOrigins: []string{"http://localhost:5173"}},
+		StaticDir: "./dist",
+		RateLimit: RateLimitConfig{
+			PerIP:    RateConfig{Rate: 50, Burst: 100},
+			PerToken: RateConfig{Rate: 20, Burst: 40},
+		},
+		Limits: LimitsConfig{MaxBodySize: 1 << 20},
+		Timeouts: TimeoutsConfig{
+			ReadHeader:    10 * time.Second,
+			Idle:          2 * time.Minute,
+			ShutdownGrace: 30 * time.Second,
+		},
+	}
+}
+
+// LoadServerConfig 在默认值的基础上依次加载配置文件和环境变量，path 为空时跳过配置文件
+func LoadServerConfig(path string) (ServerConfig, error) {
+	config := DefaultServerConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("failed to read server config: %v", err)
+		}
+		// 拒绝未知字段，避免拼写错误的配置被静默忽略
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+			return config, fmt.Errorf("failed to parse server config %s: %v", path, err)
+		}
+	}
+
+	if err := config.applyEnv(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+func (c *ServerConfig) applyEnv() error {
+	if v, ok := os.LookupEnv(EnvServerListen); ok {
+		c.Listen = v
+	}
+	if v, ok := os.LookupEnv(EnvServerTLSCert); ok {
+		c.TLS.CertFile = v
+	}
+	if v, ok := os.LookupEnv(EnvServerTLSKey); ok {
+		c.TLS.KeyFile = v
+	}
+	if v, ok := os.LookupEnv(EnvServerCORSOrigins); ok {
+		c.CORS.AllowedOrigins = SplitList(v)
+	}
+	if v, ok := os.LookupEnv(EnvServerStaticDir); ok {
+		c.StaticDir = v
+	}
+	if v, ok := os.LookupEnv(EnvServerTrustedProxies); ok {
+		c.TrustedProxies = SplitList(v)
+	}
+
+	var err error
+	if v, ok := os.LookupEnv(EnvServerRateLimitIP); ok {
+		if c.RateLimit.PerIP, err = ParseRate(v); err != nil {
+			return fmt.Errorf("invalid %s: %v", EnvServerRateLimitIP, err)
+		}
+	}
+	if v, ok := os.LookupEnv(EnvServerRateLimitToken); ok {
+		if c.RateLimit.PerToken, err = ParseRate(v); err != nil {
+			return fmt.Errorf("invalid %s: %v", EnvServerRateLimitToken, err)
+		}
+	}
+	if v, ok := os.LookupEnv(EnvServerMaxBodySize); ok {
+		if c.Limits.MaxBodySize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("invalid %s: %v", EnvServerMaxBodySize, err)
+		}
+	}
+	if v, ok := os.LookupEnv(EnvServerMaxUploadSize); ok {
+		if c.Limits.MaxUploadSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("invalid %s: %v", EnvServerMaxUploadSize, err)
+		}
+	}
+	for name, target := range map[string]*time.Duration{
+		EnvServerReadHeader:    &c.Timeouts.ReadHeader,
+		EnvServerIdle:          &c.Timeouts.Idle,
+		EnvServerShutdownGrace: &c.Timeouts.ShutdownGrace,
+	} {
+		if v, ok := os.LookupEnv(name); ok {
+			if *target, err = time.ParseDuration(v); err != nil {
+				return fmt.Errorf("invalid %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseRate 解析 "rate[:burst]" 格式的限流参数，例如 50:100
+func ParseRate(s string) (RateConfig, error) {
+	var rate RateConfig
+	rateStr, burstStr, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+	var err error
+	if rate.Rate, err = strconv.ParseFloat(rateStr, 64); err != nil {
+		return rate, fmt.Errorf("invalid rate %q", s)
+	}
+	if hasBurst {
+		if rate.Burst, err = strconv.Atoi(burstStr); err != nil {
+			return rate, fmt.Errorf("invalid burst %q", s)
+		}
+	}
+	return rate, nil
+}
+
+// SplitList 解析逗号分隔的列表，忽略空项
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// TLSEnabled 是否启用 HTTPS
+func (c *ServerConfig) TLSEnabled() bool {
+	return c.TLS.CertFile != "" || c.TLS.KeyFile != ""
+}
+
+// AllowAllOrigins 是否允许所有来源跨域访问
+func (c *ServerConfig) AllowAllOrigins() bool {
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 校验配置
+func (c *ServerConfig) Validate() error {
+	if _, port, err := net.SplitHostPort(c.Listen); err != nil || port == "" {
+		return fmt.Errorf("invalid listen address %q", c.Listen)
+	}
+
+	if c.TLSEnabled() {
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			return errors.New("both tls cert file and key file are required")
+		}
+		for _, file := range []string{c.TLS.CertFile, c.TLS.KeyFile} {
+			if _, err := os.Stat(file); err != nil {
+				return fmt.Errorf("invalid tls config: %v", err)
+			}
+		}
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("invalid cors origin %q, expected scheme://host[:port]", origin)
+		}
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			return fmt.Errorf("invalid trusted proxy %q, expected IP or CIDR", proxy)
+		}
+	}
+
+	for name, rate := range map[string]RateConfig{"perIP": c.RateLimit.PerIP, "perToken": c.RateLimit.PerToken} {
+		if rate.Rate < 0 || rate.Burst < 0 {
+			return fmt.Errorf("invalid rate limit %s: rate and burst must not be negative", name)
+		}
+	}
+	if c.Limits.MaxBodySize < 0 || c.Limits.MaxUploadSize < 0 {
+		return errors.New("body size limits must not be negative")
+	}
+	if c.Timeouts.ReadHeader < 0 || c.Timeouts.Idle < 0 || c.Timeouts.ShutdownGrace < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+
+	if c.StaticDir == "" {
+		return errors.New("static dir is required")
+	}
+	return nil
+}
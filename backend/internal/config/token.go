@@ -0,0 +1,252 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// APIToken 个人访问令牌，只保存令牌密钥的哈希
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Username   string     `json:"username"`
+	SecretHash string     `json:"secretHash"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// TokenStore 定义访问令牌存储接口
+type TokenStore interface {
+	// Get 获取指定令牌
+	Get(id string) (APIToken, bool, error)
+
+	// List 按创建时间顺序列出所有令牌
+	List() ([]APIToken, error)
+
+	// Put 添加或更新令牌
+	Put(token APIToken) error
+
+	// Remove 删除令牌
+	Remove(id string) (bool, error)
+
+	// Touch 更新令牌的最后使用时间，令牌不存在时不做修改并返回 false，避免与删除并发时重新写入已删除的令牌
+	Touch(id string, t time.Time) (bool, error)
+
+	// Close 关闭存储
+	Close() error
+}
+
+// MemoryTokenStore 内存令牌存储实现
+type MemoryTokenStore struct {
+	tokens map[string]APIToken
+	mu     sync.RWMutex
+}
+
+// NewMemoryTokenStore 创建新的内存令牌存储
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens: make(map[string]APIToken),
+	}
+}
+
+// Get 获取指定令牌
+func (s *MemoryTokenStore) Get(id string) (APIToken, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.tokens[id]
+	return token, ok, nil
+}
+
+// List 按创建时间顺序列出所有令牌
+func (s *MemoryTokenStore) List() ([]APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]APIToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+		}
+		return tokens[i].ID < tokens[j].ID
+	})
+	return tokens, nil
+}
+
+// Put 添加或更新令牌
+func (s *MemoryTokenStore) Put(token APIToken) error {
+	if token.ID == "" {
+		return errors.New("token id is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token.ID] = token
+	return nil
+}
+
+// Remove 删除令牌
+func (s *MemoryTokenStore) Remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tokens[id]; !exists {
+		return false, nil
+	}
+	delete(s.tokens, id)
+	return true, nil
+}
+
+// Touch 更新令牌的最后使用时间
+func (s *MemoryTokenStore) Touch(id string, t time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.tokens[id]
+	if !exists {
+		return false, nil
+	}
+	token.LastUsedAt = &t
+	s.tokens[id] = token
+	return true, nil
+}
+
+// Close 关闭存储
+func (s *MemoryTokenStore) Close() error {
+	return nil
+}
+
+// FileTokenStore 文件令牌存储实现
+type FileTokenStore struct {
+	*MemoryTokenStore
+	filePath string
+	saveMu   sync.Mutex
+}
+
+// NewFileTokenStore 创建新的文件令牌存储
+func NewFileTokenStore(filePath string) (*FileTokenStore, error) {
+	store := &FileTokenStore{
+		MemoryTokenStore: NewMemoryTokenStore(),
+		filePath:         filePath,
+	}
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []APIToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse token file %s: %v", filePath, err)
+	}
+	for _, token := range tokens {
+		store.tokens[token.ID] = token
+	}
+	return store, nil
+}
+
+// saveToFile 将令牌写入文件
+func (s *FileTokenStore) saveToFile() error {
+	tokens, err := s.MemoryTokenStore.List()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(s.filePath, data, 0600)
+}
+
+// Put 添加或更新令牌并保存到文件
+func (s *FileTokenStore) Put(token APIToken) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	old, existed, _ := s.MemoryTokenStore.Get(token.ID)
+	if err := s.MemoryTokenStore.Put(token); err != nil {
+		return err
+	}
+
+	if err := s.saveToFile(); err != nil {
+		s.mu.Lock()
+		if existed {
+			s.tokens[token.ID] = old
+		} else {
+			delete(s.tokens, token.ID)
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Remove 删除令牌并保存到文件
+func (s *FileTokenStore) Remove(id string) (bool, error) {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	old, _, _ := s.MemoryTokenStore.Get(id)
+	removed, err := s.MemoryTokenStore.Remove(id)
+	if err != nil || !removed {
+		return removed, err
+	}
+
+	if err := s.saveToFile(); err != nil {
+		s.mu.Lock()
+		s.tokens[id] = old
+		s.mu.Unlock()
+		return false, err
+	}
+	return true, nil
+}
+
+// Touch 更新令牌的最后使用时间并保存到文件
+func (s *FileTokenStore) Touch(id string, t time.Time) (bool, error) {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	old, _, _ := s.MemoryTokenStore.Get(id)
+	touched, err := s.MemoryTokenStore.Touch(id, t)
+	if err != nil || !touched {
+		return touched, err
+	}
+
+	if err := s.saveToFile(); err != nil {
+		s.mu.Lock()
+		s.tokens[id] = old
+		s.mu.Unlock()
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateTokenStore 创建令牌存储
+func CreateTokenStore(storeType, path string) (TokenStore, error) {
+	switch storeType {
+	case "memory":
+		return NewMemoryTokenStore(), nil
+	case "file":
+		if path == "" {
+			return nil, errors.New("file path is required for file token store")
+		}
+		return NewFileTokenStore(path)
+	default:
+		return nil, errors.New("unsupported token store type")
+	}
+}
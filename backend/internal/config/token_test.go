@@ -0,0 +1,47 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileTokenStoreTouch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(APIToken{ID: "t1", Name: "deploy", Username: "ci", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	used := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if touched, err := store.Touch("t1", used); err != nil || !touched {
+		t.Fatalf("expected token to be touched, got %v %v", touched, err)
+	}
+	reopened, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, _, _ := reopened.Get("t1"); token.LastUsedAt == nil || !token.LastUsedAt.Equal(used) || token.Name != "deploy" {
+		t.Fatalf("expected last used time to be saved, got %+v", token)
+	}
+
+	// 已删除的令牌不会被重新写入
+	if _, err := store.Remove("t1"); err != nil {
+		t.Fatal(err)
+	}
+	if touched, err := store.Touch("t1", used); err != nil || touched {
+		t.Fatalf("expected deleted token not to be touched, got %v %v", touched, err)
+	}
+	if _, ok, _ := store.Get("t1"); ok {
+		t.Fatal("expected deleted token to stay deleted")
+	}
+	if reopened, err = NewFileTokenStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if tokens, _ := reopened.List(); len(tokens) != 0 {
+		t.Fatalf("expected no tokens in the file, got %+v", tokens)
+	}
+}
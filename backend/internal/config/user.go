@@ -0,0 +1,211 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// User 用户，Provider 为空表示本地用户；外部身份提供方的用户没有密码，不能使用密码登录
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"passwordHash,omitempty"`
+	Role         string    `json:"role,omitempty"`
+	Provider     string    `json:"provider,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// UserStore 定义用户存储接口
+type UserStore interface {
+	// Get 获取指定用户
+	Get(username string) (User, bool, error)
+
+	// List 按用户名顺序列出所有用户
+	List() ([]User, error)
+
+	// Put 添加或更新用户
+	Put(user User) error
+
+	// Remove 删除用户
+	Remove(username string) (bool, error)
+
+	// Close 关闭存储
+	Close() error
+}
+
+// MemoryUserStore 内存用户存储实现
+type MemoryUserStore struct {
+	users map[string]User
+	mu    sync.RWMutex
+}
+
+// NewMemoryUserStore 创建新的内存用户存储
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users: make(map[string]User),
+	}
+}
+
+// Get 获取指定用户
+func (s *MemoryUserStore) Get(username string) (User, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	return user, ok, nil
+}
+
+// List 按用户名顺序列出所有用户
+func (s *MemoryUserStore) List() ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+// Put 添加或更新用户
+func (s *MemoryUserStore) Put(user User) error {
+	if user.Username == "" {
+		return errors.New("username is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.Username] = user
+	return nil
+}
+
+// Remove 删除用户
+func (s *MemoryUserStore) Remove(username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[username]; !exists {
+		return false, nil
+	}
+	delete(s.users, username)
+	return true, nil
+}
+
+// Close 关闭存储
+func (s *MemoryUserStore) Close() error {
+	return nil
+}
+
+// FileUserStore 文件用户存储实现
+type FileUserStore struct {
+	*MemoryUserStore
+	filePath string
+	saveMu   sync.Mutex
+}
+
+// NewFileUserStore 创建新的文件用户存储
+func NewFileUserStore(filePath string) (*FileUserStore, error) {
+	store := &FileUserStore{
+		MemoryUserStore: NewMemoryUserStore(),
+		filePath:        filePath,
+	}
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse user file %s: %v", filePath, err)
+	}
+	for _, user := range users {
+		store.users[user.Username] = user
+	}
+	return store, nil
+}
+
+// saveToFile 将用户写入文件
+func (s *FileUserStore) saveToFile() error {
+	users, err := s.MemoryUserStore.List()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 文件中包含密码哈希，仅允许当前用户读取
+	return WriteFileAtomic(s.filePath, data, 0600)
+}
+
+// Put 添加或更新用户并保存到文件
+func (s *FileUserStore) Put(user User) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	old, existed, _ := s.MemoryUserStore.Get(user.Username)
+	if err := s.MemoryUserStore.Put(user); err != nil {
+		return err
+	}
+
+	if err := s.saveToFile(); err != nil {
+		s.mu.Lock()
+		if existed {
+			s.users[user.Username] = old
+		} else {
+			delete(s.users, user.Username)
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Remove 删除用户并保存到文件
+func (s *FileUserStore) Remove(username string) (bool, error) {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	old, _, _ := s.MemoryUserStore.Get(username)
+	removed, err := s.MemoryUserStore.Remove(username)
+	if err != nil || !removed {
+		return removed, err
+	}
+
+	if err := s.saveToFile(); err != nil {
+		s.mu.Lock()
+		s.users[username] = old
+		s.mu.Unlock()
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateUserStore 创建用户存储
+func CreateUserStore(storeType, path string) (UserStore, error) {
+	switch storeType {
+	case "memory":
+		return NewMemoryUserStore(), nil
+	case "file":
+		if path == "" {
+			return nil, errors.New("file path is required for file user store")
+		}
+		return NewFileUserStore(path)
+	default:
+		return nil, errors.New("unsupported user store type")
+	}
+}
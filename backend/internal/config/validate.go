@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// FieldError 配置中某个字段的错误，Field 为 JSON 字段名，数组元素带下标，例如 mirrors[1]
+type FieldError struct {
+	Field   string `json:"field"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) String() string {
+	if e.Value == "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	return fmt.Sprintf("%s %q: %s", e.Field, e.Value, e.Message)
+}
+
+// ValidationError 仓库配置校验失败，包含全部有问题的字段
+type ValidationError struct {
+	HostName string       `json:"hostName"`
+	Errors   []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fieldErr.String()
+	}
+	return fmt.Sprintf("invalid registry config %q: %s", e.HostName, strings.Join(messages, "; "))
+}
+
+// Add 记录字段错误
+func (e *ValidationError) Add(field, value, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Value: value, Message: message})
+}
+
+// Validate 校验主机名规则、上游地址、凭据和 DNSNames，返回的错误为 *ValidationError，列出全部有问题的字段。
+// 改写规则和 TLS 设置在创建代理处理器时校验
+func (c *Config) Validate() error {
+	v := &ValidationError{HostName: c.HostName}
+
+	if msg := checkHostPattern(c.HostName); msg != "" {
+		v.Add("hostName", c.HostName, msg)
+	}
+
+	if c.RemoteURL == "" {
+		v.Add("remoteUrl", "", "is required")
+	} else if msg := checkUpstreamURL(c.RemoteURL); msg != "" {
+		v.Add("remoteUrl", redactURL(c.RemoteURL), msg)
+	}
+	for i, mirror := range c.Mirrors {
+		if msg := checkUpstreamURL(mirror); msg != "" {
+			v.Add(fmt.Sprintf("mirrors[%d]", i), redactURL(mirror), msg)
+		}
+	}
+
+	switch {
+	case c.Username != "" && c.Password == "":
+		v.Add("password", "", "is required when username is set")
+	case c.Username == "" && c.Password != "":
+		v.Add("username", "", "is required when password is set")
+	}
+
+	if c.DNSNames != nil && len(c.DNSNames) == 0 {
+		v.Add("dnsNames", "", "must not be empty, omit it to use hostName")
+	}
+	for i, name := range c.DNSNames {
+		if msg := checkDNSName(name); msg != "" {
+			v.Add(fmt.Sprintf("dnsNames[%d]", i), name, msg)
+		}
+	}
+
+	if c.MaxConnections < 0 {
+		v.Add("maxConnections", strconv.Itoa(c.MaxConnections), "must not be negative")
+	}
+	if c.BandwidthLimit < 0 {
+		v.Add("bandwidthLimit", strconv.FormatInt(c.BandwidthLimit, 10), "must not be negative")
+	}
+
+	if len(v.Errors) == 0 {
+		return nil
+	}
+	return v
+}
+
+// checkHostPattern 校验主机名规则：精确主机名 (可以带端口)、IP、*.example.com 形式的通配符、CIDR 或兜底规则 *
+func checkHostPattern(pattern string) string {
+	switch {
+	case pattern == "":
+		return "is required"
+	case pattern == "*":
+		return ""
+	case strings.HasPrefix(pattern, "*."):
+		return checkHostName(pattern[2:])
+	case strings.Contains(pattern, "*"):
+		return "wildcard is only allowed as the whole leftmost label, e.g. *.example.com"
+	}
+	if _, _, err := net.ParseCIDR(pattern); err == nil {
+		return ""
+	} else if strings.Contains(pattern, "/") {
+		return "is not a valid CIDR range"
+	}
+	return checkHostPort(pattern)
+}
+
+// checkDNSName 校验写入证书和节点配置的名称，不能是兜底规则或 CIDR
+func checkDNSName(name string) string {
+	switch {
+	case name == "":
+		return "must not be empty"
+	case name == "*":
+		return "catch-all cannot be used as a certificate name"
+	case strings.HasPrefix(name, "*."):
+		return checkHostName(name[2:])
+	case strings.Contains(name, "*"):
+		return "wildcard is only allowed as the whole leftmost label, e.g. *.example.com"
+	}
+	if _, _, err := net.ParseCIDR(name); err == nil {
+		return "CIDR ranges cannot be used as certificate names"
+	}
+	return checkHostPort(name)
+}
+
+// checkHostPort 校验主机名或 IP，可以带端口
+func checkHostPort(hostPort string) string {
+	if net.ParseIP(strings.Trim(hostPort, "[]")) != nil {
+		return ""
+	}
+	host := hostPort
+	if h, port, err := net.SplitHostPort(hostPort); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Sprintf("port %q must be between 1 and 65535", port)
+		}
+		if net.ParseIP(h) != nil {
+			return ""
+		}
+		host = h
+	} else if strings.Contains(hostPort, ":") {
+		return "is not a valid host:port"
+	}
+	return checkHostName(host)
+}
+
+// checkHostName 校验 DNS 主机名的长度和字符，请求的主机名按小写匹配，大写的配置不会被精确匹配
+func checkHostName(name string) string {
+	if name == "" {
+		return "host name must not be empty"
+	}
+	if name != strings.ToLower(name) {
+		return "must be lowercase"
+	}
+	if strings.HasSuffix(name, ".") {
+		return "must not end with a dot"
+	}
+	if len(name) > 253 {
+		return "must not be longer than 253 characters"
+	}
+	for _, label := range strings.Split(name, ".") {
+		switch {
+		case label == "":
+			return "must not contain empty labels"
+		case len(label) > 63:
+			return fmt.Sprintf("label %q is longer than 63 characters", label)
+		case label[0] == '-' || label[len(label)-1] == '-':
+			return fmt.Sprintf("label %q must not start or end with a hyphen", label)
+		}
+		for _, ch := range label {
+			if !(ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '-') {
+				return fmt.Sprintf("label %q contains invalid character %q", label, ch)
+			}
+		}
+	}
+	return ""
+}
+
+// checkUpstreamURL 校验上游地址，只支持 http 和 https
+func checkUpstreamURL(raw string) string {
+	u, err := url.Parse(raw)
+	switch {
+	case err != nil:
+		return "is not a valid url"
+	case u.Scheme != "http" && u.Scheme != "https":
+		if u.Scheme == "" {
+			return "scheme is required, e.g. https://registry.example.com"
+		}
+		return fmt.Sprintf("scheme %q is not supported, must be http or https", u.Scheme)
+	case u.Host == "":
+		return "host is required"
+	case u.RawQuery != "" || u.Fragment != "":
+		return "must not contain a query or fragment"
+	}
+	return ""
+}
+
+// redactURL 去掉地址中的密码，用于错误信息
+func redactURL(raw string) string {
+	if u, err := url.Parse(raw); err == nil {
+		return u.Redacted()
+	}
+	return raw
+}
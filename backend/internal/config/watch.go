@@ -0,0 +1,39 @@
+package config
+
+import "sync"
+
+// Watchable 配置可能在当前进程之外被修改的存储 (例如多个副本共享的 etcd) 实现该接口，
+// 使用方据此清除按主机名缓存的代理处理器等状态
+type Watchable interface {
+	// OnChange 注册回调，配置被其他进程添加、更新或删除后以主机名调用
+	OnChange(fn func(hostName string))
+}
+
+// Reloadable 可以重新读取配置来源的存储 (例如配置文件) 实现该接口，用于 SIGHUP 和管理接口触发的重新加载
+type Reloadable interface {
+	// Reload 重新读取配置，返回添加、更新或删除的主机名
+	Reload() ([]string, error)
+}
+
+// changeListeners 保存 OnChange 注册的回调，嵌入到实现 Watchable 的存储中
+type changeListeners struct {
+	mu  sync.Mutex
+	fns []func(hostName string)
+}
+
+// OnChange 注册配置变化的回调
+func (l *changeListeners) OnChange(fn func(hostName string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fns = append(l.fns, fn)
+}
+
+// notify 通知主机名的配置发生了变化
+func (l *changeListeners) notify(hostName string) {
+	l.mu.Lock()
+	fns := append([]func(string){}, l.fns...)
+	l.mu.Unlock()
+	for _, fn := range fns {
+		fn(hostName)
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetContainerArchive 以 tar 包形式下载容器内的文件或目录
+func (h *ContainerHandler) GetContainerArchive(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	srcPath := c.Query("path")
+	if srcPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		return
+	}
+
+	reader, stat, err := h.dockerService.CopyFromContainer(contextName, id, srcPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	// 与 Docker API 保持一致，通过响应头返回路径元信息
+	if statJSON, err := json.Marshal(stat); err == nil {
+		c.Header("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(statJSON))
+	}
+
+	name := stat.Name
+	if name == "" || name == "/" {
+		name = "archive"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".tar"))
+	c.DataFromReader(http.StatusOK, -1, "application/x-tar", reader, nil)
+}
+
+// PutContainerArchive 上传文件到容器内的指定目录
+// 请求体可以是 tar 包 (Content-Type: application/x-tar)，也可以是包含 file 字段的 multipart 表单
+func (h *ContainerHandler) PutContainerArchive(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	dstPath := c.Query("path")
+	if dstPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		return
+	}
+	overwrite := c.Query("overwrite") == "true"
+
+	var content io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+		content = singleFileTar(file, header)
+	}
+
+	err := h.dockerService.CopyToContainer(contextName, id, dstPath, content, overwrite)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Files copied successfully"})
+}
+
+// singleFileTar 将上传的单个文件包装成 tar 流
+func singleFileTar(file multipart.File, header *multipart.FileHeader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{
+			Name:    path.Base(header.Filename),
+			Mode:    0644,
+			Size:    header.Size,
+			ModTime: time.Now(),
+		})
+		if err == nil {
+			_, err = io.Copy(tw, file)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// ExportContainer 以 tar 包形式导出容器的完整文件系统
+func (h *ContainerHandler) ExportContainer(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+
+	reader, err := h.dockerService.ExportContainer(contextName, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, -1, "application/x-tar", reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", id+".tar"),
+	})
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/audit"
+)
+
+type AuditHandler struct {
+	sink audit.Sink
+}
+
+func NewAuditHandler(sink audit.Sink) *AuditHandler {
+	return &AuditHandler{
+		sink: sink,
+	}
+}
+
+// AuditMiddleware 在请求完成后记录所有修改操作，查询请求不记录
+func AuditMiddleware(sink audit.Sink) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isMutatingRequest(c) {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		result := audit.ResultSuccess
+		if status >= http.StatusBadRequest {
+			result = audit.ResultFailure
+		}
+		entry := audit.Entry{
+			Time:     start,
+			User:     c.GetString(authUserKey),
+			Token:    c.GetString(authTokenKey),
+			SourceIP: c.ClientIP(),
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			Route:    c.FullPath(),
+			Context:  c.Param("context"),
+			Resource: auditResource(c),
+			Action:   c.Request.Method + " " + strings.TrimPrefix(c.FullPath(), "/api"),
+			Status:   status,
+			Result:   result,
+			Duration: time.Since(start).Milliseconds(),
+		}
+		if err := sink.Record(entry); err != nil {
+			log.Printf("Failed to record audit entry: %v", err)
+		}
+	}
+}
+
+// auditResource 从路由参数中取出被操作的资源
+func auditResource(c *gin.Context) string {
+	for _, key := range []string{"id", "name", "username", "group"} {
+		if v := c.Param(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ListAudit 查询审计记录，例如
+// ?user=admin&context=prod&result=failure&since=2024-01-01T00:00:00Z&limit=50&offset=0
+// 结果按时间倒序，总数通过 X-Total-Count 响应头返回
+func (h *AuditHandler) ListAudit(c *gin.Context) {
+	query, err := auditQueryFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, total, err := h.sink.Query(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, entries)
+}
+
+func auditQueryFromQuery(c *gin.Context) (audit.Query, error) {
+	query := audit.Query{
+		User:     c.Query("user"),
+		Context:  c.Query("context"),
+		Resource: c.Query("resource"),
+		Action:   c.Query("action"),
+		Result:   c.Query("result"),
+	}
+
+	var err error
+	if v := c.Query("since"); v != "" {
+		if query.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return query, fmt.Errorf("invalid since: %s", v)
+		}
+	}
+	if v := c.Query("until"); v != "" {
+		if query.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return query, fmt.Errorf("invalid until: %s", v)
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			return query, fmt.Errorf("invalid limit: %s", v)
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil {
+			return query, fmt.Errorf("invalid offset: %s", v)
+		}
+	}
+
+	return query, query.Validate()
+}
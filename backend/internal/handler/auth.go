@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/auth"
+)
+
+// 认证通过后保存在 gin.Context 中的用户名、角色和访问令牌 ID
+const (
+	authUserKey  = "auth.user"
+	authRoleKey  = "auth.role"
+	authTokenKey = "auth.token"
+)
+
+// oidcStateCookie 保存授权请求的 state 和 nonce，回调时校验以防止 CSRF 和重放
+const oidcStateCookie = "oidc_state"
+
+type AuthHandler struct {
+	manager *auth.Manager
+	oidc    *auth.OIDCClient
+	// oidcLoginRedirect OIDC 登录完成后跳转的前端地址，token 放在 URL fragment 中
+	oidcLoginRedirect string
+}
+
+func NewAuthHandler(manager *auth.Manager, oidc *auth.OIDCClient, oidcLoginRedirect string) *AuthHandler {
+	return &AuthHandler{
+		manager:           manager,
+		oidc:              oidc,
+		oidcLoginRedirect: oidcLoginRedirect,
+	}
+}
+
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type createUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role"`
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"oldPassword" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required"`
+}
+
+// AuthMiddleware 校验 access token 或个人访问令牌，未认证的请求返回 401
+// 浏览器无法为 WebSocket 和 EventSource 设置请求头，queryTokenRoutes 中的路由 (完整的路由路径，
+// 例如 /api/contexts/:context/events) 也接受 token 查询参数；其他路由不接受，避免令牌出现在链接和访问日志中
+func AuthMiddleware(manager *auth.Manager, queryTokenRoutes ...string) gin.HandlerFunc {
+	allowQuery := make(map[string]bool, len(queryTokenRoutes))
+	for _, route := range queryTokenRoutes {
+		allowQuery[route] = true
+	}
+	return func(c *gin.Context) {
+		token := bearerToken(c, allowQuery[c.FullPath()])
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+
+		var claims auth.Claims
+		var err error
+		if auth.IsAPIToken(token) {
+			claims, err = manager.AuthenticateAPIToken(token)
+		} else {
+			claims, err = manager.Authenticate(token)
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(authUserKey, claims.Subject)
+		c.Set(authRoleKey, claims.Role)
+		if claims.Type == auth.TokenAPI {
+			c.Set(authTokenKey, claims.ID)
+		}
+		c.Next()
+	}
+}
+
+// RequireRole 要求当前用户具有指定角色及以上的权限
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.HasRole(c.GetString(authRoleKey), role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ViewerGuard 拒绝只读角色的修改请求
+func ViewerGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isMutatingRequest(c) && !auth.HasRole(c.GetString(authRoleKey), auth.RoleOperator) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func bearerToken(c *gin.Context, allowQuery bool) string {
+	header := c.GetHeader("Authorization")
+	if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	if allowQuery {
+		return c.Query("token")
+	}
+	return ""
+}
+
+// Login 用户登录
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.manager.Login(req.Username, req.Password)
+	if err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Refresh 使用 refresh token 换取新的 token
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.manager.Refresh(req.RefreshToken)
+	if err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout 注销 refresh token
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.manager.Logout(req.RefreshToken); err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// GetProviders 获取可用的登录方式，前端据此显示登录页
+func (h *AuthHandler) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"local": true,
+		"oidc":  h.oidc != nil,
+	})
+}
+
+// OIDCLogin 跳转到身份提供方进行登录
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	if h.oidc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "oidc is not configured"})
+		return
+	}
+
+	state, err := randomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	authURL, err := h.oidc.AuthCodeURL(c.Request.Context(), state, nonce)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state+"."+nonce, 600, "/api/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback 处理身份提供方的回调，签发 token 后跳转回前端
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if h.oidc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "oidc is not configured"})
+		return
+	}
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errCode + ": " + c.Query("error_description")})
+		return
+	}
+
+	cookie, err := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/api/auth/oidc", "", c.Request.TLS != nil, true)
+	state, nonce, ok := strings.Cut(cookie, ".")
+	if err != nil || !ok || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid oidc state"})
+		return
+	}
+
+	identity, err := h.oidc.Exchange(c.Request.Context(), c.Query("code"), nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	tokens, err := h.manager.LoginExternal(auth.OIDCProviderName, identity.Username, identity.Role)
+	if err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	fragment := url.Values{
+		"access_token":  {tokens.AccessToken},
+		"refresh_token": {tokens.RefreshToken},
+		"token_type":    {tokens.TokenType},
+		"expires_in":    {strconv.FormatInt(tokens.ExpiresIn, 10)},
+	}
+	c.Redirect(http.StatusFound, h.oidcLoginRedirect+"#"+fragment.Encode())
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetCurrentUser 获取当前登录用户
+func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"username": c.GetString(authUserKey),
+		"role":     c.GetString(authRoleKey),
+	})
+}
+
+// ChangePassword 修改当前用户的密码
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.manager.ChangePassword(c.GetString(authUserKey), req.OldPassword, req.NewPassword); err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// ListUsers 获取用户列表
+func (h *AuthHandler) ListUsers(c *gin.Context) {
+	users, err := h.manager.ListUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// CreateUser 创建用户
+func (h *AuthHandler) CreateUser(c *gin.Context) {
+	var req createUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.manager.CreateUser(req.Username, req.Password, req.Role); err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User created successfully"})
+}
+
+// DeleteUser 删除用户，不允许删除当前登录的用户
+func (h *AuthHandler) DeleteUser(c *gin.Context) {
+	username := c.Param("username")
+	if username == c.GetString(authUserKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot delete the current user"})
+		return
+	}
+
+	if err := h.manager.DeleteUser(username); err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+func authErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials),
+		errors.Is(err, auth.ErrInvalidToken),
+		errors.Is(err, auth.ErrTokenExpired):
+		return http.StatusUnauthorized
+	case errors.Is(err, auth.ErrUserNotFound), errors.Is(err, auth.ErrTokenNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, auth.ErrUserExists):
+		return http.StatusConflict
+	case errors.Is(err, auth.ErrWeakPassword),
+		errors.Is(err, auth.ErrPasswordTooLong),
+		errors.Is(err, auth.ErrInvalidUsername),
+		errors.Is(err, auth.ErrInvalidRole),
+		errors.Is(err, auth.ErrExternalUser),
+		errors.Is(err, auth.ErrInvalidScope):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
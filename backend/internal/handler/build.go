@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/service"
+)
+
+type BuildHandler struct {
+	dockerService *service.DockerService
+}
+
+func NewBuildHandler(dockerService *service.DockerService) *BuildHandler {
+	return &BuildHandler{
+		dockerService: dockerService,
+	}
+}
+
+// readBuildRequest 解析构建请求
+// multipart 表单中 options 字段为 JSON 格式的构建选项，context 字段为 tar 格式的构建上下文，
+// options 必须位于 context 之前，以便构建上下文可以直接流式转发而无需落盘；
+// 使用 Git 仓库等远程上下文时，也可以直接以 JSON 请求体提交构建选项。
+// 未知的选项 (例如不支持的 secrets、ssh) 直接拒绝，不会被静默忽略
+func readBuildRequest(c *gin.Context) (service.BuildOptions, io.Reader, error) {
+	var opts service.BuildOptions
+
+	if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		if err := decodeBuildOptions(c.Request.Body, &opts); err != nil {
+			return opts, nil, err
+		}
+		return opts, nil, nil
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return opts, nil, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return opts, nil, nil
+		}
+		if err != nil {
+			return opts, nil, err
+		}
+
+		switch part.FormName() {
+		case "options":
+			if err := decodeBuildOptions(part, &opts); err != nil {
+				return opts, nil, err
+			}
+		case "context":
+			return opts, part, nil
+		}
+	}
+}
+
+// decodeBuildOptions 解析 JSON 格式的构建选项，拒绝未知字段
+func decodeBuildOptions(r io.Reader, opts *service.BuildOptions) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(opts); err != nil {
+		return fmt.Errorf("invalid build options: %v", err)
+	}
+	return nil
+}
+
+// BuildImage 构建镜像，并以 NDJSON 形式流式返回构建输出
+func (h *BuildHandler) BuildImage(c *gin.Context) {
+	contextName := c.Param("context")
+
+	opts, buildContext, err := readBuildRequest(c)
+	if err == nil {
+		err = opts.Validate()
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, err := h.dockerService.BuildImage(contextName, buildContext, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	streamJSONMessages(c, reader)
+}
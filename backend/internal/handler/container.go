@@ -3,9 +3,10 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -18,22 +19,31 @@ import (
 
 type ContainerHandler struct {
 	dockerService *service.DockerService
+	execSessions  *ExecSessions
 }
 
-func NewContainerHandler(dockerService *service.DockerService) *ContainerHandler {
+func NewContainerHandler(dockerService *service.DockerService, execSessions *ExecSessions) *ContainerHandler {
 	return &ContainerHandler{
 		dockerService: dockerService,
+		execSessions:  execSessions,
 	}
 }
 
 // GetContainers 获取容器列表
 func (h *ContainerHandler) GetContainers(c *gin.Context) {
 	contextName := c.Param("context")
-	containers, err := h.dockerService.ListContainers(contextName)
+	filter, err := containerFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	containers, total, err := h.dockerService.ListContainers(contextName, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
 	c.JSON(http.StatusOK, containers)
 }
 
@@ -61,6 +71,124 @@ func (h *ContainerHandler) StopContainer(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Container stopped successfully"})
 }
 
+// PauseContainer 暂停容器
+func (h *ContainerHandler) PauseContainer(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	err := h.dockerService.PauseContainer(contextName, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Container paused successfully"})
+}
+
+// UnpauseContainer 恢复容器
+func (h *ContainerHandler) UnpauseContainer(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	err := h.dockerService.UnpauseContainer(contextName, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Container unpaused successfully"})
+}
+
+// RestartContainer 重启容器，可通过 ?timeout=秒数 指定等待停止的超时时间
+func (h *ContainerHandler) RestartContainer(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+
+	var timeout *int
+	if t := c.Query("timeout"); t != "" {
+		seconds, err := strconv.Atoi(t)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timeout: " + t})
+			return
+		}
+		timeout = &seconds
+	}
+
+	err := h.dockerService.RestartContainer(contextName, id, timeout)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Container restarted successfully"})
+}
+
+// KillContainer 向容器发送信号，可通过 ?signal=SIGTERM 指定信号，默认 SIGKILL
+func (h *ContainerHandler) KillContainer(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	signal := c.DefaultQuery("signal", "SIGKILL")
+	err := h.dockerService.KillContainer(contextName, id, signal)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Container killed successfully"})
+}
+
+type renameContainerRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// RenameContainer 重命名容器
+func (h *ContainerHandler) RenameContainer(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	var req renameContainerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.dockerService.RenameContainer(contextName, id, req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Container renamed successfully"})
+}
+
+// UpdateContainer 调整容器资源限制和重启策略
+func (h *ContainerHandler) UpdateContainer(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	var config service.ContainerUpdateConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	warnings, err := h.dockerService.UpdateContainer(contextName, id, config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Container updated successfully", "warnings": warnings})
+}
+
+// CommitContainer 将容器提交为新镜像
+func (h *ContainerHandler) CommitContainer(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	var config service.CommitConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	imageID, err := h.dockerService.CommitContainer(contextName, id, config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Container committed successfully", "id": imageID})
+}
+
 // GetContainerDetail 获取容器详情
 func (h *ContainerHandler) GetContainerDetail(c *gin.Context) {
 	contextName := c.Param("context")
@@ -103,19 +231,214 @@ func (h *ContainerHandler) DeleteContainer(c *gin.Context) {
 // ListContainers 列出容器
 func (h *ContainerHandler) ListContainers(c *gin.Context) {
 	contextName := c.Param("context")
-	containers, err := h.dockerService.ListContainers(contextName)
+	filter, err := containerFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	containers, total, err := h.dockerService.ListContainers(contextName, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
 	c.JSON(http.StatusOK, containers)
 }
 
+// containerFilterFromQuery 从查询参数解析容器列表条件，例如
+// ?state=running&name=^web&label=env=prod&sort=name&order=desc&limit=50&offset=0
+// 分页时过滤后的总数通过 X-Total-Count 响应头返回
+func containerFilterFromQuery(c *gin.Context) (service.ContainerFilter, error) {
+	filter := service.ContainerFilter{
+		Health: c.Query("health"),
+		State:  c.Query("state"),
+		Name:   c.Query("name"),
+		Image:  c.Query("image"),
+		Labels: c.QueryArray("label"),
+		Sort:   c.Query("sort"),
+	}
+
+	// 默认按创建时间倒序（与 docker ps 一致），按其他字段排序时默认正序
+	order := c.Query("order")
+	if order == "" {
+		order = "asc"
+		if filter.Sort == "" || filter.Sort == "created" {
+			order = "desc"
+		}
+	}
+	switch order {
+	case "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return filter, fmt.Errorf("invalid order: %s", order)
+	}
+
+	var err error
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			return filter, fmt.Errorf("invalid limit: %s", v)
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if filter.Offset, err = strconv.Atoi(v); err != nil {
+			return filter, fmt.Errorf("invalid offset: %s", v)
+		}
+	}
+
+	return filter, filter.Validate()
+}
+
+// RunHealthCheck 立即执行容器配置的健康检查命令
+func (h *ContainerHandler) RunHealthCheck(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+
+	result, err := h.dockerService.RunHealthCheck(contextName, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// BatchContainers 对多个容器批量执行 start/stop/restart/delete，返回每个容器的结果
+func (h *ContainerHandler) BatchContainers(c *gin.Context) {
+	contextName := c.Param("context")
+	var req service.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := h.dockerService.BatchContainers(contextName, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// RecreateContainer 使用新镜像重建容器，保留原有配置
+func (h *ContainerHandler) RecreateContainer(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	var opts service.RecreateOptions
+	if err := c.ShouldBindJSON(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	newID, err := h.dockerService.RecreateContainer(contextName, id, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "id": newID})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Container recreated successfully", "id": newID})
+}
+
+// defaultExecShells 未指定命令时依次尝试的 shell
+var defaultExecShells = []string{"/bin/bash", "/bin/sh"}
+
+// execOptions 终端会话参数，WebSocket 握手无法携带请求体，全部通过查询参数传递
+type execOptions struct {
+	Cmd     []string
+	Shells  []string
+	User    string
+	WorkDir string
+	Env     []string
+	Tty     bool
+}
+
+// execOptionsFromQuery 解析终端参数：
+// cmd 命令及参数，可重复；未指定时按 shell（可重复，默认 bash、sh）查找第一个存在的 shell
+// user、workdir 执行用户和工作目录；env 环境变量 KEY=VALUE，可重复；tty 是否分配终端，默认 true
+func execOptionsFromQuery(c *gin.Context) (execOptions, error) {
+	opts := execOptions{
+		Cmd:     c.QueryArray("cmd"),
+		Shells:  c.QueryArray("shell"),
+		User:    c.Query("user"),
+		WorkDir: c.Query("workdir"),
+		Env:     c.QueryArray("env"),
+		Tty:     true,
+	}
+	if len(opts.Shells) == 0 {
+		opts.Shells = defaultExecShells
+	}
+	for _, env := range opts.Env {
+		if !strings.Contains(env, "=") || strings.HasPrefix(env, "=") {
+			return opts, fmt.Errorf("invalid env %q, expected KEY=VALUE", env)
+		}
+	}
+	if tty := c.Query("tty"); tty != "" {
+		v, err := strconv.ParseBool(tty)
+		if err != nil {
+			return opts, fmt.Errorf("invalid tty %q", tty)
+		}
+		opts.Tty = v
+	}
+	return opts, nil
+}
+
+// startExec 创建并附加到新的 exec 实例，附加请求同时会启动该实例
+func (h *ContainerHandler) startExec(contextName, id, owner string, opts execOptions) (*execSession, error) {
+	cmd := opts.Cmd
+	if len(cmd) == 0 {
+		shell, err := h.dockerService.FindShell(contextName, id, opts.Shells)
+		if err != nil {
+			return nil, err
+		}
+		cmd = []string{shell}
+	}
+
+	execConfig := types.ExecConfig{
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          opts.Tty,
+		Cmd:          cmd,
+		User:         opts.User,
+		WorkingDir:   opts.WorkDir,
+		Env:          opts.Env,
+		DetachKeys:   "ctrl-p,ctrl-q",
+	}
+	resp, err := h.dockerService.CreateExec(contextName, id, execConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %v", err)
+	}
+	conn, err := h.dockerService.AttachExec(contextName, resp.ID, opts.Tty)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &execSession{
+		id:          resp.ID,
+		contextName: contextName,
+		containerID: id,
+		owner:       owner,
+		conn:        conn,
+	}
+	h.execSessions.start(session, opts.Tty)
+	return session, nil
+}
+
 // ExecContainer 在容器中执行命令
+// 连接建立后先发送 {"type":"session","id":"..."}，连接意外断开时可以携带 session=<id> 重新连接到同一会话
 func (h *ContainerHandler) ExecContainer(c *gin.Context) {
 	contextName := c.Param("context")
 	id := c.Param("id")
 
+	opts, err := execOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 升级HTTP连接为WebSocket
 	upgrader := websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
@@ -131,109 +454,69 @@ func (h *ContainerHandler) ExecContainer(c *gin.Context) {
 	}
 	defer ws.Close()
 
-	// 创建执行配置
-	execConfig := types.ExecConfig{
-		AttachStdin:  true,
-		AttachStdout: true,
-		AttachStderr: true,
-		Tty:          true,
-		Cmd:          []string{"/bin/sh"},
-		DetachKeys:   "ctrl-p,ctrl-q",
+	// 服务正在关闭时不再接受新的终端会话
+	if !h.execSessions.add(ws) {
+		ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "server is shutting down"),
+			time.Now().Add(time.Second))
+		return
 	}
+	defer h.execSessions.remove(ws)
 
-	// 创建执行实例
-	resp, err := h.dockerService.CreateExec(contextName, id, execConfig)
+	owner := c.GetString(authUserKey)
+	var session *execSession
+	if sessionID := c.Query("session"); sessionID != "" {
+		session, err = h.execSessions.resume(sessionID, contextName, id, owner)
+	} else {
+		session, err = h.startExec(contextName, id, owner, opts)
+	}
 	if err != nil {
-		log.Printf("Failed to create exec: %v", err)
-		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error creating exec: %v\n", err)))
+		log.Printf("Failed to start exec session: %v", err)
+		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error: %v\n", err)))
 		return
 	}
 
-	// 附加到执行实例
-	hijackedResp, err := h.dockerService.AttachExec(contextName, resp.ID, execConfig.Tty)
-	if err != nil {
-		log.Printf("Failed to attach exec: %v", err)
-		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error attaching to exec: %v\n", err)))
+	if err := ws.WriteJSON(gin.H{"type": "session", "id": session.id}); err != nil {
 		return
 	}
-	defer hijackedResp.Close()
-
-	// 创建错误通道
-	errChan := make(chan error, 2)
+	if err := h.execSessions.attach(session, ws); err != nil {
+		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error: %v\n", err)))
+		return
+	}
+	defer h.execSessions.detach(session, ws)
 
-	// 启动数据转发
-	go func() {
-		buf := make([]byte, 1024)
-		for {
-			nr, err := hijackedResp.Read(buf)
-			if err != nil {
-				errChan <- err
-				return
-			}
-			if nr > 0 {
-				err := ws.WriteMessage(websocket.BinaryMessage, buf[:nr])
-				if err != nil {
-					errChan <- err
-					return
-				}
+	// 转发客户端输入，连接关闭或进程退出后返回
+	for {
+		messageType, p, err := ws.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Exec session %s detached: %v", session.id, err)
 			}
+			return
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		var msg struct {
+			Type string `json:"type"`
+			Data string `json:"data"`
+			Cols int    `json:"cols,omitempty"`
+			Rows int    `json:"rows,omitempty"`
+		}
+		if err := json.Unmarshal(p, &msg); err != nil {
+			continue
 		}
-	}()
 
-	go func() {
-		for {
-			messageType, p, err := ws.ReadMessage()
-			if err != nil {
-				errChan <- err
+		switch msg.Type {
+		case "input":
+			if _, err := session.conn.Write([]byte(msg.Data)); err != nil {
 				return
 			}
-
-			if messageType == websocket.TextMessage {
-				var msg struct {
-					Type string `json:"type"`
-					Data string `json:"data"`
-					Cols int    `json:"cols,omitempty"`
-					Rows int    `json:"rows,omitempty"`
-				}
-
-				if err := json.Unmarshal(p, &msg); err != nil {
-					continue
-				}
-
-				switch msg.Type {
-				case "input":
-					_, err = hijackedResp.Write([]byte(msg.Data))
-					if err != nil {
-						errChan <- err
-						return
-					}
-				case "resize":
-					if err := h.dockerService.ResizeExec(contextName, resp.ID, msg.Rows, msg.Cols); err != nil {
-						log.Printf("Failed to resize terminal: %v", err)
-					}
-				}
+		case "resize":
+			if err := h.dockerService.ResizeExec(contextName, session.id, msg.Rows, msg.Cols); err != nil {
+				log.Printf("Failed to resize terminal: %v", err)
 			}
 		}
-	}()
-
-	// 启动执行实例
-	err = h.dockerService.StartExec(contextName, resp.ID, types.ExecStartCheck{
-		Tty:    true,
-		Detach: false,
-	})
-	if err != nil {
-		log.Printf("Failed to start exec: %v", err)
-		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error starting exec: %v\n", err)))
-		return
-	}
-
-	// 等待错误或连接关闭
-	select {
-	case err := <-errChan:
-		if err != io.EOF {
-			log.Printf("Connection error: %v", err)
-		}
-	case <-c.Done():
-		log.Println("Client connection closed")
 	}
 }
@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"bytes"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -18,12 +21,16 @@ func NewContextHandler(dockerService *service.DockerService) *ContextHandler {
 	}
 }
 
+// ListContexts 获取 context 列表，支持 ?group=prod&label=region=eu 过滤
 func (h *ContextHandler) ListContexts(c *gin.Context) {
-	contexts, err := h.dockerService.ListContexts()
+	contexts, err := h.dockerService.ListContexts(contextFilterFromQuery(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for i := range contexts {
+		contexts[i].DockerContext = contexts[i].Redacted()
+	}
 	c.JSON(http.StatusOK, contexts)
 }
 
@@ -33,6 +40,10 @@ func (h *ContextHandler) CreateContext(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	err := h.dockerService.CreateContext(config)
 	if err != nil {
@@ -69,6 +80,15 @@ func (h *ContextHandler) UpdateContextConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	config.Name = name
+	if err := h.dockerService.RestoreTLSKey(name, &config); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	err := h.dockerService.UpdateContextConfig(name, config)
 	if err != nil {
@@ -88,3 +108,115 @@ func (h *ContextHandler) GetServerInfo(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, info)
 }
+
+// ImportContexts 导入 docker CLI 的 context
+// JSON 请求体从服务端的 docker contexts 目录导入；上传 tar 归档（multipart 的 file 字段或 application/x-tar）
+// 时导入导出接口生成的归档，此时通过 ?name=xx&overwrite=true 指定选项
+func (h *ContextHandler) ImportContexts(c *gin.Context) {
+	var (
+		result service.ContextImportResult
+		err    error
+	)
+
+	contentType := c.ContentType()
+	if strings.HasPrefix(contentType, "multipart/form-data") || contentType == "application/x-tar" {
+		opts := service.ContextImportOptions{
+			Names:     c.QueryArray("name"),
+			Overwrite: c.Query("overwrite") == "true",
+		}
+		content, closeFn, uploadErr := uploadBody(c)
+		if uploadErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": uploadErr.Error()})
+			return
+		}
+		defer closeFn()
+		result, err = h.dockerService.ImportDockerContextArchive(content, opts)
+	} else {
+		var opts service.ContextImportOptions
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&opts); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		result, err = h.dockerService.ImportDockerContexts(opts)
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ExportContexts 以 docker CLI contexts 目录布局导出 tar 归档，?name=xx 可指定多个 context
+func (h *ContextHandler) ExportContexts(c *gin.Context) {
+	// 归档很小，先写入内存以便出错时返回 JSON 错误
+	var buf bytes.Buffer
+	if err := h.dockerService.ExportDockerContexts(c.QueryArray("name"), &buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="docker-contexts.tar"`)
+	c.Data(http.StatusOK, "application/x-tar", buf.Bytes())
+}
+
+// GetOverview 汇总 context 的概览信息，可通过 ?timeout=3s 设置单个 context 的查询超时，
+// 支持与 context 列表相同的 group/label 过滤
+func (h *ContextHandler) GetOverview(c *gin.Context) {
+	timeout := service.DefaultOverviewTimeout
+	if v := c.Query("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timeout: " + v})
+			return
+		}
+		timeout = d
+	}
+
+	overviews, err := h.dockerService.Overview(contextFilterFromQuery(c), timeout)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, overviews)
+}
+
+// contextFilterFromQuery 从查询参数解析 context 过滤条件
+func contextFilterFromQuery(c *gin.Context) service.ContextFilter {
+	return service.ContextFilter{
+		Group:  c.Query("group"),
+		Labels: c.QueryArray("label"),
+	}
+}
+
+// BatchGroupContainers 对分组内所有 context 上匹配条件的容器执行批量操作
+func (h *ContextHandler) BatchGroupContainers(c *gin.Context) {
+	group := c.Param("group")
+	var req service.GroupBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := h.dockerService.BatchGroupContainers(group, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// GetDiscoveredContexts 返回本机发现的 Docker 守护进程，?refresh=true 时重新探测
+func (h *ContextHandler) GetDiscoveredContexts(c *gin.Context) {
+	if c.Query("refresh") == "true" {
+		c.JSON(http.StatusOK, h.dockerService.DiscoverContexts())
+		return
+	}
+	c.JSON(http.StatusOK, h.dockerService.DiscoveredContexts())
+}
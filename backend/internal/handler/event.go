@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/service"
+)
+
+// eventHeartbeatInterval SSE 心跳间隔，避免连接被中间代理断开
+const eventHeartbeatInterval = 30 * time.Second
+
+type EventHandler struct {
+	dockerService *service.DockerService
+}
+
+func NewEventHandler(dockerService *service.DockerService) *EventHandler {
+	return &EventHandler{
+		dockerService: dockerService,
+	}
+}
+
+// parseEventFilters 解析查询参数中的过滤条件
+// 支持 ?filter=type=container&filter=event=start 以及 ?type=container&event=start 两种写法
+func parseEventFilters(c *gin.Context) map[string][]string {
+	filter := make(map[string][]string)
+	for _, f := range c.QueryArray("filter") {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || key == "" || value == "" {
+			continue
+		}
+		filter[key] = append(filter[key], value)
+	}
+	for _, key := range []string{"type", "event", "container", "image", "network", "volume", "label"} {
+		filter[key] = append(filter[key], c.QueryArray(key)...)
+		if len(filter[key]) == 0 {
+			delete(filter, key)
+		}
+	}
+	return filter
+}
+
+// StreamEvents 以 SSE 形式推送 Docker 引擎事件
+func (h *EventHandler) StreamEvents(c *gin.Context) {
+	contextName := c.Param("context")
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	messages, errs, err := h.dockerService.WatchEvents(ctx, contextName, parseEventFilters(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case msg := <-messages:
+			c.SSEvent("message", msg)
+			return true
+		case err := <-errs:
+			if err != nil && !errors.Is(err, context.Canceled) && err != io.EOF {
+				log.Printf("Event stream error: %v", err)
+				c.SSEvent("error", gin.H{"error": err.Error()})
+			}
+			return false
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListContainerFiles 列出容器内目录的内容，通过 ?path=/etc 指定目录，默认为根目录
+func (h *ContainerHandler) ListContainerFiles(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	dir := c.DefaultQuery("path", "/")
+
+	entries, truncated, err := h.dockerService.ListContainerDir(contextName, id, dir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setListingTruncated(c, truncated)
+	c.JSON(http.StatusOK, entries)
+}
+
+// setListingTruncated 目录过大只返回了部分子项时设置 X-Listing-Truncated 响应头
+func setListingTruncated(c *gin.Context, truncated bool) {
+	if truncated {
+		c.Header("X-Listing-Truncated", "true")
+	}
+}
+
+// GetContainerFileContent 读取容器内的文件内容
+func (h *ContainerHandler) GetContainerFileContent(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	filePath := c.Query("path")
+	if filePath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		return
+	}
+
+	reader, entry, err := h.dockerService.OpenContainerFile(contextName, id, filePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	extraHeaders := map[string]string{}
+	if c.Query("download") == "true" {
+		extraHeaders["Content-Disposition"] = fmt.Sprintf("attachment; filename=%q", entry.Name)
+	}
+	c.DataFromReader(http.StatusOK, entry.Size, "application/octet-stream", reader, extraHeaders)
+}
@@ -1,19 +1,96 @@
 package handler
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/docker/distribution/reference"
 	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/config"
 	"github.com/smartcat999/container-ui/internal/service"
 )
 
 type ImageHandler struct {
-	dockerService *service.DockerService
+	dockerService   *service.DockerService
+	registryConfigs config.ConfigStore // 可选，用于复用仓库管理器中的认证信息
+	registryURL     string             // 可选，内置镜像仓库地址，用于镜像搜索
 }
 
-func NewImageHandler(dockerService *service.DockerService) *ImageHandler {
+func NewImageHandler(dockerService *service.DockerService, registryConfigs config.ConfigStore, registryURL string) *ImageHandler {
 	return &ImageHandler{
-		dockerService: dockerService,
+		dockerService:   dockerService,
+		registryConfigs: registryConfigs,
+		registryURL:     registryURL,
+	}
+}
+
+type pullImageRequest struct {
+	Image string                `json:"image" binding:"required"`
+	Auth  *service.RegistryAuth `json:"auth"`
+}
+
+type pushImageRequest struct {
+	Target string                `json:"target"` // 目标引用，例如 localhost:5050/app:latest，为空时直接推送原镜像
+	Auth   *service.RegistryAuth `json:"auth"`
+}
+
+type tagImageRequest struct {
+	Repository string `json:"repository" binding:"required"`
+	Tag        string `json:"tag"`
+}
+
+type createContainerRequest struct {
+	ImageID string   `json:"imageId"`
+	Name    string   `json:"name"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Ports   []struct {
+		Host      uint16 `json:"host"`
+		Container uint16 `json:"container"`
+	} `json:"ports"`
+	Env []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"env"`
+	Volumes []struct {
+		Host      string `json:"host"`
+		Container string `json:"container"`
+		Mode      string `json:"mode"`
+	} `json:"volumes"`
+	RestartPolicy string `json:"restartPolicy"`
+	NetworkMode   string `json:"networkMode"`
+}
+
+// lookupRegistryAuth 根据镜像引用的仓库域名，从仓库配置中查找认证信息
+func (h *ImageHandler) lookupRegistryAuth(ref string) *service.RegistryAuth {
+	if h.registryConfigs == nil {
+		return nil
+	}
+
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil
+	}
+
+	domain := reference.Domain(named)
+	cfg, exists, err := h.registryConfigs.Get(domain)
+	if err != nil || !exists || cfg.Username == "" {
+		return nil
+	}
+	username, password, err := cfg.Credentials()
+	if err != nil {
+		log.Printf("Failed to resolve registry credentials: %v", err)
+		return nil
+	}
+
+	return &service.RegistryAuth{
+		Username:      username,
+		Password:      password,
+		ServerAddress: domain,
 	}
 }
 
@@ -28,42 +105,183 @@ func (h *ImageHandler) GetImages(c *gin.Context) {
 	c.JSON(http.StatusOK, images)
 }
 
+// PullImage 拉取镜像，并以 NDJSON 形式流式返回拉取进度
+func (h *ImageHandler) PullImage(c *gin.Context) {
+	contextName := c.Param("context")
+	var req pullImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	auth := req.Auth
+	if auth == nil {
+		auth = h.lookupRegistryAuth(req.Image)
+	}
+
+	reader, err := h.dockerService.PullImage(contextName, req.Image, auth)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	streamJSONMessages(c, reader)
+}
+
+// PushImage 为镜像打标签并推送到目标仓库，以 NDJSON 形式流式返回推送进度
+func (h *ImageHandler) PushImage(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	var req pushImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target := req.Target
+	if target == "" {
+		target = id
+	}
+
+	// 未显式提供凭据时，尝试复用仓库配置中的认证信息
+	auth := req.Auth
+	if auth == nil {
+		auth = h.lookupRegistryAuth(target)
+	}
+
+	reader, err := h.dockerService.PushImage(contextName, id, target, auth)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	streamJSONMessages(c, reader)
+}
+
+// ImportImage 从 tar 包导入镜像，以 NDJSON 形式流式返回导入结果
+// 通过 ?repository=name&tag=latest&message=...&changes=CMD ... 指定镜像引用和附加配置
+func (h *ImageHandler) ImportImage(c *gin.Context) {
+	contextName := c.Param("context")
+
+	ref := c.Query("repository")
+	if tag := c.Query("tag"); ref != "" && tag != "" {
+		ref = ref + ":" + tag
+	}
+
+	body, release, err := uploadBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer release()
+
+	reader, err := h.dockerService.ImportImage(contextName, body, ref, c.Query("message"), c.QueryArray("changes"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	streamJSONMessages(c, reader)
+}
+
+// SaveImage 将镜像导出为 tar 包下载，可通过 ?image=other 追加其他镜像一起导出
+func (h *ImageHandler) SaveImage(c *gin.Context) {
+	contextName := c.Param("context")
+	ids := append([]string{c.Param("id")}, c.QueryArray("image")...)
+
+	reader, err := h.dockerService.SaveImages(contextName, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	filename := strings.NewReplacer("/", "_", ":", "_").Replace(ids[0]) + ".tar"
+	c.DataFromReader(http.StatusOK, -1, "application/x-tar", reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", filename),
+	})
+}
+
+// LoadImage 从 tar 包加载镜像，以流的形式返回加载结果
+func (h *ImageHandler) LoadImage(c *gin.Context) {
+	contextName := c.Param("context")
+
+	body, release, err := uploadBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer release()
+
+	reader, isJSON, err := h.dockerService.LoadImages(contextName, body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	if isJSON {
+		streamJSONMessages(c, reader)
+		return
+	}
+	c.DataFromReader(http.StatusOK, -1, "text/plain; charset=utf-8", reader, nil)
+}
+
 // DeleteImage 删除镜像
+// 指定 ?tag=repo:tag 时仅移除该标签，否则删除整个镜像，可通过 ?force=true 强制删除
 func (h *ImageHandler) DeleteImage(c *gin.Context) {
 	contextName := c.Param("context")
 	id := c.Param("id")
-	err := h.dockerService.DeleteImage(contextName, id)
+
+	if tag := c.Query("tag"); tag != "" {
+		items, err := h.dockerService.UntagImage(contextName, id, tag)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Image untagged successfully", "items": items})
+		return
+	}
+
+	force := c.Query("force") == "true"
+	items, err := h.dockerService.DeleteImage(contextName, id, force)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully", "items": items})
+}
+
+// TagImage 为镜像添加新标签
+func (h *ImageHandler) TagImage(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	var req tagImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag := req.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+
+	err := h.dockerService.TagImage(contextName, id, req.Repository+":"+tag)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Image tagged successfully"})
 }
 
 // CreateContainer 从镜像创建容器
 func (h *ImageHandler) CreateContainer(c *gin.Context) {
 	contextName := c.Param("context")
-	var req struct {
-		ImageID string   `json:"imageId"`
-		Name    string   `json:"name"`
-		Command string   `json:"command"`
-		Args    []string `json:"args"`
-		Ports   []struct {
-			Host      uint16 `json:"host"`
-			Container uint16 `json:"container"`
-		} `json:"ports"`
-		Env []struct {
-			Key   string `json:"key"`
-			Value string `json:"value"`
-		} `json:"env"`
-		Volumes []struct {
-			Host      string `json:"host"`
-			Container string `json:"container"`
-			Mode      string `json:"mode"`
-		} `json:"volumes"`
-		RestartPolicy string `json:"restartPolicy"`
-		NetworkMode   string `json:"networkMode"`
-	}
+	var req createContainerRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -124,3 +342,69 @@ func (h *ImageHandler) GetImageDetail(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, detail)
 }
+
+// GetImageHistory 获取镜像分层历史
+func (h *ImageHandler) GetImageHistory(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	history, err := h.dockerService.GetImageHistory(contextName, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// SearchImages 搜索镜像，合并 Docker Hub 与内置镜像仓库的结果
+// 通过 ?term=nginx&limit=25&source=dockerhub|registry 指定搜索条件，source 为空时搜索全部来源
+func (h *ImageHandler) SearchImages(c *gin.Context) {
+	contextName := c.Param("context")
+	term := c.Query("term")
+	if term == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "term is required"})
+		return
+	}
+
+	limit := 25
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + l})
+			return
+		}
+		limit = n
+	}
+	source := c.Query("source")
+
+	results := []service.SearchResult{}
+	errors := map[string]string{}
+
+	if source == "" || source == service.SearchSourceRegistry {
+		if h.registryURL != "" {
+			registryResults, err := service.SearchRegistryCatalog(h.registryURL, term, limit)
+			if err != nil {
+				errors[service.SearchSourceRegistry] = err.Error()
+			} else {
+				results = append(results, registryResults...)
+			}
+		} else if source == service.SearchSourceRegistry {
+			errors[service.SearchSourceRegistry] = "embedded registry is not configured"
+		}
+	}
+
+	if source == "" || source == service.SearchSourceDockerHub {
+		hubResults, err := h.dockerService.SearchImages(contextName, term, limit)
+		if err != nil {
+			errors[service.SearchSourceDockerHub] = err.Error()
+		} else {
+			results = append(results, hubResults...)
+		}
+	}
+
+	// 所有来源均失败时返回错误
+	if len(results) == 0 && len(errors) > 0 {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "search failed", "errors": errors})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results, "errors": errors})
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/service"
+)
+
+// aggregateLogOptionsFromQuery 解析聚合日志的查询参数
+// container 容器 ID 或名称，可重复；label 标签选择器，可重复；tail 每个容器的历史行数；since 起始时间；follow 是否持续跟踪，默认 true
+func aggregateLogOptionsFromQuery(c *gin.Context) (service.AggregateLogOptions, error) {
+	opts := service.AggregateLogOptions{
+		Containers: c.QueryArray("container"),
+		Labels:     c.QueryArray("label"),
+		Tail:       c.Query("tail"),
+		Since:      c.Query("since"),
+		Follow:     true,
+	}
+	if opts.Tail != "" && opts.Tail != "all" {
+		if n, err := strconv.Atoi(opts.Tail); err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid tail %q, expected a non-negative number or all", opts.Tail)
+		}
+	}
+	if follow := c.Query("follow"); follow != "" {
+		v, err := strconv.ParseBool(follow)
+		if err != nil {
+			return opts, fmt.Errorf("invalid follow %q", follow)
+		}
+		opts.Follow = v
+	}
+	return opts, nil
+}
+
+// StreamAggregatedLogs 以 SSE 形式同时推送多个容器的日志
+// 先发送 sources 事件列出容器及其颜色，之后每行日志为一个 log 事件，所有日志流结束后发送 end 事件
+func (h *ContainerHandler) StreamAggregatedLogs(c *gin.Context) {
+	contextName := c.Param("context")
+
+	opts, err := aggregateLogOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sources, err := h.dockerService.ResolveLogSources(contextName, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	lines, err := h.dockerService.AggregateLogs(ctx, contextName, sources, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("sources", sources)
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				c.SSEvent("end", gin.H{"message": "all log streams ended"})
+				return false
+			}
+			c.SSEvent("log", line)
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
+
+// DownloadContainerLogs 以文件形式下载容器的完整日志
+// 支持 since、until 限定时间范围，timestamps=true 时每行带时间戳
+func (h *ContainerHandler) DownloadContainerLogs(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+
+	opts := service.LogReadOptions{
+		Since: c.Query("since"),
+		Until: c.Query("until"),
+	}
+	if timestamps := c.Query("timestamps"); timestamps != "" {
+		v, err := strconv.ParseBool(timestamps)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid timestamps %q", timestamps)})
+			return
+		}
+		opts.Timestamps = v
+	}
+
+	reader, name, err := h.dockerService.OpenContainerLogs(contextName, id, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	filename := fmt.Sprintf("%s-%s.log", name, time.Now().Format("20060102-150405"))
+	c.DataFromReader(http.StatusOK, -1, "text/plain; charset=utf-8", reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", filename),
+	})
+}
+
+// logSearchFromQuery 解析日志搜索参数
+// q 搜索内容；regex=true 时按正则表达式匹配；ignoreCase 忽略大小写；context 上下文行数；limit 最多返回的匹配数
+func logSearchFromQuery(c *gin.Context) (service.LogSearch, error) {
+	search := service.LogSearch{
+		Query: c.Query("q"),
+		Since: c.Query("since"),
+		Until: c.Query("until"),
+	}
+	for name, target := range map[string]*bool{"regex": &search.Regex, "ignoreCase": &search.IgnoreCase} {
+		if v := c.Query(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return search, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*target = b
+		}
+	}
+	for name, target := range map[string]*int{"context": &search.Context, "limit": &search.Limit} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return search, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*target = n
+		}
+	}
+	return search, search.Validate()
+}
+
+// SearchContainerLogs 在服务端搜索容器日志，返回匹配行及其上下文
+func (h *ContainerHandler) SearchContainerLogs(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+
+	search, err := logSearchFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.dockerService.SearchContainerLogs(contextName, id, search)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/service"
+)
+
+type MetricsHandler struct {
+	sampler *service.MetricsSampler
+}
+
+func NewMetricsHandler(sampler *service.MetricsSampler) *MetricsHandler {
+	return &MetricsHandler{
+		sampler: sampler,
+	}
+}
+
+// GetMetrics 获取主机资源使用情况，包括最近的历史采样点
+func (h *MetricsHandler) GetMetrics(c *gin.Context) {
+	metrics, err := h.sampler.Get(c.Param("context"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, metrics)
+}
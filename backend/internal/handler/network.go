@@ -51,3 +51,74 @@ func (h *NetworkHandler) DeleteNetwork(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Network deleted successfully"})
 }
+
+// CreateNetwork 创建网络
+func (h *NetworkHandler) CreateNetwork(c *gin.Context) {
+	contextName := c.Param("context")
+	var config service.NetworkCreateConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, warning, err := h.dockerService.CreateNetwork(contextName, config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Network created successfully", "id": id, "warning": warning})
+}
+
+// ConnectNetwork 将容器接入网络
+func (h *NetworkHandler) ConnectNetwork(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	var config service.NetworkConnectConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.dockerService.ConnectNetwork(contextName, id, config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Container connected successfully"})
+}
+
+type disconnectNetworkRequest struct {
+	Container string `json:"container" binding:"required"`
+	Force     bool   `json:"force"`
+}
+
+// DisconnectNetwork 将容器从网络断开
+func (h *NetworkHandler) DisconnectNetwork(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+	var req disconnectNetworkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.dockerService.DisconnectNetwork(contextName, id, req.Container, req.Force)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Container disconnected successfully"})
+}
+
+// GetNetworkContainers 获取使用该网络的容器，用于删除前提示
+func (h *NetworkHandler) GetNetworkContainers(c *gin.Context) {
+	contextName := c.Param("context")
+	id := c.Param("id")
+
+	containers, err := h.dockerService.NetworkContainers(contextName, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, containers)
+}
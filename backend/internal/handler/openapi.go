@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/audit"
+	"github.com/smartcat999/container-ui/internal/auth"
+	"github.com/smartcat999/container-ui/internal/config"
+	"github.com/smartcat999/container-ui/internal/openapi"
+	"github.com/smartcat999/container-ui/internal/service"
+)
+
+// 接口分组
+const (
+	tagAuth       = "auth"
+	tagContexts   = "contexts"
+	tagContainers = "containers"
+	tagImages     = "images"
+	tagNetworks   = "networks"
+	tagVolumes    = "volumes"
+	tagSystem     = "system"
+	tagSchedules  = "schedules"
+	tagAdmin      = "admin"
+)
+
+// 常用的查询参数
+var (
+	containerFilterParams = []openapi.Param{
+		{Name: "state", Description: "容器状态，例如 running、exited"},
+		{Name: "health", Description: "健康状态，例如 healthy、unhealthy"},
+		{Name: "name", Description: "名称正则表达式"},
+		{Name: "image", Description: "镜像名称"},
+		{Name: "label", Description: "标签过滤，key 或 key=value，可重复"},
+		{Name: "sort", Description: "排序字段：created、name、state、image"},
+		{Name: "order", Description: "asc 或 desc"},
+		{Name: "limit", Type: "integer"},
+		{Name: "offset", Type: "integer"},
+	}
+	contextFilterParams = []openapi.Param{
+		{Name: "group", Description: "context 分组"},
+		{Name: "label", Description: "标签过滤，key 或 key=value，可重复"},
+	}
+	forceParam = []openapi.Param{{Name: "force", Type: "boolean"}}
+)
+
+// APIRoutes 返回 UI API 的接口说明，新增或修改路由时需要同步更新，测试会与实际注册的路由对比
+func APIRoutes() []openapi.Route {
+	const ctx = "/api/contexts/:context"
+	return []openapi.Route{
+		// 文档
+		{Method: http.MethodGet, Path: "/api/openapi.json", Summary: "获取 OpenAPI 文档", Tag: tagSystem, Public: true, Response: map[string]interface{}{}},
+		{Method: http.MethodGet, Path: "/api/docs", Summary: "Swagger UI 页面", Tag: tagSystem, Public: true, ResponseType: "text/html"},
+		{Method: http.MethodGet, Path: "/api/docs/:asset", Summary: "Swagger UI 页面使用的脚本和样式", Tag: tagSystem, Public: true, ResponseType: openapi.ContentOctetStream},
+
+		// 认证
+		{Method: http.MethodGet, Path: "/api/auth/providers", Summary: "获取可用的登录方式", Tag: tagAuth, Public: true, Response: map[string]bool{}},
+		{Method: http.MethodPost, Path: "/api/auth/login", Summary: "用户名密码登录", Tag: tagAuth, Public: true, Request: loginRequest{}, Response: auth.TokenPair{}},
+		{Method: http.MethodPost, Path: "/api/auth/refresh", Summary: "刷新 token", Tag: tagAuth, Public: true, Request: refreshRequest{}, Response: auth.TokenPair{}},
+		{Method: http.MethodPost, Path: "/api/auth/logout", Summary: "注销 refresh token", Tag: tagAuth, Public: true, Request: refreshRequest{}},
+		{Method: http.MethodGet, Path: "/api/auth/oidc/login", Summary: "跳转到 OIDC 身份提供方登录", Tag: tagAuth, Public: true, ResponseType: openapi.ContentText},
+		{Method: http.MethodGet, Path: "/api/auth/oidc/callback", Summary: "OIDC 登录回调", Tag: tagAuth, Public: true, ResponseType: openapi.ContentText,
+			Query: []openapi.Param{{Name: "code"}, {Name: "state"}, {Name: "error"}, {Name: "error_description"}}},
+		{Method: http.MethodGet, Path: "/api/registry/token", Summary: "签发内置镜像仓库的访问令牌 (docker login 使用 Basic 认证)", Tag: tagAuth, Public: true, Response: auth.RegistryTokenResponse{},
+			Query: []openapi.Param{{Name: "service"}, {Name: "scope"}, {Name: "account"}}},
+		{Method: http.MethodGet, Path: "/api/auth/me", Summary: "获取当前用户", Tag: tagAuth, Response: map[string]string{}},
+		{Method: http.MethodPut, Path: "/api/auth/password", Summary: "修改当前用户密码", Tag: tagAuth, Request: changePasswordRequest{}},
+		{Method: http.MethodGet, Path: "/api/users", Summary: "获取用户列表", Tag: tagAdmin, Response: []auth.UserInfo{}},
+		{Method: http.MethodPost, Path: "/api/users", Summary: "创建用户", Tag: tagAdmin, Request: createUserRequest{}},
+		{Method: http.MethodDelete, Path: "/api/users/:username", Summary: "删除用户", Tag: tagAdmin},
+		{Method: http.MethodGet, Path: "/api/registry/acls", Summary: "获取内置镜像仓库的访问控制", Tag: tagAdmin, Response: []config.RepositoryACL{}},
+		{Method: http.MethodPut, Path: "/api/registry/acls", Summary: "添加或更新仓库访问控制", Tag: tagAdmin, Request: config.RepositoryACL{}, Response: config.RepositoryACL{}},
+		{Method: http.MethodDelete, Path: "/api/registry/acls", Summary: "删除仓库访问控制", Tag: tagAdmin, Query: []openapi.Param{{Name: "repository", Required: true}}},
+		{Method: http.MethodGet, Path: "/api/tokens", Summary: "获取访问令牌列表", Tag: tagAuth, Query: []openapi.Param{{Name: "all", Type: "boolean", Description: "管理员查看所有用户的令牌"}}, Response: []auth.APITokenInfo{}},
+		{Method: http.MethodPost, Path: "/api/tokens", Summary: "创建访问令牌", Tag: tagAuth, Request: createTokenRequest{}, Response: auth.CreatedAPIToken{}},
+		{Method: http.MethodDelete, Path: "/api/tokens/:id", Summary: "删除访问令牌", Tag: tagAuth},
+		{Method: http.MethodGet, Path: "/api/audit", Summary: "查询审计日志", Tag: tagAdmin, Paged: true, Response: []audit.Entry{},
+			Query: []openapi.Param{{Name: "user"}, {Name: "context"}, {Name: "resource"}, {Name: "action"}, {Name: "result", Description: "success 或 failure"},
+				{Name: "since", Description: "RFC3339 时间"}, {Name: "until", Description: "RFC3339 时间"}, {Name: "limit", Type: "integer"}, {Name: "offset", Type: "integer"}}},
+
+		// context
+		{Method: http.MethodGet, Path: "/api/contexts", Summary: "获取 context 列表", Tag: tagContexts, Query: contextFilterParams, Response: []service.ContextConfig{}},
+		{Method: http.MethodPost, Path: "/api/contexts", Summary: "创建或覆盖同名 context，启用认证时需要管理员", Tag: tagContexts, Request: service.ContextConfig{}},
+		{Method: http.MethodPost, Path: "/api/contexts/import", Summary: "从 docker CLI 配置目录或上传的 tar 导入 context，启用认证时需要管理员", Tag: tagContexts, RequestType: openapi.ContentUpload,
+			Query: []openapi.Param{{Name: "name", Description: "只导入指定的 context，可重复"}, {Name: "overwrite", Type: "boolean"}}, Response: service.ContextImportResult{}},
+		{Method: http.MethodGet, Path: "/api/contexts/export", Summary: "导出为 docker CLI 格式的 tar (包含 TLS 私钥)，启用认证时需要管理员", Tag: tagContexts, ResponseType: openapi.ContentTar,
+			Query: []openapi.Param{{Name: "name", Description: "只导出指定的 context，可重复"}}},
+		{Method: http.MethodGet, Path: "/api/contexts/discovered", Summary: "获取探测到的本机 Docker socket", Tag: tagContexts,
+			Query: []openapi.Param{{Name: "refresh", Type: "boolean"}}, Response: []service.DiscoveredContext{}},
+		{Method: http.MethodGet, Path: "/api/contexts/:context", Summary: "获取 context 地址", Tag: tagContexts, Response: map[string]string{}},
+		{Method: http.MethodPut, Path: "/api/contexts/:context", Summary: "更新 context，启用认证时需要管理员", Tag: tagContexts, Request: service.ContextConfig{}},
+		{Method: http.MethodDelete, Path: "/api/contexts/:context", Summary: "删除 context，启用认证时需要管理员", Tag: tagContexts},
+		{Method: http.MethodGet, Path: ctx + "/info", Summary: "获取 Docker 服务器信息", Tag: tagContexts, Response: types.Info{}},
+		{Method: http.MethodGet, Path: ctx + "/metrics", Summary: "获取主机资源使用情况", Tag: tagContexts, Response: service.HostMetrics{}},
+		{Method: http.MethodGet, Path: "/api/overview", Summary: "获取所有 context 的概览", Tag: tagContexts,
+			Query: append([]openapi.Param{{Name: "timeout", Description: "每个 context 的超时时间，例如 5s"}}, contextFilterParams...), Response: []service.ContextOverview{}},
+		{Method: http.MethodPost, Path: "/api/groups/:group/containers/batch", Summary: "对分组内所有 context 的容器执行批量操作", Tag: tagContexts,
+			Request: service.GroupBatchRequest{}, Response: []service.GroupBatchResult{}},
+
+		// 定时任务
+		{Method: http.MethodGet, Path: "/api/schedules", Summary: "获取定时任务列表", Tag: tagSchedules, Response: []service.Schedule{}},
+		{Method: http.MethodPost, Path: "/api/schedules", Summary: "创建定时任务", Tag: tagSchedules, Request: service.Schedule{}, Response: service.Schedule{}},
+		{Method: http.MethodGet, Path: "/api/schedules/:id", Summary: "获取定时任务详情", Tag: tagSchedules, Response: service.Schedule{}},
+		{Method: http.MethodPut, Path: "/api/schedules/:id", Summary: "更新定时任务", Tag: tagSchedules, Request: service.Schedule{}, Response: service.Schedule{}},
+		{Method: http.MethodDelete, Path: "/api/schedules/:id", Summary: "删除定时任务", Tag: tagSchedules},
+		{Method: http.MethodPost, Path: "/api/schedules/:id/run", Summary: "立即执行定时任务", Tag: tagSchedules, Response: service.ScheduleRun{}},
+		{Method: http.MethodGet, Path: "/api/schedules/:id/history", Summary: "获取定时任务执行记录", Tag: tagSchedules, Response: []service.ScheduleRun{}},
+
+		// 容器
+		{Method: http.MethodGet, Path: ctx + "/containers", Summary: "获取容器列表", Tag: tagContainers, Query: containerFilterParams, Paged: true, Response: []service.ContainerInfo{}},
+		{Method: http.MethodPost, Path: ctx + "/containers", Summary: "从镜像创建容器", Tag: tagContainers, Request: createContainerRequest{}},
+		{Method: http.MethodPost, Path: ctx + "/containers/batch", Summary: "批量操作容器", Tag: tagContainers, Request: service.BatchRequest{}, Response: []service.BatchResult{}},
+		{Method: http.MethodPost, Path: ctx + "/containers/:id/start", Summary: "启动容器", Tag: tagContainers},
+		{Method: http.MethodPost, Path: ctx + "/containers/:id/stop", Summary: "停止容器", Tag: tagContainers},
+		{Method: http.MethodPost, Path: ctx + "/containers/:id/pause", Summary: "暂停容器", Tag: tagContainers},
+		{Method: http.MethodPost, Path: ctx + "/containers/:id/unpause", Summary: "恢复容器", Tag: tagContainers},
+		{Method: http.MethodPost, Path: ctx + "/containers/:id/restart", Summary: "重启容器", Tag: tagContainers, Query: []openapi.Param{{Name: "timeout", Type: "integer", Description: "等待停止的秒数"}}},
+		{Method: http.MethodPost, Path: ctx + "/containers/:id/kill", Summary: "向容器发送信号", Tag: tagContainers, Query: []openapi.Param{{Name: "signal", Description: "默认 SIGKILL"}}},
+		{Method: http.MethodPost, Path: ctx + "/containers/:id/rename", Summary: "重命名容器", Tag: tagContainers, Request: renameContainerRequest{}},
+		{Method: http.MethodPost, Path: ctx + "/containers/:id/update", Summary: "调整容器资源限制和重启策略", Tag: tagContainers, Request: service.ContainerUpdateConfig{}},
+		{Method: http.MethodPost, Path: ctx + "/containers/:id/commit", Summary: "将容器提交为镜像", Tag: tagContainers, Request: service.CommitConfig{}},
+		{Method: http.MethodPost, Path: ctx + "/containers/:id/healthcheck", Summary: "立即执行健康检查", Tag: tagContainers, Response: service.HealthCheckResult{}},
+		{Method: http.MethodPost, Path: ctx + "/containers/:id/recreate", Summary: "使用新镜像重建容器", Tag: tagContainers, Request: service.RecreateOptions{}},
+		{Method: http.MethodGet, Path: ctx + "/containers/:id/export", Summary: "导出容器文件系统", Tag: tagContainers, ResponseType: openapi.ContentTar},
+		{Method: http.MethodDelete, Path: ctx + "/containers/:id", Summary: "删除容器", Tag: tagContainers, Query: forceParam},
+		{Method: http.MethodGet, Path: ctx + "/containers/:id/json", Summary: "获取容器详情", Tag: tagContainers, Response: types.ContainerJSON{}},
+		{Method: http.MethodGet, Path: ctx + "/containers/:id/logs", Summary: "获取容器日志", Tag: tagContainers, ResponseType: openapi.ContentText},
+		{Method: http.MethodGet, Path: ctx + "/containers/:id/logs/download", Summary: "下载容器的完整日志", Tag: tagContainers, ResponseType: openapi.ContentText,
+			Query: []openapi.Param{
+				{Name: "since", Description: "起始时间，RFC3339、Unix 时间戳或 10m 这样的相对时间"},
+				{Name: "until", Description: "结束时间，格式同 since"},
+				{Name: "timestamps", Type: "boolean", Description: "每行是否带时间戳"},
+			}},
+		{Method: http.MethodGet, Path: ctx + "/containers/:id/logs/search", Summary: "搜索容器日志", Tag: tagContainers, Response: service.LogSearchResult{},
+			Query: []openapi.Param{
+				{Name: "q", Required: true, Description: "搜索内容"},
+				{Name: "regex", Type: "boolean", Description: "按正则表达式匹配"},
+				{Name: "ignoreCase", Type: "boolean", Description: "忽略大小写"},
+				{Name: "since", Description: "起始时间"},
+				{Name: "until", Description: "结束时间"},
+				{Name: "context", Type: "integer", Description: "匹配行前后附带的行数，最多 20"},
+				{Name: "limit", Type: "integer", Description: "最多返回的匹配数，默认 200，最多 1000"},
+			}},
+		{Method: http.MethodGet, Path: ctx + "/containers/:id/exec", Summary: "在容器中执行命令 (WebSocket)", Tag: tagContainers, ResponseType: openapi.ContentText,
+			Query: []openapi.Param{
+				{Name: "cmd", Description: "命令及参数，可重复，未指定时启动 shell"},
+				{Name: "shell", Description: "依次尝试的 shell，可重复，默认 /bin/bash、/bin/sh"},
+				{Name: "user", Description: "执行用户，例如 root 或 1000:1000"},
+				{Name: "workdir", Description: "工作目录"},
+				{Name: "env", Description: "环境变量 KEY=VALUE，可重复"},
+				{Name: "tty", Type: "boolean", Description: "是否分配终端，默认 true"},
+				{Name: "session", Description: "重新连接到连接断开后仍保留的会话"},
+			}},
+		{Method: http.MethodGet, Path: ctx + "/containers/:id/archive", Summary: "下载容器中的文件或目录", Tag: tagContainers, ResponseType: openapi.ContentTar,
+			Query: []openapi.Param{{Name: "path", Required: true}}},
+		{Method: http.MethodPut, Path: ctx + "/containers/:id/archive", Summary: "上传文件到容器", Tag: tagContainers, RequestType: openapi.ContentUpload,
+			Query: []openapi.Param{{Name: "path", Required: true}, {Name: "overwrite", Type: "boolean"}}},
+		{Method: http.MethodGet, Path: ctx + "/containers/:id/fs", Summary: "浏览容器目录，目录过大时只返回部分子项并设置 X-Listing-Truncated 响应头", Tag: tagContainers, Query: []openapi.Param{{Name: "path"}}, Response: []service.FileEntry{}},
+		{Method: http.MethodGet, Path: ctx + "/containers/:id/fs/content", Summary: "读取容器中的文件", Tag: tagContainers, ResponseType: openapi.ContentOctetStream,
+			Query: []openapi.Param{{Name: "path", Required: true}, {Name: "download", Type: "boolean"}}},
+
+		// 镜像
+		{Method: http.MethodGet, Path: ctx + "/images", Summary: "获取镜像列表", Tag: tagImages, Response: []service.ImageInfo{}},
+		{Method: http.MethodGet, Path: ctx + "/images/search", Summary: "搜索镜像", Tag: tagImages,
+			Query: []openapi.Param{{Name: "term", Required: true}, {Name: "limit", Type: "integer"}, {Name: "source", Description: "hub、registry 或为空表示全部"}}},
+		{Method: http.MethodPost, Path: ctx + "/images/pull", Summary: "拉取镜像，流式返回进度", Tag: tagImages, Request: pullImageRequest{}, ResponseType: contentNDJSON},
+		{Method: http.MethodPost, Path: ctx + "/images/import", Summary: "从 tar 导入镜像", Tag: tagImages, RequestType: openapi.ContentUpload, ResponseType: contentNDJSON,
+			Query: []openapi.Param{{Name: "repository"}, {Name: "tag"}, {Name: "message"}, {Name: "changes", Description: "Dockerfile 指令，可重复"}}},
+		{Method: http.MethodPost, Path: ctx + "/images/load", Summary: "加载 docker save 导出的镜像", Tag: tagImages, RequestType: openapi.ContentUpload, ResponseType: contentNDJSON},
+		{Method: http.MethodGet, Path: ctx + "/images/:id/save", Summary: "导出镜像", Tag: tagImages, ResponseType: openapi.ContentTar,
+			Query: []openapi.Param{{Name: "image", Description: "同时导出的其他镜像，可重复"}}},
+		{Method: http.MethodDelete, Path: ctx + "/images/:id", Summary: "删除镜像", Tag: tagImages, Query: append([]openapi.Param{{Name: "tag", Description: "只删除指定标签"}}, forceParam...)},
+		{Method: http.MethodGet, Path: ctx + "/images/:id/json", Summary: "获取镜像详情", Tag: tagImages, Response: types.ImageInspect{}},
+		{Method: http.MethodGet, Path: ctx + "/images/:id/history", Summary: "获取镜像构建历史", Tag: tagImages, Response: []service.ImageLayer{}},
+		{Method: http.MethodPost, Path: ctx + "/images/:id/push", Summary: "推送镜像，流式返回进度", Tag: tagImages, Request: pushImageRequest{}, ResponseType: contentNDJSON},
+		{Method: http.MethodPost, Path: ctx + "/images/:id/tag", Summary: "为镜像添加标签", Tag: tagImages, Request: tagImageRequest{}},
+		{Method: http.MethodPost, Path: ctx + "/build", Summary: "构建镜像，流式返回构建输出", Tag: tagImages, Request: service.BuildOptions{}, ResponseType: contentNDJSON},
+
+		// 网络
+		{Method: http.MethodGet, Path: ctx + "/networks", Summary: "获取网络列表", Tag: tagNetworks, Response: []service.NetworkInfo{}},
+		{Method: http.MethodPost, Path: ctx + "/networks", Summary: "创建网络", Tag: tagNetworks, Request: service.NetworkCreateConfig{}},
+		{Method: http.MethodGet, Path: ctx + "/networks/:id", Summary: "获取网络详情", Tag: tagNetworks, Response: types.NetworkResource{}},
+		{Method: http.MethodDelete, Path: ctx + "/networks/:id", Summary: "删除网络", Tag: tagNetworks},
+		{Method: http.MethodPost, Path: ctx + "/networks/:id/connect", Summary: "将容器连接到网络", Tag: tagNetworks, Request: service.NetworkConnectConfig{}},
+		{Method: http.MethodPost, Path: ctx + "/networks/:id/disconnect", Summary: "将容器从网络断开", Tag: tagNetworks, Request: disconnectNetworkRequest{}},
+		{Method: http.MethodGet, Path: ctx + "/networks/:id/containers", Summary: "获取连接到网络的容器", Tag: tagNetworks, Response: []service.ContainerInfo{}},
+
+		// 数据卷
+		{Method: http.MethodGet, Path: ctx + "/volumes", Summary: "获取数据卷列表", Tag: tagVolumes, Response: []service.VolumeInfo{}},
+		{Method: http.MethodPost, Path: ctx + "/volumes", Summary: "创建数据卷", Tag: tagVolumes, Request: service.VolumeCreateConfig{}, Response: volume.Volume{}},
+		{Method: http.MethodGet, Path: ctx + "/volumes/:name", Summary: "获取数据卷详情", Tag: tagVolumes, Response: volume.Volume{}},
+		{Method: http.MethodDelete, Path: ctx + "/volumes/:name", Summary: "删除数据卷", Tag: tagVolumes},
+		{Method: http.MethodGet, Path: ctx + "/volumes/:name/browse", Summary: "浏览数据卷目录，目录过大时只返回部分子项并设置 X-Listing-Truncated 响应头", Tag: tagVolumes, Query: []openapi.Param{{Name: "path"}}, Response: []service.FileEntry{}},
+		{Method: http.MethodGet, Path: ctx + "/volumes/:name/backup", Summary: "备份数据卷为 tar", Tag: tagVolumes, ResponseType: openapi.ContentTar},
+		{Method: http.MethodPost, Path: ctx + "/volumes/:name/restore", Summary: "从 tar 恢复数据卷", Tag: tagVolumes, RequestType: openapi.ContentUpload},
+		{Method: http.MethodGet, Path: ctx + "/volumes/:name/containers", Summary: "获取使用数据卷的容器", Tag: tagVolumes, Response: []service.ContainerInfo{}},
+
+		// 资源清理和事件
+		{Method: http.MethodPost, Path: ctx + "/prune", Summary: "批量清理多类资源", Tag: tagSystem, Request: service.PruneOptions{}},
+		{Method: http.MethodPost, Path: ctx + "/containers/prune", Summary: "清理已停止的容器", Tag: tagSystem, Request: service.PruneOptions{}, Response: service.PruneReport{}},
+		{Method: http.MethodPost, Path: ctx + "/images/prune", Summary: "清理无用镜像", Tag: tagSystem, Request: service.PruneOptions{}, Response: service.PruneReport{}},
+		{Method: http.MethodPost, Path: ctx + "/volumes/prune", Summary: "清理未使用的数据卷", Tag: tagSystem, Request: service.PruneOptions{}, Response: service.PruneReport{}},
+		{Method: http.MethodPost, Path: ctx + "/networks/prune", Summary: "清理未使用的网络", Tag: tagSystem, Request: service.PruneOptions{}, Response: service.PruneReport{}},
+		{Method: http.MethodPost, Path: ctx + "/buildcache/prune", Summary: "清理构建缓存", Tag: tagSystem, Request: service.PruneOptions{}, Response: service.PruneReport{}},
+		{Method: http.MethodGet, Path: ctx + "/events", Summary: "订阅 Docker 事件 (SSE)", Tag: tagSystem, ResponseType: openapi.ContentEventStream,
+			Query: []openapi.Param{{Name: "filter", Description: "事件过滤，key=value，可重复"}}},
+		{Method: http.MethodGet, Path: ctx + "/logs", Summary: "同时跟踪多个容器的日志 (SSE)", Tag: tagContainers, ResponseType: openapi.ContentEventStream,
+			Query: []openapi.Param{
+				{Name: "container", Description: "容器 ID 或名称，可重复"},
+				{Name: "label", Description: "标签选择器，key 或 key=value，可重复"},
+				{Name: "tail", Description: "每个容器先输出的历史行数，默认 100，all 表示全部"},
+				{Name: "since", Description: "起始时间，RFC3339、Unix 时间戳或 10m 这样的相对时间"},
+				{Name: "follow", Type: "boolean", Description: "是否持续跟踪新的日志，默认 true"},
+			}},
+	}
+}
+
+// contentNDJSON 拉取、推送、构建等接口以 NDJSON 流式返回进度
+const contentNDJSON = "application/x-ndjson"
+
+type OpenAPIHandler struct {
+	spec []byte
+	docs http.Handler
+}
+
+// NewOpenAPIHandler 生成 UI API 文档，authEnabled 决定是否声明 Bearer 认证
+func NewOpenAPIHandler(authEnabled bool) (*OpenAPIHandler, error) {
+	doc := openapi.Build(openapi.Info{
+		Title:       "Container UI API",
+		Description: "容器管理界面后端接口",
+		Version:     "1.0.0",
+	}, APIRoutes(), authEnabled)
+
+	spec, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAPIHandler{
+		spec: spec,
+		docs: openapi.SwaggerUI("Container UI API", "/api/openapi.json"),
+	}, nil
+}
+
+// GetSpec 返回 OpenAPI 文档
+func (h *OpenAPIHandler) GetSpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", h.spec)
+}
+
+// GetDocs 返回 Swagger UI 页面
+func (h *OpenAPIHandler) GetDocs(c *gin.Context) {
+	h.docs.ServeHTTP(c.Writer, c.Request)
+}
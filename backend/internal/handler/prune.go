@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/service"
+)
+
+type PruneHandler struct {
+	dockerService *service.DockerService
+}
+
+func NewPruneHandler(dockerService *service.DockerService) *PruneHandler {
+	return &PruneHandler{
+		dockerService: dockerService,
+	}
+}
+
+// bindPruneOptions 解析清理选项，请求体可为空
+func bindPruneOptions(c *gin.Context) (service.PruneOptions, error) {
+	var opts service.PruneOptions
+	if c.Request.ContentLength == 0 {
+		return opts, nil
+	}
+	err := c.ShouldBindJSON(&opts)
+	return opts, err
+}
+
+// Prune 批量清理多类资源
+func (h *PruneHandler) Prune(c *gin.Context) {
+	contextName := c.Param("context")
+	opts, err := bindPruneOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reports, total, err := h.dockerService.Prune(contextName, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reports": reports, "spaceReclaimed": total})
+}
+
+// pruneResource 返回清理指定资源类型的处理函数
+func (h *PruneHandler) pruneResource(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contextName := c.Param("context")
+		opts, err := bindPruneOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		report, err := h.dockerService.PruneResource(contextName, resource, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// PruneContainers 清理已停止的容器
+func (h *PruneHandler) PruneContainers(c *gin.Context) {
+	h.pruneResource(service.PruneContainers)(c)
+}
+
+// PruneImages 清理悬空或未使用的镜像
+func (h *PruneHandler) PruneImages(c *gin.Context) {
+	h.pruneResource(service.PruneImages)(c)
+}
+
+// PruneVolumes 清理未使用的数据卷
+func (h *PruneHandler) PruneVolumes(c *gin.Context) {
+	h.pruneResource(service.PruneVolumes)(c)
+}
+
+// PruneNetworks 清理未使用的网络
+func (h *PruneHandler) PruneNetworks(c *gin.Context) {
+	h.pruneResource(service.PruneNetworks)(c)
+}
+
+// PruneBuildCache 清理构建缓存
+func (h *PruneHandler) PruneBuildCache(c *gin.Context) {
+	h.pruneResource(service.PruneBuildCache)(c)
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/ratelimit"
+)
+
+// uploadRouteSuffixes 接收文件上传的路由，请求体上限单独配置
+var uploadRouteSuffixes = []string{
+	"/images/load",
+	"/images/import",
+	"/volumes/:name/restore",
+	"/containers/:id/archive",
+	"/contexts/import",
+	"/build",
+}
+
+// RateLimitByIP 按客户端 IP 限流，需要在认证之前注册以保护登录接口
+func RateLimitByIP(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ok, wait := limiter.Allow(c.ClientIP()); !ok {
+			abortTooManyRequests(c, wait.String(), ratelimit.RetryAfter(wait))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimitByToken 按认证后的访问令牌或用户限流，需要在认证之后注册
+func RateLimitByToken(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "user:" + c.GetString(authUserKey)
+		if token := c.GetString(authTokenKey); token != "" {
+			key = "token:" + token
+		}
+		if ok, wait := limiter.Allow(key); !ok {
+			abortTooManyRequests(c, wait.String(), ratelimit.RetryAfter(wait))
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortTooManyRequests(c *gin.Context, wait, retryAfter string) {
+	c.Header("Retry-After", retryAfter)
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded, retry in " + wait})
+}
+
+// BodyLimit 限制请求体大小，上传路由使用 maxUpload，0 表示不限制
+// 声明了 Content-Length 的超限请求直接返回 413，分块传输的请求在读取超限时报错
+func BodyLimit(maxBody, maxUpload int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := maxBody
+		if isUploadRequest(c) {
+			limit = maxUpload
+		}
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+func isUploadRequest(c *gin.Context) bool {
+	path := c.FullPath()
+	for _, suffix := range uploadRouteSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
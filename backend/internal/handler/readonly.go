@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/service"
+)
+
+// ReadOnlyGuard 拒绝只读 context 上的修改请求，查询请求不受影响
+// 有副作用的 GET 请求 (例如 exec、创建辅助容器的卷浏览和备份) 通过 Mutating 标记，同样视为修改操作
+func ReadOnlyGuard(dockerService *service.DockerService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isMutatingRequest(c) {
+			c.Next()
+			return
+		}
+
+		if err := dockerService.CheckWritable(c.Param("context")); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Mutating 标记有副作用的查询路由，放在路由的处理函数之前，
+// 只读 context、查看者权限和审计日志按修改操作处理这些请求
+func Mutating() gin.HandlerFunc {
+	return mutatingRoute
+}
+
+// mutatingRoute 路由标记本身不做处理，路由组的中间件通过处理函数名称识别
+func mutatingRoute(c *gin.Context) {
+	c.Next()
+}
+
+// mutatingRouteName 与 gin.Context.HandlerNames 返回的名称格式一致
+var mutatingRouteName = runtime.FuncForPC(reflect.ValueOf(mutatingRoute).Pointer()).Name()
+
+func isMutatingRequest(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return slices.Contains(c.HandlerNames(), mutatingRouteName)
+	}
+	return true
+}
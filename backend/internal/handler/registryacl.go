@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+// RegistryACLHandler 管理内置镜像仓库的访问控制
+type RegistryACLHandler struct {
+	acls config.ACLStore
+}
+
+func NewRegistryACLHandler(acls config.ACLStore) *RegistryACLHandler {
+	return &RegistryACLHandler{
+		acls: acls,
+	}
+}
+
+// ListACLs 获取所有仓库访问控制
+func (h *RegistryACLHandler) ListACLs(c *gin.Context) {
+	acls, err := h.acls.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, acls)
+}
+
+// PutACL 添加或更新仓库访问控制，仓库名可能包含斜杠，因此放在请求体中
+func (h *RegistryACLHandler) PutACL(c *gin.Context) {
+	var acl config.RepositoryACL
+	if err := c.ShouldBindJSON(&acl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := acl.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.acls.Put(acl); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, acl)
+}
+
+// DeleteACL 删除仓库访问控制，仓库名通过 repository 查询参数指定
+func (h *RegistryACLHandler) DeleteACL(c *gin.Context) {
+	removed, err := h.acls.Remove(c.Query("repository"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "acl not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ACL deleted successfully"})
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/service"
+)
+
+type ScheduleHandler struct {
+	scheduler *service.Scheduler
+}
+
+func NewScheduleHandler(scheduler *service.Scheduler) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduler: scheduler,
+	}
+}
+
+// ListSchedules 获取定时任务列表
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	c.JSON(http.StatusOK, h.scheduler.List())
+}
+
+// GetSchedule 获取定时任务详情
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	schedule, ok := h.scheduler.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// CreateSchedule 创建定时任务
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	var schedule service.Schedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := schedule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.scheduler.Create(schedule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, created)
+}
+
+// UpdateSchedule 更新定时任务
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.scheduler.Get(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+		return
+	}
+
+	var schedule service.Schedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := schedule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.scheduler.Update(id, schedule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteSchedule 删除定时任务
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.scheduler.Get(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+		return
+	}
+
+	if err := h.scheduler.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted successfully"})
+}
+
+// RunSchedule 立即执行一次定时任务，返回执行结果
+func (h *ScheduleHandler) RunSchedule(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.scheduler.Get(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+		return
+	}
+
+	run, err := h.scheduler.Run(id)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+// GetScheduleHistory 获取定时任务的执行记录
+func (h *ScheduleHandler) GetScheduleHistory(c *gin.Context) {
+	history, err := h.scheduler.History(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/smartcat999/container-ui/internal/service"
+)
+
+const (
+	// execDetachTimeout WebSocket 断开后保留终端会话的时间，超时后结束会话
+	execDetachTimeout = time.Minute
+	// execScrollback 每个会话保留的最近输出字节数，重新连接时回放给客户端
+	execScrollback = 64 * 1024
+	// closeSessionTakenOver 同一会话被新的连接接管时发送给旧连接的关闭码
+	closeSessionTakenOver = 4001
+)
+
+// errExecSessionNotFound 会话不存在、已结束或不属于当前用户
+var errExecSessionNotFound = errors.New("exec session not found or already exited")
+
+// ExecSessions 记录正在进行的终端会话
+// 会话与 WebSocket 连接分离：连接断开后会话继续保留一段时间，客户端可以凭会话 ID 重新连接
+// http.Server.Shutdown 不会等待或关闭被劫持的连接，关闭服务时也需要由这里主动通知客户端
+type ExecSessions struct {
+	mu            sync.Mutex
+	conns         map[*websocket.Conn]struct{}
+	execs         map[string]*execSession
+	closing       bool
+	drained       chan struct{}
+	detachTimeout time.Duration
+}
+
+// NewExecSessions 创建会话记录
+func NewExecSessions() *ExecSessions {
+	return &ExecSessions{
+		conns:         make(map[*websocket.Conn]struct{}),
+		execs:         make(map[string]*execSession),
+		detachTimeout: execDetachTimeout,
+	}
+}
+
+// execSession 一个 docker exec 实例及其当前连接的 WebSocket
+type execSession struct {
+	id          string
+	contextName string
+	containerID string
+	owner       string
+	conn        io.ReadWriteCloser
+
+	mu         sync.Mutex
+	ws         *websocket.Conn
+	scrollback []byte
+	exited     bool
+	expire     *time.Timer
+}
+
+// Write 实现 io.Writer，保存输出并转发给当前连接
+func (e *execSession) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.scrollback = append(e.scrollback, p...)
+	if over := len(e.scrollback) - execScrollback; over > 0 {
+		e.scrollback = append(e.scrollback[:0], e.scrollback[over:]...)
+	}
+	if e.ws != nil {
+		e.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := e.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+			// 连接已失效，等待读取端检测到后分离
+			e.ws.Close()
+			e.ws = nil
+		}
+	}
+	return len(p), nil
+}
+
+// add 登记新的连接，服务正在关闭时返回 false
+func (s *ExecSessions) add(ws *websocket.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[ws] = struct{}{}
+	return true
+}
+
+// remove 连接结束后移除登记
+func (s *ExecSessions) remove(ws *websocket.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, ws)
+	if s.closing && len(s.conns) == 0 && s.drained != nil {
+		close(s.drained)
+		s.drained = nil
+	}
+}
+
+// Len 返回当前的连接数
+func (s *ExecSessions) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// start 登记新的 exec 会话并开始转发输出，tty 为 false 时输出为多路复用流
+func (s *ExecSessions) start(e *execSession, tty bool) {
+	s.mu.Lock()
+	s.execs[e.id] = e
+	s.mu.Unlock()
+
+	go func() {
+		if tty {
+			io.Copy(e, e.conn)
+		} else {
+			service.DemuxStream(e, e, e.conn)
+		}
+		e.conn.Close()
+
+		s.mu.Lock()
+		delete(s.execs, e.id)
+		s.mu.Unlock()
+
+		e.mu.Lock()
+		e.exited = true
+		if e.expire != nil {
+			e.expire.Stop()
+		}
+		if e.ws != nil {
+			e.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "process exited"),
+				time.Now().Add(time.Second))
+		}
+		e.mu.Unlock()
+	}()
+}
+
+// resume 查找可以重新连接的会话，会话必须属于同一用户、context 和容器
+func (s *ExecSessions) resume(id, contextName, containerID, owner string) (*execSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.execs[id]
+	if !ok || e.contextName != contextName || e.containerID != containerID || e.owner != owner {
+		return nil, errExecSessionNotFound
+	}
+	return e, nil
+}
+
+// attach 将连接绑定到会话并回放最近的输出，已有的连接会被关闭
+func (s *ExecSessions) attach(e *execSession, ws *websocket.Conn) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.exited {
+		return errExecSessionNotFound
+	}
+	if e.expire != nil {
+		e.expire.Stop()
+		e.expire = nil
+	}
+	if e.ws != nil {
+		e.ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(closeSessionTakenOver, "session attached elsewhere"),
+			time.Now().Add(time.Second))
+		e.ws.Close()
+	}
+	if len(e.scrollback) > 0 {
+		if err := ws.WriteMessage(websocket.BinaryMessage, e.scrollback); err != nil {
+			return err
+		}
+	}
+	e.ws = ws
+	return nil
+}
+
+// detach 连接断开后解除绑定，超过 detachTimeout 没有重新连接时结束会话
+func (s *ExecSessions) detach(e *execSession, ws *websocket.Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ws != ws && e.ws != nil {
+		return
+	}
+	e.ws = nil
+	if !e.exited && e.expire == nil {
+		e.expire = time.AfterFunc(s.detachTimeout, func() {
+			e.conn.Close()
+		})
+	}
+}
+
+// CloseAll 拒绝新的连接，向所有连接发送 going away 关闭帧，等待连接退出后结束所有会话
+// ctx 结束时仍未退出的连接会被强制关闭
+func (s *ExecSessions) CloseAll(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	conns := make([]*websocket.Conn, 0, len(s.conns))
+	for ws := range s.conns {
+		conns = append(conns, ws)
+	}
+	var drained chan struct{}
+	if len(conns) > 0 {
+		drained = make(chan struct{})
+		s.drained = drained
+	}
+	s.mu.Unlock()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down")
+	for _, ws := range conns {
+		ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	}
+
+	var err error
+	if drained != nil {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			for _, ws := range conns {
+				ws.Close()
+			}
+			err = ctx.Err()
+		}
+	}
+
+	// 断开的会话不会再有客户端重新连接，直接结束
+	s.mu.Lock()
+	for _, e := range s.execs {
+		e.conn.Close()
+	}
+	s.mu.Unlock()
+	return err
+}
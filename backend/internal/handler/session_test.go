@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestExecSessionsCloseAll(t *testing.T) {
+	sessions := NewExecSessions()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		if !sessions.add(ws) {
+			return
+		}
+		defer sessions.remove(ws)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for sessions.Len() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 客户端读取到关闭帧后会自动回复，服务端随之退出
+	go func() {
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+					t.Errorf("expected going away close, got %v", err)
+				}
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sessions.CloseAll(ctx); err != nil {
+		t.Fatalf("sessions did not drain: %v", err)
+	}
+	if sessions.Len() != 0 {
+		t.Fatalf("expected no sessions, got %d", sessions.Len())
+	}
+
+	// 关闭后不再接受新会话
+	if sessions.add(&websocket.Conn{}) {
+		t.Fatal("expected new sessions to be rejected while closing")
+	}
+}
+
+func TestExecSessionsResume(t *testing.T) {
+	sessions := NewExecSessions()
+	local, remote := net.Pipe()
+	defer remote.Close()
+	session := &execSession{id: "exec1", contextName: "local", containerID: "c1", owner: "alice", conn: local}
+	sessions.start(session, true)
+
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		e, err := sessions.resume("exec1", "local", "c1", "alice")
+		if err != nil || sessions.attach(e, ws) != nil {
+			return
+		}
+		defer sessions.detach(e, ws)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	read := func(ws *websocket.Conn) string {
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, p, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(p)
+	}
+
+	attached := func() bool {
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		return session.ws != nil
+	}
+
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for !attached() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	remote.Write([]byte("hello "))
+	if got := read(first); got != "hello " {
+		t.Fatalf("unexpected output %q", got)
+	}
+
+	// 连接断开期间的输出在重新连接时回放
+	first.Close()
+	for attached() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	remote.Write([]byte("world"))
+
+	second, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if got := read(second); got != "hello world" {
+		t.Fatalf("unexpected scrollback %q", got)
+	}
+
+	if _, err := sessions.resume("exec1", "local", "c1", "bob"); err == nil {
+		t.Fatal("expected other users to be rejected")
+	}
+
+	// 进程退出后客户端收到正常关闭，会话被移除
+	remote.Close()
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := second.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("expected normal close, got %v", err)
+	}
+	if _, err := sessions.resume("exec1", "local", "c1", "alice"); err == nil {
+		t.Fatal("expected exited session to be removed")
+	}
+}
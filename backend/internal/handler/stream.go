@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamJSONMessages 将 Docker 返回的 JSON 消息流逐行转发给客户端 (NDJSON)
+func streamJSONMessages(c *gin.Context, reader io.Reader) {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	scanner := bufio.NewScanner(reader)
+	// 单条消息可能较长（例如构建输出），放大缓冲区
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	c.Stream(func(w io.Writer) bool {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				msg, _ := json.Marshal(gin.H{"error": err.Error()})
+				w.Write(append(msg, '\n'))
+			}
+			return false
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			return true
+		}
+		w.Write(line)
+		w.Write([]byte("\n"))
+		return true
+	})
+}
+
+// uploadBody 返回上传内容：multipart 表单时取 file 字段，否则直接使用请求体
+// 返回的关闭函数用于释放表单文件，请求体由 HTTP 服务器负责关闭
+func uploadBody(c *gin.Context) (io.Reader, func(), error) {
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, func() { file.Close() }, nil
+	}
+	return c.Request.Body, func() {}, nil
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/smartcat999/container-ui/internal/auth"
+)
+
+type TokenHandler struct {
+	manager *auth.Manager
+}
+
+func NewTokenHandler(manager *auth.Manager) *TokenHandler {
+	return &TokenHandler{
+		manager: manager,
+	}
+}
+
+type createTokenRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+	// ExpiresIn 有效期，例如 720h，为空表示永不过期
+	ExpiresIn string `json:"expiresIn"`
+}
+
+// RequireSession 要求使用登录会话访问，个人访问令牌不能用来管理令牌
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(authTokenKey) != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "api tokens cannot be used for this operation"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListTokens 获取当前用户的访问令牌，管理员可以通过 all=true 查看所有用户的令牌
+func (h *TokenHandler) ListTokens(c *gin.Context) {
+	username := c.GetString(authUserKey)
+	if c.Query("all") == "true" && auth.HasRole(c.GetString(authRoleKey), auth.RoleAdmin) {
+		username = ""
+	}
+
+	tokens, err := h.manager.ListAPITokens(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreateToken 创建访问令牌，令牌明文只在响应中返回一次
+func (h *TokenHandler) CreateToken(c *gin.Context) {
+	var req createTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid expiresIn: %s", req.ExpiresIn)})
+			return
+		}
+	}
+
+	token, err := h.manager.CreateAPIToken(c.GetString(authUserKey), req.Name, req.Scopes, ttl)
+	if err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, token)
+}
+
+// DeleteToken 删除访问令牌，管理员可以删除任意用户的令牌
+func (h *TokenHandler) DeleteToken(c *gin.Context) {
+	username := c.GetString(authUserKey)
+	if auth.HasRole(c.GetString(authRoleKey), auth.RoleAdmin) {
+		username = ""
+	}
+
+	if err := h.manager.DeleteAPIToken(username, c.Param("id")); err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token deleted successfully"})
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -52,3 +53,89 @@ func (h *VolumeHandler) DeleteVolume(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Volume deleted successfully"})
 }
+
+// CreateVolume 创建数据卷
+func (h *VolumeHandler) CreateVolume(c *gin.Context) {
+	contextName := c.Param("context")
+	var config service.VolumeCreateConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vol, err := h.dockerService.CreateVolume(contextName, config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, vol)
+}
+
+// BrowseVolume 列出数据卷内的文件，通过 ?path=/data 指定目录，默认为数据卷根目录
+func (h *VolumeHandler) BrowseVolume(c *gin.Context) {
+	contextName := c.Param("context")
+	name := c.Param("name")
+	dir := c.DefaultQuery("path", "/")
+
+	entries, truncated, err := h.dockerService.BrowseVolume(contextName, name, dir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setListingTruncated(c, truncated)
+	c.JSON(http.StatusOK, entries)
+}
+
+// BackupVolume 以 tar 归档下载数据卷内容
+func (h *VolumeHandler) BackupVolume(c *gin.Context) {
+	contextName := c.Param("context")
+	name := c.Param("name")
+
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".tar"))
+
+	err := h.dockerService.BackupVolume(contextName, name, c.Writer)
+	if err != nil {
+		// 已经开始输出归档时无法再返回错误响应，只能中断
+		if c.Writer.Written() {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// RestoreVolume 将上传的 tar 归档恢复到数据卷，数据卷不存在时自动创建
+func (h *VolumeHandler) RestoreVolume(c *gin.Context) {
+	contextName := c.Param("context")
+	name := c.Param("name")
+
+	content, closeFn, err := uploadBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer closeFn()
+
+	if err := h.dockerService.RestoreVolume(contextName, name, content); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Volume restored successfully"})
+}
+
+// GetVolumeContainers 获取使用该数据卷的容器，用于删除前提示
+func (h *VolumeHandler) GetVolumeContainers(c *gin.Context) {
+	contextName := c.Param("context")
+	name := c.Param("name")
+
+	containers, err := h.dockerService.VolumeContainers(contextName, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, containers)
+}
@@ -0,0 +1,12 @@
+#!/bin/sh
+# 下载指定版本的 swagger-ui-dist，复制页面使用的文件到 swaggerui 目录
+# npm pack 按注册表记录的 sha512 校验包的完整性，下载的文件需要提交到仓库
+set -eu
+
+version="$1"
+dir=$(mktemp -d)
+trap 'rm -rf "$dir"' EXIT
+
+(cd "$dir" && npm pack --silent "swagger-ui-dist@$version" >/dev/null && tar -xzf "swagger-ui-dist-$version.tgz")
+cp "$dir/package/swagger-ui-bundle.js" "$dir/package/swagger-ui.css" "$dir/package/LICENSE" swaggerui/
+echo "$version" > swaggerui/VERSION
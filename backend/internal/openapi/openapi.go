@@ -0,0 +1,265 @@
+package openapi
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Document OpenAPI 3.0 文档，只包含本项目用到的字段
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+// Info 文档基本信息
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server API 地址
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem 路径下按小写 HTTP 方法索引的操作
+type PathItem map[string]*Operation
+
+// Operation 单个接口
+type Operation struct {
+	Summary     string              `json:"summary"`
+	Description string              `json:"description,omitempty"`
+	OperationID string              `json:"operationId,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	// Security 为空列表时表示该接口不需要认证，使用指针以保留空列表
+	Security *[]map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter 路径或查询参数
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody 请求体
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response 响应
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header 响应头
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// MediaType 内容类型对应的结构
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components 可复用的结构和认证方式
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme 认证方式
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Param 路由的查询参数说明，路径参数从路由中自动提取
+type Param struct {
+	Name        string
+	Description string
+	// Type 参数类型，默认 string
+	Type     string
+	Required bool
+}
+
+// Route 一个接口的说明
+type Route struct {
+	Method  string
+	Path    string // gin 风格的路径，例如 /api/contexts/:context
+	Summary string
+	Tag     string
+	Query   []Param
+	// Request 请求体对应的 Go 类型的零值，为 nil 时没有请求体
+	Request interface{}
+	// Response 200 响应对应的 Go 类型的零值，为 nil 时返回 Message
+	Response interface{}
+	// RequestType 和 ResponseType 覆盖默认的 application/json，例如文件上传和下载
+	RequestType  string
+	ResponseType string
+	// Public 不需要认证的接口
+	Public bool
+	// Paged 分页接口，总数通过 X-Total-Count 响应头返回
+	Paged bool
+}
+
+// Message 操作成功或失败时返回的通用结构
+type Message struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// 常用的内容类型
+const (
+	ContentJSON        = "application/json"
+	ContentTar         = "application/x-tar"
+	ContentOctetStream = "application/octet-stream"
+	ContentEventStream = "text/event-stream"
+	ContentText        = "text/plain"
+	// ContentUpload 上传接口同时支持原始请求体和 multipart 表单的 file 字段
+	ContentUpload = "multipart/form-data"
+)
+
+// BearerAuth 认证方式名称
+const BearerAuth = "bearerAuth"
+
+var ginParamPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// OpenAPIPath 将 gin 风格的路径转换为 OpenAPI 路径，例如 /containers/:id -> /containers/{id}
+func OpenAPIPath(path string) string {
+	return ginParamPattern.ReplaceAllString(path, "{$1}")
+}
+
+// Build 根据路由说明生成文档，auth 为 true 时非公开接口需要 Bearer 认证
+func Build(info Info, routes []Route, auth bool) *Document {
+	schemas := NewSchemas()
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   make(map[string]PathItem),
+	}
+	if auth {
+		doc.Components.SecuritySchemes = map[string]SecurityScheme{
+			BearerAuth: {
+				Type:        "http",
+				Scheme:      "bearer",
+				Description: "登录获取的 access token 或个人访问令牌 (cui_ 前缀)",
+			},
+		}
+		doc.Security = []map[string][]string{{BearerAuth: {}}}
+	}
+
+	for _, route := range routes {
+		path := OpenAPIPath(route.Path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = make(PathItem)
+			doc.Paths[path] = item
+		}
+		op := &Operation{
+			Summary:     route.Summary,
+			OperationID: operationID(route.Method, route.Path),
+			Responses:   make(map[string]Response),
+		}
+		if route.Tag != "" {
+			op.Tags = []string{route.Tag}
+		}
+		if auth && route.Public {
+			op.Security = &[]map[string][]string{}
+		}
+
+		for _, m := range ginParamPattern.FindAllStringSubmatch(route.Path, -1) {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:     m[1],
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+		for _, q := range route.Query {
+			typ := q.Type
+			if typ == "" {
+				typ = "string"
+			}
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:        q.Name,
+				In:          "query",
+				Description: q.Description,
+				Required:    q.Required,
+				Schema:      &Schema{Type: typ},
+			})
+		}
+
+		if route.Request != nil || route.RequestType != "" {
+			op.RequestBody = &RequestBody{Required: true, Content: bodyContent(schemas, route.RequestType, route.Request)}
+		}
+
+		response := route.Response
+		if response == nil && route.ResponseType == "" {
+			response = Message{}
+		}
+		ok200 := Response{Description: "OK", Content: bodyContent(schemas, route.ResponseType, response)}
+		if route.Paged {
+			ok200.Headers = map[string]Header{
+				"X-Total-Count": {Description: "分页前的总数", Schema: &Schema{Type: "integer"}},
+			}
+		}
+		op.Responses["200"] = ok200
+		errorResponse := Response{Description: "Error", Content: bodyContent(schemas, "", Message{})}
+		op.Responses["default"] = errorResponse
+
+		item[strings.ToLower(route.Method)] = op
+	}
+
+	doc.Components.Schemas = schemas.Components()
+	return doc
+}
+
+func bodyContent(schemas *Schemas, contentType string, v interface{}) map[string]MediaType {
+	if contentType == "" {
+		contentType = ContentJSON
+	}
+	var schema *Schema
+	switch {
+	case v != nil:
+		schema = schemas.SchemaOf(v)
+	case contentType == ContentUpload:
+		schema = &Schema{Type: "object", Properties: map[string]*Schema{"file": {Type: "string", Format: "binary"}}}
+	case contentType != ContentJSON:
+		schema = &Schema{Type: "string", Format: "binary"}
+	}
+	content := map[string]MediaType{contentType: {Schema: schema}}
+	// 上传接口同样接受原始请求体
+	if contentType == ContentUpload {
+		content[ContentOctetStream] = MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+	}
+	return content
+}
+
+// operationID 由方法和路径生成唯一的 operationId，例如 post_contexts_context_containers_id_stop
+func operationID(method, path string) string {
+	parts := []string{strings.ToLower(method)}
+	for _, seg := range strings.Split(strings.TrimPrefix(path, "/api"), "/") {
+		seg = strings.TrimLeft(seg, ":*")
+		if seg != "" {
+			parts = append(parts, seg)
+		}
+	}
+	return strings.Join(parts, "_")
+}
@@ -0,0 +1,183 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema JSON Schema 的子集
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+// Schemas 通过反射从 Go 类型生成结构，具名结构体放入 components 中复用
+type Schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+// NewSchemas 创建结构生成器
+func NewSchemas() *Schemas {
+	return &Schemas{
+		components: make(map[string]*Schema),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+// Components 返回生成的具名结构
+func (s *Schemas) Components() map[string]*Schema {
+	return s.components
+}
+
+// SchemaOf 返回值对应类型的结构
+func (s *Schemas) SchemaOf(v interface{}) *Schema {
+	return s.schemaOf(reflect.TypeOf(v))
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (s *Schemas) schemaOf(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawJSONType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := s.schemaOf(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		if t.PkgPath() == "time" && t.Name() == "Duration" {
+			return &Schema{Type: "integer", Format: "int64", Description: "纳秒"}
+		}
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return s.structSchema(t)
+	default:
+		// interface{} 等无法确定结构的类型
+		return &Schema{}
+	}
+}
+
+// structSchema 具名结构体生成引用，匿名结构体直接内联
+func (s *Schemas) structSchema(t reflect.Type) *Schema {
+	if t.Name() == "" {
+		return s.buildStruct(t)
+	}
+
+	if name, ok := s.names[t]; ok {
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	name := s.componentName(t)
+	s.names[t] = name
+	// 先占位以支持递归类型
+	s.components[name] = &Schema{}
+	*s.components[name] = *s.buildStruct(t)
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// componentName 使用包名加类型名，同名类型追加序号
+func (s *Schemas) componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	name := t.Name()
+	if pkg != "" {
+		name = pkg + "." + name
+	}
+	// 泛型类型名中可能包含方括号等字符
+	name = strings.NewReplacer("[", "_", "]", "", "*", "", "/", "_", ",", "_").Replace(name)
+
+	base := name
+	for i := 2; ; i++ {
+		if _, exists := s.components[name]; !exists {
+			return name
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+}
+
+func (s *Schemas) buildStruct(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	s.addFields(schema, t)
+	if len(schema.Properties) == 0 {
+		schema.Properties = nil
+	}
+	return schema
+}
+
+// addFields 按 encoding/json 的规则处理字段，匿名嵌入的结构体展开到外层
+func (s *Schemas) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				s.addFields(schema, ft)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		var prop *Schema
+		if strings.Contains(opts, "string") {
+			prop = &Schema{Type: "string"}
+		} else {
+			prop = s.schemaOf(field.Type)
+		}
+		schema.Properties[name] = prop
+
+		if binding := field.Tag.Get("binding"); strings.Contains(binding, "required") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
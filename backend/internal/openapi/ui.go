@@ -0,0 +1,86 @@
+package openapi
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"path"
+	"time"
+)
+
+//go:generate sh fetch-swagger-ui.sh 5.17.14
+
+// swaggerUIAssets 内嵌的 swagger-ui-dist 文件，由 go generate 下载固定版本后提交到仓库，
+// 页面不从 CDN 加载脚本，避免第三方内容在 API 文档页面中执行
+//
+//go:embed swaggerui
+var swaggerUIAssets embed.FS
+
+// swaggerUIFiles 页面使用的 swagger-ui-dist 文件
+var swaggerUIFiles = map[string]string{
+	"swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+	"swagger-ui.css":       "text/css; charset=utf-8",
+}
+
+const swaggerUITemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>%[1]s</title>
+  <link rel="stylesheet" href="%[2]s/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="%[2]s/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = function () {
+      window.ui = SwaggerUIBundle({ url: %[3]q, dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`
+
+const swaggerUIMissing = `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>%[1]s</title></head>
+<body>
+  <p>Swagger UI is not bundled in this build. The OpenAPI document is available at <a href="%[2]s">%[2]s</a>.</p>
+</body>
+</html>
+`
+
+// SwaggerUI 返回展示指定文档的 Swagger UI 页面，脚本和样式使用内嵌的文件，
+// 挂载在 /docs 时文件的路径为 /docs/swagger-ui.css 等，路由需要同时转发该前缀下的请求
+func SwaggerUI(title, specURL string) http.Handler {
+	_, err := fs.Stat(swaggerUIAssets, "swaggerui/swagger-ui-bundle.js")
+	bundled := err == nil
+	modTime := time.Now()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		if contentType, ok := swaggerUIFiles[name]; ok && bundled {
+			data, err := swaggerUIAssets.ReadFile("swaggerui/" + name)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", contentType)
+			http.ServeContent(w, r, name, modTime, bytes.NewReader(data))
+			return
+		}
+
+		var page string
+		if bundled {
+			// 相对于页面路径引用文件，例如 /api/docs 页面引用 /api/docs/swagger-ui.css
+			page = fmt.Sprintf(swaggerUITemplate, html.EscapeString(title), html.EscapeString(name), specURL)
+		} else {
+			page = fmt.Sprintf(swaggerUIMissing, html.EscapeString(title), html.EscapeString(specURL))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+}
@@ -0,0 +1,34 @@
+package openapi
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSwaggerUI(t *testing.T) {
+	handler := SwaggerUI("Test API", "/api/openapi.json")
+	_, err := fs.Stat(swaggerUIAssets, "swaggerui/swagger-ui-bundle.js")
+	bundled := err == nil
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+	page := rec.Body.String()
+	if rec.Code != http.StatusOK || strings.Contains(page, "https://") || strings.Contains(page, "persistAuthorization") {
+		t.Fatalf("unexpected page %d: %s", rec.Code, page)
+	}
+	if bundled && !strings.Contains(page, `src="docs/swagger-ui-bundle.js"`) {
+		t.Fatalf("expected page to load the embedded bundle: %s", page)
+	}
+	if !bundled && !strings.Contains(page, `href="/api/openapi.json"`) {
+		t.Fatalf("expected page to link the document when assets are missing: %s", page)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/docs/swagger-ui.css", nil))
+	if bundled && (rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/css")) {
+		t.Fatalf("expected embedded stylesheet, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,259 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/cert"
+)
+
+// CACertPath 获取拦截证书 CA 的路径，客户端下载后安装信任
+const CACertPath = "/ca.crt"
+
+// CRLPath 获取拦截证书 CRL 的路径，签发的证书的 CRL 分发点指向该路径
+const CRLPath = "/ca.crl"
+
+// ConnectHandler 正向代理处理器，containerd、dockerd 可以通过 HTTPS_PROXY 使用，无需修改 DNS
+// CONNECT 到 intercept 返回 true 的主机时，用 certs 按 SNI 签发的证书终止 TLS，解密后的请求交给 next 处理；
+// 其他主机只有在直通名单中且端口允许时才原样建立 TCP 隧道，否则返回 403，避免被当作开放代理访问内网。
+// 非 CONNECT 请求直接交给 next
+type ConnectHandler struct {
+	certs       *cert.Manager
+	intercept   func(host string) bool
+	next        http.Handler
+	dialer      net.Dialer
+	passthrough []string
+	ports       map[string]bool
+}
+
+// ConnectOptions 正向代理的选项
+type ConnectOptions struct {
+	// Passthrough 不拦截、直接建立隧道的主机，支持精确主机名和 *.example.com 形式的通配符，* 表示全部主机；为空时不建立隧道
+	Passthrough []string
+	// PassthroughPorts 允许建立隧道的端口，为空时只允许 443
+	PassthroughPorts []int
+}
+
+// NewConnectHandler 创建正向代理处理器，只拦截已配置的仓库，不为其他主机建立隧道
+func NewConnectHandler(certs *cert.Manager, intercept func(host string) bool, next http.Handler) *ConnectHandler {
+	return NewConnectHandlerWithOptions(certs, intercept, next, ConnectOptions{})
+}
+
+// NewConnectHandlerWithOptions 使用选项创建正向代理处理器
+func NewConnectHandlerWithOptions(certs *cert.Manager, intercept func(host string) bool, next http.Handler, opts ConnectOptions) *ConnectHandler {
+	ports := map[string]bool{"443": true}
+	if len(opts.PassthroughPorts) > 0 {
+		ports = make(map[string]bool, len(opts.PassthroughPorts))
+		for _, port := range opts.PassthroughPorts {
+			ports[strconv.Itoa(port)] = true
+		}
+	}
+	passthrough := make([]string, 0, len(opts.Passthrough))
+	for _, host := range opts.Passthrough {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			passthrough = append(passthrough, host)
+		}
+	}
+	return &ConnectHandler{
+		certs:       certs,
+		intercept:   intercept,
+		next:        next,
+		dialer:      net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		passthrough: passthrough,
+		ports:       ports,
+	}
+}
+
+// allowTunnel 判断是否可以为该主机和端口建立隧道
+func (h *ConnectHandler) allowTunnel(hostname, port string) bool {
+	if !h.ports[port] {
+		return false
+	}
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	for _, pattern := range h.passthrough {
+		switch {
+		case pattern == "*", pattern == hostname:
+			return true
+		case strings.HasPrefix(pattern, "*.") && strings.HasSuffix(hostname, pattern[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+func (h *ConnectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == CACertPath && !r.URL.IsAbs() {
+		cert.WriteCACertificate(w, r, h.certs)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == CRLPath && !r.URL.IsAbs() {
+		cert.WriteCRL(w, r, h.certs)
+		return
+	}
+	if r.Method != http.MethodConnect {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	authority := r.Host
+	hostname, port, err := net.SplitHostPort(authority)
+	if err != nil {
+		hostname, port = authority, "443"
+		authority = net.JoinHostPort(authority, port)
+	}
+
+	if h.intercept(hostname) {
+		conn, err := hijack(w)
+		if err != nil {
+			log.Printf("Failed to hijack CONNECT %s: %v", authority, err)
+			return
+		}
+		log.Printf("Intercepting CONNECT %s", authority)
+		h.serveTLS(conn, hostname, authority)
+		return
+	}
+
+	if !h.allowTunnel(hostname, port) {
+		log.Printf("Rejected CONNECT %s: not a configured registry or passthrough host", authority)
+		http.Error(w, "CONNECT to "+authority+" is not allowed", http.StatusForbidden)
+		return
+	}
+
+	upstream, err := h.dialer.DialContext(r.Context(), "tcp", authority)
+	if err != nil {
+		log.Printf("Failed to dial %s: %v", authority, err)
+		http.Error(w, "failed to connect to "+authority, http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+	conn, err := hijack(w)
+	if err != nil {
+		log.Printf("Failed to hijack CONNECT %s: %v", authority, err)
+		return
+	}
+	defer conn.Close()
+	tunnel(conn, upstream)
+}
+
+// hijack 接管客户端连接并确认隧道已建立
+func hijack(w http.ResponseWriter) (net.Conn, error) {
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// 客户端可能在收到确认前就发送了数据
+	if rw.Reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: rw.Reader}, nil
+	}
+	return conn, nil
+}
+
+// serveTLS 用签发的证书终止 TLS，在该连接上处理解密后的 HTTP 请求，直到客户端断开
+func (h *ConnectHandler) serveTLS(conn net.Conn, hostname, authority string) {
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			// 客户端没有发送 SNI 时 (例如直接使用 IP) 按 CONNECT 的目标签发
+			if hello.ServerName == "" {
+				return h.certs.Certificate(hostname)
+			}
+			return h.certs.Certificate(hello.ServerName)
+		},
+		NextProtos: []string{"http/1.1"},
+		MinVersion: tls.VersionTLS12,
+	})
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Host == "" {
+				r.Host = authority
+			}
+			h.next.ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: time.Minute,
+		ErrorLog:          log.New(io.Discard, "", 0),
+	}
+	server.Serve(newSingleConnListener(tlsConn))
+}
+
+// tunnel 在两个连接之间双向复制数据，任一方向结束后关闭写端
+func tunnel(client, upstream net.Conn) {
+	var wg sync.WaitGroup
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if tcp, ok := dst.(interface{ CloseWrite() error }); ok {
+			tcp.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	wg.Add(2)
+	go copyHalf(upstream, client)
+	go copyHalf(client, upstream)
+	wg.Wait()
+}
+
+// bufferedConn 先读取 Hijack 时缓冲区中剩余的数据
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// singleConnListener 只返回一个连接的 Listener，连接关闭后 Accept 返回错误，http.Server.Serve 随之结束
+type singleConnListener struct {
+	conn net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	l := &singleConnListener{done: make(chan struct{})}
+	l.conn = &notifyCloseConn{Conn: conn, done: l.done}
+	return l
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() { conn = l.conn })
+	if conn != nil {
+		return conn, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *singleConnListener) Close() error {
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// notifyCloseConn 关闭时通知 singleConnListener
+type notifyCloseConn struct {
+	net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *notifyCloseConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { close(c.done) })
+	return err
+}
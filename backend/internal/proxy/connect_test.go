@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/cert"
+)
+
+func TestConnectHandler(t *testing.T) {
+	certs, err := cert.NewManager("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer direct.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("intercepted " + r.Host + r.URL.Path))
+	})
+	intercept := func(host string) bool { return host == "registry.test" }
+	directURL, _ := url.Parse(direct.URL)
+	directPort, _ := strconv.Atoi(directURL.Port())
+	proxyServer := httptest.NewServer(NewConnectHandlerWithOptions(certs, intercept, next, ConnectOptions{
+		Passthrough:      []string{"127.0.0.1"},
+		PassthroughPorts: []int{directPort},
+	}))
+	defer proxyServer.Close()
+	proxyURL, _ := url.Parse(proxyServer.URL)
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certs.CACertPEM())
+	pool.AddCert(direct.Certificate())
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}}
+
+	get := func(target string) string {
+		resp, err := client.Get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if got := get("https://registry.test/v2/"); got != "intercepted registry.test/v2/" {
+		t.Fatalf("unexpected intercepted response %q", got)
+	}
+	if got := get(direct.URL); got != "direct" {
+		t.Fatalf("unexpected tunneled response %q", got)
+	}
+
+	// 不在直通名单中的主机和不允许的端口不建立隧道
+	for _, target := range []string{"localhost:" + directURL.Port(), "127.0.0.1:22"} {
+		req, _ := http.NewRequest(http.MethodConnect, proxyServer.URL, nil)
+		req.Host = target
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected CONNECT %s to be rejected, got %d", target, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(proxyServer.URL + CACertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != string(certs.CACertPEM()) {
+		t.Fatal("unexpected ca certificate")
+	}
+}
@@ -3,15 +3,22 @@ package proxy
 import (
 	"log"
 	"net/http"
+	"strings"
 )
 
+// DefaultMaxRedirects 默认最多跟随的重定向次数
+const DefaultMaxRedirects = 5
+
 // RedirectFollowingTransport 自动跟随重定向的传输层
+// 301、302 和 303 按 net/http 客户端的规则把非 GET/HEAD 请求改为不带请求体的 GET，
+// 307 和 308 保留原方法并通过 GetBody 重放请求体，请求体无法重放时把重定向响应返回给调用方。
+// 跨主机重定向时不转发 Authorization、Cookie 等凭据，避免把上游令牌泄露给对象存储等第三方
 type RedirectFollowingTransport struct {
 	*http.Transport
 	maxRedirects int
 }
 
-// NewRedirectFollowingTransport 创建新的自动跟随重定向的传输层
+// NewRedirectFollowingTransport 创建新的自动跟随重定向的传输层，maxRedirects 为 0 时不跟随重定向
 func NewRedirectFollowingTransport(transport *http.Transport, maxRedirects int) *RedirectFollowingTransport {
 	return &RedirectFollowingTransport{
 		Transport:    transport,
@@ -20,17 +27,12 @@ func NewRedirectFollowingTransport(transport *http.Transport, maxRedirects int)
 }
 
 func (t *RedirectFollowingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	origReq := req.Clone(req.Context())
-	var resp *http.Response
-	var err error
-
-	for redirects := 0; redirects < t.maxRedirects; redirects++ {
-		resp, err = t.Transport.RoundTrip(req)
+	for redirects := 0; ; redirects++ {
+		resp, err := t.Transport.RoundTrip(req)
 		if err != nil {
 			return nil, err
 		}
-
-		if !isRedirect(resp.StatusCode) {
+		if !isRedirect(resp.StatusCode) || redirects >= t.maxRedirects {
 			return resp, nil
 		}
 
@@ -38,33 +40,74 @@ func (t *RedirectFollowingTransport) RoundTrip(req *http.Request) (*http.Respons
 		if err != nil {
 			return resp, nil
 		}
+		newReq, ok, err := redirectRequest(req, resp.StatusCode, location.String())
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if !ok {
+			return resp, nil
+		}
 
-		log.Printf("跟随重定向: %s -> %s", req.URL.String(), location.String())
+		log.Printf("跟随重定向: %s %s -> %s %s", req.Method, req.URL.String(), newReq.Method, location.String())
 		resp.Body.Close()
+		req = newReq
+	}
+}
+
+// redirectRequest 按重定向语义构建下一个请求，请求体无法重放时返回 false
+func redirectRequest(req *http.Request, status int, location string) (*http.Request, bool, error) {
+	method := req.Method
+	keepBody := status == http.StatusTemporaryRedirect || status == http.StatusPermanentRedirect
+	if !keepBody && method != http.MethodGet && method != http.MethodHead {
+		method = http.MethodGet
+	}
 
-		newReq, err := http.NewRequestWithContext(req.Context(), origReq.Method, location.String(), nil)
+	hasBody := keepBody && req.Body != nil && req.Body != http.NoBody
+	if hasBody && req.GetBody == nil {
+		return nil, false, nil
+	}
+
+	newReq, err := http.NewRequestWithContext(req.Context(), method, location, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if hasBody {
+		body, err := req.GetBody()
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
+		newReq.Body = body
+		newReq.GetBody = req.GetBody
+		newReq.ContentLength = req.ContentLength
+	}
 
-		copyHeaders(origReq.Header, newReq.Header)
-		req = newReq
+	crossHost := !strings.EqualFold(newReq.URL.Host, req.URL.Host)
+	for key, values := range req.Header {
+		if crossHost && sensitiveHeaders[key] {
+			continue
+		}
+		if !hasBody && (key == "Content-Type" || key == "Content-Length") {
+			continue
+		}
+		newReq.Header[key] = append([]string(nil), values...)
 	}
+	return newReq, true, nil
+}
 
-	return resp, err
+// sensitiveHeaders 跨主机重定向时不转发的请求头
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Www-Authenticate":    true,
+	"Cookie":              true,
+	"Cookie2":             true,
 }
 
 func isRedirect(statusCode int) bool {
 	return statusCode == http.StatusTemporaryRedirect ||
+		statusCode == http.StatusPermanentRedirect ||
 		statusCode == http.StatusMovedPermanently ||
 		statusCode == http.StatusFound ||
 		statusCode == http.StatusSeeOther
 }
-
-func copyHeaders(src, dst http.Header) {
-	for key, values := range src {
-		for _, value := range values {
-			dst.Add(key, value)
-		}
-	}
-}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type recordedRequest struct {
+	method, body, auth string
+}
+
+func TestRedirectFollowingTransport(t *testing.T) {
+	var got recordedRequest
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = recordedRequest{r.Method, string(body), r.Header.Get("Authorization")}
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/see-other":
+			http.Redirect(w, r, "/target", http.StatusSeeOther)
+		case "/temporary":
+			http.Redirect(w, r, "/target", http.StatusTemporaryRedirect)
+		case "/cross-host":
+			http.Redirect(w, r, other.URL+"/target", http.StatusTemporaryRedirect)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			body, _ := io.ReadAll(r.Body)
+			got = recordedRequest{r.Method, string(body), r.Header.Get("Authorization")}
+		}
+	}))
+	defer server.Close()
+
+	transport := NewRedirectFollowingTransport(&http.Transport{}, 3)
+	do := func(method, path string) *http.Response {
+		t.Helper()
+		got = recordedRequest{}
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader("payload"))
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	do(http.MethodPost, "/see-other")
+	if got != (recordedRequest{http.MethodGet, "", "Bearer token"}) {
+		t.Errorf("303 should switch to GET without body, got %+v", got)
+	}
+
+	do(http.MethodPut, "/temporary")
+	if got != (recordedRequest{http.MethodPut, "payload", "Bearer token"}) {
+		t.Errorf("307 should replay method and body, got %+v", got)
+	}
+
+	do(http.MethodPut, "/cross-host")
+	if got != (recordedRequest{http.MethodPut, "payload", ""}) {
+		t.Errorf("cross-host redirect should drop credentials, got %+v", got)
+	}
+
+	if resp := do(http.MethodGet, "/loop"); resp.StatusCode != http.StatusFound {
+		t.Errorf("expected redirect response after max redirects, got %d", resp.StatusCode)
+	}
+
+	// 请求体无法重放时返回重定向响应
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/temporary", io.NopCloser(strings.NewReader("payload")))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("expected 307 for non-replayable body, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,187 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// bandwidthChunk 每次写入的最大字节数，较小的分块让共用同一个桶的数据流交替前进
+const bandwidthChunk = 32 * 1024
+
+// Bandwidth 字节级令牌桶，限制一个或多个数据流的总带宽
+// 令牌不足时按预留顺序排队，先到的写入先完成，共用同一个桶的数据流平分带宽
+type Bandwidth struct {
+	rate  float64 // 每秒字节数
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewBandwidth 创建带宽限制，bytesPerSecond 小于等于 0 时返回 nil，nil 不做任何限制
+func NewBandwidth(bytesPerSecond int64) *Bandwidth {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSecond)
+	// 允许突发一秒的流量，但至少能容纳一个分块
+	burst := math.Max(rate, bandwidthChunk)
+	return &Bandwidth{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// WaitN 等待 n 字节的令牌，ctx 取消时返回错误
+func (b *Bandwidth) WaitN(ctx context.Context, n int) error {
+	if b == nil {
+		return nil
+	}
+	wait := b.reserveAt(n, time.Now())
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserveAt 预留 n 字节并返回需要等待的时间，令牌可以为负，之后的预留排在后面
+func (b *Bandwidth) reserveAt(n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// BandwidthLimiter 按 key 独立的带宽限制，例如每个客户端 IP 一个桶
+type BandwidthLimiter struct {
+	bytesPerSecond int64
+
+	mu      sync.Mutex
+	buckets map[string]*bandwidthEntry
+	stop    chan struct{}
+	once    sync.Once
+}
+
+type bandwidthEntry struct {
+	bandwidth *Bandwidth
+	lastUsed  time.Time
+}
+
+// NewBandwidthLimiter 创建按 key 的带宽限制，bytesPerSecond 小于等于 0 时返回 nil
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	l := &BandwidthLimiter{
+		bytesPerSecond: bytesPerSecond,
+		buckets:        make(map[string]*bandwidthEntry),
+		stop:           make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Get 返回 key 对应的带宽限制，nil 限制器返回 nil
+func (l *BandwidthLimiter) Get(key string) *Bandwidth {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.buckets[key]
+	if !ok {
+		entry = &bandwidthEntry{bandwidth: NewBandwidth(l.bytesPerSecond)}
+		l.buckets[key] = entry
+	}
+	entry.lastUsed = time.Now()
+	return entry.bandwidth
+}
+
+// Close 停止后台清理
+func (l *BandwidthLimiter) Close() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() { close(l.stop) })
+}
+
+func (l *BandwidthLimiter) run() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for key, entry := range l.buckets {
+				if now.Sub(entry.lastUsed) > idleTimeout {
+					delete(l.buckets, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// Writer 按带宽限制写入的 io.Writer，每个分块依次等待所有限制
+type Writer struct {
+	w      io.Writer
+	ctx    context.Context
+	limits []*Bandwidth
+}
+
+// NewWriter 创建受带宽限制的 Writer，nil 限制被忽略
+func NewWriter(ctx context.Context, w io.Writer, limits ...*Bandwidth) *Writer {
+	writer := &Writer{w: w, ctx: ctx}
+	for _, limit := range limits {
+		if limit != nil {
+			writer.limits = append(writer.limits, limit)
+		}
+	}
+	return writer
+}
+
+// Limited 是否有生效的带宽限制
+func (w *Writer) Limited() bool {
+	return len(w.limits) > 0
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if len(w.limits) == 0 {
+		return w.w.Write(p)
+	}
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > bandwidthChunk {
+			chunk = chunk[:bandwidthChunk]
+		}
+		for _, limit := range w.limits {
+			if err := limit.WaitN(w.ctx, len(chunk)); err != nil {
+				return written, err
+			}
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Options HTTP 限流中间件配置
+type Options struct {
+	// PerIP 按客户端 IP 限流
+	PerIP *Limiter
+	// PerToken 按 Authorization 头限流，同一客户端的不同凭据仍受 PerIP 限制
+	PerToken *Limiter
+	// MaxBodySize 请求体大小上限，0 表示不限制
+	MaxBodySize int64
+}
+
+// Middleware 为 net/http 处理器添加限流和请求体大小限制，超出时返回 429 或 413
+func Middleware(next http.Handler, opts Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := opts.PerIP.Allow(RemoteIP(r)); !ok {
+			TooManyRequests(w, wait)
+			return
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			if ok, wait := opts.PerToken.Allow(TokenKey(auth)); !ok {
+				TooManyRequests(w, wait)
+				return
+			}
+		}
+
+		if opts.MaxBodySize > 0 {
+			if r.ContentLength > opts.MaxBodySize {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, opts.MaxBodySize)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TooManyRequests 返回 429，Retry-After 向上取整到秒
+func TooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", RetryAfter(wait))
+	http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+}
+
+// RetryAfter 将等待时间格式化为 Retry-After 头的秒数
+func RetryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds()))))
+}
+
+// TokenKey 使用凭据的哈希作为限流 key，避免在内存中保留凭据明文
+func TokenKey(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return hex.EncodeToString(sum[:16])
+}
+
+// RemoteIP 返回连接的来源 IP，不信任 X-Forwarded-For
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
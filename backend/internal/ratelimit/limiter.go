@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// 空闲桶的清理间隔和超时时间
+const (
+	sweepInterval = time.Minute
+	idleTimeout   = 10 * time.Minute
+)
+
+// Limiter 按 key 独立计数的令牌桶限流器
+type Limiter struct {
+	rate  float64 // 每秒补充的令牌数
+	burst float64 // 桶容量
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	stop    chan struct{}
+	once    sync.Once
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter 创建限流器，rate 为每秒允许的请求数，burst 为允许的突发请求数
+// rate 小于等于 0 时返回 nil，nil 限流器不做任何限制
+func NewLimiter(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+	l := &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		stop:    make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Allow 消耗一个令牌，令牌不足时返回需要等待的时间
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	return l.allowAt(key, time.Now())
+}
+
+func (l *Limiter) allowAt(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Close 停止后台清理
+func (l *Limiter) Close() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() { close(l.stop) })
+}
+
+func (l *Limiter) run() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			l.sweep(now)
+		}
+	}
+}
+
+// sweep 删除长时间未使用的桶，这些桶早已补满，删除后不影响限流结果
+func (l *Limiter) sweep(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(2, 3)
+	defer l.Close()
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allowAt("a", now); !ok {
+			t.Fatalf("request %d should be allowed by burst", i)
+		}
+	}
+	ok, wait := l.allowAt("a", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, got ok=%v wait=%v", ok, wait)
+	}
+	if ok, _ := l.allowAt("b", now); !ok {
+		t.Error("other keys must have their own bucket")
+	}
+	if ok, _ := l.allowAt("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("token should be refilled after 500ms")
+	}
+
+	var disabled *Limiter
+	if ok, _ := disabled.Allow("a"); !ok {
+		t.Error("nil limiter must allow all requests")
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	b := NewBandwidth(64 * 1024)
+	now := b.last
+	if wait := b.reserveAt(64*1024, now); wait != 0 {
+		t.Fatalf("burst should allow one second of data, got wait %v", wait)
+	}
+	if wait := b.reserveAt(32*1024, now); wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, got %v", wait)
+	}
+	// 排在前一个预留之后
+	if wait := b.reserveAt(32*1024, now); wait != time.Second {
+		t.Fatalf("expected to wait 1s, got %v", wait)
+	}
+
+	var disabled *Bandwidth
+	if err := disabled.WaitN(context.Background(), 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	if NewBandwidthLimiter(0).Get("a") != nil {
+		t.Error("disabled limiter must not limit")
+	}
+}
@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+// ACLAdmin 仓库访问控制的管理接口
+type ACLAdmin struct {
+	acls config.ACLStore
+}
+
+// NewACLAdmin 创建访问控制管理接口
+func NewACLAdmin(acls config.ACLStore) *ACLAdmin {
+	return &ACLAdmin{acls: acls}
+}
+
+// ServeHTTP 实现管理接口：GET 列出访问控制，PUT 添加或更新，DELETE ?repository=<name> 删除
+func (a *ACLAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		acls, err := a.acls.List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(acls)
+	case http.MethodPut:
+		var acl config.RepositoryACL
+		if err := json.NewDecoder(r.Body).Decode(&acl); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := acl.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := a.acls.Put(acl); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(acl)
+	case http.MethodDelete:
+		removed, err := a.acls.Remove(r.URL.Query().Get("repository"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, "acl not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
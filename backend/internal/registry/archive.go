@@ -0,0 +1,574 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+// 归档中的元数据文件
+const (
+	archiveLayoutFile   = "oci-layout"
+	archiveIndexFile    = "index.json"
+	archiveManifestFile = "manifest.json"
+	// archiveBufferLimit 导入时读入内存的文件大小上限，清单和镜像配置都远小于该值
+	archiveBufferLimit = 4 << 20
+)
+
+// 镜像引用相关的注解
+const (
+	annotationImageName = "io.containerd.image.name"
+	annotationRefName   = "org.opencontainers.image.ref.name"
+)
+
+// 旧版 docker save 格式中层和配置的媒体类型
+const (
+	mediaTypeDockerConfig   = "application/vnd.docker.container.image.v1+json"
+	mediaTypeDockerLayerTar = "application/vnd.docker.image.rootfs.diff.tar"
+)
+
+// archiveDescriptor OCI 描述符
+type archiveDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// archiveIndex OCI image-layout 的 index.json
+type archiveIndex struct {
+	SchemaVersion int                 `json:"schemaVersion"`
+	MediaType     string              `json:"mediaType,omitempty"`
+	Manifests     []archiveDescriptor `json:"manifests"`
+}
+
+// archiveDockerImage docker save 的 manifest.json 中的一项
+type archiveDockerImage struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// ExportArchive 把镜像导出为 tar 归档，归档既是 OCI image-layout，也带有 docker load 可以读取的 manifest.json。
+// refs 的每一项是 <repository>:<tag>，或只写仓库名导出该仓库的所有标签
+func ExportArchive(ctx context.Context, store storage.Storage, w io.Writer, refs []string) error {
+	tw := tar.NewWriter(w)
+	written := make(map[string]bool)
+	index := archiveIndex{SchemaVersion: 2, MediaType: MediaTypeOCIManifestIndex, Manifests: []archiveDescriptor{}}
+	dockerImages := []archiveDockerImage{}
+
+	if err := writeArchiveFile(tw, archiveLayoutFile, []byte(`{"imageLayoutVersion":"1.0.0"}`)); err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		repository, tag := parseImageReference(ref)
+		tags := []string{tag}
+		if tag == "" {
+			var err error
+			if tags, err = store.ListTags(repository); err != nil {
+				return fmt.Errorf("failed to list tags of %s: %v", repository, err)
+			}
+		}
+		for _, tag := range tags {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			data, digest, err := store.GetManifest(repository, tag)
+			if err != nil {
+				return fmt.Errorf("failed to resolve %s:%s: %v", repository, tag, err)
+			}
+			if err := exportManifest(tw, store, repository, digest, data, written); err != nil {
+				return err
+			}
+			index.Manifests = append(index.Manifests, archiveDescriptor{
+				MediaType: detectManifestMediaType(data),
+				Digest:    digest,
+				Size:      int64(len(data)),
+				Annotations: map[string]string{
+					annotationImageName: repository + ":" + tag,
+					annotationRefName:   tag,
+				},
+			})
+
+			// 清单列表无法用 docker load 导入，只出现在 index.json 中
+			var manifest gcManifest
+			if json.Unmarshal(data, &manifest) == nil && manifest.Config.Digest != "" {
+				image := archiveDockerImage{Config: blobPath(manifest.Config.Digest), RepoTags: []string{repository + ":" + tag}, Layers: []string{}}
+				for _, layer := range manifest.Layers {
+					image.Layers = append(image.Layers, blobPath(layer.Digest))
+				}
+				dockerImages = append(dockerImages, image)
+			}
+		}
+	}
+
+	for name, value := range map[string]any{archiveIndexFile: index, archiveManifestFile: dockerImages} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if err := writeArchiveFile(tw, name, data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// exportManifest 写入清单及其引用的子清单和 blob，已写入的内容跳过
+func exportManifest(tw *tar.Writer, store storage.Storage, repository, digest string, data []byte, written map[string]bool) error {
+	if written[digest] {
+		return nil
+	}
+	var manifest gcManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("failed to parse manifest %s@%s: %v", repository, digest, err)
+	}
+	for _, child := range manifest.Manifests {
+		childData, _, err := store.GetManifestByDigest(repository, child.Digest)
+		if err != nil {
+			return fmt.Errorf("failed to get manifest %s@%s: %v", repository, child.Digest, err)
+		}
+		if err := exportManifest(tw, store, repository, child.Digest, childData, written); err != nil {
+			return err
+		}
+	}
+
+	blobs := make([]string, 0, len(manifest.Layers)+1)
+	if manifest.Config.Digest != "" {
+		blobs = append(blobs, manifest.Config.Digest)
+	}
+	for _, layer := range manifest.Layers {
+		blobs = append(blobs, layer.Digest)
+	}
+	for _, blob := range blobs {
+		if written[blob] {
+			continue
+		}
+		reader, size, err := store.GetBlob(repository, blob)
+		if err != nil {
+			return fmt.Errorf("failed to read blob %s@%s: %v", repository, blob, err)
+		}
+		err = tw.WriteHeader(&tar.Header{Name: blobPath(blob), Mode: 0644, Size: size, Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = io.Copy(tw, reader)
+		}
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write blob %s: %v", blob, err)
+		}
+		written[blob] = true
+	}
+
+	if err := writeArchiveFile(tw, blobPath(digest), data); err != nil {
+		return err
+	}
+	written[digest] = true
+	return nil
+}
+
+func writeArchiveFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return nil
+}
+
+// blobPath 返回 blob 在 OCI image-layout 中的路径
+func blobPath(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	// Repository 设置后所有镜像都导入到该仓库，归档中的仓库名被忽略，只保留标签
+	Repository string
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	// Images 导入的镜像，格式为 <repository>:<tag>
+	Images []string `json:"images"`
+	Blobs  int      `json:"blobs"`
+}
+
+// importImage 归档中的一个镜像
+type importImage struct {
+	repository string
+	tag        string
+	digest     string
+}
+
+// ImportArchive 导入 OCI image-layout 或 docker save 格式的 tar 归档。
+// 归档需要读取两遍：第一遍读取元数据和清单，第二遍把 blob 流式写入存储，大的层不在内存中缓冲
+func ImportArchive(ctx context.Context, store storage.Storage, archivePath string, opts ImportOptions) (*ImportResult, error) {
+	files, err := readArchiveMetadata(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := files[archiveIndexFile]; ok {
+		return importOCIArchive(ctx, store, archivePath, files, opts)
+	}
+	if _, ok := files[archiveManifestFile]; ok {
+		return importDockerArchive(ctx, store, archivePath, files, opts)
+	}
+	return nil, errors.New("archive contains neither index.json nor manifest.json")
+}
+
+// readArchiveMetadata 读取归档中不超过 archiveBufferLimit 的文件
+func readArchiveMetadata(archivePath string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := walkArchive(archivePath, func(name string, size int64, r io.Reader) error {
+		if size > archiveBufferLimit {
+			return nil
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		files[name] = data
+		return nil
+	})
+	return files, err
+}
+
+// walkArchive 依次处理归档中的普通文件，文件名去掉开头的 ./
+func walkArchive(archivePath string, fn func(name string, size int64, r io.Reader) error) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(path.Clean(strings.TrimPrefix(header.Name, "./")), header.Size, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func importOCIArchive(ctx context.Context, store storage.Storage, archivePath string, files map[string][]byte, opts ImportOptions) (*ImportResult, error) {
+	var index archiveIndex
+	if err := json.Unmarshal(files[archiveIndexFile], &index); err != nil {
+		return nil, fmt.Errorf("failed to parse index.json: %v", err)
+	}
+
+	var images []importImage
+	for _, descriptor := range index.Manifests {
+		repository, tag := parseImageReference(descriptor.Annotations[annotationImageName])
+		if opts.Repository != "" {
+			repository = opts.Repository
+			if tag == "" {
+				tag = descriptor.Annotations[annotationRefName]
+			}
+		}
+		if repository == "" {
+			return nil, fmt.Errorf("manifest %s has no image name, specify a repository", descriptor.Digest)
+		}
+		if err := validImportTarget(repository, tag); err != nil {
+			return nil, err
+		}
+		images = append(images, importImage{repository: repository, tag: tag, digest: descriptor.Digest})
+	}
+
+	// 解析清单，得到每个 blob 需要导入的仓库，清单按子清单在前的顺序写入
+	blobRepositories := make(map[string][]string)
+	type importManifest struct {
+		repository string
+		digest     string
+	}
+	var manifests []importManifest
+	visited := make(map[string]bool)
+	var walk func(repository, digest string) error
+	walk = func(repository, digest string) error {
+		if visited[repository+"@"+digest] {
+			return nil
+		}
+		visited[repository+"@"+digest] = true
+		data, ok := files[blobPath(digest)]
+		if !ok {
+			return fmt.Errorf("manifest %s not found in archive", digest)
+		}
+		if actual := fmt.Sprintf("sha256:%x", sha256.Sum256(data)); actual != digest {
+			return fmt.Errorf("manifest %s has digest %s", digest, actual)
+		}
+		var manifest gcManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return fmt.Errorf("failed to parse manifest %s: %v", digest, err)
+		}
+		for _, child := range manifest.Manifests {
+			if err := walk(repository, child.Digest); err != nil {
+				return err
+			}
+		}
+		var blobs []string
+		if manifest.Config.Digest != "" {
+			blobs = append(blobs, manifest.Config.Digest)
+		}
+		for _, layer := range manifest.Layers {
+			blobs = append(blobs, layer.Digest)
+		}
+		for _, blob := range blobs {
+			if !containsString(blobRepositories[blob], repository) {
+				blobRepositories[blob] = append(blobRepositories[blob], repository)
+			}
+		}
+		manifests = append(manifests, importManifest{repository: repository, digest: digest})
+		return nil
+	}
+	for _, image := range images {
+		if !repositoryNamePattern.MatchString(image.repository) {
+			return nil, fmt.Errorf("invalid repository name %s", image.repository)
+		}
+		if err := walk(image.repository, image.digest); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ImportResult{Images: []string{}}
+	imported := make(map[string]bool)
+	err := walkArchive(archivePath, func(name string, size int64, r io.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		digest := strings.Replace(strings.TrimPrefix(name, "blobs/"), "/", ":", 1)
+		repositories, ok := blobRepositories[digest]
+		if !ok || imported[digest] {
+			return nil
+		}
+		if err := importBlob(store, repositories, digest, size, newDigestVerifier(r, digest)); err != nil {
+			return err
+		}
+		imported[digest] = true
+		result.Blobs++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for digest := range blobRepositories {
+		if !imported[digest] {
+			return nil, fmt.Errorf("blob %s not found in archive", digest)
+		}
+	}
+
+	for _, manifest := range manifests {
+		if err := store.PutManifest(manifest.repository, manifest.digest, manifest.digest, files[blobPath(manifest.digest)]); err != nil {
+			return nil, fmt.Errorf("failed to put manifest %s@%s: %v", manifest.repository, manifest.digest, err)
+		}
+	}
+	for _, image := range images {
+		if image.tag == "" {
+			result.Images = append(result.Images, image.repository+"@"+image.digest)
+			continue
+		}
+		if err := store.PutManifest(image.repository, image.tag, image.digest, files[blobPath(image.digest)]); err != nil {
+			return nil, fmt.Errorf("failed to put tag %s:%s: %v", image.repository, image.tag, err)
+		}
+		result.Images = append(result.Images, image.repository+":"+image.tag)
+	}
+	return result, nil
+}
+
+// importBlob 把 blob 写入第一个仓库并挂载到其他仓库，已存在的 blob 跳过
+func importBlob(store storage.Storage, repositories []string, digest string, size int64, r io.Reader) error {
+	first := repositories[0]
+	if existing, err := store.GetBlobSize(first, digest); err != nil || existing != size {
+		if _, err := store.PutBlob(first, digest, r); err != nil {
+			return fmt.Errorf("failed to import blob %s: %v", digest, err)
+		}
+	}
+	for _, repository := range repositories[1:] {
+		if err := store.MountBlob(repository, first, digest); err != nil {
+			return fmt.Errorf("failed to mount blob %s to %s: %v", digest, repository, err)
+		}
+	}
+	return nil
+}
+
+// importDockerArchive 导入旧版 docker save 归档，层是未压缩的 tar，摘要在导入时计算，
+// 然后为每个镜像生成 Docker 清单
+func importDockerArchive(ctx context.Context, store storage.Storage, archivePath string, files map[string][]byte, opts ImportOptions) (*ImportResult, error) {
+	var dockerImages []archiveDockerImage
+	if err := json.Unmarshal(files[archiveManifestFile], &dockerImages); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest.json: %v", err)
+	}
+
+	// 每个层文件需要导入的仓库
+	layerRepositories := make(map[string][]string)
+	imageRepositories := make([][]importImage, len(dockerImages))
+	for i, image := range dockerImages {
+		if _, ok := files[path.Clean(image.Config)]; !ok {
+			return nil, fmt.Errorf("image config %s not found in archive", image.Config)
+		}
+		for _, repoTag := range image.RepoTags {
+			repository, tag := parseImageReference(repoTag)
+			if opts.Repository != "" {
+				repository = opts.Repository
+			}
+			if err := validImportTarget(repository, tag); err != nil {
+				return nil, err
+			}
+			imageRepositories[i] = append(imageRepositories[i], importImage{repository: repository, tag: tag})
+		}
+		if len(imageRepositories[i]) == 0 {
+			if opts.Repository == "" {
+				return nil, fmt.Errorf("image %s has no repository tag, specify a repository", image.Config)
+			}
+			imageRepositories[i] = []importImage{{repository: opts.Repository}}
+		}
+		for _, layer := range image.Layers {
+			for _, target := range imageRepositories[i] {
+				if !containsString(layerRepositories[path.Clean(layer)], target.repository) {
+					layerRepositories[path.Clean(layer)] = append(layerRepositories[path.Clean(layer)], target.repository)
+				}
+			}
+		}
+	}
+
+	result := &ImportResult{Images: []string{}}
+	layers := make(map[string]archiveDescriptor)
+	err := walkArchive(archivePath, func(name string, size int64, r io.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		repositories, ok := layerRepositories[name]
+		if !ok {
+			return nil
+		}
+		digest, err := importLayer(store, repositories[0], r)
+		if err != nil {
+			return err
+		}
+		for _, repository := range repositories[1:] {
+			if err := store.MountBlob(repository, repositories[0], digest); err != nil {
+				return fmt.Errorf("failed to mount blob %s to %s: %v", digest, repository, err)
+			}
+		}
+		layers[name] = archiveDescriptor{MediaType: mediaTypeDockerLayerTar, Digest: digest, Size: size}
+		result.Blobs++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, image := range dockerImages {
+		config := files[path.Clean(image.Config)]
+		manifest := struct {
+			SchemaVersion int                 `json:"schemaVersion"`
+			MediaType     string              `json:"mediaType"`
+			Config        archiveDescriptor   `json:"config"`
+			Layers        []archiveDescriptor `json:"layers"`
+		}{
+			SchemaVersion: 2,
+			MediaType:     MediaTypeManifestV2,
+			Config:        archiveDescriptor{MediaType: mediaTypeDockerConfig, Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(config)), Size: int64(len(config))},
+			Layers:        []archiveDescriptor{},
+		}
+		for _, layer := range image.Layers {
+			descriptor, ok := layers[path.Clean(layer)]
+			if !ok {
+				return nil, fmt.Errorf("layer %s not found in archive", layer)
+			}
+			manifest.Layers = append(manifest.Layers, descriptor)
+		}
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			return nil, err
+		}
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+
+		for _, target := range imageRepositories[i] {
+			if _, err := store.PutBlob(target.repository, manifest.Config.Digest, bytes.NewReader(config)); err != nil {
+				return nil, fmt.Errorf("failed to import image config %s: %v", manifest.Config.Digest, err)
+			}
+			reference := target.tag
+			if reference == "" {
+				reference = digest
+			}
+			if err := store.PutManifest(target.repository, reference, digest, data); err != nil {
+				return nil, fmt.Errorf("failed to put manifest %s:%s: %v", target.repository, reference, err)
+			}
+			if target.tag == "" {
+				result.Images = append(result.Images, target.repository+"@"+digest)
+			} else {
+				result.Images = append(result.Images, target.repository+":"+target.tag)
+			}
+		}
+		result.Blobs++
+	}
+	sort.Strings(result.Images)
+	return result, nil
+}
+
+// importLayer 通过上传接口写入层并计算摘要，层的摘要在读完之前未知
+func importLayer(store storage.Storage, repository string, r io.Reader) (string, error) {
+	uploadID, err := generateUploadID()
+	if err != nil {
+		return "", err
+	}
+	if err := store.InitiateUpload(repository, uploadID); err != nil {
+		return "", fmt.Errorf("failed to initiate upload: %v", err)
+	}
+	hasher := sha256.New()
+	if _, err := store.AppendToUpload(repository, uploadID, io.TeeReader(r, hasher)); err != nil {
+		store.CancelUpload(repository, uploadID)
+		return "", fmt.Errorf("failed to import layer: %v", err)
+	}
+	digest := fmt.Sprintf("sha256:%x", hasher.Sum(nil))
+	if err := store.CompleteUpload(repository, uploadID, digest, http.NoBody); err != nil {
+		return "", fmt.Errorf("failed to import layer: %v", err)
+	}
+	return digest, nil
+}
+
+// validImportTarget 校验归档中的仓库名和标签，标签来自归档内容，存储会把它拼接为路径
+func validImportTarget(repository, tag string) error {
+	if !repositoryNamePattern.MatchString(repository) {
+		return fmt.Errorf("invalid repository name %s", repository)
+	}
+	if tag != "" && !tagPattern.MatchString(tag) {
+		return fmt.Errorf("invalid tag %q", tag)
+	}
+	return nil
+}
+
+// parseImageReference 把 [registry/]repository[:tag] 拆分为仓库名和标签，
+// 第一段包含 . 或 : 或者是 localhost 时视为仓库地址并去掉
+func parseImageReference(ref string) (string, string) {
+	ref, _, _ = strings.Cut(ref, "@")
+	if first, rest, ok := strings.Cut(ref, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref = rest
+	}
+	repository, tag := ref, ""
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		repository, tag = ref[:i], ref[i+1:]
+	}
+	return repository, tag
+}
@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src := storage.NewMemoryStorage()
+	seedGCRepository(t, src)
+
+	var buf bytes.Buffer
+	if err := ExportArchive(context.Background(), src, &buf, []string{"app:v1"}); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"io.containerd.image.name":"app:v1"`, `"RepoTags":["app:v1"]`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("Archive does not contain %s", want)
+		}
+	}
+
+	dst := storage.NewMemoryStorage()
+	result, err := ImportArchive(context.Background(), dst, archive, ImportOptions{Repository: "copy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Images, ",") != "copy:v1" || result.Blobs != 2 {
+		t.Fatalf("Unexpected import result %+v", result)
+	}
+	want, _, _ := src.GetManifest("app", "v1")
+	if got, _, err := dst.GetManifest("copy", "v1"); err != nil || string(got) != string(want) {
+		t.Fatalf("Unexpected imported manifest %s: %v", got, err)
+	}
+	if blobs, _ := dst.ListBlobs("copy"); len(blobs) != 2 {
+		t.Fatalf("Expected only referenced blobs to be imported, got %v", blobs)
+	}
+}
+
+func TestImportDockerArchive(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, data := range map[string]string{
+		"manifest.json":    `[{"Config":"config.json","RepoTags":["docker.io/library/busybox:1.36"],"Layers":["layer1/layer.tar"]}]`,
+		"config.json":      `{"architecture":"amd64","os":"linux"}`,
+		"layer1/layer.tar": "layer data",
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+	archive := filepath.Join(t.TempDir(), "busybox.tar")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := storage.NewMemoryStorage()
+	result, err := ImportArchive(context.Background(), store, archive, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Images, ",") != "library/busybox:1.36" {
+		t.Fatalf("Unexpected import result %+v", result)
+	}
+	manifest, _, err := store.GetManifest("library/busybox", "1.36")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifest), digestOf("layer data")) || !strings.Contains(string(manifest), digestOf(`{"architecture":"amd64","os":"linux"}`)) {
+		t.Fatalf("Unexpected manifest %s", manifest)
+	}
+	if size, err := store.GetBlobSize("library/busybox", digestOf("layer data")); err != nil || size != int64(len("layer data")) {
+		t.Fatalf("Layer was not imported: %v", err)
+	}
+}
+
+func TestImportArchiveRejectsInvalidTags(t *testing.T) {
+	tests := map[string]map[string]string{
+		"oci": {
+			"oci-layout": `{"imageLayoutVersion":"1.0.0"}`,
+			"index.json": `{"schemaVersion":2,"manifests":[{"digest":"` + digestOf("manifest") + `","annotations":{"org.opencontainers.image.ref.name":"../../../escape"}}]}`,
+		},
+		"docker": {
+			"manifest.json": `[{"Config":"config.json","RepoTags":["busybox:.hidden"],"Layers":[]}]`,
+			"config.json":   `{}`,
+		},
+	}
+	for name, files := range tests {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for file, data := range files {
+			tw.WriteHeader(&tar.Header{Name: file, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(data))
+		}
+		tw.Close()
+		archive := filepath.Join(t.TempDir(), name+".tar")
+		if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		store := storage.NewMemoryStorage()
+		if _, err := ImportArchive(context.Background(), store, archive, ImportOptions{Repository: "app"}); err == nil || !strings.Contains(err.Error(), "invalid tag") {
+			t.Errorf("%s: expected invalid tag error, got %v", name, err)
+		}
+		if tags, _ := store.ListTags("app"); len(tags) != 0 {
+			t.Errorf("%s: expected nothing to be imported, got %v", name, tags)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTokenExpiry 令牌响应没有 expires_in 时的有效期，与 Docker 令牌规范一致
+	defaultTokenExpiry = 60 * time.Second
+	// tokenExpiryMargin 提前刷新令牌，避免请求途中过期
+	tokenExpiryMargin = 10 * time.Second
+)
+
+// bearerToken 缓存的上游令牌
+type bearerToken struct {
+	token   string
+	expires time.Time
+}
+
+// tokenTransport 处理上游的认证质询
+// 客户端自带 Authorization 时原样转发；否则使用缓存的令牌，收到 WWW-Authenticate: Bearer 质询时
+// 用配置的凭据 (未配置时匿名) 向质询中的 realm 申请令牌并重试，令牌按作用域缓存到过期为止。
+// 质询为 Basic 时直接使用配置的凭据重试，之后发往该主机的请求直接带上凭据。
+// 推送的请求体通常无法重放，发送前先用 /v2/ 的质询取得凭据
+type tokenTransport struct {
+	base http.RoundTripper
+	// credentials 返回配置的用户名和密码，每个请求调用一次，引用环境变量或文件的凭据轮换后立即生效
+	credentials func() (string, string, error)
+
+	mu     sync.Mutex
+	tokens map[string]bearerToken
+	basic  map[string]bool // 使用 Basic 认证的主机
+}
+
+func newTokenTransport(base http.RoundTripper, username, password string) *tokenTransport {
+	return newTokenTransportWithCredentials(base, func() (string, string, error) {
+		return username, password, nil
+	})
+}
+
+func newTokenTransportWithCredentials(base http.RoundTripper, credentials func() (string, string, error)) *tokenTransport {
+	return &tokenTransport{
+		base:        base,
+		credentials: credentials,
+		tokens:      make(map[string]bearerToken),
+		basic:       make(map[string]bool),
+	}
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	username, password, err := t.credentials()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve upstream credentials: %v", err)
+	}
+
+	key := req.URL.Host + " " + requestScope(req)
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	if token, ok := t.cachedToken(key); ok {
+		req = withAuthorization(req, "Bearer "+token)
+	} else if username != "" && password != "" && t.usesBasic(req.URL.Host) {
+		req = withAuthorization(req, basicAuthorization(username, password))
+	} else if !replayable && username != "" {
+		if authorization, err := t.preflight(req, key, username, password); err != nil {
+			log.Printf("Failed to authenticate %s %s before sending body: %v", req.Method, req.URL.Path, err)
+		} else if authorization != "" {
+			req = withAuthorization(req, authorization)
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// 请求体已经被读取且无法重建时不能重试
+	if !replayable {
+		return resp, nil
+	}
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	var authorization string
+	switch scheme {
+	case "bearer":
+		token, err := t.fetchToken(req, params, key, username, password)
+		if err != nil {
+			log.Printf("Failed to fetch upstream token for %s: %v", key, err)
+			return resp, nil
+		}
+		authorization = "Bearer " + token
+	case "basic":
+		if username == "" || password == "" {
+			return resp, nil
+		}
+		authorization = basicAuthorization(username, password)
+		t.mu.Lock()
+		t.basic[req.URL.Host] = true
+		t.mu.Unlock()
+	default:
+		return resp, nil
+	}
+
+	retry := withAuthorization(req, authorization)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	resp.Body.Close()
+	return t.base.RoundTrip(retry)
+}
+
+// usesBasic 主机是否使用 Basic 认证
+func (t *tokenTransport) usesBasic(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.basic[host]
+}
+
+// preflight 向上游的 /v2/ 发送不带请求体的请求取得认证质询，返回请求应使用的 Authorization
+// 上游不要求认证时返回空字符串
+func (t *tokenTransport) preflight(req *http.Request, key, username, password string) (string, error) {
+	u := *req.URL
+	i := strings.Index(u.Path, "/v2/")
+	if i < 0 {
+		return "", nil
+	}
+	u.Path, u.RawPath, u.RawQuery = u.Path[:i]+"/v2/", "", ""
+	ping, err := http.NewRequestWithContext(req.Context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.base.RoundTrip(ping)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return "", nil
+	}
+
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	switch scheme {
+	case "bearer":
+		// /v2/ 的质询不带作用域，按原请求的路径申请推送权限
+		delete(params, "scope")
+		token, err := t.fetchToken(req, params, key, username, password)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	case "basic":
+		if password == "" {
+			return "", nil
+		}
+		t.mu.Lock()
+		t.basic[req.URL.Host] = true
+		t.mu.Unlock()
+		return basicAuthorization(username, password), nil
+	}
+	return "", nil
+}
+
+// cachedToken 返回未过期的令牌
+func (t *tokenTransport) cachedToken(key string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, ok := t.tokens[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(token.expires) {
+		delete(t.tokens, key)
+		return "", false
+	}
+	return token.token, true
+}
+
+// fetchToken 按质询参数向认证服务申请令牌，结果缓存在 key 下
+func (t *tokenTransport) fetchToken(req *http.Request, params map[string]string, key, username, password string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" || realm.Host == "" {
+		return "", fmt.Errorf("invalid realm %q", params["realm"])
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	// 质询没有给出作用域时 (例如 /v2/ 版本检查) 按请求路径推断
+	scope := params["scope"]
+	if scope == "" {
+		scope = requestScope(req)
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	realm.RawQuery = query.Encode()
+
+	tokenReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" && password != "" {
+		tokenReq.SetBasicAuth(username, password)
+	}
+	resp, err := t.base.RoundTrip(tokenReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var body struct {
+		Token       string    `json:"token"`
+		AccessToken string    `json:"access_token"`
+		ExpiresIn   int       `json:"expires_in"`
+		IssuedAt    time.Time `json:"issued_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %v", err)
+	}
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	if token == "" {
+		return "", fmt.Errorf("token response contains no token")
+	}
+
+	expiresIn := defaultTokenExpiry
+	if body.ExpiresIn > 0 {
+		expiresIn = time.Duration(body.ExpiresIn) * time.Second
+	}
+	issuedAt := body.IssuedAt
+	if issuedAt.IsZero() || issuedAt.After(time.Now()) {
+		issuedAt = time.Now()
+	}
+	t.mu.Lock()
+	t.tokens[key] = bearerToken{token: token, expires: issuedAt.Add(expiresIn - tokenExpiryMargin)}
+	t.mu.Unlock()
+	return token, nil
+}
+
+// requestScope 根据请求路径推断令牌作用域，例如 repository:library/nginx:pull
+func requestScope(req *http.Request) string {
+	name, _, ok := splitRepositoryPath(req.URL.Path)
+	if !ok {
+		return ""
+	}
+	actions := "pull"
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		actions = "pull,push"
+	}
+	return "repository:" + name + ":" + actions
+}
+
+// parseChallenge 解析 WWW-Authenticate 头，返回小写的认证方案和参数
+// 例如 Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		name, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			// 带引号的值中可能包含逗号，例如多个作用域
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[name] = value[1:]
+				break
+			}
+			params[name] = value[1 : end+1]
+			rest = value[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			params[name] = strings.TrimSpace(value)
+		}
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+		rest = strings.TrimSpace(rest)
+	}
+	return strings.ToLower(scheme), params
+}
+
+// withAuthorization 复制请求并设置 Authorization，RoundTripper 不能修改原始请求
+func withAuthorization(req *http.Request, authorization string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", authorization)
+	return clone
+}
+
+func basicAuthorization(username, password string) string {
+	req := &http.Request{Header: make(http.Header)}
+	req.SetBasicAuth(username, password)
+	return req.Header.Get("Authorization")
+}
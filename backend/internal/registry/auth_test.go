@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull,push"`)
+	if scheme != "bearer" {
+		t.Fatalf("unexpected scheme %q", scheme)
+	}
+	want := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/nginx:pull,push",
+	}
+	for k, v := range want {
+		if params[k] != v {
+			t.Errorf("expected %s=%q, got %q", k, v, params[k])
+		}
+	}
+
+	if scheme, params := parseChallenge(`Basic realm=registry`); scheme != "basic" || params["realm"] != "registry" {
+		t.Fatalf("unexpected basic challenge %q %v", scheme, params)
+	}
+}
+
+func TestTokenTransport(t *testing.T) {
+	var tokenRequests atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests.Add(1)
+			user, pass, _ := r.BasicAuth()
+			if user != "alice" || pass != "secret" || r.URL.Query().Get("scope") != "repository:library/app:pull" || r.URL.Query().Get("service") != "test" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"token":"t1","expires_in":300}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer t1" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test",scope="repository:library/app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: newTokenTransport(http.DefaultTransport, "alice", "secret")}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL + "/v2/library/app/manifests/latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+	}
+	// 第二次请求使用缓存的令牌
+	if tokenRequests.Load() != 1 {
+		t.Fatalf("expected 1 token request, got %d", tokenRequests.Load())
+	}
+
+	// 客户端自带的认证信息原样转发
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v2/library/app/manifests/latest", nil)
+	req.Header.Set("Authorization", "Bearer client-token")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected client credentials to be passed through, got %d", resp.StatusCode)
+	}
+}
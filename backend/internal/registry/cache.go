@@ -0,0 +1,518 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+const (
+	// maxCachedManifestSize 缓存的清单大小上限
+	maxCachedManifestSize = 4 << 20
+	// authorizationTTL 上游确认客户端可以读取仓库后，在这段时间内直接返回缓存，不再重复确认
+	authorizationTTL = time.Minute
+	// authorizationStaleTTL 上游不可用时，在这段时间内确认过的客户端仍然可以读取缓存
+	authorizationStaleTTL = 24 * time.Hour
+	// maxAuthorizations 记录的确认结果超过该数量时清理过期的记录
+	maxAuthorizations = 10000
+)
+
+var sha256DigestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// hopHeaders 转发上游响应时不复制的逐跳头
+var hopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// pullThroughCache 拉取缓存，在反向代理之前处理清单和 blob 的 GET/HEAD 请求
+// blob 和按摘要引用的清单内容不可变，命中后直接从本地返回；按标签引用的清单每次都向上游发送条件请求，
+// 确认标签未变化后才返回缓存，上游不可用时返回旧的缓存。其他请求交给 next 转发。
+// 缓存的内容可能来自私有仓库，返回缓存或加入其他客户端发起的下载之前，先用客户端自己的认证信息向上游确认可以读取该仓库
+type pullThroughCache struct {
+	namespace string // 缓存中仓库名称的前缀，区分不同上游的同名仓库
+	upstream  *url.URL
+	rewriter  *repositoryRewriter
+	client    *http.Client
+	// authClient 确认权限时使用，不跟随重定向，blob 跳转到对象存储即表示有权读取
+	authClient *http.Client
+	cache      storage.Storage
+	next       http.Handler
+
+	flightsMu sync.Mutex
+	flights   map[string]*blobFlight
+
+	// authorized 凭据和仓库 -> 上游最近一次确认可以读取的时间
+	authMu     sync.Mutex
+	authorized map[string]time.Time
+}
+
+// newPullThroughCache 创建拉取缓存，缓存按上游主机划分命名空间
+func newPullThroughCache(upstream *url.URL, transport http.RoundTripper, rewriter *repositoryRewriter, cache storage.Storage, next http.Handler) *pullThroughCache {
+	return &pullThroughCache{
+		namespace: upstream.Host,
+		upstream:  upstream,
+		rewriter:  rewriter,
+		client:    &http.Client{Transport: transport},
+		authClient: &http.Client{
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cache:      cache,
+		next:       next,
+		flights:    make(map[string]*blobFlight),
+		authorized: make(map[string]time.Time),
+	}
+}
+
+func (p *pullThroughCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		p.next.ServeHTTP(w, r)
+		return
+	}
+
+	name, kind, reference, ok := parseRegistryPath(r.URL.Path)
+	if !ok {
+		p.next.ServeHTTP(w, r)
+		return
+	}
+	// 缓存按客户端请求的仓库名称保存，改写规则只影响发往上游的请求
+	repository := p.namespace + "/" + name
+
+	switch {
+	case kind == "manifests":
+		p.serveManifest(w, r, repository, reference)
+	case kind == "blobs" && sha256DigestPattern.MatchString(reference):
+		p.serveBlob(w, r, repository, reference)
+	default:
+		p.next.ServeHTTP(w, r)
+	}
+}
+
+// parseRegistryPath 解析 /v2/<name>/manifests/<reference> 和 /v2/<name>/blobs/<digest>
+func parseRegistryPath(path string) (name, kind, reference string, ok bool) {
+	if !strings.HasPrefix(path, "/v2/") {
+		return "", "", "", false
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/v2/"), "/"), "/")
+	if len(parts) < 3 {
+		return "", "", "", false
+	}
+	kind = parts[len(parts)-2]
+	if kind != "manifests" && kind != "blobs" {
+		return "", "", "", false
+	}
+	reference = parts[len(parts)-1]
+	name = strings.Join(parts[:len(parts)-2], "/")
+	return name, kind, reference, name != "" && reference != ""
+}
+
+// serveManifest 返回清单，按标签引用时先向上游确认缓存是否仍然有效
+func (p *pullThroughCache) serveManifest(w http.ResponseWriter, r *http.Request, repository, reference string) {
+	var cached []byte
+	var digest string
+	// 客户端不接受缓存清单的格式时 (例如只支持单架构清单) 按未命中处理
+	if data, d, err := p.cache.GetManifest(repository, reference); err == nil && acceptsMediaType(r, detectManifestMediaType(data)) {
+		cached, digest = data, d
+	}
+
+	if cached == nil {
+		if r.Method == http.MethodHead {
+			p.next.ServeHTTP(w, r)
+			return
+		}
+		p.fetchManifest(w, r, repository, reference)
+		return
+	}
+	if sha256DigestPattern.MatchString(reference) {
+		if p.authorize(w, r, repository) {
+			writeManifest(w, r, cached, digest)
+		}
+		return
+	}
+
+	// 用 HEAD 确认，避免消耗 Docker Hub 按 GET 计算的拉取次数
+	req := p.upstreamRequest(r, http.MethodHead)
+	req.Header.Set("If-None-Match", `"`+digest+`"`)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if p.checkAuthorization(r, repository) == authorizationStale {
+			log.Printf("Failed to revalidate manifest %s:%s, serving cached copy: %v", repository, reference, err)
+			writeManifest(w, r, cached, digest)
+			return
+		}
+		http.Error(w, "Registry proxy error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified,
+		resp.StatusCode == http.StatusOK && resp.Header.Get("Docker-Content-Digest") == digest:
+		p.recordAuthorization(r, repository)
+		writeManifest(w, r, cached, digest)
+	case resp.StatusCode == http.StatusOK:
+		// 标签已指向新的清单
+		if r.Method == http.MethodHead {
+			p.next.ServeHTTP(w, r)
+			return
+		}
+		p.fetchManifest(w, r, repository, reference)
+	case (resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests) &&
+		p.checkAuthorization(r, repository) == authorizationStale:
+		// 只有之前确认过可以读取该仓库的客户端才能在上游不可用时拿到旧的缓存
+		log.Printf("Upstream returned %d for manifest %s:%s, serving cached copy", resp.StatusCode, repository, reference)
+		writeManifest(w, r, cached, digest)
+	default:
+		// 401、404 等表示客户端无权访问或标签已被删除，不能返回缓存，转发原始请求以便客户端拿到完整的错误响应
+		p.next.ServeHTTP(w, r)
+	}
+}
+
+// fetchManifest 从上游获取清单，校验摘要后写入缓存
+func (p *pullThroughCache) fetchManifest(w http.ResponseWriter, r *http.Request, repository, reference string) {
+	resp, err := p.client.Do(p.upstreamRequest(r, http.MethodGet))
+	if err != nil {
+		http.Error(w, "Registry proxy error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		copyResponse(w, resp)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedManifestSize+1))
+	if err != nil {
+		http.Error(w, "Registry proxy error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if len(data) > maxCachedManifestSize {
+		http.Error(w, "Registry proxy error: manifest too large", http.StatusBadGateway)
+		return
+	}
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	upstreamDigest := resp.Header.Get("Docker-Content-Digest")
+	switch {
+	case upstreamDigest != "" && upstreamDigest != digest:
+		log.Printf("Not caching manifest %s:%s: upstream digest %s does not match content digest %s", repository, reference, upstreamDigest, digest)
+	case sha256DigestPattern.MatchString(reference) && reference != digest:
+		log.Printf("Not caching manifest %s:%s: content digest is %s", repository, reference, digest)
+	default:
+		if err := p.cache.PutManifest(repository, reference, digest, data); err != nil {
+			log.Printf("Failed to cache manifest %s:%s: %v", repository, reference, err)
+		}
+	}
+	p.recordAuthorization(r, repository)
+
+	copyHeader(w.Header(), resp.Header)
+	if upstreamDigest == "" {
+		w.Header().Set("Docker-Content-Digest", digest)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// serveBlob 返回 blob，未命中时从上游下载，同时写给客户端和缓存
+func (p *pullThroughCache) serveBlob(w http.ResponseWriter, r *http.Request, repository, digest string) {
+	reader, size, err := p.cache.GetBlob(repository, digest)
+	if err == nil {
+		defer reader.Close()
+		if !p.authorize(w, r, repository) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Etag", `"`+digest+`"`)
+		// 文件存储支持 Seek，可以处理断点续传的 Range 请求
+		if rs, ok := reader.(io.ReadSeeker); ok {
+			http.ServeContent(w, r, "", time.Time{}, rs)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			copyStream(w, reader)
+		}
+		return
+	}
+
+	// 只有完整的 GET 才写入缓存，HEAD 和 Range 请求直接转发
+	// 客户端续传时如果该 blob 正在下载，从已下载的部分返回
+	if r.Method == http.MethodHead {
+		p.next.ServeHTTP(w, r)
+		return
+	}
+	if r.Header.Get("Range") != "" {
+		if f := p.activeFlight(repository, digest); f != nil {
+			defer f.release()
+			if f.identity != credentialIdentity(r) && !p.authorize(w, r, repository) {
+				return
+			}
+			if p.serveFlightRange(w, r, f, digest) {
+				return
+			}
+		}
+		p.next.ServeHTTP(w, r)
+		return
+	}
+
+	// 同一个 blob 的并发请求共用一次上游下载
+	f, err := p.joinBlobFlight(r, repository, digest)
+	if err != nil {
+		log.Printf("Failed to start blob download %s@%s: %v", repository, digest, err)
+		p.next.ServeHTTP(w, r)
+		return
+	}
+	defer f.release()
+	// 下载以发起请求的客户端的认证信息进行，其他凭据的客户端需要先确认自己可以读取
+	if f.identity != credentialIdentity(r) && !p.authorize(w, r, repository) {
+		return
+	}
+
+	select {
+	case <-f.ready:
+	case <-r.Context().Done():
+		return
+	}
+	if f.status != http.StatusOK {
+		// 上游返回的错误可能与发起下载的客户端的凭据有关，各自转发原始请求
+		p.next.ServeHTTP(w, r)
+		return
+	}
+	if f.identity == credentialIdentity(r) {
+		p.recordAuthorization(r, repository)
+	}
+
+	copyHeader(w.Header(), f.header)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusOK)
+	copyStream(w, &flightReader{flight: f})
+}
+
+// serveFlightRange 从进行中的下载返回客户端请求的范围，返回 false 时由调用方转发到上游
+// 只支持单个有效范围，其他范围和 If-Range 与 blob 的摘要或上游的 ETag 不一致时返回 false
+func (p *pullThroughCache) serveFlightRange(w http.ResponseWriter, r *http.Request, f *blobFlight, digest string) bool {
+	select {
+	case <-f.ready:
+	case <-r.Context().Done():
+		return true
+	}
+	if f.status != http.StatusOK {
+		return false
+	}
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != `"`+digest+`"` && ifRange != f.header.Get("Etag") {
+		return false
+	}
+	total, err := strconv.ParseInt(f.header.Get("Content-Length"), 10, 64)
+	if err != nil || total <= 0 {
+		return false
+	}
+	start, end, ok := parseSingleRange(r.Header.Get("Range"), total)
+	if !ok {
+		return false
+	}
+
+	copyHeader(w.Header(), f.header)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, total))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	copyStream(w, io.LimitReader(&flightReader{flight: f, offset: start}, end-start+1))
+	return true
+}
+
+// parseSingleRange 解析 bytes=start-end、bytes=start- 和 bytes=-suffix 形式的单个范围
+func parseSingleRange(header string, total int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false
+	}
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, false
+		}
+		if suffix > total {
+			suffix = total
+		}
+		return total - suffix, total - 1, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= total {
+		return 0, 0, false
+	}
+	end := total - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= total {
+			end = total - 1
+		}
+	}
+	return start, end, true
+}
+
+// authorizationState 客户端凭据对某个仓库的确认状态
+type authorizationState int
+
+const (
+	authorizationUnknown authorizationState = iota
+	// authorizationStale 确认过但已超过 authorizationTTL，只在上游不可用时使用
+	authorizationStale
+	authorizationFresh
+)
+
+// credentialIdentity 客户端凭据的标识，Authorization 头的摘要，没有认证信息的客户端为 anonymous
+func credentialIdentity(r *http.Request) string {
+	values := r.Header.Values("Authorization")
+	if len(values) == 0 {
+		return "anonymous"
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(values, "\n"))))
+}
+
+// checkAuthorization 返回客户端凭据对仓库的确认状态
+func (p *pullThroughCache) checkAuthorization(r *http.Request, repository string) authorizationState {
+	p.authMu.Lock()
+	checked, ok := p.authorized[credentialIdentity(r)+" "+repository]
+	p.authMu.Unlock()
+	switch {
+	case ok && time.Since(checked) < authorizationTTL:
+		return authorizationFresh
+	case ok && time.Since(checked) < authorizationStaleTTL:
+		return authorizationStale
+	}
+	return authorizationUnknown
+}
+
+// recordAuthorization 记录上游确认客户端凭据可以读取仓库，记录过多时清理过期的记录
+func (p *pullThroughCache) recordAuthorization(r *http.Request, repository string) {
+	p.authMu.Lock()
+	defer p.authMu.Unlock()
+	if len(p.authorized) >= maxAuthorizations {
+		for key, checked := range p.authorized {
+			if time.Since(checked) >= authorizationStaleTTL {
+				delete(p.authorized, key)
+			}
+		}
+	}
+	p.authorized[credentialIdentity(r)+" "+repository] = time.Now()
+}
+
+// authorize 确认客户端可以从上游读取该仓库：用客户端自己的认证信息对请求的路径发送 HEAD，
+// 成功的结果按凭据和仓库缓存 authorizationTTL。上游不可用时只接受之前确认过的凭据。
+// 返回 false 时已把原始请求转发给上游，客户端收到上游的 401、404 等错误响应
+func (p *pullThroughCache) authorize(w http.ResponseWriter, r *http.Request, repository string) bool {
+	state := p.checkAuthorization(r, repository)
+	if state == authorizationFresh {
+		return true
+	}
+
+	resp, err := p.authClient.Do(p.upstreamRequest(r, http.MethodHead))
+	if err == nil {
+		resp.Body.Close()
+	}
+	switch {
+	case err == nil && resp.StatusCode < http.StatusBadRequest:
+		p.recordAuthorization(r, repository)
+		return true
+	case (err != nil || resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests) &&
+		state == authorizationStale:
+		log.Printf("Upstream unavailable, serving cached %s to a previously authorized client", repository)
+		return true
+	}
+	p.next.ServeHTTP(w, r)
+	return false
+}
+
+// upstreamRequest 创建发往上游的请求，保留客户端的认证信息和 Accept 头，上游认证由 tokenTransport 处理
+func (p *pullThroughCache) upstreamRequest(r *http.Request, method string) *http.Request {
+	u := *p.upstream
+	u.Path = strings.TrimSuffix(u.Path, "/") + p.rewriter.rewritePath(r.URL.Path)
+	u.RawQuery = r.URL.RawQuery
+
+	req := (&http.Request{Method: method, URL: &u, Header: make(http.Header), Host: u.Host}).WithContext(r.Context())
+	for _, key := range []string{"Authorization", "Accept", "User-Agent"} {
+		for _, v := range r.Header.Values(key) {
+			req.Header.Add(key, v)
+		}
+	}
+	return req
+}
+
+// writeManifest 返回缓存的清单，客户端的条件请求命中时返回 304
+func writeManifest(w http.ResponseWriter, r *http.Request, data []byte, digest string) {
+	w.Header().Set("Content-Type", detectManifestMediaType(data))
+	w.Header().Set("Docker-Content-Digest", digest)
+	if writeNotModified(w, r, digest, time.Time{}) {
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+// acceptsMediaType 判断客户端的 Accept 头是否接受该媒体类型，没有 Accept 头时视为接受
+func acceptsMediaType(r *http.Request, mediaType string) bool {
+	values := r.Header.Values("Accept")
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		for _, accept := range strings.Split(value, ",") {
+			accept, _, _ = strings.Cut(accept, ";")
+			accept = strings.TrimSpace(accept)
+			if accept == mediaType || accept == "*/*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// copyHeader 复制上游响应头，跳过逐跳头
+func copyHeader(dst, src http.Header) {
+	for key, values := range src {
+		if hopHeaders[key] {
+			continue
+		}
+		for _, v := range values {
+			dst.Add(key, v)
+		}
+	}
+}
+
+// copyResponse 原样转发上游响应
+func copyResponse(w http.ResponseWriter, resp *http.Response) {
+	copyHeader(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	copyStream(w, resp.Body)
+}
@@ -0,0 +1,363 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+func TestPullThroughCache(t *testing.T) {
+	blob := []byte("layer content")
+	blobDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(blob))
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"` + MediaTypeManifestV2 + `","layers":[]}`)
+
+	var gets, heads atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		} else {
+			heads.Add(1)
+		}
+		switch r.URL.Path {
+		case "/v2/library/app/blobs/" + blobDigest:
+			w.Write(blob)
+		case "/v2/library/app/blobs/sha256:" + fmt.Sprintf("%064d", 0):
+			// 内容与摘要不一致，不能被缓存
+			w.Write([]byte("corrupted"))
+		case "/v2/library/app/manifests/latest":
+			digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+			if r.Header.Get("If-None-Match") == `"`+digest+`"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Content-Type", MediaTypeManifestV2)
+			w.Header().Set("Docker-Content-Digest", digest)
+			if r.Method == http.MethodGet {
+				w.Write(manifest)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{HostName: "docker.io", RemoteURL: upstream.URL}
+	handler, err := newRegistryProxyHandler(cfg, storage.NewMemoryStorage(), newUpstreamTrackers())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) (*http.Response, string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		resp := w.Result()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	// blob 第一次从上游下载，之后直接从缓存返回
+	for i := 0; i < 2; i++ {
+		resp, body := get("/v2/library/app/blobs/" + blobDigest)
+		if resp.StatusCode != http.StatusOK || body != string(blob) {
+			t.Fatalf("unexpected blob response %d %q", resp.StatusCode, body)
+		}
+		if resp.Header.Get("Docker-Content-Digest") != blobDigest {
+			t.Fatalf("unexpected digest header %q", resp.Header.Get("Docker-Content-Digest"))
+		}
+	}
+	if gets.Load() != 1 {
+		t.Fatalf("expected 1 upstream blob request, got %d", gets.Load())
+	}
+
+	// 摘要不一致的 blob 仍然返回给客户端，但不写入缓存
+	corrupted := "/v2/library/app/blobs/sha256:" + fmt.Sprintf("%064d", 0)
+	get(corrupted)
+	get(corrupted)
+	if gets.Load() != 3 {
+		t.Fatalf("expected corrupted blob to be fetched twice, got %d requests", gets.Load())
+	}
+
+	// 按标签获取的清单第二次用条件 HEAD 请求确认
+	gets.Store(0)
+	for i := 0; i < 2; i++ {
+		resp, body := get("/v2/library/app/manifests/latest")
+		if resp.StatusCode != http.StatusOK || body != string(manifest) {
+			t.Fatalf("unexpected manifest response %d %q", resp.StatusCode, body)
+		}
+		if resp.Header.Get("Content-Type") != MediaTypeManifestV2 {
+			t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+		}
+	}
+	if gets.Load() != 1 || heads.Load() != 1 {
+		t.Fatalf("expected 1 GET and 1 HEAD upstream, got %d and %d", gets.Load(), heads.Load())
+	}
+
+	// 清单更新后重新获取
+	manifest = []byte(`{"schemaVersion":2,"mediaType":"` + MediaTypeManifestV2 + `","layers":[{}]}`)
+	if _, body := get("/v2/library/app/manifests/latest"); body != string(manifest) {
+		t.Fatalf("expected updated manifest, got %q", body)
+	}
+}
+
+func TestPullThroughCacheCoalescesBlobDownloads(t *testing.T) {
+	blob := []byte("first half, second half")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(blob))
+
+	var requests atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+		w.Write(blob[:10])
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write(blob[10:])
+	}))
+	defer upstream.Close()
+
+	handler, err := newRegistryProxyHandler(config.Config{HostName: "docker.io", RemoteURL: upstream.URL}, storage.NewMemoryStorage(), newUpstreamTrackers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := handler.(*pushGuard).next.(*pullThroughCache)
+
+	path := "/v2/library/app/blobs/" + digest
+	bodies := make(chan string, 2)
+	fetch := func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		bodies <- w.Body.String()
+	}
+	go fetch()
+	go fetch()
+
+	// 等待两个客户端都加入同一次下载
+	for {
+		cache.flightsMu.Lock()
+		f := cache.flights[cache.namespace+"/library/app@"+digest]
+		cache.flightsMu.Unlock()
+		if f != nil {
+			f.mu.Lock()
+			refs := f.refs
+			f.mu.Unlock()
+			if refs == 3 {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if body := <-bodies; body != string(blob) {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", requests.Load())
+	}
+}
+
+func TestPullThroughCacheAuthorizesFlightJoiners(t *testing.T) {
+	blob := []byte("private layer, second half")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(blob))
+
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(blob[:10])
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write(blob[10:])
+	}))
+	defer upstream.Close()
+
+	handler, err := newRegistryProxyHandler(config.Config{HostName: "docker.io", RemoteURL: upstream.URL}, storage.NewMemoryStorage(), newUpstreamTrackers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := handler.(*pushGuard).next.(*pullThroughCache)
+
+	path := "/v2/private/app/blobs/" + digest
+	done := make(chan string, 1)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer good")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		done <- w.Body.String()
+	}()
+	for {
+		cache.flightsMu.Lock()
+		f := cache.flights[cache.namespace+"/private/app@"+digest]
+		cache.flightsMu.Unlock()
+		if f != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 其他客户端不能通过加入进行中的下载读取私有 blob，完整请求和 Range 请求都要确认权限
+	for _, rangeHeader := range []string{"", "bytes=0-4"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected anonymous client joining the download with range %q to get 401, got %d", rangeHeader, w.Code)
+		}
+	}
+
+	close(release)
+	if body := <-done; body != string(blob) {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestPullThroughCacheResumesInterruptedDownload(t *testing.T) {
+	blob := make([]byte, 256*1024)
+	for i := range blob {
+		blob[i] = byte(i % 251)
+	}
+	blobDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(blob))
+
+	var ranges []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("Etag", `"`+blobDigest+`"`)
+		if r.Header.Get("Range") == "" {
+			// 第一次请求只返回一半内容后断开连接
+			w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+			w.Write(blob[:len(blob)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+	}))
+	defer upstream.Close()
+
+	cache := storage.NewMemoryStorage()
+	handler, err := newRegistryProxyHandler(config.Config{HostName: "docker.io", RemoteURL: upstream.URL}, cache, newUpstreamTrackers())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/library/app/blobs/"+blobDigest, nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), blob) {
+		t.Fatalf("unexpected response %d with %d bytes", w.Code, w.Body.Len())
+	}
+	if len(ranges) != 2 || ranges[1] != fmt.Sprintf("bytes=%d-", len(blob)/2) {
+		t.Fatalf("expected download to resume from the interruption, got ranges %q", ranges)
+	}
+
+	// 缓存命中后 Range 请求直接从缓存返回
+	req := httptest.NewRequest(http.MethodGet, "/v2/library/app/blobs/"+blobDigest, nil)
+	req.Header.Set("Range", "bytes=10-19")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), blob[10:20]) {
+		t.Fatalf("unexpected range response %d %v", w.Code, w.Body.Bytes())
+	}
+	if len(ranges) != 2 {
+		t.Fatalf("range request should be served from cache, upstream saw %q", ranges)
+	}
+}
+
+func TestPullThroughCacheAuthorizesCachedPrivateBlob(t *testing.T) {
+	blob := []byte("private layer")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(blob))
+
+	var gets, heads atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="https://auth.example.com/token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+			w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+			return
+		}
+		gets.Add(1)
+		w.Write(blob)
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{HostName: "docker.io", RemoteURL: upstream.URL}
+	handler, err := newRegistryProxyHandler(cfg, storage.NewMemoryStorage(), newUpstreamTrackers())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(authorization string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/v2/private/app/blobs/"+digest, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	if resp := get("Bearer good"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected authorized client to get the blob, got %d", resp.StatusCode)
+	}
+	if resp := get(""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected anonymous client to get 401 on cached private blob, got %d", resp.StatusCode)
+	}
+	if resp := get("Bearer stolen"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected client with other credentials to get 401, got %d", resp.StatusCode)
+	}
+
+	// 确认过的凭据在有效期内直接读取缓存
+	for i := 0; i < 2; i++ {
+		if resp := get("Bearer good"); resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected cached blob, got %d", resp.StatusCode)
+		}
+	}
+	if gets.Load() != 1 || heads.Load() != 0 {
+		t.Fatalf("expected 1 GET and no HEAD upstream for the authorized client, got %d and %d", gets.Load(), heads.Load())
+	}
+}
+
+func TestParseSingleRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		start, end int64
+		ok         bool
+	}{
+		{"bytes=0-9", 0, 9, true},
+		{"bytes=90-", 90, 99, true},
+		{"bytes=-10", 90, 99, true},
+		{"bytes=50-500", 50, 99, true},
+		{"bytes=100-", 0, 0, false},
+		{"bytes=0-1,5-6", 0, 0, false},
+		{"items=0-1", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, ok := parseSingleRange(tt.header, 100)
+		if start != tt.start || end != tt.end || ok != tt.ok {
+			t.Errorf("parseSingleRange(%q) = %d, %d, %v", tt.header, start, end, ok)
+		}
+	}
+}
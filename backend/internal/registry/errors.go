@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+)
+
+// Distribution 规范定义的错误码
+const (
+	errCodeBlobUnknown             = "BLOB_UNKNOWN"
+	errCodeBlobUploadInvalid       = "BLOB_UPLOAD_INVALID"
+	errCodeBlobUploadUnknown       = "BLOB_UPLOAD_UNKNOWN"
+	errCodeDenied                  = "DENIED"
+	errCodeDigestInvalid           = "DIGEST_INVALID"
+	errCodeManifestInvalid         = "MANIFEST_INVALID"
+	errCodeManifestUnknown         = "MANIFEST_UNKNOWN"
+	errCodeNameInvalid             = "NAME_INVALID"
+	errCodeNameUnknown             = "NAME_UNKNOWN"
+	errCodePaginationNumberInvalid = "PAGINATION_NUMBER_INVALID"
+	errCodeSizeInvalid             = "SIZE_INVALID"
+	errCodeUnauthorized            = "UNAUTHORIZED"
+	errCodeUnsupported             = "UNSUPPORTED"
+	errCodeUnknown                 = "UNKNOWN"
+)
+
+// repositoryNamePattern 仓库名格式，由斜杠分隔的小写路径组成
+var repositoryNamePattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:\.|_|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:\.|_|__|-+)[a-z0-9]+)*)*$`)
+
+// tagPattern 标签格式，存储会把标签拼接为路径，写入前必须校验
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,127}$`)
+
+// writeRegistryError 按 Distribution 规范的错误格式返回
+func writeRegistryError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+// validRepository 校验仓库名，不合法时返回 NAME_INVALID
+func validRepository(w http.ResponseWriter, repository string) bool {
+	if !repositoryNamePattern.MatchString(repository) || len(repository) > 255 {
+		writeRegistryError(w, http.StatusBadRequest, errCodeNameInvalid, "invalid repository name "+repository)
+		return false
+	}
+	return true
+}
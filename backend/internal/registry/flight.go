@@ -0,0 +1,273 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// blobResumeAttempts 上游下载中断后最多续传的次数
+const blobResumeAttempts = 3
+
+// blobFlight 一次进行中的上游 blob 下载
+// 同一个 blob 的并发请求只触发一次上游下载，内容先写入临时文件，所有客户端跟随下载进度从临时文件读取
+type blobFlight struct {
+	file *os.File
+	// identity 发起下载的客户端的凭据标识，下载使用该客户端的认证信息
+	identity string
+
+	// ready 收到上游响应头或请求失败后关闭，之后 status 和 header 不再变化，status 为 0 表示请求失败
+	ready  chan struct{}
+	status int
+	header http.Header
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	written int64
+	done    bool
+	err     error
+	refs    int // 下载任务和正在读取的客户端数，归零时删除临时文件
+}
+
+// joinBlobFlight 加入该 blob 进行中的下载，没有时以 r 的认证信息启动新的下载
+// 调用方读取结束后需调用 release；凭据与 identity 不同的调用方读取前需要先确认权限
+func (p *pullThroughCache) joinBlobFlight(r *http.Request, repository, digest string) (*blobFlight, error) {
+	key := repository + "@" + digest
+
+	p.flightsMu.Lock()
+	defer p.flightsMu.Unlock()
+	if f, ok := p.flights[key]; ok {
+		f.acquire()
+		return f, nil
+	}
+
+	file, err := os.CreateTemp("", "registry-blob-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	f := &blobFlight{file: file, identity: credentialIdentity(r), ready: make(chan struct{}), refs: 2}
+	f.cond = sync.NewCond(&f.mu)
+	p.flights[key] = f
+
+	// 下载不随发起请求的客户端断开而取消，其他客户端可能还在等待
+	req := p.upstreamRequest(r, http.MethodGet).WithContext(context.Background())
+	req.Header.Set("Accept-Encoding", "identity")
+	go p.download(f, req, key, repository, digest)
+	return f, nil
+}
+
+// activeFlight 返回该 blob 进行中的下载，没有时返回 nil，调用方读取结束后需调用 release
+func (p *pullThroughCache) activeFlight(repository, digest string) *blobFlight {
+	p.flightsMu.Lock()
+	defer p.flightsMu.Unlock()
+	f, ok := p.flights[repository+"@"+digest]
+	if !ok {
+		return nil
+	}
+	f.acquire()
+	return f
+}
+
+// download 执行下载，成功后写入缓存
+// 写入缓存完成前下载保持在 flights 中，期间到达的请求读取已完成的临时文件，不会重复下载
+func (p *pullThroughCache) download(f *blobFlight, req *http.Request, key, repository, digest string) {
+	defer f.release()
+
+	size, err := f.fetch(p.client, req, digest)
+	if err != nil {
+		// 先移出 flights 再通知读取方，之后到达的请求重新下载而不是读到失败的结果
+		p.removeFlight(key)
+		f.finish(err)
+		log.Printf("Failed to download blob %s@%s: %v", repository, digest, err)
+		return
+	}
+	f.finish(nil)
+	if _, err := p.cache.PutBlob(repository, digest, io.NewSectionReader(f.file, 0, size)); err != nil {
+		log.Printf("Failed to cache blob %s@%s: %v", repository, digest, err)
+	}
+	p.removeFlight(key)
+}
+
+func (p *pullThroughCache) removeFlight(key string) {
+	p.flightsMu.Lock()
+	defer p.flightsMu.Unlock()
+	delete(p.flights, key)
+}
+
+// fetch 下载 blob 到临时文件并校验摘要
+// 上游连接中途断开时用 Range 请求从已下载的位置继续，最多续传 blobResumeAttempts 次
+func (f *blobFlight) fetch(client *http.Client, req *http.Request, digest string) (int64, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		close(f.ready)
+		return 0, err
+	}
+	f.status, f.header = resp.StatusCode, resp.Header
+	close(f.ready)
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return 0, fmt.Errorf("upstream returned %d", resp.StatusCode)
+	}
+
+	hash := sha256.New()
+	var size int64
+	for attempt := 0; ; attempt++ {
+		err = f.copyBody(resp.Body, hash, &size)
+		resp.Body.Close()
+		if err == nil {
+			break
+		}
+		if attempt >= blobResumeAttempts {
+			return 0, err
+		}
+		log.Printf("Blob download %s interrupted at %d bytes, resuming: %v", digest, size, err)
+		if resp, err = f.resume(client, req, hash, size); err != nil {
+			return 0, err
+		}
+	}
+
+	if got := fmt.Sprintf("sha256:%x", hash.Sum(nil)); got != digest {
+		return 0, fmt.Errorf("digest mismatch: expected %s, got %s", digest, got)
+	}
+	return size, nil
+}
+
+// copyBody 把响应体追加到临时文件，同时更新摘要和已下载的字节数
+func (f *blobFlight) copyBody(body io.Reader, h hash.Hash, size *int64) error {
+	buf := streamBuffers.Get()
+	defer streamBuffers.Put(buf)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, err := f.file.WriteAt(buf[:n], *size); err != nil {
+				return fmt.Errorf("failed to write temp file: %v", err)
+			}
+			h.Write(buf[:n])
+			*size += int64(n)
+			f.mu.Lock()
+			f.written = *size
+			f.cond.Broadcast()
+			f.mu.Unlock()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// resume 请求 offset 之后的内容，If-Range 保证上游内容未变化
+// 上游不支持 Range 返回完整内容时，跳过已下载的部分并重新计算摘要
+func (f *blobFlight) resume(client *http.Client, req *http.Request, h hash.Hash, offset int64) (*http.Response, error) {
+	resumeReq := req.Clone(req.Context())
+	resumeReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	if etag := f.header.Get("Etag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		resumeReq.Header.Set("If-Range", etag)
+	} else if modified := f.header.Get("Last-Modified"); modified != "" {
+		resumeReq.Header.Set("If-Range", modified)
+	}
+	resp, err := client.Do(resumeReq)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected content range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+		}
+	case http.StatusOK:
+		h.Reset()
+		if _, err := io.CopyN(h, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("upstream returned %d when resuming", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// contentRangeStart 解析 Content-Range: bytes 100-199/200 的起始位置
+func contentRangeStart(value string) (int64, bool) {
+	value, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	return n, err == nil
+}
+
+// finish 标记下载结束，唤醒等待数据的读取方
+func (f *blobFlight) finish(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.done = true
+	f.err = err
+	f.cond.Broadcast()
+}
+
+func (f *blobFlight) acquire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.refs++
+}
+
+func (f *blobFlight) release() {
+	f.mu.Lock()
+	f.refs--
+	last := f.refs == 0
+	f.mu.Unlock()
+	if last {
+		f.file.Close()
+		os.Remove(f.file.Name())
+	}
+}
+
+// flightReader 跟随下载进度读取临时文件，下载失败时返回下载的错误
+type flightReader struct {
+	flight *blobFlight
+	offset int64
+}
+
+func (r *flightReader) Read(p []byte) (int, error) {
+	f := r.flight
+	f.mu.Lock()
+	for r.offset >= f.written && !f.done {
+		f.cond.Wait()
+	}
+	written, err := f.written, f.err
+	f.mu.Unlock()
+
+	if r.offset >= written {
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	if remaining := written - r.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := f.file.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,370 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+// errGCRunning 已有垃圾回收在运行
+var errGCRunning = errors.New("garbage collection is already running")
+
+// DefaultGCGracePeriod 垃圾回收默认不删除最近多久内写入的清单和 blob
+const DefaultGCGracePeriod = time.Hour
+
+// GCOptions 垃圾回收选项
+type GCOptions struct {
+	// DryRun 只统计将被删除的内容，不实际删除
+	DryRun bool
+	// Retain 返回 true 的清单即使没有标签也作为根保留，例如保留策略宽限期内的清单
+	Retain func(repository, digest string) bool
+	// GracePeriod 回收开始前 GracePeriod 内写入的清单和 blob 不会被删除。推送镜像时先上传 blob 最后上传清单，
+	// 宽限期保护这些暂时没有被引用的 blob；0 使用 DefaultGCGracePeriod，负数表示只跳过回收开始后写入的内容。
+	// 只对能够返回修改时间的存储生效，见 GracePeriodSupported
+	GracePeriod time.Duration
+}
+
+// GracePeriodSupported 存储能否返回清单和 blob 的修改时间，不能时垃圾回收无法跳过推送中的镜像，
+// 只能在没有推送时执行
+func GracePeriodSupported(store storage.Storage) bool {
+	_, blobs := store.(storage.BlobModTimer)
+	_, manifests := store.(storage.ManifestModTimer)
+	return blobs && manifests
+}
+
+// gcRecent 判断清单和 blob 是否在 cutoff 之后写入，存储不支持修改时间时返回 false
+type gcRecent struct {
+	store  storage.Storage
+	cutoff time.Time
+}
+
+func newGCRecent(store storage.Storage, start time.Time, gracePeriod time.Duration) gcRecent {
+	if gracePeriod == 0 {
+		gracePeriod = DefaultGCGracePeriod
+	}
+	return gcRecent{store: store, cutoff: start.Add(-max(gracePeriod, 0))}
+}
+
+func (g gcRecent) manifest(repository, digest string) bool {
+	timer, ok := g.store.(storage.ManifestModTimer)
+	if !ok {
+		return false
+	}
+	modified, err := timer.ManifestModTime(repository, digest)
+	// 读取失败时 (例如回收期间被删除后重新推送) 保守地保留
+	return err != nil || modified.After(g.cutoff)
+}
+
+func (g gcRecent) blob(repository, digest string) bool {
+	timer, ok := g.store.(storage.BlobModTimer)
+	if !ok {
+		return false
+	}
+	modified, err := timer.BlobModTime(repository, digest)
+	return err != nil || modified.After(g.cutoff)
+}
+
+// GCProgress 垃圾回收进度
+type GCProgress struct {
+	// Phase 当前阶段：mark 标记、sweep 清除、prune 清理共享的 blob 数据、done 完成
+	Phase             string `json:"phase"`
+	Repository        string `json:"repository,omitempty"`
+	RepositoriesTotal int    `json:"repositoriesTotal"`
+	RepositoriesDone  int    `json:"repositoriesDone"`
+	ManifestsDeleted  int    `json:"manifestsDeleted"`
+	BlobsDeleted      int    `json:"blobsDeleted"`
+}
+
+// GCResult 垃圾回收结果，DryRun 时为将被删除的内容
+type GCResult struct {
+	DryRun bool `json:"dryRun"`
+	// Manifests 删除的清单，格式为 <repository>@<digest>
+	Manifests []string `json:"manifests"`
+	// Blobs 删除的 blob，格式为 <repository>@<digest>
+	Blobs []string `json:"blobs"`
+	// PrunedBlobs 删除的共享 blob 数据，只有 distribution 布局的存储会产生
+	PrunedBlobs []string `json:"prunedBlobs,omitempty"`
+}
+
+// gcManifest 垃圾回收关心的清单字段，同时兼容镜像清单和清单列表
+type gcManifest struct {
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Layers []struct {
+		Digest string `json:"digest"`
+	} `json:"layers"`
+	Manifests []struct {
+		Digest string `json:"digest"`
+	} `json:"manifests"`
+	Subject *struct {
+		Digest string `json:"digest"`
+	} `json:"subject"`
+}
+
+// GarbageCollect 对每个仓库执行标记清除：
+// 从标签出发标记清单，清单列表引用的子清单和 subject 指向已标记清单的清单 (签名、SBOM 等) 同样保留，
+// 然后删除未标记的清单和未被保留清单引用的 blob。
+// 宽限期内写入的清单作为根保留，宽限期内写入的 blob 不删除，回收期间推送的镜像不会丢失 blob；
+// 存储不支持修改时间时没有这层保护，应在没有推送时执行
+func GarbageCollect(ctx context.Context, store storage.Storage, opts GCOptions, progress func(GCProgress)) (*GCResult, error) {
+	if progress == nil {
+		progress = func(GCProgress) {}
+	}
+	if !GracePeriodSupported(store) {
+		log.Printf("Storage cannot report modification times, garbage collection may delete blobs of images being pushed")
+	}
+	recent := newGCRecent(store, time.Now(), opts.GracePeriod)
+	retain := func(repository, digest string) bool {
+		return recent.manifest(repository, digest) || opts.Retain != nil && opts.Retain(repository, digest)
+	}
+
+	repositories, err := store.ListRepositories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %v", err)
+	}
+
+	result := &GCResult{DryRun: opts.DryRun, Manifests: []string{}, Blobs: []string{}}
+	state := GCProgress{RepositoriesTotal: len(repositories)}
+	for _, repository := range repositories {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		state.Repository = repository
+		state.Phase = "mark"
+		progress(state)
+
+		manifests, blobs, err := markRepository(store, repository, retain)
+		if err != nil {
+			return result, err
+		}
+
+		state.Phase = "sweep"
+		progress(state)
+		for _, digest := range manifests {
+			if !opts.DryRun {
+				if err := store.DeleteManifest(repository, digest); err != nil {
+					return result, fmt.Errorf("failed to delete manifest %s@%s: %v", repository, digest, err)
+				}
+			}
+			result.Manifests = append(result.Manifests, repository+"@"+digest)
+			state.ManifestsDeleted++
+		}
+		for _, digest := range blobs {
+			if recent.blob(repository, digest) {
+				continue
+			}
+			if !opts.DryRun {
+				if err := store.DeleteBlob(repository, digest); err != nil {
+					return result, fmt.Errorf("failed to delete blob %s@%s: %v", repository, digest, err)
+				}
+			}
+			result.Blobs = append(result.Blobs, repository+"@"+digest)
+			state.BlobsDeleted++
+		}
+		state.RepositoriesDone++
+		progress(state)
+	}
+
+	state.Repository = ""
+	if pruner, ok := store.(storage.BlobPruner); ok {
+		state.Phase = "prune"
+		progress(state)
+		if result.PrunedBlobs, err = pruner.PruneBlobs(opts.DryRun); err != nil {
+			return result, fmt.Errorf("failed to prune blobs: %v", err)
+		}
+	}
+
+	state.Phase = "done"
+	progress(state)
+	return result, nil
+}
+
+// markRepository 标记仓库中保留的清单和 blob，返回应删除的清单和 blob，retain 不为空时额外保留其返回 true 的清单
+func markRepository(store storage.Storage, repository string, retain func(repository, digest string) bool) ([]string, []string, error) {
+	tags, err := store.ListTags(repository)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list tags of %s: %v", repository, err)
+	}
+	digests, err := store.ListManifests(repository)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list manifests of %s: %v", repository, err)
+	}
+
+	// 解析仓库中的全部清单，未标记的清单也要解析以检查 subject
+	manifests := make(map[string]*gcManifest, len(digests))
+	for _, digest := range digests {
+		data, _, err := store.GetManifestByDigest(repository, digest)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read manifest %s@%s: %v", repository, digest, err)
+		}
+		var manifest gcManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			// 无法解析的清单无法确定引用，保守地中止，避免误删 blob
+			return nil, nil, fmt.Errorf("failed to parse manifest %s@%s: %v", repository, digest, err)
+		}
+		manifests[digest] = &manifest
+	}
+
+	marked := make(map[string]bool)
+	var mark func(digest string)
+	mark = func(digest string) {
+		manifest, ok := manifests[digest]
+		if !ok || marked[digest] {
+			return
+		}
+		marked[digest] = true
+		for _, child := range manifest.Manifests {
+			mark(child.Digest)
+		}
+	}
+	for _, tag := range tags {
+		_, digest, err := store.GetManifest(repository, tag)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve tag %s:%s: %v", repository, tag, err)
+		}
+		mark(digest)
+	}
+	if retain != nil {
+		for _, digest := range digests {
+			if retain(repository, digest) {
+				mark(digest)
+			}
+		}
+	}
+	// subject 可能指向另一个引用者，重复直到没有新的清单被标记
+	for changed := true; changed; {
+		changed = false
+		for digest, manifest := range manifests {
+			if !marked[digest] && manifest.Subject != nil && marked[manifest.Subject.Digest] {
+				mark(digest)
+				changed = true
+			}
+		}
+	}
+
+	referenced := make(map[string]bool)
+	var sweepManifests []string
+	for _, digest := range digests {
+		if !marked[digest] {
+			sweepManifests = append(sweepManifests, digest)
+			continue
+		}
+		manifest := manifests[digest]
+		if manifest.Config.Digest != "" {
+			referenced[manifest.Config.Digest] = true
+		}
+		for _, layer := range manifest.Layers {
+			referenced[layer.Digest] = true
+		}
+	}
+
+	blobs, err := store.ListBlobs(repository)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list blobs of %s: %v", repository, err)
+	}
+	var sweepBlobs []string
+	for _, digest := range blobs {
+		if !referenced[digest] {
+			sweepBlobs = append(sweepBlobs, digest)
+		}
+	}
+	return sweepManifests, sweepBlobs, nil
+}
+
+// GCStatus 后台垃圾回收的状态
+type GCStatus struct {
+	Running    bool       `json:"running"`
+	DryRun     bool       `json:"dryRun"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Progress   GCProgress `json:"progress"`
+	Result     *GCResult  `json:"result,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// GarbageCollector 在后台执行垃圾回收，同一时间只运行一个，供管理接口启动和查询进度
+type GarbageCollector struct {
+	store  storage.Storage
+	mu     sync.Mutex
+	status GCStatus
+}
+
+// NewGarbageCollector 创建垃圾回收器
+func NewGarbageCollector(store storage.Storage) *GarbageCollector {
+	return &GarbageCollector{store: store}
+}
+
+// Start 在后台启动垃圾回收，已有回收在运行时返回错误
+func (g *GarbageCollector) Start(ctx context.Context, opts GCOptions) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.status.Running {
+		return errGCRunning
+	}
+	now := time.Now()
+	g.status = GCStatus{Running: true, DryRun: opts.DryRun, StartedAt: &now}
+
+	go func() {
+		result, err := GarbageCollect(ctx, g.store, opts, func(progress GCProgress) {
+			g.mu.Lock()
+			g.status.Progress = progress
+			g.mu.Unlock()
+		})
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		finished := time.Now()
+		g.status.Running = false
+		g.status.FinishedAt = &finished
+		g.status.Result = result
+		if err != nil {
+			g.status.Error = err.Error()
+			log.Printf("Garbage collection failed: %v", err)
+			return
+		}
+		log.Printf("Garbage collection finished: %d manifests, %d blobs deleted (dry run: %v)",
+			len(result.Manifests), len(result.Blobs), opts.DryRun)
+	}()
+	return nil
+}
+
+// Status 返回当前或最近一次垃圾回收的状态
+func (g *GarbageCollector) Status() GCStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.status
+}
+
+// ServeHTTP 实现管理接口：GET 查询状态，POST 启动回收，?dryRun=true 时只统计不删除
+func (g *GarbageCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+		// 回收在后台继续运行，不随请求结束而取消
+		if err := g.Start(context.Background(), GCOptions{DryRun: dryRun}); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(g.Status())
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g.Status())
+}
@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+func digestOf(data string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(data)))
+}
+
+// seedGCRepository 写入一个带标签的镜像、一个引用它的签名、一个未打标签的旧镜像和一个孤立 blob
+func seedGCRepository(t *testing.T, store storage.Storage) {
+	t.Helper()
+	for _, blob := range []string{"config", "layer", "old-layer", "signature", "orphan"} {
+		if _, err := store.PutBlob("app", digestOf(blob), strings.NewReader(blob)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	image := fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":%q},"layers":[{"digest":%q}]}`, digestOf("config"), digestOf("layer"))
+	old := fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":%q},"layers":[{"digest":%q}]}`, digestOf("config"), digestOf("old-layer"))
+	signature := fmt.Sprintf(`{"schemaVersion":2,"layers":[{"digest":%q}],"subject":{"digest":%q}}`, digestOf("signature"), digestOf(image))
+	for reference, manifest := range map[string]string{"v1": image, "": old, "sig": signature} {
+		tag := reference
+		if reference == "sig" {
+			tag = digestOf(signature)
+		}
+		if err := store.PutManifest("app", tag, digestOf(manifest), []byte(manifest)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGarbageCollect(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	seedGCRepository(t, store)
+
+	// 默认宽限期内刚写入的内容都不会被删除
+	result, err := GarbageCollect(context.Background(), store, GCOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Manifests) != 0 || len(result.Blobs) != 0 {
+		t.Fatalf("Expected recent content to be kept, got %+v", result)
+	}
+
+	// dry-run 只列出将被删除的内容
+	result, err = GarbageCollect(context.Background(), store, GCOptions{DryRun: true, GracePeriod: -1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Manifests) != 1 || len(result.Blobs) != 2 {
+		t.Fatalf("Unexpected dry-run result %+v", result)
+	}
+	if blobs, _ := store.ListBlobs("app"); len(blobs) != 5 {
+		t.Fatalf("Expected dry run to keep blobs, got %v", blobs)
+	}
+
+	var phases []string
+	result, err = GarbageCollect(context.Background(), store, GCOptions{GracePeriod: -1}, func(p GCProgress) {
+		phases = append(phases, p.Phase)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phases[len(phases)-1] != "done" {
+		t.Fatalf("Expected progress to finish with done, got %v", phases)
+	}
+	blobs, _ := store.ListBlobs("app")
+	if strings.Join(blobs, ",") != strings.Join(sortedDigests("config", "layer", "signature"), ",") {
+		t.Fatalf("Unexpected remaining blobs %v", blobs)
+	}
+	if manifests, _ := store.ListManifests("app"); len(manifests) != 2 {
+		t.Fatalf("Expected tagged image and signature to remain, got %v", manifests)
+	}
+}
+
+func TestGarbageCollectPrunesDistributionBlobs(t *testing.T) {
+	store, err := storage.NewDistributionStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedGCRepository(t, store)
+
+	result, err := GarbageCollect(context.Background(), store, GCOptions{GracePeriod: -1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 旧镜像的清单内容、old-layer 和 orphan 的数据都不再被引用
+	if len(result.PrunedBlobs) != 3 {
+		t.Fatalf("Unexpected pruned blobs %v", result.PrunedBlobs)
+	}
+	if _, _, err := store.GetManifest("app", "v1"); err != nil {
+		t.Fatalf("Expected tagged manifest to remain: %v", err)
+	}
+}
+
+func TestGarbageCollectorAPI(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	seedGCRepository(t, store)
+	gc := NewGarbageCollector(store)
+
+	w := httptest.NewRecorder()
+	gc.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/gc?dryRun=true", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected gc to start, got %d", w.Code)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for gc.Status().Running && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	status := gc.Status()
+	if status.Running || status.Result == nil || !status.DryRun || status.Progress.Phase != "done" {
+		t.Fatalf("Unexpected gc status %+v", status)
+	}
+}
+
+func sortedDigests(data ...string) []string {
+	digests := make([]string, len(data))
+	for i, d := range data {
+		digests[i] = digestOf(d)
+	}
+	sort.Strings(digests)
+	return digests
+}
@@ -1,18 +1,25 @@
 package registry
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
+	"math"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/smartcat999/container-ui/internal/auth"
 	"github.com/smartcat999/container-ui/internal/storage"
 )
 
@@ -59,15 +66,78 @@ const (
 	MediaTypeOCIManifestIndex = "application/vnd.oci.image.index.v1+json"
 )
 
+// DefaultMaxBlobSize 单个 blob 上传的默认大小上限
+const DefaultMaxBlobSize = 10 << 30
+
+// DefaultUploadTTL 未完成的上传没有写入多久后被清理
+const DefaultUploadTTL = 24 * time.Hour
+
+// errBlobTooLarge 上传超过大小上限
+var errBlobTooLarge = errors.New("blob exceeds maximum size")
+
 // Handler 处理镜像仓库请求
 type Handler struct {
-	storage storage.Storage
+	storage     storage.Storage
+	maxBlobSize int64
+	uploadTTL   time.Duration
+	hashes      *uploadHashes
+
+	deleteTagManifest bool
+	referenceCheck    ReferenceCheck
+
+	auth      *auth.RegistryTokenService
+	authRealm string
+	notifier  *Notifier
+	quota     *Quota
+}
+
+// HandlerOptions 处理器的选项
+type HandlerOptions struct {
+	// MaxBlobSize 单个 blob 上传的大小上限，0 使用 DefaultMaxBlobSize，负数表示不限制
+	MaxBlobSize int64
+	// UploadTTL 未完成的上传没有写入多久后被清理，0 使用 DefaultUploadTTL，负数表示不清理
+	UploadTTL time.Duration
+	// DeleteTagManifest 为 true 时 DELETE /v2/<name>/manifests/<tag> 同时删除标签指向的清单，
+	// 默认只删除标签
+	DeleteTagManifest bool
+	// ReferenceCheck 推送清单时对引用内容的检查级别，为空时不检查
+	ReferenceCheck ReferenceCheck
+	// Auth 设置后所有请求都需要携带令牌服务签发的 Bearer 令牌，未设置时不认证
+	Auth *auth.RegistryTokenService
+	// AuthRealm 质询中返回的令牌服务地址，为空时由仓库服务器在 /auth/token 签发令牌
+	AuthRealm string
+	// Notifier 设置后把清单和 blob 的推送、拉取和删除事件发送到通知地址
+	Notifier *Notifier
+	// Quota 设置后在上传完成、挂载和清单推送时检查存储配额，超过时返回 413 DENIED
+	Quota *Quota
 }
 
 // NewHandler 创建新的处理器
 func NewHandler(storage storage.Storage) *Handler {
+	return NewHandlerWithOptions(storage, HandlerOptions{})
+}
+
+// NewHandlerWithOptions 使用选项创建处理器
+func NewHandlerWithOptions(storage storage.Storage, opts HandlerOptions) *Handler {
+	if opts.MaxBlobSize == 0 {
+		opts.MaxBlobSize = DefaultMaxBlobSize
+	}
+	if opts.UploadTTL == 0 {
+		opts.UploadTTL = DefaultUploadTTL
+	}
 	return &Handler{
-		storage: storage,
+		storage:     storage,
+		maxBlobSize: opts.MaxBlobSize,
+		uploadTTL:   opts.UploadTTL,
+		hashes:      newUploadHashes(),
+
+		deleteTagManifest: opts.DeleteTagManifest,
+		referenceCheck:    opts.ReferenceCheck,
+
+		auth:      opts.Auth,
+		authRealm: opts.AuthRealm,
+		notifier:  opts.Notifier,
+		quota:     opts.Quota,
 	}
 }
 
@@ -77,7 +147,12 @@ func detectManifestMediaType(data []byte) string {
 	var m struct {
 		MediaType     string `json:"mediaType"`
 		SchemaVersion int    `json:"schemaVersion"`
+		ArtifactType  string `json:"artifactType"`
+		Subject       any    `json:"subject"`
 		Manifests     []any  `json:"manifests"`
+		Config        struct {
+			MediaType string `json:"mediaType"`
+		} `json:"config"`
 	}
 
 	if err := json.Unmarshal(data, &m); err != nil {
@@ -92,7 +167,8 @@ func detectManifestMediaType(data []byte) string {
 		} else if m.MediaType == MediaTypeOCIManifestIndex {
 			return MediaTypeOCIManifestIndex
 		}
-		return MediaTypeManifestList // 默认为Docker清单列表格式
+		// Docker 清单列表必须声明 mediaType，OCI 索引可以省略
+		return MediaTypeOCIManifestIndex
 	}
 
 	// 使用声明的媒体类型，如果有的话
@@ -100,6 +176,12 @@ func detectManifestMediaType(data []byte) string {
 		return m.MediaType
 	}
 
+	// OCI 清单可以省略 mediaType，根据配置的媒体类型判断；
+	// artifactType 和 subject 只存在于 OCI 清单中，制品的配置可以是任意媒体类型
+	if strings.HasPrefix(m.Config.MediaType, "application/vnd.oci.") || m.ArtifactType != "" || m.Subject != nil {
+		return MediaTypeOCIManifestV1
+	}
+
 	return MediaTypeManifestV2 // 默认为清单v2格式
 }
 
@@ -136,37 +218,49 @@ func (h *Handler) validateManifest(data []byte, mediaType string) error {
 	return nil
 }
 
-// generateUploadID 生成上传 ID
-func generateUploadID() string {
-	return fmt.Sprintf("%d-%s", time.Now().UnixNano(), randomString(8))
-}
+// uploadIDPattern 上传 ID 的格式，与 generateUploadID 生成的 UUID 一致
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
 
-// randomString 生成随机字符串
-func randomString(n int) string {
-	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
-	result := make([]byte, n)
-	for i := range result {
-		result[i] = chars[time.Now().UnixNano()%int64(len(chars))]
-		time.Sleep(time.Nanosecond)
+// generateUploadID 生成随机的 UUID (版本 4) 作为上传 ID，对客户端不透明
+func generateUploadID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate upload id: %v", err)
 	}
-	return string(result)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
 }
 
 // ================ HTTP 处理函数 ================
 
 // handleVersionCheck 处理API版本检查
 func (h *Handler) handleVersionCheck(c *gin.Context) {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		writeRegistryError(c.Writer, http.StatusMethodNotAllowed, errCodeUnsupported, "method not allowed")
+		return
+	}
 	c.JSON(http.StatusOK, map[string]string{})
 }
 
 // handleCatalog 处理仓库列表
 func (h *Handler) handleCatalog(c *gin.Context) {
+	n, last, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
 	repositories, err := h.storage.ListRepositories()
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
 		return
 	}
+	repositories = h.visibleRepositories(c, repositories)
 
+	repositories, more := paginate(repositories, n, last)
+	if more {
+		setNextLink(c, "/v2/_catalog", n, repositories[len(repositories)-1])
+	}
 	c.JSON(http.StatusOK, map[string]interface{}{
 		"repositories": repositories,
 	})
@@ -187,23 +281,96 @@ func (h *Handler) handleListTags(c *gin.Context) {
 	// 打印调试信息
 	log.Printf("处理标签列表请求: repository=%s, URL=%s", repositoryPath, c.Request.URL.Path)
 
-	if repositoryPath == "" {
-		c.String(http.StatusBadRequest, "Repository not specified")
+	if !validRepository(c.Writer, repositoryPath) {
+		return
+	}
+
+	n, last, ok := pageParams(c)
+	if !ok {
 		return
 	}
 
 	tags, err := h.storage.ListTags(repositoryPath)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
 		return
 	}
 
+	tags, more := paginate(tags, n, last)
+	if more {
+		setNextLink(c, fmt.Sprintf("/v2/%s/tags/list", repositoryPath), n, tags[len(tags)-1])
+	}
 	c.JSON(http.StatusOK, map[string]interface{}{
 		"name": repositoryPath,
 		"tags": tags,
 	})
 }
 
+// handleDeleteTag 处理 DELETE /v2/<name>/tags/<tag>，只删除标签
+func (h *Handler) handleDeleteTag(c *gin.Context) {
+	repository := c.GetString("repository")
+	tag := c.GetString("reference")
+	log.Printf("处理标签删除请求: repository=%s, tag=%s", repository, tag)
+
+	if c.Request.Method != http.MethodDelete {
+		writeRegistryError(c.Writer, http.StatusMethodNotAllowed, errCodeUnsupported, "method not allowed")
+		return
+	}
+	if !validRepository(c.Writer, repository) {
+		return
+	}
+	h.deleteTag(c, repository, tag)
+}
+
+// deleteTag 删除标签，标签不存在时返回 MANIFEST_UNKNOWN
+func (h *Handler) deleteTag(c *gin.Context, repository, tag string) {
+	if _, _, err := h.storage.GetManifest(repository, tag); err != nil {
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeManifestUnknown, fmt.Sprintf("tag %s not found", tag))
+		return
+	}
+	if err := h.storage.DeleteTag(repository, tag); err != nil {
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
+		return
+	}
+	c.Status(http.StatusAccepted)
+	h.notify(c, EventActionDelete, EventTarget{Repository: repository, Tag: tag})
+}
+
+// pageParams 解析分页参数 n 和 last，未指定 n 时返回 -1 表示返回全部结果
+func pageParams(c *gin.Context) (int, string, bool) {
+	n := -1
+	if value := c.Query("n"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			writeRegistryError(c.Writer, http.StatusBadRequest, errCodePaginationNumberInvalid, "invalid number of results requested")
+			return 0, "", false
+		}
+		n = parsed
+	}
+	return n, c.Query("last"), true
+}
+
+// paginate 返回已排序的 items 中 last 之后的最多 n 项，以及之后是否还有结果
+func paginate(items []string, n int, last string) ([]string, bool) {
+	if last != "" {
+		i := sort.SearchStrings(items, last)
+		if i < len(items) && items[i] == last {
+			i++
+		}
+		items = items[i:]
+	}
+	if n >= 0 && n < len(items) {
+		return items[:n], n > 0
+	}
+	return items, false
+}
+
+// setNextLink 按 RFC 5988 设置下一页的 Link 头
+func setNextLink(c *gin.Context, path string, n int, last string) {
+	query := url.Values{"n": {strconv.Itoa(n)}, "last": {last}}
+	c.Header("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, path, query.Encode()))
+}
+
 // handleManifests 处理清单
 func (h *Handler) handleManifests(c *gin.Context) {
 	// 获取完整的仓库路径
@@ -226,8 +393,11 @@ func (h *Handler) handleManifests(c *gin.Context) {
 	// 打印调试信息，帮助诊断问题
 	log.Printf("处理manifest请求: repository=%s, reference=%s, URL=%s", repositoryPath, reference, c.Request.URL.Path)
 
-	if repositoryPath == "" || reference == "" {
-		c.String(http.StatusBadRequest, "Repository or reference not specified")
+	if !validRepository(c.Writer, repositoryPath) {
+		return
+	}
+	if reference == "" {
+		writeRegistryError(c.Writer, http.StatusBadRequest, errCodeManifestInvalid, "reference not specified")
 		return
 	}
 
@@ -241,7 +411,7 @@ func (h *Handler) handleManifests(c *gin.Context) {
 	case http.MethodDelete:
 		h.handleDeleteManifest(c, repositoryPath, reference)
 	default:
-		c.String(http.StatusMethodNotAllowed, "Method not allowed")
+		writeRegistryError(c.Writer, http.StatusMethodNotAllowed, errCodeUnsupported, "method not allowed")
 	}
 }
 
@@ -253,7 +423,7 @@ func (h *Handler) handleHeadManifest(c *gin.Context, repository, reference strin
 		// 设置响应头
 		c.Header("Content-Type", MediaTypeManifestV2)
 		c.Header("Docker-Content-Digest", "")
-		c.String(http.StatusNotFound, "manifest unknown")
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeManifestUnknown, fmt.Sprintf("manifest %s not found", reference))
 		return
 	}
 
@@ -263,6 +433,9 @@ func (h *Handler) handleHeadManifest(c *gin.Context, repository, reference strin
 	// 设置响应头
 	c.Header("Content-Type", mediaType)
 	c.Header("Docker-Content-Digest", digest)
+	if writeNotModified(c.Writer, c.Request, digest, h.manifestModTime(repository, reference)) {
+		return
+	}
 	c.Header("Content-Length", fmt.Sprintf("%d", len(manifest)))
 	c.Status(http.StatusOK)
 }
@@ -286,7 +459,7 @@ func (h *Handler) handleGetManifest(c *gin.Context, repository, reference string
 		// 设置响应头
 		c.Header("Content-Type", MediaTypeManifestV2)
 		c.Header("Docker-Content-Digest", "")
-		c.String(http.StatusNotFound, "manifest unknown")
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeManifestUnknown, fmt.Sprintf("manifest %s not found", reference))
 		return
 	}
 
@@ -294,53 +467,130 @@ func (h *Handler) handleGetManifest(c *gin.Context, repository, reference string
 	mediaType := detectManifestMediaType(manifest)
 	c.Header("Content-Type", mediaType)
 	c.Header("Docker-Content-Digest", digest)
+	// 客户端缓存的清单仍然有效时不返回内容，也不算一次拉取
+	if writeNotModified(c.Writer, c.Request, digest, h.manifestModTime(repository, reference)) {
+		return
+	}
 	c.Data(http.StatusOK, mediaType, manifest)
+	h.notify(c, EventActionPull, manifestTarget(repository, reference, digest, mediaType, int64(len(manifest))))
+}
+
+// manifestModTime 返回清单的最后修改时间，存储不支持时返回零值
+func (h *Handler) manifestModTime(repository, reference string) time.Time {
+	timer, ok := h.storage.(storage.ManifestModTimer)
+	if !ok {
+		return time.Time{}
+	}
+	modified, err := timer.ManifestModTime(repository, reference)
+	if err != nil {
+		return time.Time{}
+	}
+	return modified
+}
+
+// writeNotModified 设置 ETag (清单摘要) 和 Last-Modified，条件请求命中时返回 304 并返回 true。
+// 按 RFC 9110，有 If-None-Match 时忽略 If-Modified-Since
+func writeNotModified(w http.ResponseWriter, r *http.Request, digest string, modified time.Time) bool {
+	etag := `"` + digest + `"`
+	w.Header().Set("Etag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims == "" || modified.IsZero() {
+		return false
+	} else if since, err := http.ParseTime(ims); err != nil || modified.Truncate(time.Second).After(since) {
+		return false
+	}
+
+	w.Header().Del("Content-Type")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches 判断 If-None-Match 中是否包含 etag，按弱比较处理 W/ 前缀
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
 }
 
 // handlePutManifest 处理PUT请求，上传manifest
 func (h *Handler) handlePutManifest(c *gin.Context, repository, reference string) {
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		writeRegistryError(c.Writer, http.StatusBadRequest, errCodeManifestInvalid, err.Error())
 		return
 	}
 
 	// 计算请求体的 digest
 	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	// 按 digest 推送时请求体必须与引用的 digest 一致，否则清单会被保存在错误的 digest 下
+	if strings.Contains(reference, ":") && reference != digest {
+		writeRegistryError(c.Writer, http.StatusBadRequest, errCodeDigestInvalid, fmt.Sprintf("manifest digest %s does not match reference %s", digest, reference))
+		return
+	}
 
 	// 检测清单类型
 	mediaType := detectManifestMediaType(body)
 
 	// 验证 manifest 格式
 	if err := h.validateManifest(body, mediaType); err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		writeRegistryError(c.Writer, http.StatusBadRequest, errCodeManifestInvalid, err.Error())
 		return
 	}
 
-	// 确保 manifest 目录存在
-	manifestDir := filepath.Join(h.storage.(*storage.FileStorage).RootDir(), "repositories", repository, "_manifests")
-	if err := os.MkdirAll(manifestDir, 0755); err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("Failed to create manifest directory: %v", err))
+	// 拒绝引用不存在内容的清单，避免之后拉取时才失败
+	missing, err := h.checkManifestReferences(c, repository, body)
+	if err != nil {
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
+		return
+	}
+	if missing != "" {
+		writeRegistryError(c.Writer, http.StatusBadRequest, errCodeManifestBlobUnknown, fmt.Sprintf("manifest references unknown content %s", missing))
 		return
 	}
 
-	if err := h.storage.PutManifest(repository, reference, digest, body); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	if err := h.quota.admit(repository, manifestTag(reference), digest, int64(len(body)), func() error {
+		return h.storage.PutManifest(repository, reference, digest, body)
+	}); err != nil {
+		writeQuotaError(c.Writer, err)
 		return
 	}
 
+	// 带 subject 的清单通过 OCI-Subject 告知客户端服务端支持引用者接口
+	if subject := manifestSubject(body); subject != "" {
+		c.Header("OCI-Subject", subject)
+	}
 	c.Header("Docker-Content-Digest", digest)
 	c.Status(http.StatusCreated)
+	h.notify(c, EventActionPush, manifestTarget(repository, reference, digest, mediaType, int64(len(body))))
 }
 
 // handleDeleteManifest 处理DELETE请求，删除manifest
+// 引用是标签时默认只删除标签，清单可能仍被其他标签使用，由垃圾回收清理
 func (h *Handler) handleDeleteManifest(c *gin.Context, repository, reference string) {
+	if !strings.HasPrefix(reference, "sha256:") && !h.deleteTagManifest {
+		h.deleteTag(c, repository, reference)
+		return
+	}
+
 	if err := h.storage.DeleteManifest(repository, reference); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
 		return
 	}
 
 	c.Status(http.StatusAccepted)
+	h.notify(c, EventActionDelete, EventTarget{Digest: reference, Repository: repository})
 }
 
 // handleBlobs 处理 blob
@@ -365,8 +615,11 @@ func (h *Handler) handleBlobs(c *gin.Context) {
 	// 打印调试信息
 	log.Printf("处理blob请求: repository=%s, digest=%s, URL=%s", repositoryPath, digest, c.Request.URL.Path)
 
-	if repositoryPath == "" || digest == "" {
-		c.String(http.StatusBadRequest, "Repository or digest not specified")
+	if !validRepository(c.Writer, repositoryPath) {
+		return
+	}
+	if digest == "" {
+		writeRegistryError(c.Writer, http.StatusBadRequest, errCodeDigestInvalid, "digest not specified")
 		return
 	}
 
@@ -378,7 +631,7 @@ func (h *Handler) handleBlobs(c *gin.Context) {
 	case http.MethodDelete:
 		h.handleDeleteBlob(c, repositoryPath, digest)
 	default:
-		c.String(http.StatusMethodNotAllowed, "Method not allowed")
+		writeRegistryError(c.Writer, http.StatusMethodNotAllowed, errCodeUnsupported, "method not allowed")
 	}
 }
 
@@ -387,7 +640,7 @@ func (h *Handler) handleHeadBlob(c *gin.Context, repository, digest string) {
 	// 检查 blob 是否存在
 	size, err := h.storage.GetBlobSize(repository, digest)
 	if err != nil {
-		c.String(http.StatusNotFound, err.Error())
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeBlobUnknown, err.Error())
 		return
 	}
 
@@ -401,7 +654,7 @@ func (h *Handler) handleHeadBlob(c *gin.Context, repository, digest string) {
 func (h *Handler) handleGetBlob(c *gin.Context, repository, digest string) {
 	reader, size, err := h.storage.GetBlob(repository, digest)
 	if err != nil {
-		c.String(http.StatusNotFound, err.Error())
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeBlobUnknown, err.Error())
 		return
 	}
 	defer reader.Close()
@@ -417,13 +670,24 @@ func (h *Handler) handleGetBlob(c *gin.Context, repository, digest string) {
 // handleDeleteBlob 处理DELETE请求，删除blob
 func (h *Handler) handleDeleteBlob(c *gin.Context, repository, digest string) {
 	if err := h.storage.DeleteBlob(repository, digest); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
 		return
 	}
 
 	c.Status(http.StatusAccepted)
 }
 
+// mountBlob 把 from 仓库中的 blob 挂载到 repository，挂载同样计入目标仓库的配额
+func (h *Handler) mountBlob(repository, from, digest string) error {
+	size, err := h.storage.GetBlobSize(from, digest)
+	if err != nil {
+		return err
+	}
+	return h.quota.admit(repository, "", digest, size, func() error {
+		return h.storage.MountBlob(repository, from, digest)
+	})
+}
+
 // handleInitiateUpload 处理上传初始化
 func (h *Handler) handleInitiateUpload(c *gin.Context) {
 	// 获取完整的仓库路径
@@ -439,17 +703,40 @@ func (h *Handler) handleInitiateUpload(c *gin.Context) {
 	// 打印调试信息
 	log.Printf("处理上传初始化请求: repository=%s, URL=%s", repositoryPath, c.Request.URL.Path)
 
-	if repositoryPath == "" {
-		c.String(http.StatusBadRequest, "Repository not specified")
+	if !validRepository(c.Writer, repositoryPath) {
 		return
 	}
 
+	// 跨仓库挂载已有的 blob，失败时按规范退回普通上传
+	if mount, from := c.Query("mount"), c.Query("from"); mount != "" && from != "" && sha256DigestPattern.MatchString(mount) && h.canPull(c, from) {
+		err := h.mountBlob(repositoryPath, from, mount)
+		if err == nil {
+			c.Header("Docker-Content-Digest", mount)
+			c.Header("Location", fmt.Sprintf("/v2/%s/blobs/%s", repositoryPath, mount))
+			c.Status(http.StatusCreated)
+			h.notify(c, EventActionMount, h.blobTarget(repositoryPath, mount))
+			return
+		}
+		log.Printf("Failed to mount blob %s from %s to %s: %v", mount, from, repositoryPath, err)
+	}
+
 	// 生成上传 ID
-	uploadID := generateUploadID()
+	uploadID, err := generateUploadID()
+	if err != nil {
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
+		return
+	}
 
 	// 创建上传路径
 	if err := h.storage.InitiateUpload(repositoryPath, uploadID); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
+		return
+	}
+	h.hashes.start(repositoryPath, uploadID)
+
+	// 带 digest 参数时请求体就是完整的 blob，一次请求完成上传
+	if digest := c.Query("digest"); digest != "" {
+		h.completeUpload(c, repositoryPath, uploadID, digest)
 		return
 	}
 
@@ -482,63 +769,261 @@ func (h *Handler) handleUpload(c *gin.Context) {
 	// 打印调试信息
 	log.Printf("处理上传请求: repository=%s, uploadID=%s, URL=%s", repositoryPath, uploadID, c.Request.URL.Path)
 
-	if repositoryPath == "" || uploadID == "" {
-		c.String(http.StatusBadRequest, "Repository or upload ID not specified")
+	if !validRepository(c.Writer, repositoryPath) {
+		return
+	}
+	if uploadID == "" {
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeBlobUploadUnknown, "upload ID not specified")
+		return
+	}
+	if !uploadIDPattern.MatchString(uploadID) {
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeBlobUploadUnknown, fmt.Sprintf("upload %s not found", uploadID))
 		return
 	}
 
 	switch c.Request.Method {
+	case http.MethodGet:
+		h.handleUploadStatus(c, repositoryPath, uploadID)
+	case http.MethodDelete:
+		h.handleCancelUpload(c, repositoryPath, uploadID)
 	case http.MethodPatch:
 		h.handlePatchUpload(c, repositoryPath, uploadID)
 	case http.MethodPut:
 		h.handlePutUpload(c, repositoryPath, uploadID)
 	default:
-		c.String(http.StatusMethodNotAllowed, "Method not allowed")
+		writeRegistryError(c.Writer, http.StatusMethodNotAllowed, errCodeUnsupported, "method not allowed")
 	}
 }
 
+// handleUploadStatus 处理GET请求，返回上传已接收的范围，客户端据此断点续传
+func (h *Handler) handleUploadStatus(c *gin.Context, repository, uploadID string) {
+	size, err := h.storage.GetUploadSize(repository, uploadID)
+	if err != nil {
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeBlobUploadUnknown, err.Error())
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repository, uploadID))
+	c.Header("Range", uploadRange(size))
+	c.Header("Docker-Upload-UUID", uploadID)
+	c.Status(http.StatusNoContent)
+}
+
+// handleCancelUpload 处理DELETE请求，取消上传并删除已接收的数据
+func (h *Handler) handleCancelUpload(c *gin.Context, repository, uploadID string) {
+	if err := h.storage.CancelUpload(repository, uploadID); err != nil {
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeBlobUploadUnknown, err.Error())
+		return
+	}
+	h.hashes.remove(repository, uploadID)
+	c.Status(http.StatusNoContent)
+}
+
 // handlePatchUpload 处理PATCH请求，追加上传数据
+// 请求体直接流式写入存储，不在内存中缓冲；带 Content-Range 时起点必须等于已接收的大小，
+// 检查和写入都在上传的锁内进行，并发的分块不会同时通过检查
 func (h *Handler) handlePatchUpload(c *gin.Context, repository, uploadID string) {
-	// 追加数据
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+	state, ok := h.uploadHash(c, repository, uploadID)
+	if !ok {
+		return
+	}
+	defer state.release()
+	body, current, ok := h.uploadBody(c, repository, uploadID)
+	if !ok {
 		return
 	}
 
-	offset, err := h.storage.AppendToUpload(repository, uploadID, body)
+	if contentRange := c.GetHeader("Content-Range"); contentRange != "" {
+		start, end, err := parseContentRange(contentRange)
+		if err != nil {
+			writeRegistryError(c.Writer, http.StatusBadRequest, errCodeBlobUploadInvalid, err.Error())
+			return
+		}
+		if start != current {
+			// 分块乱序，返回当前进度让客户端从正确的位置继续
+			c.Header("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repository, uploadID))
+			c.Header("Range", uploadRange(current))
+			c.Header("Docker-Upload-UUID", uploadID)
+			writeRegistryError(c.Writer, http.StatusRequestedRangeNotSatisfiable, errCodeBlobUploadInvalid,
+				fmt.Sprintf("chunk starts at %d, expected %d", start, current))
+			return
+		}
+		if c.Request.ContentLength >= 0 && c.Request.ContentLength != end-start+1 {
+			writeRegistryError(c.Writer, http.StatusBadRequest, errCodeBlobUploadInvalid, "Content-Length does not match Content-Range")
+			return
+		}
+	}
+
+	offset, err := h.storage.AppendToUpload(repository, uploadID, io.TeeReader(body, state.hash))
+	if err != nil {
+		// 已计算摘要的数据不一定都写入了存储，下一个请求从存储重建摘要状态
+		state.hash = nil
+	}
+	if body.exceeded {
+		writeRegistryError(c.Writer, http.StatusRequestEntityTooLarge, errCodeSizeInvalid, errBlobTooLarge.Error())
+		return
+	}
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
 		return
 	}
 
 	c.Header("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repository, uploadID))
-	c.Header("Range", fmt.Sprintf("0-%d", offset-1))
+	c.Header("Range", uploadRange(offset))
 	c.Header("Docker-Upload-UUID", uploadID)
 	c.Status(http.StatusAccepted)
 }
 
 // handlePutUpload 处理PUT请求，完成上传
 func (h *Handler) handlePutUpload(c *gin.Context, repository, uploadID string) {
-	// 完成上传
 	digest := c.Query("digest")
 	if digest == "" {
-		c.String(http.StatusBadRequest, "Digest parameter required")
+		writeRegistryError(c.Writer, http.StatusBadRequest, errCodeDigestInvalid, "digest parameter required")
+		return
+	}
+	h.completeUpload(c, repository, uploadID, digest)
+}
+
+// completeUpload 写入剩余数据并校验摘要，摘要一致时才把上传提交为 blob
+func (h *Handler) completeUpload(c *gin.Context, repository, uploadID, digest string) {
+	if !sha256DigestPattern.MatchString(digest) {
+		writeRegistryError(c.Writer, http.StatusBadRequest, errCodeDigestInvalid, fmt.Sprintf("unsupported digest %s", digest))
+		return
+	}
+	state, ok := h.uploadHash(c, repository, uploadID)
+	if !ok {
+		return
+	}
+	defer state.release()
+	body, _, ok := h.uploadBody(c, repository, uploadID)
+	if !ok {
 		return
 	}
 
 	// 处理可能的剩余数据
-	var body []byte
-	if c.Request.ContentLength > 0 {
-		body, _ = io.ReadAll(c.Request.Body)
+	_, err := h.storage.AppendToUpload(repository, uploadID, io.TeeReader(body, state.hash))
+	if err != nil {
+		state.hash = nil
+	}
+	if body.exceeded {
+		writeRegistryError(c.Writer, http.StatusRequestEntityTooLarge, errCodeSizeInvalid, errBlobTooLarge.Error())
+		return
+	}
+	if err != nil {
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
+		return
+	}
+
+	if actual := fmt.Sprintf("sha256:%x", state.hash.Sum(nil)); actual != digest {
+		// 数据已经无法与声明的摘要对应，取消上传，后续请求按未知上传处理
+		h.storage.CancelUpload(repository, uploadID)
+		h.hashes.remove(repository, uploadID)
+		writeRegistryError(c.Writer, http.StatusBadRequest, errCodeDigestInvalid,
+			fmt.Sprintf("digest mismatch: expected %s, got %s", digest, actual))
+		return
 	}
 
-	if err := h.storage.CompleteUpload(repository, uploadID, digest, body); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	size, err := h.storage.GetUploadSize(repository, uploadID)
+	if err != nil {
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeBlobUploadUnknown, err.Error())
+		return
+	}
+	if err := h.quota.admit(repository, "", digest, size, func() error {
+		return h.storage.CompleteUpload(repository, uploadID, digest, http.NoBody)
+	}); err != nil {
+		if errors.Is(err, ErrQuotaExceeded) {
+			// 超过配额的上传不会再被提交，直接丢弃已接收的数据
+			h.storage.CancelUpload(repository, uploadID)
+			h.hashes.remove(repository, uploadID)
+		}
+		writeQuotaError(c.Writer, err)
 		return
 	}
+	h.hashes.remove(repository, uploadID)
 
 	c.Header("Docker-Content-Digest", digest)
 	c.Header("Location", fmt.Sprintf("/v2/%s/blobs/%s", repository, digest))
 	c.Status(http.StatusCreated)
+	h.notify(c, EventActionPush, h.blobTarget(repository, digest))
+}
+
+// uploadHash 返回加锁的上传摘要状态，调用方处理完成后调用 release
+// 摘要状态不存在时从存储读取已接收的数据重建，上传不存在或存储无法读取时返回 BLOB_UPLOAD_UNKNOWN
+func (h *Handler) uploadHash(c *gin.Context, repository, uploadID string) (*uploadHash, bool) {
+	state, err := h.hashes.acquire(repository, uploadID, func() (hash.Hash, error) {
+		return h.rebuildUploadHash(repository, uploadID)
+	})
+	if err != nil {
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeBlobUploadUnknown, fmt.Sprintf("upload %s not found: %v", uploadID, err))
+		return nil, false
+	}
+	return state, true
+}
+
+// rebuildUploadHash 重新读取上传已接收的数据计算摘要状态，存储记录了摘要状态时直接使用
+func (h *Handler) rebuildUploadHash(repository, uploadID string) (hash.Hash, error) {
+	if hasher, ok := h.storage.(storage.UploadHasher); ok {
+		return hasher.UploadHash(repository, uploadID)
+	}
+	reader, ok := h.storage.(storage.UploadReader)
+	if !ok {
+		return nil, errors.New("storage cannot resume uploads started by another process")
+	}
+	r, err := reader.ReadUpload(repository, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return nil, fmt.Errorf("failed to read upload: %v", err)
+	}
+	return hasher, nil
+}
+
+// uploadBody 返回限制了大小的请求体和上传已接收的字节数，上传的总大小不能超过 maxBlobSize
+// Content-Length 已经超过剩余额度时直接拒绝，不读取请求体
+func (h *Handler) uploadBody(c *gin.Context, repository, uploadID string) (*sizeLimitedReader, int64, bool) {
+	current, err := h.storage.GetUploadSize(repository, uploadID)
+	if err != nil {
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeBlobUnknown, err.Error())
+		return nil, 0, false
+	}
+
+	remaining := int64(math.MaxInt64)
+	if h.maxBlobSize > 0 {
+		remaining = h.maxBlobSize - current
+	}
+	if c.Request.ContentLength > remaining {
+		writeRegistryError(c.Writer, http.StatusRequestEntityTooLarge, errCodeSizeInvalid, errBlobTooLarge.Error())
+		return nil, 0, false
+	}
+	return &sizeLimitedReader{r: c.Request.Body, remaining: remaining}, current, true
+}
+
+// sizeLimitedReader 最多读取 remaining 字节，超过时返回 errBlobTooLarge 并记录 exceeded
+// 与 io.LimitReader 不同，超出的数据不会被静默截断
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// 额度用完后再读一个字节，判断请求体是否还有数据
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			l.exceeded = true
+			return 0, errBlobTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
 }
@@ -1,10 +1,18 @@
 package registry
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/smartcat999/container-ui/internal/storage"
 )
@@ -12,14 +20,14 @@ import (
 func TestHandleVersionCheck(t *testing.T) {
 	// 创建存储
 	store := storage.NewMemoryStorage()
-	handler := NewHandler(store)
+	router := NewRouter(NewHandler(store))
 
 	// 创建请求
 	req := httptest.NewRequest("GET", "/v2/", nil)
 	w := httptest.NewRecorder()
 
 	// 调用处理函数
-	handler.handleVersionCheck(w, req)
+	router.ServeHTTP(w, req)
 
 	// 检查响应
 	resp := w.Result()
@@ -31,7 +39,7 @@ func TestHandleVersionCheck(t *testing.T) {
 func TestHandleCatalog(t *testing.T) {
 	// 创建存储
 	store := storage.NewMemoryStorage()
-	handler := NewHandler(store)
+	router := NewRouter(NewHandler(store))
 
 	// 添加测试数据
 	err := store.PutManifest("repo1", "tag1", "sha256:1234", []byte("test"))
@@ -48,7 +56,7 @@ func TestHandleCatalog(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// 调用处理函数
-	handler.handleCatalog(w, req)
+	router.ServeHTTP(w, req)
 
 	// 检查响应
 	resp := w.Result()
@@ -58,7 +66,7 @@ func TestHandleCatalog(t *testing.T) {
 
 	// 检查内容类型
 	contentType := resp.Header.Get("Content-Type")
-	if contentType != "application/json" {
+	if !strings.HasPrefix(contentType, "application/json") {
 		t.Errorf("Expected content type application/json, got %v", contentType)
 	}
 
@@ -74,82 +82,6 @@ func TestHandleCatalog(t *testing.T) {
 	}
 }
 
-func TestRouterPathMatching(t *testing.T) {
-	testCases := []struct {
-		name           string
-		pattern        string
-		path           string
-		expectedMatch  bool
-		expectedParams map[string]string
-	}{
-		{
-			name:           "Exact match",
-			pattern:        "/v2/",
-			path:           "/v2/",
-			expectedMatch:  true,
-			expectedParams: map[string]string{},
-		},
-		{
-			name:          "With parameter",
-			pattern:       "/v2/{repository}/tags/list",
-			path:          "/v2/my-repo/tags/list",
-			expectedMatch: true,
-			expectedParams: map[string]string{
-				"repository": "my-repo",
-			},
-		},
-		{
-			name:          "With nested repository",
-			pattern:       "/v2/{repository}/manifests/{reference}",
-			path:          "/v2/user/my-repo/manifests/latest",
-			expectedMatch: true,
-			expectedParams: map[string]string{
-				"repository": "user/my-repo",
-				"reference":  "latest",
-			},
-		},
-		{
-			name:           "No match wrong path",
-			pattern:        "/v2/{repository}/blobs/{digest}",
-			path:           "/v2/my-repo/tags/list",
-			expectedMatch:  false,
-			expectedParams: nil,
-		},
-		{
-			name:           "No match extra segment",
-			pattern:        "/v2/{repository}/tags/list",
-			path:           "/v2/my-repo/tags/list/extra",
-			expectedMatch:  false,
-			expectedParams: nil,
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			params, matched := matchPath(tc.pattern, tc.path)
-
-			if matched != tc.expectedMatch {
-				t.Errorf("Expected match: %v, got: %v", tc.expectedMatch, matched)
-			}
-
-			if !matched {
-				return
-			}
-
-			// 检查参数
-			if len(params) != len(tc.expectedParams) {
-				t.Errorf("Expected %d params, got %d", len(tc.expectedParams), len(params))
-			}
-
-			for k, v := range tc.expectedParams {
-				if params[k] != v {
-					t.Errorf("Expected param %s=%s, got %s", k, v, params[k])
-				}
-			}
-		})
-	}
-}
-
 func TestRouterServeHTTP(t *testing.T) {
 	// 创建存储
 	store := storage.NewMemoryStorage()
@@ -176,13 +108,511 @@ func TestRouterServeHTTP(t *testing.T) {
 		t.Errorf("Expected status NotFound for non-existent route, got %v", resp.StatusCode)
 	}
 
-	// 测试方法不匹配
+	// 测试方法不匹配，与其他接口一致返回 405 UNSUPPORTED
 	req = httptest.NewRequest("POST", "/v2/", nil)
 	w = httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
 	resp = w.Result()
-	if resp.StatusCode != http.StatusNotFound {
-		t.Errorf("Expected status NotFound for method mismatch, got %v", resp.StatusCode)
+	if resp.StatusCode != http.StatusMethodNotAllowed || !strings.Contains(w.Body.String(), errCodeUnsupported) {
+		t.Errorf("Expected status MethodNotAllowed with %s for method mismatch, got %v: %s", errCodeUnsupported, resp.StatusCode, w.Body.String())
+	}
+}
+
+func TestHandleStreamedUpload(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	router := NewRouter(NewHandlerWithOptions(store, HandlerOptions{MaxBlobSize: 8}))
+	serve := func(method, path string, body io.Reader) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, body))
+		return w
+	}
+
+	w := serve(http.MethodPost, "/v2/repo/blobs/uploads/", nil)
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusAccepted || location == "" {
+		t.Fatalf("Expected upload to start, got %d", w.Code)
+	}
+
+	// 长度未知的请求体按流读取
+	w = serve(http.MethodPatch, location, io.MultiReader(strings.NewReader("lay")))
+	if w.Code != http.StatusAccepted || w.Header().Get("Range") != "0-2" {
+		t.Fatalf("Unexpected patch response %d Range %q", w.Code, w.Header().Get("Range"))
+	}
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("layer")))
+	w = serve(http.MethodPut, location+"?digest="+layerDigest, strings.NewReader("er"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected upload to complete, got %d: %s", w.Code, w.Body.String())
+	}
+	if size, err := store.GetBlobSize("repo", layerDigest); err != nil || size != 5 {
+		t.Fatalf("Unexpected blob size %d %v", size, err)
+	}
+
+	// 超过大小上限：声明的长度直接拒绝，流式请求体读到上限后拒绝
+	location = serve(http.MethodPost, "/v2/repo/blobs/uploads/", nil).Header().Get("Location")
+	if w := serve(http.MethodPatch, location, strings.NewReader("123456789")); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413 for declared length, got %d", w.Code)
+	}
+	if w := serve(http.MethodPatch, location, io.MultiReader(strings.NewReader("123456789"))); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413 for streamed body, got %d", w.Code)
+	}
+}
+
+func TestHandleUploadVerification(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	router := NewRouter(NewHandler(store))
+	serve := func(method, path, contentRange string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentRange != "" {
+			req.Header.Set("Content-Range", contentRange)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	digestOf := func(data string) string {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(data)))
+	}
+
+	// 按顺序发送分块，乱序的分块返回 416 和当前进度
+	location := serve(http.MethodPost, "/v2/repo/blobs/uploads/", "", "").Header().Get("Location")
+	if w := serve(http.MethodPatch, location, "0-2", "abc"); w.Code != http.StatusAccepted || w.Header().Get("Range") != "0-2" {
+		t.Fatalf("Unexpected first chunk response %d Range %q", w.Code, w.Header().Get("Range"))
+	}
+	if w := serve(http.MethodPatch, location, "5-7", "fgh"); w.Code != http.StatusRequestedRangeNotSatisfiable || w.Header().Get("Range") != "0-2" {
+		t.Fatalf("Expected 416 for out-of-order chunk, got %d Range %q", w.Code, w.Header().Get("Range"))
+	}
+	if w := serve(http.MethodPatch, location, "3-5", "de"); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for length mismatch, got %d", w.Code)
+	}
+	if w := serve(http.MethodPatch, location, "3-4", "de"); w.Code != http.StatusAccepted || w.Header().Get("Range") != "0-4" {
+		t.Fatalf("Unexpected second chunk response %d Range %q", w.Code, w.Header().Get("Range"))
+	}
+
+	// 摘要不一致时拒绝，不生成 blob
+	w := serve(http.MethodPut, location+"?digest="+digestOf("wrong"), "", "")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "DIGEST_INVALID") {
+		t.Fatalf("Expected DIGEST_INVALID, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := store.GetBlobSize("repo", digestOf("wrong")); err == nil {
+		t.Fatal("Expected mismatched blob not to be stored")
+	}
+
+	// 单个 POST 请求完成上传
+	w = serve(http.MethodPost, "/v2/repo/blobs/uploads/?digest="+digestOf("monolithic"), "", "monolithic")
+	if w.Code != http.StatusCreated || w.Header().Get("Docker-Content-Digest") != digestOf("monolithic") {
+		t.Fatalf("Expected monolithic upload to complete, got %d: %s", w.Code, w.Body.String())
+	}
+	if size, err := store.GetBlobSize("repo", digestOf("monolithic")); err != nil || size != 10 {
+		t.Fatalf("Unexpected blob size %d %v", size, err)
+	}
+	if w := serve(http.MethodPost, "/v2/repo/blobs/uploads/?digest="+digestOf("other"), "", "monolithic"); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected monolithic upload with wrong digest to fail, got %d", w.Code)
+	}
+}
+
+func TestHandleUploadSession(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	handler := NewHandlerWithOptions(store, HandlerOptions{UploadTTL: time.Hour})
+	router := NewRouter(handler)
+	serve := func(method, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	location := serve(http.MethodPost, "/v2/repo/blobs/uploads/", "").Header().Get("Location")
+	serve(http.MethodPatch, location, "abc")
+	if w := serve(http.MethodGet, location, ""); w.Code != http.StatusNoContent || w.Header().Get("Range") != "0-2" {
+		t.Fatalf("Unexpected status response %d Range %q", w.Code, w.Header().Get("Range"))
+	}
+
+	// 取消后上传不存在
+	if w := serve(http.MethodDelete, location, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected cancel to succeed, got %d", w.Code)
+	}
+	if w := serve(http.MethodGet, location, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected cancelled upload to be unknown, got %d", w.Code)
+	}
+
+	// 超过 TTL 没有写入的上传被清理
+	location = serve(http.MethodPost, "/v2/repo/blobs/uploads/", "").Header().Get("Location")
+	handler.purgeUploads(time.Now())
+	if w := serve(http.MethodGet, location, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected fresh upload to survive, got %d", w.Code)
+	}
+	handler.purgeUploads(time.Now().Add(2 * time.Hour))
+	if w := serve(http.MethodGet, location, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected stale upload to be purged, got %d", w.Code)
+	}
+	if w := serve(http.MethodPatch, location, "abc"); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected patch to purged upload to fail, got %d", w.Code)
+	}
+}
+
+func TestHandleUploadAfterRestart(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	serve := func(router http.Handler, method, path, contentRange, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentRange != "" {
+			req.Header.Set("Content-Range", contentRange)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := NewRouter(NewHandler(store))
+	location := serve(first, http.MethodPost, "/v2/repo/blobs/uploads/", "", "").Header().Get("Location")
+	serve(first, http.MethodPatch, location, "0-2", "abc")
+
+	// 新的处理器没有摘要状态，从存储中已接收的数据重建后继续上传
+	second := NewRouter(NewHandler(store))
+	if w := serve(second, http.MethodPatch, location, "3-5", "def"); w.Code != http.StatusAccepted || w.Header().Get("Range") != "0-5" {
+		t.Fatalf("Unexpected patch response %d Range %q: %s", w.Code, w.Header().Get("Range"), w.Body.String())
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("abcdefgh")))
+	if w := serve(second, http.MethodPut, location+"?digest="+digest, "", "gh"); w.Code != http.StatusCreated {
+		t.Fatalf("Expected upload to complete, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 不存在的上传仍然返回 BLOB_UPLOAD_UNKNOWN
+	w := serve(second, http.MethodPatch, "/v2/repo/blobs/uploads/00000000-0000-4000-8000-000000000000", "", "abc")
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "BLOB_UPLOAD_UNKNOWN") {
+		t.Fatalf("Expected BLOB_UPLOAD_UNKNOWN, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// s3Bucket 模拟上传用到的 S3 接口子集，未完成的分段上传只能列出分段，不能读取数据
+type s3Bucket struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+	meta    map[string]http.Header
+	parts   map[string]map[int][]byte // uploadId -> 分段
+	keys    map[string]string         // uploadId -> 对象键
+}
+
+func (b *s3Bucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(b.keys)+1)
+		b.parts[id], b.keys[id] = map[int][]byte{}, key
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodGet && query.Has("uploads"):
+		fmt.Fprint(w, "<ListMultipartUploadsResult>")
+		for id, k := range b.keys {
+			if strings.HasPrefix(k, query.Get("prefix")) {
+				fmt.Fprintf(w, "<Upload><Key>%s</Key><UploadId>%s</UploadId></Upload>", k, id)
+			}
+		}
+		fmt.Fprint(w, "</ListMultipartUploadsResult>")
+	case r.Method == http.MethodGet && query.Has("uploadId"):
+		fmt.Fprint(w, "<ListPartsResult>")
+		for number, data := range b.parts[query.Get("uploadId")] {
+			fmt.Fprintf(w, "<Part><PartNumber>%d</PartNumber><ETag>etag</ETag><Size>%d</Size></Part>", number, len(data))
+		}
+		fmt.Fprint(w, "</ListPartsResult>")
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		b.parts[query.Get("uploadId")][number] = body
+		w.Header().Set("ETag", "etag")
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts := b.parts[query.Get("uploadId")]
+		var data []byte
+		for number := 1; number <= len(parts); number++ {
+			data = append(data, parts[number]...)
+		}
+		b.objects[key] = data
+		delete(b.parts, query.Get("uploadId"))
+		delete(b.keys, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult/>")
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		src, _ := url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/bucket/"))
+		b.objects[key] = b.objects[src]
+		fmt.Fprint(w, "<CopyObjectResult/>")
+	case r.Method == http.MethodPut:
+		b.objects[key], b.meta[key] = body, r.Header.Clone()
+	case r.Method == http.MethodDelete:
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		data, ok := b.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for name, values := range b.meta[key] {
+			if strings.HasPrefix(name, "X-Amz-Meta-") {
+				w.Header()[name] = values
+			}
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	}
+}
+
+func TestHandleS3UploadAfterRestart(t *testing.T) {
+	bucket := &s3Bucket{objects: map[string][]byte{}, meta: map[string]http.Header{}, parts: map[string]map[int][]byte{}, keys: map[string]string{}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+	newStore := func() storage.Storage {
+		store, err := storage.NewS3Storage(storage.S3Config{Endpoint: server.URL, Bucket: "bucket", PathStyle: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+	serve := func(router http.Handler, method, path, contentRange, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentRange != "" {
+			req.Header.Set("Content-Range", contentRange)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := NewRouter(NewHandler(newStore()))
+	location := serve(first, http.MethodPost, "/v2/repo/blobs/uploads/", "", "").Header().Get("Location")
+	if w := serve(first, http.MethodPatch, location, "0-2", "abc"); w.Code != http.StatusAccepted {
+		t.Fatalf("Unexpected patch response %d: %s", w.Code, w.Body.String())
+	}
+
+	// 其他实例上的处理器和存储都没有上传的状态，摘要状态从 bucket 中保存的状态恢复
+	second := NewRouter(NewHandler(newStore()))
+	if w := serve(second, http.MethodPatch, location, "3-5", "def"); w.Code != http.StatusAccepted || w.Header().Get("Range") != "0-5" {
+		t.Fatalf("Unexpected patch response %d Range %q: %s", w.Code, w.Header().Get("Range"), w.Body.String())
+	}
+	third := NewRouter(NewHandler(newStore()))
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("abcdefgh")))
+	if w := serve(third, http.MethodPut, location+"?digest="+digest, "", "gh"); w.Code != http.StatusCreated {
+		t.Fatalf("Expected upload to complete, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := serve(third, http.MethodGet, "/v2/repo/blobs/"+digest, "", ""); w.Code != http.StatusOK || w.Body.String() != "abcdefgh" {
+		t.Fatalf("Unexpected blob %d: %q", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleMountBlob(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	router := NewRouter(NewHandler(store))
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("layer")))
+	if _, err := store.PutBlob("base", digest, strings.NewReader("layer")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(http.MethodPost, "/v2/app/blobs/uploads/?mount="+digest+"&from=base")
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/v2/app/blobs/"+digest {
+		t.Fatalf("Expected blob to be mounted, got %d Location %q", w.Code, w.Header().Get("Location"))
+	}
+	if size, err := store.GetBlobSize("app", digest); err != nil || size != 5 {
+		t.Fatalf("Unexpected mounted blob size %d %v", size, err)
+	}
+
+	// 来源仓库没有该 blob 时退回普通上传
+	w = serve(http.MethodPost, "/v2/app/blobs/uploads/?mount="+digest+"&from=missing")
+	if w.Code != http.StatusAccepted || w.Header().Get("Docker-Upload-UUID") == "" {
+		t.Fatalf("Expected fallback to upload, got %d", w.Code)
+	}
+}
+
+func TestHandlePagination(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	for _, repo := range []string{"c", "a", "b"} {
+		for _, tag := range []string{"v3", "v1", "v2"} {
+			if err := store.PutManifest(repo, tag, "sha256:"+tag, []byte("{}")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	router := NewRouter(NewHandler(store))
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := serve("/v2/_catalog?n=2")
+	if !strings.Contains(w.Body.String(), `["a","b"]`) || w.Header().Get("Link") != `</v2/_catalog?last=b&n=2>; rel="next"` {
+		t.Fatalf("Unexpected first page %s Link %q", w.Body.String(), w.Header().Get("Link"))
+	}
+	w = serve("/v2/_catalog?n=2&last=b")
+	if !strings.Contains(w.Body.String(), `["c"]`) || w.Header().Get("Link") != "" {
+		t.Fatalf("Unexpected last page %s Link %q", w.Body.String(), w.Header().Get("Link"))
+	}
+
+	w = serve("/v2/a/tags/list?n=1&last=v1")
+	if !strings.Contains(w.Body.String(), `["v2"]`) || w.Header().Get("Link") != `</v2/a/tags/list?last=v2&n=1>; rel="next"` {
+		t.Fatalf("Unexpected tags page %s Link %q", w.Body.String(), w.Header().Get("Link"))
+	}
+	if w := serve("/v2/a/tags/list?n=-1"); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected invalid n to be rejected, got %d", w.Code)
+	}
+}
+
+func TestHandleDeleteTag(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	manifest := []byte(`{"schemaVersion":2}`)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+	for _, tag := range []string{"v1", "latest", "stable"} {
+		if err := store.PutManifest("app", tag, digest, manifest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	serve := func(handler *Handler, method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		NewRouter(handler).ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// 按标签删除清单默认只删除标签
+	handler := NewHandler(store)
+	if w := serve(handler, http.MethodDelete, "/v2/app/manifests/v1"); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected tag deletion, got %d", w.Code)
+	}
+	if w := serve(handler, http.MethodDelete, "/v2/app/tags/latest"); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected tag deletion through tags API, got %d", w.Code)
+	}
+	if tags, _ := store.ListTags("app"); strings.Join(tags, ",") != "stable" {
+		t.Fatalf("Unexpected remaining tags %v", tags)
+	}
+	if _, _, err := store.GetManifest("app", "stable"); err != nil {
+		t.Fatalf("Expected shared manifest to remain: %v", err)
+	}
+	if w := serve(handler, http.MethodDelete, "/v2/app/tags/missing"); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected missing tag to return 404, got %d", w.Code)
+	}
+
+	// 配置后按标签删除同时删除清单
+	handler = NewHandlerWithOptions(store, HandlerOptions{DeleteTagManifest: true})
+	if w := serve(handler, http.MethodDelete, "/v2/app/manifests/stable"); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected manifest deletion, got %d", w.Code)
+	}
+	if _, _, err := store.GetManifestByDigest("app", digest); err == nil {
+		t.Fatal("Expected manifest to be deleted")
+	}
+}
+
+func TestHandleRegistryErrors(t *testing.T) {
+	router := NewRouter(NewHandler(storage.NewMemoryStorage()))
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("missing")))
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{http.MethodGet, "/v2/app/manifests/latest", http.StatusNotFound, errCodeManifestUnknown},
+		{http.MethodGet, "/v2/app/blobs/" + digest, http.StatusNotFound, errCodeBlobUnknown},
+		{http.MethodGet, "/v2/App/tags/list", http.StatusBadRequest, errCodeNameInvalid},
+		{http.MethodPut, "/v2/app/manifests/v1", http.StatusBadRequest, errCodeManifestInvalid},
+		{http.MethodPut, "/v2/app/manifests/" + digest, http.StatusBadRequest, errCodeDigestInvalid},
+		{http.MethodPost, "/v2/app/manifests/v1", http.StatusMethodNotAllowed, errCodeUnsupported},
+		{http.MethodGet, "/v2/app/referrers/latest", http.StatusBadRequest, errCodeDigestInvalid},
+		{http.MethodGet, "/v2/app/unknown/endpoint", http.StatusNotFound, errCodeUnsupported},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader("not json")))
+
+		var body struct {
+			Errors []struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Errors) != 1 {
+			t.Fatalf("%s %s: expected error envelope, got %d: %s", tt.method, tt.path, w.Code, w.Body.String())
+		}
+		if w.Code != tt.status || body.Errors[0].Code != tt.code {
+			t.Errorf("%s %s: expected %d %s, got %d %s", tt.method, tt.path, tt.status, tt.code, w.Code, body.Errors[0].Code)
+		}
+	}
+}
+
+func TestUploadIDs(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	router := NewRouter(NewHandler(store))
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// 并发发起上传，ID 不重复且符合格式
+	ids := make(chan string, 50)
+	for i := 0; i < cap(ids); i++ {
+		go func() {
+			ids <- serve(http.MethodPost, "/v2/repo/blobs/uploads/").Header().Get("Docker-Upload-UUID")
+		}()
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < cap(ids); i++ {
+		id := <-ids
+		if !uploadIDPattern.MatchString(id) || seen[id] {
+			t.Fatalf("Unexpected upload ID %q", id)
+		}
+		seen[id] = true
+	}
+
+	// 格式不正确的 ID 直接返回 BLOB_UPLOAD_UNKNOWN，不访问存储
+	if w := serve(http.MethodPatch, "/v2/repo/blobs/uploads/..%2Fother"); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for invalid upload ID, got %d", w.Code)
+	}
+}
+
+func TestManifestConditionalRequests(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	router := NewRouter(NewHandler(store))
+	manifest := `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","layers":[]}`
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest)))
+	if err := store.PutManifest("repo", "latest", digest, []byte(manifest)); err != nil {
+		t.Fatal(err)
+	}
+	serve := func(method string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v2/repo/manifests/latest", nil)
+		req.Header = header
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodGet, http.Header{})
+	etag, modified := w.Header().Get("Etag"), w.Header().Get("Last-Modified")
+	if w.Code != http.StatusOK || etag != `"`+digest+`"` || modified == "" {
+		t.Fatalf("Unexpected response %d ETag %q Last-Modified %q", w.Code, etag, modified)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		if w := serve(method, http.Header{"If-None-Match": {`"other", ` + etag}}); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Fatalf("%s: expected 304 for matching ETag, got %d", method, w.Code)
+		}
+		if w := serve(method, http.Header{"If-Modified-Since": {modified}}); w.Code != http.StatusNotModified {
+			t.Fatalf("%s: expected 304 for unmodified manifest, got %d", method, w.Code)
+		}
+		// If-None-Match 不匹配时忽略 If-Modified-Since
+		if w := serve(method, http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {modified}}); w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200 for stale ETag, got %d", method, w.Code)
+		}
+	}
+
+	stale := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	if w := serve(http.MethodGet, http.Header{"If-Modified-Since": {stale}}); w.Code != http.StatusOK || w.Body.String() != manifest {
+		t.Fatalf("Expected 200 for modified manifest, got %d", w.Code)
 	}
 }
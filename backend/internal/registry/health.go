@@ -0,0 +1,266 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// breakerFailureThreshold 连续失败多少次后打开断路器
+	breakerFailureThreshold = 5
+	// breakerCooldown 断路器打开后等待多久放行试探请求
+	breakerCooldown = 30 * time.Second
+	// healthProbeTimeout 单次健康探测的超时时间
+	healthProbeTimeout = 10 * time.Second
+)
+
+// 断路器状态
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// HealthStatus 上游的健康状态和断路器状态
+type HealthStatus struct {
+	Upstream            string     `json:"upstream"`
+	State               string     `json:"state"`               // closed、open 或 half-open
+	ConsecutiveFailures int        `json:"consecutiveFailures"` // 连续失败次数，成功一次后清零
+	Failures            int64      `json:"failures"`            // 累计失败次数
+	LastError           string     `json:"lastError,omitempty"`
+	LastFailure         *time.Time `json:"lastFailure,omitempty"`
+	LastProbe           *time.Time `json:"lastProbe,omitempty"` // 最近一次 /v2/ 探测的时间
+	ProbeLatencyMs      int64      `json:"probeLatencyMs,omitempty"`
+	RetryAt             *time.Time `json:"retryAt,omitempty"` // 断路器打开时，放行试探请求的时间
+}
+
+// errCircuitOpen 断路器打开时不再请求上游
+type errCircuitOpen struct {
+	upstream string
+}
+
+func (e errCircuitOpen) Error() string {
+	return fmt.Sprintf("upstream %s is unavailable (circuit open)", e.upstream)
+}
+
+// healthTracker 按上游主机记录健康状态，同一上游的多个代理配置共用一个断路器
+type healthTracker struct {
+	mu        sync.Mutex
+	upstreams map[string]*upstreamHealth
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{upstreams: make(map[string]*upstreamHealth)}
+}
+
+// get 返回上游的健康状态，不存在时创建
+func (t *healthTracker) get(host string) *upstreamHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.upstreams[host]
+	if !ok {
+		h = &upstreamHealth{status: HealthStatus{Upstream: host}}
+		t.upstreams[host] = h
+	}
+	return h
+}
+
+// Statuses 返回所有上游的健康状态，按主机名排序
+func (t *healthTracker) Statuses() []HealthStatus {
+	t.mu.Lock()
+	upstreams := make([]*upstreamHealth, 0, len(t.upstreams))
+	for _, h := range t.upstreams {
+		upstreams = append(upstreams, h)
+	}
+	t.mu.Unlock()
+
+	statuses := make([]HealthStatus, 0, len(upstreams))
+	for _, h := range upstreams {
+		statuses = append(statuses, h.snapshot())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Upstream < statuses[j].Upstream })
+	return statuses
+}
+
+// upstreamHealth 单个上游的断路器
+// 连续失败 breakerFailureThreshold 次后打开，冷却 breakerCooldown 后半开并放行一个试探请求，
+// 试探请求或健康探测成功后关闭，试探失败则重新打开
+type upstreamHealth struct {
+	mu        sync.Mutex
+	status    HealthStatus
+	openUntil time.Time // 为零时断路器关闭
+	trial     bool      // 半开状态下已放行试探请求
+}
+
+func (h *upstreamHealth) snapshot() HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := h.status
+	status.State = h.stateLocked(time.Now())
+	if !h.openUntil.IsZero() {
+		retryAt := h.openUntil
+		status.RetryAt = &retryAt
+	}
+	return status
+}
+
+func (h *upstreamHealth) stateLocked(now time.Time) string {
+	switch {
+	case h.openUntil.IsZero():
+		return BreakerClosed
+	case now.Before(h.openUntil):
+		return BreakerOpen
+	default:
+		return BreakerHalfOpen
+	}
+}
+
+// allow 断路器是否允许请求发往该上游
+func (h *upstreamHealth) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch h.stateLocked(time.Now()) {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if h.trial {
+			return false
+		}
+		h.trial = true
+		return true
+	default:
+		return false
+	}
+}
+
+// success 记录一次成功，关闭断路器
+func (h *upstreamHealth) success() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.openUntil.IsZero() {
+		log.Printf("Circuit closed for upstream %s", h.status.Upstream)
+	}
+	h.status.ConsecutiveFailures = 0
+	h.openUntil = time.Time{}
+	h.trial = false
+}
+
+// failure 记录一次失败，达到阈值或试探请求失败时打开断路器
+func (h *upstreamHealth) failure(err error) {
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.ConsecutiveFailures++
+	h.status.Failures++
+	h.status.LastError = err.Error()
+	h.status.LastFailure = &now
+	if h.trial || (h.openUntil.IsZero() && h.status.ConsecutiveFailures >= breakerFailureThreshold) {
+		log.Printf("Circuit opened for upstream %s after %d failures: %v", h.status.Upstream, h.status.ConsecutiveFailures, err)
+		h.openUntil = now.Add(breakerCooldown)
+	}
+	h.trial = false
+}
+
+// abandon 试探请求被客户端取消，没有结果，允许下一个请求试探
+func (h *upstreamHealth) abandon() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.trial = false
+}
+
+// probed 记录一次健康探测的结果
+func (h *upstreamHealth) probed(latency time.Duration, err error) {
+	now := time.Now()
+	h.mu.Lock()
+	h.status.LastProbe = &now
+	h.status.ProbeLatencyMs = latency.Milliseconds()
+	h.mu.Unlock()
+	if err != nil {
+		h.failure(err)
+		return
+	}
+	h.success()
+}
+
+// runHealthChecks 定期探测所有配置的上游，直到 ctx 取消
+func (rm *Manager) runHealthChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		rm.probeUpstreams(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeUpstreams 对每个上游 (包括备用镜像) 发送 GET /v2/，返回 200 或 401 视为健康
+func (rm *Manager) probeUpstreams(ctx context.Context) {
+	configs, err := rm.store.List()
+	if err != nil {
+		log.Printf("Failed to list configs for health checks: %v", err)
+		return
+	}
+	probed := make(map[string]bool)
+	var wg sync.WaitGroup
+	for _, summary := range configs {
+		cfg, ok := rm.GetConfig(summary.HostName)
+		if !ok {
+			continue
+		}
+		tlsConfig, err := newUpstreamTLSConfig(cfg.TLS)
+		if err != nil {
+			continue
+		}
+		client := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment, DisableKeepAlives: true},
+			Timeout:   healthProbeTimeout,
+		}
+		for _, raw := range cfg.Upstreams() {
+			u, err := url.Parse(raw)
+			if err != nil || u.Host == "" || probed[u.Host] {
+				continue
+			}
+			probed[u.Host] = true
+			u.User = nil
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/v2/"
+			wg.Add(1)
+			go func(target string, h *upstreamHealth) {
+				defer wg.Done()
+				latency, err := probeUpstream(ctx, client, target)
+				// 关闭时被取消的探测不计入结果
+				if ctx.Err() == nil {
+					h.probed(latency, err)
+				}
+			}(u.String(), rm.upstreams.health.get(u.Host))
+		}
+	}
+	wg.Wait()
+}
+
+func probeUpstream(ctx context.Context, client *http.Client, target string) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		return latency, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		return latency, fmt.Errorf("health probe returned %d", resp.StatusCode)
+	}
+	return latency, nil
+}
@@ -0,0 +1,90 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	var requests atomic.Int32
+	failing.Store(true)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+
+	trackers := newUpstreamTrackers()
+	handler, err := newRegistryProxyHandler(config.Config{HostName: "registry.test", RemoteURL: upstream.URL}, nil, trackers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/library/app/manifests/latest", nil))
+		return w.Code
+	}
+
+	for i := 0; i < breakerFailureThreshold; i++ {
+		if code := get(); code != http.StatusServiceUnavailable {
+			t.Fatalf("expected upstream 503, got %d", code)
+		}
+	}
+	// 断路器打开后不再请求上游
+	if code := get(); code != http.StatusBadGateway {
+		t.Fatalf("expected 502 while circuit is open, got %d", code)
+	}
+	if requests.Load() != breakerFailureThreshold {
+		t.Fatalf("expected %d upstream requests, got %d", breakerFailureThreshold, requests.Load())
+	}
+	u, _ := url.Parse(upstream.URL)
+	if statuses := trackers.health.Statuses(); len(statuses) != 1 || statuses[0].State != BreakerOpen {
+		t.Fatalf("unexpected health status %+v", statuses)
+	}
+
+	// 健康探测成功后断路器关闭
+	failing.Store(false)
+	h := trackers.health.get(u.Host)
+	h.probed(probeUpstream(context.Background(), http.DefaultClient, upstream.URL+"/v2/"))
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("expected 200 after recovery, got %d", code)
+	}
+	if s := h.snapshot(); s.State != BreakerClosed || s.LastProbe == nil {
+		t.Fatalf("unexpected health status %+v", s)
+	}
+}
+
+func TestCircuitBreakerFailsOverToMirror(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("primary should be skipped while its circuit is open")
+	}))
+	defer primary.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer mirror.Close()
+
+	trackers := newUpstreamTrackers()
+	u, _ := url.Parse(primary.URL)
+	h := trackers.health.get(u.Host)
+	for i := 0; i < breakerFailureThreshold; i++ {
+		h.failure(errCircuitOpen{upstream: u.Host})
+	}
+
+	handler, err := newRegistryProxyHandler(config.Config{HostName: "registry.test", RemoteURL: primary.URL, Mirrors: []string{mirror.URL}}, nil, trackers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/library/app/manifests/latest", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected mirror response, got %d", w.Code)
+	}
+}
@@ -0,0 +1,226 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+// errManifestNotFound 要查看的清单不存在
+var errManifestNotFound = errors.New("manifest not found")
+
+// Platform 镜像的目标平台
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+	OSVersion    string `json:"osVersion,omitempty"`
+}
+
+// LayerInfo 镜像的一个层
+type LayerInfo struct {
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+}
+
+// PlatformManifest 单个平台的镜像清单
+type PlatformManifest struct {
+	Digest    string    `json:"digest"`
+	MediaType string    `json:"mediaType"`
+	Platform  *Platform `json:"platform,omitempty"`
+	// Size 配置和层的大小之和，即拉取该平台镜像需要下载的数据量
+	Size   int64       `json:"size"`
+	Config string      `json:"config"`
+	Layers []LayerInfo `json:"layers"`
+	// Error 子清单不存在或无法解析时的原因，此时只有 Digest、MediaType 和 Platform 有效
+	Error string `json:"error,omitempty"`
+}
+
+// ImageInspection 标签或摘要解析出的全部平台
+type ImageInspection struct {
+	Repository string `json:"repository"`
+	Reference  string `json:"reference"`
+	Digest     string `json:"digest"`
+	MediaType  string `json:"mediaType"`
+	// MultiArch 引用指向清单列表时为 true
+	MultiArch bool `json:"multiArch"`
+	// Size 所有平台去重后的配置和层的大小之和，即仓库中该标签占用的 blob 存储
+	Size      int64              `json:"size"`
+	Manifests []PlatformManifest `json:"manifests"`
+}
+
+// inspectedManifest 查看关心的清单字段，同时兼容镜像清单和清单列表
+type inspectedManifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+		Size   int64  `json:"size"`
+	} `json:"config"`
+	Layers    []LayerInfo `json:"layers"`
+	Manifests []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+		Platform  *struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+			Variant      string `json:"variant"`
+			OSVersion    string `json:"os.version"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// Inspector 把标签解析为各平台的镜像清单，前端用它展示标签支持的架构和各自的大小
+type Inspector struct {
+	store storage.Storage
+}
+
+// NewInspector 创建清单查看器
+func NewInspector(store storage.Storage) *Inspector {
+	return &Inspector{store: store}
+}
+
+// Inspect 解析 repository 中的引用 (标签或摘要)，清单列表展开为各平台的子清单，
+// 单个镜像清单的平台从镜像配置中读取
+func (i *Inspector) Inspect(repository, reference string) (*ImageInspection, error) {
+	data, digest, err := i.store.GetManifest(repository, reference)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s:%s", errManifestNotFound, repository, reference)
+	}
+	var manifest inspectedManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s:%s: %v", repository, reference, err)
+	}
+
+	mediaType := detectManifestMediaType(data)
+	result := &ImageInspection{
+		Repository: repository,
+		Reference:  reference,
+		Digest:     digest,
+		MediaType:  mediaType,
+		MultiArch:  mediaType == MediaTypeManifestList || mediaType == MediaTypeOCIManifestIndex,
+		Manifests:  []PlatformManifest{},
+	}
+
+	if !result.MultiArch {
+		child := platformManifest(digest, mediaType, manifest)
+		child.Platform = i.configPlatform(repository, manifest.Config.Digest)
+		result.Manifests = append(result.Manifests, child)
+	} else {
+		for _, descriptor := range manifest.Manifests {
+			child := PlatformManifest{Digest: descriptor.Digest, MediaType: descriptor.MediaType, Layers: []LayerInfo{}}
+			if p := descriptor.Platform; p != nil {
+				child.Platform = &Platform{OS: p.OS, Architecture: p.Architecture, Variant: p.Variant, OSVersion: p.OSVersion}
+			}
+			childData, _, err := i.store.GetManifestByDigest(repository, descriptor.Digest)
+			if err != nil {
+				child.Error = "manifest not found"
+				result.Manifests = append(result.Manifests, child)
+				continue
+			}
+			var parsed inspectedManifest
+			if err := json.Unmarshal(childData, &parsed); err != nil {
+				child.Error = fmt.Sprintf("invalid manifest: %v", err)
+				result.Manifests = append(result.Manifests, child)
+				continue
+			}
+			platform := child.Platform
+			child = platformManifest(descriptor.Digest, detectManifestMediaType(childData), parsed)
+			child.Platform = platform
+			result.Manifests = append(result.Manifests, child)
+		}
+	}
+
+	// 多个平台共享的层只计算一次
+	seen := make(map[string]bool)
+	for _, child := range result.Manifests {
+		if child.Config != "" && !seen[child.Config] {
+			seen[child.Config] = true
+			result.Size += child.Size - sumLayerSizes(child.Layers)
+		}
+		for _, layer := range child.Layers {
+			if !seen[layer.Digest] {
+				seen[layer.Digest] = true
+				result.Size += layer.Size
+			}
+		}
+	}
+	return result, nil
+}
+
+// platformManifest 按镜像清单中声明的大小汇总
+func platformManifest(digest, mediaType string, manifest inspectedManifest) PlatformManifest {
+	layers := manifest.Layers
+	if layers == nil {
+		layers = []LayerInfo{}
+	}
+	return PlatformManifest{
+		Digest:    digest,
+		MediaType: mediaType,
+		Size:      manifest.Config.Size + sumLayerSizes(layers),
+		Config:    manifest.Config.Digest,
+		Layers:    layers,
+	}
+}
+
+// configPlatform 从镜像配置读取平台，读取失败时返回 nil
+func (i *Inspector) configPlatform(repository, digest string) *Platform {
+	if digest == "" {
+		return nil
+	}
+	blob, _, err := i.store.GetBlob(repository, digest)
+	if err != nil {
+		return nil
+	}
+	defer blob.Close()
+	var config struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+		OSVersion    string `json:"os.version"`
+	}
+	if err := json.NewDecoder(io.LimitReader(blob, 4<<20)).Decode(&config); err != nil || config.Architecture == "" {
+		return nil
+	}
+	return &Platform{OS: config.OS, Architecture: config.Architecture, Variant: config.Variant, OSVersion: config.OSVersion}
+}
+
+func sumLayerSizes(layers []LayerInfo) int64 {
+	var total int64
+	for _, layer := range layers {
+		total += layer.Size
+	}
+	return total
+}
+
+// ServeHTTP 实现管理接口：GET ?repository=<name>&reference=<tag 或 digest>，reference 默认为 latest
+func (i *Inspector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	repository, reference := r.URL.Query().Get("repository"), r.URL.Query().Get("reference")
+	if !repositoryNamePattern.MatchString(repository) {
+		http.Error(w, "invalid repository", http.StatusBadRequest)
+		return
+	}
+	if reference == "" {
+		reference = "latest"
+	}
+
+	result, err := i.Inspect(repository, reference)
+	if errors.Is(err, errManifestNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
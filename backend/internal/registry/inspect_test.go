@@ -0,0 +1,63 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+func TestInspector(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	image := func(arch, layer string) string {
+		config := fmt.Sprintf(`{"os":"linux","architecture":%q}`, arch)
+		store.PutBlob("app", digestOf(config), strings.NewReader(config))
+		manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"digest":%q,"size":%d},"layers":[{"digest":"sha256:shared","size":100},{"digest":%q,"size":10}]}`,
+			MediaTypeOCIManifestV1, digestOf(config), len(config), layer)
+		store.PutManifest("app", digestOf(manifest), digestOf(manifest), []byte(manifest))
+		return manifest
+	}
+	amd64, arm64 := image("amd64", "sha256:amd64"), image("arm64", "sha256:arm64")
+	store.PutManifest("app", "single", digestOf(amd64), []byte(amd64))
+	index := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"manifests":[{"digest":%q,"platform":{"os":"linux","architecture":"amd64"}},{"digest":%q,"platform":{"os":"linux","architecture":"arm64","variant":"v8"}},{"digest":"sha256:missing","platform":{"os":"windows","architecture":"amd64"}}]}`,
+		MediaTypeOCIManifestIndex, digestOf(amd64), digestOf(arm64))
+	store.PutManifest("app", "latest", digestOf(index), []byte(index))
+
+	inspect := func(query string) (*ImageInspection, int) {
+		w := httptest.NewRecorder()
+		NewInspector(store).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/inspect?"+query, nil))
+		var result ImageInspection
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return &result, w.Code
+	}
+
+	result, code := inspect("repository=app")
+	if code != http.StatusOK || !result.MultiArch || len(result.Manifests) != 3 {
+		t.Fatalf("Unexpected inspection %d %+v", code, result)
+	}
+	arm := result.Manifests[1]
+	if arm.Platform == nil || arm.Platform.Variant != "v8" || len(arm.Layers) != 2 || arm.Size != 110+int64(len(`{"os":"linux","architecture":"arm64"}`)) {
+		t.Fatalf("Unexpected arm64 manifest %+v", arm)
+	}
+	if result.Manifests[2].Error == "" {
+		t.Fatalf("Expected missing child manifest to be reported, got %+v", result.Manifests[2])
+	}
+	// 共享的层只计算一次
+	if want := result.Manifests[0].Size + arm.Size - 100; result.Size != want {
+		t.Fatalf("Expected deduplicated size %d, got %d", want, result.Size)
+	}
+
+	// 单平台镜像的平台从镜像配置读取
+	result, code = inspect("repository=app&reference=single")
+	if code != http.StatusOK || result.MultiArch || len(result.Manifests) != 1 || result.Manifests[0].Platform == nil || result.Manifests[0].Platform.Architecture != "amd64" {
+		t.Fatalf("Unexpected single-platform inspection %d %+v", code, result)
+	}
+
+	if _, code := inspect("repository=app&reference=unknown"); code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for unknown tag, got %d", code)
+	}
+}
@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errCodeManifestBlobUnknown 清单引用的 blob 或子清单不存在
+const errCodeManifestBlobUnknown = "MANIFEST_BLOB_UNKNOWN"
+
+// ReferenceCheck 推送清单时对引用内容的检查级别
+type ReferenceCheck string
+
+const (
+	// ReferenceCheckOff 不检查引用，允许推送引用不存在内容的清单
+	ReferenceCheckOff ReferenceCheck = "off"
+	// ReferenceCheckStrict 配置、层和清单列表的子清单必须已存在于仓库中
+	ReferenceCheckStrict ReferenceCheck = "strict"
+	// ReferenceCheckMount 在 strict 的基础上，仓库中缺少的 blob 从客户端可以拉取的其他仓库自动挂载
+	ReferenceCheckMount ReferenceCheck = "mount"
+)
+
+// ParseReferenceCheck 解析检查级别，空字符串按 off 处理
+func ParseReferenceCheck(value string) (ReferenceCheck, error) {
+	switch check := ReferenceCheck(value); check {
+	case "":
+		return ReferenceCheckOff, nil
+	case ReferenceCheckOff, ReferenceCheckStrict, ReferenceCheckMount:
+		return check, nil
+	default:
+		return "", fmt.Errorf("invalid reference check %q", value)
+	}
+}
+
+// referencedManifest 引用检查关心的清单字段，同时兼容镜像清单和清单列表
+type referencedManifest struct {
+	Config *struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Layers []struct {
+		MediaType string   `json:"mediaType"`
+		Digest    string   `json:"digest"`
+		URLs      []string `json:"urls"`
+	} `json:"layers"`
+	Manifests []struct {
+		Digest string `json:"digest"`
+	} `json:"manifests"`
+}
+
+// checkManifestReferences 按检查级别确认清单引用的内容都已存在，返回第一个缺少的摘要。
+// subject 指向的清单可以晚于引用者推送，不检查；带 urls 的外部层 (Windows 基础镜像) 不需要上传，也不检查
+func (h *Handler) checkManifestReferences(c *gin.Context, repository string, data []byte) (string, error) {
+	if h.referenceCheck == "" || h.referenceCheck == ReferenceCheckOff {
+		return "", nil
+	}
+
+	var manifest referencedManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	for _, child := range manifest.Manifests {
+		if _, _, err := h.storage.GetManifestByDigest(repository, child.Digest); err != nil {
+			return child.Digest, nil
+		}
+	}
+
+	blobs := make([]string, 0, len(manifest.Layers)+1)
+	if manifest.Config != nil && manifest.Config.Digest != "" {
+		blobs = append(blobs, manifest.Config.Digest)
+	}
+	for _, layer := range manifest.Layers {
+		if len(layer.URLs) > 0 || strings.Contains(layer.MediaType, "foreign") {
+			continue
+		}
+		blobs = append(blobs, layer.Digest)
+	}
+
+	var sources []string
+	for _, digest := range blobs {
+		if _, err := h.storage.GetBlobSize(repository, digest); err == nil {
+			continue
+		}
+		if h.referenceCheck != ReferenceCheckMount || !sha256DigestPattern.MatchString(digest) {
+			return digest, nil
+		}
+		if sources == nil {
+			repositories, err := h.storage.ListRepositories()
+			if err != nil {
+				return "", fmt.Errorf("failed to list repositories: %v", err)
+			}
+			sources = h.visibleRepositories(c, repositories)
+		}
+		if !h.mountFromAny(repository, sources, digest) {
+			return digest, nil
+		}
+	}
+	return "", nil
+}
+
+// mountFromAny 从第一个包含该 blob 的仓库挂载，挂载同样计入配额
+func (h *Handler) mountFromAny(repository string, sources []string, digest string) bool {
+	for _, from := range sources {
+		if from == repository {
+			continue
+		}
+		if _, err := h.storage.GetBlobSize(from, digest); err != nil {
+			continue
+		}
+		if err := h.mountBlob(repository, from, digest); err != nil {
+			log.Printf("Failed to mount blob %s from %s to %s: %v", digest, from, repository, err)
+			continue
+		}
+		return true
+	}
+	return false
+}
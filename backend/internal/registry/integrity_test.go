@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+func TestManifestReferenceCheck(t *testing.T) {
+	config, layer := `{"architecture":"amd64"}`, "layer"
+	image := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"digest":%q},"layers":[{"digest":%q},{"mediaType":"application/vnd.docker.image.rootfs.foreign.diff.tar.gzip","digest":"sha256:foreign","urls":["https://example.com/layer"]}]}`,
+		MediaTypeManifestV2, digestOf(config), digestOf(layer))
+	index := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"manifests":[{"digest":%q}]}`, MediaTypeOCIManifestIndex, digestOf(image))
+
+	for _, tc := range []struct {
+		check  ReferenceCheck
+		status int
+	}{
+		{ReferenceCheckOff, http.StatusCreated},
+		{ReferenceCheckStrict, http.StatusBadRequest},
+		{ReferenceCheckMount, http.StatusCreated},
+	} {
+		store := storage.NewMemoryStorage()
+		router := NewRouter(NewHandlerWithOptions(store, HandlerOptions{ReferenceCheck: tc.check}))
+		put := func(path, body string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, path, strings.NewReader(body)))
+			return w
+		}
+
+		// 子清单不存在时不能推送清单列表
+		if w := put("/v2/app/manifests/latest", index); tc.check != ReferenceCheckOff && w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected index with unknown child to be rejected, got %d", tc.check, w.Code)
+		}
+
+		// 配置在仓库中，层只在其他仓库中，外部层不需要上传
+		store.PutBlob("app", digestOf(config), strings.NewReader(config))
+		store.PutBlob("base", digestOf(layer), strings.NewReader(layer))
+		w := put("/v2/app/manifests/v1", image)
+		if w.Code != tc.status {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.check, tc.status, w.Code, w.Body.String())
+		}
+		if tc.status == http.StatusBadRequest && !strings.Contains(w.Body.String(), errCodeManifestBlobUnknown) {
+			t.Fatalf("%s: expected %s, got %s", tc.check, errCodeManifestBlobUnknown, w.Body.String())
+		}
+		if _, err := store.GetBlobSize("app", digestOf(layer)); (err == nil) != (tc.check == ReferenceCheckMount) {
+			t.Fatalf("%s: unexpected layer mount state: %v", tc.check, err)
+		}
+
+		if tc.status == http.StatusCreated {
+			if w := put("/v2/app/manifests/latest", index); w.Code != http.StatusCreated {
+				t.Fatalf("%s: expected index to be accepted, got %d", tc.check, w.Code)
+			}
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package registry
 
 import (
-	"crypto/tls"
-	"io"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
@@ -13,28 +14,77 @@ import (
 
 	"github.com/smartcat999/container-ui/internal/config"
 	proxytransprt "github.com/smartcat999/container-ui/internal/proxy"
+	"github.com/smartcat999/container-ui/internal/ratelimit"
+	"github.com/smartcat999/container-ui/internal/storage"
 )
 
+// ErrReloadNotSupported 配置存储不支持重新加载，例如内存存储
+var ErrReloadNotSupported = errors.New("config store does not support reload")
+
 // Manager 管理镜像仓库配置
 type Manager struct {
 	store config.ConfigStore
+	// 拉取缓存的存储，为 nil 时所有请求直接转发到上游
+	cache storage.Storage
+	// 各上游的限流和健康状态
+	upstreams *upstreamTrackers
+	// 停止后台健康检查
+	stopHealthChecks context.CancelFunc
+	// 全局和每个客户端 IP 的响应带宽限制，为 nil 时不限制
+	bandwidth       *ratelimit.Bandwidth
+	clientBandwidth *ratelimit.BandwidthLimiter
 	// 添加代理处理器缓存，避免重复创建
 	proxyHandlers sync.Map
 }
 
+// ManagerOptions 仓库管理器选项
+type ManagerOptions struct {
+	// Cache 拉取缓存的存储，设置后清单和 blob 按摘要缓存在本地
+	Cache storage.Storage
+	// Bandwidth 所有响应的总带宽上限，单位字节每秒，0 表示不限制
+	Bandwidth int64
+	// ClientBandwidth 每个客户端 IP 的带宽上限，同一客户端的多个并发拉取共享，0 表示不限制
+	ClientBandwidth int64
+	// HealthCheckInterval 定期探测上游 /v2/ 的间隔，0 表示不探测，断路器仍按实际请求的结果工作
+	HealthCheckInterval time.Duration
+}
+
 // NewManager 创建一个新的仓库管理器
 func NewManager(store config.ConfigStore) *Manager {
+	return NewManagerWithOptions(store, ManagerOptions{})
+}
+
+// NewManagerWithOptions 使用选项创建仓库管理器
+func NewManagerWithOptions(store config.ConfigStore, opts ManagerOptions) *Manager {
 	rm := &Manager{
-		store: store,
+		store:     store,
+		cache:     opts.Cache,
+		upstreams: newUpstreamTrackers(),
+
+		bandwidth:       ratelimit.NewBandwidth(opts.Bandwidth),
+		clientBandwidth: ratelimit.NewBandwidthLimiter(opts.ClientBandwidth),
 	}
 
 	// 加载默认配置
 	rm.loadDefaultConfigs()
 
+	// 配置被其他进程修改 (例如其他副本写入 etcd) 或配置文件重新加载时清除对应的代理处理器
+	if watchable, ok := store.(config.Watchable); ok {
+		watchable.OnChange(func(hostName string) {
+			rm.proxyHandlers.Delete(hostName)
+		})
+	}
+
+	if opts.HealthCheckInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		rm.stopHealthChecks = cancel
+		go rm.runHealthChecks(ctx, opts.HealthCheckInterval)
+	}
+
 	return rm
 }
 
-// loadDefaultConfigs 加载默认的仓库配置
+// loadDefaultConfigs 加载默认的仓库配置，存储中已有的配置 (例如其他副本保存在 etcd 中的) 不覆盖
 func (rm *Manager) loadDefaultConfigs() {
 	defaultConfigs := []config.Config{
 		//{HostName: "localhost", RemoteURL: "https://localhost:7443"},
@@ -55,6 +105,9 @@ func (rm *Manager) loadDefaultConfigs() {
 	}
 
 	for _, config := range defaultConfigs {
+		if _, exists := rm.GetConfig(config.HostName); exists {
+			continue
+		}
 		if err := rm.AddConfig(config); err != nil {
 			log.Printf("Warning: Failed to add default config for %s: %v", config.HostName, err)
 		}
@@ -96,8 +149,49 @@ func (rm *Manager) GetDefaultConfig() config.Config {
 	}
 }
 
-// AddConfig 添加或更新配置
+// ValidateConfig 校验配置的全部字段，包括改写规则和 TLS 设置，不修改存储；
+// 校验失败时返回 *config.ValidationError
+func ValidateConfig(cfg config.Config) error {
+	verr := &config.ValidationError{HostName: cfg.HostName}
+	if err := cfg.Validate(); err != nil && !errors.As(err, &verr) {
+		return err
+	}
+	if _, err := newRepositoryRewriter(cfg.Rewrites); err != nil {
+		verr.Add("rewrites", "", err.Error())
+	}
+	if _, err := newUpstreamTLSConfig(cfg.TLS); err != nil {
+		verr.Add("tls", "", err.Error())
+	}
+	if len(verr.Errors) == 0 {
+		return nil
+	}
+	return verr
+}
+
+// ValidateConfigs 校验一组配置 (例如整个配置文件)，包括主机名是否重复以及凭据能否解密、引用能否解析，返回全部错误
+func ValidateConfigs(configs []config.Config) error {
+	var errs []error
+	seen := make(map[string]int)
+	for i, cfg := range configs {
+		if err := ValidateConfig(cfg); err != nil {
+			errs = append(errs, err)
+		} else if _, _, err := cfg.Credentials(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid registry config %q: cannot resolve credentials: %v", cfg.HostName, err))
+		}
+		if first, ok := seen[cfg.HostName]; ok {
+			errs = append(errs, fmt.Errorf("duplicate hostName %q in entries %d and %d, the later entry overrides the earlier one", cfg.HostName, first, i))
+		} else {
+			seen[cfg.HostName] = i
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AddConfig 校验并添加或更新配置
 func (rm *Manager) AddConfig(config config.Config) error {
+	if err := ValidateConfig(config); err != nil {
+		return err
+	}
 	if err := rm.store.Add(config); err != nil {
 		return err
 	}
@@ -125,13 +219,42 @@ func (rm *Manager) RemoveConfig(hostName string) (bool, error) {
 	return removed, nil
 }
 
+// ReloadConfigs 重新读取配置存储 (例如被手动修改的配置文件)，返回发生变化的主机名，
+// 对应的代理处理器通过 OnChange 清除；存储不支持时返回 ErrReloadNotSupported
+func (rm *Manager) ReloadConfigs() ([]string, error) {
+	reloadable, ok := rm.store.(config.Reloadable)
+	if !ok {
+		return nil, ErrReloadNotSupported
+	}
+	changed, err := reloadable.Reload()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Registry configs reloaded, changed: %v", changed)
+	return changed, nil
+}
+
 // ListConfigs 列出所有配置
 func (rm *Manager) ListConfigs() ([]config.Config, error) {
 	return rm.store.List()
 }
 
+// RateLimits 返回各上游最近一次报告的限流状态和退避统计
+func (rm *Manager) RateLimits() []RateLimitStatus {
+	return rm.upstreams.rateLimits.Statuses()
+}
+
+// Health 返回各上游的健康探测结果和断路器状态
+func (rm *Manager) Health() []HealthStatus {
+	return rm.upstreams.health.Statuses()
+}
+
 // Close 关闭管理器
 func (rm *Manager) Close() error {
+	if rm.stopHealthChecks != nil {
+		rm.stopHealthChecks()
+	}
+	rm.clientBandwidth.Close()
 	return rm.store.Close()
 }
 
@@ -143,28 +266,40 @@ func (rm *Manager) GetProxyHandler(config config.Config) (http.Handler, error) {
 	}
 
 	// 创建新的代理处理器
-	handler, err := NewRegistryProxyHandler(config)
+	handler, err := newRegistryProxyHandler(config, rm.cache, rm.upstreams)
 	if err != nil {
 		return nil, err
 	}
 
 	// 存入缓存
+	handler = rm.throttle(handler, config.BandwidthLimit)
 	rm.proxyHandlers.Store(config.HostName, handler)
 	return handler, nil
 }
 
 // NewRegistryProxyHandler 创建新的镜像仓库代理处理器
 func NewRegistryProxyHandler(config config.Config) (http.Handler, error) {
+	return newRegistryProxyHandler(config, nil, newUpstreamTrackers())
+}
+
+// newRegistryProxyHandler 创建代理处理器，cache 不为 nil 时在代理之前加上拉取缓存
+func newRegistryProxyHandler(config config.Config, cache storage.Storage, trackers *upstreamTrackers) (http.Handler, error) {
 	remoteURL, err := url.Parse(config.RemoteURL)
 	if err != nil {
 		return nil, err
 	}
+	rewriter, err := newRepositoryRewriter(config.Rewrites)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := newUpstreamTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
 
 	proxy := httputil.NewSingleHostReverseProxy(remoteURL)
 	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
+		TLSClientConfig: tlsConfig,
 		DialContext: (&net.Dialer{
 			Timeout:   5 * time.Minute,
 			KeepAlive: 30 * time.Minute,
@@ -177,24 +312,31 @@ func NewRegistryProxyHandler(config config.Config) (http.Handler, error) {
 		MaxIdleConnsPerHost:   20,
 		DisableCompression:    false,
 	}
-	proxy.Transport = proxytransprt.NewRedirectFollowingTransport(transport, 5)
+	// 依次尝试主上游和备用镜像
+	maxRedirects := config.MaxRedirects
+	switch {
+	case maxRedirects == 0:
+		maxRedirects = proxytransprt.DefaultMaxRedirects
+	case maxRedirects < 0:
+		maxRedirects = 0
+	}
+	mirrors, err := newMirrorTransport(config, proxytransprt.NewRedirectFollowingTransport(transport, maxRedirects), trackers)
+	if err != nil {
+		return nil, err
+	}
+	proxy.Transport = mirrors
 
-	// 自定义Director函数，添加认证信息
+	// 自定义Director函数
 	originalDirector := proxy.Director
 	proxy.Director = func(req *http.Request) {
+		// 按规则把请求的仓库映射到上游的仓库
+		req.URL.Path = rewriter.rewritePath(req.URL.Path)
+		req.URL.RawPath = ""
 		originalDirector(req)
 
 		// 设置Host头
 		req.Host = remoteURL.Host
 
-		// 如果配置了认证信息，添加到请求中
-		if config.Username != "" && config.Password != "" {
-			// 保留客户端原始认证信息
-			if _, _, ok := req.BasicAuth(); !ok {
-				req.SetBasicAuth(config.Username, config.Password)
-			}
-		}
-
 		// 添加调试日志
 		log.Printf("Proxying request: %s %s -> %s %s %s",
 			req.Method, req.URL.Path, remoteURL.String(), req.Header.Get("Content-Type"), req.Header.Get("Content-Length"))
@@ -212,16 +354,10 @@ func NewRegistryProxyHandler(config config.Config) (http.Handler, error) {
 		log.Printf("Received response: %d for %s %s %s %s %s", resp.StatusCode, resp.Request.Method, resp.Request.URL.Path,
 			resp.Header.Get("Content-Type"), resp.Header.Get("Range"), resp.Header.Get("Content-Length"))
 
-		// 对于大型响应，使用自定义的响应复制器
-		if resp.ContentLength > 0 && resp.StatusCode >= http.StatusCreated && http.StatusIMUsed >= resp.StatusCode {
+		// 大型响应逐块透传，结束时记录传输量
+		if resp.ContentLength > 0 && resp.StatusCode >= http.StatusOK && http.StatusIMUsed >= resp.StatusCode {
 			log.Printf("处理响应: %.2f MB", float64(resp.ContentLength)/(1024*1024))
-			// 创建一个新的响应体读取器
-			originalBody := resp.Body
-			resp.Body = &bufferedReadCloser{
-				reader: originalBody,
-				closer: originalBody,
-				size:   resp.ContentLength,
-			}
+			resp.Body = &transferLogger{ReadCloser: resp.Body, path: resp.Request.URL.Path, size: resp.ContentLength}
 		}
 
 		// 保持原始的 Content-Length 和 Range 头
@@ -237,34 +373,12 @@ func NewRegistryProxyHandler(config config.Config) (http.Handler, error) {
 
 	// 自定义 FlushInterval 设置
 	proxy.FlushInterval = 100 * time.Millisecond
+	// 复用复制响应体的缓冲区
+	proxy.BufferPool = streamBuffers
 
-	return proxy, nil
-}
-
-// bufferedReadCloser 带缓冲的读取器，用于处理大型响应
-type bufferedReadCloser struct {
-	reader io.Reader
-	closer io.Closer
-	size   int64
-}
-
-func (b *bufferedReadCloser) Read(p []byte) (n int, err error) {
-	// 使用更大的缓冲区
-	buf := make([]byte, 32*1024) // 32KB 缓冲区
-	n, err = b.reader.Read(buf)
-	if err != nil {
-		if err == io.EOF {
-			log.Printf("读取完成，总大小: %.2f MB", float64(b.size)/(1024*1024))
-		} else {
-			log.Printf("读取错误: %v", err)
-		}
-		return 0, err
+	var handler http.Handler = proxy
+	if cache != nil {
+		handler = newPullThroughCache(remoteURL, proxy.Transport, rewriter, cache, proxy)
 	}
-	// 复制数据到目标缓冲区
-	copy(p, buf[:n])
-	return n, nil
-}
-
-func (b *bufferedReadCloser) Close() error {
-	return b.closer.Close()
+	return newPushGuard(config.AllowPush, remoteURL, rewriter, handler), nil
 }
@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"net"
+	"strings"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+// CatchAllHost 兜底规则的主机名，匹配所有没有其他规则命中的主机
+const CatchAllHost = "*"
+
+// hostPattern 解析后的主机名规则，支持精确主机名、*.gcr.io 形式的通配符、10.0.0.0/8 形式的 CIDR 和兜底规则 *
+type hostPattern struct {
+	exact    string
+	suffix   string // *.gcr.io 解析为 .gcr.io，只匹配子域名
+	network  *net.IPNet
+	catchAll bool
+}
+
+func parseHostPattern(pattern string) hostPattern {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	switch {
+	case pattern == CatchAllHost:
+		return hostPattern{catchAll: true}
+	case strings.HasPrefix(pattern, "*."):
+		return hostPattern{suffix: strings.TrimSuffix(pattern[1:], ".")}
+	}
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		return hostPattern{network: network}
+	}
+	return hostPattern{exact: normalizeHost(pattern)}
+}
+
+// match 判断规范化后的主机名是否命中规则
+func (p hostPattern) match(host string) bool {
+	switch {
+	case p.catchAll:
+		return true
+	case p.suffix != "":
+		return strings.HasSuffix(host, p.suffix)
+	case p.network != nil:
+		ip := net.ParseIP(host)
+		return ip != nil && p.network.Contains(ip)
+	default:
+		return host == p.exact
+	}
+}
+
+// specificity 规则的具体程度，优先级相同时数值大的规则优先
+func (p hostPattern) specificity() int {
+	switch {
+	case p.catchAll:
+		return -1
+	case p.suffix != "":
+		return len(p.suffix)
+	case p.network != nil:
+		ones, _ := p.network.Mask.Size()
+		return ones
+	default:
+		// 精确主机名 (例如带端口的 registry.local:5000) 比任何通配符都具体
+		return 1 << 16
+	}
+}
+
+// normalizeHost 去掉端口、IPv6 的方括号和末尾的点，并转为小写
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return strings.TrimSuffix(host, ".")
+}
+
+// MatchConfig 按请求的主机名查找配置，忽略端口和大小写
+// 精确匹配的配置优先，其次按 Priority 从高到低、规则从具体到宽泛依次尝试通配符、CIDR 和兜底规则
+func (rm *Manager) MatchConfig(host string) (config.Config, bool) {
+	host = normalizeHost(host)
+	if cfg, ok := rm.GetConfig(host); ok {
+		return cfg, true
+	}
+
+	configs, err := rm.store.List()
+	if err != nil {
+		return config.Config{}, false
+	}
+	var (
+		best     config.Config
+		bestSpec int
+		found    bool
+	)
+	for _, cfg := range configs {
+		pattern := parseHostPattern(cfg.HostName)
+		if !pattern.match(host) {
+			continue
+		}
+		spec := pattern.specificity()
+		if !found || cfg.Priority > best.Priority || (cfg.Priority == best.Priority && spec > bestSpec) ||
+			(cfg.Priority == best.Priority && spec == bestSpec && cfg.HostName < best.HostName) {
+			best, bestSpec, found = cfg, spec, true
+		}
+	}
+	if !found {
+		return config.Config{}, false
+	}
+	// 列表中的配置不含凭据，重新获取完整配置
+	return rm.GetConfig(best.HostName)
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestMatchConfig(t *testing.T) {
+	rm := NewManager(config.NewMemoryConfigStore())
+	for _, cfg := range []config.Config{
+		{HostName: "*.gcr.io", RemoteURL: "https://mirror.gcr.io"},
+		{HostName: "*.io", RemoteURL: "https://io.example.com"},
+		{HostName: "*.pkg.dev", RemoteURL: "https://pkg.example.com", Priority: 10},
+		{HostName: "*.dev", RemoteURL: "https://dev.example.com", Priority: 20},
+		{HostName: "10.0.0.0/8", RemoteURL: "https://internal.example.com", Username: "user", Password: "secret"},
+		{HostName: "registry.local:5000", RemoteURL: "https://registry.local:5000"},
+		{HostName: CatchAllHost, RemoteURL: "https://fallback.example.com"},
+	} {
+		if err := rm.AddConfig(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		// 精确匹配优先于通配符，忽略端口和大小写
+		{"gcr.io:443", "gcr.io"},
+		{"K8S.GCR.IO", "k8s.gcr.io"},
+		// 更具体的通配符优先
+		{"us.gcr.io", "*.gcr.io"},
+		{"example.io", "*.io"},
+		// 优先级高于具体程度
+		{"us-docker.pkg.dev", "*.dev"},
+		{"10.1.2.3:5000", "10.0.0.0/8"},
+		{"[::1]:5000", CatchAllHost},
+		{"registry.local", "registry.local:5000"},
+		{"unknown.example.com", CatchAllHost},
+	}
+	for _, tt := range tests {
+		cfg, ok := rm.MatchConfig(tt.host)
+		if !ok || cfg.HostName != tt.want {
+			t.Errorf("MatchConfig(%q) = %q, %v; want %q", tt.host, cfg.HostName, ok, tt.want)
+		}
+	}
+
+	// 通过通配符匹配到的配置包含凭据
+	if cfg, _ := rm.MatchConfig("10.0.0.1"); cfg.Password != "secret" {
+		t.Errorf("expected full config with credentials, got %+v", cfg)
+	}
+
+	if _, err := rm.RemoveConfig(CatchAllHost); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, ok := rm.MatchConfig("unknown.example.com"); ok {
+		t.Errorf("expected no match without catch-all, got %q", cfg.HostName)
+	}
+}
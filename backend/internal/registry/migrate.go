@@ -0,0 +1,167 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+// MigrateOptions 迁移选项
+type MigrateOptions struct {
+	// Repositories 只迁移这些仓库，为空时迁移全部
+	Repositories []string
+}
+
+// MigrateProgress 迁移进度
+type MigrateProgress struct {
+	Repository        string `json:"repository"`
+	RepositoriesTotal int    `json:"repositoriesTotal"`
+	RepositoriesDone  int    `json:"repositoriesDone"`
+	BlobsCopied       int    `json:"blobsCopied"`
+	BlobsSkipped      int    `json:"blobsSkipped"`
+	BytesCopied       int64  `json:"bytesCopied"`
+	ManifestsCopied   int    `json:"manifestsCopied"`
+	ManifestsSkipped  int    `json:"manifestsSkipped"`
+	TagsCopied        int    `json:"tagsCopied"`
+}
+
+// Migrate 把 src 中的仓库、清单、标签和 blob 复制到 dst。
+// 目标中已存在且内容一致的 blob 和清单会被跳过，中断后重新执行即可从断点继续；
+// 复制的 blob 和清单都会校验摘要，不一致时中止，不会写入损坏的数据
+func Migrate(ctx context.Context, src, dst storage.Storage, opts MigrateOptions, progress func(MigrateProgress)) (*MigrateProgress, error) {
+	if progress == nil {
+		progress = func(MigrateProgress) {}
+	}
+
+	repositories := opts.Repositories
+	if len(repositories) == 0 {
+		var err error
+		if repositories, err = src.ListRepositories(); err != nil {
+			return nil, fmt.Errorf("failed to list repositories: %v", err)
+		}
+	}
+
+	state := &MigrateProgress{RepositoriesTotal: len(repositories)}
+	for _, repository := range repositories {
+		if err := ctx.Err(); err != nil {
+			return state, err
+		}
+		state.Repository = repository
+		progress(*state)
+		if err := migrateRepository(ctx, src, dst, repository, state, progress); err != nil {
+			return state, err
+		}
+		state.RepositoriesDone++
+		progress(*state)
+	}
+	state.Repository = ""
+	return state, nil
+}
+
+// migrateRepository 按 blob、清单、标签的顺序复制，清单写入时引用的内容已经存在
+func migrateRepository(ctx context.Context, src, dst storage.Storage, repository string, state *MigrateProgress, progress func(MigrateProgress)) error {
+	blobs, err := src.ListBlobs(repository)
+	if err != nil {
+		return fmt.Errorf("failed to list blobs of %s: %v", repository, err)
+	}
+	for _, digest := range blobs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		size, err := src.GetBlobSize(repository, digest)
+		if err != nil {
+			return fmt.Errorf("failed to get blob size %s@%s: %v", repository, digest, err)
+		}
+		if existing, err := dst.GetBlobSize(repository, digest); err == nil && existing == size {
+			state.BlobsSkipped++
+			continue
+		}
+		if err := copyBlob(src, dst, repository, digest); err != nil {
+			return err
+		}
+		state.BlobsCopied++
+		state.BytesCopied += size
+		progress(*state)
+	}
+
+	manifests, err := src.ListManifests(repository)
+	if err != nil {
+		return fmt.Errorf("failed to list manifests of %s: %v", repository, err)
+	}
+	for _, digest := range manifests {
+		data, _, err := src.GetManifestByDigest(repository, digest)
+		if err != nil {
+			return fmt.Errorf("failed to get manifest %s@%s: %v", repository, digest, err)
+		}
+		if actual := fmt.Sprintf("sha256:%x", sha256.Sum256(data)); actual != digest {
+			return fmt.Errorf("manifest %s@%s has digest %s", repository, digest, actual)
+		}
+		if existing, _, err := dst.GetManifestByDigest(repository, digest); err == nil && string(existing) == string(data) {
+			state.ManifestsSkipped++
+			continue
+		}
+		if err := dst.PutManifest(repository, digest, digest, data); err != nil {
+			return fmt.Errorf("failed to put manifest %s@%s: %v", repository, digest, err)
+		}
+		state.ManifestsCopied++
+	}
+
+	tags, err := src.ListTags(repository)
+	if err != nil {
+		return fmt.Errorf("failed to list tags of %s: %v", repository, err)
+	}
+	for _, tag := range tags {
+		data, digest, err := src.GetManifest(repository, tag)
+		if err != nil {
+			return fmt.Errorf("failed to resolve tag %s:%s: %v", repository, tag, err)
+		}
+		if _, current, err := dst.GetManifest(repository, tag); err == nil && current == digest {
+			continue
+		}
+		if err := dst.PutManifest(repository, tag, digest, data); err != nil {
+			return fmt.Errorf("failed to put tag %s:%s: %v", repository, tag, err)
+		}
+		state.TagsCopied++
+	}
+	return nil
+}
+
+// copyBlob 流式复制 blob，摘要不一致时读取返回错误，目标存储不会保存该 blob
+func copyBlob(src, dst storage.Storage, repository, digest string) error {
+	reader, _, err := src.GetBlob(repository, digest)
+	if err != nil {
+		return fmt.Errorf("failed to read blob %s@%s: %v", repository, digest, err)
+	}
+	defer reader.Close()
+	if _, err := dst.PutBlob(repository, digest, newDigestVerifier(reader, digest)); err != nil {
+		return fmt.Errorf("failed to copy blob %s@%s: %v", repository, digest, err)
+	}
+	return nil
+}
+
+// digestVerifier 读到结尾时校验摘要，不一致时返回错误而不是 io.EOF
+type digestVerifier struct {
+	r      io.Reader
+	hasher hash.Hash
+	digest string
+}
+
+func newDigestVerifier(r io.Reader, digest string) *digestVerifier {
+	return &digestVerifier{r: r, hasher: sha256.New(), digest: digest}
+}
+
+func (v *digestVerifier) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.hasher.Write(p[:n])
+	if err == io.EOF {
+		if actual := "sha256:" + hex.EncodeToString(v.hasher.Sum(nil)); actual != v.digest {
+			return n, fmt.Errorf("digest mismatch: expected %s, got %s", v.digest, actual)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+func TestMigrate(t *testing.T) {
+	src := storage.NewMemoryStorage()
+	seedGCRepository(t, src)
+	dst, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Migrate(context.Background(), src, dst, MigrateOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BlobsCopied != 5 || result.ManifestsCopied != 3 || result.TagsCopied != 1 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if data, digest, err := dst.GetManifest("app", "v1"); err != nil || digest != digestOf(string(data)) {
+		t.Fatalf("Tag was not migrated: %v", err)
+	}
+	if manifests, _ := dst.ListManifests("app"); len(manifests) != 3 {
+		t.Fatalf("Expected untagged manifests to be migrated, got %v", manifests)
+	}
+
+	// 再次执行时跳过已经复制的内容
+	result, err = Migrate(context.Background(), src, dst, MigrateOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BlobsCopied != 0 || result.BlobsSkipped != 5 || result.ManifestsSkipped != 3 || result.TagsCopied != 0 {
+		t.Fatalf("Expected second run to skip everything, got %+v", result)
+	}
+
+	// 内容与摘要不一致的 blob 不会写入目标
+	src.PutBlob("broken", digestOf("expected"), strings.NewReader("actual"))
+	if _, err := Migrate(context.Background(), src, dst, MigrateOptions{Repositories: []string{"broken"}}, nil); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Fatalf("Expected digest mismatch, got %v", err)
+	}
+	if _, err := dst.GetBlobSize("broken", digestOf("expected")); err == nil {
+		t.Fatal("Corrupted blob was written")
+	}
+}
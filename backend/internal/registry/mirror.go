@@ -0,0 +1,172 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+// UpstreamHeader 响应头，记录实际处理请求的上游主机
+const UpstreamHeader = "X-Registry-Upstream"
+
+// upstreamTrackers 按上游主机共享的限流和健康状态
+type upstreamTrackers struct {
+	rateLimits *rateLimitTracker
+	health     *healthTracker
+}
+
+func newUpstreamTrackers() *upstreamTrackers {
+	return &upstreamTrackers{rateLimits: newRateLimitTracker(), health: newHealthTracker()}
+}
+
+// mirrorUpstream 回退链中的一个上游
+type mirrorUpstream struct {
+	url       *url.URL
+	transport http.RoundTripper
+	limit     *upstreamLimit
+	health    *upstreamHealth
+}
+
+// mirrorTransport 按顺序尝试主上游和备用镜像
+// 连接失败、返回 5xx 或 429 时改用下一个上游，正处于限流退避中或断路器打开的上游直接跳过，最后一个上游的响应原样返回
+type mirrorTransport struct {
+	upstreams []*mirrorUpstream
+}
+
+// newMirrorTransport 为配置中的每个上游创建独立的认证和限流传输层
+// 配置的凭据只发送给主上游，每个请求重新解析，镜像的凭据从地址中的用户信息读取
+func newMirrorTransport(cfg config.Config, base http.RoundTripper, trackers *upstreamTrackers) (*mirrorTransport, error) {
+	rawURLs := cfg.Upstreams()
+	if _, _, err := cfg.Credentials(); err != nil {
+		return nil, err
+	}
+	t := &mirrorTransport{}
+	for i, raw := range rawURLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid upstream url %q", raw)
+		}
+		credentials := cfg.Credentials
+		if i > 0 {
+			var username, password string
+			if u.User != nil {
+				username = u.User.Username()
+				password, _ = u.User.Password()
+				u.User = nil
+			}
+			credentials = func() (string, string, error) {
+				return username, password, nil
+			}
+		}
+		limit := trackers.rateLimits.get(u.Host)
+		t.upstreams = append(t.upstreams, &mirrorUpstream{
+			url:    u,
+			limit:  limit,
+			health: trackers.health.get(u.Host),
+			// 客户端没有提供认证信息时，由代理完成上游的认证质询；上游返回 429 时退避重试，后面还有镜像时直接切换；
+			// 并发请求数超过 MaxConnections 时排队
+			transport: newTokenTransportWithCredentials(&rateLimitTransport{
+				base:     newConnLimitTransport(base, u.Host, cfg.MaxConnections),
+				host:     u.Host,
+				limit:    limit,
+				failover: i < len(rawURLs)-1,
+			}, credentials),
+		})
+	}
+	return t, nil
+}
+
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// 推送只发往主上游，镜像通常只读；请求体无法重建时只能发送一次
+	replayable := (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		(req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+	primary := t.upstreams[0]
+
+	var lastErr error
+	for i, upstream := range t.upstreams {
+		last := i == len(t.upstreams)-1 || !replayable
+		if !last && upstream.limit.blocked() {
+			continue
+		}
+		if !upstream.health.allow() {
+			lastErr = errCircuitOpen{upstream: upstream.url.Host}
+			if last {
+				return nil, lastErr
+			}
+			continue
+		}
+
+		attempt := req
+		if i > 0 {
+			var err error
+			if attempt, err = upstream.rewrite(req, primary.url); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := upstream.transport.RoundTrip(attempt)
+		// 连接失败和 5xx 计入断路器，429 由限流处理
+		switch {
+		case errors.Is(err, context.Canceled):
+			upstream.health.abandon()
+		case err != nil:
+			upstream.health.failure(err)
+		case resp.StatusCode >= http.StatusInternalServerError:
+			upstream.health.failure(fmt.Errorf("upstream returned %d", resp.StatusCode))
+		default:
+			upstream.health.success()
+		}
+		if err == nil && (last || !shouldFailover(resp.StatusCode)) {
+			resp.Header.Set(UpstreamHeader, upstream.url.Host)
+			if i > 0 {
+				log.Printf("Served %s %s from mirror %s", req.Method, req.URL.Path, upstream.url.Host)
+			}
+			return resp, nil
+		}
+		if err != nil {
+			if errors.Is(err, context.Canceled) || last {
+				return nil, err
+			}
+			lastErr = err
+			log.Printf("Upstream %s failed for %s %s, trying next mirror: %v", upstream.url.Host, req.Method, req.URL.Path, err)
+		} else {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("upstream %s returned %d", upstream.url.Host, resp.StatusCode)
+			log.Printf("Upstream %s returned %d for %s %s, trying next mirror", upstream.url.Host, resp.StatusCode, req.Method, req.URL.Path)
+		}
+	}
+	return nil, lastErr
+}
+
+// shouldFailover 连接成功但需要切换到下一个上游的状态码
+func shouldFailover(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// rewrite 将发往主上游的请求改写为发往该镜像
+// 客户端的认证信息属于主上游，不发送给镜像
+func (u *mirrorUpstream) rewrite(req *http.Request, primary *url.URL) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	clone.URL.Scheme = u.url.Scheme
+	clone.URL.Host = u.url.Host
+	clone.URL.Path = strings.TrimSuffix(u.url.Path, "/") + strings.TrimPrefix(req.URL.Path, strings.TrimSuffix(primary.Path, "/"))
+	clone.URL.RawPath = ""
+	clone.Host = u.url.Host
+	clone.Header.Del("Authorization")
+	return clone, nil
+}
@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestMirrorFallback(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	// 已关闭的服务器模拟连接失败
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	var mirrorPath, mirrorAuth string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorPath = r.URL.Path
+		mirrorAuth = r.Header.Get("Authorization")
+		w.Write([]byte("ok"))
+	}))
+	defer mirror.Close()
+
+	handler, err := newRegistryProxyHandler(config.Config{
+		HostName:  "docker.io",
+		RemoteURL: primary.URL,
+		Mirrors:   []string{down.URL, mirror.URL + "/dockerhub"},
+	}, nil, newUpstreamTrackers())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/library/app/manifests/latest", nil)
+	req.Header.Set("Authorization", "Bearer primary-token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	body, _ := io.ReadAll(w.Result().Body)
+	if w.Code != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("unexpected response %d %q", w.Code, body)
+	}
+	mirrorURL, _ := url.Parse(mirror.URL)
+	if got := w.Header().Get(UpstreamHeader); got != mirrorURL.Host {
+		t.Fatalf("expected response from %s, got %q", mirrorURL.Host, got)
+	}
+	if mirrorPath != "/dockerhub/v2/library/app/manifests/latest" {
+		t.Fatalf("unexpected mirror path %q", mirrorPath)
+	}
+	if mirrorAuth != "" {
+		t.Fatalf("client credentials must not be sent to mirrors, got %q", mirrorAuth)
+	}
+}
+
+func TestEncryptedCredentials(t *testing.T) {
+	if err := config.SetCredentialKey([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	defer config.SetCredentialKey(nil)
+	t.Setenv("TEST_REGISTRY_USER", "alice")
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "alice" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	store := config.NewMemoryConfigStore()
+	if err := store.Add(config.Config{HostName: "registry.local", RemoteURL: upstream.URL, Username: "${TEST_REGISTRY_USER}", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, _ := store.Get("registry.local")
+	if cfg.Username != "${TEST_REGISTRY_USER}" || !strings.HasPrefix(cfg.Password, "enc:v1:") {
+		t.Fatalf("Expected password to be encrypted and reference kept, got %q %q", cfg.Username, cfg.Password)
+	}
+	if configs, _ := store.List(); configs[0].Username != "" || configs[0].Password != "" {
+		t.Fatal("Expected credentials to be redacted")
+	}
+
+	handler, err := newRegistryProxyHandler(cfg, nil, newUpstreamTrackers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/library/app/manifests/latest", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected upstream to accept resolved credentials, got %d", w.Code)
+	}
+
+	// 环境变量轮换后下一个请求使用新的值，不需要重新创建处理器
+	t.Setenv("TEST_REGISTRY_USER", "bob")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/library/app/manifests/latest", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected rotated username to be sent upstream, got %d", w.Code)
+	}
+
+	// 没有密钥时无法解密，不能使用密文作为密码
+	config.SetCredentialKey(nil)
+	if _, err := newRegistryProxyHandler(cfg, nil, newUpstreamTrackers()); err == nil {
+		t.Fatal("Expected encrypted credentials without key to be rejected")
+	}
+}
@@ -0,0 +1,406 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcat999/container-ui/internal/auth"
+	"gopkg.in/yaml.v3"
+)
+
+// EventsMediaType 通知请求体的媒体类型，与 Distribution 的通知格式一致
+const EventsMediaType = "application/vnd.docker.distribution.events.v1+json"
+
+// 事件动作
+const (
+	EventActionPush   = "push"
+	EventActionPull   = "pull"
+	EventActionDelete = "delete"
+	EventActionMount  = "mount"
+)
+
+// 通知的默认参数
+const (
+	defaultWebhookTimeout = 5 * time.Second
+	defaultWebhookRetries = 5
+	webhookQueueSize      = 1024
+	webhookRecent         = 50
+	maxWebhookBackoff     = time.Minute
+)
+
+// Event 仓库事件，字段与 Distribution 的通知事件一致
+type Event struct {
+	ID        string       `json:"id"`
+	Timestamp time.Time    `json:"timestamp"`
+	Action    string       `json:"action"`
+	Target    EventTarget  `json:"target"`
+	Request   EventRequest `json:"request"`
+	Actor     EventActor   `json:"actor"`
+}
+
+// EventTarget 事件作用的清单或 blob
+type EventTarget struct {
+	MediaType  string `json:"mediaType,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	Length     int64  `json:"length,omitempty"`
+	Repository string `json:"repository"`
+	URL        string `json:"url,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+}
+
+// EventRequest 触发事件的请求
+type EventRequest struct {
+	ID        string `json:"id"`
+	Addr      string `json:"addr"`
+	Host      string `json:"host"`
+	Method    string `json:"method"`
+	UserAgent string `json:"useragent"`
+}
+
+// EventActor 触发事件的用户，未启用认证时为空
+type EventActor struct {
+	Name string `json:"name,omitempty"`
+}
+
+// WebhookEndpoint 接收通知的地址
+// Secret 不为空时使用 HMAC-SHA256 对请求体签名，签名放在 X-Registry-Signature-256: sha256=<hex> 中
+type WebhookEndpoint struct {
+	Name    string            `yaml:"name" json:"name"`
+	URL     string            `yaml:"url" json:"url"`
+	Secret  string            `yaml:"secret" json:"-"`
+	Headers map[string]string `yaml:"headers" json:"-"`
+	// Actions 只发送这些动作的事件，为空时发送全部
+	Actions []string `yaml:"actions" json:"actions,omitempty"`
+	// Timeout 单次请求的超时时间，0 使用默认值
+	Timeout time.Duration `yaml:"timeout" json:"-"`
+	// Retries 失败后的重试次数，0 使用默认值，负数表示不重试
+	Retries int `yaml:"retries" json:"-"`
+}
+
+// LoadWebhookConfig 读取通知配置文件 (YAML，endpoints 列表)
+func LoadWebhookConfig(path string) ([]WebhookEndpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification config: %v", err)
+	}
+	var config struct {
+		Endpoints []WebhookEndpoint `yaml:"endpoints"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse notification config: %v", err)
+	}
+	for i, endpoint := range config.Endpoints {
+		if endpoint.URL == "" {
+			return nil, fmt.Errorf("notification endpoint %d has no url", i)
+		}
+		if endpoint.Name == "" {
+			config.Endpoints[i].Name = endpoint.URL
+		}
+	}
+	return config.Endpoints, nil
+}
+
+// WebhookDelivery 一次事件投递的结果
+type WebhookDelivery struct {
+	EventID    string    `json:"eventId"`
+	Action     string    `json:"action"`
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag,omitempty"`
+	Digest     string    `json:"digest,omitempty"`
+	Attempts   int       `json:"attempts"`
+	Delivered  bool      `json:"delivered"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// WebhookStatus 通知地址的投递状态
+type WebhookStatus struct {
+	WebhookEndpoint
+	Pending   int               `json:"pending"`
+	Delivered int64             `json:"delivered"`
+	Failed    int64             `json:"failed"`
+	Dropped   int64             `json:"dropped"`
+	Recent    []WebhookDelivery `json:"recent"`
+}
+
+// webhookSink 一个通知地址的发送队列，事件按顺序投递，失败时按指数退避重试
+type webhookSink struct {
+	endpoint WebhookEndpoint
+	client   *http.Client
+	queue    chan Event
+
+	mu        sync.Mutex
+	delivered int64
+	failed    int64
+	dropped   int64
+	recent    []WebhookDelivery
+}
+
+// Notifier 把仓库事件异步发送到配置的通知地址，发送失败不影响仓库请求
+type Notifier struct {
+	sinks []*webhookSink
+	// backoff 第一次重试前的等待时间，之后每次加倍
+	backoff time.Duration
+}
+
+// NewNotifier 创建通知器，需要调用 Run 才会开始投递
+func NewNotifier(endpoints []WebhookEndpoint) *Notifier {
+	n := &Notifier{backoff: time.Second}
+	for _, endpoint := range endpoints {
+		if endpoint.Timeout <= 0 {
+			endpoint.Timeout = defaultWebhookTimeout
+		}
+		if endpoint.Retries == 0 {
+			endpoint.Retries = defaultWebhookRetries
+		}
+		n.sinks = append(n.sinks, &webhookSink{
+			endpoint: endpoint,
+			client:   &http.Client{Timeout: endpoint.Timeout},
+			queue:    make(chan Event, webhookQueueSize),
+		})
+	}
+	return n
+}
+
+// Notify 把事件放入每个通知地址的队列，队列已满时丢弃事件并计数
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	for _, sink := range n.sinks {
+		if !sink.accepts(event.Action) {
+			continue
+		}
+		select {
+		case sink.queue <- event:
+		default:
+			sink.mu.Lock()
+			sink.dropped++
+			sink.mu.Unlock()
+			log.Printf("Notification queue for %s is full, dropping event %s", sink.endpoint.Name, event.ID)
+		}
+	}
+}
+
+// Run 投递队列中的事件直到 ctx 结束
+func (n *Notifier) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, sink := range n.sinks {
+		wg.Add(1)
+		go func(sink *webhookSink) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event := <-sink.queue:
+					sink.deliver(ctx, event, n.backoff)
+				}
+			}
+		}(sink)
+	}
+	wg.Wait()
+}
+
+// Status 返回所有通知地址的投递状态
+func (n *Notifier) Status() []WebhookStatus {
+	statuses := make([]WebhookStatus, 0, len(n.sinks))
+	for _, sink := range n.sinks {
+		sink.mu.Lock()
+		recent := make([]WebhookDelivery, len(sink.recent))
+		copy(recent, sink.recent)
+		statuses = append(statuses, WebhookStatus{
+			WebhookEndpoint: sink.endpoint,
+			Pending:         len(sink.queue),
+			Delivered:       sink.delivered,
+			Failed:          sink.failed,
+			Dropped:         sink.dropped,
+			Recent:          recent,
+		})
+		sink.mu.Unlock()
+	}
+	return statuses
+}
+
+// ServeHTTP 实现管理接口：GET 返回所有通知地址的投递状态
+func (n *Notifier) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n.Status())
+}
+
+func (s *webhookSink) accepts(action string) bool {
+	if len(s.endpoint.Actions) == 0 {
+		return true
+	}
+	for _, a := range s.endpoint.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver 投递一个事件，失败时按指数退避重试，最多重试 Retries 次
+func (s *webhookSink) deliver(ctx context.Context, event Event, backoff time.Duration) {
+	body, err := json.Marshal(map[string][]Event{"events": {event}})
+	if err != nil {
+		log.Printf("Failed to encode event %s: %v", event.ID, err)
+		return
+	}
+
+	delivery := WebhookDelivery{
+		EventID:    event.ID,
+		Action:     event.Action,
+		Repository: event.Target.Repository,
+		Tag:        event.Target.Tag,
+		Digest:     event.Target.Digest,
+	}
+	for {
+		delivery.Attempts++
+		delivery.StatusCode, err = s.send(ctx, body)
+		if err == nil || delivery.Attempts > s.endpoint.Retries {
+			break
+		}
+		log.Printf("Failed to deliver event %s to %s (attempt %d): %v", event.ID, s.endpoint.Name, delivery.Attempts, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxWebhookBackoff {
+			backoff = maxWebhookBackoff
+		}
+	}
+
+	delivery.Delivered = err == nil
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	delivery.Time = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if delivery.Delivered {
+		s.delivered++
+	} else {
+		s.failed++
+	}
+	s.recent = append(s.recent, delivery)
+	if len(s.recent) > webhookRecent {
+		s.recent = s.recent[len(s.recent)-webhookRecent:]
+	}
+}
+
+// send 发送一次请求，非 2xx 响应视为失败
+func (s *webhookSink) send(ctx context.Context, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for key, value := range s.endpoint.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", EventsMediaType)
+	if s.endpoint.Secret != "" {
+		req.Header.Set("X-Registry-Signature-256", "sha256="+signPayload(s.endpoint.Secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// signPayload 计算请求体的 HMAC-SHA256 签名
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notify 发送由当前请求触发的事件，未配置通知时不做任何事
+func (h *Handler) notify(c *gin.Context, action string, target EventTarget) {
+	if h.notifier == nil {
+		return
+	}
+	var actor EventActor
+	if claims, ok := c.Get(registryClaimsKey); ok {
+		actor.Name = claims.(auth.RegistryClaims).Subject
+	}
+	h.notifier.Notify(Event{
+		ID:        newEventID(),
+		Timestamp: time.Now().UTC(),
+		Action:    action,
+		Target:    target,
+		Request: EventRequest{
+			ID:        c.GetHeader("X-Request-Id"),
+			Addr:      c.Request.RemoteAddr,
+			Host:      c.Request.Host,
+			Method:    c.Request.Method,
+			UserAgent: c.Request.UserAgent(),
+		},
+		Actor: actor,
+	})
+}
+
+// manifestTarget 返回清单事件的目标，引用不是摘要时记录标签
+func manifestTarget(repository, reference, digest, mediaType string, size int64) EventTarget {
+	target := EventTarget{
+		MediaType:  mediaType,
+		Size:       size,
+		Length:     size,
+		Digest:     digest,
+		Repository: repository,
+		URL:        fmt.Sprintf("/v2/%s/manifests/%s", repository, digest),
+	}
+	if !sha256DigestPattern.MatchString(reference) {
+		target.Tag = reference
+	}
+	return target
+}
+
+// blobTarget 返回 blob 事件的目标
+func (h *Handler) blobTarget(repository, digest string) EventTarget {
+	size, _ := h.storage.GetBlobSize(repository, digest)
+	return EventTarget{
+		MediaType:  "application/octet-stream",
+		Size:       size,
+		Length:     size,
+		Digest:     digest,
+		Repository: repository,
+		URL:        fmt.Sprintf("/v2/%s/blobs/%s", repository, digest),
+	}
+}
+
+// newEventID 生成事件 ID
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
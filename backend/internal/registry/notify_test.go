@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+func TestNotifier(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		events   []Event
+	)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Registry-Signature-256") != "sha256="+signPayload("s3cret", body) {
+			t.Errorf("Unexpected signature %q", r.Header.Get("X-Registry-Signature-256"))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		// 第一次投递失败，验证重试
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var envelope struct {
+			Events []Event `json:"events"`
+		}
+		json.Unmarshal(body, &envelope)
+		events = append(events, envelope.Events...)
+	}))
+	defer webhook.Close()
+
+	notifier := NewNotifier([]WebhookEndpoint{{Name: "ci", URL: webhook.URL, Secret: "s3cret", Actions: []string{EventActionPush}}})
+	notifier.backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	router := NewRouter(NewHandlerWithOptions(storage.NewMemoryStorage(), HandlerOptions{Notifier: notifier}))
+	manifest := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"sha256:c"},"layers":[]}`
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPut, "/v2/app/manifests/v1", strings.NewReader(manifest)),
+		httptest.NewRequest(http.MethodGet, "/v2/app/manifests/v1", nil),
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// 拉取事件被过滤，只投递推送事件
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := notifier.Status()[0]
+		if status.Delivered == 1 {
+			if status.Recent[0].Attempts != 2 || status.Failed != 0 {
+				t.Fatalf("Unexpected delivery status %+v", status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Event was not delivered: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 {
+		t.Fatalf("Expected one event, got %+v", events)
+	}
+	if target := events[0].Target; events[0].Action != EventActionPush || target.Repository != "app" || target.Tag != "v1" || target.Digest != digestOf(manifest) {
+		t.Fatalf("Unexpected event %+v", events[0])
+	}
+}
@@ -0,0 +1,173 @@
+package registry
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// pathRouter 在同一个主机名下按路径前缀代理多个上游，适用于无法劫持 DNS 的环境
+// 客户端拉取 mirror.example.com/docker.io/library/nginx 时请求 /v2/docker.io/library/nginx/...，
+// 路由器按第一段路径查找配置，去掉前缀后交给对应上游的代理处理器，并把响应中的 Location、Link 和
+// WWW-Authenticate 改写回带前缀的路径。没有前缀的请求交给 fallback 按主机名处理
+type pathRouter struct {
+	manager  *Manager
+	fallback http.Handler
+}
+
+// NewPathRouter 创建按路径前缀路由的处理器
+func NewPathRouter(manager *Manager, fallback http.Handler) http.Handler {
+	return &pathRouter{manager: manager, fallback: fallback}
+}
+
+func (p *pathRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 版本检查由代理直接应答，上游的认证由代理完成
+	if r.URL.Path == "/v2/" || r.URL.Path == "/v2" {
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+		return
+	}
+
+	prefix, rest, ok := splitUpstreamPrefix(r.URL.Path)
+	if !ok {
+		p.fallback.ServeHTTP(w, r)
+		return
+	}
+	cfg, ok := p.manager.MatchConfig(prefix)
+	if !ok {
+		p.fallback.ServeHTTP(w, r)
+		return
+	}
+	handler, err := p.manager.GetProxyHandler(cfg)
+	if err != nil {
+		log.Printf("Error creating proxy for %s: %v", prefix, err)
+		http.Error(w, "Failed to create proxy", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Routing %s %s to %s", r.Method, r.URL.Path, cfg.RemoteURL)
+	req := r.Clone(r.Context())
+	req.URL.Path = "/v2/" + rest
+	req.URL.RawPath = ""
+	// 客户端的令牌是为代理的主机名申请的，对上游无效，上游认证由代理使用配置的凭据完成
+	req.Header.Del("Authorization")
+
+	upstreams := make(map[string]bool)
+	for _, raw := range cfg.Upstreams() {
+		if u, err := url.Parse(raw); err == nil {
+			upstreams[strings.ToLower(u.Host)] = true
+		}
+	}
+	rewriter := &prefixRewriter{prefix: prefix, upstreams: upstreams}
+	handler.ServeHTTP(&headerRewriteWriter{ResponseWriter: w, rewrite: rewriter.rewriteHeaders}, req)
+}
+
+// splitUpstreamPrefix 拆分 /v2/<upstream>/<repository path>，第一段按镜像引用的规则识别为主机名：
+// 包含 . 或 :，或者为 localhost
+func splitUpstreamPrefix(path string) (string, string, bool) {
+	trimmed := strings.TrimPrefix(path, "/v2/")
+	if trimmed == path {
+		return "", "", false
+	}
+	prefix, rest, ok := strings.Cut(trimmed, "/")
+	if !ok || rest == "" {
+		return "", "", false
+	}
+	if !strings.ContainsAny(prefix, ".:") && prefix != "localhost" {
+		return "", "", false
+	}
+	if _, _, ok := splitRepositoryPath("/v2/" + rest); !ok {
+		return "", "", false
+	}
+	return prefix, rest, true
+}
+
+// headerRewriteWriter 在写出响应头之前调用 rewrite 修改响应头
+type headerRewriteWriter struct {
+	http.ResponseWriter
+	rewrite     func(http.Header)
+	wroteHeader bool
+}
+
+func (w *headerRewriteWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.rewrite(w.Header())
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerRewriteWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *headerRewriteWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层的 ResponseWriter
+func (w *headerRewriteWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// linkTarget 匹配 Link 头中尖括号内的地址
+var linkTarget = regexp.MustCompile(`<([^>]*)>`)
+
+// challengeScope 匹配 WWW-Authenticate 中的仓库作用域
+var challengeScope = regexp.MustCompile(`repository:([^:" ]+)`)
+
+// prefixRewriter 把上游的路径改写为带前缀的路径
+type prefixRewriter struct {
+	prefix    string
+	upstreams map[string]bool
+}
+
+func (w *prefixRewriter) rewriteHeaders(header http.Header) {
+	if location := header.Get("Location"); location != "" {
+		header.Set("Location", w.rewriteURL(location))
+	}
+	if links := header.Values("Link"); len(links) > 0 {
+		header.Del("Link")
+		for _, link := range links {
+			header.Add("Link", linkTarget.ReplaceAllStringFunc(link, func(m string) string {
+				return "<" + w.rewriteURL(m[1:len(m)-1]) + ">"
+			}))
+		}
+	}
+	if challenge := header.Get("WWW-Authenticate"); challenge != "" {
+		header.Set("WWW-Authenticate", challengeScope.ReplaceAllString(challenge, "repository:"+w.prefix+"/$1"))
+	}
+}
+
+// rewriteURL 把指向上游 /v2/ 的相对或绝对地址改写为代理上带前缀的相对地址
+// 指向其他主机的地址 (例如 blob 存储的签名地址) 保持不变
+func (w *prefixRewriter) rewriteURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	if u.Host != "" && !w.upstreams[strings.ToLower(u.Host)] {
+		return raw
+	}
+	// 镜像地址可能带有路径前缀，例如 https://mirror.example.com/dockerhub/v2/...
+	i := strings.Index(u.Path, "/v2/")
+	if i < 0 {
+		return raw
+	}
+	rewritten := url.URL{
+		Path:     "/v2/" + w.prefix + "/" + u.Path[i+len("/v2/"):],
+		RawQuery: u.RawQuery,
+	}
+	return rewritten.String()
+}
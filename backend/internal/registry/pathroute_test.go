@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestPathRouter(t *testing.T) {
+	var upstreamURL string
+	var gotPath, gotAuth string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/v2/library/app/blobs/uploads/":
+			w.Header().Set("Location", upstreamURL+"/v2/library/app/blobs/uploads/123?state=abc")
+			w.WriteHeader(http.StatusAccepted)
+		case "/v2/library/app/tags/list":
+			w.Header().Set("Link", `</v2/library/app/tags/list?last=b&n=2>; rel="next"`)
+			w.Write([]byte(`{"name":"library/app","tags":["a","b"]}`))
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="",service="test",scope="repository:library/app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer upstream.Close()
+	upstreamURL = upstream.URL
+
+	rm := NewManager(config.NewMemoryConfigStore())
+	if err := rm.AddConfig(config.Config{HostName: "registry.test", RemoteURL: upstream.URL, AllowPush: true}); err != nil {
+		t.Fatal(err)
+	}
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router := NewPathRouter(rm, fallback)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer mirror-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve(http.MethodGet, "/v2/"); w.Code != http.StatusOK {
+		t.Fatalf("expected version check to succeed, got %d", w.Code)
+	}
+
+	w := serve(http.MethodPost, "/v2/registry.test/library/app/blobs/uploads/")
+	if gotPath != "/v2/library/app/blobs/uploads/" || gotAuth != "" {
+		t.Fatalf("unexpected upstream request %q auth=%q", gotPath, gotAuth)
+	}
+	if got := w.Header().Get("Location"); got != "/v2/registry.test/library/app/blobs/uploads/123?state=abc" {
+		t.Fatalf("unexpected Location %q", got)
+	}
+
+	w = serve(http.MethodGet, "/v2/registry.test/library/app/tags/list")
+	if got := w.Header().Get("Link"); got != `</v2/registry.test/library/app/tags/list?last=b&n=2>; rel="next"` {
+		t.Fatalf("unexpected Link %q", got)
+	}
+
+	w = serve(http.MethodGet, "/v2/registry.test/library/app/manifests/latest")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); got != `Bearer realm="",service="test",scope="repository:registry.test/library/app:pull"` {
+		t.Fatalf("unexpected WWW-Authenticate %q", got)
+	}
+
+	// 没有主机名前缀的请求按 Host 头路由
+	if w := serve(http.MethodGet, "/v2/library/app/manifests/latest"); w.Code != http.StatusTeapot {
+		t.Fatalf("expected fallback, got %d", w.Code)
+	}
+}
@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// pushGuard 校验推送请求后转发给主上游，并把上游返回的上传地址改写回代理
+// 配置未开启 AllowPush 时拒绝所有写请求，避免任何能访问代理的客户端借用代理的凭据推送镜像
+type pushGuard struct {
+	allow    bool
+	upstream *url.URL
+	rewriter *repositoryRewriter
+	next     http.Handler
+}
+
+func newPushGuard(allow bool, upstream *url.URL, rewriter *repositoryRewriter, next http.Handler) *pushGuard {
+	return &pushGuard{allow: allow, upstream: upstream, rewriter: rewriter, next: next}
+}
+
+func (g *pushGuard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		g.next.ServeHTTP(w, r)
+		return
+	}
+
+	name, rest, ok := splitRepositoryPath(r.URL.Path)
+	if !ok {
+		writeRegistryError(w, http.StatusNotFound, errCodeNameUnknown, "unsupported push endpoint")
+		return
+	}
+	if !g.allow {
+		writeRegistryError(w, http.StatusMethodNotAllowed, errCodeUnsupported, "push is not enabled for this registry")
+		return
+	}
+
+	kind, reference, _ := strings.Cut(rest, "/")
+	switch {
+	case kind == "manifests" && r.Method == http.MethodPut:
+		if !g.validateManifest(w, r, reference) {
+			return
+		}
+	case kind == "blobs" && strings.HasPrefix(reference, "uploads/") && r.Method == http.MethodPut:
+		// 完成上传时必须给出摘要，上游据此校验内容
+		if digest := r.URL.Query().Get("digest"); !sha256DigestPattern.MatchString(digest) {
+			writeRegistryError(w, http.StatusBadRequest, errCodeDigestInvalid, "upload must be completed with a sha256 digest")
+			return
+		}
+	}
+
+	log.Printf("Pushing %s %s to %s", r.Method, r.URL.Path, g.upstream.Host)
+	upstreamName := g.rewriter.repository(name)
+	g.next.ServeHTTP(&headerRewriteWriter{ResponseWriter: w, rewrite: func(header http.Header) {
+		if location := header.Get("Location"); location != "" {
+			header.Set("Location", g.rewriteLocation(location, name, upstreamName))
+		}
+	}}, r)
+}
+
+// validateManifest 读取并校验清单，通过后把请求体替换为可重放的内容，上游认证质询后可以重试
+func (g *pushGuard) validateManifest(w http.ResponseWriter, r *http.Request, reference string) bool {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxCachedManifestSize+1))
+	if err != nil {
+		writeRegistryError(w, http.StatusBadRequest, errCodeManifestInvalid, err.Error())
+		return false
+	}
+	if len(data) > maxCachedManifestSize {
+		writeRegistryError(w, http.StatusRequestEntityTooLarge, errCodeSizeInvalid, "manifest is too large")
+		return false
+	}
+
+	var manifest struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		writeRegistryError(w, http.StatusBadRequest, errCodeManifestInvalid, fmt.Sprintf("invalid manifest: %v", err))
+		return false
+	}
+	if manifest.SchemaVersion != 2 {
+		writeRegistryError(w, http.StatusBadRequest, errCodeManifestInvalid, "unsupported manifest schema version")
+		return false
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	if sha256DigestPattern.MatchString(reference) && reference != digest {
+		writeRegistryError(w, http.StatusBadRequest, errCodeDigestInvalid, fmt.Sprintf("manifest digest is %s", digest))
+		return false
+	}
+	if r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", detectManifestMediaType(data))
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return true
+}
+
+// rewriteLocation 把上游返回的上传地址改写为代理上的相对地址，仓库名称改回客户端请求的名称
+// 客户端后续的 PATCH 和 PUT 因此仍然经过代理，由代理注入凭据
+func (g *pushGuard) rewriteLocation(raw, name, upstreamName string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Host != "" && !strings.EqualFold(u.Host, g.upstream.Host)) {
+		return raw
+	}
+	i := strings.Index(u.Path, "/v2/")
+	if i < 0 {
+		return raw
+	}
+	path := u.Path[i:]
+	if locName, rest, ok := splitRepositoryPath(path); ok && locName == upstreamName {
+		path = "/v2/" + name + "/" + rest
+	}
+	rewritten := url.URL{Path: path, RawQuery: u.RawQuery}
+	return rewritten.String()
+}
@@ -0,0 +1,100 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestPushThrough(t *testing.T) {
+	var upstreamURL string
+	var patched, manifest string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "robot" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/v2/":
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/team/myrepo/app/blobs/uploads/":
+			w.Header().Set("Location", upstreamURL+"/v2/team/myrepo/app/blobs/uploads/u1?_state=s1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPatch && r.URL.Path == "/v2/team/myrepo/app/blobs/uploads/u1":
+			patched = string(body)
+			w.Header().Set("Location", "/v2/team/myrepo/app/blobs/uploads/u1?_state=s2")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/team/myrepo/app/manifests/v1":
+			manifest = string(body)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("unexpected upstream request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+	upstreamURL = upstream.URL
+
+	cfg := config.Config{
+		HostName:  "registry.test",
+		RemoteURL: upstream.URL,
+		Username:  "robot",
+		Password:  "secret",
+		AllowPush: true,
+		Rewrites:  []config.RewriteRule{{Match: "myrepo/", Replace: "team/myrepo/"}},
+	}
+	handler, err := NewRegistryProxyHandler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	// 请求体无法重放，先通过 /v2/ 的质询取得凭据
+	w := serve(http.MethodPatch, "/v2/myrepo/app/blobs/uploads/u1?_state=s1", "layer data")
+	if w.Code != http.StatusAccepted || patched != "layer data" {
+		t.Fatalf("unexpected patch response %d, upstream received %q", w.Code, patched)
+	}
+	if got := w.Header().Get("Location"); got != "/v2/myrepo/app/blobs/uploads/u1?_state=s2" {
+		t.Fatalf("unexpected Location %q", got)
+	}
+
+	w = serve(http.MethodPost, "/v2/myrepo/app/blobs/uploads/", "")
+	if got := w.Header().Get("Location"); w.Code != http.StatusAccepted || got != "/v2/myrepo/app/blobs/uploads/u1?_state=s1" {
+		t.Fatalf("unexpected upload response %d Location %q", w.Code, got)
+	}
+
+	body := `{"schemaVersion":2,"mediaType":"` + MediaTypeManifestV2 + `"}`
+	if w := serve(http.MethodPut, "/v2/myrepo/app/manifests/v1", body); w.Code != http.StatusCreated || manifest != body {
+		t.Fatalf("unexpected manifest response %d, upstream received %q", w.Code, manifest)
+	}
+
+	wrongDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other")))
+	if w := serve(http.MethodPut, "/v2/myrepo/app/manifests/"+wrongDigest, body); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected digest mismatch to be rejected, got %d", w.Code)
+	}
+	if w := serve(http.MethodPut, "/v2/myrepo/app/blobs/uploads/u1", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected upload without digest to be rejected, got %d", w.Code)
+	}
+
+	cfg.AllowPush = false
+	readOnly, err := NewRegistryProxyHandler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	readOnly.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v2/myrepo/app/blobs/uploads/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected push to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,235 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+// ErrQuotaExceeded 写入会超过存储配额
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaOptions 存储配额，0 表示不限制
+type QuotaOptions struct {
+	// MaxRepositoryBytes 单个仓库中清单和 blob 的总大小上限
+	MaxRepositoryBytes int64 `json:"maxRepositoryBytes"`
+	// MaxTotalBytes 所有仓库的总大小上限，相同摘要的内容只统计一次
+	MaxTotalBytes int64 `json:"maxTotalBytes"`
+	// MaxTags 单个仓库的标签数量上限
+	MaxTags int `json:"maxTags"`
+}
+
+// RepositoryUsage 仓库的存储用量
+type RepositoryUsage struct {
+	Repository string `json:"repository"`
+	Bytes      int64  `json:"bytes"`
+	Tags       int    `json:"tags"`
+}
+
+// QuotaUsage 配额和当前用量
+type QuotaUsage struct {
+	Limits       QuotaOptions      `json:"limits"`
+	TotalBytes   int64             `json:"totalBytes"`
+	Repositories []RepositoryUsage `json:"repositories"`
+}
+
+// Quota 在上传完成和清单推送时检查存储配额。
+// 用量每次从存储统计，不单独记录，删除和垃圾回收后无需同步；
+// 检查和写入在同一把锁内完成，避免并发推送同时通过检查
+type Quota struct {
+	store storage.Storage
+	opts  QuotaOptions
+	mu    sync.Mutex
+}
+
+// NewQuota 创建存储配额
+func NewQuota(store storage.Storage, opts QuotaOptions) *Quota {
+	return &Quota{store: store, opts: opts}
+}
+
+// admit 检查向仓库写入 digest 内容后是否超过配额，未超过时调用 commit 写入。
+// tag 不为空时写入的是该标签指向的清单，新标签需要检查标签数量。
+// q 为空时直接写入，超过配额时返回 ErrQuotaExceeded
+func (q *Quota) admit(repository, tag, digest string, size int64, commit func() error) error {
+	if q == nil {
+		return commit()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.check(repository, tag, digest, size); err != nil {
+		return err
+	}
+	return commit()
+}
+
+func (q *Quota) check(repository, tag, digest string, size int64) error {
+	if q.opts.MaxTags > 0 && tag != "" {
+		tags, err := q.store.ListTags(repository)
+		if err != nil {
+			return fmt.Errorf("failed to list tags of %s: %v", repository, err)
+		}
+		if !containsString(tags, tag) && len(tags) >= q.opts.MaxTags {
+			return fmt.Errorf("%w: repository %s already has %d tags", ErrQuotaExceeded, repository, len(tags))
+		}
+	}
+
+	if q.opts.MaxRepositoryBytes > 0 {
+		digests, err := q.repositoryDigests(repository)
+		if err != nil {
+			return err
+		}
+		if _, exists := digests[digest]; !exists {
+			if used := sumSizes(digests); used+size > q.opts.MaxRepositoryBytes {
+				return fmt.Errorf("%w: repository %s would use %d of %d bytes", ErrQuotaExceeded, repository, used+size, q.opts.MaxRepositoryBytes)
+			}
+		}
+	}
+
+	if q.opts.MaxTotalBytes > 0 {
+		usage, err := q.usage()
+		if err != nil {
+			return err
+		}
+		if _, exists := usage.digests[digest]; !exists {
+			if used := usage.TotalBytes; used+size > q.opts.MaxTotalBytes {
+				return fmt.Errorf("%w: registry would use %d of %d bytes", ErrQuotaExceeded, used+size, q.opts.MaxTotalBytes)
+			}
+		}
+	}
+	return nil
+}
+
+// repositoryDigests 返回仓库中所有清单和 blob 的摘要及大小
+func (q *Quota) repositoryDigests(repository string) (map[string]int64, error) {
+	digests := make(map[string]int64)
+	manifests, err := q.store.ListManifests(repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list manifests of %s: %v", repository, err)
+	}
+	for _, digest := range manifests {
+		data, _, err := q.store.GetManifestByDigest(repository, digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get manifest %s@%s: %v", repository, digest, err)
+		}
+		digests[digest] = int64(len(data))
+	}
+
+	blobs, err := q.store.ListBlobs(repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs of %s: %v", repository, err)
+	}
+	for _, digest := range blobs {
+		size, err := q.store.GetBlobSize(repository, digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get blob size %s@%s: %v", repository, digest, err)
+		}
+		digests[digest] = size
+	}
+	return digests, nil
+}
+
+// quotaUsage 统计用量时额外记录所有仓库的摘要
+type quotaUsage struct {
+	QuotaUsage
+	digests map[string]int64
+}
+
+func (q *Quota) usage() (*quotaUsage, error) {
+	repositories, err := q.store.ListRepositories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %v", err)
+	}
+
+	usage := &quotaUsage{
+		QuotaUsage: QuotaUsage{Limits: q.opts, Repositories: []RepositoryUsage{}},
+		digests:    make(map[string]int64),
+	}
+	for _, repository := range repositories {
+		digests, err := q.repositoryDigests(repository)
+		if err != nil {
+			return nil, err
+		}
+		tags, err := q.store.ListTags(repository)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %v", repository, err)
+		}
+		usage.Repositories = append(usage.Repositories, RepositoryUsage{
+			Repository: repository,
+			Bytes:      sumSizes(digests),
+			Tags:       len(tags),
+		})
+		for digest, size := range digests {
+			usage.digests[digest] = size
+		}
+	}
+	usage.TotalBytes = sumSizes(usage.digests)
+	sort.Slice(usage.Repositories, func(i, j int) bool {
+		return usage.Repositories[i].Repository < usage.Repositories[j].Repository
+	})
+	return usage, nil
+}
+
+// Usage 返回配额和各仓库的当前用量
+func (q *Quota) Usage() (*QuotaUsage, error) {
+	usage, err := q.usage()
+	if err != nil {
+		return nil, err
+	}
+	return &usage.QuotaUsage, nil
+}
+
+// ServeHTTP 实现管理接口：GET 返回配额和当前用量
+func (q *Quota) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	usage, err := q.Usage()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+func sumSizes(digests map[string]int64) int64 {
+	var total int64
+	for _, size := range digests {
+		total += size
+	}
+	return total
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeQuotaError 超过配额时返回 413 DENIED，其他错误返回 500
+func writeQuotaError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrQuotaExceeded) {
+		writeRegistryError(w, http.StatusRequestEntityTooLarge, errCodeDenied, err.Error())
+		return
+	}
+	writeRegistryError(w, http.StatusInternalServerError, errCodeUnknown, err.Error())
+}
+
+// manifestTag 引用是标签时返回标签，按摘要推送时返回空
+func manifestTag(reference string) string {
+	if strings.HasPrefix(reference, "sha256:") {
+		return ""
+	}
+	return reference
+}
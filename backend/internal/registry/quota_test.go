@@ -0,0 +1,67 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+func TestQuota(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	quota := NewQuota(store, QuotaOptions{MaxRepositoryBytes: 200, MaxTotalBytes: 400, MaxTags: 2})
+	router := NewRouter(NewHandlerWithOptions(store, HandlerOptions{Quota: quota}))
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	pushBlob := func(repository, data string) *httptest.ResponseRecorder {
+		return serve(http.MethodPost, "/v2/"+repository+"/blobs/uploads/?digest="+digestOf(data), data)
+	}
+	denied := func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusRequestEntityTooLarge && strings.Contains(w.Body.String(), `"DENIED"`)
+	}
+
+	if w := pushBlob("app", strings.Repeat("a", 150)); w.Code != http.StatusCreated {
+		t.Fatalf("Expected blob to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := pushBlob("app", strings.Repeat("b", 100)); !denied(w) {
+		t.Fatalf("Expected repository quota to be exceeded, got %d: %s", w.Code, w.Body.String())
+	}
+	// 已有的 blob 不重复计入用量
+	if w := pushBlob("app", strings.Repeat("a", 150)); w.Code != http.StatusCreated {
+		t.Fatalf("Expected existing blob to be accepted, got %d", w.Code)
+	}
+	if w := pushBlob("other", strings.Repeat("c", 150)); w.Code != http.StatusCreated {
+		t.Fatalf("Expected blob in other repository to be accepted, got %d", w.Code)
+	}
+	if w := pushBlob("third", strings.Repeat("d", 101)); !denied(w) {
+		t.Fatalf("Expected total quota to be exceeded, got %d: %s", w.Code, w.Body.String())
+	}
+
+	manifest := `{"schemaVersion":2}`
+	for _, tag := range []string{"v1", "v2", "v1"} {
+		if w := serve(http.MethodPut, "/v2/other/manifests/"+tag, manifest); w.Code != http.StatusCreated {
+			t.Fatalf("Expected tag %s to be accepted, got %d: %s", tag, w.Code, w.Body.String())
+		}
+	}
+	if w := serve(http.MethodPut, "/v2/other/manifests/v3", manifest); !denied(w) {
+		t.Fatalf("Expected tag quota to be exceeded, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	quota.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/quotas", nil))
+	var usage QuotaUsage
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatal(err)
+	}
+	want := []RepositoryUsage{{Repository: "app", Bytes: 150}, {Repository: "other", Bytes: 150 + int64(len(manifest)), Tags: 2}}
+	if usage.TotalBytes != 300+int64(len(manifest)) || len(usage.Repositories) < 2 || usage.Repositories[0] != want[0] || usage.Repositories[1] != want[1] {
+		t.Fatalf("Unexpected usage %+v", usage)
+	}
+}
@@ -0,0 +1,240 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// rateLimitMaxRetries 收到 429 后最多重试的次数
+	rateLimitMaxRetries = 4
+	// rateLimitBaseDelay 上游没有返回 Retry-After 时的初始退避时间，每次重试翻倍
+	rateLimitBaseDelay = time.Second
+	// rateLimitMaxDelay 单次退避时间上限
+	rateLimitMaxDelay = 30 * time.Second
+	// rateLimitMaxWait 单个请求排队和重试等待的总时长上限，超过时直接返回上游的 429
+	rateLimitMaxWait = 2 * time.Minute
+)
+
+// RateLimitStatus 上游的限流状态
+type RateLimitStatus struct {
+	Upstream     string     `json:"upstream"`
+	Limit        int        `json:"limit"`         // 上游返回的窗口内请求上限，例如 Docker Hub 的拉取次数
+	Remaining    int        `json:"remaining"`     // 窗口内剩余的请求数
+	Window       int        `json:"windowSeconds"` // 窗口长度，单位秒
+	ReportedAt   *time.Time `json:"reportedAt,omitempty"`
+	Throttled    int64      `json:"throttled"` // 收到 429 的次数
+	Retries      int64      `json:"retries"`   // 因 429 重试的次数
+	Queued       int        `json:"queued"`    // 正在等待退避结束的请求数
+	BlockedUntil *time.Time `json:"blockedUntil,omitempty"`
+}
+
+// rateLimitTracker 按上游主机记录限流状态，同一上游的多个代理配置共用一份状态
+type rateLimitTracker struct {
+	mu        sync.Mutex
+	upstreams map[string]*upstreamLimit
+}
+
+func newRateLimitTracker() *rateLimitTracker {
+	return &rateLimitTracker{upstreams: make(map[string]*upstreamLimit)}
+}
+
+// get 返回上游的限流状态，不存在时创建
+func (t *rateLimitTracker) get(host string) *upstreamLimit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.upstreams[host]
+	if !ok {
+		l = &upstreamLimit{status: RateLimitStatus{Upstream: host}}
+		t.upstreams[host] = l
+	}
+	return l
+}
+
+// Statuses 返回所有上游的限流状态，按主机名排序
+func (t *rateLimitTracker) Statuses() []RateLimitStatus {
+	t.mu.Lock()
+	limits := make([]*upstreamLimit, 0, len(t.upstreams))
+	for _, l := range t.upstreams {
+		limits = append(limits, l)
+	}
+	t.mu.Unlock()
+
+	statuses := make([]RateLimitStatus, 0, len(limits))
+	for _, l := range limits {
+		statuses = append(statuses, l.snapshot())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Upstream < statuses[j].Upstream })
+	return statuses
+}
+
+// upstreamLimit 单个上游的限流状态，blockedUntil 之前发往该上游的请求排队等待
+type upstreamLimit struct {
+	mu           sync.Mutex
+	status       RateLimitStatus
+	blockedUntil time.Time
+}
+
+func (l *upstreamLimit) snapshot() RateLimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	status := l.status
+	if l.blockedUntil.After(time.Now()) {
+		until := l.blockedUntil
+		status.BlockedUntil = &until
+	}
+	return status
+}
+
+// observe 记录响应中的 RateLimit-Limit 和 RateLimit-Remaining 头，格式为 100;w=21600
+func (l *upstreamLimit) observe(header http.Header) {
+	limit, window, ok := parseRateLimitHeader(header.Get("RateLimit-Limit"))
+	if !ok {
+		return
+	}
+	remaining, _, ok := parseRateLimitHeader(header.Get("RateLimit-Remaining"))
+	if !ok {
+		return
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.status.Limit, l.status.Window, l.status.Remaining = limit, window, remaining
+	l.status.ReportedAt = &now
+}
+
+// throttle 记录一次 429，delay 内的请求排队等待
+func (l *upstreamLimit) throttle(delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.status.Throttled++
+	if until := time.Now().Add(delay); until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// blocked 上游是否处于限流退避中
+func (l *upstreamLimit) blocked() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.blockedUntil.After(time.Now())
+}
+
+func (l *upstreamLimit) retried() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.status.Retries++
+}
+
+// wait 等待退避结束，退避在 deadline 之后才结束时不等待，由上游决定是否拒绝
+func (l *upstreamLimit) wait(ctx context.Context, deadline time.Time) error {
+	l.mu.Lock()
+	until := l.blockedUntil
+	if !until.After(time.Now()) || until.After(deadline) {
+		l.mu.Unlock()
+		return nil
+	}
+	l.status.Queued++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.status.Queued--
+		l.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimitTransport 记录上游的限流响应头，收到 429 时按 Retry-After 或指数退避重试
+// 退避期间发往同一上游的其他请求也排队等待，避免持续触发限流
+type rateLimitTransport struct {
+	base  http.RoundTripper
+	host  string
+	limit *upstreamLimit
+	// failover 为 true 时后面还有备用镜像，收到 429 不重试，直接返回由 mirrorTransport 切换
+	failover bool
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// 令牌服务等其他主机的请求不计入该上游
+	if req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+
+	// 只重试没有请求体的拉取请求
+	retryable := (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		(req.Body == nil || req.Body == http.NoBody)
+	deadline := time.Now().Add(rateLimitMaxWait)
+	for attempt := 0; ; attempt++ {
+		if err := t.limit.wait(req.Context(), deadline); err != nil {
+			return nil, err
+		}
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		t.limit.observe(resp.Header)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+
+		delay := retryDelay(resp.Header, attempt)
+		t.limit.throttle(delay)
+		if !retryable || t.failover || attempt >= rateLimitMaxRetries || time.Now().Add(delay).After(deadline) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		t.limit.retried()
+	}
+}
+
+// retryDelay 优先使用 Retry-After (秒数或 HTTP 日期)，否则按重试次数指数退避
+func retryDelay(header http.Header, attempt int) time.Duration {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if t, err := http.ParseTime(value); err == nil {
+			if delay := time.Until(t); delay > 0 {
+				return delay
+			}
+			return 0
+		}
+	}
+	delay := rateLimitBaseDelay << attempt
+	if delay > rateLimitMaxDelay {
+		delay = rateLimitMaxDelay
+	}
+	return delay
+}
+
+// parseRateLimitHeader 解析 100;w=21600 格式的限流头，返回数量和窗口秒数
+func parseRateLimitHeader(value string) (int, int, bool) {
+	if value == "" {
+		return 0, 0, false
+	}
+	countPart, params, _ := strings.Cut(value, ";")
+	count, err := strconv.Atoi(strings.TrimSpace(countPart))
+	if err != nil {
+		return 0, 0, false
+	}
+	window := 0
+	for _, param := range strings.Split(params, ";") {
+		if name, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && name == "w" {
+			window, _ = strconv.Atoi(v)
+		}
+	}
+	return count, window, true
+}
@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseRateLimitHeader(t *testing.T) {
+	count, window, ok := parseRateLimitHeader("100;w=21600")
+	if !ok || count != 100 || window != 21600 {
+		t.Fatalf("unexpected result %d %d %v", count, window, ok)
+	}
+	if _, _, ok := parseRateLimitHeader("abc"); ok {
+		t.Fatal("expected invalid header to be rejected")
+	}
+}
+
+func TestRateLimitTransportRetries(t *testing.T) {
+	var requests, posts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		if r.Method == http.MethodPost {
+			posts.Add(1)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if requests.Add(1) < 3 {
+			w.Header().Set("RateLimit-Remaining", "0;w=21600")
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("RateLimit-Remaining", "42;w=21600")
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	tracker := newRateLimitTracker()
+	client := &http.Client{Transport: &rateLimitTransport{base: http.DefaultTransport, host: u.Host, limit: tracker.get(u.Host)}}
+	resp, err := client.Get(srv.URL + "/v2/library/app/manifests/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 after retries, got %d", resp.StatusCode)
+	}
+
+	statuses := tracker.Statuses()
+	if len(statuses) != 1 {
+		t.Fatalf("expected 1 upstream, got %d", len(statuses))
+	}
+	s := statuses[0]
+	if s.Throttled != 2 || s.Retries != 2 || s.Limit != 100 || s.Remaining != 42 || s.Window != 21600 {
+		t.Fatalf("unexpected status %+v", s)
+	}
+
+	// 只重试拉取请求
+	resp, err = client.Post(srv.URL+"/v2/library/app/blobs/uploads/", "application/octet-stream", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || posts.Load() != 1 {
+		t.Fatalf("expected push request not to be retried, got %d after %d requests", resp.StatusCode, posts.Load())
+	}
+}
@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Descriptor OCI 内容描述符
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// ReferrersIndex 引用者列表，格式为 OCI 镜像索引
+type ReferrersIndex struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// referrerFields 判断引用关系需要的清单字段
+type referrerFields struct {
+	ArtifactType string `json:"artifactType"`
+	Config       struct {
+		MediaType string `json:"mediaType"`
+	} `json:"config"`
+	Subject *struct {
+		Digest string `json:"digest"`
+	} `json:"subject"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// manifestSubject 返回清单 subject 指向的摘要，没有 subject 时返回空字符串
+func manifestSubject(data []byte) string {
+	var fields referrerFields
+	if err := json.Unmarshal(data, &fields); err != nil || fields.Subject == nil {
+		return ""
+	}
+	return fields.Subject.Digest
+}
+
+// handleReferrers 处理 GET /v2/<name>/referrers/<digest>，返回 subject 指向该摘要的清单
+// 引用者通过扫描仓库中的清单得到，支持 artifactType 过滤
+func (h *Handler) handleReferrers(c *gin.Context) {
+	repository := c.GetString("repository")
+	digest := c.GetString("digest")
+	log.Printf("处理引用者请求: repository=%s, digest=%s", repository, digest)
+
+	if c.Request.Method != http.MethodGet {
+		writeRegistryError(c.Writer, http.StatusMethodNotAllowed, errCodeUnsupported, "method not allowed")
+		return
+	}
+	if !validRepository(c.Writer, repository) {
+		return
+	}
+	if !sha256DigestPattern.MatchString(digest) {
+		writeRegistryError(c.Writer, http.StatusBadRequest, errCodeDigestInvalid, "invalid digest "+digest)
+		return
+	}
+
+	digests, err := h.storage.ListManifests(repository)
+	if err != nil {
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
+		return
+	}
+
+	artifactType := c.Query("artifactType")
+	index := ReferrersIndex{SchemaVersion: 2, MediaType: MediaTypeOCIManifestIndex, Manifests: []Descriptor{}}
+	for _, manifestDigest := range digests {
+		data, _, err := h.storage.GetManifestByDigest(repository, manifestDigest)
+		if err != nil {
+			continue
+		}
+		var fields referrerFields
+		if err := json.Unmarshal(data, &fields); err != nil || fields.Subject == nil || fields.Subject.Digest != digest {
+			continue
+		}
+
+		// 没有 artifactType 时使用配置的媒体类型
+		descriptorType := fields.ArtifactType
+		if descriptorType == "" {
+			descriptorType = fields.Config.MediaType
+		}
+		if artifactType != "" && descriptorType != artifactType {
+			continue
+		}
+		index.Manifests = append(index.Manifests, Descriptor{
+			MediaType:    detectManifestMediaType(data),
+			Digest:       manifestDigest,
+			Size:         int64(len(data)),
+			ArtifactType: descriptorType,
+			Annotations:  fields.Annotations,
+		})
+	}
+
+	if artifactType != "" {
+		c.Header("OCI-Filters-Applied", "artifactType")
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		writeRegistryError(c.Writer, http.StatusInternalServerError, errCodeUnknown, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, MediaTypeOCIManifestIndex, data)
+}
@@ -0,0 +1,62 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+func TestHandleReferrers(t *testing.T) {
+	router := NewRouter(NewHandler(storage.NewMemoryStorage()))
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	image := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:c"},"layers":[]}`
+	if w := serve(http.MethodPut, "/v2/app/manifests/v1", image); w.Code != http.StatusCreated {
+		t.Fatalf("Expected image to be stored, got %d", w.Code)
+	}
+	subject := digestOf(image)
+
+	// 制品的配置是任意媒体类型，没有声明 mediaType 时按 OCI 清单处理
+	signature := fmt.Sprintf(`{"schemaVersion":2,"artifactType":"application/vnd.dev.cosign.artifact.sig.v1+json","config":{"mediaType":"application/vnd.oci.empty.v1+json","digest":"sha256:e"},"layers":[],"subject":{"digest":%q},"annotations":{"org.example":"sig"}}`, subject)
+	sbom := fmt.Sprintf(`{"schemaVersion":2,"config":{"mediaType":"application/spdx+json","digest":"sha256:s"},"layers":[],"subject":{"digest":%q}}`, subject)
+	for _, manifest := range []string{signature, sbom} {
+		w := serve(http.MethodPut, "/v2/app/manifests/"+digestOf(manifest), manifest)
+		if w.Code != http.StatusCreated || w.Header().Get("OCI-Subject") != subject {
+			t.Fatalf("Expected OCI-Subject header, got %d %q", w.Code, w.Header().Get("OCI-Subject"))
+		}
+	}
+	if w := serve(http.MethodGet, "/v2/app/manifests/"+digestOf(sbom), ""); w.Header().Get("Content-Type") != MediaTypeOCIManifestV1 {
+		t.Fatalf("Expected artifact to be served as OCI manifest, got %q", w.Header().Get("Content-Type"))
+	}
+
+	w := serve(http.MethodGet, "/v2/app/referrers/"+subject, "")
+	var index ReferrersIndex
+	if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Unexpected referrers response %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != MediaTypeOCIManifestIndex || len(index.Manifests) != 2 {
+		t.Fatalf("Unexpected referrers %+v", index)
+	}
+
+	w = serve(http.MethodGet, "/v2/app/referrers/"+subject+"?artifactType=application/spdx%2Bjson", "")
+	index = ReferrersIndex{}
+	json.Unmarshal(w.Body.Bytes(), &index)
+	if w.Header().Get("OCI-Filters-Applied") != "artifactType" || len(index.Manifests) != 1 || index.Manifests[0].Digest != digestOf(sbom) {
+		t.Fatalf("Unexpected filtered referrers %+v", index)
+	}
+
+	// 没有引用者时返回空列表
+	w = serve(http.MethodGet, "/v2/other/referrers/"+subject, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"manifests":[]`) {
+		t.Fatalf("Expected empty referrers list, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestReloadConfigs(t *testing.T) {
+	if _, err := NewManager(config.NewMemoryConfigStore()).ReloadConfigs(); !errors.Is(err, ErrReloadNotSupported) {
+		t.Fatalf("Expected memory store reload to be unsupported, got %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "registries.json")
+	write := func(data string) {
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`[{"hostName":"docker.io","remoteUrl":"https://mirror-a.example.com"},{"hostName":"quay.io","remoteUrl":"https://quay.io"}]`)
+	store, err := config.NewFileConfigStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm := NewManager(store)
+	defer rm.Close()
+
+	cfg, _ := rm.GetConfig("docker.io")
+	handler, err := rm.GetProxyHandler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 手动修改文件：更新 docker.io，删除 quay.io，其余配置不变
+	configs, _ := store.List()
+	var rewritten []config.Config
+	for _, c := range configs {
+		full, _, _ := store.Get(c.HostName)
+		switch c.HostName {
+		case "docker.io":
+			full.RemoteURL = "https://mirror-b.example.com"
+		case "quay.io":
+			continue
+		}
+		rewritten = append(rewritten, full)
+	}
+	data, _ := json.Marshal(rewritten)
+	write(string(data))
+
+	changed, err := rm.ReloadConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"docker.io", "quay.io"}; !reflect.DeepEqual(changed, want) {
+		t.Fatalf("Expected %v to change, got %v", want, changed)
+	}
+	if _, ok := rm.GetConfig("quay.io"); ok {
+		t.Fatal("Expected quay.io to be removed")
+	}
+	cfg, _ = rm.GetConfig("docker.io")
+	if cfg.RemoteURL != "https://mirror-b.example.com" {
+		t.Fatalf("Expected updated remote URL, got %s", cfg.RemoteURL)
+	}
+	if reloaded, _ := rm.GetProxyHandler(cfg); reloaded == handler {
+		t.Fatal("Expected cached proxy handler to be invalidated")
+	}
+
+	// 无法解析的文件不影响当前配置
+	write("{")
+	if _, err := rm.ReloadConfigs(); err == nil {
+		t.Fatal("Expected invalid file to be rejected")
+	}
+	if _, ok := rm.GetConfig("docker.io"); !ok {
+		t.Fatal("Expected configs to be kept after failed reload")
+	}
+}
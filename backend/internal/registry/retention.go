@@ -0,0 +1,346 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+// DefaultRetentionInterval 保留策略默认的执行间隔
+const DefaultRetentionInterval = 24 * time.Hour
+
+// errRetentionRunning 已有保留策略在执行
+var errRetentionRunning = errors.New("retention is already running")
+
+// RetentionRule 一组仓库的保留策略
+// Repository 为仓库名，以 /* 结尾时匹配该前缀下的所有仓库，* 匹配所有仓库；
+// 多条规则匹配时精确匹配优先，其次是最长的前缀
+type RetentionRule struct {
+	Repository string `yaml:"repository" json:"repository"`
+	// KeepLastTags 按镜像创建时间保留最新的 N 个标签，0 表示不限制
+	KeepLastTags int `yaml:"keepLastTags" json:"keepLastTags"`
+	// UntaggedDays 没有标签的清单保留的天数，0 表示不删除
+	UntaggedDays int `yaml:"untaggedDays" json:"untaggedDays"`
+}
+
+// RetentionConfig 保留策略配置
+type RetentionConfig struct {
+	// Interval 执行间隔，0 使用 DefaultRetentionInterval
+	Interval time.Duration   `yaml:"interval"`
+	Rules    []RetentionRule `yaml:"rules"`
+}
+
+// LoadRetentionConfig 从 YAML 文件加载保留策略
+func LoadRetentionConfig(path string) (*RetentionConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retention config: %v", err)
+	}
+	var config RetentionConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse retention config: %v", err)
+	}
+	for _, rule := range config.Rules {
+		prefix, isPattern := strings.CutSuffix(rule.Repository, "*")
+		if rule.Repository == "" || (isPattern && prefix != "" && !strings.HasSuffix(prefix, "/")) || strings.Contains(prefix, "*") {
+			return nil, fmt.Errorf("invalid repository pattern %q", rule.Repository)
+		}
+		if rule.KeepLastTags < 0 || rule.UntaggedDays < 0 {
+			return nil, fmt.Errorf("invalid retention rule for %q", rule.Repository)
+		}
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultRetentionInterval
+	}
+	return &config, nil
+}
+
+// RetentionResult 一次执行删除的内容，DryRun 时为将被删除的内容
+type RetentionResult struct {
+	DryRun bool `json:"dryRun"`
+	// Tags 删除的标签，格式为 <repository>:<tag>
+	Tags []string `json:"tags"`
+	// Manifests 删除的无标签清单，格式为 <repository>@<digest>
+	Manifests []string `json:"manifests"`
+}
+
+// RetentionStatus 最近一次执行的状态
+type RetentionStatus struct {
+	LastRun *time.Time       `json:"lastRun,omitempty"`
+	Result  *RetentionResult `json:"result,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// Retention 按规则删除旧标签和过期的无标签清单，然后启动垃圾回收清理 blob。
+// 存储不记录推送时间，标签按镜像配置中的创建时间排序；
+// 清单没有标签的时间从第一次被发现时开始计算，只保存在内存中，重启后重新计算，不会提前删除
+type Retention struct {
+	store storage.Storage
+	rules []RetentionRule
+	gc    *GarbageCollector
+	now   func() time.Time
+
+	run      sync.Mutex
+	mu       sync.Mutex
+	untagged map[string]time.Time // <repository>@<digest> -> 第一次发现没有标签的时间
+	status   RetentionStatus
+}
+
+// NewRetention 创建保留策略，gc 不为空且存储支持垃圾回收宽限期时在删除后启动垃圾回收
+func NewRetention(store storage.Storage, rules []RetentionRule, gc *GarbageCollector) *Retention {
+	return &Retention{
+		store:    store,
+		rules:    rules,
+		gc:       gc,
+		now:      time.Now,
+		untagged: make(map[string]time.Time),
+	}
+}
+
+// Run 按间隔执行保留策略，直到 ctx 结束
+func (r *Retention) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Apply(ctx, false); err != nil {
+				log.Printf("Retention failed: %v", err)
+			}
+		}
+	}
+}
+
+// Apply 执行一次保留策略，dryRun 时只返回将被删除的内容。
+// 预览不包含因删除标签才变成无标签的清单，这些清单在之后的执行中才开始计时
+func (r *Retention) Apply(ctx context.Context, dryRun bool) (*RetentionResult, error) {
+	if !r.run.TryLock() {
+		return nil, errRetentionRunning
+	}
+	defer r.run.Unlock()
+
+	result, retained, err := r.apply(ctx, dryRun)
+
+	r.mu.Lock()
+	now := r.now()
+	r.status = RetentionStatus{LastRun: &now, Result: result}
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return result, err
+	}
+
+	if !dryRun && r.gc != nil && len(result.Tags)+len(result.Manifests) > 0 {
+		if GracePeriodSupported(r.store) {
+			// 宽限期内的无标签清单作为根保留，避免被垃圾回收提前删除
+			err := r.gc.Start(context.Background(), GCOptions{Retain: func(repository, digest string) bool {
+				return retained[repository+"@"+digest]
+			}})
+			if err != nil {
+				log.Printf("Failed to start garbage collection after retention: %v", err)
+			}
+		} else {
+			// 回收可能删除推送中的镜像的 blob，需要在没有推送时手动执行
+			log.Printf("Skipping garbage collection after retention: storage cannot report modification times")
+		}
+	}
+	log.Printf("Retention finished: %d tags, %d manifests deleted (dry run: %v)", len(result.Tags), len(result.Manifests), dryRun)
+	return result, nil
+}
+
+// apply 返回执行结果和仍在宽限期内的无标签清单
+func (r *Retention) apply(ctx context.Context, dryRun bool) (*RetentionResult, map[string]bool, error) {
+	result := &RetentionResult{DryRun: dryRun, Tags: []string{}, Manifests: []string{}}
+	retained := make(map[string]bool)
+
+	repositories, err := r.store.ListRepositories()
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to list repositories: %v", err)
+	}
+
+	now := r.now()
+	seen := make(map[string]bool)
+	for _, repository := range repositories {
+		if err := ctx.Err(); err != nil {
+			return result, nil, err
+		}
+		rule, ok := matchRetentionRule(r.rules, repository)
+		if !ok {
+			continue
+		}
+
+		if rule.KeepLastTags > 0 {
+			expired, err := r.expiredTags(repository, rule.KeepLastTags)
+			if err != nil {
+				return result, nil, err
+			}
+			for _, tag := range expired {
+				if !dryRun {
+					if err := r.store.DeleteTag(repository, tag); err != nil {
+						return result, nil, fmt.Errorf("failed to delete tag %s:%s: %v", repository, tag, err)
+					}
+				}
+				result.Tags = append(result.Tags, repository+":"+tag)
+			}
+		}
+
+		if rule.UntaggedDays > 0 {
+			// 垃圾回收会删除的清单就是没有被标签直接或间接引用的清单
+			manifests, _, err := markRepository(r.store, repository, nil)
+			if err != nil {
+				return result, nil, err
+			}
+			grace := time.Duration(rule.UntaggedDays) * 24 * time.Hour
+			for _, digest := range manifests {
+				key := repository + "@" + digest
+				seen[key] = true
+
+				r.mu.Lock()
+				since, ok := r.untagged[key]
+				if !ok {
+					since = now
+					r.untagged[key] = now
+				}
+				r.mu.Unlock()
+
+				if now.Sub(since) < grace {
+					retained[key] = true
+					continue
+				}
+				if !dryRun {
+					if err := r.store.DeleteManifest(repository, digest); err != nil {
+						return result, nil, fmt.Errorf("failed to delete manifest %s: %v", key, err)
+					}
+				}
+				result.Manifests = append(result.Manifests, key)
+			}
+		}
+	}
+
+	// 不再是无标签的清单 (重新打了标签或已被删除) 不再计时
+	r.mu.Lock()
+	for key := range r.untagged {
+		if !seen[key] {
+			delete(r.untagged, key)
+		}
+	}
+	r.mu.Unlock()
+	return result, retained, nil
+}
+
+// expiredTags 返回超过保留数量的标签，标签按镜像创建时间从新到旧排序，
+// 没有创建时间的清单 (例如清单列表) 排在最后，时间相同时按标签名倒序
+func (r *Retention) expiredTags(repository string, keep int) ([]string, error) {
+	tags, err := r.store.ListTags(repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %v", repository, err)
+	}
+	if len(tags) <= keep {
+		return nil, nil
+	}
+
+	created := make(map[string]time.Time, len(tags))
+	for _, tag := range tags {
+		manifest, _, err := r.store.GetManifest(repository, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve tag %s:%s: %v", repository, tag, err)
+		}
+		created[tag] = r.imageCreated(repository, manifest)
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		ti, tj := created[tags[i]], created[tags[j]]
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return tags[i] > tags[j]
+	})
+	return tags[keep:], nil
+}
+
+// imageCreated 从镜像配置读取创建时间，读取失败时返回零值
+func (r *Retention) imageCreated(repository string, manifest []byte) time.Time {
+	var parsed gcManifest
+	if err := json.Unmarshal(manifest, &parsed); err != nil || parsed.Config.Digest == "" {
+		return time.Time{}
+	}
+	blob, _, err := r.store.GetBlob(repository, parsed.Config.Digest)
+	if err != nil {
+		return time.Time{}
+	}
+	defer blob.Close()
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+	if err := json.NewDecoder(io.LimitReader(blob, 4<<20)).Decode(&config); err != nil {
+		return time.Time{}
+	}
+	return config.Created
+}
+
+// matchRetentionRule 返回仓库适用的规则，精确匹配优先，其次是最长的 /* 前缀，最后是 *
+func matchRetentionRule(rules []RetentionRule, repository string) (RetentionRule, bool) {
+	var best RetentionRule
+	found := false
+	for _, rule := range rules {
+		if rule.Repository == repository {
+			return rule, true
+		}
+		prefix, isPattern := strings.CutSuffix(rule.Repository, "*")
+		if !isPattern || !strings.HasPrefix(repository, prefix) {
+			continue
+		}
+		if !found || len(rule.Repository) > len(best.Repository) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+// Status 返回最近一次执行的状态
+func (r *Retention) Status() RetentionStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// ServeHTTP 实现管理接口：GET 查询最近一次执行的状态，POST 立即执行，?dryRun=true 时只预览不删除
+func (r *Retention) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Status())
+	case http.MethodPost:
+		dryRun, _ := strconv.ParseBool(req.URL.Query().Get("dryRun"))
+		result, err := r.Apply(context.Background(), dryRun)
+		if errors.Is(err, errRetentionRunning) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
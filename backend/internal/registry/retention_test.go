@@ -0,0 +1,63 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+func TestRetention(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	// 标签名顺序与创建时间相反，验证按创建时间保留
+	for i, tag := range []string{"c", "b", "a"} {
+		config := fmt.Sprintf(`{"created":"2026-0%d-01T00:00:00Z"}`, i+1)
+		store.PutBlob("app", digestOf(config), strings.NewReader(config))
+		manifest := fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":%q},"layers":[]}`, digestOf(config))
+		store.PutManifest("app", tag, digestOf(manifest), []byte(manifest))
+	}
+	untagged := `{"schemaVersion":2,"layers":[]}`
+	store.PutManifest("app", digestOf(untagged), digestOf(untagged), []byte(untagged))
+	store.PutManifest("other", "v1", "sha256:other", []byte(`{"schemaVersion":2}`))
+
+	gc := NewGarbageCollector(store)
+	retention := NewRetention(store, []RetentionRule{{Repository: "*", KeepLastTags: 2, UntaggedDays: 1}, {Repository: "other"}}, gc)
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	retention.now = func() time.Time { return now }
+
+	// 预览不删除，无标签清单从第一次发现开始计时
+	result, err := retention.Apply(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Tags, ",") != "app:c" || len(result.Manifests) != 0 {
+		t.Fatalf("Unexpected preview %+v", result)
+	}
+	if tags, _ := store.ListTags("app"); len(tags) != 3 {
+		t.Fatalf("Dry run deleted tags: %v", tags)
+	}
+
+	now = now.Add(48 * time.Hour)
+	result, err = retention.Apply(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Tags, ",") != "app:c" || strings.Join(result.Manifests, ",") != "app@"+digestOf(untagged) {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	for deadline := time.Now().Add(5 * time.Second); gc.Status().Running || gc.Status().Result == nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("Garbage collection did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 刚失去标签的清单仍在宽限期内，垃圾回收不会删除
+	manifests, _ := store.ListManifests("app")
+	if tags, _ := store.ListTags("app"); strings.Join(tags, ",") != "a,b" || len(manifests) != 3 {
+		t.Fatalf("Unexpected repository state: tags %v, manifests %v, gc %+v", tags, manifests, gc.Status())
+	}
+}
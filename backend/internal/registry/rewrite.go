@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+// repositoryRewriter 按配置的规则改写请求路径中的仓库名称
+type repositoryRewriter struct {
+	rules []compiledRewriteRule
+}
+
+type compiledRewriteRule struct {
+	config.RewriteRule
+	re *regexp.Regexp
+}
+
+// newRepositoryRewriter 编译改写规则，没有规则时返回 nil
+func newRepositoryRewriter(rules []config.RewriteRule) (*repositoryRewriter, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	rw := &repositoryRewriter{}
+	for i, rule := range rules {
+		if rule.Match == "" {
+			return nil, errors.New("rewrite rule match must not be empty")
+		}
+		compiled := compiledRewriteRule{RewriteRule: rule}
+		if rule.Regex {
+			re, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rewrite rule %d: %v", i, err)
+			}
+			compiled.re = re
+		}
+		rw.rules = append(rw.rules, compiled)
+	}
+	return rw, nil
+}
+
+// repository 返回改写后的仓库名称，没有规则匹配时返回原名称
+func (rw *repositoryRewriter) repository(name string) string {
+	if rw == nil {
+		return name
+	}
+	for _, rule := range rw.rules {
+		if rule.re != nil {
+			if rule.re.MatchString(name) {
+				return rule.re.ReplaceAllString(name, rule.Replace)
+			}
+			continue
+		}
+		if strings.HasPrefix(name, rule.Match) {
+			return rule.Replace + strings.TrimPrefix(name, rule.Match)
+		}
+	}
+	return name
+}
+
+// rewritePath 改写 /v2/<name>/{manifests,blobs,tags,referrers}/... 中的仓库名称，其他路径不变
+func (rw *repositoryRewriter) rewritePath(path string) string {
+	if rw == nil {
+		return path
+	}
+	name, rest, ok := splitRepositoryPath(path)
+	if !ok {
+		return path
+	}
+	rewritten := rw.repository(name)
+	if rewritten == name {
+		return path
+	}
+	log.Printf("Rewriting repository %s -> %s", name, rewritten)
+	return "/v2/" + rewritten + "/" + rest
+}
+
+// splitRepositoryPath 将 /v2/ 下的路径拆分为仓库名称和之后的部分
+// 支持 <name>/{manifests,blobs,tags,referrers}/<x> 和 <name>/blobs/uploads/<uuid>，仓库名称本身可以包含这些单词
+func splitRepositoryPath(path string) (string, string, bool) {
+	trimmed := strings.TrimPrefix(path, "/v2/")
+	if trimmed == path {
+		return "", "", false
+	}
+	parts := strings.Split(trimmed, "/")
+	n := len(parts)
+	i := -1
+	switch {
+	case n >= 4 && parts[n-3] == "blobs" && parts[n-2] == "uploads":
+		i = n - 3
+	case n >= 3:
+		switch parts[n-2] {
+		case "manifests", "blobs", "tags", "referrers":
+			i = n - 2
+		}
+	}
+	if i < 1 {
+		return "", "", false
+	}
+	return strings.Join(parts[:i], "/"), strings.Join(parts[i:], "/"), true
+}
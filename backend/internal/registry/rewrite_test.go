@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestRepositoryRewriter(t *testing.T) {
+	rw, err := newRepositoryRewriter([]config.RewriteRule{
+		{Match: "library/", Replace: "mycorp/mirror/"},
+		{Match: `^bitnami/(.+)$`, Replace: "mycorp/bitnami-$1", Regex: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"/v2/library/nginx/manifests/latest":  "/v2/mycorp/mirror/nginx/manifests/latest",
+		"/v2/library/nginx/blobs/uploads/abc": "/v2/mycorp/mirror/nginx/blobs/uploads/abc",
+		"/v2/bitnami/redis/tags/list":         "/v2/mycorp/bitnami-redis/tags/list",
+		"/v2/other/app/manifests/blobs":       "/v2/other/app/manifests/blobs",
+		"/v2/library/manifests/manifests/v1":  "/v2/mycorp/mirror/manifests/manifests/v1",
+		"/v2/":                                "/v2/",
+	}
+	for path, want := range cases {
+		if got := rw.rewritePath(path); got != want {
+			t.Errorf("rewritePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+
+	if _, err := newRepositoryRewriter([]config.RewriteRule{{Match: "(", Regex: true}}); err == nil {
+		t.Fatal("expected invalid regex to be rejected")
+	}
+}
+
+func TestProxyAppliesRewrite(t *testing.T) {
+	var gotPath string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+	}))
+	defer upstream.Close()
+
+	handler, err := newRegistryProxyHandler(config.Config{
+		HostName:  "docker.io",
+		RemoteURL: upstream.URL,
+		Rewrites:  []config.RewriteRule{{Match: "library/", Replace: "mycorp/mirror/"}},
+	}, nil, newUpstreamTrackers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v2/library/nginx/manifests/latest", nil))
+	if gotPath != "/v2/mycorp/mirror/nginx/manifests/latest" {
+		t.Fatalf("unexpected upstream path %q", gotPath)
+	}
+}
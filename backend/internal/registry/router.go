@@ -50,6 +50,12 @@ func (router *Router) registerRoutes() {
 	router.engine.NoRoute(func(c *gin.Context) {
 		path := c.Request.URL.Path
 
+		// 内置令牌服务
+		if path == registryTokenPath && router.handler.auth != nil {
+			router.handler.auth.ServeHTTP(c.Writer, c.Request)
+			return
+		}
+
 		// 确保是/v2开头的路径
 		if !strings.HasPrefix(path, "/v2") {
 			c.String(http.StatusNotFound, "404 page not found")
@@ -58,12 +64,18 @@ func (router *Router) registerRoutes() {
 
 		// 处理API版本检查
 		if path == "/v2/" || path == "/v2" {
+			if !router.handler.authorize(c, "", "", "", "") {
+				return
+			}
 			router.handler.handleVersionCheck(c)
 			return
 		}
 
 		// 处理仓库目录
 		if path == "/v2/_catalog" || path == "/v2/_catalog/" {
+			if !router.handler.authorize(c, "registry", "catalog", "*", "*") {
+				return
+			}
 			router.handler.handleCatalog(c)
 			return
 		}
@@ -72,7 +84,20 @@ func (router *Router) registerRoutes() {
 		subPath := strings.TrimPrefix(path, "/v2/")
 		parts := strings.Split(subPath, "/")
 		if len(parts) < 2 {
-			c.String(http.StatusNotFound, "404 page not found")
+			writeRegistryError(c.Writer, http.StatusNotFound, errCodeUnsupported, "unsupported endpoint "+path)
+			return
+		}
+
+		// 处理引用者列表: /v2/{name}/referrers/{digest}
+		if segments := strings.Split(strings.Trim(subPath, "/"), "/"); len(segments) >= 3 && segments[len(segments)-2] == "referrers" {
+			repository := strings.Join(segments[:len(segments)-2], "/")
+			c.Set("repository", repository)
+			c.Set("digest", segments[len(segments)-1])
+
+			if !router.handler.authorizeRepository(c, repository) {
+				return
+			}
+			router.handler.handleReferrers(c)
 			return
 		}
 
@@ -102,6 +127,9 @@ func (router *Router) registerRoutes() {
 			c.Set("repository", repository)
 			c.Set("reference", reference)
 
+			if !router.handler.authorizeRepository(c, repository) {
+				return
+			}
 			router.handler.handleManifests(c)
 			return
 		}
@@ -113,10 +141,26 @@ func (router *Router) registerRoutes() {
 			log.Printf("解析标签列表请求: 仓库=%s", repository)
 			c.Set("repository", repository)
 
+			if !router.handler.authorizeRepository(c, repository) {
+				return
+			}
 			router.handler.handleListTags(c)
 			return
 		}
 
+		// 处理标签删除: /v2/{name}/tags/{tag}
+		if tagsIndex > 0 && tagsIndex+1 < len(parts) && parts[tagsIndex+1] != "" {
+			repository := strings.Join(parts[:tagsIndex], "/")
+			c.Set("repository", repository)
+			c.Set("reference", parts[tagsIndex+1])
+
+			if !router.handler.authorizeRepository(c, repository) {
+				return
+			}
+			router.handler.handleDeleteTag(c)
+			return
+		}
+
 		// 处理Blob操作: /v2/{name}/blobs/{digest} 或上传操作
 		if blobsIndex > 0 {
 			repository := strings.Join(parts[:blobsIndex], "/")
@@ -128,6 +172,9 @@ func (router *Router) registerRoutes() {
 					log.Printf("解析上传初始化请求: 仓库=%s", repository)
 					c.Set("repository", repository)
 
+					if !router.handler.authorizeRepository(c, repository) {
+						return
+					}
 					router.handler.handleInitiateUpload(c)
 					return
 				} else if blobsIndex+2 < len(parts) {
@@ -138,6 +185,9 @@ func (router *Router) registerRoutes() {
 					c.Set("repository", repository)
 					c.Set("uuid", uuid)
 
+					if !router.handler.authorizeRepository(c, repository) {
+						return
+					}
 					router.handler.handleUpload(c)
 					return
 				}
@@ -149,13 +199,16 @@ func (router *Router) registerRoutes() {
 				c.Set("repository", repository)
 				c.Set("digest", digest)
 
+				if !router.handler.authorizeRepository(c, repository) {
+					return
+				}
 				router.handler.handleBlobs(c)
 				return
 			}
 		}
 
 		// 如果没有匹配的路由，返回404
-		c.String(http.StatusNotFound, "404 page not found")
+		writeRegistryError(c.Writer, http.StatusNotFound, errCodeUnsupported, "unsupported endpoint "+path)
 	})
 }
 
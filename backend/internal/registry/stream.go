@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"io"
+	"log"
+	"sync"
+)
+
+// copyBufferSize 流式复制使用的缓冲区大小
+const copyBufferSize = 32 * 1024
+
+// bufferPool 复用流式复制的缓冲区，实现 httputil.BufferPool，代理和缓存共用
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func newBufferPool(size int) *bufferPool {
+	return &bufferPool{pool: sync.Pool{New: func() any {
+		buf := make([]byte, size)
+		return &buf
+	}}}
+}
+
+func (p *bufferPool) Get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+func (p *bufferPool) Put(buf []byte) {
+	if cap(buf) < copyBufferSize {
+		return
+	}
+	buf = buf[:cap(buf)]
+	p.pool.Put(&buf)
+}
+
+// streamBuffers 全局的缓冲区池
+var streamBuffers = newBufferPool(copyBufferSize)
+
+// copyStream 使用池化的缓冲区把 src 复制到 dst
+func copyStream(dst io.Writer, src io.Reader) (int64, error) {
+	buf := streamBuffers.Get()
+	defer streamBuffers.Put(buf)
+	return io.CopyBuffer(dst, src, buf)
+}
+
+// transferLogger 原样透传响应体并统计字节数，读取结束时记录一次日志
+// 不做额外缓冲，Read 返回的数据和错误与底层读取器完全一致
+type transferLogger struct {
+	io.ReadCloser
+	path   string
+	size   int64
+	read   int64
+	logged bool
+}
+
+func (t *transferLogger) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.read += int64(n)
+	if err != nil && !t.logged {
+		t.logged = true
+		if err == io.EOF {
+			log.Printf("Transfer complete for %s: %.2f MB", t.path, float64(t.read)/(1024*1024))
+		} else {
+			log.Printf("Transfer failed for %s after %d of %d bytes: %v", t.path, t.read, t.size, err)
+		}
+	}
+	return n, err
+}
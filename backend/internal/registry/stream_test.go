@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestTransferLoggerKeepsDataReturnedWithEOF(t *testing.T) {
+	// DataErrReader 在最后一次读取时同时返回数据和 io.EOF
+	body := &transferLogger{ReadCloser: io.NopCloser(iotest.DataErrReader(strings.NewReader("hello world"))), size: 11}
+	data, err := io.ReadAll(body)
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("unexpected read %q %v", data, err)
+	}
+}
+
+// newBlobUpstream 返回固定内容的上游，用于验证大文件代理
+func newBlobUpstream(size int) (*httptest.Server, []byte) {
+	blob := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(blob)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+	}))
+	return server, blob
+}
+
+func TestProxyStreamsLargeBlob(t *testing.T) {
+	upstream, blob := newBlobUpstream(16<<20 + 123)
+	defer upstream.Close()
+	handler, err := NewRegistryProxyHandler(config.Config{HostName: "registry.test", RemoteURL: upstream.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/v2/library/app/blobs/sha256:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	hash := sha256.New()
+	n, err := io.Copy(hash, resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(blob)) || !bytes.Equal(hash.Sum(nil), sha256Sum(blob)) {
+		t.Fatalf("blob corrupted: got %d bytes, want %d", n, len(blob))
+	}
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func BenchmarkProxyLargeBlob(b *testing.B) {
+	upstream, blob := newBlobUpstream(64 << 20)
+	defer upstream.Close()
+	handler, err := NewRegistryProxyHandler(config.Config{HostName: "registry.test", RemoteURL: upstream.URL})
+	if err != nil {
+		b.Fatal(err)
+	}
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	b.SetBytes(int64(len(blob)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := http.Get(proxy.URL + "/v2/library/app/blobs/sha256:test")
+		if err != nil {
+			b.Fatal(err)
+		}
+		n, err := io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err != nil || n != int64(len(blob)) {
+			b.Fatalf("short read %d: %v", n, err)
+		}
+	}
+}
+
+func BenchmarkCopyStream(b *testing.B) {
+	data := make([]byte, 64<<20)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// 隐藏 WriterTo 和 ReaderFrom，走缓冲区复制路径
+		copyStream(struct{ io.Writer }{io.Discard}, struct{ io.Reader }{bytes.NewReader(data)})
+	}
+}
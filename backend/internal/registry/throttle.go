@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/smartcat999/container-ui/internal/ratelimit"
+)
+
+// connLimitTransport 限制发往上游的并发请求数，响应体关闭后释放名额
+type connLimitTransport struct {
+	base http.RoundTripper
+	host string
+	sem  chan struct{}
+}
+
+// newConnLimitTransport max 小于等于 0 时不限制，直接返回 base
+func newConnLimitTransport(base http.RoundTripper, host string, max int) http.RoundTripper {
+	if max <= 0 {
+		return base
+	}
+	return &connLimitTransport{base: base, host: host, sem: make(chan struct{}, max)}
+}
+
+func (t *connLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// 令牌服务等其他主机的请求不占用名额
+	if req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+	select {
+	case t.sem <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		<-t.sem
+		return nil, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: func() { <-t.sem }}
+	return resp, nil
+}
+
+// releaseOnClose 响应体第一次关闭时释放并发名额
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// throttle 为响应加上带宽限制：单个请求的限制、每个客户端 IP 的限制和全局限制同时生效
+func (rm *Manager) throttle(next http.Handler, requestBandwidth int64) http.Handler {
+	if requestBandwidth <= 0 && rm.bandwidth == nil && rm.clientBandwidth == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writer := ratelimit.NewWriter(r.Context(), w,
+			ratelimit.NewBandwidth(requestBandwidth),
+			rm.clientBandwidth.Get(ratelimit.RemoteIP(r)),
+			rm.bandwidth)
+		next.ServeHTTP(&throttledResponseWriter{ResponseWriter: w, writer: writer}, r)
+	})
+}
+
+// throttledResponseWriter 响应体经过带宽限制后写出
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	writer *ratelimit.Writer
+}
+
+func (w *throttledResponseWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+func (w *throttledResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层的 ResponseWriter
+func (w *throttledResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
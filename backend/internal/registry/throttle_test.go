@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestMaxConnections(t *testing.T) {
+	var active, peak atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	handler, err := NewRegistryProxyHandler(config.Config{HostName: "registry.test", RemoteURL: upstream.URL, MaxConnections: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v2/library/app/manifests/latest", nil))
+		}()
+	}
+	wg.Wait()
+	if got := peak.Load(); got != 2 {
+		t.Fatalf("expected at most 2 concurrent upstream requests, got %d", got)
+	}
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	blob := bytes.Repeat([]byte("x"), 96*1024)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(blob)
+	}))
+	defer upstream.Close()
+
+	rm := NewManager(config.NewMemoryConfigStore())
+	cfg := config.Config{HostName: "registry.test", RemoteURL: upstream.URL, BandwidthLimit: 64 * 1024}
+	handler, err := rm.GetProxyHandler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 突发允许一秒的流量，剩余的 32KB 需要约 500ms
+	start := time.Now()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/library/app/blobs/sha256:test", nil))
+	if w.Body.Len() != len(blob) {
+		t.Fatalf("expected %d bytes, got %d", len(blob), w.Body.Len())
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("response was not throttled, took %v", elapsed)
+	}
+}
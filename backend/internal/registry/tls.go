@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+// tlsVersions MinVersion 支持的取值
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// readPEM 读取 PEM 内容，value 可以是文件路径或直接填写的 PEM 文本
+func readPEM(value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value)
+}
+
+// newUpstreamTLSConfig 根据配置构建连接上游的 TLS 客户端配置，默认使用系统根证书校验
+func newUpstreamTLSConfig(c *config.UpstreamTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c == nil {
+		return tlsConfig, nil
+	}
+	tlsConfig.InsecureSkipVerify = c.InsecureSkipVerify
+
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[strings.TrimPrefix(c.MinVersion, "TLS")]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tls min version %q", c.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if c.CACert != "" {
+		caPEM, err := readPEM(c.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls ca certificate: %v", err)
+		}
+		// 在系统根证书的基础上追加，同一配置中的公共镜像仍然可以校验
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("failed to parse tls ca certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (c.Cert == "") != (c.Key == "") {
+		return nil, fmt.Errorf("tls client certificate and key must be provided together")
+	}
+	if c.Cert != "" {
+		certPEM, err := readPEM(c.Cert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls client certificate: %v", err)
+		}
+		keyPEM, err := readPEM(c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls client key: %v", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
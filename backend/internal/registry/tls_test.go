@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestUpstreamTLS(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}))
+
+	tests := []struct {
+		name string
+		tls  *config.UpstreamTLSConfig
+		want int
+	}{
+		{"verify by default", nil, http.StatusBadGateway},
+		{"custom ca", &config.UpstreamTLSConfig{CACert: caPEM}, http.StatusOK},
+		{"skip verify", &config.UpstreamTLSConfig{InsecureSkipVerify: true}, http.StatusOK},
+		{"min version 1.3", &config.UpstreamTLSConfig{CACert: caPEM, MinVersion: "1.3"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := NewRegistryProxyHandler(config.Config{HostName: "registry.test", RemoteURL: upstream.URL, TLS: tt.tls})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/", nil))
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+
+	if _, err := newUpstreamTLSConfig(&config.UpstreamTLSConfig{MinVersion: "1.4"}); err == nil {
+		t.Fatal("expected error for unsupported tls version")
+	}
+	if _, err := newUpstreamTLSConfig(&config.UpstreamTLSConfig{Cert: caPEM}); err == nil {
+		t.Fatal("expected error for certificate without key")
+	}
+}
@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcat999/container-ui/internal/auth"
+)
+
+// registryTokenPath 内置令牌服务的路径，没有配置 AuthRealm 时由仓库服务器自己签发令牌
+const registryTokenPath = "/auth/token"
+
+// registryClaimsKey 认证通过的令牌声明在 gin 上下文中的键
+const registryClaimsKey = "registryClaims"
+
+// requestActions 返回请求需要的操作以及质询中请求的操作
+// 推送时客户端需要同时拉取已有的 blob，因此质询中请求 pull,push
+func requestActions(method string) (string, string) {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return "pull", "pull"
+	case http.MethodDelete:
+		return "delete", "delete"
+	default:
+		return "push", "pull,push"
+	}
+}
+
+// authorize 校验请求携带的仓库令牌，未启用认证时直接放行
+// resourceType 为空时只要求令牌有效，用于 /v2/ 的登录检查
+// 没有令牌或令牌无效时返回 401 和 Bearer 质询，客户端据此到令牌服务换取令牌
+func (h *Handler) authorize(c *gin.Context, resourceType, name, action, scopeActions string) bool {
+	if h.auth == nil {
+		return true
+	}
+
+	scope := ""
+	if resourceType != "" {
+		scope = fmt.Sprintf("%s:%s:%s", resourceType, name, scopeActions)
+	}
+
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found || token == "" {
+		h.challenge(c, scope, "")
+		return false
+	}
+	claims, err := h.auth.Verify(token)
+	if err != nil {
+		h.challenge(c, scope, "invalid_token")
+		return false
+	}
+	if resourceType != "" && !claims.Allows(resourceType, name, action) {
+		h.challenge(c, scope, "insufficient_scope")
+		return false
+	}
+	c.Set(registryClaimsKey, claims)
+	return true
+}
+
+// authorizeRepository 按请求方法校验仓库的访问权限
+func (h *Handler) authorizeRepository(c *gin.Context, repository string) bool {
+	action, scopeActions := requestActions(c.Request.Method)
+	return h.authorize(c, "repository", repository, action, scopeActions)
+}
+
+// canPull 判断已认证的请求能否拉取另一个仓库，用于跨仓库挂载 blob
+func (h *Handler) canPull(c *gin.Context, repository string) bool {
+	if h.auth == nil {
+		return true
+	}
+	claims, ok := c.Get(registryClaimsKey)
+	return ok && claims.(auth.RegistryClaims).Allows("repository", repository, "pull")
+}
+
+// visibleRepositories 过滤掉令牌持有者不能拉取的仓库，私有仓库不出现在仓库目录中
+func (h *Handler) visibleRepositories(c *gin.Context, repositories []string) []string {
+	if h.auth == nil {
+		return repositories
+	}
+	claims, ok := c.Get(registryClaimsKey)
+	if !ok {
+		return nil
+	}
+	visible := make([]string, 0, len(repositories))
+	for _, repository := range repositories {
+		if h.auth.CanPull(claims.(auth.RegistryClaims), repository) {
+			visible = append(visible, repository)
+		}
+	}
+	return visible
+}
+
+// challenge 返回 401 和 WWW-Authenticate 质询
+func (h *Handler) challenge(c *gin.Context, scope, reason string) {
+	challenge := fmt.Sprintf(`Bearer realm=%q,service=%q`, h.realm(c.Request), h.auth.Service())
+	if scope != "" {
+		challenge += fmt.Sprintf(`,scope=%q`, scope)
+	}
+	if reason != "" {
+		challenge += fmt.Sprintf(`,error=%q`, reason)
+	}
+	c.Header("WWW-Authenticate", challenge)
+
+	code, message := errCodeUnauthorized, "authentication required"
+	if reason == "insufficient_scope" {
+		code, message = errCodeDenied, "requested access to the resource is denied"
+	}
+	writeRegistryError(c.Writer, http.StatusUnauthorized, code, message)
+}
+
+// realm 返回令牌服务地址，未配置时使用仓库服务器自身的令牌接口
+func (h *Handler) realm(r *http.Request) string {
+	if h.authRealm != "" {
+		return h.authRealm
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + registryTokenPath
+}
@@ -0,0 +1,162 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/smartcat999/container-ui/internal/auth"
+	"github.com/smartcat999/container-ui/internal/config"
+	"github.com/smartcat999/container-ui/internal/storage"
+)
+
+func TestTokenAuth(t *testing.T) {
+	entry, err := auth.HtpasswdEntry("ci", "ci-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(path, []byte(entry+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	htpasswd, err := auth.LoadHtpasswd(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := auth.NewRegistryTokenService(htpasswd, []byte("0123456789abcdef0123456789abcdef"), auth.RegistryTokenOptions{})
+	router := NewRouter(NewHandlerWithOptions(storage.NewMemoryStorage(), HandlerOptions{Auth: tokens}))
+
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"schemaVersion":2}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	fetchToken := func(username, password, scope string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/auth/token?service="+auth.DefaultRegistryService+"&scope="+scope, nil)
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp auth.RegistryTokenResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Token
+	}
+
+	// 没有令牌时返回质询
+	w := serve(http.MethodPut, "/v2/app/manifests/v1", "")
+	want := `Bearer realm="http://example.com/auth/token",service="container-ui-registry",scope="repository:app:pull,push"`
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != want {
+		t.Fatalf("Expected challenge, got %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+
+	if code, _ := fetchToken("ci", "wrong-password", "repository:app:pull,push"); code != http.StatusUnauthorized {
+		t.Fatalf("Expected invalid credentials to be rejected, got %d", code)
+	}
+	code, token := fetchToken("ci", "ci-password", "repository:app:pull,push")
+	if code != http.StatusOK || token == "" {
+		t.Fatalf("Expected token, got %d", code)
+	}
+	if w := serve(http.MethodPut, "/v2/app/manifests/v1", token); w.Code != http.StatusCreated {
+		t.Fatalf("Expected push with token, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodGet, "/v2/app/manifests/v1", token); w.Code != http.StatusOK {
+		t.Fatalf("Expected pull with token, got %d", w.Code)
+	}
+
+	// 令牌只对请求的仓库有效
+	w = serve(http.MethodGet, "/v2/other/manifests/v1", token)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`) {
+		t.Fatalf("Expected insufficient scope, got %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+
+	// 匿名令牌没有任何权限
+	if _, anonymous := fetchToken("", "", "repository:app:pull"); serve(http.MethodGet, "/v2/app/manifests/v1", anonymous).Code != http.StatusUnauthorized {
+		t.Fatal("Expected anonymous pull to be denied")
+	}
+	if w := serve(http.MethodGet, "/v2/", "forged."+token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected invalid token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestTokenAuthACL(t *testing.T) {
+	users := config.NewMemoryUserStore()
+	for username, role := range map[string]string{"alice": auth.RoleOperator, "bob": auth.RoleOperator} {
+		hash, err := auth.HashPassword(username + "-password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		users.Put(config.User{Username: username, PasswordHash: hash, Role: role})
+	}
+	acls := config.NewMemoryACLStore()
+	acls.Put(config.RepositoryACL{Repository: "public/app", Public: true})
+	acls.Put(config.RepositoryACL{Repository: "team-a/*", Push: []string{"alice"}})
+
+	tokens := auth.NewRegistryTokenService(auth.NewUserCredentials(users), []byte("0123456789abcdef0123456789abcdef"), auth.RegistryTokenOptions{
+		Authorize: auth.ACLRegistryAuthorizer(acls),
+	})
+	store := storage.NewMemoryStorage()
+	for _, repository := range []string{"public/app", "team-a/api", "shared"} {
+		store.PutManifest(repository, "v1", "sha256:abc", []byte(`{"schemaVersion":2}`))
+	}
+	router := NewRouter(NewHandlerWithOptions(store, HandlerOptions{Auth: tokens}))
+
+	// 返回用户对每个 scope 获得的操作
+	granted := func(username string, scopes ...string) map[string][]string {
+		query := "?service=" + auth.DefaultRegistryService
+		for _, scope := range scopes {
+			query += "&scope=" + scope
+		}
+		req := httptest.NewRequest(http.MethodGet, "/auth/token"+query, nil)
+		if username != "" {
+			req.SetBasicAuth(username, username+"-password")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp auth.RegistryTokenResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		claims, err := tokens.Verify(resp.Token)
+		if err != nil {
+			t.Fatalf("Invalid token for %q: %v", username, err)
+		}
+		result := make(map[string][]string)
+		for _, access := range claims.Access {
+			result[access.Name] = access.Actions
+		}
+		return result
+	}
+
+	if got := granted("", "repository:public/app:pull,push", "repository:team-a/api:pull"); strings.Join(got["public/app"], ",") != "pull" || got["team-a/api"] != nil {
+		t.Fatalf("Unexpected anonymous access %v", got)
+	}
+	if got := granted("alice", "repository:team-a/api:pull,push"); strings.Join(got["team-a/api"], ",") != "pull,push" {
+		t.Fatalf("Unexpected member access %v", got)
+	}
+	if got := granted("bob", "repository:team-a/api:pull,push", "repository:shared:pull,push"); got["team-a/api"] != nil || strings.Join(got["shared"], ",") != "pull,push" {
+		t.Fatalf("Unexpected non-member access %v", got)
+	}
+
+	// 私有仓库不出现在非成员的仓库目录中
+	req := httptest.NewRequest(http.MethodGet, "/auth/token?scope=registry:catalog:*", nil)
+	req.SetBasicAuth("bob", "bob-password")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var resp auth.RegistryTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	req = httptest.NewRequest(http.MethodGet, "/v2/_catalog", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"repositories":["public/app","shared"]`) {
+		t.Fatalf("Unexpected catalog %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uploadJanitorInterval 清理过期上传的最长间隔
+const uploadJanitorInterval = 10 * time.Minute
+
+// uploadHashes 保存每个上传已接收数据的 sha256 状态
+// 数据在写入存储的同时计算摘要，完成上传时不需要重新读取
+type uploadHashes struct {
+	mutex  sync.Mutex
+	hashes map[string]*uploadHash
+}
+
+// uploadHash 上传的摘要状态和最后访问时间，mutex 保证同一个上传的写入请求串行处理
+type uploadHash struct {
+	mutex sync.Mutex
+	hash  hash.Hash // 为 nil 时需要从已接收的数据重建
+	used  time.Time
+}
+
+func newUploadHashes() *uploadHashes {
+	return &uploadHashes{hashes: make(map[string]*uploadHash)}
+}
+
+// start 开始记录上传的摘要
+func (u *uploadHashes) start(repository, uploadID string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.hashes[repository+"/"+uploadID] = &uploadHash{hash: sha256.New(), used: time.Now()}
+}
+
+// acquire 返回加锁的上传摘要状态，调用方处理完成后调用 release
+// 摘要状态不存在时 (进程重启或上传由其他实例创建) 调用 rebuild 从已接收的数据重新计算
+func (u *uploadHashes) acquire(repository, uploadID string, rebuild func() (hash.Hash, error)) (*uploadHash, error) {
+	key := repository + "/" + uploadID
+	for {
+		u.mutex.Lock()
+		h, ok := u.hashes[key]
+		if !ok {
+			h = &uploadHash{}
+			u.hashes[key] = h
+		}
+		h.used = time.Now()
+		u.mutex.Unlock()
+
+		h.mutex.Lock()
+		// 等待期间上传可能已经完成、取消或被清理
+		u.mutex.Lock()
+		current := u.hashes[key] == h
+		u.mutex.Unlock()
+		if !current {
+			h.mutex.Unlock()
+			continue
+		}
+		if h.hash == nil {
+			hasher, err := rebuild()
+			if err != nil {
+				u.remove(repository, uploadID)
+				h.mutex.Unlock()
+				return nil, err
+			}
+			h.hash = hasher
+		}
+		return h, nil
+	}
+}
+
+// release 释放 acquire 加的锁
+func (h *uploadHash) release() {
+	h.mutex.Unlock()
+}
+
+// purge 删除最后访问早于 before 的摘要状态，正在处理的上传不会被清理
+func (u *uploadHashes) purge(before time.Time) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	for key, h := range u.hashes {
+		if h.used.Before(before) && h.mutex.TryLock() {
+			delete(u.hashes, key)
+			h.mutex.Unlock()
+		}
+	}
+}
+
+// remove 删除上传的摘要状态
+func (u *uploadHashes) remove(repository, uploadID string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	delete(u.hashes, repository+"/"+uploadID)
+}
+
+// errInvalidContentRange Content-Range 格式错误
+var errInvalidContentRange = errors.New("invalid Content-Range")
+
+// parseContentRange 解析分块上传的 Content-Range，格式为 <start>-<end>，两端都包含
+// 兼容部分客户端添加的 "bytes " 前缀和 "/<total>" 后缀
+func parseContentRange(value string) (int64, int64, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "bytes ")
+	value, _, _ = strings.Cut(value, "/")
+	startValue, endValue, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, errInvalidContentRange
+	}
+	start, err := strconv.ParseInt(startValue, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, errInvalidContentRange
+	}
+	end, err := strconv.ParseInt(endValue, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, errInvalidContentRange
+	}
+	return start, end, nil
+}
+
+// uploadRange 返回已接收数据的 Range 头，没有数据时为 0-0
+func uploadRange(size int64) string {
+	if size <= 0 {
+		return "0-0"
+	}
+	return fmt.Sprintf("0-%d", size-1)
+}
+
+// RunUploadJanitor 定期清理超过 uploadTTL 没有写入的上传，直到 ctx 取消
+// 客户端中断的推送不会再完成或取消上传，不清理会一直占用存储
+func (h *Handler) RunUploadJanitor(ctx context.Context) {
+	if h.uploadTTL < 0 {
+		return
+	}
+	interval := uploadJanitorInterval
+	if h.uploadTTL < interval {
+		interval = h.uploadTTL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.purgeUploads(now)
+		}
+	}
+}
+
+// purgeUploads 删除最后一次写入早于 now - uploadTTL 的上传
+func (h *Handler) purgeUploads(now time.Time) {
+	before := now.Add(-h.uploadTTL)
+	purged, err := h.storage.PurgeUploads(before)
+	if err != nil {
+		log.Printf("Failed to purge stale uploads: %v", err)
+	}
+	if purged > 0 {
+		log.Printf("Purged %d stale uploads", purged)
+	}
+	h.hashes.purge(before)
+}
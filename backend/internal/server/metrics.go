@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/smartcat999/container-ui/internal/registry"
+)
+
+// writeRateLimitMetrics 以 Prometheus 文本格式输出上游限流指标
+// 上游没有报告过限流头时不输出 limit 和 remaining
+func writeRateLimitMetrics(w io.Writer, statuses []registry.RateLimitStatus) {
+	metrics := []struct {
+		name, help, kind string
+		value            func(registry.RateLimitStatus) (float64, bool)
+	}{
+		{"registry_upstream_ratelimit_limit", "Request limit reported by the upstream for the current window.", "gauge",
+			func(s registry.RateLimitStatus) (float64, bool) { return float64(s.Limit), s.ReportedAt != nil }},
+		{"registry_upstream_ratelimit_remaining", "Requests remaining in the current upstream window.", "gauge",
+			func(s registry.RateLimitStatus) (float64, bool) { return float64(s.Remaining), s.ReportedAt != nil }},
+		{"registry_upstream_throttled_total", "Responses with status 429 received from the upstream.", "counter",
+			func(s registry.RateLimitStatus) (float64, bool) { return float64(s.Throttled), true }},
+		{"registry_upstream_retries_total", "Requests retried after a 429 response.", "counter",
+			func(s registry.RateLimitStatus) (float64, bool) { return float64(s.Retries), true }},
+		{"registry_upstream_queued_requests", "Requests waiting for the upstream backoff to end.", "gauge",
+			func(s registry.RateLimitStatus) (float64, bool) { return float64(s.Queued), true }},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range statuses {
+			if v, ok := m.value(s); ok {
+				fmt.Fprintf(w, "%s{upstream=%q} %g\n", m.name, s.Upstream, v)
+			}
+		}
+	}
+}
+
+// writeHealthMetrics 以 Prometheus 文本格式输出上游健康指标
+func writeHealthMetrics(w io.Writer, statuses []registry.HealthStatus) {
+	metrics := []struct {
+		name, help, kind string
+		value            func(registry.HealthStatus) float64
+	}{
+		{"registry_upstream_up", "Whether the upstream circuit breaker is closed (1) or open/half-open (0).", "gauge",
+			func(s registry.HealthStatus) float64 {
+				if s.State == registry.BreakerClosed {
+					return 1
+				}
+				return 0
+			}},
+		{"registry_upstream_consecutive_failures", "Consecutive failed requests or health probes.", "gauge",
+			func(s registry.HealthStatus) float64 { return float64(s.ConsecutiveFailures) }},
+		{"registry_upstream_failures_total", "Failed requests and health probes.", "counter",
+			func(s registry.HealthStatus) float64 { return float64(s.Failures) }},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range statuses {
+			fmt.Fprintf(w, "%s{upstream=%q} %g\n", m.name, s.Upstream, m.value(s))
+		}
+	}
+}
@@ -2,13 +2,18 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 
+	"github.com/smartcat999/container-ui/internal/cert"
 	"github.com/smartcat999/container-ui/internal/config"
+	"github.com/smartcat999/container-ui/internal/openapi"
 	"github.com/smartcat999/container-ui/internal/registry"
 	"github.com/smartcat999/container-ui/internal/storage"
 )
@@ -17,11 +22,9 @@ import (
 func CreateProxyHandler(manager *registry.Manager) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		host := r.Host
-		if colonIndex := strings.IndexByte(host, ':'); colonIndex != -1 {
-			host = host[:colonIndex]
-		}
 
-		config, ok := manager.GetConfig(host)
+		// 依次尝试精确主机名、通配符、CIDR 和兜底规则
+		config, ok := manager.MatchConfig(host)
 		if !ok {
 			config = manager.GetDefaultConfig()
 			log.Printf("No mapping found for host: %s, using default: %s", host, config.HostName)
@@ -40,6 +43,12 @@ func CreateProxyHandler(manager *registry.Manager) http.Handler {
 	})
 }
 
+// CreatePathRoutingHandler 创建按路径前缀路由的代理处理器
+// /v2/<上游主机名>/<仓库>/... 代理到对应的上游，其他请求按 Host 头路由
+func CreatePathRoutingHandler(manager *registry.Manager) http.Handler {
+	return registry.NewPathRouter(manager, CreateProxyHandler(manager))
+}
+
 // StartServer 启动代理服务器 (兼容旧版API)
 func StartServer(ctx context.Context, addr string, handler http.Handler, manager *registry.Manager) *http.Server {
 	return StartServerWithOptions(ctx, ServerOptions{
@@ -51,18 +60,26 @@ func StartServer(ctx context.Context, addr string, handler http.Handler, manager
 
 // StartRegistryServer 启动仓库服务器 (兼容旧版API)
 func StartRegistryServer(ctx context.Context, addr string, manager *registry.Manager) *http.Server {
-	log.Printf("正在初始化仓库服务器，监听地址: %s", addr)
-
 	// 创建存储
 	storage, err := storage.NewFileStorage("./tmp")
 	if err != nil {
 		log.Fatalf("Failed to create storage: %v", err)
 	}
-	log.Printf("存储初始化成功: %v", storage)
+	return StartRegistryServerWithStorage(ctx, addr, manager, storage, registry.HandlerOptions{})
+}
+
+// StartRegistryServerWithStorage 使用指定的存储启动仓库服务器
+func StartRegistryServerWithStorage(ctx context.Context, addr string, manager *registry.Manager, storage storage.Storage, opts registry.HandlerOptions) *http.Server {
+	log.Printf("正在初始化仓库服务器，监听地址: %s", addr)
+	log.Printf("存储初始化成功: %T", storage)
 
 	// 创建注册表处理器
-	registryHandler := registry.NewHandler(storage)
+	registryHandler := registry.NewHandlerWithOptions(storage, opts)
 	log.Printf("处理器初始化成功: %v", registryHandler)
+	go registryHandler.RunUploadJanitor(ctx)
+	if opts.Notifier != nil {
+		go opts.Notifier.Run(ctx)
+	}
 
 	// 创建路由器
 	router := registry.NewRouter(registryHandler)
@@ -78,8 +95,112 @@ func StartRegistryServer(ctx context.Context, addr string, manager *registry.Man
 	})
 }
 
+// RegistryAdminOptions 仓库服务器管理接口的选项，为空的功能不提供对应的接口
+type RegistryAdminOptions struct {
+	// GC 垃圾回收 /api/v1/gc
+	GC *registry.GarbageCollector
+	// ACLs 仓库访问控制 /api/v1/acls
+	ACLs config.ACLStore
+	// Notifier 通知投递状态 /api/v1/notifications
+	Notifier *registry.Notifier
+	// Quota 配额和存储用量 /api/v1/quotas
+	Quota *registry.Quota
+	// Retention 保留策略的执行和预览 /api/v1/retention
+	Retention *registry.Retention
+	// Inspector 多架构标签的平台和大小 /api/v1/inspect
+	Inspector *registry.Inspector
+}
+
+// StartRegistryAdminServer 启动仓库服务器的管理接口
+func StartRegistryAdminServer(ctx context.Context, addr string, opts RegistryAdminOptions) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"status":"ok"}`)
+	})
+	if opts.GC != nil {
+		mux.Handle("/api/v1/gc", opts.GC)
+	}
+	if opts.ACLs != nil {
+		mux.Handle("/api/v1/acls", registry.NewACLAdmin(opts.ACLs))
+	}
+	if opts.Notifier != nil {
+		mux.Handle("/api/v1/notifications", opts.Notifier)
+	}
+	if opts.Quota != nil {
+		mux.Handle("/api/v1/quotas", opts.Quota)
+	}
+	if opts.Retention != nil {
+		mux.Handle("/api/v1/retention", opts.Retention)
+	}
+	if opts.Inspector != nil {
+		mux.Handle("/api/v1/inspect", opts.Inspector)
+	}
+
+	return StartServerWithOptions(ctx, ServerOptions{
+		Addr:    addr,
+		Handler: mux,
+	})
+}
+
+// AdminRoutes 返回管理API的全部接口，用于生成 OpenAPI 文档
+func AdminRoutes() []openapi.Route {
+	const tag = "registries"
+	return []openapi.Route{
+		{Method: http.MethodGet, Path: "/api/v1/health", Summary: "健康检查", Tag: "system", Response: map[string]string{}},
+		{Method: http.MethodGet, Path: "/api/v1/openapi.json", Summary: "OpenAPI 文档", Tag: "system", Response: map[string]interface{}{}},
+		{Method: http.MethodGet, Path: "/api/v1/docs", Summary: "Swagger UI 页面", Tag: "system", ResponseType: "text/html"},
+		{Method: http.MethodGet, Path: "/api/v1/registries", Summary: "列出仓库代理配置", Tag: tag, Response: []config.Config{}},
+		{Method: http.MethodPost, Path: "/api/v1/registries", Summary: "添加仓库代理配置", Tag: tag, Request: config.Config{}},
+		{Method: http.MethodGet, Path: "/api/v1/registries/:host", Summary: "获取仓库代理配置", Tag: tag, Response: config.Config{}},
+		{Method: http.MethodPut, Path: "/api/v1/registries/:host", Summary: "更新仓库代理配置", Tag: tag, Request: config.Config{}},
+		{Method: http.MethodDelete, Path: "/api/v1/registries/:host", Summary: "删除仓库代理配置", Tag: tag},
+		{Method: http.MethodPost, Path: "/api/v1/validate", Summary: "校验候选的仓库代理配置，不保存也不生效，校验失败时返回 422 和全部字段错误", Tag: tag, Request: config.Config{}, Response: validateResponse{}},
+		{Method: http.MethodPost, Path: "/api/v1/reload", Summary: "重新读取配置文件，返回发生变化的主机名", Tag: tag, Response: reloadResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/ratelimits", Summary: "查看各上游的限流状态", Tag: tag, Response: []registry.RateLimitStatus{}},
+		{Method: http.MethodGet, Path: "/api/v1/upstreams/health", Summary: "查看各上游的健康状态和断路器状态", Tag: tag, Response: []registry.HealthStatus{}},
+		{Method: http.MethodGet, Path: "/api/v1/ca", Summary: "查看正向代理签发拦截证书的 CA", Tag: "certificates", Response: cert.CAInfo{}},
+		{Method: http.MethodPut, Path: "/api/v1/ca", Summary: "使用已有的 CA 证书和私钥替换当前 CA", Tag: "certificates", Request: cert.CARequest{}, Response: cert.CAInfo{}},
+		{Method: http.MethodGet, Path: "/api/v1/ca.crt", Summary: "下载 CA 证书，?format=der 返回 DER 编码", Tag: "certificates", ResponseType: "application/x-pem-file"},
+		{Method: http.MethodGet, Path: "/api/v1/ca.crl", Summary: "下载 CA 签发的 CRL，?format=pem 返回 PEM 编码", Tag: "certificates", ResponseType: "application/pkix-crl"},
+		{Method: http.MethodGet, Path: "/api/v1/certificates", Summary: "列出签发的主机证书及吊销状态，?host= 按主机过滤", Tag: "certificates", Response: []cert.IssuedCertificate{}},
+		{Method: http.MethodDelete, Path: "/api/v1/certificates/:host", Summary: "吊销主机的证书，?serial= 只吊销指定的证书，下次连接时重新签发", Tag: "certificates", Response: []cert.IssuedCertificate{}},
+		{Method: http.MethodPost, Path: "/api/v1/certificates/:host", Summary: "吊销主机当前的证书并立即重新签发", Tag: "certificates", Response: cert.IssuedCertificate{}},
+		{Method: http.MethodGet, Path: "/api/v1/ca/trust", Summary: "节点信任 CA 和使用代理的配置 (containerd hosts.toml、daemon.json)，?format=sh 返回脚本", Tag: "certificates", Response: cert.TrustBundle{}},
+		{Method: http.MethodGet, Path: "/metrics", Summary: "Prometheus 格式的指标", Tag: "system", ResponseType: "text/plain"},
+	}
+}
+
+// reloadResponse 重新加载配置的结果
+type reloadResponse struct {
+	// Changed 添加、更新或删除的主机名
+	Changed []string `json:"changed"`
+}
+
+// validateResponse 校验候选配置的结果
+type validateResponse struct {
+	Valid  bool                `json:"valid"`
+	Errors []config.FieldError `json:"errors,omitempty"`
+}
+
+// AdminOptions 代理管理接口的选项，为空的功能不提供对应的接口
+type AdminOptions struct {
+	// Certs 正向代理模式签发拦截证书的 CA，查看和更换 CA /api/v1/ca，下载 CA 证书 /api/v1/ca.crt 和 CRL /api/v1/ca.crl，
+	// 节点信任 CA 和使用代理的配置 /api/v1/ca/trust，签发记录和吊销 /api/v1/certificates
+	Certs *cert.Manager
+	// ProxyAddr 代理的监听地址，生成节点配置时与请求的主机名组成默认的代理地址
+	ProxyAddr string
+	// TLSConfig 不为空时管理接口使用 HTTPS，例如使用 ACME 申请的证书
+	TLSConfig *tls.Config
+}
+
 // StartAdminServer 启动管理API服务器
 func StartAdminServer(ctx context.Context, listenAddr string, manager *registry.Manager) *http.Server {
+	return StartAdminServerWithOptions(ctx, listenAddr, manager, AdminOptions{})
+}
+
+// StartAdminServerWithOptions 使用选项启动管理API服务器
+func StartAdminServerWithOptions(ctx context.Context, listenAddr string, manager *registry.Manager, opts AdminOptions) *http.Server {
 	// 创建管理API路由
 	mux := http.NewServeMux()
 
@@ -89,6 +210,123 @@ func StartAdminServer(ctx context.Context, listenAddr string, manager *registry.
 		fmt.Fprintf(w, `{"status":"ok"}`)
 	})
 
+	// API 文档
+	spec, err := json.Marshal(openapi.Build(openapi.Info{
+		Title:       "Registry Proxy Admin API",
+		Description: "镜像仓库代理管理接口",
+		Version:     "1.0.0",
+	}, AdminRoutes(), false))
+	if err != nil {
+		log.Fatalf("Failed to build OpenAPI document: %v", err)
+	}
+	mux.HandleFunc("/api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+	docs := openapi.SwaggerUI("Registry Proxy Admin API", "/api/v1/openapi.json")
+	mux.Handle("/api/v1/docs", docs)
+	mux.Handle("/api/v1/docs/", docs)
+
+	// 校验候选配置，不修改存储
+	mux.HandleFunc("/api/v1/validate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var cfg config.Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := validateResponse{Valid: true}
+		var verr *config.ValidationError
+		if err := registry.ValidateConfig(cfg); errors.As(err, &verr) {
+			resp = validateResponse{Errors: verr.Errors}
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := rejectSecretReferences(manager, cfg); errors.As(err, &verr) {
+			resp = validateResponse{Errors: append(resp.Errors, verr.Errors...)}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !resp.Valid {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	// 重新读取配置文件，与 SIGHUP 相同
+	mux.HandleFunc("/api/v1/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		changed, err := manager.ReloadConfigs()
+		if errors.Is(err, registry.ErrReloadNotSupported) {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reloadResponse{Changed: append([]string{}, changed...)})
+	})
+
+	// 上游限流状态
+	mux.HandleFunc("/api/v1/ratelimits", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(manager.RateLimits())
+	})
+	// 上游健康状态
+	mux.HandleFunc("/api/v1/upstreams/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(manager.Health())
+	})
+	if opts.Certs != nil {
+		mux.Handle("/api/v1/ca", cert.NewCAAdmin(opts.Certs))
+		mux.HandleFunc("/api/v1/ca.crt", func(w http.ResponseWriter, r *http.Request) {
+			cert.WriteCACertificate(w, r, opts.Certs)
+		})
+		mux.HandleFunc("/api/v1/ca.crl", func(w http.ResponseWriter, r *http.Request) {
+			cert.WriteCRL(w, r, opts.Certs)
+		})
+		certificates := cert.NewCertificateAdmin(opts.Certs)
+		mux.Handle("/api/v1/certificates", certificates)
+		mux.Handle("/api/v1/certificates/", certificates)
+		// ?proxy= 指定节点访问代理的地址，?format=sh 返回可以直接执行的脚本
+		mux.HandleFunc("/api/v1/ca/trust", func(w http.ResponseWriter, r *http.Request) {
+			configs, err := manager.ListConfigs()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			var hosts []string
+			for _, cfg := range configs {
+				hosts = append(hosts, cfg.GetDNSNames()...)
+			}
+			proxyURL := r.URL.Query().Get("proxy")
+			if proxyURL == "" {
+				proxyURL = defaultProxyURL(r, opts.ProxyAddr)
+			}
+			bundle := cert.NewTrustBundle(opts.Certs.CACertPEM(), hosts, proxyURL)
+			if r.URL.Query().Get("format") == "sh" {
+				w.Header().Set("Content-Type", "text/x-shellscript")
+				fmt.Fprint(w, bundle.Script())
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(bundle)
+		})
+	}
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeRateLimitMetrics(w, manager.RateLimits())
+		writeHealthMetrics(w, manager.Health())
+	})
+
 	// 获取所有仓库配置
 	mux.HandleFunc("/api/v1/registries", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -106,6 +344,10 @@ func StartAdminServer(ctx context.Context, listenAddr string, manager *registry.
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+			if err := rejectSecretReferences(manager, cfg); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 
 			if err := manager.AddConfig(cfg); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
@@ -146,6 +388,10 @@ func StartAdminServer(ctx context.Context, listenAddr string, manager *registry.
 			}
 
 			cfg.HostName = hostName
+			if err := rejectSecretReferences(manager, cfg); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			if err := manager.AddConfig(cfg); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
@@ -170,8 +416,29 @@ func StartAdminServer(ctx context.Context, listenAddr string, manager *registry.
 	})
 
 	return StartServerWithOptions(ctx, ServerOptions{
-		Addr:    listenAddr,
-		Handler: mux,
-		Manager: manager,
+		Addr:      listenAddr,
+		Handler:   mux,
+		Manager:   manager,
+		TLSConfig: opts.TLSConfig,
 	})
 }
+
+// rejectSecretReferences 管理 API 不接受新的环境变量和文件引用，否则调用方可以让代理把主机上的文件或
+// 加密密钥作为凭据发送到自己控制的上游；已保存的引用原样提交时允许保留
+func rejectSecretReferences(manager *registry.Manager, cfg config.Config) error {
+	previous, _ := manager.GetConfig(cfg.HostName)
+	return cfg.RejectSecretReferences(previous)
+}
+
+// defaultProxyURL 用访问管理接口的主机名和代理的监听端口组成代理地址
+func defaultProxyURL(r *http.Request, proxyAddr string) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	_, port, err := net.SplitHostPort(proxyAddr)
+	if err != nil || port == "80" {
+		return "http://" + host
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"log"
 	"net/http"
 	"time"
@@ -20,6 +21,8 @@ type ServerOptions struct {
 	Addr    string
 	Handler http.Handler
 	Manager *registry.Manager
+	// TLSConfig 不为空时使用 HTTPS，证书由 TLSConfig 提供 (例如 GetCertificate)
+	TLSConfig *tls.Config
 }
 
 // StartServerWithOptions 启动HTTP服务器
@@ -34,14 +37,21 @@ func StartServerWithOptions(ctx context.Context, options ServerOptions) *http.Se
 
 	// 创建服务器
 	srv := &http.Server{
-		Addr:    options.Addr,
-		Handler: mux,
+		Addr:      options.Addr,
+		Handler:   mux,
+		TLSConfig: options.TLSConfig,
 	}
 
 	// 启动服务器
 	go func() {
-		log.Printf("Starting HTTP server on %s", options.Addr)
-		err := srv.ListenAndServe()
+		var err error
+		if options.TLSConfig != nil {
+			log.Printf("Starting HTTPS server on %s", options.Addr)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Starting HTTP server on %s", options.Addr)
+			err = srv.ListenAndServe()
+		}
 		if err != nil && err != http.ErrServerClosed {
 			log.Printf("Server error: %v", err)
 		}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+)
+
+// 批量操作的最大并发数，避免同时向 Docker 发起过多请求
+const batchWorkers = 8
+
+// 批量操作支持的动作
+const (
+	BatchStart   = "start"
+	BatchStop    = "stop"
+	BatchRestart = "restart"
+	BatchDelete  = "delete"
+)
+
+// BatchRequest 容器批量操作请求
+type BatchRequest struct {
+	IDs    []string `json:"ids"`
+	Action string   `json:"action"`
+	Force  bool     `json:"force"` // 仅对 delete 生效，强制删除运行中的容器
+}
+
+// BatchResult 单个容器的操作结果
+type BatchResult struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Validate 检查批量操作请求是否合法
+func (r BatchRequest) Validate() error {
+	if len(r.IDs) == 0 {
+		return fmt.Errorf("ids is required")
+	}
+	switch r.Action {
+	case BatchStart, BatchStop, BatchRestart, BatchDelete:
+		return nil
+	}
+	return fmt.Errorf("unsupported action: %s", r.Action)
+}
+
+// BatchContainers 并发地对多个容器执行同一操作，结果顺序与请求中的 ID 顺序一致
+// 单个容器失败不会中断其他容器的操作
+func (s *DockerService) BatchContainers(contextName string, req BatchRequest) ([]BatchResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	// 提前获取 client，context 不可用时直接返回错误而不是每个容器都失败
+	if _, err := s.getClient(contextName); err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(req.IDs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := batchWorkers
+	if len(req.IDs) < workers {
+		workers = len(req.IDs)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				id := req.IDs[i]
+				results[i] = BatchResult{ID: id, Success: true}
+				if err := s.runBatchAction(contextName, id, req); err != nil {
+					results[i].Success = false
+					results[i].Error = err.Error()
+				}
+			}
+		}()
+	}
+
+	for i := range req.IDs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, nil
+}
+
+func (s *DockerService) runBatchAction(contextName string, id string, req BatchRequest) error {
+	switch req.Action {
+	case BatchStart:
+		return s.StartContainer(contextName, id)
+	case BatchStop:
+		return s.StopContainer(contextName, id)
+	case BatchRestart:
+		return s.RestartContainer(contextName, id, nil)
+	case BatchDelete:
+		return s.DeleteContainer(contextName, id, req.Force)
+	}
+	return fmt.Errorf("unsupported action: %s", req.Action)
+}
+
+// GroupBatchRequest 对一组 context 中匹配条件的容器执行批量操作
+type GroupBatchRequest struct {
+	ContextLabels []string `json:"contextLabels"` // 进一步按标签筛选 context
+	Action        string   `json:"action"`
+	Force         bool     `json:"force"`
+
+	// 容器选择条件，至少指定一个，避免误操作整组主机上的全部容器
+	State  string   `json:"state"`
+	Name   string   `json:"name"` // 容器名称正则表达式
+	Image  string   `json:"image"`
+	Labels []string `json:"labels"`
+}
+
+// GroupBatchResult 单个 context 的批量操作结果
+type GroupBatchResult struct {
+	Context string        `json:"context"`
+	Error   string        `json:"error,omitempty"`
+	Results []BatchResult `json:"results"`
+}
+
+// Validate 检查分组批量操作请求是否合法
+func (r GroupBatchRequest) Validate() error {
+	if err := (BatchRequest{IDs: []string{""}, Action: r.Action}).Validate(); err != nil {
+		return err
+	}
+	if r.State == "" && r.Name == "" && r.Image == "" && len(r.Labels) == 0 {
+		return fmt.Errorf("at least one container selector (state, name, image or labels) is required")
+	}
+	return r.containerFilter().Validate()
+}
+
+func (r GroupBatchRequest) containerFilter() ContainerFilter {
+	return ContainerFilter{State: r.State, Name: r.Name, Image: r.Image, Labels: r.Labels}
+}
+
+// BatchGroupContainers 在分组内的每个 context 上选出匹配的容器并执行批量操作
+// 各 context 并发处理，单个 context 失败记录在结果中，不影响其他 context
+func (s *DockerService) BatchGroupContainers(group string, req GroupBatchRequest) ([]GroupBatchResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	contexts, err := s.ListContexts(ContextFilter{Group: group, Labels: req.ContextLabels})
+	if err != nil {
+		return nil, err
+	}
+	if len(contexts) == 0 {
+		return nil, fmt.Errorf("no contexts found in group %s", group)
+	}
+
+	results := make([]GroupBatchResult, len(contexts))
+	sem := make(chan struct{}, batchWorkers)
+	var wg sync.WaitGroup
+	for i, ctx := range contexts {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = s.batchContextContainers(name, req)
+		}(i, ctx.Name)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+func (s *DockerService) batchContextContainers(contextName string, req GroupBatchRequest) GroupBatchResult {
+	result := GroupBatchResult{Context: contextName, Results: []BatchResult{}}
+	if err := s.CheckWritable(contextName); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	containers, _, err := s.ListContainers(contextName, req.containerFilter())
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if len(containers) == 0 {
+		return result
+	}
+
+	ids := make([]string, len(containers))
+	for i, container := range containers {
+		ids[i] = container.ID
+	}
+	batchResults, err := s.BatchContainers(contextName, BatchRequest{IDs: ids, Action: req.Action, Force: req.Force})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Results = batchResults
+	return result
+}
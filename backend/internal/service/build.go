@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// BuildOptions 镜像构建选项
+type BuildOptions struct {
+	Tags       []string          `json:"tags"`
+	Dockerfile string            `json:"dockerfile"` // 构建上下文中 Dockerfile 的相对路径，默认 Dockerfile
+	Target     string            `json:"target"`     // 多阶段构建的目标阶段
+	BuildArgs  map[string]string `json:"buildArgs"`
+	Labels     map[string]string `json:"labels"`
+	Remote     string            `json:"remote"` // Git 仓库地址或远程 tar 包 URL，设置后无需上传构建上下文
+	NoCache    bool              `json:"noCache"`
+	Pull       bool              `json:"pull"` // 总是尝试拉取更新的基础镜像
+
+	// Platforms 目标平台，例如 linux/amd64、linux/arm64，经典构建器只支持一个平台，
+	// 多平台需要 BuildKit 并且守护进程启用 containerd 镜像存储
+	Platforms []string `json:"platforms"`
+	CacheFrom []string `json:"cacheFrom"` // 用作缓存来源的镜像
+
+	// 以下选项需要 BuildKit
+	// secret/ssh 挂载需要客户端通过 BuildKit 会话 (gRPC) 提供内容，服务端未实现会话，因此不提供这两个选项
+	BuildKit    bool `json:"buildkit"`    // 使用 BuildKit 构建器
+	InlineCache bool `json:"inlineCache"` // 将缓存元数据写入产出镜像，供其他构建通过 cacheFrom 复用
+}
+
+// Validate 校验构建选项
+func (o BuildOptions) Validate() error {
+	if !o.BuildKit && len(o.Platforms) > 1 {
+		return fmt.Errorf("building for multiple platforms requires buildkit to be enabled")
+	}
+	if !o.BuildKit && o.InlineCache {
+		return fmt.Errorf("inline cache requires buildkit to be enabled")
+	}
+	return nil
+}
+
+// BuildImage 构建镜像，返回 Docker 输出的 JSON 构建日志流，调用方负责关闭
+// buildContext 为 tar 格式的构建上下文，使用 Remote 时可以为 nil
+func (s *DockerService) BuildImage(contextName string, buildContext io.Reader, opts BuildOptions) (io.ReadCloser, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	if buildContext == nil && opts.Remote == "" {
+		return nil, fmt.Errorf("build context or remote url is required")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	buildArgs := make(map[string]*string, len(opts.BuildArgs))
+	for key, value := range opts.BuildArgs {
+		v := value
+		buildArgs[key] = &v
+	}
+	if opts.InlineCache {
+		inline := "1"
+		buildArgs["BUILDKIT_INLINE_CACHE"] = &inline
+	}
+
+	buildOptions := types.ImageBuildOptions{
+		Tags:          opts.Tags,
+		Dockerfile:    opts.Dockerfile,
+		Target:        opts.Target,
+		BuildArgs:     buildArgs,
+		Labels:        opts.Labels,
+		RemoteContext: opts.Remote,
+		NoCache:       opts.NoCache,
+		PullParent:    opts.Pull,
+		CacheFrom:     opts.CacheFrom,
+		Platform:      strings.Join(opts.Platforms, ","),
+		Remove:        true,
+		Version:       types.BuilderV1,
+	}
+	if opts.BuildKit {
+		buildOptions.Version = types.BuilderBuildKit
+	}
+
+	resp, err := cli.ImageBuild(context.Background(), buildContext, buildOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build image: %v", err)
+	}
+	if opts.BuildKit {
+		return translateBuildKitStream(resp.Body), nil
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,21 @@
+package service
+
+import "testing"
+
+func TestBuildOptionsValidate(t *testing.T) {
+	tests := []struct {
+		opts    BuildOptions
+		wantErr bool
+	}{
+		{opts: BuildOptions{Platforms: []string{"linux/arm64"}}},
+		{opts: BuildOptions{Platforms: []string{"linux/amd64", "linux/arm64"}}, wantErr: true},
+		{opts: BuildOptions{Platforms: []string{"linux/amd64", "linux/arm64"}, BuildKit: true}},
+		{opts: BuildOptions{InlineCache: true}, wantErr: true},
+		{opts: BuildOptions{InlineCache: true, BuildKit: true}},
+	}
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) = %v", tt.opts, err)
+		}
+	}
+}
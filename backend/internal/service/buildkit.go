@@ -0,0 +1,241 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// buildKitTraceID BuildKit 构建进度消息的标识，aux 字段为 protobuf 编码的 StatusResponse
+const buildKitTraceID = "moby.buildkit.trace"
+
+// buildKitVertex 构建步骤（对应 moby.buildkit.v1.Vertex 中用到的字段）
+type buildKitVertex struct {
+	Digest    string
+	Name      string
+	Cached    bool
+	Started   bool
+	Completed bool
+	Error     string
+}
+
+// buildKitLog 构建步骤输出（对应 moby.buildkit.v1.VertexLog）
+type buildKitLog struct {
+	Vertex string
+	Msg    []byte
+}
+
+// buildKitStatus 构建进度（对应 moby.buildkit.v1.StatusResponse）
+type buildKitStatus struct {
+	Vertexes []buildKitVertex
+	Logs     []buildKitLog
+}
+
+// decodeBuildKitStatus 解析 protobuf 编码的 StatusResponse，只解码展示日志所需的字段
+func decodeBuildKitStatus(data []byte) (buildKitStatus, error) {
+	var status buildKitStatus
+	err := walkProtoFields(data, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			vertex, err := decodeBuildKitVertex(value)
+			if err != nil {
+				return err
+			}
+			status.Vertexes = append(status.Vertexes, vertex)
+		case 3:
+			var log buildKitLog
+			err := walkProtoFields(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case 1:
+					log.Vertex = string(value)
+				case 4:
+					log.Msg = append([]byte(nil), value...)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			status.Logs = append(status.Logs, log)
+		}
+		return nil
+	})
+	return status, err
+}
+
+func decodeBuildKitVertex(data []byte) (buildKitVertex, error) {
+	var vertex buildKitVertex
+	err := walkProtoFields(data, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			vertex.Digest = string(value)
+		case 3:
+			vertex.Name = string(value)
+		case 4:
+			vertex.Cached = len(value) > 0 && value[0] != 0
+		case 5:
+			vertex.Started = true
+		case 6:
+			vertex.Completed = true
+		case 7:
+			vertex.Error = string(value)
+		}
+		return nil
+	})
+	return vertex, err
+}
+
+// walkProtoFields 遍历 protobuf 消息的字段，varint 字段以单字节布尔/整数形式传给回调，
+// length-delimited 字段传递原始字节，其余类型忽略
+func walkProtoFields(data []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var value []byte
+		switch typ {
+		case protowire.VarintType:
+			v, m := protowire.ConsumeVarint(data)
+			if m < 0 {
+				return protowire.ParseError(m)
+			}
+			value = []byte{byte(v)}
+			n = m
+		case protowire.BytesType:
+			v, m := protowire.ConsumeBytes(data)
+			if m < 0 {
+				return protowire.ParseError(m)
+			}
+			value = v
+			n = m
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		data = data[n:]
+
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildKitPrinter 将 BuildKit 进度转换为与 docker build --progress=plain 类似的文本输出
+type buildKitPrinter struct {
+	indexes map[string]int
+	started map[string]bool
+	done    map[string]bool
+}
+
+func newBuildKitPrinter() *buildKitPrinter {
+	return &buildKitPrinter{
+		indexes: make(map[string]int),
+		started: make(map[string]bool),
+		done:    make(map[string]bool),
+	}
+}
+
+func (p *buildKitPrinter) index(digest string) int {
+	if i, ok := p.indexes[digest]; ok {
+		return i
+	}
+	i := len(p.indexes) + 1
+	p.indexes[digest] = i
+	return i
+}
+
+// lines 返回本次进度更新对应的输出行
+func (p *buildKitPrinter) lines(status buildKitStatus) []string {
+	var lines []string
+	for _, v := range status.Vertexes {
+		i := p.index(v.Digest)
+		if !p.started[v.Digest] && (v.Started || v.Cached) {
+			p.started[v.Digest] = true
+			lines = append(lines, fmt.Sprintf("#%d %s\n", i, v.Name))
+		}
+		if p.done[v.Digest] {
+			continue
+		}
+		switch {
+		case v.Error != "":
+			p.done[v.Digest] = true
+			lines = append(lines, fmt.Sprintf("#%d ERROR: %s\n", i, v.Error))
+		case v.Cached:
+			p.done[v.Digest] = true
+			lines = append(lines, fmt.Sprintf("#%d CACHED\n", i))
+		case v.Completed:
+			p.done[v.Digest] = true
+			lines = append(lines, fmt.Sprintf("#%d DONE\n", i))
+		}
+	}
+	for _, l := range status.Logs {
+		i := p.index(l.Vertex)
+		for _, line := range strings.SplitAfter(string(l.Msg), "\n") {
+			if line == "" {
+				continue
+			}
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			lines = append(lines, fmt.Sprintf("#%d %s", i, line))
+		}
+	}
+	return lines
+}
+
+// translateBuildKitStream 将构建输出中的 BuildKit 进度消息转换为 {"stream": "..."} 文本消息，
+// 其余消息原样转发，使前端可以用同一种方式展示经典构建器和 BuildKit 的输出
+func translateBuildKitStream(body io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer body.Close()
+
+		printer := newBuildKitPrinter()
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			var msg struct {
+				ID  string          `json:"id"`
+				Aux json.RawMessage `json:"aux"`
+			}
+			if json.Unmarshal(line, &msg) != nil || msg.ID != buildKitTraceID {
+				if _, err := pw.Write(append(append([]byte(nil), line...), '\n')); err != nil {
+					return
+				}
+				continue
+			}
+
+			// aux 为 JSON 字符串形式的 base64 编码数据
+			var data []byte
+			if err := json.Unmarshal(msg.Aux, &data); err != nil {
+				continue
+			}
+			status, err := decodeBuildKitStatus(data)
+			if err != nil {
+				continue
+			}
+			for _, text := range printer.lines(status) {
+				out, _ := json.Marshal(map[string]string{"stream": text})
+				if _, err := pw.Write(append(out, '\n')); err != nil {
+					return
+				}
+			}
+		}
+		pw.CloseWithError(scanner.Err())
+	}()
+	return pr
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// encodeTestStatus 构造 protobuf 编码的 StatusResponse，包含一个已完成的步骤和一条日志
+func encodeTestStatus() []byte {
+	var vertex []byte
+	vertex = protowire.AppendTag(vertex, 1, protowire.BytesType)
+	vertex = protowire.AppendString(vertex, "sha256:abc")
+	vertex = protowire.AppendTag(vertex, 3, protowire.BytesType)
+	vertex = protowire.AppendString(vertex, "[1/2] FROM alpine")
+	vertex = protowire.AppendTag(vertex, 5, protowire.BytesType)
+	vertex = protowire.AppendBytes(vertex, []byte{0x08, 0x01})
+	vertex = protowire.AppendTag(vertex, 6, protowire.BytesType)
+	vertex = protowire.AppendBytes(vertex, []byte{0x08, 0x02})
+
+	var log []byte
+	log = protowire.AppendTag(log, 1, protowire.BytesType)
+	log = protowire.AppendString(log, "sha256:abc")
+	log = protowire.AppendTag(log, 3, protowire.VarintType)
+	log = protowire.AppendVarint(log, 1)
+	log = protowire.AppendTag(log, 4, protowire.BytesType)
+	log = protowire.AppendBytes(log, []byte("hello\nworld\n"))
+
+	var status []byte
+	status = protowire.AppendTag(status, 1, protowire.BytesType)
+	status = protowire.AppendBytes(status, vertex)
+	status = protowire.AppendTag(status, 3, protowire.BytesType)
+	status = protowire.AppendBytes(status, log)
+	return status
+}
+
+func TestDecodeBuildKitStatus(t *testing.T) {
+	status, err := decodeBuildKitStatus(encodeTestStatus())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	if len(status.Vertexes) != 1 {
+		t.Fatalf("Expected 1 vertex, got %d", len(status.Vertexes))
+	}
+	v := status.Vertexes[0]
+	if v.Digest != "sha256:abc" || v.Name != "[1/2] FROM alpine" || !v.Started || !v.Completed {
+		t.Errorf("Unexpected vertex: %+v", v)
+	}
+
+	if len(status.Logs) != 1 || string(status.Logs[0].Msg) != "hello\nworld\n" {
+		t.Errorf("Unexpected logs: %+v", status.Logs)
+	}
+}
+
+func TestTranslateBuildKitStream(t *testing.T) {
+	aux, _ := json.Marshal(base64.StdEncoding.EncodeToString(encodeTestStatus()))
+	input := `{"stream":"plain message"}` + "\n" +
+		`{"id":"moby.buildkit.trace","aux":` + string(aux) + `}` + "\n"
+
+	out, err := io.ReadAll(translateBuildKitStream(io.NopCloser(strings.NewReader(input))))
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	var streams []string
+	for _, line := range bytes.Split(bytes.TrimSpace(out), []byte("\n")) {
+		var msg struct {
+			Stream string `json:"stream"`
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			t.Fatalf("invalid output line %q: %v", line, err)
+		}
+		streams = append(streams, msg.Stream)
+	}
+
+	expected := []string{
+		"plain message",
+		"#1 [1/2] FROM alpine\n",
+		"#1 DONE\n",
+		"#1 hello\n",
+		"#1 world\n",
+	}
+	if strings.Join(streams, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, streams)
+	}
+}
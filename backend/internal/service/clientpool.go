@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+const (
+	// clientHealthInterval 距离上次检查超过该时间的 client 在使用前会先 ping 一次
+	clientHealthInterval = 30 * time.Second
+	// clientPingTimeout 健康检查超时时间
+	clientPingTimeout = 5 * time.Second
+	// clientIdleTimeout 超过该时间未使用的 client 会被关闭并移出连接池
+	clientIdleTimeout = 10 * time.Minute
+)
+
+// clientPool 按 context 名称缓存 Docker client，按需创建，并定期做健康检查和空闲回收
+// 每个请求使用 URL 中的 context 获取自己的 client，不同 context 的请求互不影响
+type clientPool struct {
+	factory func(contextName string) (*client.Client, error)
+
+	mu      sync.Mutex
+	entries map[string]*pooledClient
+}
+
+type pooledClient struct {
+	cli         *client.Client
+	lastUsed    time.Time
+	lastChecked time.Time
+}
+
+func newClientPool(factory func(contextName string) (*client.Client, error)) *clientPool {
+	return &clientPool{
+		factory: factory,
+		entries: make(map[string]*pooledClient),
+	}
+}
+
+// get 获取 context 对应的 client，不存在或健康检查失败时重新创建
+func (p *clientPool) get(contextName string) (*client.Client, error) {
+	now := time.Now()
+
+	p.mu.Lock()
+	entry, ok := p.entries[contextName]
+	if ok {
+		entry.lastUsed = now
+		needCheck := now.Sub(entry.lastChecked) > clientHealthInterval
+		p.mu.Unlock()
+
+		if !needCheck {
+			return entry.cli, nil
+		}
+
+		// ping 在锁外进行，避免一个不可达的 daemon 阻塞其他 context
+		ctx, cancel := context.WithTimeout(context.Background(), clientPingTimeout)
+		_, err := entry.cli.Ping(ctx)
+		cancel()
+		if err == nil {
+			p.mu.Lock()
+			entry.lastChecked = time.Now()
+			p.mu.Unlock()
+			return entry.cli, nil
+		}
+
+		// 连接失效，丢弃后重新创建
+		p.remove(contextName, entry)
+	} else {
+		p.mu.Unlock()
+	}
+
+	cli, err := p.factory(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 并发请求可能已经创建了同一个 context 的 client，保留先创建的那个
+	if existing, ok := p.entries[contextName]; ok {
+		cli.Close()
+		existing.lastUsed = now
+		return existing.cli, nil
+	}
+	p.entries[contextName] = &pooledClient{cli: cli, lastUsed: now, lastChecked: now}
+	return cli, nil
+}
+
+// remove 在条目未被替换的情况下移除并关闭 client
+func (p *clientPool) remove(contextName string, entry *pooledClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.entries[contextName] == entry {
+		delete(p.entries, contextName)
+		entry.cli.Close()
+	}
+}
+
+// evict 移除 context 的 client，context 配置变更或删除时调用
+func (p *clientPool) evict(contextName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if entry, ok := p.entries[contextName]; ok {
+		delete(p.entries, contextName)
+		entry.cli.Close()
+	}
+}
+
+// sweep 关闭长时间未使用的 client
+func (p *clientPool) sweep() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for name, entry := range p.entries {
+		if now.Sub(entry.lastUsed) > clientIdleTimeout {
+			delete(p.entries, name)
+			entry.cli.Close()
+		}
+	}
+}
+
+// run 定期回收空闲 client
+func (p *clientPool) run() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		p.sweep()
+	}
+}
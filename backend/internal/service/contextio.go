@@ -0,0 +1,320 @@
+package service
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 上传的 context 归档的限制，防止异常归档耗尽内存
+const (
+	maxDockerContextFile  = 1 << 20  // 单个文件的最大大小
+	maxDockerContextFiles = 1000     // 最多包含的文件数
+	maxDockerContextBytes = 16 << 20 // 所有文件的总大小
+)
+
+// dockerContextMeta docker CLI 的 context 元数据 (contexts/meta/<sha256>/meta.json)
+type dockerContextMeta struct {
+	Name      string                    `json:"Name"`
+	Metadata  map[string]interface{}    `json:"Metadata,omitempty"`
+	Endpoints map[string]dockerEndpoint `json:"Endpoints"`
+}
+
+type dockerEndpoint struct {
+	Host          string `json:"Host"`
+	SkipTLSVerify bool   `json:"SkipTLSVerify"`
+}
+
+// ContextImportOptions 导入选项
+// 目录导入固定使用服务端 docker CLI 的 contexts 目录，不接受客户端指定路径
+type ContextImportOptions struct {
+	Names     []string `json:"names"`     // 要导入的 context，为空表示全部
+	Overwrite bool     `json:"overwrite"` // 是否覆盖同名 context
+}
+
+// ContextImportResult 导入结果
+type ContextImportResult struct {
+	Imported []string          `json:"imported"`
+	Skipped  map[string]string `json:"skipped"` // context 名称 -> 跳过原因
+}
+
+// dockerContextDir 返回 docker CLI 默认的 contexts 目录
+func dockerContextDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "contexts"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".docker", "contexts"), nil
+}
+
+// dockerContextID docker CLI 使用 context 名称的 sha256 作为目录名
+func dockerContextID(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+// dockerContextSource 读取 docker CLI context 存储，目录和归档两种来源使用同样的布局
+type dockerContextSource struct {
+	files map[string][]byte // 相对路径 -> 内容
+	// tlsValue 返回 TLS 文件在 ContextConfig 中的取值：目录来源使用文件路径，归档来源使用 PEM 内容
+	tlsValue func(rel string) string
+}
+
+// loadDockerContextDir 从 docker CLI contexts 目录读取
+func loadDockerContextDir(dir string) (*dockerContextSource, error) {
+	src := &dockerContextSource{files: make(map[string][]byte)}
+	metaFiles, err := filepath.Glob(filepath.Join(dir, "meta", "*", "meta.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(metaFiles) == 0 {
+		return nil, fmt.Errorf("no docker contexts found in %s", dir)
+	}
+	for _, file := range metaFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		rel, _ := filepath.Rel(dir, file)
+		src.files[filepath.ToSlash(rel)] = data
+	}
+
+	src.tlsValue = func(rel string) string {
+		file := filepath.Join(dir, filepath.FromSlash(rel))
+		if _, err := os.Stat(file); err != nil {
+			return ""
+		}
+		return file
+	}
+	return src, nil
+}
+
+// loadDockerContextArchive 从 tar 归档读取，归档布局与 contexts 目录相同（由导出接口生成）
+func loadDockerContextArchive(r io.Reader) (*dockerContextSource, error) {
+	src := &dockerContextSource{files: make(map[string][]byte)}
+	tr := tar.NewReader(r)
+	var files int
+	var total int64
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read context archive: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if header.Size > maxDockerContextFile {
+			return nil, fmt.Errorf("file %s in context archive is too large", header.Name)
+		}
+		files++
+		total += header.Size
+		if files > maxDockerContextFiles {
+			return nil, fmt.Errorf("context archive contains more than %d files", maxDockerContextFiles)
+		}
+		if total > maxDockerContextBytes {
+			return nil, fmt.Errorf("context archive is larger than %d bytes", maxDockerContextBytes)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		src.files[path.Clean(strings.TrimPrefix(header.Name, "./"))] = data
+	}
+
+	src.tlsValue = func(rel string) string {
+		return string(src.files[rel])
+	}
+	return src, nil
+}
+
+// contexts 将 docker CLI context 转换为 ContextConfig，无法转换的记录在 skipped 中
+func (src *dockerContextSource) contexts(skipped map[string]string) []ContextConfig {
+	var configs []ContextConfig
+	for rel, data := range src.files {
+		if !strings.HasPrefix(rel, "meta/") || path.Base(rel) != "meta.json" {
+			continue
+		}
+
+		var meta dockerContextMeta
+		if err := json.Unmarshal(data, &meta); err != nil || meta.Name == "" {
+			skipped[rel] = "invalid meta.json"
+			continue
+		}
+		endpoint, ok := meta.Endpoints["docker"]
+		if !ok || endpoint.Host == "" {
+			skipped[meta.Name] = "no docker endpoint"
+			continue
+		}
+
+		config := ContextConfig{}
+		config.Name = meta.Name
+		config.Host = endpoint.Host
+		switch {
+		case strings.HasPrefix(endpoint.Host, "tcp://"):
+			config.Type = "tcp"
+		case strings.HasPrefix(endpoint.Host, "unix://"):
+			config.Type = "socket"
+		case strings.HasPrefix(endpoint.Host, "ssh://"):
+			config.Type = "ssh"
+		default:
+			skipped[meta.Name] = fmt.Sprintf("unsupported endpoint %s", endpoint.Host)
+			continue
+		}
+
+		if config.Type == "tcp" {
+			tlsDir := path.Join("tls", dockerContextID(meta.Name), "docker")
+			config.TLSCACert = src.tlsValue(path.Join(tlsDir, "ca.pem"))
+			config.TLSCert = src.tlsValue(path.Join(tlsDir, "cert.pem"))
+			config.TLSKey = src.tlsValue(path.Join(tlsDir, "key.pem"))
+			config.TLSSkipVerify = endpoint.SkipTLSVerify
+		}
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+// ImportDockerContexts 从服务端 docker CLI 的 contexts 目录导入
+func (s *DockerService) ImportDockerContexts(opts ContextImportOptions) (ContextImportResult, error) {
+	dir, err := dockerContextDir()
+	if err != nil {
+		return ContextImportResult{}, err
+	}
+
+	src, err := loadDockerContextDir(dir)
+	if err != nil {
+		return ContextImportResult{}, err
+	}
+	return s.importDockerContexts(src, opts)
+}
+
+// ImportDockerContextArchive 从导出接口生成的 tar 归档导入
+func (s *DockerService) ImportDockerContextArchive(r io.Reader, opts ContextImportOptions) (ContextImportResult, error) {
+	src, err := loadDockerContextArchive(r)
+	if err != nil {
+		return ContextImportResult{}, err
+	}
+	return s.importDockerContexts(src, opts)
+}
+
+func (s *DockerService) importDockerContexts(src *dockerContextSource, opts ContextImportOptions) (ContextImportResult, error) {
+	result := ContextImportResult{Imported: []string{}, Skipped: map[string]string{}}
+
+	wanted := make(map[string]bool)
+	for _, name := range opts.Names {
+		wanted[name] = true
+	}
+
+	for _, ctx := range src.contexts(result.Skipped) {
+		if len(wanted) > 0 && !wanted[ctx.Name] {
+			continue
+		}
+		_, exists, err := s.contexts.Get(ctx.Name)
+		if err != nil {
+			return result, err
+		}
+		if exists && !opts.Overwrite {
+			result.Skipped[ctx.Name] = "context already exists"
+			continue
+		}
+		if err := ctx.Validate(); err != nil {
+			result.Skipped[ctx.Name] = err.Error()
+			continue
+		}
+
+		if err := s.contexts.Put(ctx.DockerContext); err != nil {
+			return result, err
+		}
+		s.clients.evict(ctx.Name)
+		result.Imported = append(result.Imported, ctx.Name)
+	}
+
+	return result, nil
+}
+
+// ExportDockerContexts 将 context 以 docker CLI contexts 目录的布局写入 tar 归档，
+// 解压到 ~/.docker/contexts 即可被 docker CLI 使用；names 为空时导出全部
+func (s *DockerService) ExportDockerContexts(names []string, w io.Writer) error {
+	contexts, err := s.ListContexts(ContextFilter{})
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	writeFile := func(name string, data []byte, mode int64) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    mode,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	for _, ctx := range contexts {
+		if len(wanted) > 0 && !wanted[ctx.Name] {
+			continue
+		}
+		id := dockerContextID(ctx.Name)
+
+		meta := dockerContextMeta{
+			Name:     ctx.Name,
+			Metadata: map[string]interface{}{},
+			Endpoints: map[string]dockerEndpoint{
+				"docker": {Host: ctx.Host, SkipTLSVerify: ctx.TLSSkipVerify},
+			},
+		}
+		data, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(path.Join("meta", id, "meta.json"), data, 0644); err != nil {
+			return err
+		}
+
+		tlsFiles := []struct {
+			name  string
+			value string
+			mode  int64
+		}{
+			{"ca.pem", ctx.TLSCACert, 0644},
+			{"cert.pem", ctx.TLSCert, 0644},
+			{"key.pem", ctx.TLSKey, 0600},
+		}
+		for _, f := range tlsFiles {
+			if f.value == "" {
+				continue
+			}
+			pem, err := readPEM(f.value)
+			if err != nil {
+				return fmt.Errorf("failed to read %s of context %s: %v", f.name, ctx.Name, err)
+			}
+			if err := writeFile(path.Join("tls", id, "docker", f.name), pem, f.mode); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func contextArchive(t *testing.T, files int, size int) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	data := bytes.Repeat([]byte("x"), size)
+	for i := 0; i < files; i++ {
+		if err := tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("meta/%d/meta.json", i), Mode: 0644, Size: int64(size)}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestLoadDockerContextArchiveLimits(t *testing.T) {
+	src, err := loadDockerContextArchive(contextArchive(t, 2, 16))
+	if err != nil || len(src.files) != 2 {
+		t.Fatalf("expected 2 files, got %v %v", src, err)
+	}
+
+	tests := []struct {
+		name  string
+		files int
+		size  int
+		want  string
+	}{
+		{name: "file too large", files: 1, size: maxDockerContextFile + 1, want: "too large"},
+		{name: "too many files", files: maxDockerContextFiles + 1, size: 1, want: "more than"},
+		{name: "archive too large", files: maxDockerContextBytes/maxDockerContextFile + 1, size: maxDockerContextFile, want: "larger than"},
+	}
+	for _, tt := range tests {
+		if _, err := loadDockerContextArchive(contextArchive(t, tt.files, tt.size)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q error, got %v", tt.name, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// readPEM 读取 PEM 内容，value 可以是文件路径或直接填写的 PEM 文本
+func readPEM(value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value)
+}
+
+// contextTLSConfig 根据 context 配置构建 TLS 客户端配置
+func contextTLSConfig(c ContextConfig) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.TLSSkipVerify,
+	}
+
+	if c.TLSCACert != "" {
+		caPEM, err := readPEM(c.TLSCACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls ca certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("failed to parse tls ca certificate")
+		}
+		config.RootCAs = pool
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return nil, fmt.Errorf("tls client certificate and key must be provided together")
+	}
+	if c.TLSCert != "" {
+		certPEM, err := readPEM(c.TLSCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls client certificate: %v", err)
+		}
+		keyPEM, err := readPEM(c.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls client key: %v", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// withContextTLS 将 TLS 配置应用到 client 的 transport，必须在 client.WithHost 之后使用
+func withContextTLS(tlsConfig *tls.Config) client.Opt {
+	return func(c *client.Client) error {
+		transport, ok := c.HTTPClient().Transport.(*http.Transport)
+		if !ok {
+			return fmt.Errorf("cannot apply tls config to transport: %T", c.HTTPClient().Transport)
+		}
+		transport.TLSClientConfig = tlsConfig
+		return nil
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2024, 1, 31, 10, 30, 15, 0, time.UTC) // 周三
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 2, 1, 3, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 9 1-7 * 1", time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)}, // 日和周任一匹配
+		{"30 10 31 1 *", time.Date(2025, 1, 31, 10, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := schedule.Next(base); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextHalfHourZone(t *testing.T) {
+	for _, loc := range []*time.Location{time.FixedZone("IST", 5*3600+30*60), time.FixedZone("NPT", 5*3600+45*60)} {
+		schedule, err := ParseCron("0 3 * * *")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := time.Date(2024, 2, 1, 3, 0, 0, 0, loc)
+		if got := schedule.Next(time.Date(2024, 1, 31, 10, 30, 0, 0, loc)); !got.Equal(want) {
+			t.Errorf("Next in %s = %v, want %v", loc, got, want)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) expected error", expr)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// 探测单个地址的超时时间
+const discoveryTimeout = 2 * time.Second
+
+// DiscoveredContext 本机发现的 Docker 兼容守护进程，作为建议的 context 返回
+type DiscoveredContext struct {
+	Name          string `json:"name"`   // 建议的 context 名称
+	Source        string `json:"source"` // docker、rootless、desktop、podman、colima、lima 或 env
+	Host          string `json:"host"`
+	ServerVersion string `json:"serverVersion"`
+	Registered    bool   `json:"registered"` // 是否已存在相同地址的 context
+}
+
+// discoveryCandidate 待探测的地址
+type discoveryCandidate struct {
+	name   string
+	source string
+	socket string
+}
+
+// discovery 保存最近一次探测结果
+type discovery struct {
+	mu      sync.RWMutex
+	results []DiscoveredContext
+	done    bool
+}
+
+// discoveryCandidates 返回本机常见的 Docker 兼容 socket 路径
+func discoveryCandidates() []discoveryCandidate {
+	candidates := []discoveryCandidate{
+		{"local", "docker", "/var/run/docker.sock"},
+		{"podman", "podman", "/run/podman/podman.sock"},
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	candidates = append(candidates,
+		discoveryCandidate{"rootless", "rootless", filepath.Join(runtimeDir, "docker.sock")},
+		discoveryCandidate{"podman-rootless", "podman", filepath.Join(runtimeDir, "podman", "podman.sock")},
+	)
+
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates,
+			discoveryCandidate{"desktop", "desktop", filepath.Join(home, ".docker", "run", "docker.sock")},
+			discoveryCandidate{"colima", "colima", filepath.Join(home, ".colima", "default", "docker.sock")},
+			discoveryCandidate{"colima", "colima", filepath.Join(home, ".colima", "docker.sock")},
+			discoveryCandidate{"lima", "lima", filepath.Join(home, ".lima", "docker", "sock", "docker.sock")},
+		)
+	}
+	return candidates
+}
+
+// socketKey 解析符号链接，避免同一个 socket 以不同路径出现多次（例如 /var/run -> /run）
+func socketKey(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// probeDockerHost 连接并获取守护进程版本，不可用时返回错误
+func probeDockerHost(host string) (string, error) {
+	cli, err := client.NewClientWithOpts(client.WithHost(host), client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	version, err := cli.ServerVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	return version.Version, nil
+}
+
+// DiscoverContexts 探测本机常见的 Docker/Podman socket 并保存结果，启动时在后台调用
+func (s *DockerService) DiscoverContexts() []DiscoveredContext {
+	var hosts []discoveryCandidate
+	seen := make(map[string]bool)
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		hosts = append(hosts, discoveryCandidate{name: "env", source: "env", socket: host})
+		seen[socketKey(strings.TrimPrefix(host, "unix://"))] = true
+	}
+	for _, candidate := range discoveryCandidates() {
+		if _, err := os.Stat(candidate.socket); err != nil {
+			continue
+		}
+		key := socketKey(candidate.socket)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		candidate.socket = "unix://" + candidate.socket
+		hosts = append(hosts, candidate)
+	}
+
+	results := make([]DiscoveredContext, len(hosts))
+	found := make([]bool, len(hosts))
+	var wg sync.WaitGroup
+	for i, candidate := range hosts {
+		wg.Add(1)
+		go func(i int, candidate discoveryCandidate) {
+			defer wg.Done()
+			version, err := probeDockerHost(candidate.socket)
+			if err != nil {
+				return
+			}
+			results[i] = DiscoveredContext{
+				Name:          candidate.name,
+				Source:        candidate.source,
+				Host:          candidate.socket,
+				ServerVersion: version,
+			}
+			found[i] = true
+		}(i, candidate)
+	}
+	wg.Wait()
+
+	discovered := make([]DiscoveredContext, 0, len(hosts))
+	for i := range results {
+		if found[i] {
+			discovered = append(discovered, results[i])
+		}
+	}
+
+	s.discovery.mu.Lock()
+	s.discovery.results = discovered
+	s.discovery.done = true
+	s.discovery.mu.Unlock()
+	return s.markRegistered(discovered)
+}
+
+// DiscoveredContexts 返回最近一次探测结果，尚未探测时立即探测
+func (s *DockerService) DiscoveredContexts() []DiscoveredContext {
+	s.discovery.mu.RLock()
+	done := s.discovery.done
+	results := append([]DiscoveredContext(nil), s.discovery.results...)
+	s.discovery.mu.RUnlock()
+
+	if !done {
+		return s.DiscoverContexts()
+	}
+	return s.markRegistered(results)
+}
+
+// markRegistered 标记已存在相同地址的 context
+func (s *DockerService) markRegistered(discovered []DiscoveredContext) []DiscoveredContext {
+	contexts, err := s.contexts.List()
+	if err != nil {
+		return discovered
+	}
+	hosts := make(map[string]bool, len(contexts))
+	for _, ctx := range contexts {
+		hosts[ctx.Host] = true
+	}
+
+	marked := make([]DiscoveredContext, len(discovered))
+	for i, d := range discovered {
+		d.Registered = hosts[d.Host]
+		marked[i] = d
+	}
+	return marked
+}
@@ -4,10 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -17,13 +17,21 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
+
+	"github.com/smartcat999/container-ui/internal/config"
 )
 
 type DockerService struct {
-	clients map[string]*client.Client // 存储多个 context 的 client
+	contexts config.ContextStore // context 配置存储
+	clients  *clientPool         // 按 context 缓存的 client 连接池
+
+	discovery discovery // 本机 Docker socket 探测结果
 }
 
 type ContainerInfo struct {
@@ -34,6 +42,38 @@ type ContainerInfo struct {
 	State   string `json:"state"`
 	Created int64  `json:"created"`
 	Ports   []Port `json:"ports"`
+	Health  string `json:"health,omitempty"` // healthy/unhealthy/starting，未配置健康检查时为空
+}
+
+// ContainerFilter 容器列表过滤、排序和分页条件
+type ContainerFilter struct {
+	Health string   // healthy/unhealthy/starting/none
+	State  string   // created/running/paused/restarting/exited/dead
+	Name   string   // 容器名称正则表达式
+	Image  string   // 镜像名称或 ID，匹配由该镜像派生的容器
+	Labels []string // 标签选择器，格式为 key 或 key=value
+	Sort   string   // created/name/state，默认为 created
+	Desc   bool     // 是否倒序
+	Limit  int      // 为 0 时不分页
+	Offset int
+}
+
+// Validate 检查过滤条件是否合法
+func (f ContainerFilter) Validate() error {
+	switch f.Sort {
+	case "", "created", "name", "state":
+	default:
+		return fmt.Errorf("invalid sort field: %s", f.Sort)
+	}
+	if f.Limit < 0 || f.Offset < 0 {
+		return fmt.Errorf("limit and offset must not be negative")
+	}
+	if f.Name != "" {
+		if _, err := regexp.Compile(f.Name); err != nil {
+			return fmt.Errorf("invalid name pattern: %v", err)
+		}
+	}
+	return nil
 }
 
 type Port struct {
@@ -51,6 +91,18 @@ type ImageInfo struct {
 	Created    int64  `json:"created"`
 }
 
+// ImageLayer 镜像历史中的一层
+type ImageLayer struct {
+	ID             string   `json:"id"`
+	Created        int64    `json:"created"`
+	CreatedBy      string   `json:"createdBy"`
+	Tags           []string `json:"tags"`
+	Size           int64    `json:"size"`
+	Comment        string   `json:"comment"`
+	EmptyLayer     bool     `json:"emptyLayer"`     // 不产生文件系统变更的层，例如 ENV、CMD
+	CumulativeSize int64    `json:"cumulativeSize"` // 从基础层累计到当前层的大小
+}
+
 type NetworkInfo struct {
 	ID      string       `json:"id"`
 	Name    string       `json:"name"`
@@ -60,6 +112,28 @@ type NetworkInfo struct {
 	Created time.Time    `json:"created"`
 }
 
+// NetworkCreateConfig 网络创建配置
+type NetworkCreateConfig struct {
+	Name       string            `json:"name" binding:"required"`
+	Driver     string            `json:"driver"` // 默认 bridge
+	Subnet     string            `json:"subnet"`
+	Gateway    string            `json:"gateway"`
+	IPRange    string            `json:"ipRange"`
+	Internal   bool              `json:"internal"`
+	Attachable bool              `json:"attachable"`
+	EnableIPv6 bool              `json:"enableIPv6"`
+	Options    map[string]string `json:"options"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// NetworkConnectConfig 容器接入网络的配置
+type NetworkConnectConfig struct {
+	Container   string   `json:"container" binding:"required"`
+	Aliases     []string `json:"aliases"`
+	IPv4Address string   `json:"ipv4Address"`
+	IPv6Address string   `json:"ipv6Address"`
+}
+
 type VolumeInfo struct {
 	Name       string            `json:"name"`
 	Driver     string            `json:"driver"`
@@ -70,12 +144,45 @@ type VolumeInfo struct {
 	Options    map[string]string `json:"options"`
 }
 
-// ContextConfig 定义
+// RegistryAuth 镜像仓库认证信息
+type RegistryAuth struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	ServerAddress string `json:"serverAddress"`
+}
+
+// encodeRegistryAuth 将认证信息编码为 Docker API 需要的 X-Registry-Auth 格式
+func encodeRegistryAuth(auth *RegistryAuth) (string, error) {
+	if auth == nil || (auth.Username == "" && auth.Password == "") {
+		return "", nil
+	}
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		ServerAddress: auth.ServerAddress,
+	})
+}
+
+// ContextConfig 定义，在存储的配置之外标记是否为当前 context
 type ContextConfig struct {
-	Name    string `json:"name"`
-	Type    string `json:"type"` // tcp or socket
-	Host    string `json:"host"` // tcp://host:port 或 unix:///path/to/socket
-	Current bool   `json:"current"`
+	config.DockerContext
+	Current bool `json:"current"`
+}
+
+// Validate 检查 context 配置是否合法，除格式外还会检查 ssh 参数和 TLS 证书能否加载
+func (c *ContextConfig) Validate() error {
+	if err := c.DockerContext.Validate(); err != nil {
+		return err
+	}
+	if strings.HasPrefix(c.Host, "ssh://") {
+		_, err := sshDialer(*c)
+		return err
+	}
+	if c.UsesTLS() {
+		_, err := contextTLSConfig(*c)
+		return err
+	}
+	return nil
 }
 
 // 构建 Docker Host URL
@@ -110,6 +217,25 @@ type ContainerConfig struct {
 	NetworkMode   string
 }
 
+// ContainerUpdateConfig 容器资源更新配置，字段为 nil 表示不修改
+type ContainerUpdateConfig struct {
+	Memory        *int64  `json:"memory"`     // 内存限制，单位字节
+	MemorySwap    *int64  `json:"memorySwap"` // 内存+交换分区限制，-1 表示不限制
+	CPUShares     *int64  `json:"cpuShares"`
+	NanoCPUs      *int64  `json:"nanoCpus"` // CPU 配额，1e9 表示一个核心
+	RestartPolicy *string `json:"restartPolicy"`
+}
+
+// CommitConfig 容器提交为镜像的配置
+type CommitConfig struct {
+	Repository string   `json:"repository"`
+	Tag        string   `json:"tag"`
+	Author     string   `json:"author"`
+	Comment    string   `json:"comment"`
+	Changes    []string `json:"changes"` // Dockerfile 指令，例如 CMD ["nginx"]、ENV KEY=value
+	Pause      *bool    `json:"pause"`   // 提交期间是否暂停容器，默认 true
+}
+
 // PortMapping 端口映射
 type PortMapping struct {
 	Host      uint16
@@ -129,175 +255,307 @@ type VolumeMapping struct {
 	Mode      string
 }
 
-const (
-	configDir  = ".docker-contexts"
-	configFile = "contexts.json"
-)
+func NewDockerService(contexts config.ContextStore) (*DockerService, error) {
+	s := &DockerService{contexts: contexts}
+	s.clients = newClientPool(s.newClient)
+	go s.clients.run()
+	return s, nil
+}
 
-// 获取配置文件路径
-func getConfigPath() string {
-	dir := filepath.Join(".", configDir)
+// ErrReadOnlyContext 在只读 context 上执行修改操作时返回
+var ErrReadOnlyContext = errors.New("context is read-only")
 
-	// 确保配置目录存在
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			// 如果无法创建目录，使用当前目录
-			return filepath.Join(".", configFile)
-		}
+// CheckWritable 检查 context 是否允许修改操作
+func (s *DockerService) CheckWritable(contextName string) error {
+	ctx, ok, err := s.contexts.Get(contextName)
+	if err != nil {
+		return err
 	}
+	if ok && ctx.ReadOnly {
+		return fmt.Errorf("%w: %s", ErrReadOnlyContext, contextName)
+	}
+	return nil
+}
 
-	return filepath.Join(dir, configFile)
+// getClient 根据 context name 获取或创建对应的 Docker client
+func (s *DockerService) getClient(contextName string) (*client.Client, error) {
+	return s.clients.get(contextName)
 }
 
-// 读取配置
-func readConfig() (map[string]interface{}, error) {
-	configPath := getConfigPath()
+// newClient 根据 context 配置创建新的 Docker client
+func (s *DockerService) newClient(contextName string) (*client.Client, error) {
+	// 读取 context 配置
+	dockerContext, ok, err := s.contexts.Get(contextName)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("context %s not found", contextName)
+	}
+	contextConfig := ContextConfig{DockerContext: dockerContext}
+	if contextConfig.Host == "" {
+		return nil, fmt.Errorf("invalid host configuration for context %s", contextName)
+	}
 
-	// 如果文件不存在，创建默认配置
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		defaultConfig := map[string]interface{}{
-			"contexts":        make(map[string]interface{}),
-			"current-context": "",
-		}
-		data, err := json.MarshalIndent(defaultConfig, "", "  ")
+	opts := []client.Opt{client.WithAPIVersionNegotiation()}
+	if strings.HasPrefix(contextConfig.Host, "ssh://") {
+		// ssh 连接通过自定义拨号函数建立，Host 仅用于构造请求 URL
+		dialer, err := sshDialer(contextConfig)
 		if err != nil {
 			return nil, err
 		}
-		if err := os.WriteFile(configPath, data, 0644); err != nil {
-			return nil, err
+		opts = append(opts, client.WithHost("http://docker.example.com"), client.WithDialContext(dialer))
+	} else {
+		opts = append(opts, client.WithHost(contextConfig.Host))
+		if contextConfig.UsesTLS() {
+			tlsConfig, err := contextTLSConfig(contextConfig)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, withContextTLS(tlsConfig))
 		}
-		return defaultConfig, nil
 	}
 
-	// 读取现有配置
-	data, err := os.ReadFile(configPath)
+	// 创建新的 client
+	cli, err := client.NewClientWithOpts(opts...)
 	if err != nil {
-		return nil, err
-	}
-
-	var config map[string]interface{}
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to create docker client: %v", err)
 	}
 
-	return config, nil
+	return cli, nil
 }
 
-// 保存配置
-func saveConfig(config map[string]interface{}) error {
-	configPath := getConfigPath()
+// ListContainers 按过滤条件列出容器，返回当前页的容器和过滤后的总数
+func (s *DockerService) ListContainers(contextName string, filter ContainerFilter) ([]ContainerInfo, int, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, 0, err
+	}
 
-	data, err := json.MarshalIndent(config, "", "  ")
+	args := filters.NewArgs()
+	if filter.Health != "" {
+		args.Add("health", filter.Health)
+	}
+	if filter.State != "" {
+		args.Add("status", filter.State)
+	}
+	if filter.Image != "" {
+		args.Add("ancestor", filter.Image)
+	}
+	for _, label := range filter.Labels {
+		args.Add("label", label)
+	}
+
+	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{All: true, Filters: args})
 	if err != nil {
-		return err
+		return nil, 0, err
+	}
+
+	// Docker 的 name 过滤器会匹配带 "/" 前缀的名称，这里在服务端按去掉前缀后的名称匹配
+	var nameRe *regexp.Regexp
+	if filter.Name != "" {
+		nameRe = regexp.MustCompile(filter.Name)
+	}
+
+	containerInfos := make([]ContainerInfo, 0, len(containers))
+	for _, container := range containers {
+		info := toContainerInfo(container)
+		if nameRe != nil && !nameRe.MatchString(info.Name) {
+			continue
+		}
+		containerInfos = append(containerInfos, info)
+	}
+
+	sortContainers(containerInfos, filter.Sort, filter.Desc)
+
+	total := len(containerInfos)
+	if filter.Offset >= total {
+		return []ContainerInfo{}, total, nil
+	}
+	containerInfos = containerInfos[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(containerInfos) {
+		containerInfos = containerInfos[:filter.Limit]
 	}
 
-	return os.WriteFile(configPath, data, 0644)
+	return containerInfos, total, nil
 }
 
-func NewDockerService() (*DockerService, error) {
-	return &DockerService{
-		clients: make(map[string]*client.Client),
-	}, nil
+// sortContainers 按指定字段排序，字段相同时按名称排序以保证分页稳定
+func sortContainers(containers []ContainerInfo, field string, desc bool) {
+	less := func(a, b ContainerInfo) bool {
+		switch field {
+		case "name":
+			return a.Name < b.Name
+		case "state":
+			if a.State != b.State {
+				return a.State < b.State
+			}
+		default:
+			if a.Created != b.Created {
+				return a.Created < b.Created
+			}
+		}
+		return a.Name < b.Name
+	}
+	sort.SliceStable(containers, func(i, j int) bool {
+		if desc {
+			return less(containers[j], containers[i])
+		}
+		return less(containers[i], containers[j])
+	})
 }
 
-// getClient 根据 context name 获取或创建对应的 Docker client
-func (s *DockerService) getClient(contextName string) (*client.Client, error) {
-	// 检查是否已有该 context 的 client
-	if cli, exists := s.clients[contextName]; exists {
-		return cli, nil
+// toContainerInfo 将 Docker 容器列表项转换为 ContainerInfo
+func toContainerInfo(container types.Container) ContainerInfo {
+	// 处理容器名称，移除开头的 "/"
+	name := strings.TrimPrefix(container.Names[0], "/")
+
+	// 转换端口信息
+	var ports []Port
+	for _, p := range container.Ports {
+		ports = append(ports, Port{
+			IP:          p.IP,
+			PrivatePort: p.PrivatePort,
+			PublicPort:  p.PublicPort,
+			Type:        p.Type,
+		})
 	}
 
-	// 读取 context 配置
-	config, err := readConfig()
+	return ContainerInfo{
+		ID:      container.ID[:12], // 只显示ID的前12位
+		Name:    name,
+		Image:   container.Image,
+		Status:  container.Status,
+		State:   container.State,
+		Created: container.Created,
+		Ports:   ports,
+		Health:  parseHealthStatus(container.Status),
+	}
+}
+
+func (s *DockerService) StartContainer(contextName string, id string) error {
+	cli, err := s.getClient(contextName)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return cli.ContainerStart(context.Background(), id, types.ContainerStartOptions{})
+}
 
-	contexts, ok := config["contexts"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("no contexts found")
+func (s *DockerService) StopContainer(contextName string, id string) error {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return err
 	}
+	return cli.ContainerStop(context.Background(), id, container.StopOptions{})
+}
 
-	contextConfig, ok := contexts[contextName].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("context %s not found", contextName)
+// PauseContainer 暂停容器
+func (s *DockerService) PauseContainer(contextName string, id string) error {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return err
 	}
+	return cli.ContainerPause(context.Background(), id)
+}
 
-	host, _ := contextConfig["host"].(string)
-	if host == "" {
-		return nil, fmt.Errorf("invalid host configuration for context %s", contextName)
+// UnpauseContainer 恢复已暂停的容器
+func (s *DockerService) UnpauseContainer(contextName string, id string) error {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return err
 	}
+	return cli.ContainerUnpause(context.Background(), id)
+}
 
-	// 创建新的 client
-	cli, err := client.NewClientWithOpts(
-		client.WithHost(host),
-		client.WithAPIVersionNegotiation(),
-	)
+// RestartContainer 重启容器，timeout 为等待容器停止的秒数，为 nil 时使用容器默认值
+func (s *DockerService) RestartContainer(contextName string, id string, timeout *int) error {
+	cli, err := s.getClient(contextName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create docker client: %v", err)
+		return err
 	}
+	return cli.ContainerRestart(context.Background(), id, container.StopOptions{Timeout: timeout})
+}
 
-	// 保存 client
-	s.clients[contextName] = cli
-	return cli, nil
+// KillContainer 向容器发送信号，signal 为空时默认 SIGKILL
+func (s *DockerService) KillContainer(contextName string, id string, signal string) error {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return err
+	}
+	return cli.ContainerKill(context.Background(), id, signal)
 }
 
-func (s *DockerService) ListContainers(contextName string) ([]ContainerInfo, error) {
+// RenameContainer 重命名容器
+func (s *DockerService) RenameContainer(contextName string, id string, name string) error {
 	cli, err := s.getClient(contextName)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return cli.ContainerRename(context.Background(), id, name)
+}
 
-	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{All: true})
+// UpdateContainer 在线调整容器资源限制和重启策略，返回 Docker 给出的警告信息
+func (s *DockerService) UpdateContainer(contextName string, id string, config ContainerUpdateConfig) ([]string, error) {
+	cli, err := s.getClient(contextName)
 	if err != nil {
 		return nil, err
 	}
 
-	var containerInfos []ContainerInfo
-	for _, container := range containers {
-		// 处理容器名称，移除开头的 "/"
-		name := strings.TrimPrefix(container.Names[0], "/")
-
-		// 转换端口信息
-		var ports []Port
-		for _, p := range container.Ports {
-			ports = append(ports, Port{
-				IP:          p.IP,
-				PrivatePort: p.PrivatePort,
-				PublicPort:  p.PublicPort,
-				Type:        p.Type,
-			})
-		}
-
-		containerInfos = append(containerInfos, ContainerInfo{
-			ID:      container.ID[:12], // 只显示ID的前12位
-			Name:    name,
-			Image:   container.Image,
-			Status:  container.Status,
-			State:   container.State,
-			Created: container.Created,
-			Ports:   ports,
-		})
+	var updateConfig container.UpdateConfig
+	if config.Memory != nil {
+		updateConfig.Memory = *config.Memory
+	}
+	if config.MemorySwap != nil {
+		updateConfig.MemorySwap = *config.MemorySwap
+	}
+	if config.CPUShares != nil {
+		updateConfig.CPUShares = *config.CPUShares
+	}
+	if config.NanoCPUs != nil {
+		updateConfig.NanoCPUs = *config.NanoCPUs
+	}
+	if config.RestartPolicy != nil {
+		updateConfig.RestartPolicy = parseRestartPolicy(*config.RestartPolicy)
 	}
 
-	return containerInfos, nil
+	resp, err := cli.ContainerUpdate(context.Background(), id, updateConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update container: %v", err)
+	}
+	return resp.Warnings, nil
 }
 
-func (s *DockerService) StartContainer(contextName string, id string) error {
+// CommitContainer 将容器当前状态提交为新镜像，返回新镜像 ID
+func (s *DockerService) CommitContainer(contextName string, id string, config CommitConfig) (string, error) {
 	cli, err := s.getClient(contextName)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return cli.ContainerStart(context.Background(), id, types.ContainerStartOptions{})
-}
 
-func (s *DockerService) StopContainer(contextName string, id string) error {
-	cli, err := s.getClient(contextName)
+	reference := config.Repository
+	if reference != "" && config.Tag != "" {
+		reference = reference + ":" + config.Tag
+	}
+
+	pause := true
+	if config.Pause != nil {
+		pause = *config.Pause
+	}
+
+	resp, err := cli.ContainerCommit(context.Background(), id, types.ContainerCommitOptions{
+		Reference: reference,
+		Comment:   config.Comment,
+		Author:    config.Author,
+		Changes:   config.Changes,
+		Pause:     pause,
+	})
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to commit container: %v", err)
 	}
-	return cli.ContainerStop(context.Background(), id, container.StopOptions{})
+	return resp.ID, nil
 }
 
 func (s *DockerService) GetContainerDetail(contextName string, id string) (types.ContainerJSON, error) {
@@ -344,13 +602,173 @@ func (s *DockerService) ListImages(contextName string) ([]ImageInfo, error) {
 	return imageInfos, nil
 }
 
-func (s *DockerService) DeleteImage(contextName string, id string) error {
+// PullImage 拉取镜像，返回 Docker 输出的 JSON 进度消息流，调用方负责关闭
+func (s *DockerService) PullImage(contextName string, ref string, auth *RegistryAuth) (io.ReadCloser, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	registryAuth, err := encodeRegistryAuth(auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode registry auth: %v", err)
+	}
+
+	reader, err := cli.ImagePull(context.Background(), ref, types.ImagePullOptions{
+		RegistryAuth: registryAuth,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull image: %v", err)
+	}
+	return reader, nil
+}
+
+// waitJSONMessages 读取完 Docker 的 JSON 进度消息流，流中包含错误消息时返回该错误
+// 拉取/推送失败时 Docker 仍返回 200，错误只出现在消息流中
+func waitJSONMessages(reader io.Reader) error {
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("%s", msg.Error)
+		}
+	}
+}
+
+// PushImage 为镜像打上目标标签并推送，返回 Docker 输出的 JSON 进度消息流，调用方负责关闭
+func (s *DockerService) PushImage(contextName string, id string, target string, auth *RegistryAuth) (io.ReadCloser, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	// 目标引用与源镜像不同时，先打标签
+	if target != id {
+		if err := cli.ImageTag(context.Background(), id, target); err != nil {
+			return nil, fmt.Errorf("failed to tag image: %v", err)
+		}
+	}
+
+	registryAuth, err := encodeRegistryAuth(auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode registry auth: %v", err)
+	}
+	if registryAuth == "" {
+		// 推送接口要求携带 X-Registry-Auth，未提供认证时发送空配置
+		registryAuth, _ = registry.EncodeAuthConfig(registry.AuthConfig{})
+	}
+
+	reader, err := cli.ImagePush(context.Background(), target, types.ImagePushOptions{
+		RegistryAuth: registryAuth,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to push image: %v", err)
+	}
+	return reader, nil
+}
+
+// ImportImage 从 tar 包（可压缩）导入镜像，返回 Docker 输出的 JSON 消息流，调用方负责关闭
+func (s *DockerService) ImportImage(contextName string, source io.Reader, ref string, message string, changes []string) (io.ReadCloser, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := cli.ImageImport(context.Background(), types.ImageImportSource{
+		Source:     source,
+		SourceName: "-",
+	}, ref, types.ImageImportOptions{
+		Message: message,
+		Changes: changes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import image: %v", err)
+	}
+	return reader, nil
+}
+
+// SaveImages 将一个或多个镜像导出为 tar 流，调用方负责关闭
+func (s *DockerService) SaveImages(contextName string, ids []string) (io.ReadCloser, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := cli.ImageSave(context.Background(), ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save image: %v", err)
+	}
+	return reader, nil
+}
+
+// LoadImages 从 tar 流加载镜像，返回 Docker 的输出以及输出是否为 JSON 消息流，调用方负责关闭
+func (s *DockerService) LoadImages(contextName string, input io.Reader) (io.ReadCloser, bool, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := cli.ImageLoad(context.Background(), input, false)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load image: %v", err)
+	}
+	return resp.Body, resp.JSON, nil
+}
+
+// DeleteImage 删除整个镜像，镜像存在多个标签或被已停止容器引用时需要 force
+func (s *DockerService) DeleteImage(contextName string, id string, force bool) ([]types.ImageDeleteResponseItem, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+	return cli.ImageRemove(context.Background(), id, types.ImageRemoveOptions{Force: force})
+}
+
+// TagImage 为镜像添加新的 repository:tag 引用
+func (s *DockerService) TagImage(contextName string, id string, target string) error {
 	cli, err := s.getClient(contextName)
 	if err != nil {
 		return err
 	}
-	_, err = cli.ImageRemove(context.Background(), id, types.ImageRemoveOptions{Force: false})
-	return err
+	if err := cli.ImageTag(context.Background(), id, target); err != nil {
+		return fmt.Errorf("failed to tag image: %v", err)
+	}
+	return nil
+}
+
+// UntagImage 仅移除镜像的某个标签引用
+// 若该标签是镜像唯一的引用，Docker 会直接删除镜像，因此这种情况下拒绝操作，应改用 DeleteImage
+func (s *DockerService) UntagImage(contextName string, id string, ref string) ([]types.ImageDeleteResponseItem, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	inspect, _, err := cli.ImageInspectWithRaw(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, tag := range inspect.RepoTags {
+		if tag == ref {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("tag %s does not belong to image %s", ref, id)
+	}
+	if len(inspect.RepoTags) == 1 {
+		return nil, fmt.Errorf("tag %s is the only reference of image %s, delete the image instead", ref, id)
+	}
+
+	return cli.ImageRemove(context.Background(), ref, types.ImageRemoveOptions{})
 }
 
 func (s *DockerService) CreateContainer(contextName string, config ContainerConfig) error {
@@ -393,17 +811,7 @@ func (s *DockerService) CreateContainer(contextName string, config ContainerConf
 	}
 
 	// 准备重启策略
-	var restartPolicy container.RestartPolicy
-	switch config.RestartPolicy {
-	case "always":
-		restartPolicy = container.RestartPolicy{Name: "always"}
-	case "unless-stopped":
-		restartPolicy = container.RestartPolicy{Name: "unless-stopped"}
-	case "on-failure":
-		restartPolicy = container.RestartPolicy{Name: "on-failure"}
-	default:
-		restartPolicy = container.RestartPolicy{Name: "no"}
-	}
+	restartPolicy := parseRestartPolicy(config.RestartPolicy)
 
 	// 准备命令和参数
 	var cmd []string
@@ -475,6 +883,53 @@ func (s *DockerService) CreateContainer(contextName string, config ContainerConf
 	return nil
 }
 
+// parseRestartPolicy 将重启策略名称转换为 Docker 重启策略，未知名称按 "no" 处理
+func parseRestartPolicy(name string) container.RestartPolicy {
+	switch name {
+	case "always":
+		return container.RestartPolicy{Name: "always"}
+	case "unless-stopped":
+		return container.RestartPolicy{Name: "unless-stopped"}
+	case "on-failure":
+		return container.RestartPolicy{Name: "on-failure"}
+	default:
+		return container.RestartPolicy{Name: "no"}
+	}
+}
+
+// GetImageHistory 获取镜像的分层历史，顺序与 docker history 一致（最新的层在前）
+func (s *DockerService) GetImageHistory(contextName string, id string) ([]ImageLayer, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := cli.ImageHistory(context.Background(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image history: %v", err)
+	}
+
+	layers := make([]ImageLayer, len(history))
+	var cumulative int64
+	// Docker 返回的历史最新层在前，从最底层开始累计大小
+	for i := len(history) - 1; i >= 0; i-- {
+		item := history[i]
+		cumulative += item.Size
+		layers[i] = ImageLayer{
+			ID:             item.ID,
+			Created:        item.Created,
+			CreatedBy:      item.CreatedBy,
+			Tags:           item.Tags,
+			Size:           item.Size,
+			Comment:        item.Comment,
+			EmptyLayer:     item.Size == 0,
+			CumulativeSize: cumulative,
+		}
+	}
+
+	return layers, nil
+}
+
 func (s *DockerService) GetImageDetail(contextName string, id string) (types.ImageInspect, error) {
 	cli, err := s.getClient(contextName)
 	if err != nil {
@@ -521,6 +976,78 @@ func (s *DockerService) GetNetworkDetail(contextName string, id string) (types.N
 	return cli.NetworkInspect(context.Background(), id, types.NetworkInspectOptions{})
 }
 
+// CreateNetwork 创建网络，返回网络 ID 和 Docker 给出的警告
+func (s *DockerService) CreateNetwork(contextName string, config NetworkCreateConfig) (string, string, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return "", "", err
+	}
+
+	driver := config.Driver
+	if driver == "" {
+		driver = "bridge"
+	}
+
+	options := types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         driver,
+		Internal:       config.Internal,
+		Attachable:     config.Attachable,
+		EnableIPv6:     config.EnableIPv6,
+		Options:        config.Options,
+		Labels:         config.Labels,
+	}
+
+	// 只有在指定子网时才设置 IPAM
+	if config.Subnet != "" {
+		options.IPAM = &network.IPAM{
+			Driver: "default",
+			Config: []network.IPAMConfig{{
+				Subnet:  config.Subnet,
+				Gateway: config.Gateway,
+				IPRange: config.IPRange,
+			}},
+		}
+	} else if config.Gateway != "" || config.IPRange != "" {
+		return "", "", fmt.Errorf("subnet is required when gateway or ip range is set")
+	}
+
+	resp, err := cli.NetworkCreate(context.Background(), config.Name, options)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create network: %v", err)
+	}
+	return resp.ID, resp.Warning, nil
+}
+
+// ConnectNetwork 将容器接入网络
+func (s *DockerService) ConnectNetwork(contextName string, id string, config NetworkConnectConfig) error {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return err
+	}
+
+	settings := &network.EndpointSettings{
+		Aliases: config.Aliases,
+	}
+	if config.IPv4Address != "" || config.IPv6Address != "" {
+		settings.IPAMConfig = &network.EndpointIPAMConfig{
+			IPv4Address: config.IPv4Address,
+			IPv6Address: config.IPv6Address,
+		}
+	}
+
+	return cli.NetworkConnect(context.Background(), id, config.Container, settings)
+}
+
+// DisconnectNetwork 将容器从网络断开
+func (s *DockerService) DisconnectNetwork(contextName string, id string, containerID string, force bool) error {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return err
+	}
+	return cli.NetworkDisconnect(context.Background(), id, containerID, force)
+}
+
 func (s *DockerService) DeleteNetwork(contextName string, id string) error {
 	cli, err := s.getClient(contextName)
 	if err != nil {
@@ -601,52 +1128,42 @@ func (s *DockerService) GetContainerLogs(contextName string, id string) (string,
 	return buf.String(), nil
 }
 
-func (s *DockerService) ListContexts() ([]ContextConfig, error) {
-	config, err := readConfig()
+// ContextFilter context 列表过滤条件
+type ContextFilter struct {
+	Group  string   // 只返回该分组的 context
+	Labels []string // 标签选择器，格式为 key 或 key=value，需全部匹配
+}
+
+// Match 判断 context 是否匹配过滤条件
+func (f ContextFilter) Match(ctx config.DockerContext) bool {
+	if f.Group != "" && ctx.Group != f.Group {
+		return false
+	}
+	return ctx.MatchLabels(f.Labels)
+}
+
+func (s *DockerService) ListContexts(filter ContextFilter) ([]ContextConfig, error) {
+	contexts, err := s.contexts.List()
 	if err != nil {
 		return nil, err
 	}
-
-	currentCtx, _ := config["current-context"].(string)
-	contextsMap, ok := config["contexts"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("no contexts found")
+	current, err := s.contexts.Current()
+	if err != nil {
+		return nil, err
 	}
 
-	var contextConfigs []ContextConfig
-	var currentConfig *ContextConfig
-
-	for name, ctx := range contextsMap {
-		contextConfig, ok := ctx.(map[string]interface{})
-		if !ok {
+	// 存储按名称排序返回，当前上下文放在列表开头
+	contextConfigs := make([]ContextConfig, 0, len(contexts))
+	for _, ctx := range contexts {
+		if !filter.Match(ctx) {
 			continue
 		}
-
-		contextType, _ := contextConfig["type"].(string)
-		host, _ := contextConfig["host"].(string)
-
-		config := ContextConfig{
-			Name:    name,
-			Type:    contextType,
-			Host:    host,
-			Current: name == currentCtx,
-		}
-
-		if name == currentCtx {
-			currentConfig = &config
-		} else {
-			contextConfigs = append(contextConfigs, config)
+		config := ContextConfig{DockerContext: ctx, Current: ctx.Name == current}
+		if config.Current {
+			contextConfigs = append([]ContextConfig{config}, contextConfigs...)
+			continue
 		}
-	}
-
-	// 按名称排序非当前上下文
-	sort.Slice(contextConfigs, func(i, j int) bool {
-		return contextConfigs[i].Name < contextConfigs[j].Name
-	})
-
-	// 将当前上下文插入到列表开头
-	if currentConfig != nil {
-		contextConfigs = append([]ContextConfig{*currentConfig}, contextConfigs...)
+		contextConfigs = append(contextConfigs, config)
 	}
 
 	return contextConfigs, nil
@@ -654,110 +1171,77 @@ func (s *DockerService) ListContexts() ([]ContextConfig, error) {
 
 func (s *DockerService) CreateContext(config ContextConfig) error {
 	// 创建 context 时不再自动切换和创建 client
-	currentConfig, err := readConfig()
-	if err != nil {
+	if err := config.Validate(); err != nil {
 		return err
 	}
-
-	contexts, ok := currentConfig["contexts"].(map[string]interface{})
-	if !ok {
-		contexts = make(map[string]interface{})
-		currentConfig["contexts"] = contexts
-	}
-
-	contexts[config.Name] = map[string]interface{}{
-		"type": config.Type,
-		"host": config.Host,
+	if err := s.contexts.Put(config.DockerContext); err != nil {
+		return err
 	}
 
-	return saveConfig(currentConfig)
+	// 覆盖同名 context 时丢弃旧的 client
+	s.clients.evict(config.Name)
+	return nil
 }
 
 func (s *DockerService) DeleteContext(name string) error {
-	config, err := readConfig()
+	removed, err := s.contexts.Remove(name)
 	if err != nil {
 		return err
 	}
-
-	// 检查是否为当前使用的上下文
-	if currentContext, ok := config["current-context"].(string); ok && currentContext == name {
-		return fmt.Errorf("cannot delete current context: %s", name)
-	}
-
-	contexts, ok := config["contexts"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("no contexts found")
-	}
-
-	if _, exists := contexts[name]; !exists {
+	if !removed {
 		return fmt.Errorf("context %s not found", name)
 	}
 
-	delete(contexts, name)
-	return saveConfig(config)
+	s.clients.evict(name)
+	return nil
 }
 
 func (s *DockerService) GetContextConfig(name string) (string, error) {
-	config, err := readConfig()
+	ctx, ok, err := s.contexts.Get(name)
 	if err != nil {
 		return "", err
 	}
-
-	contexts, ok := config["contexts"].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("no contexts found")
-	}
-
-	contextConfig, ok := contexts[name].(map[string]interface{})
 	if !ok {
 		return "", fmt.Errorf("context %s not found", name)
 	}
 
-	host, ok := contextConfig["host"].(string)
-	if !ok {
-		return "", fmt.Errorf("invalid host configuration for context %s", name)
-	}
-
-	return host, nil
+	return ctx.Host, nil
 }
 
-func (s *DockerService) UpdateContextConfig(name string, config ContextConfig) error {
-	currentConfig, err := readConfig()
-	if err != nil {
+// RestoreTLSKey 更新时没有提交私钥且客户端证书未变化时沿用已保存的私钥，列表接口不返回内联私钥
+func (s *DockerService) RestoreTLSKey(name string, config *ContextConfig) error {
+	if config.TLSKey != "" || config.TLSCert == "" {
+		return nil
+	}
+	old, ok, err := s.contexts.Get(name)
+	if err != nil || !ok {
 		return err
 	}
-
-	contexts, ok := currentConfig["contexts"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("no contexts found")
+	if old.TLSCert == config.TLSCert {
+		config.TLSKey = old.TLSKey
 	}
+	return nil
+}
 
-	if _, exists := contexts[name]; !exists {
+func (s *DockerService) UpdateContextConfig(name string, config ContextConfig) error {
+	if _, ok, err := s.contexts.Get(name); err != nil {
+		return err
+	} else if !ok {
 		return fmt.Errorf("context %s not found", name)
 	}
 
-	// 更新配置
-	contexts[name] = map[string]interface{}{
-		"type": config.Type,
-		"host": config.Host,
+	// 更新配置，名称以 URL 中的为准
+	config.Name = name
+	if err := config.Validate(); err != nil {
+		return err
 	}
-
-	// 如果是当前上下文，更新 Docker 客户端
-	if currentContext, ok := currentConfig["current-context"].(string); ok && currentContext == name {
-		dockerHost := buildDockerHost(config)
-		os.Setenv("DOCKER_HOST", dockerHost)
-
-		cli, err := client.NewClientWithOpts(
-			client.FromEnv,
-			client.WithAPIVersionNegotiation(),
-		)
-		if err != nil {
-			return fmt.Errorf("failed to create docker client: %v", err)
-		}
-		s.clients[name] = cli
+	if err := s.contexts.Put(config.DockerContext); err != nil {
+		return err
 	}
 
-	return saveConfig(currentConfig)
+	// 丢弃旧配置创建的 client，下次使用时按新配置重新创建
+	s.clients.evict(name)
+	return nil
 }
 
 func (s *DockerService) DeleteContainer(contextName string, id string, force bool) error {
@@ -772,6 +1256,47 @@ func (s *DockerService) DeleteContainer(contextName string, id string, force boo
 	return cli.ContainerRemove(context.Background(), id, options)
 }
 
+// CopyFromContainer 以 tar 流的形式读取容器内的文件或目录，调用方负责关闭
+func (s *DockerService) CopyFromContainer(contextName string, id string, path string) (io.ReadCloser, types.ContainerPathStat, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+	reader, stat, err := cli.CopyFromContainer(context.Background(), id, path)
+	if err != nil {
+		return nil, types.ContainerPathStat{}, fmt.Errorf("failed to copy from container: %v", err)
+	}
+	return reader, stat, nil
+}
+
+// CopyToContainer 将 tar 流解压到容器内的指定目录
+func (s *DockerService) CopyToContainer(contextName string, id string, path string, content io.Reader, overwrite bool) error {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return err
+	}
+	err = cli.CopyToContainer(context.Background(), id, path, content, types.CopyToContainerOptions{
+		AllowOverwriteDirWithFile: overwrite,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy to container: %v", err)
+	}
+	return nil
+}
+
+// ExportContainer 以 tar 流的形式导出容器文件系统，调用方负责关闭
+func (s *DockerService) ExportContainer(contextName string, id string) (io.ReadCloser, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := cli.ContainerExport(context.Background(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export container: %v", err)
+	}
+	return reader, nil
+}
+
 // CreateExec 创建执行实例
 func (s *DockerService) CreateExec(contextName string, containerID string, config types.ExecConfig) (types.IDResponse, error) {
 	cli, err := s.getClient(contextName)
@@ -822,6 +1347,40 @@ func (s *DockerService) ResizeExec(contextName string, execID string, height, wi
 	})
 }
 
+// FindShell 按顺序返回容器中第一个存在的 shell
+// 通过查询文件状态判断，不需要在容器内执行命令
+func (s *DockerService) FindShell(contextName string, containerID string, candidates []string) (string, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return "", err
+	}
+	for _, shell := range candidates {
+		if _, err := cli.ContainerStatPath(context.Background(), containerID, shell); err == nil {
+			return shell, nil
+		}
+	}
+	return "", fmt.Errorf("no shell found in container, tried %s", strings.Join(candidates, ", "))
+}
+
+// WatchEvents 订阅 Docker 引擎事件，ctx 取消时停止订阅
+// filter 与 docker events --filter 语义一致，例如 {"type": ["container"], "event": ["start", "die"]}
+func (s *DockerService) WatchEvents(ctx context.Context, contextName string, filter map[string][]string) (<-chan events.Message, <-chan error, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	args := filters.NewArgs()
+	for key, values := range filter {
+		for _, value := range values {
+			args.Add(key, value)
+		}
+	}
+
+	messages, errs := cli.Events(ctx, types.EventsOptions{Filters: args})
+	return messages, errs, nil
+}
+
 // GetServerInfo 获取服务器信息
 func (s *DockerService) GetServerInfo(contextName string) (types.Info, error) {
 	cli, err := s.getClient(contextName)
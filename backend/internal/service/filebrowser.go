@@ -0,0 +1,168 @@
+package service
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// FileEntry 容器内的文件信息
+type FileEntry struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"`
+	IsDir      bool      `json:"isDir"`
+	IsSymlink  bool      `json:"isSymlink"`
+	LinkTarget string    `json:"linkTarget,omitempty"`
+	ModTime    time.Time `json:"modTime"`
+}
+
+// newFileEntry 根据 tar 头构造文件信息
+func newFileEntry(dir string, hdr *tar.Header) FileEntry {
+	info := hdr.FileInfo()
+	name := path.Base(strings.TrimSuffix(hdr.Name, "/"))
+	return FileEntry{
+		Name:       name,
+		Path:       path.Join(dir, name),
+		Size:       hdr.Size,
+		Mode:       info.Mode().String(),
+		IsDir:      info.IsDir(),
+		IsSymlink:  hdr.Typeflag == tar.TypeSymlink,
+		LinkTarget: hdr.Linkname,
+		ModTime:    hdr.ModTime,
+	}
+}
+
+// maxDirListingBytes 列出目录时最多读取的归档大小
+// Docker 的归档包含整个子树，并且按路径顺序深度优先排列，无法只读取第一层，
+// 超过上限后停止读取，只返回已经读到的子项
+const maxDirListingBytes = 64 << 20
+
+// ListContainerDir 列出容器内目录的直接子项，目录过大时只返回部分子项，truncated 为 true
+// 通过解析 CopyFromContainer 返回的 tar 流实现，不依赖容器内的 shell 或 ls 等工具
+func (s *DockerService) ListContainerDir(contextName string, id string, dir string) ([]FileEntry, bool, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, false, err
+	}
+	return listContainerDir(cli, id, dir)
+}
+
+// listContainerDir 使用指定的 client 列出容器内目录的直接子项
+func listContainerDir(cli *client.Client, id string, dir string) ([]FileEntry, bool, error) {
+	dir = path.Clean("/" + dir)
+	stat, err := cli.ContainerStatPath(context.Background(), id, dir)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to stat path: %v", err)
+	}
+
+	srcPath := dir
+	if stat.Mode&os.ModeSymlink != 0 {
+		// 以 "/." 结尾时 Docker 会跟随符号链接复制目录内容
+		srcPath = strings.TrimSuffix(dir, "/") + "/."
+	} else if !stat.Mode.IsDir() {
+		return nil, false, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	reader, _, err := cli.CopyFromContainer(context.Background(), id, srcPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read directory: %v", err)
+	}
+	defer reader.Close()
+
+	entries, truncated, err := readDirEntries(&io.LimitedReader{R: reader, N: maxDirListingBytes}, dir)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 目录在前，其余按名称排序
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, truncated, nil
+}
+
+// readDirEntries 从目录的归档中读取直接子项，归档超过 LimitedReader 的上限时返回已读到的子项和 true
+func readDirEntries(r *io.LimitedReader, dir string) ([]FileEntry, bool, error) {
+	entries := []FileEntry{}
+	tr := tar.NewReader(r)
+	root := ""
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF && r.N > 0 {
+			break
+		}
+		if err != nil {
+			if r.N <= 0 {
+				return entries, true, nil
+			}
+			return nil, false, fmt.Errorf("failed to read archive: %v", err)
+		}
+
+		name := strings.TrimSuffix(hdr.Name, "/")
+		// 第一个条目是目录本身，后续条目均以它为前缀
+		if root == "" {
+			root = name
+			continue
+		}
+
+		rel := strings.TrimPrefix(name, root+"/")
+		if rel == name || rel == "" || strings.Contains(rel, "/") {
+			continue
+		}
+		entries = append(entries, newFileEntry(dir, hdr))
+	}
+	return entries, false, nil
+}
+
+// containerFileReader 读取 tar 流中单个文件的内容，关闭时释放底层连接
+type containerFileReader struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r *containerFileReader) Close() error {
+	return r.closer.Close()
+}
+
+// OpenContainerFile 打开容器内的普通文件，返回文件内容和文件信息，调用方负责关闭
+func (s *DockerService) OpenContainerFile(contextName string, id string, filePath string) (io.ReadCloser, FileEntry, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, FileEntry{}, err
+	}
+
+	filePath = path.Clean("/" + filePath)
+	reader, _, err := cli.CopyFromContainer(context.Background(), id, filePath)
+	if err != nil {
+		return nil, FileEntry{}, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	tr := tar.NewReader(reader)
+	hdr, err := tr.Next()
+	if err != nil {
+		reader.Close()
+		return nil, FileEntry{}, fmt.Errorf("failed to read archive: %v", err)
+	}
+
+	if hdr.Typeflag != tar.TypeReg {
+		reader.Close()
+		return nil, FileEntry{}, fmt.Errorf("%s is not a regular file", filePath)
+	}
+
+	entry := newFileEntry(path.Dir(filePath), hdr)
+	return &containerFileReader{Reader: tr, closer: reader}, entry, nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func dirArchive(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := []struct {
+		name string
+		size int
+	}{
+		{"etc/", 0},
+		{"etc/a.conf", 10},
+		{"etc/nginx/", 0},
+		{"etc/nginx/big.bin", 64 << 10},
+		{"etc/z.conf", 10},
+	}
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(f.size), Typeflag: tar.TypeReg}
+		if f.size == 0 {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(make([]byte, f.size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadDirEntries(t *testing.T) {
+	data := dirArchive(t)
+
+	entries, truncated, err := readDirEntries(&io.LimitedReader{R: bytes.NewReader(data), N: maxDirListingBytes}, "/etc")
+	if err != nil || truncated {
+		t.Fatalf("unexpected result %v %v", truncated, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Path)
+	}
+	if len(names) != 3 || names[0] != "/etc/a.conf" || names[1] != "/etc/nginx" || names[2] != "/etc/z.conf" {
+		t.Fatalf("unexpected entries %v", names)
+	}
+
+	// 子树超过上限时停止读取，返回已经读到的子项
+	entries, truncated, err = readDirEntries(&io.LimitedReader{R: bytes.NewReader(data), N: 8 << 10}, "/etc")
+	if err != nil || !truncated || len(entries) != 2 {
+		t.Fatalf("expected 2 entries before the limit, got %+v %v %v", entries, truncated, err)
+	}
+
+	if _, _, err := readDirEntries(&io.LimitedReader{R: bytes.NewReader(data[:len(data)/2]), N: maxDirListingBytes}, "/etc"); err == nil {
+		t.Fatal("expected truncated archive to fail")
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// 默认健康检查超时时间，与 Docker 的默认值保持一致
+const defaultHealthCheckTimeout = 30 * time.Second
+
+// HealthCheckResult 手动执行健康检查的结果
+type HealthCheckResult struct {
+	Healthy  bool   `json:"healthy"`
+	ExitCode int    `json:"exitCode"`
+	Output   string `json:"output"`
+}
+
+// parseHealthStatus 从容器列表的状态描述中解析健康状态
+// Docker 在状态末尾附加 (healthy)、(unhealthy) 或 (health: starting)
+func parseHealthStatus(status string) string {
+	switch {
+	case strings.HasSuffix(status, "(healthy)"):
+		return "healthy"
+	case strings.HasSuffix(status, "(unhealthy)"):
+		return "unhealthy"
+	case strings.HasSuffix(status, "(health: starting)"):
+		return "starting"
+	}
+	return ""
+}
+
+// RunHealthCheck 通过 exec 立即执行容器配置的健康检查命令
+// 结果只返回给调用方，不会影响 Docker 记录的健康状态
+func (s *DockerService) RunHealthCheck(contextName string, id string) (HealthCheckResult, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return HealthCheckResult{}, err
+	}
+
+	ctx := context.Background()
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return HealthCheckResult{}, fmt.Errorf("failed to inspect container: %v", err)
+	}
+	if info.State == nil || !info.State.Running {
+		return HealthCheckResult{}, fmt.Errorf("container is not running")
+	}
+
+	healthcheck := info.Config.Healthcheck
+	if healthcheck == nil || len(healthcheck.Test) == 0 || healthcheck.Test[0] == "NONE" {
+		return HealthCheckResult{}, fmt.Errorf("container has no healthcheck configured")
+	}
+
+	var cmd []string
+	switch healthcheck.Test[0] {
+	case "CMD":
+		cmd = healthcheck.Test[1:]
+	case "CMD-SHELL":
+		cmd = []string{"/bin/sh", "-c", strings.Join(healthcheck.Test[1:], " ")}
+	default:
+		return HealthCheckResult{}, fmt.Errorf("unsupported healthcheck test: %s", healthcheck.Test[0])
+	}
+	if len(cmd) == 0 {
+		return HealthCheckResult{}, fmt.Errorf("healthcheck command is empty")
+	}
+
+	timeout := healthcheck.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// 使用 TTY 模式避免 stdout/stderr 多路复用，输出可直接读取
+	exec, err := cli.ContainerExecCreate(ctx, id, types.ExecConfig{
+		Cmd:          cmd,
+		Tty:          true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return HealthCheckResult{}, fmt.Errorf("failed to create exec: %v", err)
+	}
+
+	resp, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{Tty: true})
+	if err != nil {
+		return HealthCheckResult{}, fmt.Errorf("failed to run healthcheck: %v", err)
+	}
+	defer resp.Close()
+
+	var output bytes.Buffer
+	if _, err := io.Copy(&output, resp.Reader); err != nil && ctx.Err() != nil {
+		return HealthCheckResult{}, fmt.Errorf("healthcheck timed out after %s", timeout)
+	}
+
+	inspect, err := cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return HealthCheckResult{}, fmt.Errorf("failed to inspect exec: %v", err)
+	}
+
+	return HealthCheckResult{
+		Healthy:  inspect.ExitCode == 0,
+		ExitCode: inspect.ExitCode,
+		Output:   output.String(),
+	}, nil
+}
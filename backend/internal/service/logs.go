@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// MaxAggregatedContainers 聚合日志最多同时跟踪的容器数
+const MaxAggregatedContainers = 50
+
+// logColors 聚合日志中区分容器的颜色，按容器顺序循环分配
+var logColors = []string{
+	"#409eff", "#67c23a", "#e6a23c", "#f56c6c", "#9b59b6", "#1abc9c",
+	"#e67e22", "#3498db", "#d35400", "#16a085", "#c0392b", "#8e44ad",
+}
+
+// 日志行的来源，system 表示由服务端生成的提示，例如某个容器的日志流结束
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+	LogStreamSystem = "system"
+)
+
+// LogLine 聚合日志中的一行
+type LogLine struct {
+	ContainerID string    `json:"containerId"`
+	Name        string    `json:"name"`
+	Color       string    `json:"color"`
+	Stream      string    `json:"stream"`
+	Time        time.Time `json:"time"`
+	Line        string    `json:"line"`
+}
+
+// LogSource 聚合日志中的一个容器
+type LogSource struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+	tty   bool
+}
+
+// AggregateLogOptions 聚合日志的容器选择和读取参数
+type AggregateLogOptions struct {
+	Containers []string // 容器 ID 或名称
+	Labels     []string // 标签选择器，格式为 key 或 key=value，与 Containers 合并
+	Tail       string   // 每个容器先输出的历史行数，默认 100，all 表示全部
+	Since      string   // 只输出该时间之后的日志，支持 RFC3339、Unix 时间戳或 10m 这样的相对时间
+	Follow     bool     // 是否持续跟踪新的日志
+}
+
+// ResolveLogSources 解析需要聚合的容器，按选择顺序去重并分配颜色
+func (s *DockerService) ResolveLogSources(contextName string, opts AggregateLogOptions) ([]LogSource, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := append([]string(nil), opts.Containers...)
+	if len(opts.Labels) > 0 {
+		containers, _, err := s.ListContainers(contextName, ContainerFilter{Labels: opts.Labels, Sort: "name"})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range containers {
+			refs = append(refs, c.ID)
+		}
+	}
+	if len(refs) == 0 {
+		return nil, errors.New("no containers selected, specify container or label")
+	}
+
+	var sources []LogSource
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		info, err := cli.ContainerInspect(context.Background(), ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect container %s: %v", ref, err)
+		}
+		if seen[info.ID] {
+			continue
+		}
+		seen[info.ID] = true
+		if len(sources) == MaxAggregatedContainers {
+			return nil, fmt.Errorf("too many containers selected, at most %d are allowed", MaxAggregatedContainers)
+		}
+		sources = append(sources, LogSource{
+			ID:    info.ID,
+			Name:  strings.TrimPrefix(info.Name, "/"),
+			Color: logColors[len(sources)%len(logColors)],
+			tty:   info.Config != nil && info.Config.Tty,
+		})
+	}
+	return sources, nil
+}
+
+// AggregateLogs 同时读取多个容器的日志并合并到一个通道中，ctx 取消或所有日志流结束后关闭通道
+// 每个容器的日志流结束或出错时输出一条 system 行
+func (s *DockerService) AggregateLogs(ctx context.Context, contextName string, sources []LogSource, opts AggregateLogOptions) (<-chan LogLine, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+	tail := opts.Tail
+	if tail == "" {
+		tail = "100"
+	}
+
+	lines := make(chan LogLine, 256)
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source LogSource) {
+			defer wg.Done()
+			emit := func(stream, text string, t time.Time) bool {
+				select {
+				case lines <- LogLine{ContainerID: source.ID, Name: source.Name, Color: source.Color, Stream: stream, Time: t, Line: text}:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			}
+
+			reader, err := cli.ContainerLogs(ctx, source.ID, types.ContainerLogsOptions{
+				ShowStdout: true,
+				ShowStderr: true,
+				Timestamps: true,
+				Follow:     opts.Follow,
+				Tail:       tail,
+				Since:      opts.Since,
+			})
+			if err != nil {
+				emit(LogStreamSystem, fmt.Sprintf("failed to read logs: %v", err), time.Now())
+				return
+			}
+			defer reader.Close()
+
+			stdout := &logLineWriter{stream: LogStreamStdout, emit: emit}
+			stderr := &logLineWriter{stream: LogStreamStderr, emit: emit}
+			if source.tty {
+				_, err = io.Copy(stdout, reader)
+			} else {
+				err = DemuxStream(stdout, stderr, reader)
+			}
+			stdout.Flush()
+			stderr.Flush()
+
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				emit(LogStreamSystem, fmt.Sprintf("log stream failed: %v", err), time.Now())
+				return
+			}
+			emit(LogStreamSystem, "log stream ended", time.Now())
+		}(source)
+	}
+
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+	return lines, nil
+}
+
+// logLineWriter 将带时间戳的日志输出按行拆分
+type logLineWriter struct {
+	stream  string
+	emit    func(stream, text string, t time.Time) bool
+	partial []byte
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(bytes.TrimRight(w.partial[:i], "\r"))
+		w.partial = w.partial[i+1:]
+		if !w.emitLine(line) {
+			return 0, context.Canceled
+		}
+	}
+	return len(p), nil
+}
+
+// Flush 输出没有以换行结尾的最后一行
+func (w *logLineWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.emitLine(string(w.partial))
+		w.partial = nil
+	}
+}
+
+// emitLine 拆分 Docker 在每行开头添加的 RFC3339Nano 时间戳
+func (w *logLineWriter) emitLine(line string) bool {
+	if ts, text, ok := strings.Cut(line, " "); ok {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return w.emit(w.stream, text, t)
+		}
+	}
+	return w.emit(w.stream, line, time.Time{})
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// 日志搜索的上限，避免单次请求占用过多内存
+const (
+	DefaultLogSearchLimit = 200
+	MaxLogSearchLimit     = 1000
+	MaxLogSearchContext   = 20
+)
+
+// LogReadOptions 读取单个容器日志的参数，时间格式与 docker logs 的 --since/--until 相同
+type LogReadOptions struct {
+	Since      string
+	Until      string
+	Timestamps bool
+}
+
+// OpenContainerLogs 返回容器的完整日志，未启用 TTY 时标准输出和标准错误按原顺序合并，调用方负责关闭
+// 同时返回容器名称，用于生成下载文件名
+func (s *DockerService) OpenContainerLogs(contextName string, id string, opts LogReadOptions) (io.ReadCloser, string, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, "", err
+	}
+	info, err := cli.ContainerInspect(context.Background(), id)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to inspect container: %v", err)
+	}
+	name := strings.TrimPrefix(info.Name, "/")
+
+	reader, err := cli.ContainerLogs(context.Background(), id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: opts.Timestamps,
+		Since:      opts.Since,
+		Until:      opts.Until,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read container logs: %v", err)
+	}
+	if info.Config != nil && info.Config.Tty {
+		return reader, name, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(DemuxStream(pw, pw, reader))
+	}()
+	return &logReader{Reader: pr, closers: []io.Closer{pr, reader}}, name, nil
+}
+
+// logReader 关闭时同时关闭管道和 Docker 返回的原始日志流
+type logReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *logReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// LogSearch 日志搜索条件
+type LogSearch struct {
+	Query      string // 子字符串，Regex 为 true 时为正则表达式
+	Regex      bool
+	IgnoreCase bool
+	Since      string
+	Until      string
+	Context    int // 每个匹配行前后附带的行数
+	Limit      int // 最多返回的匹配数，为 0 时使用 DefaultLogSearchLimit
+}
+
+// Validate 检查搜索条件是否合法
+func (q LogSearch) Validate() error {
+	if q.Query == "" {
+		return errors.New("query is required")
+	}
+	if q.Regex {
+		if _, err := regexp.Compile(q.Query); err != nil {
+			return fmt.Errorf("invalid regex: %v", err)
+		}
+	}
+	if q.Context < 0 || q.Context > MaxLogSearchContext {
+		return fmt.Errorf("context must be between 0 and %d", MaxLogSearchContext)
+	}
+	if q.Limit < 0 || q.Limit > MaxLogSearchLimit {
+		return fmt.Errorf("limit must be between 0 and %d", MaxLogSearchLimit)
+	}
+	return nil
+}
+
+// matcher 根据搜索条件生成匹配函数
+func (q LogSearch) matcher() func(string) bool {
+	if q.Regex {
+		pattern := q.Query
+		if q.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re := regexp.MustCompile(pattern)
+		return re.MatchString
+	}
+	if q.IgnoreCase {
+		query := strings.ToLower(q.Query)
+		return func(line string) bool {
+			return strings.Contains(strings.ToLower(line), query)
+		}
+	}
+	return func(line string) bool {
+		return strings.Contains(line, q.Query)
+	}
+}
+
+// LogMatch 一个匹配行及其上下文
+type LogMatch struct {
+	LineNumber int       `json:"lineNumber"` // 在搜索范围内的行号，从 1 开始
+	Time       time.Time `json:"time"`
+	Stream     string    `json:"stream"`
+	Line       string    `json:"line"`
+	Before     []string  `json:"before,omitempty"`
+	After      []string  `json:"after,omitempty"`
+}
+
+// LogSearchResult 日志搜索结果
+type LogSearchResult struct {
+	Matches   []LogMatch `json:"matches"`
+	Scanned   int        `json:"scanned"`   // 已扫描的行数
+	Truncated bool       `json:"truncated"` // 匹配数达到上限，之后的日志没有继续搜索
+}
+
+// SearchContainerLogs 在服务端逐行搜索容器日志，只返回匹配行及其上下文
+func (s *DockerService) SearchContainerLogs(contextName string, id string, q LogSearch) (*LogSearchResult, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+	info, err := cli.ContainerInspect(context.Background(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reader, err := cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Since:      q.Since,
+		Until:      q.Until,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container logs: %v", err)
+	}
+	defer reader.Close()
+
+	m := newLogMatcher(q)
+	stdout := &logLineWriter{stream: LogStreamStdout, emit: m.add}
+	stderr := &logLineWriter{stream: LogStreamStderr, emit: m.add}
+	if info.Config != nil && info.Config.Tty {
+		_, err = io.Copy(stdout, reader)
+	} else {
+		err = DemuxStream(stdout, stderr, reader)
+	}
+	if !m.stopped {
+		stdout.Flush()
+		stderr.Flush()
+	}
+	if err != nil && !m.stopped && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("failed to search container logs: %v", err)
+	}
+	return m.result(), nil
+}
+
+// logMatcher 按行匹配日志并收集上下文
+type logMatcher struct {
+	match     func(string) bool
+	context   int
+	limit     int
+	scanned   int
+	matches   []LogMatch
+	before    []string
+	pending   []int // 还需要补充后续上下文的匹配
+	truncated bool
+	stopped   bool
+}
+
+func newLogMatcher(q LogSearch) *logMatcher {
+	limit := q.Limit
+	if limit == 0 {
+		limit = DefaultLogSearchLimit
+	}
+	return &logMatcher{match: q.matcher(), context: q.Context, limit: limit}
+}
+
+// add 处理一行日志，返回 false 时停止读取
+func (m *logMatcher) add(stream, text string, t time.Time) bool {
+	m.scanned++
+
+	// 补充之前匹配行的后续上下文
+	pending := m.pending[:0]
+	for _, i := range m.pending {
+		m.matches[i].After = append(m.matches[i].After, text)
+		if len(m.matches[i].After) < m.context {
+			pending = append(pending, i)
+		}
+	}
+	m.pending = pending
+
+	if !m.truncated && m.match(text) {
+		if len(m.matches) == m.limit {
+			m.truncated = true
+		} else {
+			m.matches = append(m.matches, LogMatch{
+				LineNumber: m.scanned,
+				Time:       t,
+				Stream:     stream,
+				Line:       text,
+				Before:     append([]string(nil), m.before...),
+			})
+			if m.context > 0 {
+				m.pending = append(m.pending, len(m.matches)-1)
+			}
+		}
+	}
+	if m.truncated && len(m.pending) == 0 {
+		m.stopped = true
+		return false
+	}
+
+	if m.context > 0 {
+		if len(m.before) == m.context {
+			copy(m.before, m.before[1:])
+			m.before = m.before[:m.context-1]
+		}
+		m.before = append(m.before, text)
+	}
+	return true
+}
+
+func (m *logMatcher) result() *LogSearchResult {
+	result := &LogSearchResult{Matches: m.matches, Scanned: m.scanned, Truncated: m.truncated}
+	if result.Matches == nil {
+		result.Matches = []LogMatch{}
+	}
+	return result
+}
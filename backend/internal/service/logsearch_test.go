@@ -0,0 +1,45 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLogMatcher(t *testing.T) {
+	lines := []string{"start", "error: a", "ok", "ok", "ERROR: b", "done", "error: c", "tail"}
+	scan := func(q LogSearch) *LogSearchResult {
+		m := newLogMatcher(q)
+		for _, line := range lines {
+			if !m.add(LogStreamStdout, line, time.Time{}) {
+				break
+			}
+		}
+		return m.result()
+	}
+
+	result := scan(LogSearch{Query: "error", IgnoreCase: true, Context: 1})
+	if len(result.Matches) != 3 || result.Truncated {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	first := result.Matches[0]
+	if first.LineNumber != 2 || !reflect.DeepEqual(first.Before, []string{"start"}) || !reflect.DeepEqual(first.After, []string{"ok"}) {
+		t.Errorf("unexpected first match %+v", first)
+	}
+
+	// 达到上限后补齐最后一个匹配的上下文再停止
+	result = scan(LogSearch{Query: `^error: [ab]$`, Regex: true, IgnoreCase: true, Context: 2, Limit: 1})
+	if len(result.Matches) != 1 || !result.Truncated || result.Scanned != 5 {
+		t.Fatalf("unexpected truncated result %+v", result)
+	}
+	if !reflect.DeepEqual(result.Matches[0].After, []string{"ok", "ok"}) {
+		t.Errorf("unexpected after context %+v", result.Matches[0].After)
+	}
+
+	if err := (LogSearch{Query: "("}).Validate(); err != nil {
+		t.Errorf("substring query should not be parsed as regex: %v", err)
+	}
+	if err := (LogSearch{Query: "(", Regex: true}).Validate(); err == nil {
+		t.Error("expected invalid regex to be rejected")
+	}
+}
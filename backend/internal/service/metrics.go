@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// DefaultMetricsInterval 默认采样间隔
+	DefaultMetricsInterval = 15 * time.Second
+	// metricsIdleTimeout 超过该时间没有被查询的 context 停止采样
+	metricsIdleTimeout = 5 * time.Minute
+	// metricsHistorySize 每个 context 保留的历史采样点数
+	metricsHistorySize = 60
+	// diskUsageInterval 磁盘占用的计算开销较大，按更长的间隔刷新
+	diskUsageInterval = 5 * time.Minute
+	// metricsSampleTimeout 单次采样的超时时间
+	metricsSampleTimeout = 10 * time.Second
+)
+
+// MetricsPoint 历史采样点
+type MetricsPoint struct {
+	Time       time.Time `json:"time"`
+	CPUPercent float64   `json:"cpuPercent"`
+	MemoryUsed uint64    `json:"memoryUsed"`
+}
+
+// DiskMetrics Docker 占用的磁盘空间，单位为字节
+type DiskMetrics struct {
+	Images     int64     `json:"images"`
+	Containers int64     `json:"containers"` // 容器可写层
+	Volumes    int64     `json:"volumes"`
+	BuildCache int64     `json:"buildCache"`
+	Total      int64     `json:"total"`
+	SampledAt  time.Time `json:"sampledAt"`
+}
+
+// HostMetrics 一个 context 所在主机的资源使用情况
+// Docker 不提供主机整体的 CPU 和内存使用率，这里以所有运行中容器的使用量之和近似
+type HostMetrics struct {
+	Context           string         `json:"context"`
+	Time              time.Time      `json:"time"`
+	ServerVersion     string         `json:"serverVersion"`
+	OperatingSystem   string         `json:"operatingSystem"`
+	KernelVersion     string         `json:"kernelVersion"`
+	Architecture      string         `json:"architecture"`
+	DockerRootDir     string         `json:"dockerRootDir"`
+	CPUs              int            `json:"cpus"`
+	CPUPercent        float64        `json:"cpuPercent"` // 容器占用主机 CPU 的百分比，0-100
+	MemoryTotal       int64          `json:"memoryTotal"`
+	MemoryUsed        uint64         `json:"memoryUsed"` // 容器内存使用量之和，不含页缓存
+	MemoryPercent     float64        `json:"memoryPercent"`
+	Containers        int            `json:"containers"`
+	ContainersRunning int            `json:"containersRunning"`
+	ContainersPaused  int            `json:"containersPaused"`
+	ContainersStopped int            `json:"containersStopped"`
+	Images            int            `json:"images"`
+	Disk              *DiskMetrics   `json:"disk,omitempty"`
+	History           []MetricsPoint `json:"history"`
+	Error             string         `json:"error,omitempty"` // 最近一次采样失败的原因，此时返回上一次成功的数据
+}
+
+// cpuSample 容器累计 CPU 时间，用于计算两次采样之间的使用率
+type cpuSample struct {
+	total  uint64
+	system uint64
+}
+
+// contextMetrics 单个 context 的采样状态
+type contextMetrics struct {
+	mu            sync.Mutex
+	lastRequested time.Time
+	metrics       HostMetrics
+	sampled       bool
+	cpu           map[string]cpuSample
+}
+
+// MetricsSampler 定期采样最近被查询过的 context 的资源使用情况
+// 只有被查询过的 context 才会采样，避免持续轮询所有远程主机
+type MetricsSampler struct {
+	docker   *DockerService
+	interval time.Duration
+
+	mu       sync.Mutex
+	contexts map[string]*contextMetrics
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewMetricsSampler 创建采样器，interval 不大于 0 时使用 DefaultMetricsInterval
+func NewMetricsSampler(docker *DockerService, interval time.Duration) *MetricsSampler {
+	if interval <= 0 {
+		interval = DefaultMetricsInterval
+	}
+	return &MetricsSampler{
+		docker:   docker,
+		interval: interval,
+		contexts: make(map[string]*contextMetrics),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start 启动采样循环
+func (m *MetricsSampler) Start() {
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.sampleActive()
+			}
+		}
+	}()
+}
+
+// Stop 停止采样循环
+func (m *MetricsSampler) Stop() {
+	close(m.stop)
+	<-m.done
+}
+
+// Get 返回 context 最近一次的采样结果，首次查询时立即采样
+func (m *MetricsSampler) Get(contextName string) (HostMetrics, error) {
+	if _, err := m.docker.getClient(contextName); err != nil {
+		return HostMetrics{}, err
+	}
+
+	m.mu.Lock()
+	cm, ok := m.contexts[contextName]
+	if !ok {
+		cm = &contextMetrics{cpu: make(map[string]cpuSample)}
+		m.contexts[contextName] = cm
+	}
+	m.mu.Unlock()
+
+	cm.mu.Lock()
+	cm.lastRequested = time.Now()
+	if !cm.sampled {
+		// 第一次采样没有可以对比的 CPU 时间，间隔一秒再采样一次
+		m.sample(contextName, cm)
+		if cm.sampled && cm.metrics.Error == "" {
+			time.Sleep(time.Second)
+			m.sample(contextName, cm)
+		}
+		if !cm.sampled {
+			err := fmt.Errorf("failed to sample metrics: %s", cm.metrics.Error)
+			// 先释放 cm.mu 再获取 m.mu，与 sampleActive 的加锁顺序一致
+			cm.mu.Unlock()
+			m.remove(contextName, cm)
+			return HostMetrics{}, err
+		}
+	}
+
+	metrics := cm.metrics
+	metrics.History = append([]MetricsPoint(nil), cm.metrics.History...)
+	cm.mu.Unlock()
+	return metrics, nil
+}
+
+// remove 移除 context 的采样状态，期间已被替换为新的状态时保留新的状态
+func (m *MetricsSampler) remove(contextName string, cm *contextMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.contexts[contextName] == cm {
+		delete(m.contexts, contextName)
+	}
+}
+
+// sampleActive 采样所有最近被查询过的 context，移除长时间未查询的 context
+func (m *MetricsSampler) sampleActive() {
+	// 持有 m.mu 时不获取 cm.mu，Get 在首次采样期间持有 cm.mu，失败时需要获取 m.mu
+	m.mu.Lock()
+	contexts := maps.Clone(m.contexts)
+	m.mu.Unlock()
+
+	active := make(map[string]*contextMetrics)
+	for name, cm := range contexts {
+		cm.mu.Lock()
+		idle := time.Since(cm.lastRequested) > metricsIdleTimeout
+		cm.mu.Unlock()
+		if idle {
+			m.remove(name, cm)
+			continue
+		}
+		active[name] = cm
+	}
+
+	sem := make(chan struct{}, batchWorkers)
+	var wg sync.WaitGroup
+	for name, cm := range active {
+		wg.Add(1)
+		go func(name string, cm *contextMetrics) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			cm.mu.Lock()
+			defer cm.mu.Unlock()
+			m.sample(name, cm)
+		}(name, cm)
+	}
+	wg.Wait()
+}
+
+// sample 采样一次并更新 cm，调用方需持有 cm.mu
+func (m *MetricsSampler) sample(contextName string, cm *contextMetrics) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsSampleTimeout)
+	defer cancel()
+
+	metrics, err := m.collect(ctx, contextName, cm)
+	if err != nil {
+		cm.metrics.Error = err.Error()
+		return
+	}
+	metrics.History = append(cm.metrics.History, MetricsPoint{
+		Time:       metrics.Time,
+		CPUPercent: metrics.CPUPercent,
+		MemoryUsed: metrics.MemoryUsed,
+	})
+	if over := len(metrics.History) - metricsHistorySize; over > 0 {
+		metrics.History = append([]MetricsPoint(nil), metrics.History[over:]...)
+	}
+	cm.metrics = metrics
+	cm.sampled = true
+}
+
+// collect 查询引擎信息、运行中容器的统计信息和磁盘占用
+func (m *MetricsSampler) collect(ctx context.Context, contextName string, cm *contextMetrics) (HostMetrics, error) {
+	cli, err := m.docker.getClient(contextName)
+	if err != nil {
+		return HostMetrics{}, err
+	}
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return HostMetrics{}, fmt.Errorf("failed to get server info: %v", err)
+	}
+
+	metrics := HostMetrics{
+		Context:           contextName,
+		Time:              time.Now(),
+		ServerVersion:     info.ServerVersion,
+		OperatingSystem:   info.OperatingSystem,
+		KernelVersion:     info.KernelVersion,
+		Architecture:      info.Architecture,
+		DockerRootDir:     info.DockerRootDir,
+		CPUs:              info.NCPU,
+		MemoryTotal:       info.MemTotal,
+		Containers:        info.Containers,
+		ContainersRunning: info.ContainersRunning,
+		ContainersPaused:  info.ContainersPaused,
+		ContainersStopped: info.ContainersStopped,
+		Images:            info.Images,
+		Disk:              cm.metrics.Disk,
+	}
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("status", "running")),
+	})
+	if err != nil {
+		return HostMetrics{}, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	type result struct {
+		id    string
+		stats types.StatsJSON
+		err   error
+	}
+	results := make(chan result, len(containers))
+	sem := make(chan struct{}, batchWorkers)
+	for _, c := range containers {
+		go func(id string) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			r := result{id: id}
+			resp, err := cli.ContainerStatsOneShot(ctx, id)
+			if err != nil {
+				r.err = err
+				results <- r
+				return
+			}
+			defer resp.Body.Close()
+			r.err = json.NewDecoder(resp.Body).Decode(&r.stats)
+			results <- r
+		}(c.ID)
+	}
+
+	cpu := make(map[string]cpuSample, len(containers))
+	for range containers {
+		r := <-results
+		if r.err != nil {
+			// 容器可能在采样期间退出，忽略单个容器的错误
+			continue
+		}
+		current := cpuSample{total: r.stats.CPUStats.CPUUsage.TotalUsage, system: r.stats.CPUStats.SystemUsage}
+		cpu[r.id] = current
+		if prev, ok := cm.cpu[r.id]; ok && current.system > prev.system && current.total >= prev.total {
+			metrics.CPUPercent += float64(current.total-prev.total) / float64(current.system-prev.system) * 100
+		}
+		metrics.MemoryUsed += memoryUsage(r.stats.MemoryStats)
+	}
+	cm.cpu = cpu
+	if metrics.CPUPercent > 100 {
+		metrics.CPUPercent = 100
+	}
+	if metrics.MemoryTotal > 0 {
+		metrics.MemoryPercent = float64(metrics.MemoryUsed) / float64(metrics.MemoryTotal) * 100
+	}
+
+	if metrics.Disk == nil || time.Since(metrics.Disk.SampledAt) > diskUsageInterval {
+		if disk, err := diskMetrics(ctx, cli); err == nil {
+			metrics.Disk = disk
+		}
+	}
+	return metrics, nil
+}
+
+// memoryUsage 与 docker stats 一致，从内存使用量中扣除可回收的页缓存
+func memoryUsage(stats types.MemoryStats) uint64 {
+	for _, key := range []string{"inactive_file", "total_inactive_file"} {
+		if cache, ok := stats.Stats[key]; ok && cache < stats.Usage {
+			return stats.Usage - cache
+		}
+	}
+	return stats.Usage
+}
+
+// diskMetrics 汇总镜像、容器可写层、数据卷和构建缓存占用的空间
+func diskMetrics(ctx context.Context, cli *client.Client) (*DiskMetrics, error) {
+	usage, err := cli.DiskUsage(ctx, types.DiskUsageOptions{})
+	if err != nil {
+		return nil, err
+	}
+	disk := &DiskMetrics{Images: usage.LayersSize, SampledAt: time.Now()}
+	for _, c := range usage.Containers {
+		disk.Containers += c.SizeRw
+	}
+	for _, v := range usage.Volumes {
+		if v.UsageData != nil && v.UsageData.Size > 0 {
+			disk.Volumes += v.UsageData.Size
+		}
+	}
+	for _, b := range usage.BuildCache {
+		if !b.Shared {
+			disk.BuildCache += b.Size
+		}
+	}
+	disk.Total = disk.Images + disk.Containers + disk.Volumes + disk.BuildCache
+	return disk, nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+// 首次采样失败的同时后台采样在运行，两者不能互相等待对方持有的锁
+func TestMetricsSamplerFailedFirstSampleWithSampleActive(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_ping") {
+			w.Header().Set("API-Version", "1.41")
+			w.Write([]byte("OK"))
+			return
+		}
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		http.Error(w, `{"message":"daemon unavailable"}`, http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	contexts := config.NewMemoryContextStore()
+	if err := contexts.Put(config.DockerContext{Name: "remote", Type: "tcp", Host: "tcp://" + strings.TrimPrefix(server.URL, "http://")}); err != nil {
+		t.Fatal(err)
+	}
+	docker, err := NewDockerService(contexts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMetricsSampler(docker, time.Hour)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := m.Get("remote")
+		errs <- err
+	}()
+	<-started
+
+	// Get 持有 cm.mu 等待采样结果时运行后台采样
+	sampled := make(chan struct{})
+	go func() {
+		m.sampleActive()
+		close(sampled)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	timeout := time.After(5 * time.Second)
+	select {
+	case err := <-errs:
+		if err == nil || !strings.Contains(err.Error(), "failed to sample metrics") {
+			t.Fatalf("Expected sampling error, got %v", err)
+		}
+	case <-timeout:
+		t.Fatal("Get deadlocked with sampleActive")
+	}
+	select {
+	case <-sampled:
+	case <-timeout:
+		t.Fatal("sampleActive deadlocked with Get")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.contexts["remote"]; ok {
+		t.Fatal("Expected context to be removed after a failed first sample")
+	}
+}
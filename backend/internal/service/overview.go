@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/volume"
+)
+
+// 查询单个 context 的默认超时时间
+const DefaultOverviewTimeout = 5 * time.Second
+
+// ContextOverview 单个 context 的概览信息
+type ContextOverview struct {
+	Name              string `json:"name"`
+	Host              string `json:"host"`
+	Group             string `json:"group,omitempty"`
+	Current           bool   `json:"current"`
+	Reachable         bool   `json:"reachable"`
+	Error             string `json:"error,omitempty"`
+	ServerVersion     string `json:"serverVersion,omitempty"`
+	OperatingSystem   string `json:"operatingSystem,omitempty"`
+	Architecture      string `json:"architecture,omitempty"`
+	Containers        int    `json:"containers"`
+	ContainersRunning int    `json:"containersRunning"`
+	ContainersPaused  int    `json:"containersPaused"`
+	ContainersStopped int    `json:"containersStopped"`
+	Images            int    `json:"images"`
+	Volumes           int    `json:"volumes"`
+	Latency           string `json:"latency"` // 查询耗时
+}
+
+// Overview 并发查询匹配过滤条件的 context 的概览信息，单个 context 超时或不可达不影响其他 context
+// 结果顺序与 ListContexts 一致
+func (s *DockerService) Overview(filter ContextFilter, timeout time.Duration) ([]ContextOverview, error) {
+	contexts, err := s.ListContexts(filter)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = DefaultOverviewTimeout
+	}
+
+	overviews := make([]ContextOverview, len(contexts))
+	sem := make(chan struct{}, batchWorkers)
+	var wg sync.WaitGroup
+	for i, ctx := range contexts {
+		wg.Add(1)
+		go func(i int, ctx ContextConfig) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			overviews[i] = s.contextOverview(ctx, timeout)
+		}(i, ctx)
+	}
+	wg.Wait()
+
+	return overviews, nil
+}
+
+// contextOverview 查询单个 context 的概览信息，使用命名返回值以便 defer 设置查询耗时
+func (s *DockerService) contextOverview(config ContextConfig, timeout time.Duration) (overview ContextOverview) {
+	overview = ContextOverview{
+		Name:    config.Name,
+		Host:    config.Host,
+		Group:   config.Group,
+		Current: config.Current,
+	}
+
+	start := time.Now()
+	defer func() {
+		overview.Latency = time.Since(start).Round(time.Millisecond).String()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 建立连接可能不受 ctx 控制（例如 ssh），放到单独的 goroutine 中以保证超时生效
+	result := make(chan ContextOverview, 1)
+	base := overview
+	go func() {
+		o := base
+		cli, err := s.getClient(config.Name)
+		if err != nil {
+			o.Error = err.Error()
+			result <- o
+			return
+		}
+
+		info, err := cli.Info(ctx)
+		if err != nil {
+			o.Error = err.Error()
+			result <- o
+			return
+		}
+		o.Reachable = true
+		o.ServerVersion = info.ServerVersion
+		o.OperatingSystem = info.OperatingSystem
+		o.Architecture = info.Architecture
+		o.Containers = info.Containers
+		o.ContainersRunning = info.ContainersRunning
+		o.ContainersPaused = info.ContainersPaused
+		o.ContainersStopped = info.ContainersStopped
+		o.Images = info.Images
+
+		volumes, err := cli.VolumeList(ctx, volume.ListOptions{})
+		if err != nil {
+			o.Error = err.Error()
+		} else {
+			o.Volumes = len(volumes.Volumes)
+		}
+		result <- o
+	}()
+
+	select {
+	case o := <-result:
+		overview = o
+	case <-ctx.Done():
+		overview.Error = "timed out after " + timeout.String()
+	}
+	return overview
+}
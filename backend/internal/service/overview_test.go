@@ -0,0 +1,47 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+func TestContextOverviewLatency(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	contexts := config.NewMemoryContextStore()
+	if err := contexts.Put(config.DockerContext{Name: "slow", Type: "tcp", Host: "tcp://" + strings.TrimPrefix(server.URL, "http://")}); err != nil {
+		t.Fatal(err)
+	}
+	docker, err := NewDockerService(contexts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 超时和查询失败时同样返回耗时
+	overviews, err := docker.Overview(ContextFilter{}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overviews) != 1 || overviews[0].Reachable || !strings.HasPrefix(overviews[0].Error, "timed out") {
+		t.Fatalf("Expected timed out overview, got %+v", overviews)
+	}
+	latency, err := time.ParseDuration(overviews[0].Latency)
+	if err != nil || latency < 50*time.Millisecond {
+		t.Fatalf("Expected latency of at least the timeout, got %q", overviews[0].Latency)
+	}
+
+	overview := docker.contextOverview(ContextConfig{DockerContext: config.DockerContext{Name: "missing"}}, time.Second)
+	if overview.Error == "" || overview.Latency == "" {
+		t.Fatalf("Expected error and latency for missing context, got %+v", overview)
+	}
+}
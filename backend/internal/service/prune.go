@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// 可清理的资源类型
+const (
+	PruneContainers = "containers"
+	PruneImages     = "images"
+	PruneVolumes    = "volumes"
+	PruneNetworks   = "networks"
+	PruneBuildCache = "buildcache"
+)
+
+// allPruneResources 未指定资源时按此顺序清理，先清理容器以释放其引用的镜像、卷和网络
+var allPruneResources = []string{PruneContainers, PruneImages, PruneVolumes, PruneNetworks, PruneBuildCache}
+
+// PruneOptions 清理选项
+type PruneOptions struct {
+	Resources []string `json:"resources"` // 要清理的资源类型，为空表示全部
+	Dangling  *bool    `json:"dangling"`  // 仅对镜像生效，false 表示同时清理未被使用的非悬空镜像
+	Until     string   `json:"until"`     // 只清理在此时间之前创建的对象，例如 24h 或 RFC3339 时间
+	Labels    []string `json:"labels"`    // 标签过滤，例如 env=dev 或 label!=keep
+	All       bool     `json:"all"`       // 仅对构建缓存生效，清理全部缓存而不仅是悬空缓存
+}
+
+// PruneReport 单类资源的清理结果
+type PruneReport struct {
+	Resource       string   `json:"resource"`
+	Deleted        []string `json:"deleted"`
+	SpaceReclaimed uint64   `json:"spaceReclaimed"`
+	Error          string   `json:"error,omitempty"`
+}
+
+// pruneFilters 根据清理选项构建过滤条件
+func pruneFilters(opts PruneOptions, resource string) filters.Args {
+	args := filters.NewArgs()
+	if opts.Until != "" && resource != PruneVolumes {
+		// 数据卷清理不支持 until 过滤
+		args.Add("until", opts.Until)
+	}
+	for _, label := range opts.Labels {
+		if len(label) > 1 && label[0] == '!' {
+			args.Add("label!", label[1:])
+			continue
+		}
+		args.Add("label", label)
+	}
+	if resource == PruneImages && opts.Dangling != nil {
+		args.Add("dangling", fmt.Sprintf("%t", *opts.Dangling))
+	}
+	return args
+}
+
+// PruneResource 清理单类资源
+func (s *DockerService) PruneResource(contextName string, resource string, opts PruneOptions) (PruneReport, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return PruneReport{}, err
+	}
+
+	ctx := context.Background()
+	args := pruneFilters(opts, resource)
+	report := PruneReport{Resource: resource, Deleted: []string{}}
+
+	switch resource {
+	case PruneContainers:
+		resp, err := cli.ContainersPrune(ctx, args)
+		if err != nil {
+			return report, fmt.Errorf("failed to prune containers: %v", err)
+		}
+		report.Deleted = append(report.Deleted, resp.ContainersDeleted...)
+		report.SpaceReclaimed = resp.SpaceReclaimed
+	case PruneImages:
+		resp, err := cli.ImagesPrune(ctx, args)
+		if err != nil {
+			return report, fmt.Errorf("failed to prune images: %v", err)
+		}
+		for _, item := range resp.ImagesDeleted {
+			if item.Deleted != "" {
+				report.Deleted = append(report.Deleted, item.Deleted)
+			} else if item.Untagged != "" {
+				report.Deleted = append(report.Deleted, item.Untagged)
+			}
+		}
+		report.SpaceReclaimed = resp.SpaceReclaimed
+	case PruneVolumes:
+		resp, err := cli.VolumesPrune(ctx, args)
+		if err != nil {
+			return report, fmt.Errorf("failed to prune volumes: %v", err)
+		}
+		report.Deleted = append(report.Deleted, resp.VolumesDeleted...)
+		report.SpaceReclaimed = resp.SpaceReclaimed
+	case PruneNetworks:
+		resp, err := cli.NetworksPrune(ctx, args)
+		if err != nil {
+			return report, fmt.Errorf("failed to prune networks: %v", err)
+		}
+		report.Deleted = append(report.Deleted, resp.NetworksDeleted...)
+	case PruneBuildCache:
+		resp, err := cli.BuildCachePrune(ctx, types.BuildCachePruneOptions{
+			All:     opts.All,
+			Filters: args,
+		})
+		if err != nil {
+			return report, fmt.Errorf("failed to prune build cache: %v", err)
+		}
+		report.Deleted = append(report.Deleted, resp.CachesDeleted...)
+		report.SpaceReclaimed = resp.SpaceReclaimed
+	default:
+		return report, fmt.Errorf("unsupported prune resource: %s", resource)
+	}
+
+	return report, nil
+}
+
+// Prune 按顺序清理多类资源，单类资源失败不会中断其余资源的清理
+func (s *DockerService) Prune(contextName string, opts PruneOptions) ([]PruneReport, uint64, error) {
+	resources := opts.Resources
+	if len(resources) == 0 {
+		resources = allPruneResources
+	}
+
+	// 校验资源类型，避免部分清理后才发现参数错误
+	for _, resource := range resources {
+		switch resource {
+		case PruneContainers, PruneImages, PruneVolumes, PruneNetworks, PruneBuildCache:
+		default:
+			return nil, 0, fmt.Errorf("unsupported prune resource: %s", resource)
+		}
+	}
+
+	var reports []PruneReport
+	var total uint64
+	for _, resource := range resources {
+		report, err := s.PruneResource(contextName, resource, opts)
+		if err != nil {
+			report.Resource = resource
+			report.Error = err.Error()
+		}
+		total += report.SpaceReclaimed
+		reports = append(reports, report)
+	}
+
+	return reports, total, nil
+}
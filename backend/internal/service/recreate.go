@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+// RecreateOptions 重建容器的选项
+type RecreateOptions struct {
+	Image string        `json:"image"` // 新镜像，为空时使用原容器的镜像
+	Pull  bool          `json:"pull"`  // 重建前是否先拉取镜像
+	Auth  *RegistryAuth `json:"auth"`
+}
+
+// RecreateContainer 使用新镜像重建容器，保留端口、环境变量、挂载和网络配置，返回新容器 ID
+// 旧容器先被停止并重命名，新容器创建失败时会回滚到旧容器
+func (s *DockerService) RecreateContainer(contextName string, id string, opts RecreateOptions) (string, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	old, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container: %v", err)
+	}
+
+	image := opts.Image
+	if image == "" {
+		image = old.Config.Image
+	}
+
+	if opts.Pull {
+		reader, err := s.PullImage(contextName, image, opts.Auth)
+		if err != nil {
+			return "", err
+		}
+		err = waitJSONMessages(reader)
+		reader.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to pull image: %v", err)
+		}
+	}
+
+	name := strings.TrimPrefix(old.Name, "/")
+	wasRunning := old.State != nil && old.State.Running
+
+	// 容器配置中包含从旧镜像继承的环境变量、命令和标签等，只保留用户设置的部分，其余使用新镜像的默认值
+	oldImage, _, err := cli.ImageInspectWithRaw(ctx, old.Image)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image of container: %v", err)
+	}
+	config := userConfig(old.Config, oldImage.Config)
+	config.Image = image
+	// 自动生成的主机名等于容器短 ID，需要清空让新容器重新生成
+	if config.Hostname == old.ID[:12] {
+		config.Hostname = ""
+	}
+	hostConfig := *old.HostConfig
+	hostConfig.Mounts = append(slices.Clone(hostConfig.Mounts), anonymousVolumeMounts(old)...)
+	for _, m := range hostConfig.Mounts {
+		delete(config.Volumes, m.Target)
+	}
+
+	primary, extra := recreateEndpoints(old)
+
+	if wasRunning {
+		if err := cli.ContainerStop(ctx, old.ID, container.StopOptions{}); err != nil {
+			return "", fmt.Errorf("failed to stop container: %v", err)
+		}
+	}
+
+	backupName := fmt.Sprintf("%s-old-%d", name, time.Now().Unix())
+	if err := cli.ContainerRename(ctx, old.ID, backupName); err != nil {
+		if wasRunning {
+			cli.ContainerStart(ctx, old.ID, types.ContainerStartOptions{})
+		}
+		return "", fmt.Errorf("failed to rename container: %v", err)
+	}
+
+	// rollback 恢复旧容器的名称和运行状态
+	rollback := func(newID string) {
+		if newID != "" {
+			cli.ContainerRemove(ctx, newID, types.ContainerRemoveOptions{Force: true})
+		}
+		cli.ContainerRename(ctx, old.ID, name)
+		if wasRunning {
+			cli.ContainerStart(ctx, old.ID, types.ContainerStartOptions{})
+		}
+	}
+
+	resp, err := cli.ContainerCreate(ctx, &config, &hostConfig, &network.NetworkingConfig{EndpointsConfig: primary}, nil, name)
+	if err != nil {
+		rollback("")
+		return "", fmt.Errorf("failed to create container: %v", err)
+	}
+
+	// 创建时只能指定一个网络，其余网络在创建后连接
+	for networkName, endpoint := range extra {
+		if err := cli.NetworkConnect(ctx, networkName, resp.ID, endpoint); err != nil {
+			rollback(resp.ID)
+			return "", fmt.Errorf("failed to connect network %s: %v", networkName, err)
+		}
+	}
+
+	if wasRunning {
+		if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+			rollback(resp.ID)
+			return "", fmt.Errorf("failed to start container: %v", err)
+		}
+	}
+
+	if err := cli.ContainerRemove(ctx, old.ID, types.ContainerRemoveOptions{}); err != nil {
+		return resp.ID, fmt.Errorf("container recreated but failed to remove old container %s: %v", backupName, err)
+	}
+
+	return resp.ID, nil
+}
+
+// userConfig 返回容器配置中由用户设置的部分，与镜像配置相同的字段被清空，重建时改用新镜像的值
+func userConfig(cfg *container.Config, image *container.Config) container.Config {
+	config := *cfg
+	if image == nil {
+		return config
+	}
+
+	config.Env = nil
+	for _, env := range cfg.Env {
+		if !slices.Contains(image.Env, env) {
+			config.Env = append(config.Env, env)
+		}
+	}
+	// 用户设置入口点时 Docker 不再使用镜像的命令，两者都保留
+	if slices.Equal(cfg.Entrypoint, image.Entrypoint) {
+		config.Entrypoint = nil
+		if slices.Equal(cfg.Cmd, image.Cmd) {
+			config.Cmd = nil
+		}
+	}
+	config.Labels = nil
+	for key, value := range cfg.Labels {
+		if imageValue, ok := image.Labels[key]; !ok || imageValue != value {
+			if config.Labels == nil {
+				config.Labels = map[string]string{}
+			}
+			config.Labels[key] = value
+		}
+	}
+	config.ExposedPorts = nil
+	for port := range cfg.ExposedPorts {
+		if _, ok := image.ExposedPorts[port]; !ok {
+			if config.ExposedPorts == nil {
+				config.ExposedPorts = nat.PortSet{}
+			}
+			config.ExposedPorts[port] = struct{}{}
+		}
+	}
+	config.Volumes = maps.Clone(cfg.Volumes)
+	for path := range image.Volumes {
+		delete(config.Volumes, path)
+	}
+	if cfg.WorkingDir == image.WorkingDir {
+		config.WorkingDir = ""
+	}
+	if cfg.User == image.User {
+		config.User = ""
+	}
+	if cfg.StopSignal == image.StopSignal {
+		config.StopSignal = ""
+	}
+	if slices.Equal(cfg.Shell, image.Shell) {
+		config.Shell = nil
+	}
+	if reflect.DeepEqual(cfg.Healthcheck, image.Healthcheck) {
+		config.Healthcheck = nil
+	}
+	return config
+}
+
+// anonymousVolumeMounts 把旧容器的匿名卷 (镜像 VOLUME 或 -v /path 创建的卷) 转换为挂载，
+// 新容器沿用原来的卷而不是创建空卷；命名卷和绑定挂载已经在 HostConfig 中
+func anonymousVolumeMounts(old types.ContainerJSON) []mount.Mount {
+	configured := map[string]bool{}
+	for _, bind := range old.HostConfig.Binds {
+		if parts := strings.Split(bind, ":"); len(parts) >= 2 {
+			configured[parts[1]] = true
+		}
+	}
+	for _, m := range old.HostConfig.Mounts {
+		configured[m.Target] = true
+	}
+
+	var mounts []mount.Mount
+	for _, m := range old.Mounts {
+		if m.Type != mount.TypeVolume || m.Name == "" || configured[m.Destination] {
+			continue
+		}
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   m.Name,
+			Target:   m.Destination,
+			ReadOnly: !m.RW,
+		})
+	}
+	return mounts
+}
+
+// recreateEndpoints 从旧容器中提取网络端点配置，返回创建时使用的主网络和需要之后连接的其他网络
+// 只保留用户配置的字段，运行时分配的地址等信息会被丢弃
+func recreateEndpoints(old types.ContainerJSON) (map[string]*network.EndpointSettings, map[string]*network.EndpointSettings) {
+	primary := map[string]*network.EndpointSettings{}
+	extra := map[string]*network.EndpointSettings{}
+	if old.NetworkSettings == nil {
+		return primary, extra
+	}
+
+	mode := string(old.HostConfig.NetworkMode)
+	for networkName, endpoint := range old.NetworkSettings.Networks {
+		if endpoint == nil {
+			continue
+		}
+
+		// Docker 会自动添加容器短 ID 作为别名，不需要保留
+		var aliases []string
+		for _, alias := range endpoint.Aliases {
+			if alias != old.ID[:12] {
+				aliases = append(aliases, alias)
+			}
+		}
+
+		settings := &network.EndpointSettings{
+			IPAMConfig: endpoint.IPAMConfig,
+			Links:      endpoint.Links,
+			Aliases:    aliases,
+			DriverOpts: endpoint.DriverOpts,
+		}
+		if networkName == mode || (mode == "default" && networkName == "bridge") {
+			primary[networkName] = settings
+		} else {
+			extra[networkName] = settings
+		}
+	}
+	return primary, extra
+}
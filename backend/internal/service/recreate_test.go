@@ -0,0 +1,81 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestUserConfig(t *testing.T) {
+	image := &container.Config{
+		Env:          []string{"PATH=/usr/bin", "VERSION=1.0"},
+		Cmd:          []string{"nginx", "-g", "daemon off;"},
+		Labels:       map[string]string{"maintainer": "nginx", "version": "1.0"},
+		ExposedPorts: nat.PortSet{"80/tcp": {}},
+		Volumes:      map[string]struct{}{"/var/cache/nginx": {}},
+		WorkingDir:   "/usr/share/nginx",
+		StopSignal:   "SIGQUIT",
+	}
+	cfg := &container.Config{
+		Hostname:     "web",
+		Env:          []string{"PATH=/usr/bin", "VERSION=1.0", "MODE=prod"},
+		Cmd:          image.Cmd,
+		Labels:       map[string]string{"maintainer": "nginx", "version": "custom", "app": "web"},
+		ExposedPorts: nat.PortSet{"80/tcp": {}, "8080/tcp": {}},
+		Volumes:      map[string]struct{}{"/var/cache/nginx": {}, "/data": {}},
+		WorkingDir:   image.WorkingDir,
+		StopSignal:   image.StopSignal,
+		User:         "nginx",
+	}
+
+	got := userConfig(cfg, image)
+	want := container.Config{
+		Hostname:     "web",
+		Env:          []string{"MODE=prod"},
+		Labels:       map[string]string{"version": "custom", "app": "web"},
+		ExposedPorts: nat.PortSet{"8080/tcp": {}},
+		Volumes:      map[string]struct{}{"/data": {}},
+		User:         "nginx",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected user config\n got %+v\nwant %+v", got, want)
+	}
+	if len(cfg.Volumes) != 2 || len(cfg.Env) != 3 {
+		t.Fatal("userConfig must not modify the container config")
+	}
+
+	// 用户设置了入口点时命令一起保留
+	cfg = &container.Config{Entrypoint: []string{"/bin/sh", "-c"}, Cmd: image.Cmd}
+	if got := userConfig(cfg, image); !reflect.DeepEqual(got.Entrypoint, cfg.Entrypoint) || !reflect.DeepEqual(got.Cmd, cfg.Cmd) {
+		t.Fatalf("expected entrypoint and command to be kept, got %+v", got)
+	}
+}
+
+func TestAnonymousVolumeMounts(t *testing.T) {
+	old := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			HostConfig: &container.HostConfig{
+				Binds:  []string{"/srv/html:/usr/share/nginx/html:ro", "logs:/var/log/nginx"},
+				Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: "conf", Target: "/etc/nginx"}},
+			},
+		},
+		Mounts: []types.MountPoint{
+			{Type: mount.TypeBind, Source: "/srv/html", Destination: "/usr/share/nginx/html"},
+			{Type: mount.TypeVolume, Name: "logs", Destination: "/var/log/nginx", RW: true},
+			{Type: mount.TypeVolume, Name: "conf", Destination: "/etc/nginx", RW: true},
+			{Type: mount.TypeVolume, Name: "3f2a9c", Destination: "/var/cache/nginx", RW: true},
+			{Type: mount.TypeVolume, Name: "8b1d4e", Destination: "/data"},
+		},
+	}
+	want := []mount.Mount{
+		{Type: mount.TypeVolume, Source: "3f2a9c", Target: "/var/cache/nginx"},
+		{Type: mount.TypeVolume, Source: "8b1d4e", Target: "/data", ReadOnly: true},
+	}
+	if got := anonymousVolumeMounts(old); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected mounts\n got %+v\nwant %+v", got, want)
+	}
+}
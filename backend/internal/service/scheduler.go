@@ -0,0 +1,412 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smartcat999/container-ui/internal/config"
+)
+
+// 定时任务支持的动作
+const (
+	ScheduleStart   = "start"
+	ScheduleStop    = "stop"
+	ScheduleRestart = "restart"
+	SchedulePrune   = "prune"
+)
+
+// 每个定时任务保留的执行记录条数
+const scheduleHistoryLimit = 50
+
+// Schedule 定时任务，保存在独立的 JSON 文件中
+type Schedule struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Context   string        `json:"context"`
+	Cron      string        `json:"cron"`
+	Action    string        `json:"action"`
+	Container string        `json:"container,omitempty"` // start/stop/restart 的目标容器
+	Prune     *PruneOptions `json:"prune,omitempty"`     // prune 的清理选项，为空表示清理全部资源
+	Enabled   bool          `json:"enabled"`
+	CreatedAt time.Time     `json:"createdAt"`
+	NextRun   *time.Time    `json:"nextRun,omitempty"` // 仅在返回时计算，不持久化
+}
+
+// ScheduleRun 一次执行记录
+type ScheduleRun struct {
+	StartedAt time.Time   `json:"startedAt"`
+	Duration  string      `json:"duration"`
+	Success   bool        `json:"success"`
+	Error     string      `json:"error,omitempty"`
+	Result    interface{} `json:"result,omitempty"`
+}
+
+// Validate 检查定时任务配置是否合法
+func (sc Schedule) Validate() error {
+	if sc.Context == "" {
+		return fmt.Errorf("context is required")
+	}
+	if _, err := ParseCron(sc.Cron); err != nil {
+		return err
+	}
+	switch sc.Action {
+	case ScheduleStart, ScheduleStop, ScheduleRestart:
+		if sc.Container == "" {
+			return fmt.Errorf("container is required for action %s", sc.Action)
+		}
+	case SchedulePrune:
+	default:
+		return fmt.Errorf("unsupported action: %s", sc.Action)
+	}
+	return nil
+}
+
+// Scheduler 按 cron 表达式执行容器操作和清理任务
+// 任务定义持久化到配置文件，执行记录只保存在内存中
+type Scheduler struct {
+	docker   *DockerService
+	filePath string
+
+	mu        sync.Mutex
+	schedules map[string]*Schedule
+	history   map[string][]ScheduleRun
+	running   map[string]bool // 正在执行的任务，避免同一任务重叠执行
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewScheduler 创建调度器并从 filePath 加载已保存的定时任务
+// 文件不存在时尝试从 legacyPath（旧版本的 context 配置文件）中读取 schedules 字段
+func NewScheduler(docker *DockerService, filePath string, legacyPath string) (*Scheduler, error) {
+	s := &Scheduler{
+		docker:    docker,
+		filePath:  filePath,
+		schedules: make(map[string]*Schedule),
+		history:   make(map[string][]ScheduleRun),
+		running:   make(map[string]bool),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	schedules, err := loadSchedules(filePath, legacyPath)
+	if err != nil {
+		return nil, err
+	}
+	for i := range schedules {
+		s.schedules[schedules[i].ID] = &schedules[i]
+	}
+	return s, nil
+}
+
+// Start 启动调度循环，每分钟整点检查一次需要执行的任务
+func (s *Scheduler) Start() {
+	go func() {
+		defer close(s.done)
+		for {
+			now := time.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-s.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+				s.runDue(next)
+			}
+		}
+	}()
+}
+
+// Stop 停止调度循环，不等待正在执行的任务
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// runDue 执行在 t 这一分钟应触发的任务
+func (s *Scheduler) runDue(t time.Time) {
+	s.mu.Lock()
+	var due []Schedule
+	for _, sc := range s.schedules {
+		if !sc.Enabled || s.running[sc.ID] {
+			continue
+		}
+		cron, err := ParseCron(sc.Cron)
+		if err != nil {
+			continue
+		}
+		// Next(t - 1m) == t 表示 t 这一分钟匹配表达式
+		if cron.Next(t.Add(-time.Minute)).Equal(t) {
+			s.running[sc.ID] = true
+			due = append(due, *sc)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sc := range due {
+		go s.execute(sc)
+	}
+}
+
+// execute 执行一次任务并记录结果
+func (s *Scheduler) execute(sc Schedule) ScheduleRun {
+	run := ScheduleRun{StartedAt: time.Now()}
+	result, err := s.runAction(sc)
+	run.Duration = time.Since(run.StartedAt).Round(time.Millisecond).String()
+	run.Success = err == nil
+	run.Result = result
+	if err != nil {
+		run.Error = err.Error()
+		log.Printf("Schedule %s (%s) failed: %v", sc.ID, sc.Name, err)
+	}
+
+	s.mu.Lock()
+	delete(s.running, sc.ID)
+	history := append(s.history[sc.ID], run)
+	if len(history) > scheduleHistoryLimit {
+		history = history[len(history)-scheduleHistoryLimit:]
+	}
+	s.history[sc.ID] = history
+	s.mu.Unlock()
+
+	return run
+}
+
+func (s *Scheduler) runAction(sc Schedule) (interface{}, error) {
+	if err := s.docker.CheckWritable(sc.Context); err != nil {
+		return nil, err
+	}
+	switch sc.Action {
+	case ScheduleStart:
+		return nil, s.docker.StartContainer(sc.Context, sc.Container)
+	case ScheduleStop:
+		return nil, s.docker.StopContainer(sc.Context, sc.Container)
+	case ScheduleRestart:
+		return nil, s.docker.RestartContainer(sc.Context, sc.Container, nil)
+	case SchedulePrune:
+		var opts PruneOptions
+		if sc.Prune != nil {
+			opts = *sc.Prune
+		}
+		reports, total, err := s.docker.Prune(sc.Context, opts)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"reports": reports, "spaceReclaimed": total}, nil
+	}
+	return nil, fmt.Errorf("unsupported action: %s", sc.Action)
+}
+
+// withNextRun 返回附带下一次执行时间的副本
+func withNextRun(sc Schedule) Schedule {
+	sc.NextRun = nil
+	if !sc.Enabled {
+		return sc
+	}
+	if cron, err := ParseCron(sc.Cron); err == nil {
+		if next := cron.Next(time.Now()); !next.IsZero() {
+			sc.NextRun = &next
+		}
+	}
+	return sc
+}
+
+// List 返回全部定时任务，按创建时间排序
+func (s *Scheduler) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules := make([]Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		schedules = append(schedules, withNextRun(*sc))
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+	})
+	return schedules
+}
+
+// Get 获取定时任务
+func (s *Scheduler) Get(id string) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, false
+	}
+	return withNextRun(*sc), true
+}
+
+// Create 创建定时任务
+func (s *Scheduler) Create(sc Schedule) (Schedule, error) {
+	if err := sc.Validate(); err != nil {
+		return Schedule{}, err
+	}
+
+	id, err := newScheduleID()
+	if err != nil {
+		return Schedule{}, err
+	}
+	sc.ID = id
+	sc.CreatedAt = time.Now()
+	sc.NextRun = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules[sc.ID] = &sc
+	if err := s.save(); err != nil {
+		delete(s.schedules, sc.ID)
+		return Schedule{}, err
+	}
+	return withNextRun(sc), nil
+}
+
+// Update 更新定时任务，ID 和创建时间保持不变
+func (s *Scheduler) Update(id string, sc Schedule) (Schedule, error) {
+	if err := sc.Validate(); err != nil {
+		return Schedule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, fmt.Errorf("schedule %s not found", id)
+	}
+
+	sc.ID = id
+	sc.CreatedAt = old.CreatedAt
+	sc.NextRun = nil
+	s.schedules[id] = &sc
+	if err := s.save(); err != nil {
+		s.schedules[id] = old
+		return Schedule{}, err
+	}
+	return withNextRun(sc), nil
+}
+
+// Delete 删除定时任务及其执行记录
+func (s *Scheduler) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.schedules[id]
+	if !ok {
+		return fmt.Errorf("schedule %s not found", id)
+	}
+
+	delete(s.schedules, id)
+	if err := s.save(); err != nil {
+		s.schedules[id] = old
+		return err
+	}
+	delete(s.history, id)
+	return nil
+}
+
+// Run 立即执行一次定时任务
+func (s *Scheduler) Run(id string) (ScheduleRun, error) {
+	s.mu.Lock()
+	sc, ok := s.schedules[id]
+	if !ok {
+		s.mu.Unlock()
+		return ScheduleRun{}, fmt.Errorf("schedule %s not found", id)
+	}
+	if s.running[id] {
+		s.mu.Unlock()
+		return ScheduleRun{}, fmt.Errorf("schedule %s is already running", id)
+	}
+	s.running[id] = true
+	copied := *sc
+	s.mu.Unlock()
+
+	return s.execute(copied), nil
+}
+
+// History 返回定时任务的执行记录，最新的在前
+func (s *Scheduler) History(id string) ([]ScheduleRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.schedules[id]; !ok {
+		return nil, fmt.Errorf("schedule %s not found", id)
+	}
+
+	history := s.history[id]
+	runs := make([]ScheduleRun, len(history))
+	for i, run := range history {
+		runs[len(history)-1-i] = run
+	}
+	return runs, nil
+}
+
+// save 将定时任务写入文件，调用方需持有锁
+func (s *Scheduler) save() error {
+	schedules := make([]Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		schedules = append(schedules, *sc)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteFileAtomic(s.filePath, data, 0644)
+}
+
+// loadSchedules 读取定时任务文件
+func loadSchedules(filePath string, legacyPath string) ([]Schedule, error) {
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return loadLegacySchedules(legacyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var schedules []Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return nil, fmt.Errorf("failed to parse schedules: %v", err)
+	}
+	return schedules, nil
+}
+
+// loadLegacySchedules 读取旧版本保存在 context 配置文件中的定时任务，下次保存时写入新文件
+func loadLegacySchedules(legacyPath string) ([]Schedule, error) {
+	if legacyPath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(legacyPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var legacy struct {
+		Schedules []Schedule `json:"schedules"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("failed to parse legacy schedules: %v", err)
+	}
+	return legacy.Schedules, nil
+}
+
+func newScheduleID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
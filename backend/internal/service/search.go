@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// 搜索结果来源
+const (
+	SearchSourceDockerHub = "dockerhub"
+	SearchSourceRegistry  = "registry"
+)
+
+// SearchResult 统一的镜像搜索结果
+type SearchResult struct {
+	Name        string `json:"name"` // 可直接用于拉取的镜像名称
+	Description string `json:"description"`
+	StarCount   int    `json:"starCount"`
+	Official    bool   `json:"official"`
+	Source      string `json:"source"`
+}
+
+// SearchImages 通过 Docker 引擎搜索 Docker Hub 上的镜像
+func (s *DockerService) SearchImages(contextName string, term string, limit int) ([]SearchResult, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := cli.ImageSearch(context.Background(), term, types.ImageSearchOptions{Limit: limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search images: %v", err)
+	}
+
+	searchResults := make([]SearchResult, 0, len(results))
+	for _, r := range results {
+		searchResults = append(searchResults, SearchResult{
+			Name:        r.Name,
+			Description: r.Description,
+			StarCount:   r.StarCount,
+			Official:    r.IsOfficial,
+			Source:      SearchSourceDockerHub,
+		})
+	}
+	return searchResults, nil
+}
+
+// SearchRegistryCatalog 在内置镜像仓库的目录中按名称搜索镜像
+// registryURL 为仓库地址，例如 http://localhost:5050，返回的名称带有仓库主机前缀以便直接拉取
+func SearchRegistryCatalog(registryURL string, term string, limit int) ([]SearchResult, error) {
+	base, err := url.Parse(registryURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry url: %v", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(base.String(), "/") + "/v2/_catalog")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query registry catalog: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry catalog returned status %d", resp.StatusCode)
+	}
+
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&catalog); err != nil {
+		return nil, fmt.Errorf("failed to decode registry catalog: %v", err)
+	}
+
+	term = strings.ToLower(term)
+	results := []SearchResult{}
+	for _, repo := range catalog.Repositories {
+		if !strings.Contains(strings.ToLower(repo), term) {
+			continue
+		}
+		results = append(results, SearchResult{
+			Name:   base.Host + "/" + repo,
+			Source: SearchSourceRegistry,
+		})
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sshStderrLimit ssh 错误输出最多保留的字节数
+const sshStderrLimit = 4096
+
+// sshDialer 返回通过 ssh 连接远程 Docker 的拨号函数
+// 与 docker CLI 一致，调用本机的 ssh 命令并在远端执行 `docker system dial-stdio`，
+// 因此支持 ssh-agent、~/.ssh/config 和 known_hosts；远端需要安装 docker CLI
+func sshDialer(config ContextConfig) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	u, err := url.Parse(config.Host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh host %q: %v", config.Host, err)
+	}
+	if u.Scheme != "ssh" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid ssh host %q: expected ssh://[user@]host[:port]", config.Host)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("invalid ssh host %q: path is not supported", config.Host)
+	}
+
+	// BatchMode 禁止交互式输入密码，认证只能使用密钥或 ssh-agent
+	args := []string{"-o", "ConnectTimeout=30", "-o", "BatchMode=yes"}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	if config.SSHIdentityFile != "" {
+		args = append(args, "-i", config.SSHIdentityFile, "-o", "IdentitiesOnly=yes")
+	}
+	if config.SSHKnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+config.SSHKnownHostsFile)
+	}
+	switch config.SSHHostKeyCheck {
+	case "":
+		// 使用 ssh 配置中的默认策略
+	case "yes", "accept-new":
+		args = append(args, "-o", "StrictHostKeyChecking="+config.SSHHostKeyCheck)
+	case "no":
+		args = append(args, "-o", "StrictHostKeyChecking=no")
+		if config.SSHKnownHostsFile == "" {
+			args = append(args, "-o", "UserKnownHostsFile=/dev/null")
+		}
+	default:
+		return nil, fmt.Errorf("invalid ssh host key check %q: expected yes, accept-new or no", config.SSHHostKeyCheck)
+	}
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return newCommandConn("ssh", args...)
+	}, nil
+}
+
+// commandConn 将子进程的 stdin/stdout 包装成 net.Conn
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr *limitedBuffer
+
+	closeOnce sync.Once
+	waitOnce  sync.Once
+	waitErr   error
+}
+
+func newCommandConn(name string, args ...string) (net.Conn, error) {
+	// 连接的生命周期由 HTTP 连接池管理，不能与单个请求的 context 绑定
+	cmd := exec.Command(name, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &limitedBuffer{limit: sshStderrLimit}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %v", name, err)
+	}
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, stderr: stderr}, nil
+}
+
+// wait 等待子进程退出，返回包含 stderr 内容的错误
+func (c *commandConn) wait() error {
+	c.waitOnce.Do(func() {
+		err := c.cmd.Wait()
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			c.waitErr = fmt.Errorf("ssh connection failed: %s", msg)
+		} else if err != nil {
+			c.waitErr = fmt.Errorf("ssh connection failed: %v", err)
+		}
+	})
+	return c.waitErr
+}
+
+func (c *commandConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		// 子进程异常退出时返回 ssh 的错误输出，便于定位认证或主机密钥问题
+		if werr := c.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	n, err := c.stdin.Write(p)
+	if err != nil {
+		if werr := c.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// CloseWrite 关闭 stdin，hijack 连接（exec/attach）半关闭时使用
+func (c *commandConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		c.wait()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return dummyAddr{} }
+func (c *commandConn) RemoteAddr() net.Addr { return dummyAddr{} }
+
+// 管道不支持超时设置，忽略 deadline
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type dummyAddr struct{}
+
+func (dummyAddr) Network() string { return "ssh" }
+func (dummyAddr) String() string  { return "ssh" }
+
+// limitedBuffer 只保留最前面 limit 字节的缓冲区
+type limitedBuffer struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if remaining := b.limit - b.buf.Len(); remaining > 0 {
+		if len(p) > remaining {
+			b.buf.Write(p[:remaining])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
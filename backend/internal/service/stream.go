@@ -0,0 +1,54 @@
+package service
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// 多路复用流的类型，见 Docker Engine API 中 attach 和 logs 的说明
+const (
+	streamStdin  = 0
+	streamStdout = 1
+	streamStderr = 2
+)
+
+// DemuxStream 解析未启用 TTY 时 Docker 返回的多路复用流，将标准输出和标准错误分别写入 stdout 和 stderr
+// 每一帧以 8 字节的头开始：第 1 字节为流类型，后 4 字节为大端序的数据长度
+func DemuxStream(stdout, stderr io.Writer, src io.Reader) error {
+	header := make([]byte, 8)
+	buf := make([]byte, 32*1024)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		var dst io.Writer
+		switch header[0] {
+		case streamStdin, streamStdout:
+			dst = stdout
+		case streamStderr:
+			dst = stderr
+		default:
+			return fmt.Errorf("invalid stream type %d", header[0])
+		}
+
+		size := int(binary.BigEndian.Uint32(header[4:]))
+		for size > 0 {
+			n := size
+			if n > len(buf) {
+				n = len(buf)
+			}
+			if _, err := io.ReadFull(src, buf[:n]); err != nil {
+				return err
+			}
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+			size -= n
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func frame(stream byte, data string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	return append(header, data...)
+}
+
+func TestDemuxStream(t *testing.T) {
+	var src bytes.Buffer
+	src.Write(frame(streamStdout, "out1 "))
+	src.Write(frame(streamStderr, "err"))
+	src.Write(frame(streamStdout, "out2"))
+
+	var stdout, stderr bytes.Buffer
+	if err := DemuxStream(&stdout, &stderr, &src); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "out1 out2" || stderr.String() != "err" {
+		t.Fatalf("unexpected output stdout=%q stderr=%q", stdout.String(), stderr.String())
+	}
+
+	if err := DemuxStream(&stdout, &stderr, bytes.NewReader([]byte{9, 0, 0, 0, 0, 0, 0, 1, 'x'})); err == nil {
+		t.Fatal("expected error for invalid stream type")
+	}
+}
+
+func TestLogLineWriter(t *testing.T) {
+	var got []LogLine
+	w := &logLineWriter{stream: LogStreamStdout, emit: func(stream, text string, ts time.Time) bool {
+		got = append(got, LogLine{Stream: stream, Line: text, Time: ts})
+		return true
+	}}
+
+	// 一行可能被拆分到多次写入中
+	w.Write([]byte("2024-01-31T10:30:15.123456789Z hel"))
+	w.Write([]byte("lo\r\nno timestamp\n2024-01-31T10:30:16Z partial"))
+	w.Flush()
+
+	if len(got) != 3 {
+		t.Fatalf("expected 3 lines, got %+v", got)
+	}
+	if got[0].Line != "hello" || got[0].Time.Nanosecond() != 123456789 {
+		t.Errorf("unexpected first line %+v", got[0])
+	}
+	if got[1].Line != "no timestamp" || !got[1].Time.IsZero() {
+		t.Errorf("unexpected second line %+v", got[1])
+	}
+	if got[2].Line != "partial" || got[2].Time.Second() != 16 {
+		t.Errorf("unexpected last line %+v", got[2])
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// NetworkContainers 返回连接到指定网络的容器（包括已停止的容器）
+func (s *DockerService) NetworkContainers(contextName string, id string) ([]ContainerInfo, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先解析网络，使名称和 ID 都能使用，同时在网络不存在时返回错误
+	network, err := cli.NetworkInspect(context.Background(), id, types.NetworkInspectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect network: %v", err)
+	}
+
+	return s.listContainersByFilter(contextName, filters.NewArgs(filters.Arg("network", network.ID)))
+}
+
+// VolumeContainers 返回挂载了指定数据卷的容器（包括已停止的容器）
+func (s *DockerService) VolumeContainers(contextName string, name string) ([]ContainerInfo, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := cli.VolumeInspect(context.Background(), name); err != nil {
+		return nil, fmt.Errorf("failed to inspect volume: %v", err)
+	}
+
+	return s.listContainersByFilter(contextName, filters.NewArgs(filters.Arg("volume", name)))
+}
+
+func (s *DockerService) listContainersByFilter(contextName string, args filters.Args) ([]ContainerInfo, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	containerInfos := make([]ContainerInfo, 0, len(containers))
+	for _, container := range containers {
+		containerInfos = append(containerInfos, toContainerInfo(container))
+	}
+	return containerInfos, nil
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+const (
+	// volumeHelperImage 用于挂载数据卷的辅助容器镜像
+	volumeHelperImage = "busybox:latest"
+	// volumeMountPoint 数据卷在辅助容器内的挂载点
+	volumeMountPoint = "/volume"
+)
+
+// VolumeCreateConfig 数据卷创建配置
+type VolumeCreateConfig struct {
+	Name       string            `json:"name"` // 为空时由 Docker 生成
+	Driver     string            `json:"driver"`
+	DriverOpts map[string]string `json:"driverOpts"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// CreateVolume 创建数据卷
+func (s *DockerService) CreateVolume(contextName string, config VolumeCreateConfig) (volume.Volume, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return volume.Volume{}, err
+	}
+
+	vol, err := cli.VolumeCreate(context.Background(), volume.CreateOptions{
+		Name:       config.Name,
+		Driver:     config.Driver,
+		DriverOpts: config.DriverOpts,
+		Labels:     config.Labels,
+	})
+	if err != nil {
+		return volume.Volume{}, fmt.Errorf("failed to create volume: %v", err)
+	}
+	return vol, nil
+}
+
+// ensureImage 确保镜像存在于本地，不存在时拉取
+func ensureImage(cli *client.Client, image string) error {
+	ctx := context.Background()
+	if _, _, err := cli.ImageInspectWithRaw(ctx, image); err == nil {
+		return nil
+	} else if !errdefs.IsNotFound(err) {
+		return err
+	}
+
+	reader, err := cli.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull helper image %s: %v", image, err)
+	}
+	defer reader.Close()
+
+	// 读取完拉取输出以等待拉取结束
+	if err := waitJSONMessages(reader); err != nil {
+		return fmt.Errorf("failed to pull helper image %s: %v", image, err)
+	}
+	return nil
+}
+
+// withVolumeHelper 创建一个挂载了数据卷的辅助容器（不启动），执行 fn 后删除容器
+// 已创建但未启动的容器同样支持文件复制，因此无需在容器内运行任何进程
+func withVolumeHelper(cli *client.Client, volumeName string, readOnly bool, fn func(containerID string) error) error {
+	ctx := context.Background()
+
+	if _, err := cli.VolumeInspect(ctx, volumeName); err != nil {
+		return fmt.Errorf("failed to inspect volume: %v", err)
+	}
+
+	if err := ensureImage(cli, volumeHelperImage); err != nil {
+		return err
+	}
+
+	mode := "rw"
+	if readOnly {
+		mode = "ro"
+	}
+
+	resp, err := cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:  volumeHelperImage,
+			Cmd:    []string{"true"},
+			Labels: map[string]string{"container-ui.helper": "volume"},
+		},
+		&container.HostConfig{
+			Binds: []string{fmt.Sprintf("%s:%s:%s", volumeName, volumeMountPoint, mode)},
+		},
+		nil, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to create helper container: %v", err)
+	}
+	defer cli.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{Force: true})
+
+	return fn(resp.ID)
+}
+
+// BrowseVolume 列出数据卷内指定目录的内容，dir 为相对于数据卷根目录的路径，目录过大时只返回部分子项，truncated 为 true
+func (s *DockerService) BrowseVolume(contextName string, name string, dir string) ([]FileEntry, bool, error) {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var entries []FileEntry
+	var truncated bool
+	err = withVolumeHelper(cli, name, true, func(containerID string) error {
+		var err error
+		entries, truncated, err = listContainerDir(cli, containerID, path.Join(volumeMountPoint, path.Clean("/"+dir)))
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 将辅助容器内的路径转换为数据卷内的路径
+	for i := range entries {
+		entries[i].Path = "/" + strings.TrimPrefix(strings.TrimPrefix(entries[i].Path, volumeMountPoint), "/")
+	}
+	return entries, truncated, nil
+}
+
+// BackupVolume 将数据卷内容以 tar 格式写入 w，归档内路径相对于数据卷根目录
+func (s *DockerService) BackupVolume(contextName string, name string, w io.Writer) error {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return err
+	}
+
+	return withVolumeHelper(cli, name, true, func(containerID string) error {
+		reader, _, err := cli.CopyFromContainer(context.Background(), containerID, volumeMountPoint)
+		if err != nil {
+			return fmt.Errorf("failed to read volume: %v", err)
+		}
+		defer reader.Close()
+
+		// Docker 返回的归档以挂载点目录名为前缀，去掉前缀使归档与挂载位置无关
+		prefix := path.Base(volumeMountPoint) + "/"
+		tr := tar.NewReader(reader)
+		tw := tar.NewWriter(w)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read volume archive: %v", err)
+			}
+
+			name := strings.TrimPrefix(header.Name, prefix)
+			if name == "" || name == path.Base(volumeMountPoint) {
+				continue
+			}
+			header.Name = name
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				return err
+			}
+		}
+		return tw.Close()
+	})
+}
+
+// RestoreVolume 将 tar 归档解压到数据卷根目录，数据卷不存在时自动创建
+func (s *DockerService) RestoreVolume(contextName string, name string, content io.Reader) error {
+	cli, err := s.getClient(contextName)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if _, err := cli.VolumeInspect(ctx, name); err != nil {
+		if !errdefs.IsNotFound(err) {
+			return fmt.Errorf("failed to inspect volume: %v", err)
+		}
+		if _, err := cli.VolumeCreate(ctx, volume.CreateOptions{Name: name}); err != nil {
+			return fmt.Errorf("failed to create volume: %v", err)
+		}
+	}
+
+	return withVolumeHelper(cli, name, false, func(containerID string) error {
+		err := cli.CopyToContainer(ctx, containerID, volumeMountPoint, content, types.CopyToContainerOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to restore volume: %v", err)
+		}
+		return nil
+	})
+}
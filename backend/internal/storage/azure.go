@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAzureBlockSize = 8 << 20
+	azureAPIVersion       = "2021-08-06"
+	// azureCopyPollInterval 异步复制未完成时轮询的间隔
+	azureCopyPollInterval = 500 * time.Millisecond
+)
+
+// AzureConfig Azure Blob Storage 的连接配置
+type AzureConfig struct {
+	AccountName string `json:"accountName"`
+	// AccountKey base64 编码的账户密钥，用于 Shared Key 签名
+	AccountKey string `json:"accountKey"`
+	Container  string `json:"container"`
+	// Prefix 所有 blob 名称的前缀
+	Prefix string `json:"prefix,omitempty"`
+	// Endpoint 服务地址，默认 https://<account>.blob.core.windows.net，Azurite 使用 http://127.0.0.1:10000/<account>
+	Endpoint string `json:"endpoint,omitempty"`
+	// BlockSize 分块上传的块大小，默认 8MiB
+	BlockSize int64 `json:"blockSize,omitempty"`
+}
+
+// NewAzureStorage 创建 Azure Blob 存储，blob 使用 Put Block 分块上传
+func NewAzureStorage(config AzureConfig) (Storage, error) {
+	if config.AccountName == "" || config.Container == "" {
+		return nil, errors.New("account name and container are required for azure storage")
+	}
+	key, err := base64.StdEncoding.DecodeString(config.AccountKey)
+	if err != nil || len(key) == 0 {
+		return nil, errors.New("invalid azure account key")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://" + config.AccountName + ".blob.core.windows.net"
+	}
+	if config.BlockSize <= 0 {
+		config.BlockSize = defaultAzureBlockSize
+	}
+
+	store := &azureStore{
+		account:   config.AccountName,
+		key:       key,
+		container: strings.TrimSuffix(config.Endpoint, "/") + "/" + config.Container,
+		client:    &http.Client{},
+		blockSize: int(config.BlockSize),
+	}
+	return newObjectStorage(store, config.Prefix), nil
+}
+
+// azureStore 通过 REST API 访问 Azure Blob Storage
+type azureStore struct {
+	account   string
+	key       []byte
+	container string
+	client    *http.Client
+	blockSize int
+}
+
+func (a *azureStore) blobURL(key string) string {
+	return a.container + "/" + s3Escape(key, false)
+}
+
+func (a *azureStore) get(key string) (io.ReadCloser, int64, error) {
+	resp, err := a.do(http.MethodGet, a.blobURL(key), nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (a *azureStore) size(key string) (int64, error) {
+	resp, err := a.do(http.MethodHead, a.blobURL(key), nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+func (a *azureStore) delete(key string) error {
+	resp, err := a.do(http.MethodDelete, a.blobURL(key), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// copy 使用 Copy Blob 在服务端复制，复制可能是异步的，等待完成后返回
+func (a *azureStore) copy(src, dst string) error {
+	resp, err := a.do(http.MethodPut, a.blobURL(dst), http.Header{"X-Ms-Copy-Source": {a.blobURL(src)}}, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	status := resp.Header.Get("X-Ms-Copy-Status")
+	for status == "pending" {
+		time.Sleep(azureCopyPollInterval)
+		resp, err := a.do(http.MethodHead, a.blobURL(dst), nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		status = resp.Header.Get("X-Ms-Copy-Status")
+	}
+	if status != "" && status != "success" {
+		return fmt.Errorf("copy blob %s", status)
+	}
+	return nil
+}
+
+func (a *azureStore) list(prefix string) ([]string, error) {
+	var keys []string
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {prefix}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := a.do(http.MethodGet, a.container+"?"+query.Encode(), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Blobs []struct {
+				Name string `xml:"Name"`
+			} `xml:"Blobs>Blob"`
+			NextMarker string `xml:"NextMarker"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid list response: %v", err)
+		}
+
+		for _, blob := range result.Blobs {
+			keys = append(keys, blob.Name)
+		}
+		if result.NextMarker == "" {
+			return keys, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// create 不超过一个块的 blob 直接上传，否则逐块 Put Block，Close 时提交块列表
+func (a *azureStore) create(key string) (objectWriter, error) {
+	blobURL := a.blobURL(key)
+	var blocks []string
+
+	putBlock := func(data []byte) error {
+		// 同一个 blob 的块 ID 长度必须相同
+		id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", len(blocks))))
+		resp, err := a.do(http.MethodPut, blobURL+"?comp=block&blockid="+url.QueryEscape(id), nil, data)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		blocks = append(blocks, id)
+		return nil
+	}
+
+	w := &chunkWriter{chunkSize: a.blockSize, flush: putBlock}
+	w.commit = func(rest []byte) error {
+		if len(blocks) == 0 {
+			resp, err := a.do(http.MethodPut, blobURL, http.Header{"X-Ms-Blob-Type": {"BlockBlob"}}, rest)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			return nil
+		}
+		if len(rest) > 0 {
+			if err := putBlock(rest); err != nil {
+				return err
+			}
+		}
+		body, err := xml.Marshal(struct {
+			XMLName xml.Name `xml:"BlockList"`
+			Latest  []string `xml:"Latest"`
+		}{Latest: blocks})
+		if err != nil {
+			return err
+		}
+		resp, err := a.do(http.MethodPut, blobURL+"?comp=blocklist", nil, body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	// 未提交的块会被服务端自动清理
+	return w, nil
+}
+
+// do 发送使用 Shared Key 签名的请求
+func (a *azureStore) do(method, rawURL string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	a.sign(req, len(body), time.Now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, httpStatusError(resp)
+}
+
+// sign 按 Shared Key 规则签名请求
+func (a *azureStore) sign(req *http.Request, contentLength int, now time.Time) {
+	req.Header.Set("X-Ms-Date", now.UTC().Format(http.TimeFormat))
+	req.Header.Set("X-Ms-Version", azureAPIVersion)
+
+	length := ""
+	if contentLength > 0 {
+		length = strconv.Itoa(contentLength)
+	}
+	var names []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+
+	// 规范化资源：/<account><path>，查询参数按名称排序，每行一个
+	canonical.WriteString("/" + a.account + req.URL.EscapedPath())
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for name := range query {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		canonical.WriteString("\n" + strings.ToLower(name) + ":" + strings.Join(values, ","))
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		length,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date，使用 x-ms-date
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonical.String(),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(stringToSign))
+	req.Header.Set("Authorization", "SharedKey "+a.account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAzure 实现测试用到的 Blob REST API 子集，列表每页只返回一个 blob 以覆盖分页
+type fakeAzure struct {
+	mutex  sync.Mutex
+	blobs  map[string][]byte
+	blocks map[string][]byte
+	puts   int
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey account:") || r.Header.Get("X-Ms-Date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	query := r.URL.Query()
+	name := strings.TrimPrefix(r.URL.Path, "/account/container/")
+
+	switch {
+	case r.URL.Path == "/account/container" && query.Get("comp") == "list":
+		var names []string
+		for blob := range f.blobs {
+			if strings.HasPrefix(blob, query.Get("prefix")) && blob > query.Get("marker") {
+				names = append(names, blob)
+			}
+		}
+		sort.Strings(names)
+		fmt.Fprint(w, "<EnumerationResults><Blobs>")
+		if len(names) > 0 {
+			fmt.Fprintf(w, "<Blob><Name>%s</Name></Blob>", names[0])
+		}
+		fmt.Fprint(w, "</Blobs><NextMarker>")
+		if len(names) > 1 {
+			fmt.Fprint(w, names[0])
+		}
+		fmt.Fprint(w, "</NextMarker></EnumerationResults>")
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		f.blocks[name+"/"+query.Get("blockid")] = body
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var list struct {
+			Latest []string `xml:"Latest"`
+		}
+		xml.Unmarshal(body, &list)
+		var data []byte
+		for _, id := range list.Latest {
+			data = append(data, f.blocks[name+"/"+id]...)
+		}
+		f.blobs[name] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && r.Header.Get("X-Ms-Copy-Source") != "":
+		src := r.Header.Get("X-Ms-Copy-Source")
+		src = strings.ReplaceAll(src[strings.Index(src, "/account/container/")+len("/account/container/"):], "%3A", ":")
+		f.blobs[name] = f.blobs[src]
+		w.Header().Set("X-Ms-Copy-Status", "success")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut:
+		if r.Header.Get("X-Ms-Blob-Type") != "BlockBlob" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.puts++
+		f.blobs[name] = body
+		w.WriteHeader(http.StatusCreated)
+	default:
+		data, ok := f.blobs[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(f.blobs, name)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	}
+}
+
+func TestAzureStorage(t *testing.T) {
+	fake := &fakeAzure{blobs: map[string][]byte{}, blocks: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s, err := New("azure", Parameters{
+		"accountname": "account",
+		"accountkey":  base64.StdEncoding.EncodeToString([]byte("secret")),
+		"container":   "container",
+		"endpoint":    server.URL + "/account",
+		"blocksize":   "4",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.PutManifest("library/app", "v1", "sha256:abc", []byte("man")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _, err := s.GetManifest("library/app", "v1"); err != nil || string(data) != "man" {
+		t.Fatalf("unexpected manifest %q %v", data, err)
+	}
+
+	// 超过一个块时分块上传并提交块列表
+	puts, blocks := fake.puts, len(fake.blocks)
+	if n, err := s.PutBlob("library/app", "sha256:large", strings.NewReader("0123456789")); err != nil || n != 10 {
+		t.Fatalf("unexpected put result %d %v", n, err)
+	}
+	if fake.puts != puts || len(fake.blocks)-blocks != 3 {
+		t.Fatalf("expected block upload, got %d puts and %d blocks", fake.puts-puts, len(fake.blocks)-blocks)
+	}
+	reader, size, err := s.GetBlob("library/app", "sha256:large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if !bytes.Equal(data, []byte("0123456789")) || size != 10 {
+		t.Fatalf("unexpected blob %q", data)
+	}
+
+	if err := s.InitiateUpload("library/app", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AppendToUpload("library/app", "u1", strings.NewReader("lay")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompleteUpload("library/app", "u1", "sha256:layer", strings.NewReader("er")); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := s.GetBlobSize("library/app", "sha256:layer"); err != nil || size != 5 {
+		t.Fatalf("unexpected blob size %d %v", size, err)
+	}
+
+	if repos, err := s.ListRepositories(); err != nil || len(repos) != 1 || repos[0] != "library/app" {
+		t.Fatalf("unexpected repositories %v %v", repos, err)
+	}
+	if err := s.DeleteManifest("library/app", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := s.ListTags("library/app"); len(tags) != 0 {
+		t.Fatalf("expected tag to be removed, got %v", tags)
+	}
+}
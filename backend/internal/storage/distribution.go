@@ -0,0 +1,700 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// digestPattern 摘要格式 algorithm:hex，拼接路径前必须校验，避免 .. 之类的路径穿越
+var digestPattern = regexp.MustCompile(`^([a-z0-9]+):([a-f0-9]{32,})$`)
+
+// DistributionStorage 实现与 docker/distribution (registry:2) 文件系统驱动相同的目录布局，
+// 已有的 registry 数据目录可以直接挂载使用，写入的数据也可以迁移到官方 registry：
+//
+//	docker/registry/v2/blobs/<alg>/<hex[:2]>/<hex>/data                         blob 和清单内容
+//	docker/registry/v2/repositories/<name>/_layers/<alg>/<hex>/link             仓库引用的 blob
+//	docker/registry/v2/repositories/<name>/_manifests/revisions/<alg>/<hex>/link 仓库中的清单
+//	docker/registry/v2/repositories/<name>/_manifests/tags/<tag>/current/link   标签当前指向的清单
+//	docker/registry/v2/repositories/<name>/_manifests/tags/<tag>/index/<alg>/<hex>/link
+//	docker/registry/v2/repositories/<name>/_uploads/<id>/data                   未完成的上传
+//
+// 删除只移除链接，blob 内容由垃圾回收清理，与 distribution 的行为一致
+type DistributionStorage struct {
+	rootDir string
+	mutex   sync.RWMutex
+}
+
+// NewDistributionStorage 创建 distribution 布局的存储，rootDir 对应 registry 配置中的 rootdirectory
+func NewDistributionStorage(rootDir string) (*DistributionStorage, error) {
+	for _, dir := range []string{"blobs", "repositories"} {
+		if err := os.MkdirAll(filepath.Join(rootDir, "docker", "registry", "v2", dir), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %v", dir, err)
+		}
+	}
+	return &DistributionStorage{rootDir: rootDir}, nil
+}
+
+// RootDir 返回存储根目录
+func (s *DistributionStorage) RootDir() string {
+	return s.rootDir
+}
+
+// ListRepositories 列出所有仓库，包含 _manifests 目录的目录即为仓库
+func (s *DistributionStorage) ListRepositories() ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	root := s.path("repositories")
+	var repositories []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || p == root {
+			return nil
+		}
+		if d.Name() == "_manifests" {
+			rel, err := filepath.Rel(root, filepath.Dir(p))
+			if err != nil {
+				return err
+			}
+			repositories = append(repositories, filepath.ToSlash(rel))
+		}
+		if strings.HasPrefix(d.Name(), "_") {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk repositories directory: %v", err)
+	}
+	sort.Strings(repositories)
+	return repositories, nil
+}
+
+// ListTags 列出仓库的所有标签
+func (s *DistributionStorage) ListTags(repository string) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	entries, err := os.ReadDir(s.path("repositories", repository, "_manifests", "tags"))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags directory: %v", err)
+	}
+
+	tags := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			tags = append(tags, entry.Name())
+		}
+	}
+	return tags, nil
+}
+
+// GetManifest 获取清单
+func (s *DistributionStorage) GetManifest(repository, reference string) ([]byte, string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	digest := reference
+	if !strings.Contains(reference, ":") {
+		var err error
+		if digest, err = readLink(s.path("repositories", repository, "_manifests", "tags", reference, "current", "link")); err != nil {
+			return nil, "", fmt.Errorf("failed to read tag link: %v", err)
+		}
+	}
+	return s.getManifestByDigest(repository, digest)
+}
+
+// ManifestModTime 返回引用的链接文件最后写入的时间，标签为标签最后一次更新的时间
+func (s *DistributionStorage) ManifestModTime(repository, reference string) (time.Time, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	link := s.path("repositories", repository, "_manifests", "tags", reference, "current", "link")
+	if strings.Contains(reference, ":") {
+		alg, hex, err := splitDigest(reference)
+		if err != nil {
+			return time.Time{}, err
+		}
+		link = s.path("repositories", repository, "_manifests", "revisions", alg, hex, "link")
+	}
+	info, err := os.Stat(link)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to stat manifest link: %v", err)
+	}
+	return info.ModTime(), nil
+}
+
+// GetManifestByDigest 通过摘要获取清单
+func (s *DistributionStorage) GetManifestByDigest(repository, digest string) ([]byte, string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.getManifestByDigest(repository, digest)
+}
+
+// getManifestByDigest 读取清单内容，调用方需持有读锁
+func (s *DistributionStorage) getManifestByDigest(repository, digest string) ([]byte, string, error) {
+	alg, hex, err := splitDigest(digest)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := readLink(s.path("repositories", repository, "_manifests", "revisions", alg, hex, "link")); err != nil {
+		return nil, "", fmt.Errorf("failed to read manifest link: %v", err)
+	}
+	data, err := os.ReadFile(s.blobDataPath(alg, hex))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read manifest file: %v", err)
+	}
+	return data, digest, nil
+}
+
+// PutManifest 存储清单，清单内容和 blob 一样保存在 blobs 目录中
+func (s *DistributionStorage) PutManifest(repository, reference, digest string, manifest []byte) error {
+	alg, hex, err := splitDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := writeFileAtomic(s.blobDataPath(alg, hex), manifest); err != nil {
+		return fmt.Errorf("failed to write manifest file: %v", err)
+	}
+	manifests := s.path("repositories", repository, "_manifests")
+	if err := writeLink(filepath.Join(manifests, "revisions", alg, hex, "link"), digest); err != nil {
+		return fmt.Errorf("failed to write manifest link: %v", err)
+	}
+
+	// 如果提供了标签引用，更新标签
+	if reference != "" && !strings.Contains(reference, ":") {
+		tagDir := filepath.Join(manifests, "tags", reference)
+		if err := writeLink(filepath.Join(tagDir, "index", alg, hex, "link"), digest); err != nil {
+			return fmt.Errorf("failed to write tag index link: %v", err)
+		}
+		if err := writeLink(filepath.Join(tagDir, "current", "link"), digest); err != nil {
+			return fmt.Errorf("failed to write tag link: %v", err)
+		}
+	}
+	return nil
+}
+
+// DeleteTag 删除标签目录，清单修订保留
+func (s *DistributionStorage) DeleteTag(repository, tag string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tagDir := s.path("repositories", repository, "_manifests", "tags", filepath.Base(tag))
+	if _, err := os.Stat(tagDir); err != nil {
+		return fmt.Errorf("failed to remove tag: %v", err)
+	}
+	if err := os.RemoveAll(tagDir); err != nil {
+		return fmt.Errorf("failed to remove tag: %v", err)
+	}
+	return nil
+}
+
+// ListManifests 列出仓库 _manifests/revisions 下链接的清单
+func (s *DistributionStorage) ListManifests(repository string) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	digests, err := listLinkDigests(s.path("repositories", repository, "_manifests", "revisions"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest revisions: %v", err)
+	}
+	return digests, nil
+}
+
+// DeleteManifest 删除清单，通过标签删除时同时删除标签
+func (s *DistributionStorage) DeleteManifest(repository, reference string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	manifests := s.path("repositories", repository, "_manifests")
+	digest := reference
+	if !strings.Contains(reference, ":") {
+		tagDir := filepath.Join(manifests, "tags", reference)
+		var err error
+		if digest, err = readLink(filepath.Join(tagDir, "current", "link")); err != nil {
+			return fmt.Errorf("failed to read tag link: %v", err)
+		}
+		if err := os.RemoveAll(tagDir); err != nil {
+			return fmt.Errorf("failed to remove tag: %v", err)
+		}
+	}
+
+	alg, hex, err := splitDigest(digest)
+	if err != nil {
+		return err
+	}
+	revision := filepath.Join(manifests, "revisions", alg, hex)
+	if _, err := os.Stat(revision); err != nil {
+		return fmt.Errorf("failed to remove manifest: %v", err)
+	}
+	if err := os.RemoveAll(revision); err != nil {
+		return fmt.Errorf("failed to remove manifest: %v", err)
+	}
+	return nil
+}
+
+// GetBlobSize 获取 blob 大小
+func (s *DistributionStorage) GetBlobSize(repository, digest string) (int64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	dataPath, err := s.layerDataPath(repository, digest)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(dataPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat blob file: %v", err)
+	}
+	return info.Size(), nil
+}
+
+// BlobModTime 返回 blob 链接到仓库的时间，上传和挂载都会重写链接
+func (s *DistributionStorage) BlobModTime(repository, digest string) (time.Time, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	alg, hex, err := splitDigest(digest)
+	if err != nil {
+		return time.Time{}, err
+	}
+	info, err := os.Stat(s.path("repositories", repository, "_layers", alg, hex, "link"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to stat blob link: %v", err)
+	}
+	return info.ModTime(), nil
+}
+
+// GetBlob 获取 blob
+func (s *DistributionStorage) GetBlob(repository, digest string) (io.ReadCloser, int64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	dataPath, err := s.layerDataPath(repository, digest)
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := os.Open(dataPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open blob file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to stat blob file: %v", err)
+	}
+	return file, info.Size(), nil
+}
+
+// PutBlob 流式写入 blob，先写入临时文件，读取完成后再移动到 blobs 目录并链接到仓库
+func (s *DistributionStorage) PutBlob(repository, digest string, r io.Reader) (int64, error) {
+	alg, hex, err := splitDigest(digest)
+	if err != nil {
+		return 0, err
+	}
+	dataPath := s.blobDataPath(alg, hex)
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create blob directory: %v", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(dataPath), ".tmp-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	tmpFile := file.Name()
+	defer os.Remove(tmpFile)
+
+	size, err := io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write blob file: %v", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := os.Rename(tmpFile, dataPath); err != nil {
+		return 0, fmt.Errorf("failed to rename blob file: %v", err)
+	}
+	if err := s.linkLayer(repository, alg, hex); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// DeleteBlob 从仓库中删除 blob 的链接，blob 内容可能被其他仓库引用，由垃圾回收清理
+func (s *DistributionStorage) DeleteBlob(repository, digest string) error {
+	alg, hex, err := splitDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	layer := s.path("repositories", repository, "_layers", alg, hex)
+	if _, err := os.Stat(layer); err != nil {
+		return fmt.Errorf("failed to remove blob link: %v", err)
+	}
+	if err := os.RemoveAll(layer); err != nil {
+		return fmt.Errorf("failed to remove blob link: %v", err)
+	}
+	return nil
+}
+
+// ListBlobs 列出仓库 _layers 下链接的 blob
+func (s *DistributionStorage) ListBlobs(repository string) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	digests, err := listLinkDigests(s.path("repositories", repository, "_layers"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layer links: %v", err)
+	}
+	return digests, nil
+}
+
+// PruneBlobs 删除没有被任何仓库的 _layers 或清单修订链接的 blob 数据
+func (s *DistributionStorage) PruneBlobs(dryRun bool) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// 标记：收集所有仓库中的链接
+	referenced := make(map[string]bool)
+	err := filepath.WalkDir(s.path("repositories"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == "_uploads" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || d.Name() != "link" {
+			return nil
+		}
+		if digest, err := readLink(p); err == nil {
+			referenced[digest] = true
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to walk repositories directory: %v", err)
+	}
+
+	// 清除：blobs/<alg>/<hex[:2]>/<hex>
+	var pruned []string
+	algs, err := os.ReadDir(s.path("blobs"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read blobs directory: %v", err)
+	}
+	for _, alg := range algs {
+		prefixes, err := os.ReadDir(s.path("blobs", alg.Name()))
+		if err != nil {
+			continue
+		}
+		for _, prefix := range prefixes {
+			hexes, err := os.ReadDir(s.path("blobs", alg.Name(), prefix.Name()))
+			if err != nil {
+				continue
+			}
+			for _, hex := range hexes {
+				digest := alg.Name() + ":" + hex.Name()
+				if referenced[digest] || !digestPattern.MatchString(digest) {
+					continue
+				}
+				pruned = append(pruned, digest)
+				if dryRun {
+					continue
+				}
+				if err := os.RemoveAll(s.path("blobs", alg.Name(), prefix.Name(), hex.Name())); err != nil {
+					return pruned, fmt.Errorf("failed to remove blob data: %v", err)
+				}
+			}
+		}
+	}
+	return pruned, nil
+}
+
+// MountBlob 在 repository 中创建指向同一 blob 的链接
+func (s *DistributionStorage) MountBlob(repository, from, digest string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dataPath, err := s.layerDataPath(from, digest)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dataPath); err != nil {
+		return fmt.Errorf("failed to stat blob: %v", err)
+	}
+	alg, hex, _ := splitDigest(digest)
+	return s.linkLayer(repository, alg, hex)
+}
+
+// InitiateUpload 初始化上传
+func (s *DistributionStorage) InitiateUpload(repository, uploadID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	uploadDir := s.uploadDir(repository, uploadID)
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(uploadDir, "data"), nil, 0644); err != nil {
+		return fmt.Errorf("failed to create upload file: %v", err)
+	}
+	startedAt := time.Now().UTC().Format(time.RFC3339)
+	if err := os.WriteFile(filepath.Join(uploadDir, "startedat"), []byte(startedAt), 0644); err != nil {
+		return fmt.Errorf("failed to write upload start time: %v", err)
+	}
+	return nil
+}
+
+// AppendToUpload 追加数据到上传，流式写入时不持有锁
+func (s *DistributionStorage) AppendToUpload(repository, uploadID string, r io.Reader) (int64, error) {
+	return appendToFile(filepath.Join(s.uploadDir(repository, uploadID), "data"), r)
+}
+
+// GetUploadSize 返回上传已接收的字节数
+func (s *DistributionStorage) GetUploadSize(repository, uploadID string) (int64, error) {
+	info, err := os.Stat(filepath.Join(s.uploadDir(repository, uploadID), "data"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat upload file: %v", err)
+	}
+	return info.Size(), nil
+}
+
+// ReadUpload 返回上传已接收的数据
+func (s *DistributionStorage) ReadUpload(repository, uploadID string) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(s.uploadDir(repository, uploadID), "data"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %v", err)
+	}
+	return file, nil
+}
+
+// CompleteUpload 完成上传，移动到 blobs 目录并链接到仓库
+func (s *DistributionStorage) CompleteUpload(repository, uploadID, digest string, r io.Reader) error {
+	alg, hex, err := splitDigest(digest)
+	if err != nil {
+		return err
+	}
+	uploadDir := s.uploadDir(repository, uploadID)
+	uploadFile := filepath.Join(uploadDir, "data")
+	if _, err := appendToFile(uploadFile, r); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dataPath := s.blobDataPath(alg, hex)
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %v", err)
+	}
+	if err := os.Rename(uploadFile, dataPath); err != nil {
+		return fmt.Errorf("failed to move upload file: %v", err)
+	}
+	if err := s.linkLayer(repository, alg, hex); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(uploadDir); err != nil {
+		return fmt.Errorf("failed to remove upload directory: %v", err)
+	}
+	return nil
+}
+
+// CancelUpload 取消上传，删除上传目录
+func (s *DistributionStorage) CancelUpload(repository, uploadID string) error {
+	uploadDir := s.uploadDir(repository, uploadID)
+	if _, err := os.Stat(uploadDir); err != nil {
+		return fmt.Errorf("upload not found: %v", err)
+	}
+	if err := os.RemoveAll(uploadDir); err != nil {
+		return fmt.Errorf("failed to remove upload directory: %v", err)
+	}
+	return nil
+}
+
+// PurgeUploads 删除 data 修改时间早于 before 的上传目录
+func (s *DistributionStorage) PurgeUploads(before time.Time) (int, error) {
+	purged := 0
+	err := filepath.Walk(s.path("repositories"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() || filepath.Base(filepath.Dir(path)) != "_uploads" {
+			return nil
+		}
+		// 没有 data 文件的目录是中断的初始化，按目录的修改时间判断
+		modTime := info.ModTime()
+		if data, err := os.Stat(filepath.Join(path, "data")); err == nil {
+			modTime = data.ModTime()
+		}
+		if modTime.Before(before) {
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+			purged++
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return purged, fmt.Errorf("failed to purge uploads: %v", err)
+	}
+	return purged, nil
+}
+
+// path 返回 docker/registry/v2 下的路径
+func (s *DistributionStorage) path(elem ...string) string {
+	return filepath.Join(append([]string{s.rootDir, "docker", "registry", "v2"}, elem...)...)
+}
+
+func (s *DistributionStorage) blobDataPath(alg, hex string) string {
+	return s.path("blobs", alg, hex[:2], hex, "data")
+}
+
+func (s *DistributionStorage) uploadDir(repository, uploadID string) string {
+	return s.path("repositories", repository, "_uploads", filepath.Base(uploadID))
+}
+
+// layerDataPath 检查仓库是否引用了 blob，返回 blob 内容的路径，调用方需持有读锁
+func (s *DistributionStorage) layerDataPath(repository, digest string) (string, error) {
+	alg, hex, err := splitDigest(digest)
+	if err != nil {
+		return "", err
+	}
+	if _, err := readLink(s.path("repositories", repository, "_layers", alg, hex, "link")); err != nil {
+		return "", fmt.Errorf("failed to read blob link: %v", err)
+	}
+	return s.blobDataPath(alg, hex), nil
+}
+
+// linkLayer 把 blob 链接到仓库，调用方需持有写锁
+func (s *DistributionStorage) linkLayer(repository, alg, hex string) error {
+	if err := writeLink(s.path("repositories", repository, "_layers", alg, hex, "link"), alg+":"+hex); err != nil {
+		return fmt.Errorf("failed to write blob link: %v", err)
+	}
+	return nil
+}
+
+// splitDigest 校验摘要并拆分为算法和十六进制部分
+func splitDigest(digest string) (string, string, error) {
+	m := digestPattern.FindStringSubmatch(digest)
+	if m == nil {
+		return "", "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return m[1], m[2], nil
+}
+
+// listLinkDigests 列出 <dir>/<alg>/<hex>/link 形式的链接指向的摘要
+func listLinkDigests(dir string) ([]string, error) {
+	algs, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	digests := []string{}
+	for _, alg := range algs {
+		hexes, err := os.ReadDir(filepath.Join(dir, alg.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, hex := range hexes {
+			if digest, err := readLink(filepath.Join(dir, alg.Name(), hex.Name(), "link")); err == nil {
+				digests = append(digests, digest)
+			}
+		}
+	}
+	return digests, nil
+}
+
+// readLink 读取链接文件中的摘要
+func readLink(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	digest := strings.TrimSpace(string(data))
+	if !digestPattern.MatchString(digest) {
+		return "", fmt.Errorf("invalid link %s", path)
+	}
+	return digest, nil
+}
+
+func writeLink(path, digest string) error {
+	return writeFileAtomic(path, []byte(digest))
+}
+
+// writeFileAtomic 先写入临时文件并 fsync，再重命名并 fsync 目录，
+// 读取方不会看到写了一半的内容，崩溃后文件要么是旧内容要么是新内容
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return renameSync(file.Name(), path)
+}
+
+// appendToFile 把 r 的内容追加到上传文件，返回文件的总大小
+func appendToFile(path string, r io.Reader) (int64, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("upload not found: %v", err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open upload file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, r); err != nil {
+		return 0, fmt.Errorf("failed to write to upload file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat upload file: %v", err)
+	}
+	return info.Size(), nil
+}
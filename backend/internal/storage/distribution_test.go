@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDistributionStorage(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewDistributionStorage(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2 := filepath.Join(root, "docker", "registry", "v2")
+	digestOf := func(data string) (string, string) {
+		hex := fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+		return "sha256:" + hex, hex
+	}
+
+	manifestDigest, manifestHex := digestOf("manifest")
+	if err := s.PutManifest("library/app", "v1", manifestDigest, []byte("manifest")); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{
+		"blobs/sha256/" + manifestHex[:2] + "/" + manifestHex + "/data",
+		"repositories/library/app/_manifests/revisions/sha256/" + manifestHex + "/link",
+		"repositories/library/app/_manifests/tags/v1/current/link",
+		"repositories/library/app/_manifests/tags/v1/index/sha256/" + manifestHex + "/link",
+	} {
+		if _, err := os.Stat(filepath.Join(v2, p)); err != nil {
+			t.Fatalf("expected %s: %v", p, err)
+		}
+	}
+	if data, digest, err := s.GetManifest("library/app", "v1"); err != nil || string(data) != "manifest" || digest != manifestDigest {
+		t.Fatalf("unexpected manifest %q %q %v", data, digest, err)
+	}
+
+	layerDigest, layerHex := digestOf("layer")
+	if err := s.InitiateUpload("library/app", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AppendToUpload("library/app", "u1", strings.NewReader("la")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompleteUpload("library/app", "u1", layerDigest, strings.NewReader("yer")); err != nil {
+		t.Fatal(err)
+	}
+	if link, _ := os.ReadFile(filepath.Join(v2, "repositories/library/app/_layers/sha256", layerHex, "link")); string(link) != layerDigest {
+		t.Fatalf("unexpected layer link %q", link)
+	}
+	reader, size, err := s.GetBlob("library/app", layerDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "layer" || size != 5 {
+		t.Fatalf("unexpected blob %q", data)
+	}
+
+	// 其他仓库没有链接时不能读取
+	if _, err := s.GetBlobSize("other", layerDigest); err == nil {
+		t.Fatal("expected unlinked blob to be missing")
+	}
+	if _, _, err := s.GetBlob("library/app", "sha256:../../../etc"); err == nil || !strings.Contains(err.Error(), "invalid digest") {
+		t.Fatalf("expected invalid digest error, got %v", err)
+	}
+
+	if repos, err := s.ListRepositories(); err != nil || len(repos) != 1 || repos[0] != "library/app" {
+		t.Fatalf("unexpected repositories %v %v", repos, err)
+	}
+	if err := s.DeleteManifest("library/app", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := s.ListTags("library/app"); len(tags) != 0 {
+		t.Fatalf("expected tag to be removed, got %v", tags)
+	}
+
+	// 过期的上传目录被清理，未过期的保留
+	if err := s.InitiateUpload("library/app", "stale"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InitiateUpload("library/app", "fresh"); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(s.uploadDir("library/app", "stale"), "data"), old, old)
+	if purged, err := s.PurgeUploads(time.Now().Add(-time.Hour)); err != nil || purged != 1 {
+		t.Fatalf("unexpected purge result %d %v", purged, err)
+	}
+	if _, err := s.GetUploadSize("library/app", "stale"); err == nil {
+		t.Fatal("expected stale upload to be purged")
+	}
+	if err := s.CancelUpload("library/app", "fresh"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUploadSize("library/app", "fresh"); err == nil {
+		t.Fatal("expected cancelled upload to be removed")
+	}
+}
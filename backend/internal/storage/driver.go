@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Parameters 存储驱动的参数，键名与 distribution 的配置保持一致，例如 rootdirectory、bucket
+type Parameters map[string]string
+
+// String 返回参数，不存在时返回 def
+func (p Parameters) String(key, def string) string {
+	if value, ok := p[key]; ok && value != "" {
+		return value
+	}
+	return def
+}
+
+// Int64 返回整数参数，不存在时返回 def
+func (p Parameters) Int64(key string, def int64) (int64, error) {
+	value, ok := p[key]
+	if !ok || value == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %v", key, value, err)
+	}
+	return n, nil
+}
+
+// Bool 返回布尔参数，不存在时返回 def
+func (p Parameters) Bool(key string, def bool) (bool, error) {
+	value, ok := p[key]
+	if !ok || value == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %v", key, value, err)
+	}
+	return b, nil
+}
+
+// Factory 按参数创建存储
+type Factory func(params Parameters) (Storage, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Factory)
+)
+
+// Register 注册存储驱动，名称重复时 panic
+func Register(name string, factory Factory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if _, ok := drivers[name]; ok {
+		panic(fmt.Sprintf("storage driver %s registered twice", name))
+	}
+	drivers[name] = factory
+}
+
+// Drivers 返回已注册的驱动名称
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New 使用已注册的驱动创建存储
+func New(name string, params Parameters) (Storage, error) {
+	driversMu.RLock()
+	factory, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage driver %q", name)
+	}
+	return factory(params)
+}
+
+// DriverConfig 存储配置文件的内容，例如：
+//
+//	driver: gcs
+//	parameters:
+//	  bucket: registry
+//	  credentials: /etc/registry/gcs.json
+type DriverConfig struct {
+	Driver     string     `yaml:"driver"`
+	Parameters Parameters `yaml:"parameters"`
+}
+
+// LoadDriverConfig 读取存储配置文件
+func LoadDriverConfig(path string) (DriverConfig, error) {
+	var config DriverConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read storage config: %v", err)
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse storage config: %v", err)
+	}
+	if config.Driver == "" {
+		return config, fmt.Errorf("storage config %s has no driver", path)
+	}
+	return config, nil
+}
+
+func init() {
+	Register("memory", func(Parameters) (Storage, error) {
+		return NewMemoryStorage(), nil
+	})
+	Register("file", func(params Parameters) (Storage, error) {
+		rootDir := params.String("rootdirectory", "")
+		if rootDir == "" {
+			return nil, fmt.Errorf("rootdirectory is required for file storage")
+		}
+		return NewFileStorage(rootDir)
+	})
+	Register("distribution", func(params Parameters) (Storage, error) {
+		rootDir := params.String("rootdirectory", "")
+		if rootDir == "" {
+			return nil, fmt.Errorf("rootdirectory is required for distribution storage")
+		}
+		return NewDistributionStorage(rootDir)
+	})
+	Register("s3", func(params Parameters) (Storage, error) {
+		pathStyle, err := params.Bool("pathstyle", false)
+		if err != nil {
+			return nil, err
+		}
+		partSize, err := params.Int64("partsize", 0)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Storage(S3Config{
+			Endpoint:  params.String("endpoint", "https://s3.amazonaws.com"),
+			Region:    params.String("region", ""),
+			Bucket:    params.String("bucket", ""),
+			AccessKey: params.String("accesskey", os.Getenv("AWS_ACCESS_KEY_ID")),
+			SecretKey: params.String("secretkey", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+			Prefix:    params.String("prefix", ""),
+			PathStyle: pathStyle,
+			PartSize:  partSize,
+		})
+	})
+	Register("gcs", func(params Parameters) (Storage, error) {
+		chunkSize, err := params.Int64("chunksize", 0)
+		if err != nil {
+			return nil, err
+		}
+		return NewGCSStorage(GCSConfig{
+			Bucket:      params.String("bucket", ""),
+			Prefix:      params.String("prefix", ""),
+			Credentials: params.String("credentials", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")),
+			Endpoint:    params.String("endpoint", ""),
+			ChunkSize:   chunkSize,
+		})
+	})
+	Register("azure", func(params Parameters) (Storage, error) {
+		blockSize, err := params.Int64("blocksize", 0)
+		if err != nil {
+			return nil, err
+		}
+		return NewAzureStorage(AzureConfig{
+			AccountName: params.String("accountname", os.Getenv("AZURE_STORAGE_ACCOUNT")),
+			AccountKey:  params.String("accountkey", os.Getenv("AZURE_STORAGE_KEY")),
+			Container:   params.String("container", ""),
+			Prefix:      params.String("prefix", ""),
+			Endpoint:    params.String("endpoint", ""),
+			BlockSize:   blockSize,
+		})
+	})
+}
@@ -1,19 +1,28 @@
 package storage
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
-	"sync"
+	"time"
 )
 
+// sha256DigestPattern 写入 blob 时可以校验的摘要格式
+var sha256DigestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
 // FileStorage 实现基于文件系统的存储
+// 标签和清单按仓库加锁；blob 以摘要命名，写入临时文件后重命名，按摘要读取 blob 不需要加锁
 type FileStorage struct {
 	rootDir string
-	mutex   sync.RWMutex
+	locks   repositoryLocks
 }
 
 // NewFileStorage 创建新的文件存储
@@ -43,31 +52,58 @@ func (s *FileStorage) RootDir() string {
 	return s.rootDir
 }
 
-// ListRepositories 列出所有仓库
+// ListRepositories 递归列出所有仓库，返回 user/app 形式的完整路径
+// 包含 _manifests 或 _blobs 目录的目录即为仓库，仓库下仍可能有嵌套的仓库
 func (s *FileStorage) ListRepositories() ([]string, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	repositoriesDir := filepath.Join(s.rootDir, "repositories")
-	entries, err := os.ReadDir(repositoriesDir)
+	root := filepath.Join(s.rootDir, "repositories")
+	repositories := []string{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || p == root {
+			return nil
+		}
+		// 跳过仓库内部的目录，仓库的 tags 目录本身也是名为 tags 的子仓库时继续遍历
+		if strings.HasPrefix(d.Name(), "_") {
+			return filepath.SkipDir
+		}
+		isRepository := isFileRepository(p)
+		if d.Name() == "tags" && !isRepository && isFileRepository(filepath.Dir(p)) {
+			return filepath.SkipDir
+		}
+		if isRepository {
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			repositories = append(repositories, filepath.ToSlash(rel))
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to read repositories directory: %v", err)
 	}
 
-	var repositories []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			repositories = append(repositories, entry.Name())
+	sort.Strings(repositories)
+	return repositories, nil
+}
+
+// isFileRepository 判断目录是否包含仓库数据
+func isFileRepository(dir string) bool {
+	for _, name := range []string{"_manifests", "_blobs"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.IsDir() {
+			return true
 		}
 	}
-
-	return repositories, nil
+	return false
 }
 
 // ListTags 列出仓库的所有标签
 func (s *FileStorage) ListTags(repository string) ([]string, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	lock := s.locks.get(repository)
+	lock.RLock()
+	defer lock.RUnlock()
 
 	tagsDir := filepath.Join(s.rootDir, "repositories", repository, "tags")
 	if _, err := os.Stat(tagsDir); os.IsNotExist(err) {
@@ -91,12 +127,13 @@ func (s *FileStorage) ListTags(repository string) ([]string, error) {
 
 // GetManifest 获取清单
 func (s *FileStorage) GetManifest(repository, reference string) ([]byte, string, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	lock := s.locks.get(repository)
+	lock.RLock()
+	defer lock.RUnlock()
 
 	// 首先检查是否是 digest
 	if strings.HasPrefix(reference, "sha256:") {
-		return s.GetManifestByDigest(repository, reference)
+		return s.getManifestByDigest(repository, reference)
 	}
 
 	// 如果是 tag，首先找到对应的 digest
@@ -107,14 +144,21 @@ func (s *FileStorage) GetManifest(repository, reference string) ([]byte, string,
 	}
 
 	digest := string(data)
-	return s.GetManifestByDigest(repository, digest)
+	return s.getManifestByDigest(repository, digest)
 }
 
 // GetManifestByDigest 通过摘要获取清单
 func (s *FileStorage) GetManifestByDigest(repository, digest string) ([]byte, string, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	lock := s.locks.get(repository)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return s.getManifestByDigest(repository, digest)
+}
 
+// getManifestByDigest 读取清单文件，调用方需持有仓库的读锁
+// 不能在持有读锁时再次调用 GetManifestByDigest，写锁等待期间重复加读锁会死锁
+func (s *FileStorage) getManifestByDigest(repository, digest string) ([]byte, string, error) {
 	manifestFile := filepath.Join(s.rootDir, "repositories", repository, "_manifests", digest)
 	data, err := os.ReadFile(manifestFile)
 	if err != nil {
@@ -124,38 +168,56 @@ func (s *FileStorage) GetManifestByDigest(repository, digest string) ([]byte, st
 	return data, digest, nil
 }
 
+// ManifestModTime 返回标签文件或清单文件的修改时间
+func (s *FileStorage) ManifestModTime(repository, reference string) (time.Time, error) {
+	lock := s.locks.get(repository)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	path := filepath.Join(s.rootDir, "repositories", repository, "tags", reference)
+	if strings.HasPrefix(reference, "sha256:") {
+		path = filepath.Join(s.rootDir, "repositories", repository, "_manifests", reference)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to stat manifest: %v", err)
+	}
+	return info.ModTime(), nil
+}
+
 // PutManifest 存储清单
 func (s *FileStorage) PutManifest(repository, reference, digest string, manifest []byte) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	lock := s.locks.get(repository)
+	lock.Lock()
+	defer lock.Unlock()
 
 	// 确保仓库目录存在
 	repoDir := filepath.Join(s.rootDir, "repositories", repository)
-	if err := os.MkdirAll(repoDir, 0755); err != nil {
+	if err := mkdirAllSync(repoDir); err != nil {
 		return fmt.Errorf("failed to create repository directory: %v", err)
 	}
 
 	// 确保清单目录存在
 	manifestsDir := filepath.Join(repoDir, "_manifests")
-	if err := os.MkdirAll(manifestsDir, 0755); err != nil {
+	if err := mkdirAllSync(manifestsDir); err != nil {
 		return fmt.Errorf("failed to create manifests directory: %v", err)
 	}
 
-	// 写入清单文件
+	// 写入清单文件，标签在清单持久化之后才更新，崩溃后标签不会指向不存在的清单
 	manifestFile := filepath.Join(manifestsDir, digest)
-	if err := os.WriteFile(manifestFile, manifest, 0644); err != nil {
+	if err := writeFileAtomic(manifestFile, manifest); err != nil {
 		return fmt.Errorf("failed to write manifest file: %v", err)
 	}
 
 	// 如果提供了标签引用，更新标签
 	if reference != "" && !strings.HasPrefix(reference, "sha256:") {
 		tagsDir := filepath.Join(repoDir, "tags")
-		if err := os.MkdirAll(tagsDir, 0755); err != nil {
+		if err := mkdirAllSync(tagsDir); err != nil {
 			return fmt.Errorf("failed to create tags directory: %v", err)
 		}
 
 		tagFile := filepath.Join(tagsDir, reference)
-		if err := os.WriteFile(tagFile, []byte(digest), 0644); err != nil {
+		if err := writeFileAtomic(tagFile, []byte(digest)); err != nil {
 			return fmt.Errorf("failed to write tag file: %v", err)
 		}
 	}
@@ -163,10 +225,24 @@ func (s *FileStorage) PutManifest(repository, reference, digest string, manifest
 	return nil
 }
 
+// ListManifests 列出仓库中所有清单的摘要
+func (s *FileStorage) ListManifests(repository string) ([]string, error) {
+	lock := s.locks.get(repository)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	digests, err := listDigestFiles(filepath.Join(s.rootDir, "repositories", repository, "_manifests"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifests directory: %v", err)
+	}
+	return digests, nil
+}
+
 // DeleteManifest 删除清单
 func (s *FileStorage) DeleteManifest(repository, reference string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	lock := s.locks.get(repository)
+	lock.Lock()
+	defer lock.Unlock()
 
 	// 如果是摘要，直接删除清单
 	if strings.HasPrefix(reference, "sha256:") {
@@ -200,11 +276,20 @@ func (s *FileStorage) DeleteManifest(repository, reference string) error {
 	return nil
 }
 
+// DeleteTag 删除标签文件
+func (s *FileStorage) DeleteTag(repository, tag string) error {
+	lock := s.locks.get(repository)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := os.Remove(filepath.Join(s.rootDir, "repositories", repository, "tags", filepath.Base(tag))); err != nil {
+		return fmt.Errorf("failed to remove tag file: %v", err)
+	}
+	return nil
+}
+
 // GetBlobSize 获取 blob 大小
 func (s *FileStorage) GetBlobSize(repository, digest string) (int64, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
 	blobFile := filepath.Join(s.rootDir, "repositories", repository, "_blobs", digest)
 	info, err := os.Stat(blobFile)
 	if err != nil {
@@ -216,9 +301,6 @@ func (s *FileStorage) GetBlobSize(repository, digest string) (int64, error) {
 
 // GetBlob 获取 blob
 func (s *FileStorage) GetBlob(repository, digest string) (io.ReadCloser, int64, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
 	blobFile := filepath.Join(s.rootDir, "repositories", repository, "_blobs", digest)
 	file, err := os.Open(blobFile)
 	if err != nil {
@@ -234,11 +316,44 @@ func (s *FileStorage) GetBlob(repository, digest string) (io.ReadCloser, int64,
 	return file, info.Size(), nil
 }
 
+// PutBlob 流式写入 blob
+// 先写入临时文件，读取完成并校验摘要后再重命名，读取失败或摘要不一致时不会留下不完整的 blob
+func (s *FileStorage) PutBlob(repository, digest string, r io.Reader) (int64, error) {
+	blobsDir := filepath.Join(s.rootDir, "repositories", repository, "_blobs")
+	if err := mkdirAllSync(blobsDir); err != nil {
+		return 0, fmt.Errorf("failed to create blobs directory: %v", err)
+	}
+
+	file, err := os.CreateTemp(blobsDir, ".tmp-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	tmpFile := file.Name()
+	defer os.Remove(tmpFile)
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hasher), r)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write blob file: %v", err)
+	}
+	if err := verifyDigest(digest, hasher); err != nil {
+		return 0, err
+	}
+
+	if err := renameSync(tmpFile, filepath.Join(blobsDir, digest)); err != nil {
+		return 0, fmt.Errorf("failed to rename blob file: %v", err)
+	}
+	return size, nil
+}
+
 // DeleteBlob 删除 blob
 func (s *FileStorage) DeleteBlob(repository, digest string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
 	blobFile := filepath.Join(s.rootDir, "repositories", repository, "_blobs", digest)
 	if err := os.Remove(blobFile); err != nil {
 		return fmt.Errorf("failed to remove blob file: %v", err)
@@ -247,14 +362,78 @@ func (s *FileStorage) DeleteBlob(repository, digest string) error {
 	return nil
 }
 
+// MountBlob 把 from 仓库中的 blob 关联到 repository，优先使用硬链接，不支持时复制文件
+func (s *FileStorage) MountBlob(repository, from, digest string) error {
+	lock := s.locks.get(repository)
+	lock.Lock()
+	defer lock.Unlock()
+
+	source := filepath.Join(s.rootDir, "repositories", from, "_blobs", filepath.Base(digest))
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("failed to stat blob file: %v", err)
+	}
+
+	blobsDir := filepath.Join(s.rootDir, "repositories", repository, "_blobs")
+	if err := mkdirAllSync(blobsDir); err != nil {
+		return fmt.Errorf("failed to create blobs directory: %v", err)
+	}
+	// 硬链接与源文件共享修改时间，更新为挂载的时间，垃圾回收据此判断 blob 是否刚写入
+	target := filepath.Join(blobsDir, filepath.Base(digest))
+	now := time.Now()
+	if _, err := os.Stat(target); err == nil {
+		return os.Chtimes(target, now, now)
+	}
+	if err := os.Link(source, target); err != nil {
+		return copyFile(source, target)
+	}
+	if err := os.Chtimes(target, now, now); err != nil {
+		return err
+	}
+	return syncDir(blobsDir)
+}
+
+// BlobModTime 返回 blob 文件的修改时间
+func (s *FileStorage) BlobModTime(repository, digest string) (time.Time, error) {
+	info, err := os.Stat(filepath.Join(s.rootDir, "repositories", repository, "_blobs", filepath.Base(digest)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to stat blob file: %v", err)
+	}
+	return info.ModTime(), nil
+}
+
+// ListBlobs 列出仓库中所有 blob 的摘要
+func (s *FileStorage) ListBlobs(repository string) ([]string, error) {
+	digests, err := listDigestFiles(filepath.Join(s.rootDir, "repositories", repository, "_blobs"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blobs directory: %v", err)
+	}
+	return digests, nil
+}
+
+// listDigestFiles 列出目录中以摘要命名的文件，跳过写入中的临时文件
+func listDigestFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	digests := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && digestPattern.MatchString(entry.Name()) {
+			digests = append(digests, entry.Name())
+		}
+	}
+	return digests, nil
+}
+
 // InitiateUpload 初始化上传
 func (s *FileStorage) InitiateUpload(repository, uploadID string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
 	// 确保仓库目录存在
 	repoDir := filepath.Join(s.rootDir, "repositories", repository)
-	if err := os.MkdirAll(repoDir, 0755); err != nil {
+	if err := mkdirAllSync(repoDir); err != nil {
 		return fmt.Errorf("failed to create repository directory: %v", err)
 	}
 
@@ -276,73 +455,207 @@ func (s *FileStorage) InitiateUpload(repository, uploadID string) error {
 }
 
 // AppendToUpload 追加数据到上传
-func (s *FileStorage) AppendToUpload(repository, uploadID string, data []byte) (int64, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// 上传文件只属于一个上传，流式写入时不持有锁，避免慢速客户端阻塞其他请求
+func (s *FileStorage) AppendToUpload(repository, uploadID string, r io.Reader) (int64, error) {
+	return appendToFile(s.uploadFile(repository, uploadID), r)
+}
 
-	uploadFile := filepath.Join(s.rootDir, "uploads", repository, uploadID)
-	file, err := os.OpenFile(uploadFile, os.O_WRONLY|os.O_APPEND, 0644)
+// GetUploadSize 返回上传已接收的字节数
+func (s *FileStorage) GetUploadSize(repository, uploadID string) (int64, error) {
+	info, err := os.Stat(s.uploadFile(repository, uploadID))
 	if err != nil {
-		return 0, fmt.Errorf("failed to open upload file: %v", err)
-	}
-	defer file.Close()
-
-	if _, err := file.Write(data); err != nil {
-		return 0, fmt.Errorf("failed to write to upload file: %v", err)
+		return 0, fmt.Errorf("failed to stat upload file: %v", err)
 	}
+	return info.Size(), nil
+}
 
-	// 获取文件大小
-	info, err := file.Stat()
+// ReadUpload 返回上传已接收的数据
+func (s *FileStorage) ReadUpload(repository, uploadID string) (io.ReadCloser, error) {
+	file, err := os.Open(s.uploadFile(repository, uploadID))
 	if err != nil {
-		return 0, fmt.Errorf("failed to stat upload file: %v", err)
+		return nil, fmt.Errorf("failed to open upload file: %v", err)
 	}
-
-	return info.Size(), nil
+	return file, nil
 }
 
-// CompleteUpload 完成上传
-func (s *FileStorage) CompleteUpload(repository, uploadID, digest string, data []byte) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// CompleteUpload 完成上传，摘要由调用方校验，这里只持久化上传文件并移动到 blob 的位置
+func (s *FileStorage) CompleteUpload(repository, uploadID, digest string, r io.Reader) error {
+	if !sha256DigestPattern.MatchString(digest) {
+		return fmt.Errorf("unsupported digest %s", digest)
+	}
+
+	// 处理最后的数据片段
+	uploadFile := s.uploadFile(repository, uploadID)
+	if _, err := appendToFile(uploadFile, r); err != nil {
+		return err
+	}
 
 	// 确保仓库的blob目录存在
 	blobsDir := filepath.Join(s.rootDir, "repositories", repository, "_blobs")
-	if err := os.MkdirAll(blobsDir, 0755); err != nil {
+	if err := mkdirAllSync(blobsDir); err != nil {
 		return fmt.Errorf("failed to create blobs directory: %v", err)
 	}
 
-	// 处理最后的数据片段
-	uploadFile := filepath.Join(s.rootDir, "uploads", repository, uploadID)
-	if len(data) > 0 {
-		file, err := os.OpenFile(uploadFile, os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to open upload file: %v", err)
-		}
-		if _, err := file.Write(data); err != nil {
-			file.Close()
-			return fmt.Errorf("failed to write to upload file: %v", err)
-		}
-		file.Close()
+	if err := syncFile(uploadFile); err != nil {
+		return err
 	}
 
 	// 移动上传文件到blob文件
 	blobFile := filepath.Join(blobsDir, digest)
 	if err := os.Rename(uploadFile, blobFile); err != nil {
 		// 如果无法重命名（可能跨设备），则复制
-		uploadData, err := ioutil.ReadFile(uploadFile)
-		if err != nil {
-			return fmt.Errorf("failed to read upload file: %v", err)
-		}
-
-		if err := ioutil.WriteFile(blobFile, uploadData, 0644); err != nil {
-			return fmt.Errorf("failed to write blob file: %v", err)
+		if err := copyFile(uploadFile, blobFile); err != nil {
+			return err
 		}
 
 		// 删除上传文件
 		if err := os.Remove(uploadFile); err != nil {
 			return fmt.Errorf("failed to remove upload file: %v", err)
 		}
+		return nil
 	}
 
+	// 重命名已经成功，上传文件不再存在，fsync 失败时只能返回错误，不能再回退到复制
+	return syncDir(blobsDir)
+}
+
+// CancelUpload 取消上传，删除上传文件
+func (s *FileStorage) CancelUpload(repository, uploadID string) error {
+	if err := os.Remove(s.uploadFile(repository, uploadID)); err != nil {
+		return fmt.Errorf("failed to remove upload file: %v", err)
+	}
+	return nil
+}
+
+// PurgeUploads 删除修改时间早于 before 的上传文件
+func (s *FileStorage) PurgeUploads(before time.Time) (int, error) {
+	purged := 0
+	err := filepath.Walk(filepath.Join(s.rootDir, "uploads"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() && info.ModTime().Before(before) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			purged++
+		}
+		return nil
+	})
+	if err != nil {
+		return purged, fmt.Errorf("failed to purge uploads: %v", err)
+	}
+	return purged, nil
+}
+
+func (s *FileStorage) uploadFile(repository, uploadID string) string {
+	return filepath.Join(s.rootDir, "uploads", repository, filepath.Base(uploadID))
+}
+
+// copyFile 流式复制文件，先写入目标目录中的临时文件再重命名，
+// 不加锁读取 blob 的请求不会看到复制到一半的文件
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to read upload file: %v", err)
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(dst), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to write blob file: %v", err)
+	}
+	defer os.Remove(out.Name())
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = renameSync(out.Name(), dst)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write blob file: %v", err)
+	}
+	return nil
+}
+
+// renameSync 重命名后 fsync 目标目录，使重命名本身在崩溃后仍然有效
+func renameSync(oldpath, newpath string) error {
+	if err := os.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(newpath))
+}
+
+// mkdirAllSync 与 os.MkdirAll 相同，并 fsync 每个新建目录的父目录，使新建的目录在崩溃后仍然存在，
+// 否则之后写入并 fsync 的文件可能随未持久化的目录一起丢失
+func mkdirAllSync(dir string) error {
+	var created []string
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		created = append(created, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if len(created) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, d := range created {
+		if err := syncDir(filepath.Dir(d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncDir fsync 目录，持久化其中新建、重命名的目录项
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %v", dir, err)
+	}
+	return nil
+}
+
+// verifyDigest 校验 sha256 摘要，不支持其他算法的摘要
+func verifyDigest(digest string, hasher hash.Hash) error {
+	if !sha256DigestPattern.MatchString(digest) {
+		return fmt.Errorf("unsupported digest %s", digest)
+	}
+	if actual := "sha256:" + hex.EncodeToString(hasher.Sum(nil)); actual != digest {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+	}
+	return nil
+}
+
+// syncFile fsync 上传文件，移动到 blob 的位置前确保数据已经落盘
+func syncFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open upload file: %v", err)
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync upload file: %v", err)
+	}
 	return nil
 }
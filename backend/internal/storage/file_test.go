@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStorageListRepositories(t *testing.T) {
+	s, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 多级仓库名，以及嵌套在另一个仓库下的仓库
+	for _, repository := range []string{"app", "user/app", "org/team/service", "org/team/service/sidecar"} {
+		if err := s.PutManifest(repository, "v1", "sha256:abc", []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.PutBlob("blobs/only", fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("layer"))), strings.NewReader("layer")); err != nil {
+		t.Fatal(err)
+	}
+	// 名为 tags 的仓库不会与仓库内部的 tags 目录混淆
+	if err := s.PutManifest("user/tags", "v1", "sha256:abc", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	repositories, err := s.ListRepositories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "app,blobs/only,org/team/service,org/team/service/sidecar,user/app,user/tags"
+	if got := strings.Join(repositories, ","); got != want {
+		t.Fatalf("unexpected repositories\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestFileStorageVerifiesDigests(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewFileStorage(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("layer")))
+
+	// 摘要不一致的 blob 不会被保存
+	if _, err := s.PutBlob("app", digest, strings.NewReader("other")); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Fatalf("Expected digest mismatch, got %v", err)
+	}
+	if _, err := s.GetBlobSize("app", digest); err == nil {
+		t.Fatal("Blob with mismatched digest was stored")
+	}
+
+	// 无法校验的摘要算法直接拒绝
+	if _, err := s.PutBlob("app", "md5:"+strings.Repeat("0", 32), strings.NewReader("layer")); err == nil || !strings.Contains(err.Error(), "unsupported digest") {
+		t.Fatalf("Expected unsupported digest to be rejected, got %v", err)
+	}
+	if err := s.InitiateUpload("app", "upload"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompleteUpload("app", "upload", "md5:"+strings.Repeat("0", 32), strings.NewReader("")); err == nil {
+		t.Fatal("Expected upload with unsupported digest to fail")
+	}
+	if err := s.CancelUpload("app", "upload"); err != nil {
+		t.Fatalf("Expected upload to be kept for cleanup: %v", err)
+	}
+
+	if _, err := s.PutBlob("app", digest, strings.NewReader("layer")); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"v1", "v1"} {
+		if err := s.PutManifest("app", tag, digest, []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, got, err := s.GetManifest("app", "v1"); err != nil || got != digest {
+		t.Fatalf("Unexpected tag %s: %v", got, err)
+	}
+
+	// 原子写入不会留下临时文件
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && strings.HasPrefix(d.Name(), ".tmp-") {
+			t.Errorf("Temporary file left behind: %s", path)
+		}
+		return err
+	})
+}
+
+func TestMkdirAllSync(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "repositories", "library", "app", "_blobs")
+	if err := mkdirAllSync(dir); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("Expected directory to be created: %v", err)
+	}
+	// 目录已存在时不做任何事
+	if err := mkdirAllSync(dir); err != nil {
+		t.Fatal(err)
+	}
+	// 路径中存在同名文件时返回错误
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := mkdirAllSync(filepath.Join(file, "dir")); err == nil {
+		t.Fatal("Expected error when a parent is a file")
+	}
+}
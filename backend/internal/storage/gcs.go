@@ -0,0 +1,389 @@
+package storage
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultGCSEndpoint = "https://storage.googleapis.com"
+	// gcsChunkAlign 断点续传上传的分块必须是 256KiB 的整数倍
+	gcsChunkAlign       = 256 << 10
+	defaultGCSChunkSize = 8 << 20
+	gcsScope            = "https://www.googleapis.com/auth/devstorage.read_write"
+	gcsMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// GCSConfig Google Cloud Storage 的连接配置
+type GCSConfig struct {
+	Bucket string `json:"bucket"`
+	// Prefix 所有对象名称的前缀
+	Prefix string `json:"prefix,omitempty"`
+	// Credentials 服务账号 JSON 密钥文件，为空时从 GCE 元数据服务获取令牌
+	Credentials string `json:"credentials,omitempty"`
+	// Endpoint 服务地址，用于模拟器，设置且没有 Credentials 时不认证
+	Endpoint string `json:"endpoint,omitempty"`
+	// ChunkSize 上传分块大小，向上取整为 256KiB 的整数倍，默认 8MiB
+	ChunkSize int64 `json:"chunkSize,omitempty"`
+}
+
+// NewGCSStorage 创建 GCS 存储，使用 JSON API 和断点续传上传
+func NewGCSStorage(config GCSConfig) (Storage, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("bucket is required for gcs storage")
+	}
+	store := &gcsStore{
+		bucket:    config.Bucket,
+		endpoint:  strings.TrimSuffix(config.Endpoint, "/"),
+		client:    &http.Client{},
+		chunkSize: int(defaultGCSChunkSize),
+	}
+	if config.ChunkSize > 0 {
+		store.chunkSize = int((config.ChunkSize + gcsChunkAlign - 1) / gcsChunkAlign * gcsChunkAlign)
+	}
+
+	switch {
+	case config.Credentials != "":
+		source, err := newServiceAccountTokenSource(store.client, config.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		store.token = source
+	case store.endpoint == "":
+		store.token = &cachedToken{fetch: func() (string, time.Duration, error) {
+			return fetchMetadataToken(store.client)
+		}}
+	}
+	if store.endpoint == "" {
+		store.endpoint = defaultGCSEndpoint
+	}
+	return newObjectStorage(store, config.Prefix), nil
+}
+
+// gcsStore 通过 JSON API 访问 GCS
+type gcsStore struct {
+	bucket    string
+	endpoint  string
+	client    *http.Client
+	token     *cachedToken
+	chunkSize int
+}
+
+func (g *gcsStore) objectURL(key string) string {
+	return g.endpoint + "/storage/v1/b/" + url.PathEscape(g.bucket) + "/o/" + url.PathEscape(key)
+}
+
+func (g *gcsStore) get(key string) (io.ReadCloser, int64, error) {
+	resp, err := g.do(http.MethodGet, g.objectURL(key)+"?alt=media", nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (g *gcsStore) size(key string) (int64, error) {
+	resp, err := g.do(http.MethodGet, g.objectURL(key), nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var object struct {
+		Size string `json:"size"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&object); err != nil {
+		return 0, fmt.Errorf("invalid object metadata: %v", err)
+	}
+	return strconv.ParseInt(object.Size, 10, 64)
+}
+
+func (g *gcsStore) delete(key string) error {
+	resp, err := g.do(http.MethodDelete, g.objectURL(key), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// copy 使用 rewrite 在服务端复制，大对象需要多次调用
+func (g *gcsStore) copy(src, dst string) error {
+	target := g.objectURL(src) + "/rewriteTo/b/" + url.PathEscape(g.bucket) + "/o/" + url.PathEscape(dst)
+	token := ""
+	for {
+		u := target
+		if token != "" {
+			u += "?rewriteToken=" + url.QueryEscape(token)
+		}
+		resp, err := g.do(http.MethodPost, u, nil, nil)
+		if err != nil {
+			return err
+		}
+		var result struct {
+			Done         bool   `json:"done"`
+			RewriteToken string `json:"rewriteToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("invalid rewrite response: %v", err)
+		}
+		if result.Done {
+			return nil
+		}
+		token = result.RewriteToken
+	}
+}
+
+func (g *gcsStore) list(prefix string) ([]string, error) {
+	var keys []string
+	pageToken := ""
+	for {
+		query := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		resp, err := g.do(http.MethodGet, g.endpoint+"/storage/v1/b/"+url.PathEscape(g.bucket)+"/o?"+query.Encode(), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid list response: %v", err)
+		}
+
+		for _, item := range result.Items {
+			keys = append(keys, item.Name)
+		}
+		if result.NextPageToken == "" {
+			return keys, nil
+		}
+		pageToken = result.NextPageToken
+	}
+}
+
+// create 不超过一个分块的对象直接上传，否则使用断点续传上传
+func (g *gcsStore) create(key string) (objectWriter, error) {
+	uploadURL := g.endpoint + "/upload/storage/v1/b/" + url.PathEscape(g.bucket) + "/o?name=" + url.QueryEscape(key)
+	var session string
+	var offset int64
+
+	putChunk := func(chunk []byte, final bool) error {
+		header := http.Header{}
+		end := offset + int64(len(chunk)) - 1
+		switch {
+		case final && len(chunk) == 0:
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", offset))
+		case final:
+			header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, end, end+1))
+		default:
+			header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/*", offset, end))
+		}
+		resp, err := g.do(http.MethodPut, session, header, chunk)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		offset += int64(len(chunk))
+		return nil
+	}
+
+	w := &chunkWriter{chunkSize: g.chunkSize}
+	w.flush = func(chunk []byte) error {
+		if session == "" {
+			header := http.Header{"Content-Type": {"application/json"}}
+			resp, err := g.do(http.MethodPost, uploadURL+"&uploadType=resumable", header, []byte("{}"))
+			if err != nil {
+				return fmt.Errorf("failed to start resumable upload: %v", err)
+			}
+			resp.Body.Close()
+			if session = resp.Header.Get("Location"); session == "" {
+				return errors.New("resumable upload has no session url")
+			}
+		}
+		return putChunk(chunk, false)
+	}
+	w.commit = func(rest []byte) error {
+		if session == "" {
+			resp, err := g.do(http.MethodPost, uploadURL+"&uploadType=media", nil, rest)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			return nil
+		}
+		return putChunk(rest, true)
+	}
+	w.abort = func() {
+		if session != "" {
+			if resp, err := g.do(http.MethodDelete, session, nil, nil); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	return w, nil
+}
+
+// do 发送带访问令牌的请求，断点续传的中间分块返回 308
+func (g *gcsStore) do(method, rawURL string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if g.token != nil {
+		token, err := g.token.get()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get gcs access token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 || resp.StatusCode == http.StatusPermanentRedirect {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, httpStatusError(resp)
+}
+
+// cachedToken 缓存访问令牌，过期前一分钟刷新
+type cachedToken struct {
+	mutex  sync.Mutex
+	fetch  func() (string, time.Duration, error)
+	token  string
+	expiry time.Time
+}
+
+func (c *cachedToken) get() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token != "" && time.Until(c.expiry) > time.Minute {
+		return c.token, nil
+	}
+	token, ttl, err := c.fetch()
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expiry = token, time.Now().Add(ttl)
+	return token, nil
+}
+
+// newServiceAccountTokenSource 使用服务账号密钥签发 JWT 换取访问令牌
+func newServiceAccountTokenSource(client *http.Client, credentialsFile string) (*cachedToken, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gcs credentials: %v", err)
+	}
+	var account struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse gcs credentials: %v", err)
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("gcs credentials have no private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse gcs private key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("gcs private key is not an rsa key")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	return &cachedToken{fetch: func() (string, time.Duration, error) {
+		now := time.Now()
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+		claims, _ := json.Marshal(map[string]any{
+			"iss":   account.ClientEmail,
+			"scope": gcsScope,
+			"aud":   account.TokenURI,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		})
+		signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+		digest := sha256.Sum256([]byte(signingInput))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", 0, err
+		}
+		assertion := signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+		resp, err := client.PostForm(account.TokenURI, url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		})
+		if err != nil {
+			return "", 0, err
+		}
+		defer resp.Body.Close()
+		return decodeAccessToken(resp)
+	}}, nil
+}
+
+// fetchMetadataToken 从 GCE 元数据服务获取默认服务账号的令牌
+func fetchMetadataToken(client *http.Client) (string, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, gcsMetadataTokenURL, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	return decodeAccessToken(resp)
+}
+
+func decodeAccessToken(resp *http.Response) (string, time.Duration, error) {
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, httpStatusError(resp)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", 0, fmt.Errorf("invalid token response: %v", err)
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
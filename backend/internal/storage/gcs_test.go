@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGCS 实现测试用到的 JSON API 子集，列表每页只返回一个对象以覆盖分页
+type fakeGCS struct {
+	mutex    sync.Mutex
+	url      string
+	objects  map[string][]byte
+	sessions map[string][]byte
+	chunks   int
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	query := r.URL.Query()
+	const objects = "/storage/v1/b/bucket/o"
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/session/"):
+		id := strings.TrimPrefix(r.URL.Path, "/session/")
+		f.sessions[id] = append(f.sessions[id], body...)
+		f.chunks++
+		if strings.HasSuffix(r.Header.Get("Content-Range"), "/*") {
+			w.WriteHeader(http.StatusPermanentRedirect)
+			return
+		}
+		f.objects[id] = f.sessions[id]
+	case r.URL.Path == "/upload"+objects && query.Get("uploadType") == "resumable":
+		name := query.Get("name")
+		f.sessions[name] = nil
+		w.Header().Set("Location", f.url+"/session/"+name)
+	case r.URL.Path == "/upload"+objects && query.Get("uploadType") == "media":
+		f.objects[query.Get("name")] = body
+	case r.URL.Path == objects:
+		var names []string
+		for name := range f.objects {
+			if strings.HasPrefix(name, query.Get("prefix")) && name > query.Get("pageToken") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		result := map[string]any{"items": []map[string]string{}}
+		if len(names) > 0 {
+			result["items"] = []map[string]string{{"name": names[0]}}
+			if len(names) > 1 {
+				result["nextPageToken"] = names[0]
+			}
+		}
+		json.NewEncoder(w).Encode(result)
+	default:
+		rest := strings.TrimPrefix(r.URL.EscapedPath(), objects+"/")
+		escaped, target, isRewrite := strings.Cut(rest, "/rewriteTo/b/bucket/o/")
+		name, _ := url.PathUnescape(escaped)
+		data, ok := f.objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch {
+		case isRewrite:
+			dst, _ := url.PathUnescape(target)
+			f.objects[dst] = data
+			w.Write([]byte(`{"done":true}`))
+		case r.Method == http.MethodDelete:
+			delete(f.objects, name)
+			w.WriteHeader(http.StatusNoContent)
+		case query.Get("alt") == "media":
+			w.Write(data)
+		default:
+			fmt.Fprintf(w, `{"name":%q,"size":"%d"}`, name, len(data))
+		}
+	}
+}
+
+func TestGCSStorage(t *testing.T) {
+	fake := &fakeGCS{objects: map[string][]byte{}, sessions: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	fake.url = server.URL
+
+	s, err := New("gcs", Parameters{"bucket": "bucket", "endpoint": server.URL, "prefix": "registry", "chunksize": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.PutManifest("library/app", "v1", "sha256:abc", []byte("manifest")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutManifest("library/app", "v2", "sha256:abc", []byte("manifest")); err != nil {
+		t.Fatal(err)
+	}
+	if data, digest, err := s.GetManifest("library/app", "v1"); err != nil || string(data) != "manifest" || digest != "sha256:abc" {
+		t.Fatalf("unexpected manifest %q %q %v", data, digest, err)
+	}
+	if tags, err := s.ListTags("library/app"); err != nil || strings.Join(tags, ",") != "v1,v2" {
+		t.Fatalf("unexpected tags %v %v", tags, err)
+	}
+
+	// 分块大小向上取整为 256KiB，超过一个分块时使用断点续传上传
+	large := bytes.Repeat([]byte("x"), 2*gcsChunkAlign+10)
+	if n, err := s.PutBlob("library/app", "sha256:large", bytes.NewReader(large)); err != nil || n != int64(len(large)) {
+		t.Fatalf("unexpected put result %d %v", n, err)
+	}
+	if fake.chunks != 3 {
+		t.Fatalf("expected 3 chunks, got %d", fake.chunks)
+	}
+	if size, err := s.GetBlobSize("library/app", "sha256:large"); err != nil || size != int64(len(large)) {
+		t.Fatalf("unexpected blob size %d %v", size, err)
+	}
+
+	if err := s.InitiateUpload("library/app", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AppendToUpload("library/app", "u1", strings.NewReader("lay")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompleteUpload("library/app", "u1", "sha256:layer", strings.NewReader("er")); err != nil {
+		t.Fatal(err)
+	}
+	reader, _, err := s.GetBlob("library/app", "sha256:layer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "layer" {
+		t.Fatalf("unexpected blob %q", data)
+	}
+	if _, ok := fake.objects["registry/uploads/library/app/u1"]; ok {
+		t.Fatal("expected upload object to be removed")
+	}
+
+	if repos, err := s.ListRepositories(); err != nil || len(repos) != 1 || repos[0] != "library/app" {
+		t.Fatalf("unexpected repositories %v %v", repos, err)
+	}
+	if _, err := s.GetBlobSize("library/app", "sha256:missing"); err == nil {
+		t.Fatal("expected missing blob error")
+	}
+}
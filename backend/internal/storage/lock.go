@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// repositoryLockStripes 仓库锁的分片数量
+const repositoryLockStripes = 256
+
+// repositoryLocks 按仓库名的哈希把仓库分配到固定数量的读写锁上，不同仓库的操作通常互不阻塞
+// 读取路径也会为任意仓库名加锁，按名称分配独立的锁会随请求无限增长，固定分片的内存占用不变；
+// 同一个操作只持有一个仓库的锁，共用分片的仓库只会互相等待，不会死锁
+type repositoryLocks struct {
+	stripes [repositoryLockStripes]sync.RWMutex
+}
+
+// get 返回仓库所在分片的锁
+func (l *repositoryLocks) get(repository string) *sync.RWMutex {
+	h := fnv.New32a()
+	h.Write([]byte(repository))
+	return &l.stripes[h.Sum32()%repositoryLockStripes]
+}
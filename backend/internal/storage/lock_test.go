@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedStorages 返回各存储实现和锁住某个仓库的函数
+func lockedStorages(t testing.TB) map[string]struct {
+	store Storage
+	lock  func(repository string) func()
+} {
+	file, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := NewMemoryStorage()
+	return map[string]struct {
+		store Storage
+		lock  func(repository string) func()
+	}{
+		"file": {file, func(repository string) func() {
+			lock := file.locks.get(repository)
+			lock.Lock()
+			return lock.Unlock
+		}},
+		"memory": {memory, func(repository string) func() {
+			repo := memory.ensureRepository(repository)
+			repo.mutex.Lock()
+			return repo.mutex.Unlock
+		}},
+	}
+}
+
+func TestRepositoryLocking(t *testing.T) {
+	for name, tc := range lockedStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			store := tc.store
+			blobDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("data")))
+			for _, repository := range []string{"a", "b"} {
+				store.PutBlob(repository, blobDigest, strings.NewReader("data"))
+				store.PutManifest(repository, "v1", "sha256:manifest", []byte(`{"schemaVersion":2}`))
+			}
+
+			// 仓库 a 的写锁被占用时，仓库 b 的读写和仓库 a 按摘要读取 blob 都不受影响
+			unlock := tc.lock("a")
+			done := make(chan error, 1)
+			go func() {
+				if _, _, err := store.GetManifest("b", "v1"); err != nil {
+					done <- err
+					return
+				}
+				if err := store.PutManifest("b", "v2", "sha256:manifest", []byte(`{"schemaVersion":2}`)); err != nil {
+					done <- err
+					return
+				}
+				blob, _, err := store.GetBlob("a", blobDigest)
+				if err == nil {
+					blob.Close()
+				}
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Operations were blocked by another repository's lock")
+			}
+			unlock()
+		})
+	}
+}
+
+func TestRepositoryLocksStripes(t *testing.T) {
+	var locks repositoryLocks
+	if locks.get("library/app") != locks.get("library/app") {
+		t.Fatal("Expected the same lock for the same repository")
+	}
+	// 任意数量的仓库名共用固定的分片
+	used := map[*sync.RWMutex]bool{}
+	for i := 0; i < 10*repositoryLockStripes; i++ {
+		used[locks.get(fmt.Sprintf("repo%d", i))] = true
+	}
+	if len(used) < repositoryLockStripes/2 || len(used) > repositoryLockStripes {
+		t.Fatalf("Unexpected number of lock stripes in use: %d", len(used))
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	for name, tc := range lockedStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			store := tc.store
+			var wg sync.WaitGroup
+			errs := make(chan error, 64)
+			for i := 0; i < 8; i++ {
+				repository := fmt.Sprintf("repo%d", i%2)
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 20; j++ {
+						tag := fmt.Sprintf("t%d-%d", i, j)
+						digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(tag)))
+						uploadID := fmt.Sprintf("u%d-%d", i, j)
+						if err := store.InitiateUpload(repository, uploadID); err != nil {
+							errs <- err
+							return
+						}
+						if _, err := store.AppendToUpload(repository, uploadID, strings.NewReader(tag)); err != nil {
+							errs <- err
+							return
+						}
+						if err := store.CompleteUpload(repository, uploadID, digest, strings.NewReader("")); err != nil {
+							errs <- err
+							return
+						}
+						if err := store.PutManifest(repository, tag, digest, []byte(tag)); err != nil {
+							errs <- err
+							return
+						}
+						if data, _, err := store.GetManifest(repository, tag); err != nil || string(data) != tag {
+							errs <- fmt.Errorf("manifest %s:%s = %q, %v", repository, tag, data, err)
+							return
+						}
+						blob, _, err := store.GetBlob(repository, digest)
+						if err != nil {
+							errs <- err
+							return
+						}
+						data, _ := io.ReadAll(blob)
+						blob.Close()
+						if string(data) != tag {
+							errs <- fmt.Errorf("blob %s@%s = %q", repository, digest, data)
+							return
+						}
+						store.ListTags(repository)
+						store.ListBlobs(repository)
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Fatal(err)
+			}
+			for _, repository := range []string{"repo0", "repo1"} {
+				if tags, _ := store.ListTags(repository); len(tags) != 80 {
+					t.Fatalf("Expected 80 tags in %s, got %d", repository, len(tags))
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkParallelPull 多个请求并发拉取同一个 blob，同时另一个仓库在持续推送
+func BenchmarkParallelPull(b *testing.B) {
+	for name, tc := range lockedStorages(b) {
+		b.Run(name, func(b *testing.B) {
+			store := tc.store
+			data := strings.Repeat("x", 1<<20)
+			digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(data)))
+			store.PutBlob("pull", digest, strings.NewReader(data))
+			store.PutManifest("pull", "latest", "sha256:manifest", []byte(`{"schemaVersion":2}`))
+
+			stop := make(chan struct{})
+			defer close(stop)
+			go func() {
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					store.PutBlob("push", digest, strings.NewReader(data))
+					store.PutManifest("push", "latest", "sha256:manifest", []byte(`{"schemaVersion":2}`))
+				}
+			}()
+
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, _, err := store.GetManifest("pull", "latest"); err != nil {
+						b.Fatal(err)
+					}
+					blob, _, err := store.GetBlob("pull", digest)
+					if err != nil {
+						b.Fatal(err)
+					}
+					io.Copy(io.Discard, blob)
+					blob.Close()
+				}
+			})
+		})
+	}
+}
@@ -4,34 +4,73 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
 // MemoryStorage 实现基于内存的存储
+// 锁按仓库划分，不同仓库的操作互不阻塞；blob 和清单写入后不再修改，按摘要读取不需要加锁
 type MemoryStorage struct {
 	repositories map[string]*Repository
-	uploads      map[string]map[string][]byte
-	mutex        sync.RWMutex
+	mutex        sync.RWMutex // 只保护 repositories 映射本身
 }
 
 // Repository 表示内存中的仓库
 type Repository struct {
 	Name      string
 	Tags      map[string]string // tag -> digest
-	Manifests map[string][]byte // digest -> manifest
-	Blobs     map[string][]byte // digest -> blob
+	Manifests sync.Map          // digest -> manifest
+	Blobs     sync.Map          // digest -> blob
+
+	modified     map[string]time.Time     // tag 或 digest -> 最后写入时间
+	blobModified map[string]time.Time     // blob digest -> 最后写入时间
+	uploads      map[string]*memoryUpload // uploadID -> 上传
+	mutex        sync.RWMutex             // 保护 Tags、modified、blobModified 和 uploads
+}
+
+// memoryUpload 未完成的上传
+type memoryUpload struct {
+	data    []byte
+	updated time.Time // 最后写入时间
 }
 
 // NewMemoryStorage 创建新的内存存储
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
 		repositories: make(map[string]*Repository),
-		uploads:      make(map[string]map[string][]byte),
 	}
 }
 
+// repository 返回仓库，不存在时返回 nil
+func (s *MemoryStorage) repository(name string) *Repository {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.repositories[name]
+}
+
+// ensureRepository 返回仓库，不存在时创建
+func (s *MemoryStorage) ensureRepository(name string) *Repository {
+	if repo := s.repository(name); repo != nil {
+		return repo
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	repo, ok := s.repositories[name]
+	if !ok {
+		repo = &Repository{
+			Name:         name,
+			Tags:         make(map[string]string),
+			modified:     make(map[string]time.Time),
+			blobModified: make(map[string]time.Time),
+			uploads:      make(map[string]*memoryUpload),
+		}
+		s.repositories[name] = repo
+	}
+	return repo
+}
+
 // ListRepositories 列出所有仓库
 func (s *MemoryStorage) ListRepositories() ([]string, error) {
 	s.mutex.RLock()
@@ -41,42 +80,42 @@ func (s *MemoryStorage) ListRepositories() ([]string, error) {
 	for name := range s.repositories {
 		repos = append(repos, name)
 	}
+	sort.Strings(repos)
 	return repos, nil
 }
 
 // ListTags 列出仓库的所有标签
 func (s *MemoryStorage) ListTags(repository string) ([]string, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	repo, ok := s.repositories[repository]
-	if !ok {
+	repo := s.repository(repository)
+	if repo == nil {
 		return []string{}, nil
 	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
 
 	tags := make([]string, 0, len(repo.Tags))
 	for tag := range repo.Tags {
 		tags = append(tags, tag)
 	}
+	sort.Strings(tags)
 	return tags, nil
 }
 
 // GetManifest 获取清单
 func (s *MemoryStorage) GetManifest(repository, reference string) ([]byte, string, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
 	// 首先检查是否是 digest
 	if strings.HasPrefix(reference, "sha256:") {
 		return s.GetManifestByDigest(repository, reference)
 	}
 
-	repo, ok := s.repositories[repository]
-	if !ok {
+	repo := s.repository(repository)
+	if repo == nil {
 		return nil, "", fmt.Errorf("repository not found: %s", repository)
 	}
 
+	repo.mutex.RLock()
 	digest, ok := repo.Tags[reference]
+	repo.mutex.RUnlock()
 	if !ok {
 		return nil, "", fmt.Errorf("tag not found: %s", reference)
 	}
@@ -86,214 +125,356 @@ func (s *MemoryStorage) GetManifest(repository, reference string) ([]byte, strin
 
 // GetManifestByDigest 通过摘要获取清单
 func (s *MemoryStorage) GetManifestByDigest(repository, digest string) ([]byte, string, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	repo, ok := s.repositories[repository]
-	if !ok {
+	repo := s.repository(repository)
+	if repo == nil {
 		return nil, "", fmt.Errorf("repository not found: %s", repository)
 	}
 
-	manifest, ok := repo.Manifests[digest]
+	manifest, ok := repo.Manifests.Load(digest)
 	if !ok {
 		return nil, "", fmt.Errorf("manifest not found: %s", digest)
 	}
 
-	return manifest, digest, nil
+	return manifest.([]byte), digest, nil
 }
 
 // PutManifest 存储清单
 func (s *MemoryStorage) PutManifest(repository, reference, digest string, manifest []byte) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	// 确保仓库存在
-	repo, ok := s.repositories[repository]
-	if !ok {
-		repo = &Repository{
-			Name:      repository,
-			Tags:      make(map[string]string),
-			Manifests: make(map[string][]byte),
-			Blobs:     make(map[string][]byte),
-		}
-		s.repositories[repository] = repo
-	}
+	repo := s.ensureRepository(repository)
 
-	// 存储清单
-	repo.Manifests[digest] = manifest
+	// 先存储清单，标签更新后指向的清单一定存在
+	repo.Manifests.Store(digest, manifest)
 
+	now := time.Now()
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.modified[digest]; !ok {
+		repo.modified[digest] = now
+	}
 	// 如果提供了标签引用，更新标签
 	if reference != "" && !strings.HasPrefix(reference, "sha256:") {
+		if repo.Tags[reference] != digest {
+			repo.modified[reference] = now
+		}
 		repo.Tags[reference] = digest
 	}
 
 	return nil
 }
 
+// ManifestModTime 返回标签或清单最后写入的时间
+func (s *MemoryStorage) ManifestModTime(repository, reference string) (time.Time, error) {
+	repo := s.repository(repository)
+	if repo == nil {
+		return time.Time{}, fmt.Errorf("repository not found: %s", repository)
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	modified, ok := repo.modified[reference]
+	if !ok {
+		return time.Time{}, fmt.Errorf("manifest not found: %s", reference)
+	}
+	return modified, nil
+}
+
+// ListManifests 列出仓库中所有清单的摘要
+func (s *MemoryStorage) ListManifests(repository string) ([]string, error) {
+	repo := s.repository(repository)
+	if repo == nil {
+		return []string{}, nil
+	}
+	return sortedKeys(&repo.Manifests), nil
+}
+
 // DeleteManifest 删除清单
 func (s *MemoryStorage) DeleteManifest(repository, reference string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	repo, ok := s.repositories[repository]
-	if !ok {
+	repo := s.repository(repository)
+	if repo == nil {
 		return fmt.Errorf("repository not found: %s", repository)
 	}
 
 	// 如果是摘要，直接删除清单
 	if strings.HasPrefix(reference, "sha256:") {
-		delete(repo.Manifests, reference)
+		repo.Manifests.Delete(reference)
+		repo.mutex.Lock()
+		delete(repo.modified, reference)
+		repo.mutex.Unlock()
 		return nil
 	}
 
 	// 如果是标签，找到对应的摘要，然后删除标签和清单
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
 	digest, ok := repo.Tags[reference]
 	if !ok {
 		return fmt.Errorf("tag not found: %s", reference)
 	}
 
 	delete(repo.Tags, reference)
-	delete(repo.Manifests, digest)
+	delete(repo.modified, reference)
+	delete(repo.modified, digest)
+	repo.Manifests.Delete(digest)
 
 	return nil
 }
 
-// GetBlobSize 获取 blob 大小
-func (s *MemoryStorage) GetBlobSize(repository, digest string) (int64, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+// DeleteTag 删除标签
+func (s *MemoryStorage) DeleteTag(repository, tag string) error {
+	repo := s.repository(repository)
+	if repo == nil {
+		return fmt.Errorf("repository not found: %s", repository)
+	}
 
-	repo, ok := s.repositories[repository]
-	if !ok {
-		return 0, fmt.Errorf("repository not found: %s", repository)
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.Tags[tag]; !ok {
+		return fmt.Errorf("tag not found: %s", tag)
 	}
+	delete(repo.Tags, tag)
+	delete(repo.modified, tag)
+	return nil
+}
 
-	blob, ok := repo.Blobs[digest]
+// blob 按摘要查找 blob，不加锁
+func (s *MemoryStorage) blob(repository, digest string) ([]byte, error) {
+	repo := s.repository(repository)
+	if repo == nil {
+		return nil, fmt.Errorf("repository not found: %s", repository)
+	}
+	blob, ok := repo.Blobs.Load(digest)
 	if !ok {
-		return 0, fmt.Errorf("blob not found: %s", digest)
+		return nil, fmt.Errorf("blob not found: %s", digest)
 	}
+	return blob.([]byte), nil
+}
 
+// GetBlobSize 获取 blob 大小
+func (s *MemoryStorage) GetBlobSize(repository, digest string) (int64, error) {
+	blob, err := s.blob(repository, digest)
+	if err != nil {
+		return 0, err
+	}
 	return int64(len(blob)), nil
 }
 
 // GetBlob 获取 blob
 func (s *MemoryStorage) GetBlob(repository, digest string) (io.ReadCloser, int64, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	blob, err := s.blob(repository, digest)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytesReadCloser{bytes.NewReader(blob)}, int64(len(blob)), nil
+}
 
-	repo, ok := s.repositories[repository]
-	if !ok {
-		return nil, 0, fmt.Errorf("repository not found: %s", repository)
+// PutBlob 读取全部数据后存储 blob
+func (s *MemoryStorage) PutBlob(repository, digest string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read blob: %v", err)
 	}
 
-	blob, ok := repo.Blobs[digest]
+	s.storeBlob(s.ensureRepository(repository), digest, data)
+	return int64(len(data)), nil
+}
+
+// storeBlob 存储 blob 并记录写入时间
+func (s *MemoryStorage) storeBlob(repo *Repository, digest string, data []byte) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.Blobs.Store(digest, data)
+	repo.blobModified[digest] = time.Now()
+}
+
+// BlobModTime 返回 blob 最后写入的时间
+func (s *MemoryStorage) BlobModTime(repository, digest string) (time.Time, error) {
+	repo := s.repository(repository)
+	if repo == nil {
+		return time.Time{}, fmt.Errorf("repository not found: %s", repository)
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	modified, ok := repo.blobModified[digest]
 	if !ok {
-		return nil, 0, fmt.Errorf("blob not found: %s", digest)
+		return time.Time{}, fmt.Errorf("blob not found: %s", digest)
 	}
-
-	return io.NopCloser(bytes.NewReader(blob)), int64(len(blob)), nil
+	return modified, nil
 }
 
 // DeleteBlob 删除 blob
 func (s *MemoryStorage) DeleteBlob(repository, digest string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	repo, ok := s.repositories[repository]
-	if !ok {
+	repo := s.repository(repository)
+	if repo == nil {
 		return fmt.Errorf("repository not found: %s", repository)
 	}
 
-	delete(repo.Blobs, digest)
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.Blobs.Delete(digest)
+	delete(repo.blobModified, digest)
 	return nil
 }
 
-// InitiateUpload 初始化上传
-func (s *MemoryStorage) InitiateUpload(repository, uploadID string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	// 确保仓库存在
-	if _, ok := s.repositories[repository]; !ok {
-		s.repositories[repository] = &Repository{
-			Name:      repository,
-			Tags:      make(map[string]string),
-			Manifests: make(map[string][]byte),
-			Blobs:     make(map[string][]byte),
-		}
+// MountBlob 把 from 仓库中的 blob 关联到 repository，两个仓库共享同一份数据
+func (s *MemoryStorage) MountBlob(repository, from, digest string) error {
+	blob, err := s.blob(from, digest)
+	if err != nil {
+		return err
 	}
+	s.storeBlob(s.ensureRepository(repository), digest, blob)
+	return nil
+}
 
-	// 确保上传映射存在
-	if _, ok := s.uploads[repository]; !ok {
-		s.uploads[repository] = make(map[string][]byte)
+// ListBlobs 列出仓库中所有 blob 的摘要
+func (s *MemoryStorage) ListBlobs(repository string) ([]string, error) {
+	repo := s.repository(repository)
+	if repo == nil {
+		return []string{}, nil
 	}
+	return sortedKeys(&repo.Blobs), nil
+}
+
+// InitiateUpload 初始化上传
+func (s *MemoryStorage) InitiateUpload(repository, uploadID string) error {
+	repo := s.ensureRepository(repository)
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
 
 	// 初始化空上传
-	s.uploads[repository][uploadID] = []byte{}
+	repo.uploads[uploadID] = &memoryUpload{data: []byte{}, updated: time.Now()}
 	return nil
 }
 
 // AppendToUpload 追加数据到上传
-func (s *MemoryStorage) AppendToUpload(repository, uploadID string, data []byte) (int64, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	repoUploads, ok := s.uploads[repository]
-	if !ok {
-		return 0, fmt.Errorf("no uploads for repository: %s", repository)
+// 读取请求体时不持有锁，避免慢速客户端阻塞其他请求
+func (s *MemoryStorage) AppendToUpload(repository, uploadID string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read upload data: %v", err)
 	}
 
-	current, ok := repoUploads[uploadID]
-	if !ok {
-		return 0, fmt.Errorf("upload not found: %s", uploadID)
+	repo, upload, err := s.upload(repository, uploadID)
+	if err != nil {
+		return 0, err
 	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
 
 	// 追加数据
-	repoUploads[uploadID] = append(current, data...)
-	return int64(len(repoUploads[uploadID])), nil
+	upload.data = append(upload.data, data...)
+	upload.updated = time.Now()
+	return int64(len(upload.data)), nil
 }
 
-// CompleteUpload 完成上传
-func (s *MemoryStorage) CompleteUpload(repository, uploadID, digest string, data []byte) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// GetUploadSize 返回上传已接收的字节数
+func (s *MemoryStorage) GetUploadSize(repository, uploadID string) (int64, error) {
+	repo, upload, err := s.upload(repository, uploadID)
+	if err != nil {
+		return 0, err
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	return int64(len(upload.data)), nil
+}
 
-	repoUploads, ok := s.uploads[repository]
-	if !ok {
-		return fmt.Errorf("no uploads for repository: %s", repository)
+// ReadUpload 返回上传已接收的数据
+func (s *MemoryStorage) ReadUpload(repository, uploadID string) (io.ReadCloser, error) {
+	repo, upload, err := s.upload(repository, uploadID)
+	if err != nil {
+		return nil, err
 	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	return bytesReadCloser{bytes.NewReader(upload.data)}, nil
+}
 
-	current, ok := repoUploads[uploadID]
-	if !ok {
+// CompleteUpload 完成上传
+func (s *MemoryStorage) CompleteUpload(repository, uploadID, digest string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read upload data: %v", err)
+	}
+
+	repo, upload, err := s.upload(repository, uploadID)
+	if err != nil {
+		return err
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if repo.uploads[uploadID] != upload {
 		return fmt.Errorf("upload not found: %s", uploadID)
 	}
 
-	// 处理最后的数据片段
-	if len(data) > 0 {
-		current = append(current, data...)
+	// 处理最后的数据片段，存储 blob 并清理上传
+	repo.Blobs.Store(digest, append(upload.data, data...))
+	repo.blobModified[digest] = time.Now()
+	delete(repo.uploads, uploadID)
+	return nil
+}
+
+// CancelUpload 取消上传
+func (s *MemoryStorage) CancelUpload(repository, uploadID string) error {
+	repo, _, err := s.upload(repository, uploadID)
+	if err != nil {
+		return err
 	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	delete(repo.uploads, uploadID)
+	return nil
+}
 
-	// 确保仓库存在
-	repo, ok := s.repositories[repository]
-	if !ok {
-		repo = &Repository{
-			Name:      repository,
-			Tags:      make(map[string]string),
-			Manifests: make(map[string][]byte),
-			Blobs:     make(map[string][]byte),
+// PurgeUploads 删除最后一次写入早于 before 的上传
+func (s *MemoryStorage) PurgeUploads(before time.Time) (int, error) {
+	s.mutex.RLock()
+	repos := make([]*Repository, 0, len(s.repositories))
+	for _, repo := range s.repositories {
+		repos = append(repos, repo)
+	}
+	s.mutex.RUnlock()
+
+	purged := 0
+	for _, repo := range repos {
+		repo.mutex.Lock()
+		for uploadID, upload := range repo.uploads {
+			if upload.updated.Before(before) {
+				delete(repo.uploads, uploadID)
+				purged++
+			}
 		}
-		s.repositories[repository] = repo
+		repo.mutex.Unlock()
 	}
+	return purged, nil
+}
 
-	// 存储 blob
-	repo.Blobs[digest] = current
+// upload 返回上传所在的仓库和上传
+func (s *MemoryStorage) upload(repository, uploadID string) (*Repository, *memoryUpload, error) {
+	repo := s.repository(repository)
+	if repo == nil {
+		return nil, nil, fmt.Errorf("no uploads for repository: %s", repository)
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	upload, ok := repo.uploads[uploadID]
+	if !ok {
+		return nil, nil, fmt.Errorf("upload not found: %s", uploadID)
+	}
+	return repo, upload, nil
+}
 
-	// 清理上传
-	delete(repoUploads, uploadID)
-	return nil
+// bytesReadCloser 支持 Seek 的内存读取器，拉取缓存可以用它处理 Range 请求
+type bytesReadCloser struct {
+	*bytes.Reader
 }
 
-// generateUploadID 生成上传 ID (辅助函数)
-func generateUploadID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+func (bytesReadCloser) Close() error { return nil }
+
+// sortedKeys 返回排序后的键
+func sortedKeys(m *sync.Map) []string {
+	keys := []string{}
+	m.Range(func(key, _ any) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,466 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errObjectNotFound 对象不存在
+var errObjectNotFound = errors.New("object not found")
+
+// objectStore 对象存储的基本操作，GCS 和 Azure 驱动实现该接口，由 objectStorage 实现 Storage
+type objectStore interface {
+	get(key string) (io.ReadCloser, int64, error)
+	size(key string) (int64, error)
+	// create 返回流式写入对象的 objectWriter，Close 之前对象不可见
+	create(key string) (objectWriter, error)
+	copy(src, dst string) error
+	delete(key string) error
+	// list 列出前缀下的全部对象键，内部处理分页
+	list(prefix string) ([]string, error)
+}
+
+// objectWriter 分块上传对象，数据凑满一块后发送
+type objectWriter interface {
+	io.Writer
+	// Close 提交对象
+	Close() error
+	// Abort 放弃上传
+	Abort()
+	// Size 已写入的字节数
+	Size() int64
+}
+
+// objectStorage 在对象存储上实现 Storage，对象布局与 FileStorage 的目录结构一致：
+//
+//	repositories/<repo>/_manifests/<digest>  清单内容
+//	repositories/<repo>/tags/<tag>           标签指向的摘要
+//	repositories/<repo>/_blobs/<digest>      blob 内容
+//	uploads/<repo>/<uploadID>                未完成的上传
+//
+// 上传会话保存在当前进程中，同一个上传的请求需要发送到同一个实例
+type objectStorage struct {
+	store  objectStore
+	prefix string
+
+	mutex   sync.Mutex
+	uploads map[string]objectWriter
+	touched map[string]time.Time // 上传最后写入的时间
+}
+
+func newObjectStorage(store objectStore, prefix string) *objectStorage {
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+	return &objectStorage{
+		store:   store,
+		prefix:  prefix,
+		uploads: make(map[string]objectWriter),
+		touched: make(map[string]time.Time),
+	}
+}
+
+// ListRepositories 列出所有仓库
+func (s *objectStorage) ListRepositories() ([]string, error) {
+	prefix := s.key("repositories") + "/"
+	keys, err := s.store.list(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	repositories := []string{}
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		for _, marker := range []string{"/_manifests/", "/tags/", "/_blobs/"} {
+			if i := strings.Index(name, marker); i > 0 {
+				if repository := name[:i]; !seen[repository] {
+					seen[repository] = true
+					repositories = append(repositories, repository)
+				}
+				break
+			}
+		}
+	}
+	sort.Strings(repositories)
+	return repositories, nil
+}
+
+// ListTags 列出仓库的所有标签
+func (s *objectStorage) ListTags(repository string) ([]string, error) {
+	prefix := s.key("repositories", repository, "tags") + "/"
+	keys, err := s.store.list(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %v", err)
+	}
+
+	tags := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if tag := strings.TrimPrefix(key, prefix); !strings.Contains(tag, "/") {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// GetManifest 获取清单
+func (s *objectStorage) GetManifest(repository, reference string) ([]byte, string, error) {
+	if strings.HasPrefix(reference, "sha256:") {
+		return s.GetManifestByDigest(repository, reference)
+	}
+
+	data, err := s.read(s.key("repositories", repository, "tags", reference))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read tag: %v", err)
+	}
+	return s.GetManifestByDigest(repository, string(data))
+}
+
+// GetManifestByDigest 通过摘要获取清单
+func (s *objectStorage) GetManifestByDigest(repository, digest string) ([]byte, string, error) {
+	data, err := s.read(s.key("repositories", repository, "_manifests", digest))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read manifest: %v", err)
+	}
+	return data, digest, nil
+}
+
+// PutManifest 存储清单
+func (s *objectStorage) PutManifest(repository, reference, digest string, manifest []byte) error {
+	if err := s.write(s.key("repositories", repository, "_manifests", digest), manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+
+	// 如果提供了标签引用，更新标签
+	if reference != "" && !strings.HasPrefix(reference, "sha256:") {
+		if err := s.write(s.key("repositories", repository, "tags", reference), []byte(digest)); err != nil {
+			return fmt.Errorf("failed to write tag: %v", err)
+		}
+	}
+	return nil
+}
+
+// DeleteTag 删除标签对象
+func (s *objectStorage) DeleteTag(repository, tag string) error {
+	tagKey := s.key("repositories", repository, "tags", tag)
+	if _, err := s.store.size(tagKey); err != nil {
+		return fmt.Errorf("failed to read tag: %v", err)
+	}
+	if err := s.store.delete(tagKey); err != nil {
+		return fmt.Errorf("failed to remove tag: %v", err)
+	}
+	return nil
+}
+
+// ListManifests 列出仓库中所有清单的摘要
+func (s *objectStorage) ListManifests(repository string) ([]string, error) {
+	digests, err := s.listNames(s.key("repositories", repository, "_manifests") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list manifests: %v", err)
+	}
+	return digests, nil
+}
+
+// DeleteManifest 删除清单
+func (s *objectStorage) DeleteManifest(repository, reference string) error {
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		tagKey := s.key("repositories", repository, "tags", reference)
+		data, err := s.read(tagKey)
+		if err != nil {
+			return fmt.Errorf("failed to read tag: %v", err)
+		}
+		digest = string(data)
+		if err := s.store.delete(tagKey); err != nil {
+			return fmt.Errorf("failed to remove tag: %v", err)
+		}
+	}
+
+	if err := s.store.delete(s.key("repositories", repository, "_manifests", digest)); err != nil {
+		return fmt.Errorf("failed to remove manifest: %v", err)
+	}
+	return nil
+}
+
+// GetBlobSize 获取 blob 大小
+func (s *objectStorage) GetBlobSize(repository, digest string) (int64, error) {
+	size, err := s.store.size(s.key("repositories", repository, "_blobs", digest))
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat blob: %v", err)
+	}
+	return size, nil
+}
+
+// GetBlob 获取 blob
+func (s *objectStorage) GetBlob(repository, digest string) (io.ReadCloser, int64, error) {
+	reader, size, err := s.store.get(s.key("repositories", repository, "_blobs", digest))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open blob: %v", err)
+	}
+	return reader, size, nil
+}
+
+// PutBlob 流式写入 blob，r 返回错误时放弃上传
+func (s *objectStorage) PutBlob(repository, digest string, r io.Reader) (int64, error) {
+	w, err := s.store.create(s.key("repositories", repository, "_blobs", digest))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create blob: %v", err)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Abort()
+		return 0, fmt.Errorf("failed to write blob: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write blob: %v", err)
+	}
+	return w.Size(), nil
+}
+
+// DeleteBlob 删除 blob
+func (s *objectStorage) DeleteBlob(repository, digest string) error {
+	if err := s.store.delete(s.key("repositories", repository, "_blobs", digest)); err != nil {
+		return fmt.Errorf("failed to remove blob: %v", err)
+	}
+	return nil
+}
+
+// ListBlobs 列出仓库中所有 blob 的摘要
+func (s *objectStorage) ListBlobs(repository string) ([]string, error) {
+	digests, err := s.listNames(s.key("repositories", repository, "_blobs") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %v", err)
+	}
+	return digests, nil
+}
+
+// MountBlob 在服务端把 from 仓库的 blob 复制到 repository，数据不经过本地
+func (s *objectStorage) MountBlob(repository, from, digest string) error {
+	if err := s.store.copy(s.key("repositories", from, "_blobs", digest), s.key("repositories", repository, "_blobs", digest)); err != nil {
+		return fmt.Errorf("failed to mount blob: %v", err)
+	}
+	return nil
+}
+
+// InitiateUpload 初始化上传
+func (s *objectStorage) InitiateUpload(repository, uploadID string) error {
+	w, err := s.store.create(s.key("uploads", repository, uploadID))
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %v", err)
+	}
+
+	s.mutex.Lock()
+	s.uploads[repository+"/"+uploadID] = w
+	s.touched[repository+"/"+uploadID] = time.Now()
+	s.mutex.Unlock()
+	return nil
+}
+
+// AppendToUpload 追加数据到上传
+func (s *objectStorage) AppendToUpload(repository, uploadID string, r io.Reader) (int64, error) {
+	w, err := s.upload(repository, uploadID)
+	if err != nil {
+		return 0, err
+	}
+	s.touch(repository, uploadID)
+	defer s.touch(repository, uploadID)
+	if _, err := io.Copy(w, r); err != nil {
+		return 0, fmt.Errorf("failed to write to upload: %v", err)
+	}
+	return w.Size(), nil
+}
+
+// GetUploadSize 返回上传已接收的字节数
+func (s *objectStorage) GetUploadSize(repository, uploadID string) (int64, error) {
+	w, err := s.upload(repository, uploadID)
+	if err != nil {
+		return 0, err
+	}
+	return w.Size(), nil
+}
+
+// CompleteUpload 完成上传，提交后复制到 blob 的位置并删除上传对象
+func (s *objectStorage) CompleteUpload(repository, uploadID, digest string, r io.Reader) error {
+	w, err := s.upload(repository, uploadID)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("failed to write to upload: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to complete upload: %v", err)
+	}
+
+	s.mutex.Lock()
+	delete(s.uploads, repository+"/"+uploadID)
+	delete(s.touched, repository+"/"+uploadID)
+	s.mutex.Unlock()
+
+	uploadKey := s.key("uploads", repository, uploadID)
+	if err := s.store.copy(uploadKey, s.key("repositories", repository, "_blobs", digest)); err != nil {
+		return fmt.Errorf("failed to move upload to blob: %v", err)
+	}
+	if err := s.store.delete(uploadKey); err != nil {
+		return fmt.Errorf("failed to remove upload: %v", err)
+	}
+	return nil
+}
+
+// CancelUpload 取消上传，放弃未提交的数据
+func (s *objectStorage) CancelUpload(repository, uploadID string) error {
+	s.mutex.Lock()
+	w, ok := s.uploads[repository+"/"+uploadID]
+	delete(s.uploads, repository+"/"+uploadID)
+	delete(s.touched, repository+"/"+uploadID)
+	s.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("upload %s not found", uploadID)
+	}
+	w.Abort()
+	return nil
+}
+
+// PurgeUploads 放弃最后一次写入早于 before 的上传
+func (s *objectStorage) PurgeUploads(before time.Time) (int, error) {
+	var stale []objectWriter
+	s.mutex.Lock()
+	for key, w := range s.uploads {
+		if s.touched[key].Before(before) {
+			delete(s.uploads, key)
+			delete(s.touched, key)
+			stale = append(stale, w)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, w := range stale {
+		w.Abort()
+	}
+	return len(stale), nil
+}
+
+// touch 记录上传的写入时间
+func (s *objectStorage) touch(repository, uploadID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.uploads[repository+"/"+uploadID]; ok {
+		s.touched[repository+"/"+uploadID] = time.Now()
+	}
+}
+
+func (s *objectStorage) upload(repository, uploadID string) (objectWriter, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w, ok := s.uploads[repository+"/"+uploadID]
+	if !ok {
+		return nil, fmt.Errorf("upload %s not found", uploadID)
+	}
+	return w, nil
+}
+
+// listNames 列出前缀下一级对象的名称
+func (s *objectStorage) listNames(prefix string) ([]string, error) {
+	keys, err := s.store.list(prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if name := strings.TrimPrefix(key, prefix); !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// key 拼接对象键
+func (s *objectStorage) key(elem ...string) string {
+	return s.prefix + path.Join(elem...)
+}
+
+func (s *objectStorage) read(key string) ([]byte, error) {
+	reader, _, err := s.store.get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func (s *objectStorage) write(key string, data []byte) error {
+	w, err := s.store.create(key)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// chunkWriter 把写入的数据按 chunkSize 分块交给 flush，Close 时把剩余数据交给 commit
+// 同一个上传可能被并发的请求追加，所有操作都持有锁
+type chunkWriter struct {
+	mutex     sync.Mutex
+	chunkSize int
+	buf       []byte
+	size      int64
+	flush     func(chunk []byte) error
+	commit    func(rest []byte) error
+	abort     func()
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buf = append(w.buf, p...)
+	w.size += int64(len(p))
+	for len(w.buf) >= w.chunkSize {
+		if err := w.flush(w.buf[:w.chunkSize]); err != nil {
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[w.chunkSize:]...)
+	}
+	return len(p), nil
+}
+
+func (w *chunkWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.commit(w.buf)
+}
+
+func (w *chunkWriter) Abort() {
+	if w.abort != nil {
+		w.abort()
+	}
+}
+
+func (w *chunkWriter) Size() int64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.size
+}
+
+// httpStatusError 把非预期的响应转换为错误，404 转换为 errObjectNotFound
+func httpStatusError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return errObjectNotFound
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if data = bytes.TrimSpace(data); len(data) > 0 {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, data)
+	}
+	return fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
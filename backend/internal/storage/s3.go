@@ -0,0 +1,1138 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultS3PartSize 分段上传的默认分段大小
+	defaultS3PartSize = 16 << 20
+	// minS3PartSize S3 要求除最后一段外每段至少 5MiB
+	minS3PartSize = 5 << 20
+	// maxS3CopySize 单次 CopyObject 支持的最大对象，超过时使用分段复制
+	maxS3CopySize = 5 << 30
+
+	s3DefaultRegion = "us-east-1"
+	s3MetaDigest    = "X-Amz-Meta-Digest"
+	// s3MetaUploadHash 和 s3MetaUploadSize 保存在 pending 对象上，记录上传已接收数据的 sha256 状态和对应的大小
+	s3MetaUploadHash = "X-Amz-Meta-Upload-Hash"
+	s3MetaUploadSize = "X-Amz-Meta-Upload-Size"
+	emptyPayloadSHA  = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Config S3 兼容存储 (AWS S3、MinIO 等) 的连接配置
+type S3Config struct {
+	// Endpoint 服务地址，例如 https://s3.amazonaws.com 或 http://minio:9000
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"accessKey,omitempty"`
+	SecretKey string `json:"secretKey,omitempty"`
+	// Prefix 所有对象键的前缀，多个仓库可以共用一个 bucket
+	Prefix string `json:"prefix,omitempty"`
+	// PathStyle 使用 endpoint/bucket/key 形式的地址，MinIO 通常需要开启
+	PathStyle bool `json:"pathStyle,omitempty"`
+	// PartSize 分段上传的分段大小，默认 16MiB，最小 5MiB
+	PartSize int64 `json:"partSize,omitempty"`
+}
+
+// S3Storage 实现基于 S3 兼容对象存储的存储，对象布局与 FileStorage 的目录结构一致：
+//
+//	repositories/<repo>/_manifests/<digest>  清单内容
+//	repositories/<repo>/tags/<tag>           空对象，指向的摘要保存在对象元数据中
+//	repositories/<repo>/_blobs/<digest>      blob 内容
+//	uploads/<repo>/<uploadID>                未完成的分段上传
+//	uploads/<repo>/<uploadID>.pending        上传中不足一个分段的数据，元数据中保存已接收数据的 sha256 状态
+//
+// blob 和上传均使用分段上传，完成前对象不可见，不会留下不完整的 blob。
+// 进行中的上传缓存在当前进程中，缓存没有时通过 ListMultipartUploads 和 ListParts 从 bucket 恢复，
+// 重启或请求发送到其他实例后可以继续上传；同一个上传不能由多个实例同时写入
+type S3Storage struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+
+	mutex   sync.Mutex
+	uploads map[string]*s3Upload
+}
+
+// s3Upload 进行中的分段上传，不足一个分段的数据暂存在 pending 中
+type s3Upload struct {
+	mutex    sync.Mutex
+	key      string
+	uploadID string
+	parts    []s3Part
+	pending  []byte
+	stored   bool      // pending 已保存到 bucket
+	hash     hash.Hash // 已接收数据的 sha256 状态，从 bucket 恢复时状态不可用则为 nil
+	size     int64
+	updated  time.Time // 最后写入时间
+}
+
+// pendingKey 保存 pending 的对象键
+func (u *s3Upload) pendingKey() string {
+	return u.key + ".pending"
+}
+
+// s3MultipartUpload ListMultipartUploads 返回的未完成分段上传
+type s3MultipartUpload struct {
+	Key       string    `xml:"Key"`
+	UploadID  string    `xml:"UploadId"`
+	Initiated time.Time `xml:"Initiated"`
+}
+
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// NewS3Storage 创建 S3 存储
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("bucket is required for s3 storage")
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", config.Endpoint)
+	}
+	if config.Region == "" {
+		config.Region = s3DefaultRegion
+	}
+	if config.PartSize == 0 {
+		config.PartSize = defaultS3PartSize
+	} else if config.PartSize < minS3PartSize {
+		config.PartSize = minS3PartSize
+	}
+	if config.Prefix = strings.Trim(config.Prefix, "/"); config.Prefix != "" {
+		config.Prefix += "/"
+	}
+
+	return &S3Storage{
+		config:   config,
+		endpoint: endpoint,
+		client: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			MaxIdleConnsPerHost:   32,
+			IdleConnTimeout:       90 * time.Second,
+			ResponseHeaderTimeout: time.Minute,
+		}},
+		uploads: make(map[string]*s3Upload),
+	}, nil
+}
+
+// ListRepositories 列出所有仓库
+func (s *S3Storage) ListRepositories() ([]string, error) {
+	prefix := s.key("repositories") + "/"
+	keys, _, err := s.list(prefix, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	repositories := []string{}
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		for _, marker := range []string{"/_manifests/", "/tags/", "/_blobs/"} {
+			if i := strings.Index(name, marker); i > 0 {
+				if repository := name[:i]; !seen[repository] {
+					seen[repository] = true
+					repositories = append(repositories, repository)
+				}
+				break
+			}
+		}
+	}
+	sort.Strings(repositories)
+	return repositories, nil
+}
+
+// ListTags 列出仓库的所有标签
+func (s *S3Storage) ListTags(repository string) ([]string, error) {
+	prefix := s.key("repositories", repository, "tags") + "/"
+	keys, _, err := s.list(prefix, "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %v", err)
+	}
+
+	tags := make([]string, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, strings.TrimPrefix(key, prefix))
+	}
+	return tags, nil
+}
+
+// GetManifest 获取清单
+func (s *S3Storage) GetManifest(repository, reference string) ([]byte, string, error) {
+	if strings.HasPrefix(reference, "sha256:") {
+		return s.GetManifestByDigest(repository, reference)
+	}
+
+	digest, err := s.tagDigest(repository, reference)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.GetManifestByDigest(repository, digest)
+}
+
+// GetManifestByDigest 通过摘要获取清单
+func (s *S3Storage) GetManifestByDigest(repository, digest string) ([]byte, string, error) {
+	resp, err := s.do(http.MethodGet, s.key("repositories", repository, "_manifests", digest), nil, nil, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read manifest: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read manifest: %v", err)
+	}
+	return data, digest, nil
+}
+
+// PutManifest 存储清单
+func (s *S3Storage) PutManifest(repository, reference, digest string, manifest []byte) error {
+	header := http.Header{s3MetaDigest: {digest}}
+	if err := s.put(s.key("repositories", repository, "_manifests", digest), header, manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+
+	// 如果提供了标签引用，更新标签
+	if reference != "" && !strings.HasPrefix(reference, "sha256:") {
+		if err := s.put(s.key("repositories", repository, "tags", reference), header, nil); err != nil {
+			return fmt.Errorf("failed to write tag: %v", err)
+		}
+	}
+	return nil
+}
+
+// DeleteTag 删除标签对象
+func (s *S3Storage) DeleteTag(repository, tag string) error {
+	if _, err := s.tagDigest(repository, tag); err != nil {
+		return err
+	}
+	if err := s.delete(s.key("repositories", repository, "tags", tag)); err != nil {
+		return fmt.Errorf("failed to remove tag: %v", err)
+	}
+	return nil
+}
+
+// ListManifests 列出仓库中所有清单的摘要
+func (s *S3Storage) ListManifests(repository string) ([]string, error) {
+	digests, err := s.listNames(s.key("repositories", repository, "_manifests") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list manifests: %v", err)
+	}
+	return digests, nil
+}
+
+// DeleteManifest 删除清单
+func (s *S3Storage) DeleteManifest(repository, reference string) error {
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		var err error
+		if digest, err = s.tagDigest(repository, reference); err != nil {
+			return err
+		}
+		if err := s.delete(s.key("repositories", repository, "tags", reference)); err != nil {
+			return fmt.Errorf("failed to remove tag: %v", err)
+		}
+	}
+
+	if err := s.delete(s.key("repositories", repository, "_manifests", digest)); err != nil {
+		return fmt.Errorf("failed to remove manifest: %v", err)
+	}
+	return nil
+}
+
+// GetBlobSize 获取 blob 大小
+func (s *S3Storage) GetBlobSize(repository, digest string) (int64, error) {
+	resp, err := s.do(http.MethodHead, s.key("repositories", repository, "_blobs", digest), nil, nil, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat blob: %v", err)
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// GetBlob 获取 blob
+func (s *S3Storage) GetBlob(repository, digest string) (io.ReadCloser, int64, error) {
+	resp, err := s.do(http.MethodGet, s.key("repositories", repository, "_blobs", digest), nil, nil, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open blob: %v", err)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// PutBlob 流式写入 blob
+// 不超过一个分段时直接上传，否则使用分段上传，r 返回错误时中止上传
+func (s *S3Storage) PutBlob(repository, digest string, r io.Reader) (int64, error) {
+	key := s.key("repositories", repository, "_blobs", digest)
+	buf := make([]byte, s.config.PartSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if err := s.put(key, nil, buf[:n]); err != nil {
+			return 0, fmt.Errorf("failed to write blob: %v", err)
+		}
+		return int64(n), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read blob: %v", err)
+	}
+
+	upload, err := s.createMultipartUpload(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create multipart upload: %v", err)
+	}
+	for n > 0 {
+		if err := s.uploadPart(upload, buf[:n]); err != nil {
+			s.abortMultipartUpload(upload)
+			return 0, fmt.Errorf("failed to upload blob part: %v", err)
+		}
+		n, err = io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			s.abortMultipartUpload(upload)
+			return 0, fmt.Errorf("failed to read blob: %v", err)
+		}
+	}
+	if err := s.completeMultipartUpload(upload); err != nil {
+		return 0, fmt.Errorf("failed to complete blob upload: %v", err)
+	}
+	return upload.size, nil
+}
+
+// DeleteBlob 删除 blob
+func (s *S3Storage) DeleteBlob(repository, digest string) error {
+	if err := s.delete(s.key("repositories", repository, "_blobs", digest)); err != nil {
+		return fmt.Errorf("failed to remove blob: %v", err)
+	}
+	return nil
+}
+
+// ListBlobs 列出仓库中所有 blob 的摘要
+func (s *S3Storage) ListBlobs(repository string) ([]string, error) {
+	digests, err := s.listNames(s.key("repositories", repository, "_blobs") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %v", err)
+	}
+	return digests, nil
+}
+
+// listNames 列出前缀下一级对象的名称
+func (s *S3Storage) listNames(prefix string) ([]string, error) {
+	keys, _, err := s.list(prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, strings.TrimPrefix(key, prefix))
+	}
+	return names, nil
+}
+
+// MountBlob 在服务端把 from 仓库的 blob 复制到 repository，数据不经过本地
+func (s *S3Storage) MountBlob(repository, from, digest string) error {
+	source := s.key("repositories", from, "_blobs", digest)
+	resp, err := s.do(http.MethodHead, source, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to stat blob: %v", err)
+	}
+	resp.Body.Close()
+	if err := s.copyObject(source, s.key("repositories", repository, "_blobs", digest), resp.ContentLength); err != nil {
+		return fmt.Errorf("failed to mount blob: %v", err)
+	}
+	return nil
+}
+
+// InitiateUpload 初始化上传
+func (s *S3Storage) InitiateUpload(repository, uploadID string) error {
+	upload, err := s.createMultipartUpload(s.key("uploads", repository, uploadID))
+	if err != nil {
+		return fmt.Errorf("failed to create multipart upload: %v", err)
+	}
+
+	upload.updated = time.Now()
+	upload.hash = sha256.New()
+
+	s.mutex.Lock()
+	s.uploads[repository+"/"+uploadID] = upload
+	s.mutex.Unlock()
+	return nil
+}
+
+// AppendToUpload 追加数据到上传，凑满一个分段后上传到 S3
+func (s *S3Storage) AppendToUpload(repository, uploadID string, r io.Reader) (int64, error) {
+	upload, err := s.upload(repository, uploadID)
+	if err != nil {
+		return 0, err
+	}
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+
+	upload.updated = time.Now()
+	_, err = io.Copy(&s3UploadWriter{s: s, upload: upload}, r)
+	// 写入失败时也保存已接收的数据，客户端按返回的大小续传
+	if saveErr := s.savePending(upload); err == nil && saveErr != nil {
+		err = saveErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write to upload: %v", err)
+	}
+	return upload.size + int64(len(upload.pending)), nil
+}
+
+// savePending 把不足一个分段的数据和已接收数据的 sha256 状态保存到 bucket
+// 已上传的分段无法在完成前读取，其他实例只能从保存的状态恢复摘要，因此没有剩余数据时也保存 pending 对象
+func (s *S3Storage) savePending(upload *s3Upload) error {
+	size := upload.size + int64(len(upload.pending))
+	if size == 0 {
+		return s.removePending(upload)
+	}
+	header := http.Header{s3MetaUploadSize: {strconv.FormatInt(size, 10)}}
+	if upload.hash != nil {
+		state, err := upload.hash.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		header.Set(s3MetaUploadHash, base64.StdEncoding.EncodeToString(state))
+	}
+	if err := s.put(upload.pendingKey(), header, upload.pending); err != nil {
+		return err
+	}
+	upload.stored = true
+	return nil
+}
+
+// removePending 删除保存在 bucket 中的 pending 对象
+func (s *S3Storage) removePending(upload *s3Upload) error {
+	if !upload.stored {
+		return nil
+	}
+	if err := s.delete(upload.pendingKey()); err != nil && !errors.Is(err, errObjectNotFound) {
+		return err
+	}
+	upload.stored = false
+	return nil
+}
+
+// UploadHash 返回上传已接收数据的 sha256 状态的副本
+func (s *S3Storage) UploadHash(repository, uploadID string) (hash.Hash, error) {
+	upload, err := s.upload(repository, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+	if upload.hash == nil {
+		return nil, fmt.Errorf("sha256 state of upload %s is not available", uploadID)
+	}
+	state, err := upload.hash.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalSHA256(state)
+}
+
+// unmarshalSHA256 从 MarshalBinary 的结果恢复 sha256 状态
+func unmarshalSHA256(state []byte) (hash.Hash, error) {
+	hasher := sha256.New()
+	if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+	return hasher, nil
+}
+
+// GetUploadSize 返回上传已接收的字节数
+func (s *S3Storage) GetUploadSize(repository, uploadID string) (int64, error) {
+	upload, err := s.upload(repository, uploadID)
+	if err != nil {
+		return 0, err
+	}
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+	return upload.size + int64(len(upload.pending)), nil
+}
+
+// CompleteUpload 完成上传
+// 上传的对象键在开始时就已确定，完成后复制到 blob 的位置并删除上传对象
+func (s *S3Storage) CompleteUpload(repository, uploadID, digest string, r io.Reader) error {
+	upload, err := s.upload(repository, uploadID)
+	if err != nil {
+		return err
+	}
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+
+	if _, err := io.Copy(&s3UploadWriter{s: s, upload: upload}, r); err != nil {
+		return fmt.Errorf("failed to write to upload: %v", err)
+	}
+	// 最后一段可以小于分段大小
+	if len(upload.pending) > 0 || len(upload.parts) == 0 {
+		if err := s.uploadPart(upload, upload.pending); err != nil {
+			return fmt.Errorf("failed to upload part: %v", err)
+		}
+		upload.pending = nil
+	}
+	if err := s.completeMultipartUpload(upload); err != nil {
+		return fmt.Errorf("failed to complete upload: %v", err)
+	}
+
+	s.mutex.Lock()
+	delete(s.uploads, repository+"/"+uploadID)
+	s.mutex.Unlock()
+	if err := s.removePending(upload); err != nil {
+		return fmt.Errorf("failed to remove pending upload data: %v", err)
+	}
+
+	if err := s.copyObject(upload.key, s.key("repositories", repository, "_blobs", digest), upload.size); err != nil {
+		return fmt.Errorf("failed to move upload to blob: %v", err)
+	}
+	if err := s.delete(upload.key); err != nil {
+		return fmt.Errorf("failed to remove upload: %v", err)
+	}
+	return nil
+}
+
+// CancelUpload 取消上传，放弃分段上传
+func (s *S3Storage) CancelUpload(repository, uploadID string) error {
+	upload, err := s.upload(repository, uploadID)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	delete(s.uploads, repository+"/"+uploadID)
+	s.mutex.Unlock()
+
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+	s.abortUpload(upload)
+	return nil
+}
+
+// PurgeUploads 放弃最后一次写入早于 before 的上传，正在写入的上传不会被清理
+// 上传从 bucket 中列出，其他实例创建或重启前遗留的上传同样会被清理
+func (s *S3Storage) PurgeUploads(before time.Time) (int, error) {
+	prefix := s.key("uploads") + "/"
+	multipart, err := s.listMultipartUploads(prefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list multipart uploads: %v", err)
+	}
+
+	purged := 0
+	for _, m := range multipart {
+		if !m.Initiated.Before(before) {
+			continue
+		}
+		name := strings.TrimPrefix(m.Key, prefix)
+		s.mutex.Lock()
+		upload, cached := s.uploads[name]
+		s.mutex.Unlock()
+		if !cached || upload.uploadID != m.UploadID {
+			upload = &s3Upload{key: m.Key, uploadID: m.UploadID}
+		}
+		if !upload.mutex.TryLock() {
+			continue
+		}
+
+		updated := upload.updated
+		if !cached {
+			// 没有缓存时以最后上传的分段和 pending 对象的修改时间作为最后写入时间
+			if updated, err = s.lastModified(upload); err != nil {
+				upload.mutex.Unlock()
+				return purged, err
+			}
+		}
+		if updated.Before(before) {
+			s.mutex.Lock()
+			if s.uploads[name] == upload {
+				delete(s.uploads, name)
+			}
+			s.mutex.Unlock()
+			upload.stored = true
+			s.abortUpload(upload)
+			purged++
+		}
+		upload.mutex.Unlock()
+	}
+	return purged, nil
+}
+
+// abortUpload 放弃分段上传并删除保存的 pending 数据
+func (s *S3Storage) abortUpload(upload *s3Upload) {
+	s.abortMultipartUpload(upload)
+	if upload.stored {
+		s.delete(upload.pendingKey())
+	}
+}
+
+// s3UploadWriter 把写入的数据暂存在 pending 中，凑满一个分段后上传，调用方需持有上传的锁
+type s3UploadWriter struct {
+	s      *S3Storage
+	upload *s3Upload
+}
+
+func (w *s3UploadWriter) Write(p []byte) (int, error) {
+	partSize := w.s.config.PartSize
+	w.upload.pending = append(w.upload.pending, p...)
+	if w.upload.hash != nil {
+		w.upload.hash.Write(p)
+	}
+	for int64(len(w.upload.pending)) >= partSize {
+		if err := w.s.uploadPart(w.upload, w.upload.pending[:partSize]); err != nil {
+			return 0, err
+		}
+		w.upload.pending = append(w.upload.pending[:0], w.upload.pending[partSize:]...)
+	}
+	return len(p), nil
+}
+
+// upload 返回缓存的上传，没有缓存时从 bucket 恢复
+func (s *S3Storage) upload(repository, uploadID string) (*s3Upload, error) {
+	name := repository + "/" + uploadID
+	s.mutex.Lock()
+	upload, ok := s.uploads[name]
+	s.mutex.Unlock()
+	if ok {
+		return upload, nil
+	}
+
+	upload, err := s.loadUpload(s.key("uploads", repository, uploadID))
+	if err != nil {
+		return nil, err
+	}
+	if upload == nil {
+		return nil, fmt.Errorf("upload %s not found", uploadID)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// 并发请求可能已经恢复了同一个上传
+	if cached, ok := s.uploads[name]; ok {
+		return cached, nil
+	}
+	s.uploads[name] = upload
+	return upload, nil
+}
+
+// loadUpload 从 bucket 恢复上传：ListMultipartUploads 找到 UploadId，ListParts 取得已上传的分段，
+// 不足一个分段的数据和 sha256 状态从 pending 对象读取；上传不存在时返回 nil
+func (s *S3Storage) loadUpload(key string) (*s3Upload, error) {
+	multipart, err := s.listMultipartUploads(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list multipart uploads: %v", err)
+	}
+	var upload *s3Upload
+	for _, m := range multipart {
+		// 前缀也会匹配其他上传，同一个键有多个分段上传时使用最新的
+		if m.Key == key && (upload == nil || m.Initiated.After(upload.updated)) {
+			upload = &s3Upload{key: key, uploadID: m.UploadID, updated: m.Initiated}
+		}
+	}
+	if upload == nil {
+		return nil, nil
+	}
+
+	updated, err := s.listParts(upload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list parts: %v", err)
+	}
+	upload.updated = maxTime(upload.updated, updated)
+
+	resp, err := s.do(http.MethodGet, upload.pendingKey(), nil, nil, nil)
+	if errors.Is(err, errObjectNotFound) {
+		if upload.size == 0 {
+			upload.hash = sha256.New()
+		}
+		return upload, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending upload data: %v", err)
+	}
+	defer resp.Body.Close()
+	if upload.pending, err = io.ReadAll(resp.Body); err != nil {
+		return nil, fmt.Errorf("failed to read pending upload data: %v", err)
+	}
+	upload.stored = true
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		upload.updated = maxTime(upload.updated, modified)
+	}
+	// 上传分段后保存 pending 对象失败时状态与已接收的数据不一致，此时不使用保存的状态
+	size := strconv.FormatInt(upload.size+int64(len(upload.pending)), 10)
+	if state, err := base64.StdEncoding.DecodeString(resp.Header.Get(s3MetaUploadHash)); err == nil && len(state) > 0 && resp.Header.Get(s3MetaUploadSize) == size {
+		upload.hash, _ = unmarshalSHA256(state)
+	}
+	return upload, nil
+}
+
+// lastModified 返回上传最后一次写入的时间
+func (s *S3Storage) lastModified(upload *s3Upload) (time.Time, error) {
+	updated, err := s.listParts(upload)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to list parts: %v", err)
+	}
+	resp, err := s.do(http.MethodHead, upload.pendingKey(), nil, nil, nil)
+	if errors.Is(err, errObjectNotFound) {
+		return updated, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to stat pending upload data: %v", err)
+	}
+	resp.Body.Close()
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		updated = maxTime(updated, modified)
+	}
+	return updated, nil
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// key 拼接对象键
+func (s *S3Storage) key(elem ...string) string {
+	return s.config.Prefix + path.Join(elem...)
+}
+
+// tagDigest 从标签对象的元数据中读取摘要
+func (s *S3Storage) tagDigest(repository, tag string) (string, error) {
+	resp, err := s.do(http.MethodHead, s.key("repositories", repository, "tags", tag), nil, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to read tag: %v", err)
+	}
+	resp.Body.Close()
+
+	digest := resp.Header.Get(s3MetaDigest)
+	if digest == "" {
+		return "", fmt.Errorf("tag %s has no digest", tag)
+	}
+	return digest, nil
+}
+
+func (s *S3Storage) put(key string, header http.Header, body []byte) error {
+	resp, err := s.do(http.MethodPut, key, nil, header, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// list 列出前缀下的对象，delimiter 不为空时只列出当前层级
+func (s *S3Storage) list(prefix, delimiter string) ([]string, []string, error) {
+	var keys, prefixes []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			CommonPrefixes []struct {
+				Prefix string `xml:"Prefix"`
+			} `xml:"CommonPrefixes"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid list response: %v", err)
+		}
+
+		for _, content := range result.Contents {
+			keys = append(keys, content.Key)
+		}
+		for _, p := range result.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, prefixes, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3Storage) createMultipartUpload(key string) (*s3Upload, error) {
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return nil, fmt.Errorf("invalid multipart upload response: %v", err)
+	}
+	return &s3Upload{key: key, uploadID: result.UploadID}, nil
+}
+
+// listMultipartUploads 列出键以 prefix 开头的未完成分段上传
+func (s *S3Storage) listMultipartUploads(prefix string) ([]s3MultipartUpload, error) {
+	var uploads []s3MultipartUpload
+	keyMarker, uploadIDMarker := "", ""
+	for {
+		query := url.Values{"uploads": {""}, "prefix": {prefix}}
+		if keyMarker != "" {
+			query.Set("key-marker", keyMarker)
+			query.Set("upload-id-marker", uploadIDMarker)
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Uploads            []s3MultipartUpload `xml:"Upload"`
+			IsTruncated        bool                `xml:"IsTruncated"`
+			NextKeyMarker      string              `xml:"NextKeyMarker"`
+			NextUploadIDMarker string              `xml:"NextUploadIdMarker"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid list multipart uploads response: %v", err)
+		}
+
+		uploads = append(uploads, result.Uploads...)
+		if !result.IsTruncated || result.NextKeyMarker == "" {
+			return uploads, nil
+		}
+		keyMarker, uploadIDMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
+
+// listParts 从 ListParts 重建已上传的分段和大小，返回最后上传分段的时间
+func (s *S3Storage) listParts(upload *s3Upload) (time.Time, error) {
+	var parts []s3Part
+	var size int64
+	var updated time.Time
+	marker := ""
+	for {
+		query := url.Values{"uploadId": {upload.uploadID}}
+		if marker != "" {
+			query.Set("part-number-marker", marker)
+		}
+		resp, err := s.do(http.MethodGet, upload.key, query, nil, nil)
+		if err != nil {
+			return time.Time{}, err
+		}
+		var result struct {
+			Parts []struct {
+				s3Part
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Part"`
+			IsTruncated          bool   `xml:"IsTruncated"`
+			NextPartNumberMarker string `xml:"NextPartNumberMarker"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid list parts response: %v", err)
+		}
+
+		for _, part := range result.Parts {
+			parts = append(parts, part.s3Part)
+			size += part.Size
+			updated = maxTime(updated, part.LastModified)
+		}
+		if !result.IsTruncated || result.NextPartNumberMarker == "" {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+
+	// 分段按编号连续上传，编号必须从 1 开始连续，否则无法按顺序追加
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	for i, part := range parts {
+		if part.PartNumber != i+1 {
+			return time.Time{}, fmt.Errorf("missing part %d", i+1)
+		}
+	}
+	upload.parts, upload.size = parts, size
+	return updated, nil
+}
+
+func (s *S3Storage) uploadPart(upload *s3Upload, data []byte) error {
+	number := len(upload.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {upload.uploadID}}
+	resp, err := s.do(http.MethodPut, upload.key, query, nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	upload.parts = append(upload.parts, s3Part{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	upload.size += int64(len(data))
+	return nil
+}
+
+func (s *S3Storage) completeMultipartUpload(upload *s3Upload) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: upload.parts})
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPost, upload.key, url.Values{"uploadId": {upload.uploadID}}, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 完成分段上传时 S3 可能在 200 响应中返回错误
+	return checkS3ResponseBody(resp)
+}
+
+func (s *S3Storage) abortMultipartUpload(upload *s3Upload) {
+	if resp, err := s.do(http.MethodDelete, upload.key, url.Values{"uploadId": {upload.uploadID}}, nil, nil); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// copyObject 在服务端复制对象，超过 CopyObject 上限时使用分段复制
+func (s *S3Storage) copyObject(src, dst string, size int64) error {
+	source := "/" + s.config.Bucket + "/" + s3Escape(src, false)
+	if size <= maxS3CopySize {
+		resp, err := s.do(http.MethodPut, dst, nil, http.Header{"X-Amz-Copy-Source": {source}}, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return checkS3ResponseBody(resp)
+	}
+
+	upload, err := s.createMultipartUpload(dst)
+	if err != nil {
+		return err
+	}
+	partSize := int64(maxS3CopySize)
+	for offset := int64(0); offset < size; offset += partSize {
+		end := min(offset+partSize, size) - 1
+		number := len(upload.parts) + 1
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {upload.uploadID}}
+		header := http.Header{
+			"X-Amz-Copy-Source":       {source},
+			"X-Amz-Copy-Source-Range": {fmt.Sprintf("bytes=%d-%d", offset, end)},
+		}
+		resp, err := s.do(http.MethodPut, dst, query, header, nil)
+		if err != nil {
+			s.abortMultipartUpload(upload)
+			return err
+		}
+		var result struct {
+			ETag string `xml:"ETag"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			s.abortMultipartUpload(upload)
+			return fmt.Errorf("invalid copy part response: %v", err)
+		}
+		upload.parts = append(upload.parts, s3Part{PartNumber: number, ETag: result.ETag})
+	}
+	upload.size = size
+	return s.completeMultipartUpload(upload)
+}
+
+// do 发送签名后的请求，非 2xx 响应转换为错误
+func (s *S3Storage) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	p := "/" + key
+	if s.config.PathStyle {
+		p = "/" + s.config.Bucket + p
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+	}
+	u.Path, u.RawPath = p, s3Escape(p, false)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payloadHash := emptyPayloadSHA
+	if len(body) > 0 {
+		payloadHash = hex.EncodeToString(sha256Sum(body))
+	}
+	s.sign(req, payloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errObjectNotFound
+	}
+	return nil, s3ResponseError(resp)
+}
+
+// sign 使用 AWS Signature Version 4 签名请求，未配置凭据时匿名访问
+func (s *S3Storage) sign(req *http.Request, payloadHash string, now time.Time) {
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.config.AccessKey == "" {
+		return
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" || name == "content-type" || name == "content-md5" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := amzDate[:8] + "/" + s.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sha256Sum([]byte(canonicalRequest)))
+
+	key := []byte("AWS4" + s.config.SecretKey)
+	for _, part := range []string{amzDate[:8], s.config.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signedHeaders, signature))
+}
+
+// s3CanonicalQuery 按键排序并编码查询参数，签名和请求使用同一个结果
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape 按 SigV4 的规则编码，只保留非保留字符，路径中的 / 不编码
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// checkS3ResponseBody 检查 200 响应体中是否包含错误
+func checkS3ResponseBody(resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(data, []byte("<Error>")) {
+		return parseS3Error(resp.StatusCode, data)
+	}
+	return nil
+}
+
+func s3ResponseError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return parseS3Error(resp.StatusCode, data)
+}
+
+func parseS3Error(status int, data []byte) error {
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(data, &s3Err) != nil || s3Err.Code == "" {
+		return fmt.Errorf("s3 returned status %d", status)
+	}
+	return fmt.Errorf("s3 returned %s: %s", s3Err.Code, s3Err.Message)
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -1,30 +1,88 @@
 package storage
 
 import (
+	"hash"
 	"io"
+	"time"
 )
 
 // Storage 定义仓库存储接口
 type Storage interface {
-	// 仓库操作
+	// 仓库操作，按字典序返回，接口分页依赖该顺序
 	ListRepositories() ([]string, error)
 
-	// 标签操作
+	// 标签操作，按字典序返回
 	ListTags(repository string) ([]string, error)
 
 	// 清单操作
 	GetManifest(repository, reference string) ([]byte, string, error)
 	GetManifestByDigest(repository, digest string) ([]byte, string, error)
 	PutManifest(repository, reference, digest string, manifest []byte) error
+	// DeleteTag 只删除标签，标签指向的清单保留，可能仍被其他标签使用
+	DeleteTag(repository, tag string) error
+	// ListManifests 列出仓库中所有清单的摘要，包括没有标签指向的清单
+	ListManifests(repository string) ([]string, error)
 	DeleteManifest(repository, reference string) error
 
 	// Blob 操作
 	GetBlobSize(repository, digest string) (int64, error)
 	GetBlob(repository, digest string) (io.ReadCloser, int64, error)
+	// PutBlob 从 r 读取并存储 blob，r 返回错误时不保存任何内容
+	PutBlob(repository, digest string, r io.Reader) (int64, error)
 	DeleteBlob(repository, digest string) error
+	// ListBlobs 列出仓库中所有 blob 的摘要
+	ListBlobs(repository string) ([]string, error)
+	// MountBlob 把 from 仓库中已有的 blob 关联到 repository，不需要重新上传
+	MountBlob(repository, from, digest string) error
 
-	// 上传操作
+	// 上传操作，数据从请求体流式读取，不在内存中缓冲整个请求
 	InitiateUpload(repository, uploadID string) error
-	AppendToUpload(repository, uploadID string, data []byte) (int64, error)
-	CompleteUpload(repository, uploadID, digest string, data []byte) error
+	// AppendToUpload 从 r 读取数据追加到上传，返回上传的总大小
+	AppendToUpload(repository, uploadID string, r io.Reader) (int64, error)
+	// GetUploadSize 返回上传已接收的字节数
+	GetUploadSize(repository, uploadID string) (int64, error)
+	// CompleteUpload 追加 r 中剩余的数据并把上传保存为 blob，digest 由调用方在写入数据时校验
+	CompleteUpload(repository, uploadID, digest string, r io.Reader) error
+	// CancelUpload 取消上传并删除已接收的数据
+	CancelUpload(repository, uploadID string) error
+	// PurgeUploads 删除最后一次写入早于 before 的上传，返回删除的数量
+	PurgeUploads(before time.Time) (int, error)
+}
+
+// BlobPruner 由多个仓库共享 blob 数据的存储实现，删除 blob 只移除仓库的引用，
+// 数据需要在没有任何仓库引用后单独清理
+type BlobPruner interface {
+	// PruneBlobs 删除不再被任何仓库引用的 blob 数据，dryRun 时只返回将被删除的摘要
+	PruneBlobs(dryRun bool) ([]string, error)
+}
+
+// UploadReader 能够读取未完成上传已接收数据的存储实现，进程重启后据此重建上传的摘要状态
+type UploadReader interface {
+	// ReadUpload 返回上传已接收的数据
+	ReadUpload(repository, uploadID string) (io.ReadCloser, error)
+}
+
+// UploadHasher 无法读取未完成上传数据的存储实现 (例如 S3 的分段上传) 在写入时记录已接收数据的 sha256 状态，
+// 进程重启或上传由其他实例创建时据此恢复上传的摘要状态
+type UploadHasher interface {
+	// UploadHash 返回上传已接收数据的 sha256 状态的副本，状态不可用时返回错误
+	UploadHash(repository, uploadID string) (hash.Hash, error)
+}
+
+// BlobModTimer 能够返回 blob 最后写入时间的存储实现，垃圾回收据此跳过正在推送的镜像的 blob
+type BlobModTimer interface {
+	// BlobModTime 返回 blob 最后一次写入仓库 (上传或挂载) 的时间
+	BlobModTime(repository, digest string) (time.Time, error)
+}
+
+// ManifestModTimer 能够返回清单最后修改时间的存储实现，用于设置 Last-Modified
+type ManifestModTimer interface {
+	// ManifestModTime 返回引用最后一次写入的时间，引用是标签时为标签最后一次更新的时间
+	ManifestModTime(repository, reference string) (time.Time, error)
+}
+
+// CreateStorage 根据类型创建存储，file 和 distribution 类型需要指定根目录
+// 其他参数的驱动使用 New 创建
+func CreateStorage(storageType, rootDir string) (Storage, error) {
+	return New(storageType, Parameters{"rootdirectory": rootDir})
 }